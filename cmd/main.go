@@ -10,6 +10,7 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -27,9 +28,15 @@ import (
 
 	"arker/internal/archivers"
 	"arker/internal/brightdata"
+	"arker/internal/cookiejars"
+	"arker/internal/feeds"
+	"arker/internal/gitcache"
 	"arker/internal/handlers"
+	"arker/internal/health"
+	"arker/internal/manifest"
 	"arker/internal/models"
 	"arker/internal/monitoring"
+	"arker/internal/timestamp"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/postgres"
@@ -42,17 +49,20 @@ import (
 )
 
 type Config struct {
-	DBURL          string `envconfig:"DB_URL" default:"host=localhost user=user password=pass dbname=arker port=5432 sslmode=disable"`
-	StoragePath    string `envconfig:"STORAGE_PATH" default:"./storage"`
-	CachePath      string `envconfig:"CACHE_PATH" default:"./cache"`
-	MaxWorkers     int    `envconfig:"MAX_WORKERS" default:"5"`
-	Port           string `envconfig:"PORT" default:"8080"`
-	GinMode        string `envconfig:"GIN_MODE" default:"release"`
-	TrustedProxies string `envconfig:"TRUSTED_PROXIES" default:"127.0.0.1,::1,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16"`
-	SessionSecret  string `envconfig:"SESSION_SECRET"`
-	AdminUsername  string `envconfig:"ADMIN_USERNAME" default:"admin"`
-	AdminPassword  string `envconfig:"ADMIN_PASSWORD" default:"admin"`
-	LoginText      string `envconfig:"LOGIN_TEXT"`
+	DBURL       string `envconfig:"DB_URL" default:"host=localhost user=user password=pass dbname=arker port=5432 sslmode=disable"`
+	StoragePath string `envconfig:"STORAGE_PATH" default:"./storage"`
+	CachePath   string `envconfig:"CACHE_PATH" default:"./cache"`
+	// GitCacheMaxBytes bounds the repositories unpacked under CachePath for
+	// clones and the repository browser; 0 never evicts.
+	GitCacheMaxBytes int64  `envconfig:"GIT_CACHE_MAX_BYTES" default:"10737418240"`
+	MaxWorkers       int    `envconfig:"MAX_WORKERS" default:"5"`
+	Port             string `envconfig:"PORT" default:"8080"`
+	GinMode          string `envconfig:"GIN_MODE" default:"release"`
+	TrustedProxies   string `envconfig:"TRUSTED_PROXIES" default:"127.0.0.1,::1,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16"`
+	SessionSecret    string `envconfig:"SESSION_SECRET"`
+	AdminUsername    string `envconfig:"ADMIN_USERNAME" default:"admin"`
+	AdminPassword    string `envconfig:"ADMIN_PASSWORD" default:"admin"`
+	LoginText        string `envconfig:"LOGIN_TEXT"`
 
 	// S3 Configuration
 	StorageType      string `envconfig:"STORAGE_TYPE" default:"filesystem"` // "filesystem" or "s3"
@@ -66,6 +76,13 @@ type Config struct {
 	S3TempDir        string `envconfig:"S3_TEMP_DIR" default:"/tmp"`          // Temp directory for upload buffering
 	S3PublicBaseURL  string `envconfig:"S3_PUBLIC_BASE_URL"`                  // Optional public bucket/CDN base URL
 
+	// Replicated storage: every object is also copied to these secondaries,
+	// comma-separated file:///path or s3://KEY:SECRET@bucket/prefix?endpoint=...
+	// locations (see storage.OpenBackend). Empty keeps one copy.
+	StorageReplicas       string        `envconfig:"STORAGE_REPLICAS"`
+	ReplicaRepairInterval time.Duration `envconfig:"REPLICA_REPAIR_INTERVAL" default:"10m"`
+	ReplicaRepairBatch    int           `envconfig:"REPLICA_REPAIR_BATCH" default:"200"` // Replicas copied per repair pass
+
 	// S3DirectURLExpiration controls presigned archive download URL lifetime.
 	S3DirectURLExpiration time.Duration `envconfig:"S3_DIRECT_URL_EXPIRATION" default:"12h"`
 
@@ -81,10 +98,83 @@ type Config struct {
 	YtDlpCookiesB64  string `envconfig:"YTDLP_COOKIES_B64"`  // Base64-encoded cookies.txt content (used when no file path is set)
 	YtDlpProxy       string `envconfig:"YTDLP_PROXY"`        // Optional proxy (e.g. residential); Instagram throttles datacenter IPs
 	YtDlpImpersonate string `envconfig:"YTDLP_IMPERSONATE"`  // Optional yt-dlp --impersonate target (Docker defaults to chrome)
+	// CookieJarKey encrypts the per-host cookie jars uploaded at
+	// /admin/cookie-jars. Unset disables stored jars; the env jar above
+	// still works. Changing it makes every stored jar unreadable.
+	CookieJarKey string `envconfig:"COOKIE_JAR_KEY"`
 	// SubtitleLangs overrides which caption tracks are fetched. Empty computes
 	// the default per video: its own language plus English. Passed to yt-dlp's
 	// --sub-langs verbatim, so "all,-live_chat" hoards every translation.
 	SubtitleLangs string `envconfig:"ARKER_SUB_LANGS"`
+	// PlaylistMaxEntries caps how many videos one playlist or channel capture
+	// queues, first listed first.
+	PlaylistMaxEntries int `envconfig:"PLAYLIST_MAX_ENTRIES" default:"200"`
+
+	// Feed subscriptions managed at /admin/feeds. A feed without its own
+	// interval is polled this often; never more often than every 5 minutes.
+	FeedPollInterval time.Duration `envconfig:"FEED_POLL_INTERVAL" default:"1h"`
+
+	// Local speech-to-text for videos with no captions at all. Empty model
+	// disables it; the binary must be whisper.cpp-compatible.
+	WhisperPath        string        `envconfig:"WHISPER_PATH" default:"whisper-cli"`
+	WhisperModel       string        `envconfig:"WHISPER_MODEL"`                      // Path to a ggml model file
+	WhisperMaxDuration time.Duration `envconfig:"WHISPER_MAX_DURATION" default:"15m"` // Longer videos are not transcribed
+	WhisperTimeout     time.Duration `envconfig:"WHISPER_TIMEOUT" default:"10m"`
+	WhisperThreads     int           `envconfig:"WHISPER_THREADS"` // 0 lets the binary choose
+
+	// Health monitoring. Checks run at startup and then on this interval.
+	HealthCheckInterval time.Duration `envconfig:"HEALTH_CHECK_INTERVAL" default:"5m"`
+	YtDlpStaleAfter     time.Duration `envconfig:"YTDLP_STALE_AFTER" default:"1440h"`   // yt-dlp older than this reports degraded
+	HealthQueueLagWarn  time.Duration `envconfig:"HEALTH_QUEUE_LAG_WARN" default:"15m"` // Oldest waiting job older than this reports degraded
+
+	// HLS packaging of long videos, for seeking without range requests into
+	// one huge MP4. Runs as its own job after the video is archived.
+	HLSEnabled        bool          `envconfig:"HLS_ENABLED"`
+	HLSMinDuration    time.Duration `envconfig:"HLS_MIN_DURATION" default:"20m"` // Shorter videos are not packaged
+	HLSSegmentSeconds int           `envconfig:"HLS_SEGMENT_SECONDS" default:"6"`
+	HLSRenditions     string        `envconfig:"HLS_RENDITIONS" default:"source"` // "source" and/or heights, e.g. "source,720,480"
+	HLSTimeout        time.Duration `envconfig:"HLS_TIMEOUT" default:"3h"`
+
+	// Live streams are recorded for a bounded window instead of downloaded.
+	LiveMaxDuration        time.Duration `envconfig:"LIVE_MAX_DURATION" default:"2h"`
+	LiveFromStart          bool          `envconfig:"LIVE_FROM_START"`                        // Record from the broadcast's start where the extractor supports it
+	LiveCheckpointInterval time.Duration `envconfig:"LIVE_CHECKPOINT_INTERVAL" default:"10m"` // How often the growing recording is stored
+
+	// Print-to-PDF captures of web pages.
+	PDFPaperSize string `envconfig:"PDF_PAPER_SIZE" default:"A4"` // Letter, Legal, Tabloid, Ledger or A0-A6
+	PDFDefault   bool   `envconfig:"PDF_DEFAULT"`                 // Print every web page capture, not only when asked for
+
+	// Git captures. Submodules are captured as repositories of their own;
+	// LFS content is stored in the capture up to this many bytes.
+	GitLFSMaxBytes int64 `envconfig:"GIT_LFS_MAX_BYTES" default:"4294967296"`
+
+	// ManifestSigningKey signs capture manifests: a base64 ed25519 seed.
+	// Unset generates one and keeps it in the database. Changing it leaves
+	// manifests signed before verifiable only with the old public key.
+	ManifestSigningKey string `envconfig:"MANIFEST_SIGNING_KEY"`
+	// RFC 3161 timestamping of signed manifests. Unset TSAURL leaves
+	// manifests untimestamped; unset TSACAFile trusts the system roots.
+	TSAURL    string `envconfig:"TSA_URL"`     // e.g. https://freetsa.org/tsr
+	TSACAFile string `envconfig:"TSA_CA_FILE"` // PEM roots the TSA's certificate must chain to
+
+	// Fixity auditing re-reads stored artifacts against the checksum and size
+	// recorded when they were written. 0 interval disables the periodic pass.
+	FixityAuditInterval time.Duration `envconfig:"FIXITY_AUDIT_INTERVAL" default:"1h"`
+	FixityAuditRate     int64         `envconfig:"FIXITY_AUDIT_RATE" default:"8388608"` // Bytes per second read; 0 is unthrottled
+	FixityAuditBatch    int           `envconfig:"FIXITY_AUDIT_BATCH" default:"500"`    // Items audited per pass
+
+	// Forge (project) captures: issues, pull requests, releases and wikis read
+	// from a code host's API. github.com, gitlab.com, codeberg.org and
+	// gitea.com are always known.
+	ForgeHosts         string `envconfig:"FORGE_HOSTS"`                                // Self-hosted instances: "git.example.org=gitea,code.example.com=gitlab"
+	ForgeTokens        string `envconfig:"FORGE_TOKENS"`                               // API tokens: "github.com=ghp_...,gitlab.com=glpat-..."
+	ForgeMaxThreads    int    `envconfig:"FORGE_MAX_THREADS" default:"1000"`           // Newest issues and pull requests kept per project
+	ForgeMaxAssetSize  int64  `envconfig:"FORGE_MAX_ASSET_SIZE" default:"2147483648"`  // Largest release asset stored, in bytes
+	ForgeMaxAssetTotal int64  `envconfig:"FORGE_MAX_ASSET_TOTAL" default:"4294967296"` // Release assets stored per project, in bytes
+
+	// Non-HTML URLs are detected with a HEAD request when submitted and stored
+	// byte for byte. 0 disables the probe; every URL is then treated as a page.
+	FileProbeTimeout time.Duration `envconfig:"FILE_PROBE_TIMEOUT" default:"5s"`
 
 	// gallery-dl Configuration (photo posts and mixed photo/video carousels)
 	GalleryDlUserAgent    string `envconfig:"GALLERYDL_USER_AGENT"`    // Optional UA override; empty keeps gallery-dl's per-site defaults
@@ -181,6 +271,49 @@ func generateRandomSecret() string {
 	return hex.EncodeToString(bytes)
 }
 
+// loadManifestSigner returns the signer for capture manifests: the key from
+// the environment, or else the one kept in the database, generated on first
+// boot.
+func loadManifestSigner(db *gorm.DB, configured string) (*manifest.Signer, error) {
+	encoded := configured
+	if encoded == "" {
+		generated, err := manifest.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		if encoded, err = getOrCreateConfigValue(db, "manifest_signing_key", generated); err != nil {
+			return nil, err
+		}
+		if encoded == generated {
+			log.Println("Generated new manifest signing key and stored in database")
+		}
+	}
+	key, err := manifest.ParsePrivateKey(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return manifest.NewSigner(key), nil
+}
+
+// loadTimestampAuthority returns the TSA manifests are timestamped by, or nil
+// when none is configured.
+func loadTimestampAuthority(url, caFile string) (*timestamp.Authority, error) {
+	if url == "" {
+		return nil, nil
+	}
+	tsa := &timestamp.Authority{URL: url}
+	if caFile != "" {
+		pemData, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		if tsa.Roots, err = timestamp.LoadRoots(pemData); err != nil {
+			return nil, fmt.Errorf("%s: %w", caFile, err)
+		}
+	}
+	return tsa, nil
+}
+
 // getOrCreateConfigValue retrieves a config value from database or creates it with a default
 func getOrCreateConfigValue(db *gorm.DB, key string, defaultValue string) (string, error) {
 	return utils.GetOrCreateConfigValue(db, key, defaultValue)
@@ -386,6 +519,12 @@ func parseTrustedProxies(value string) []string {
 }
 
 func main() {
+	// `arker verify` checks a downloaded capture offline; it needs none of
+	// the server's configuration.
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		os.Exit(runVerify(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	// Initialize structured logging
 	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
 		Level:     slog.LevelInfo,
@@ -441,6 +580,38 @@ func main() {
 		slog.Error("AutoMigrate failed with detailed error", "error", err, "error_type", fmt.Sprintf("%T", err), "error_string", err.Error())
 		slog.Info("Continuing startup despite AutoMigrate error")
 	}
+	// Separate call: AutoMigrate stops at the first model that fails, and on
+	// existing deployments the call above fails before reaching a new table.
+	if err := db.AutoMigrate(&models.CookieJar{}); err != nil {
+		slog.Error("Cookie jar table migration failed", "error", err)
+	}
+	if err := db.AutoMigrate(&models.PlaylistEntry{}); err != nil {
+		slog.Error("Playlist entry table migration failed", "error", err)
+	}
+	if err := db.AutoMigrate(&models.GitSubmodule{}); err != nil {
+		slog.Error("Git submodule table migration failed", "error", err)
+	}
+	if err := db.AutoMigrate(&models.GitExport{}); err != nil {
+		slog.Error("Git export table migration failed", "error", err)
+	}
+	if err := db.AutoMigrate(&models.CaptureManifest{}); err != nil {
+		slog.Error("Capture manifest table migration failed", "error", err)
+	}
+	if err := db.AutoMigrate(&models.CaptureTimestamp{}); err != nil {
+		slog.Error("Capture timestamp table migration failed", "error", err)
+	}
+	if err := db.AutoMigrate(&models.StorageReplica{}); err != nil {
+		slog.Error("Storage replica table migration failed", "error", err)
+	}
+	if err := db.AutoMigrate(&models.FixityAudit{}, &models.FixityBaseline{}); err != nil {
+		slog.Error("Fixity audit table migration failed", "error", err)
+	}
+	if err := db.AutoMigrate(&models.HLSPackage{}); err != nil {
+		slog.Error("HLS package table migration failed", "error", err)
+	}
+	if err := db.AutoMigrate(&models.FeedSubscription{}, &models.FeedEntry{}, &models.FeedEnclosure{}); err != nil {
+		slog.Error("Feed subscription table migration failed", "error", err)
+	}
 	// Composite index for the queue-position and status-count queries that run on
 	// every archive page view / dashboard load. CreatedAt is embedded in
 	// gorm.Model, so this is expressed as raw SQL rather than a struct tag.
@@ -453,6 +624,9 @@ func main() {
 	if err := utils.EnsureCompletenessSchema(db); err != nil {
 		slog.Error("Completeness column migration failed", "error", err)
 	}
+	if err := utils.EnsureQualityPolicySchema(db); err != nil {
+		slog.Error("Quality policy column migration failed", "error", err)
+	}
 	if err := utils.ConfigureArchiveItemLogSchema(db); err != nil {
 		slog.Error("Archive log schema configuration failed", "error", err)
 	} else if err := utils.BackfillLegacyArchiveItemLogs(db); err != nil {
@@ -489,8 +663,22 @@ func main() {
 		}
 	}
 
+	manifestSigner, err := loadManifestSigner(db, cfg.ManifestSigningKey)
+	if err != nil {
+		log.Fatalf("Failed to load manifest signing key: %v", err)
+	}
+	slog.Info("Capture manifests signed", "key_id", manifestSigner.KeyID())
+	timestampAuthority, err := loadTimestampAuthority(cfg.TSAURL, cfg.TSACAFile)
+	if err != nil {
+		log.Fatalf("Failed to load TSA roots: %v", err)
+	}
+	if timestampAuthority != nil {
+		slog.Info("Capture manifests timestamped", "tsa", timestampAuthority.URL)
+	}
+
 	// Initialize storage backend
 	var baseStorage storage.SeekableStorage
+	var baseStorageName string
 	var storageErr error
 
 	switch cfg.StorageType {
@@ -517,13 +705,41 @@ func main() {
 		if storageErr != nil {
 			log.Fatalf("Failed to initialize S3 storage: %v", storageErr)
 		}
+		baseStorageName = storage.S3BackendName(cfg.S3Bucket, cfg.S3Prefix)
 
 	default: // "filesystem"
 		log.Printf("Initializing filesystem storage (path: %s)", cfg.StoragePath)
 		baseStorage = storage.NewFSStorage(cfg.StoragePath)
+		absPath, err := filepath.Abs(cfg.StoragePath)
+		if err != nil {
+			absPath = cfg.StoragePath
+		}
+		baseStorageName = "file://" + filepath.ToSlash(absPath)
 	}
 
 	storageInstance := baseStorage
+	var replicatedStorage *storage.ReplicatedStorage
+	var secondaries []storage.Backend
+	for _, location := range strings.Split(cfg.StorageReplicas, ",") {
+		if location = strings.TrimSpace(location); location == "" {
+			continue
+		}
+		backend, err := storage.OpenBackend(context.Background(), location, cfg.S3TempDir)
+		if err != nil {
+			log.Fatalf("Failed to initialize storage replica: %v", err)
+		}
+		if backend.Name == baseStorageName {
+			log.Fatalf("Storage replica %s is the primary storage", backend.Name)
+		}
+		secondaries = append(secondaries, backend)
+	}
+	if len(secondaries) > 0 {
+		replicatedStorage = storage.NewReplicatedStorage(db, storage.Backend{Name: baseStorageName, Storage: baseStorage}, secondaries...)
+		storageInstance = replicatedStorage
+		for _, backend := range replicatedStorage.Backends() {
+			slog.Info("Replicated storage backend", "name", backend.Name)
+		}
+	}
 
 	// Populate file sizes for existing archives
 	populateFileSizes(db, storageInstance)
@@ -547,6 +763,14 @@ func main() {
 	default:
 		slog.Warn("No media cookies configured; posts on sites requiring login (e.g. Instagram) will fail to archive")
 	}
+	cookieStore, err := cookiejars.NewStore(db, cfg.CookieJarKey)
+	if err != nil {
+		log.Fatalf("Failed to initialize cookie jar store: %v", err)
+	}
+	if cookieStore.Enabled() {
+		utils.SetMediaCookieJars(cookieStore.Pick, cookieStore.Has)
+		slog.Info("Stored per-host cookie jars enabled")
+	}
 	if proxy := utils.InitYtDlpProxy(cfg.YtDlpProxy); proxy != "" {
 		slog.Info("Media proxy configured")
 	}
@@ -556,6 +780,56 @@ func main() {
 	if langs := utils.InitYtDlpSubtitleLangs(cfg.SubtitleLangs); langs != "" {
 		slog.Info("Subtitle language override configured", "sub_langs", langs)
 	}
+	if transcription := utils.InitTranscription(utils.TranscriptionConfig{
+		Binary:      cfg.WhisperPath,
+		Model:       cfg.WhisperModel,
+		MaxDuration: cfg.WhisperMaxDuration,
+		Timeout:     cfg.WhisperTimeout,
+		Threads:     cfg.WhisperThreads,
+	}); transcription.Enabled() {
+		slog.Info("Local transcription enabled", "binary", transcription.Binary, "model", transcription.Model, "max_duration", transcription.MaxDuration)
+	}
+	hlsRenditions, err := utils.ParseHLSRenditions(cfg.HLSRenditions)
+	if err != nil {
+		log.Fatalf("Invalid HLS_RENDITIONS: %v", err)
+	}
+	if hls := utils.InitHLS(utils.HLSConfig{
+		Enabled:        cfg.HLSEnabled,
+		MinDuration:    cfg.HLSMinDuration,
+		SegmentSeconds: cfg.HLSSegmentSeconds,
+		Renditions:     hlsRenditions,
+		Timeout:        cfg.HLSTimeout,
+	}); hls.Enabled {
+		slog.Info("HLS packaging enabled", "min_duration", hls.MinDuration, "renditions", strings.Join(hls.Renditions, ","))
+	}
+	utils.InitLive(utils.LiveConfig{
+		MaxDuration:        cfg.LiveMaxDuration,
+		FromStart:          cfg.LiveFromStart,
+		CheckpointInterval: cfg.LiveCheckpointInterval,
+	})
+	pdfPaperSize, err := utils.ParsePDFPaperSize(cfg.PDFPaperSize)
+	if err != nil {
+		log.Fatalf("Invalid PDF_PAPER_SIZE: %v", err)
+	}
+	utils.InitPDF(utils.PDFConfig{PaperSize: pdfPaperSize, Default: cfg.PDFDefault})
+	forgeHosts, err := utils.ParseForgeHosts(cfg.ForgeHosts)
+	if err != nil {
+		log.Fatalf("Invalid FORGE_HOSTS: %v", err)
+	}
+	forgeTokens, err := utils.ParseForgeTokens(cfg.ForgeTokens)
+	if err != nil {
+		log.Fatalf("Invalid FORGE_TOKENS: %v", err)
+	}
+	utils.InitForge(utils.ForgeConfig{
+		Hosts:          forgeHosts,
+		Tokens:         forgeTokens,
+		MaxThreads:     cfg.ForgeMaxThreads,
+		MaxAssetBytes:  cfg.ForgeMaxAssetSize,
+		MaxAssetsTotal: cfg.ForgeMaxAssetTotal,
+	})
+	if cfg.FileProbeTimeout > 0 {
+		utils.SetRemoteContentProbe(utils.NewHTTPContentProbe(cfg.FileProbeTimeout))
+	}
 	if userAgent := utils.InitGalleryDlUserAgent(cfg.GalleryDlUserAgent); userAgent != "" {
 		slog.Info("gallery-dl user agent override configured", "user_agent", userAgent)
 	}
@@ -563,16 +837,6 @@ func main() {
 		slog.Info("gallery-dl request interval override configured", "sleep_request", sleepRequest)
 	}
 
-	// Perform health checks on startup
-	log.Println("Performing startup health checks...")
-	healthConfig := utils.DefaultHealthCheckConfig()
-	if err := utils.RunHealthChecks(healthConfig); err != nil {
-		log.Printf("Health check warning: %v", err)
-		// Continue startup even if health checks fail (non-critical)
-	} else {
-		log.Println("All health checks passed")
-	}
-
 	// Default user
 	var user models.User
 	if db.First(&user).Error == gorm.ErrRecordNotFound {
@@ -585,14 +849,36 @@ func main() {
 		log.Printf("Created default admin user: %s/%s", cfg.AdminUsername, cfg.AdminPassword)
 	}
 
+	// Dependency health: the first run happens at startup (below, once Bright
+	// Data is configured), then every HEALTH_CHECK_INTERVAL. Types whose
+	// dependency is down are refused at queue time rather than failing later.
+	allTypes := utils.CanonicalArchiveTypes()
+	mediaTypes := []string{utils.ArchiveTypeYtDlp, utils.ArchiveTypeGalleryDl, utils.ArchiveTypeAudio}
+	healthChecks := []health.Check{
+		health.DatabaseCheck(db, allTypes),
+		health.StorageCheck(storageInstance, allTypes),
+		health.YtDlpCheck([]string{utils.ArchiveTypeYtDlp, utils.ArchiveTypePlaylist, utils.ArchiveTypeAudio}, cfg.YtDlpStaleAfter),
+		health.CommandCheck("gallery-dl", []string{utils.ArchiveTypeGalleryDl}, "gallery-dl", "--version"),
+		health.CommandCheck("itch-dl", []string{utils.ArchiveTypeItch},
+			"python3", "-c", "import importlib.metadata as m; print(m.version('itch-dl'))"),
+		health.PlaywrightCheck([]string{utils.ArchiveTypeMHTML, utils.ArchiveTypeScreenshot, utils.ArchiveTypePDF}, 30*time.Second),
+		health.CookiesCheck(mediaTypes, 7*24*time.Hour),
+		health.QueueLagCheck(db, cfg.HealthQueueLagWarn),
+	}
+
 	// No shared browser manager - each job creates its own browser instance
 	archiversMap := map[string]archivers.Archiver{
 		utils.ArchiveTypeMHTML:      &archivers.MHTMLArchiver{},
 		utils.ArchiveTypeScreenshot: &archivers.ScreenshotArchiver{},
-		utils.ArchiveTypeGit:        &archivers.GitArchiver{},
+		utils.ArchiveTypeGit:        &archivers.GitArchiver{Store: storageInstance, LFSMaxBytes: cfg.GitLFSMaxBytes},
 		utils.ArchiveTypeYtDlp:      &archivers.YtDlpArchiver{},
 		utils.ArchiveTypeGalleryDl:  &archivers.GalleryDLArchiver{},
 		utils.ArchiveTypeItch:       &archivers.ItchArchiver{ItchDlPath: cfg.ItchDlPath, APIKey: cfg.ItchAPIKey},
+		utils.ArchiveTypePlaylist:   &archivers.PlaylistArchiver{MaxEntries: cfg.PlaylistMaxEntries},
+		utils.ArchiveTypeAudio:      &archivers.AudioArchiver{},
+		utils.ArchiveTypePDF:        &archivers.PDFArchiver{},
+		utils.ArchiveTypeFile:       &archivers.FileArchiver{},
+		utils.ArchiveTypeForge:      &archivers.ForgeArchiver{},
 	}
 
 	// Bright Data fallback: wraps the media archivers so a failed native run on
@@ -617,6 +903,7 @@ func main() {
 		// table lives in exactly one place.
 		if bdClient.Enabled() {
 			utils.SetBrightDataMediaFallback(bdClient.SupportsFallback)
+			healthChecks = append(healthChecks, health.BrightDataCheck(bdClient.Ping))
 		}
 		slog.Info("Bright Data media fallback configured",
 			"datasets", bdClient.Enabled(),
@@ -625,7 +912,23 @@ func main() {
 		slog.Info("Bright Data media fallback not configured (BRIGHTDATA_API_KEY unset)")
 	}
 
-	os.MkdirAll(cfg.CachePath, 0755)
+	gitCache, err := gitcache.New(cfg.CachePath, cfg.GitCacheMaxBytes, storageInstance)
+	if err != nil {
+		log.Fatalf("Failed to open git cache: %v", err)
+	}
+
+	log.Println("Performing startup health checks...")
+	healthMonitor := health.NewMonitor(cfg.HealthCheckInterval, healthChecks...)
+	healthMonitor.RunOnce(context.Background())
+	if report := healthMonitor.Report(); report.Status == health.StatusOK {
+		log.Println("All health checks passed")
+	} else {
+		// Startup continues: the monitor keeps checking and queueing refuses
+		// only the affected types.
+		log.Printf("Health check warning: status %s, unavailable types %v", report.Status, report.UnavailableTypes)
+	}
+	utils.SetArchiveTypeHealth(healthMonitor.Unavailable)
+	healthMonitor.Start(context.Background())
 
 	// Initialize browser monitoring
 	monitor := monitoring.GetGlobalMonitor()
@@ -659,17 +962,40 @@ func main() {
 	// Backfills thumbnails for archives captured before the feature existed.
 	// New captures produce theirs inline and never enqueue this.
 	river.AddWorker(riverWorkers, workers.NewThumbnailWorker(storageInstance, db))
+	// Packages long videos as HLS after they are archived.
+	river.AddWorker(riverWorkers, workers.NewHLSWorker(storageInstance, db))
+	// Extracts reader-mode articles from MHTML captured before inline extraction.
+	river.AddWorker(riverWorkers, workers.NewReaderWorker(storageInstance, db))
+	// Signs each capture's manifest once its last item has finished.
+	river.AddWorker(riverWorkers, workers.NewManifestWorker(storageInstance, db, manifestSigner, timestampAuthority))
+	// Has each signed manifest timestamped, when TSA_URL is set.
+	river.AddWorker(riverWorkers, workers.NewTimestampWorker(storageInstance, db, timestampAuthority))
+	// Re-reads stored artifacts to catch loss and corruption.
+	river.AddWorker(riverWorkers, workers.NewFixityWorker(storageInstance, db, cfg.FixityAuditRate, cfg.FixityAuditBatch))
+	// Copies objects to the replicas missing them, when STORAGE_REPLICAS is set.
+	river.AddWorker(riverWorkers, workers.NewReplicaRepairWorker(replicatedStorage, cfg.ReplicaRepairBatch))
+	var periodicJobs []*river.PeriodicJob
+	if cfg.FixityAuditInterval > 0 {
+		periodicJobs = append(periodicJobs, workers.NewFixityAuditPeriodicJob(cfg.FixityAuditInterval))
+	}
+	if replicatedStorage != nil && cfg.ReplicaRepairInterval > 0 {
+		periodicJobs = append(periodicJobs, workers.NewReplicaRepairPeriodicJob(cfg.ReplicaRepairInterval))
+	}
 	// Create River client with configuration
 	errorHandler := &CustomErrorHandler{db: db}
-	timeoutConfig := utils.DefaultTimeoutConfig()
-	jobTimeout := timeoutConfig.YtDlpMaxTimeout + 30*time.Minute
-	rescueStuckJobsAfter := jobTimeout + 5*time.Minute
+	jobTimeout := utils.ArchiveJobTimeout()
+	// Past the longest any job may run, which a long LIVE_MAX_DURATION
+	// extends for video and audio jobs.
+	rescueStuckJobsAfter := max(jobTimeout, utils.ArchiveJobTimeoutFor(utils.ArchiveTypeYtDlp)) + 5*time.Minute
 	riverConfig := &river.Config{
 		Queues: map[string]river.QueueConfig{
-			river.QueueDefault: {MaxWorkers: cfg.MaxWorkers},
-			"high_priority":    {MaxWorkers: max(2, cfg.MaxWorkers/2)}, // At least 2 workers, or half of total workers
+			river.QueueDefault:       {MaxWorkers: cfg.MaxWorkers},
+			"high_priority":          {MaxWorkers: max(2, cfg.MaxWorkers/2)}, // At least 2 workers, or half of total workers
+			workers.FixityQueue:      {MaxWorkers: 1},
+			workers.ReplicationQueue: {MaxWorkers: 1},
 		},
 		Workers:              riverWorkers,
+		PeriodicJobs:         periodicJobs,
 		JobTimeout:           jobTimeout,
 		RescueStuckJobsAfter: rescueStuckJobsAfter,
 		ErrorHandler:         errorHandler,
@@ -679,12 +1005,31 @@ func main() {
 		log.Fatalf("Failed to create River client: %v", err)
 	}
 
+	// Copy each new object to the secondaries soon after it is written. Set
+	// before Start, which begins running the jobs that write.
+	if replicatedStorage != nil {
+		replicatedStorage.OnPending(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := workers.EnqueueReplicaRepair(ctx, riverClient); err != nil {
+				slog.Warn("Failed to queue replica repair; the periodic pass will copy", "error", err)
+			}
+		})
+	}
+
 	// Start River client
 	if err := riverClient.Start(context.Background()); err != nil {
 		log.Fatalf("Failed to start River client: %v", err)
 	}
 	defer riverClient.Stop(context.Background())
 
+	// Record and fill in objects stored before a secondary was added.
+	if replicatedStorage != nil {
+		if err := workers.EnqueueReplicaBackfill(context.Background(), riverClient); err != nil {
+			slog.Error("Failed to queue replica backfill", "error", err)
+		}
+	}
+
 	// Initialize cleanup worker and start periodic cleanup
 	cleanupWorker := workers.NewCleanupWorker(db)
 
@@ -706,6 +1051,11 @@ func main() {
 		}
 	}()
 
+	// Poll subscribed feeds. Each feed keeps its own interval; the tick only
+	// bounds how late a due feed is polled.
+	feedPoller := feeds.NewPoller(db, riverClient, cfg.FeedPollInterval)
+	feedPoller.Start(context.Background(), time.Minute)
+
 	// Setup River UI
 	riverUIServer, err := riverui.NewServer(&riverui.ServerOpts{
 		Client: riverClient,
@@ -744,6 +1094,12 @@ func main() {
 
 	// Setup routes
 	r.GET("/health", handlers.HealthCheckHandler(db))
+	r.GET("/health/detail", func(c *gin.Context) {
+		if !handlers.RequireLogin(c) {
+			return
+		}
+		handlers.HealthDetailHandler(healthMonitor)(c)
+	})
 	r.GET("/metrics/browser", func(c *gin.Context) {
 		if !handlers.RequireLogin(c) {
 			return
@@ -762,6 +1118,12 @@ func main() {
 		}
 		handlers.DBStorageStatusHandler(db)(c)
 	})
+	r.GET("/status/git-cache", func(c *gin.Context) {
+		if !handlers.RequireLogin(c) {
+			return
+		}
+		handlers.GitCacheStatusHandler(gitCache)(c)
+	})
 	r.GET("/login", func(c *gin.Context) { handlers.LoginGet(c, cfg.LoginText) })
 	r.POST("/login", func(c *gin.Context) { handlers.LoginPost(c, db, cfg.LoginText) })
 	admin := r.Group("/admin", handlers.RequireLoginMiddleware())
@@ -769,6 +1131,19 @@ func main() {
 	admin.POST("/api-keys", func(c *gin.Context) { handlers.ApiKeysCreate(c, db) })
 	admin.POST("/api-keys/:id/toggle", func(c *gin.Context) { handlers.ApiKeysToggle(c, db) })
 	admin.DELETE("/api-keys/:id", func(c *gin.Context) { handlers.ApiKeysDelete(c, db) })
+	admin.GET("/cookie-jars", func(c *gin.Context) { handlers.CookieJarsGet(c, cookieStore) })
+	admin.POST("/cookie-jars", func(c *gin.Context) { handlers.CookieJarsCreate(c, cookieStore) })
+	admin.POST("/cookie-jars/:id/toggle", func(c *gin.Context) { handlers.CookieJarsToggle(c, cookieStore) })
+	admin.DELETE("/cookie-jars/:id", func(c *gin.Context) { handlers.CookieJarsDelete(c, cookieStore) })
+	admin.GET("/feeds", func(c *gin.Context) { handlers.FeedsGet(c, feedPoller) })
+	admin.POST("/feeds", func(c *gin.Context) { handlers.FeedsCreate(c, feedPoller) })
+	admin.POST("/feeds/:id/poll", func(c *gin.Context) { handlers.FeedsPoll(c, feedPoller) })
+	admin.POST("/feeds/:id/toggle", func(c *gin.Context) { handlers.FeedsToggle(c, feedPoller) })
+	admin.DELETE("/feeds/:id", func(c *gin.Context) { handlers.FeedsDelete(c, feedPoller) })
+	admin.GET("/fixity", func(c *gin.Context) { handlers.FixityGet(c, db) })
+	admin.POST("/fixity/audit", func(c *gin.Context) { handlers.FixityAudit(c, riverClient) })
+	admin.POST("/fixity/recapture", func(c *gin.Context) { handlers.FixityRecaptureAll(c, db, riverClient) })
+	admin.POST("/fixity/:id/recapture", func(c *gin.Context) { handlers.FixityRecapture(c, db, riverClient) })
 	admin.POST("/retry-failed", func(c *gin.Context) { handlers.RetryAllFailedJobs(c, db, riverClient) })
 	admin.GET("/brightdata-usage", func(c *gin.Context) { handlers.BrightDataUsage(c, db) })
 	admin.POST("/backfill-media", func(c *gin.Context) { handlers.BackfillMissingMediaItems(c, db, riverClient) })
@@ -796,19 +1171,51 @@ func main() {
 	r.POST("/api/v1/archive/find-or-create", handlers.RequireAPIKey(db), func(c *gin.Context) {
 		handlers.ApiFindOrCreateArchive(c, db, riverClient)
 	})
-	r.GET("/api/v1/archive/:shortid", handlers.RequireAPIKey(db), func(c *gin.Context) { handlers.ApiArchiveResult(c, storageInstance, db) })
+	r.GET("/api/v1/archive/:shortid", handlers.RequireAPIKey(db), func(c *gin.Context) { handlers.ApiArchiveResult(c, storageInstance, db, riverClient) })
 	r.GET("/api/v1/past-archives", handlers.RequireAPIKey(db), func(c *gin.Context) { handlers.ApiPastArchives(c, db) })
 	r.GET("/web/past-archives", func(c *gin.Context) { handlers.WebPastArchives(c, db) })
 	r.GET("/logs/:shortid/:type", func(c *gin.Context) { handlers.GetLogs(c, db) })
 	r.GET("/archive/:shortid/:type", func(c *gin.Context) { handlers.ServeArchive(c, storageInstance, db) })
 	r.HEAD("/archive/:shortid/:type", func(c *gin.Context) { handlers.ServeArchive(c, storageInstance, db) })
 	r.GET("/archive/:shortid/mhtml/html", func(c *gin.Context) { handlers.ServeMHTMLAsHTML(c, storageInstance, db) })
+	// Signed list of every stored file of a capture, and the key it verifies
+	// under.
+	r.GET("/archive/:shortid/manifest.sig", func(c *gin.Context) { handlers.ServeCaptureManifest(c, storageInstance, db, riverClient) })
+	r.GET("/archive/:shortid/manifest.tsr", func(c *gin.Context) { handlers.ServeManifestTimestamp(c, storageInstance, db) })
+	r.GET("/.well-known/arker-manifest-key", func(c *gin.Context) { handlers.ServeManifestKey(c, manifestSigner) })
+	// Downloads generated from a git capture on first request, then kept.
+	gitBundle := func(c *gin.Context) { handlers.ServeGitBundle(c, storageInstance, db, gitCache) }
+	r.GET("/archive/:shortid/git/bundle", gitBundle)
+	r.HEAD("/archive/:shortid/git/bundle", gitBundle)
+	gitTarball := func(c *gin.Context) { handlers.ServeGitTarball(c, storageInstance, db, gitCache) }
+	r.GET("/archive/:shortid/git/tarball/*ref", gitTarball)
+	r.HEAD("/archive/:shortid/git/tarball/*ref", gitTarball)
+	// Reader-mode article extracted from the web archive.
+	r.GET("/reader/:shortid", func(c *gin.Context) { handlers.ServeReader(c, storageInstance, db, riverClient, "html") })
+	r.GET("/reader/:shortid/markdown", func(c *gin.Context) { handlers.ServeReader(c, storageInstance, db, riverClient, "markdown") })
+	r.GET("/reader/:shortid/json", func(c *gin.Context) { handlers.ServeReader(c, storageInstance, db, riverClient, "json") })
 	// Video metadata routes expose a stable post manifest without changing the
 	// long-lived /archive/:shortid/yt-dlp media URL.
 	r.GET("/video/:shortid/manifest", func(c *gin.Context) { handlers.ServeVideoManifest(c, storageInstance, db) })
 	r.GET("/video/:shortid/raw", func(c *gin.Context) { handlers.ServeVideoRawMetadata(c, storageInstance, db) })
 	r.GET("/video/:shortid/transcript", func(c *gin.Context) { handlers.ServeVideoTranscript(c, storageInstance, db) })
 	r.GET("/video/:shortid/subtitle/:name", func(c *gin.Context) { handlers.ServeVideoSubtitle(c, storageInstance, db) })
+	r.GET("/video/:shortid/transcript/cues", func(c *gin.Context) { handlers.ServeVideoCues(c, storageInstance, db) })
+	r.GET("/video/:shortid/search", func(c *gin.Context) { handlers.ServeVideoSearch(c, storageInstance, db) })
+	r.GET("/video/:shortid/hls/*name", func(c *gin.Context) { handlers.ServeVideoHLS(c, storageInstance, db, riverClient) })
+	r.GET("/video/:shortid", func(c *gin.Context) { handlers.ServeVideoDeepLink(c, db) })
+	// Audio captures share the video record, captions and transcript; these
+	// are the same handlers under the name a podcast client would look for.
+	r.GET("/audio/:shortid/manifest", func(c *gin.Context) { handlers.ServeVideoManifest(c, storageInstance, db) })
+	r.GET("/audio/:shortid/raw", func(c *gin.Context) { handlers.ServeVideoRawMetadata(c, storageInstance, db) })
+	r.GET("/audio/:shortid/transcript", func(c *gin.Context) { handlers.ServeVideoTranscript(c, storageInstance, db) })
+	r.GET("/audio/:shortid/subtitle/:name", func(c *gin.Context) { handlers.ServeVideoSubtitle(c, storageInstance, db) })
+	r.GET("/audio/:shortid/transcript/cues", func(c *gin.Context) { handlers.ServeVideoCues(c, storageInstance, db) })
+	r.GET("/audio/:shortid/search", func(c *gin.Context) { handlers.ServeVideoSearch(c, storageInstance, db) })
+	r.GET("/audio/:shortid", func(c *gin.Context) { handlers.ServeVideoDeepLink(c, db) })
+
+	// Archived feeds: a subscription's captured entries, linked into the archive.
+	r.GET("/feeds/:id", func(c *gin.Context) { handlers.ArchivedFeed(c, db) })
 
 	// Thumbnail routes - MUST come before /:shortid/:type catch-all.
 	// HEAD is registered alongside GET, matching /archive/:shortid/:type:
@@ -825,16 +1232,27 @@ func main() {
 	r.GET("/itch/:shortid/list", func(c *gin.Context) { handlers.ServeItchGameList(c, storageInstance, db) })
 
 	// Gallery routes - MUST come before /:shortid/:type catch-all
+	r.GET("/playlist/:shortid/manifest", func(c *gin.Context) { handlers.ServePlaylistManifest(c, storageInstance, db) })
 	r.GET("/gallery/:shortid/manifest", func(c *gin.Context) { handlers.ServeGalleryManifest(c, storageInstance, db) })
 	r.GET("/gallery/:shortid/list", func(c *gin.Context) { handlers.ServeGalleryList(c, storageInstance, db) })
 	r.GET("/gallery/:shortid/raw", func(c *gin.Context) { handlers.ServeGalleryRawMetadata(c, storageInstance, db) })
 	r.GET("/gallery/:shortid/file/*filepath", func(c *gin.Context) { handlers.ServeGalleryFile(c, storageInstance, db) })
 
-	r.Any("/git/*path", func(c *gin.Context) { handlers.GitHandler(c, storageInstance, db, cfg.CachePath) })
+	// Forge routes - MUST come before /:shortid/:type catch-all
+	r.GET("/forge/:shortid/manifest", func(c *gin.Context) { handlers.ServeForgeManifest(c, storageInstance, db) })
+	r.GET("/forge/:shortid/file/*filepath", func(c *gin.Context) { handlers.ServeForgeFile(c, storageInstance, db) })
+
+	// Link previews - MUST come before /:shortid/:type catch-all
+	r.GET("/oembed", func(c *gin.Context) { handlers.ServeOEmbed(c, storageInstance, db) })
+	r.GET("/embed/:shortid", func(c *gin.Context) { handlers.ServeEmbed(c, storageInstance, db) })
+
+	r.Any("/git/*path", func(c *gin.Context) { handlers.GitHandler(c, db, gitCache) })
+	r.GET("/git-view/:shortid", func(c *gin.Context) { handlers.GitView(c, db, gitCache) })
+	r.GET("/git-view/:shortid/*path", func(c *gin.Context) { handlers.GitView(c, db, gitCache) })
 
 	// Catch-all routes - MUST come last
-	r.GET("/:shortid/:type", func(c *gin.Context) { handlers.DisplayType(c, db) })
-	r.GET("/:shortid", func(c *gin.Context) { handlers.DisplayDefault(c, db) })
+	r.GET("/:shortid/:type", func(c *gin.Context) { handlers.DisplayType(c, storageInstance, db) })
+	r.GET("/:shortid", func(c *gin.Context) { handlers.DisplayDefault(c, storageInstance, db) })
 	r.GET("/", func(c *gin.Context) { handlers.AdminGet(c, db) })
 
 	slog.Info("Starting HTTP server", "port", cfg.Port, "address", "0.0.0.0:"+cfg.Port)
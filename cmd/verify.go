@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"arker/internal/manifest"
+	"arker/internal/timestamp"
+)
+
+const verifyUsage = `usage: arker verify -key <key> [-timestamp <manifest.tsr> [-tsa-ca <roots.pem>]]
+                    <manifest.sig> [file or directory...]
+
+Checks a capture's signed manifest, then checks each file against it by
+size and SHA-256. <key> is the instance's public key: the URL of its
+/.well-known/arker-manifest-key, that document saved to a file, or the key
+in base64. <manifest.sig> is a file or the URL of /archive/<id>/manifest.sig.
+Directories are checked file by file.
+
+With -timestamp, also checks the manifest's RFC 3161 timestamp, a file or
+the URL of /archive/<id>/manifest.tsr, and prints the time it vouches for.
+The TSA's certificate must chain to the roots in -tsa-ca, or by default to
+the system's.
+
+Exits 0 when everything verifies and every file is listed, 1 when anything
+does not match, and 2 on a usage error.
+`
+
+// runVerify is `arker verify`. It returns the process exit code.
+func runVerify(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { fmt.Fprint(stderr, verifyUsage) }
+	keySource := flags.String("key", "", "public key: URL, file or base64")
+	stampSource := flags.String("timestamp", "", "RFC 3161 timestamp of the manifest: URL or file")
+	caFile := flags.String("tsa-ca", "", "PEM roots for the TSA's certificate")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *keySource == "" || flags.NArg() < 1 {
+		flags.Usage()
+		return 2
+	}
+
+	keyData, err := readVerifySource(*keySource)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Not a file: the key itself.
+		keyData, err = []byte(*keySource), nil
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "verify: reading key: %v\n", err)
+		return 2
+	}
+	pub, err := manifest.ParsePublicKey(keyData)
+	if err != nil {
+		fmt.Fprintf(stderr, "verify: %v\n", err)
+		return 2
+	}
+	envelope, err := readVerifySource(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "verify: reading manifest: %v\n", err)
+		return 2
+	}
+	m, err := manifest.Open(envelope, pub)
+	if err != nil {
+		fmt.Fprintf(stdout, "FAIL manifest: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Signature OK (key %s)\n", manifest.KeyID(pub))
+	fmt.Fprintf(stdout, "Capture %s of %s, captured %s, signed %s\n",
+		m.ShortID, m.URL, m.CapturedAt.Format(time.RFC3339), m.SignedAt.Format(time.RFC3339))
+
+	failed := false
+	if *stampSource != "" {
+		var roots *x509.CertPool
+		if *caFile != "" {
+			pemData, err := os.ReadFile(*caFile)
+			if err == nil {
+				roots, err = timestamp.LoadRoots(pemData)
+			}
+			if err != nil {
+				fmt.Fprintf(stderr, "verify: reading TSA roots: %v\n", err)
+				return 2
+			}
+		}
+		reply, err := readVerifySource(*stampSource)
+		if err != nil {
+			fmt.Fprintf(stderr, "verify: reading timestamp: %v\n", err)
+			return 2
+		}
+		token, err := timestamp.Verify(reply, timestamp.Digest(envelope), roots)
+		if err != nil {
+			fmt.Fprintf(stdout, "FAIL timestamp: %v\n", err)
+			failed = true
+		} else {
+			when := token.Time.Format(time.RFC3339Nano)
+			if token.Accuracy > 0 {
+				when += fmt.Sprintf(" (±%s)", token.Accuracy)
+			}
+			fmt.Fprintf(stdout, "Timestamp OK: manifest existed at %s, per %s\n", when, token.TSA)
+		}
+	}
+
+	var paths []string
+	for _, arg := range flags.Args()[1:] {
+		err := filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(stderr, "verify: %v\n", err)
+			return 2
+		}
+	}
+
+	matched := map[string]bool{}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(stdout, "FAIL %s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		size, digest, err := manifest.Hash(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(stdout, "FAIL %s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		item, file, ok := m.Match(size, digest)
+		if !ok {
+			fmt.Fprintf(stdout, "FAIL %s: not in the manifest (%d bytes, sha256 %s)\n", path, size, digest)
+			failed = true
+			continue
+		}
+		matched[file.Key] = true
+		fmt.Fprintf(stdout, "OK   %s: %s %s\n", path, item.Type, file.Role)
+	}
+	if len(paths) > 0 {
+		unchecked := 0
+		for _, key := range m.Keys() {
+			if !matched[key] {
+				unchecked++
+			}
+		}
+		fmt.Fprintf(stdout, "%d of %d listed files checked\n", len(m.Keys())-unchecked, len(m.Keys()))
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// readVerifySource reads a file, or fetches an http(s) URL.
+func readVerifySource(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", source, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+}
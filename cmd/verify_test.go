@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"arker/internal/manifest"
+	"arker/internal/timestamp"
+	"arker/internal/timestamp/tsatest"
+)
+
+func TestRunVerify(t *testing.T) {
+	dir := t.TempDir()
+	page := filepath.Join(dir, "capture", "page.mhtml")
+	os.MkdirAll(filepath.Dir(page), 0755)
+	os.WriteFile(page, []byte("<html>kept</html>"), 0644)
+	size, digest, _ := manifest.Hash(strings.NewReader("<html>kept</html>"))
+
+	pub, key, _ := ed25519.GenerateKey(nil)
+	envelope, _ := manifest.NewSigner(key).Sign(&manifest.Manifest{
+		Version: manifest.Version, ShortID: "abc12", URL: "https://example.com/",
+		Items: []manifest.Item{{Type: "mhtml", Files: []manifest.File{
+			{Role: manifest.RoleArtifact, Key: "abc12/mhtml-00.mhtml", Size: size, SHA256: digest},
+			{Role: manifest.RoleMetadata, Key: "abc12/mhtml-00.metadata.json", Size: 2, SHA256: strings.Repeat("0", 64)},
+		}}},
+	})
+	sig := filepath.Join(dir, "manifest.sig")
+	os.WriteFile(sig, envelope, 0644)
+	keyDoc, _ := json.Marshal(manifest.NewPublicKeyDocument(pub))
+	keyFile := filepath.Join(dir, "key.json")
+	os.WriteFile(keyFile, keyDoc, 0644)
+
+	run := func(args ...string) (int, string) {
+		var out, errOut strings.Builder
+		code := runVerify(args, &out, &errOut)
+		return code, out.String() + errOut.String()
+	}
+
+	if code, out := run("-key", keyFile, sig, filepath.Join(dir, "capture")); code != 0 ||
+		!strings.Contains(out, "Signature OK") || !strings.Contains(out, "OK   "+page+": mhtml artifact") || !strings.Contains(out, "1 of 2 listed files checked") {
+		t.Errorf("matching file = %d:\n%s", code, out)
+	}
+	if code, out := run("-key", base64.StdEncoding.EncodeToString(pub), sig); code != 0 {
+		t.Errorf("base64 key, no files = %d:\n%s", code, out)
+	}
+
+	os.WriteFile(page, []byte("<html>altered</html>"), 0644)
+	if code, out := run("-key", keyFile, sig, page); code != 1 || !strings.Contains(out, "FAIL "+page+": not in the manifest") {
+		t.Errorf("altered file = %d:\n%s", code, out)
+	}
+
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+	if code, out := run("-key", base64.StdEncoding.EncodeToString(otherPub), sig); code != 1 || !strings.Contains(out, "FAIL manifest") {
+		t.Errorf("wrong key = %d:\n%s", code, out)
+	}
+	if code, _ := run(sig); code != 2 {
+		t.Errorf("no key = %d, want a usage error", code)
+	}
+}
+
+func TestRunVerifyTimestamp(t *testing.T) {
+	tsa := tsatest.NewServer()
+	defer tsa.Close()
+	tsa.SetNow(func() time.Time { return time.Date(2026, 7, 1, 12, 0, 0, 0, time.UTC) })
+
+	dir := t.TempDir()
+	pub, key, _ := ed25519.GenerateKey(nil)
+	envelope, _ := manifest.NewSigner(key).Sign(&manifest.Manifest{Version: manifest.Version, ShortID: "abc12"})
+	reply, _, err := tsa.Authority().Stamp(context.Background(), timestamp.Digest(envelope))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := filepath.Join(dir, "manifest.sig")
+	tsr := filepath.Join(dir, "manifest.tsr")
+	ca := filepath.Join(dir, "ca.pem")
+	os.WriteFile(sig, envelope, 0644)
+	os.WriteFile(tsr, reply, 0644)
+	os.WriteFile(ca, tsa.RootPEM, 0644)
+	keyArg := base64.StdEncoding.EncodeToString(pub)
+
+	run := func(args ...string) (int, string) {
+		var out, errOut strings.Builder
+		code := runVerify(args, &out, &errOut)
+		return code, out.String() + errOut.String()
+	}
+
+	if code, out := run("-key", keyArg, "-timestamp", tsr, "-tsa-ca", ca, sig); code != 0 ||
+		!strings.Contains(out, "Timestamp OK: manifest existed at 2026-07-01T12:00:00Z (±1s), per ") {
+		t.Errorf("timestamp = %d:\n%s", code, out)
+	}
+	// The stand-in's root is not among the system's.
+	if code, out := run("-key", keyArg, "-timestamp", tsr, sig); code != 1 || !strings.Contains(out, "FAIL timestamp") {
+		t.Errorf("untrusted TSA = %d:\n%s", code, out)
+	}
+	// A timestamp of some other manifest does not vouch for this one.
+	other, _ := manifest.NewSigner(key).Sign(&manifest.Manifest{Version: manifest.Version, ShortID: "zzz99"})
+	otherSig := filepath.Join(dir, "other.sig")
+	os.WriteFile(otherSig, other, 0644)
+	if code, out := run("-key", keyArg, "-timestamp", tsr, "-tsa-ca", ca, otherSig); code != 1 || !strings.Contains(out, "different digest") {
+		t.Errorf("other manifest = %d:\n%s", code, out)
+	}
+}
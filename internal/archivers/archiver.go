@@ -66,9 +66,15 @@ type Result struct {
 	// Completeness is the archiver's claim about whether it stored every
 	// obtainable source asset: one of CompletenessComplete, CompletenessPartial
 	// or CompletenessUnknown. Empty means the archiver does not speak to
-	// completeness (mhtml, screenshot, git, itch), and is stored as-is so those
+	// completeness (mhtml, screenshot, itch), and is stored as-is so those
 	// types stay distinguishable from a social capture that answered "unknown".
 	Completeness string
+	// Playlist is set only by PlaylistArchiver. The worker creates a child
+	// capture per entry before it marks the playlist item completed.
+	Playlist *PlaylistListing
+	// Submodules is set only by GitArchiver. The worker creates a linked
+	// capture of each submodule's repository, as it does for a playlist.
+	Submodules []GitSubmoduleRef
 }
 
 // ExtraArtifact is one additional stored object belonging to an archive item.
@@ -0,0 +1,221 @@
+package archivers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AudioArchiver downloads podcast episodes, music tracks and bare audio
+// enclosures via yt-dlp. It keeps only the audio, stored as Opus when the
+// source already is Opus and as M4A otherwise, and describes it with the same
+// normalized record as a video plus the show and episode fields.
+type AudioArchiver struct{}
+
+// audioFormats are the stored formats, by extension, best first.
+var audioFormats = []VideoMedia{
+	{Extension: ".opus", ContentType: "audio/ogg"},
+	{Extension: ".m4a", ContentType: "audio/mp4"},
+}
+
+func (a *AudioArchiver) Archive(ctx context.Context, url string, logWriter io.Writer, db *gorm.DB, itemID uint) (Result, error) {
+	fmt.Fprintf(logWriter, "Starting audio archive for: %s\n", url)
+
+	download, err := runYtDlpDownload(ctx, url, "audio", logWriter, audioDownloadArgs)
+	if err != nil {
+		return Result{}, err
+	}
+	defer download.cleanup()
+
+	outputPath, media, err := findDownloadedAudio(download.tempBase)
+	if err != nil {
+		fmt.Fprintf(logWriter, "Failed to find downloaded audio: %v\n", err)
+		return Result{}, err
+	}
+
+	metadata, sanitizedRaw, rawInfo, err := download.metadata(url, outputPath, &media, logWriter)
+	if err != nil {
+		return Result{}, err
+	}
+	metadata.Media = storedAudioMedia(metadata.Media)
+	metadata.Audio = audioDetailsFromInfo(rawInfo)
+	if len(metadata.Chapters) == 0 {
+		// A bare enclosure has no page for yt-dlp to read chapters from, but
+		// podcast files often carry them in their own tags.
+		metadata.Chapters = probeChapters(ctx, outputPath, logWriter)
+	}
+	if len(metadata.Chapters) > 0 {
+		fmt.Fprintf(logWriter, "Recorded %d chapters\n", len(metadata.Chapters))
+	}
+	extras := download.captions(ctx, outputPath, rawInfo, metadata, logWriter)
+
+	metadataJSON, err := MarshalVideoMetadata(metadata)
+	if err != nil {
+		fmt.Fprintf(logWriter, "Failed to encode normalized audio metadata: %v\n", err)
+		return Result{}, err
+	}
+
+	data, err := download.open(outputPath)
+	if err != nil {
+		fmt.Fprintf(logWriter, "Failed to open downloaded audio: %v\n", err)
+		return Result{}, err
+	}
+
+	// The episode or cover artwork is the thumbnail. Read it before returning,
+	// while the temp directory still exists.
+	thumb := audioArtwork(ctx, download.tempBase, outputPath, logWriter)
+
+	fmt.Fprintf(logWriter, "Audio download completed successfully\n")
+
+	return Result{
+		Data:         data,
+		Extension:    media.Extension,
+		ContentType:  media.ContentType,
+		Thumbnail:    thumb,
+		Source:       "native",
+		Metadata:     &Sidecar{Data: metadataJSON},
+		RawMetadata:  &Sidecar{Data: sanitizedRaw},
+		Extras:       extras,
+		Completeness: CompletenessComplete,
+	}, nil
+}
+
+// audioDownloadArgs selects the best audio stream and extracts it. Opus and
+// AAC are kept as they are; the --audio-format rules are keyed on the
+// downloaded file's extension, so an Opus stream in WebM or Ogg is remuxed to
+// .opus and anything else (the MP3 of most podcast feeds) is converted to M4A.
+func audioDownloadArgs(outputTemplate string) []string {
+	return []string{
+		"-f", "bestaudio[acodec=opus]/bestaudio[ext=m4a]/bestaudio/best",
+		"--no-playlist",
+		"--extract-audio",
+		"--audio-format", "webm>opus/ogg>opus/opus>opus/m4a",
+		// The episode or cover artwork; see ytDlpDownloadArgs.
+		"--write-thumbnail",
+		"--write-info-json",
+		"--no-clean-infojson",
+		"--verbose",
+		"-o", outputTemplate,
+	}
+}
+
+// findDownloadedAudio finds the extracted audio among yt-dlp's outputs.
+func findDownloadedAudio(tempBase string) (string, VideoMedia, error) {
+	for _, media := range audioFormats {
+		if path, err := findDownloadedMedia(tempBase, media.Extension); err == nil {
+			return path, media, nil
+		}
+	}
+	return "", VideoMedia{}, fmt.Errorf("no Opus or M4A output found for %s", tempBase)
+}
+
+// storedAudioMedia corrects the provider's format description to the file
+// actually stored. The provider describes the format it served, which may
+// have carried a video track or been converted by --extract-audio.
+func storedAudioMedia(media VideoMedia) VideoMedia {
+	media.Width, media.Height, media.FPS = nil, nil, nil
+	media.VideoCodec = ""
+	switch media.Extension {
+	case ".opus":
+		media.AudioCodec = "opus"
+	case ".m4a":
+		if !strings.HasPrefix(media.AudioCodec, "mp4a") {
+			media.AudioCodec = "aac"
+		}
+	}
+	return media
+}
+
+// audioDetailsFromInfo reads the show and episode fields of yt-dlp's info
+// record. Podcast extractors fill series/episode, music extractors
+// album/track; a record with neither yields nil.
+func audioDetailsFromInfo(rawInfo []byte) *AudioDetails {
+	info, err := decodeJSONObject(rawInfo)
+	if err != nil {
+		return nil
+	}
+	details := &AudioDetails{
+		Show:          videoString(info, "series", "album"),
+		Episode:       videoString(info, "episode", "track"),
+		EpisodeNumber: videoInt(info, "episode_number", "track_number"),
+		SeasonNumber:  videoInt(info, "season_number"),
+		Artist:        videoString(info, "artist", "creator"),
+		Album:         videoString(info, "album"),
+	}
+	if *details == (AudioDetails{}) {
+		return nil
+	}
+	return details
+}
+
+// probeChapters reads the chapter markers embedded in the audio file itself.
+// Every failure yields no chapters: they are a convenience, and ffprobe may
+// not even be installed.
+func probeChapters(ctx context.Context, path string, logWriter io.Writer) []Chapter {
+	probeCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(probeCtx, "ffprobe", "-v", "error", "-show_chapters", "-of", "json", path)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(logWriter, "Could not probe embedded chapters: %v\n", err)
+		return nil
+	}
+	var raw struct {
+		Chapters []struct {
+			StartTime string            `json:"start_time"`
+			EndTime   string            `json:"end_time"`
+			Tags      map[string]string `json:"tags"`
+		} `json:"chapters"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &raw); err != nil {
+		fmt.Fprintf(logWriter, "Could not decode embedded chapters: %v\n", err)
+		return nil
+	}
+	var chapters []Chapter
+	for _, c := range raw.Chapters {
+		var start float64
+		if _, err := fmt.Sscanf(c.StartTime, "%g", &start); err != nil {
+			continue
+		}
+		chapters = append(chapters, Chapter{
+			Title:        strings.TrimSpace(c.Tags["title"]),
+			StartSeconds: start,
+			EndSeconds:   positiveProbeFloat(c.EndTime),
+		})
+	}
+	return chapters
+}
+
+// audioArtwork returns the artwork yt-dlp downloaded, or else the cover
+// embedded in the audio file (an ID3 APIC frame or an MP4 covr atom), which is
+// where a bare enclosure keeps it. Returns nil when there is neither.
+func audioArtwork(ctx context.Context, tempBase, audioPath string, logWriter io.Writer) *Thumbnail {
+	if findDownloadedThumbnail(tempBase, audioPath) != "" {
+		return videoThumbnail(tempBase, audioPath, logWriter)
+	}
+
+	coverPath := tempBase + ".cover.jpg"
+	extractCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(extractCtx, "ffmpeg", "-v", "error", "-y", "-i", audioPath, "-an", "-frames:v", "1", coverPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		fmt.Fprintf(logWriter, "No artwork available: %v %s\n", err, strings.TrimSpace(string(output)))
+		return nil
+	}
+	if _, err := os.Stat(coverPath); err != nil {
+		fmt.Fprintf(logWriter, "No artwork available\n")
+		return nil
+	}
+	fmt.Fprintf(logWriter, "Using artwork embedded in %s\n", filepath.Base(audioPath))
+	return videoThumbnail(tempBase, audioPath, logWriter)
+}
@@ -0,0 +1,120 @@
+package archivers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"arker/internal/testfixtures"
+)
+
+// podcastInfoJSON is a trimmed yt-dlp record for a podcast episode: an MP3
+// enclosure with show and episode fields and two chapters.
+const podcastInfoJSON = `{
+  "id": "1000650000001",
+  "title": "Episode 12: Tape Decks",
+  "uploader": "Example Radio",
+  "duration": 1830,
+  "extractor": "ApplePodcasts",
+  "extractor_key": "ApplePodcasts",
+  "webpage_url": "https://podcasts.apple.com/us/podcast/example/id123?i=1000650000001",
+  "series": "Example Radio Hour",
+  "episode": "Tape Decks",
+  "episode_number": 12,
+  "season_number": 2,
+  "acodec": "mp3",
+  "vcodec": "none",
+  "ext": "mp3",
+  "chapters": [
+    {"title": "Intro", "start_time": 0, "end_time": 95.5},
+    {"title": "The decks", "start_time": 95.5, "end_time": 1830}
+  ]
+}`
+
+func TestAudioArchiverStoresM4AWithEpisodeMetadata(t *testing.T) {
+	binDir := testfixtures.InstallFakeYtDlp(t, testfixtures.YtDlpFake{
+		Fixture:     "youtube_regular",
+		InfoJSON:    []byte(podcastInfoJSON),
+		NoSubtitles: true,
+	})
+
+	var log strings.Builder
+	result, err := (&AudioArchiver{}).Archive(context.Background(), "https://podcasts.apple.com/us/podcast/example/id123?i=1000650000001", &log, nil, 1)
+	if err != nil {
+		t.Fatalf("archive: %v\n%s", err, log.String())
+	}
+	if closer, ok := result.Data.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	args, err := os.ReadFile(filepath.Join(binDir, "args.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	argv := strings.Split(strings.TrimSpace(string(args)), "\n")
+	if !hasArgPair(argv, "--audio-format", "webm>opus/ogg>opus/opus>opus/m4a") {
+		t.Errorf("yt-dlp was not asked to keep Opus and convert the rest to M4A: %q", argv)
+	}
+	if result.Extension != ".m4a" || result.ContentType != "audio/mp4" {
+		t.Errorf("result = %s %s, want .m4a audio/mp4", result.Extension, result.ContentType)
+	}
+	if result.Thumbnail == nil {
+		t.Error("the downloaded artwork did not become the thumbnail")
+	}
+
+	var metadata VideoMetadata
+	if err := json.Unmarshal(result.Metadata.Data, &metadata); err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Audio == nil || metadata.Audio.Show != "Example Radio Hour" || metadata.Audio.Episode != "Tape Decks" {
+		t.Fatalf("audio details = %+v", metadata.Audio)
+	}
+	if metadata.Audio.EpisodeNumber == nil || *metadata.Audio.EpisodeNumber != 12 ||
+		metadata.Audio.SeasonNumber == nil || *metadata.Audio.SeasonNumber != 2 {
+		t.Errorf("episode numbering = %+v", metadata.Audio)
+	}
+	if len(metadata.Chapters) != 2 || metadata.Chapters[1].Title != "The decks" || metadata.Chapters[1].StartSeconds != 95.5 {
+		t.Errorf("chapters = %+v", metadata.Chapters)
+	}
+	// The MP3 was converted, so the provider's codec no longer describes the
+	// stored file.
+	if metadata.Media.AudioCodec != "aac" || metadata.Media.VideoCodec != "" {
+		t.Errorf("media codecs = %q/%q, want aac and none", metadata.Media.AudioCodec, metadata.Media.VideoCodec)
+	}
+	if metadata.DurationSeconds == nil || *metadata.DurationSeconds != 1830 {
+		t.Errorf("duration = %v", metadata.DurationSeconds)
+	}
+}
+
+func TestAudioDetailsFromInfoReadsMusicFields(t *testing.T) {
+	details := audioDetailsFromInfo([]byte(`{"album": "Night Drive", "track": "Overpass", "track_number": 3, "artist": "The Examples"}`))
+	if details == nil {
+		t.Fatal("no details for a music track")
+	}
+	if details.Show != "Night Drive" || details.Episode != "Overpass" || details.Artist != "The Examples" || details.Album != "Night Drive" {
+		t.Errorf("details = %+v", details)
+	}
+	if details.EpisodeNumber == nil || *details.EpisodeNumber != 3 {
+		t.Errorf("track number = %v", details.EpisodeNumber)
+	}
+
+	if got := audioDetailsFromInfo([]byte(`{"title": "Just a clip"}`)); got != nil {
+		t.Errorf("a record with no show or episode fields yielded %+v", got)
+	}
+}
+
+func TestStoredAudioMediaDescribesTheStoredFile(t *testing.T) {
+	width := int64(1280)
+	opus := storedAudioMedia(VideoMedia{Extension: ".opus", AudioCodec: "opus", VideoCodec: "vp9", Width: &width})
+	if opus.AudioCodec != "opus" || opus.VideoCodec != "" || opus.Width != nil {
+		t.Errorf("opus media = %+v", opus)
+	}
+	copied := storedAudioMedia(VideoMedia{Extension: ".m4a", AudioCodec: "mp4a.40.2"})
+	if copied.AudioCodec != "mp4a.40.2" {
+		t.Errorf("a copied AAC stream lost its codec: %+v", copied)
+	}
+}
@@ -56,7 +56,7 @@ func normalizedMetadataMap(t *testing.T, fake testfixtures.YtDlpFake, url string
 func TestYtDlpAsksForSubtitles(t *testing.T) {
 	// Subtitle flags live in their own helper so the language filter can be
 	// built per video; the contract is about the composed invocation.
-	args := append(ytDlpDownloadArgs("/tmp/out.%(ext)s"), utils.YtDlpSubtitleArgs("")...)
+	args := append(ytDlpDownloadArgs("/tmp/out.%(ext)s", utils.VideoQuality{}), utils.YtDlpSubtitleArgs("")...)
 	joined := strings.Join(args, " ")
 
 	// Already true and load-bearing for the transcript work: the info JSON is
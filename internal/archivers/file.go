@@ -0,0 +1,259 @@
+package archivers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"arker/internal/thumbnail"
+	"arker/internal/utils"
+)
+
+// FileMetadata is the normalized sidecar of a file capture: the response
+// headers that describe the bytes, kept because the server's own name and
+// validators for a document are part of what was archived.
+type FileMetadata struct {
+	URL      string `json:"url"`
+	FinalURL string `json:"final_url,omitempty"`
+	// ContentType is the Content-Type the server sent, or the sniffed type
+	// when it sent none.
+	ContentType string `json:"content_type"`
+	// Filename comes from Content-Disposition, else the last path segment of
+	// the final URL. Empty when neither names a file.
+	Filename      string `json:"filename,omitempty"`
+	LastModified  string `json:"last_modified,omitempty"`
+	ETag          string `json:"etag,omitempty"`
+	ContentLength int64  `json:"content_length,omitempty"`
+	Size          int64  `json:"size"`
+	SHA256        string `json:"sha256"`
+	RetrievedAt   string `json:"retrieved_at"`
+}
+
+// FileArchiver stores a non-HTML URL exactly as the server sends it. A
+// browser given a PDF or a ZIP produces an empty MHTML and a blank
+// screenshot; the document itself is the capture.
+type FileArchiver struct {
+	// Client is used for the download; nil means a default client with no
+	// overall timeout, since the job context bounds the transfer.
+	Client *http.Client
+}
+
+func (a *FileArchiver) Archive(ctx context.Context, rawURL string, logWriter io.Writer, db *gorm.DB, itemID uint) (Result, error) {
+	fmt.Fprintf(logWriter, "Starting file archive for: %s\n", rawURL)
+
+	client := a.Client
+	if client == nil {
+		client = &http.Client{}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	resp, err := client.Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return Result{}, fmt.Errorf("download failed: server answered %s", resp.Status)
+	}
+
+	dir, err := os.MkdirTemp("", "arker-file-*")
+	if err != nil {
+		return Result{}, err
+	}
+	filePath := filepath.Join(dir, "download")
+	file, err := os.Create(filePath)
+	if err != nil {
+		os.RemoveAll(dir)
+		return Result{}, err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), resp.Body)
+	if err != nil {
+		file.Close()
+		os.RemoveAll(dir)
+		return Result{}, fmt.Errorf("download interrupted after %d bytes: %w", size, err)
+	}
+	if resp.ContentLength >= 0 && size != resp.ContentLength {
+		file.Close()
+		os.RemoveAll(dir)
+		return Result{}, fmt.Errorf("download truncated: got %d of %d bytes", size, resp.ContentLength)
+	}
+
+	metadata := FileMetadata{
+		URL:          rawURL,
+		ContentType:  resp.Header.Get("Content-Type"),
+		Filename:     responseFilename(resp),
+		LastModified: resp.Header.Get("Last-Modified"),
+		ETag:         resp.Header.Get("ETag"),
+		Size:         size,
+		SHA256:       hex.EncodeToString(hash.Sum(nil)),
+		RetrievedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+	if finalURL := resp.Request.URL.String(); finalURL != rawURL {
+		metadata.FinalURL = finalURL
+	}
+	if resp.ContentLength >= 0 {
+		metadata.ContentLength = resp.ContentLength
+	}
+	if metadata.ContentType == "" {
+		metadata.ContentType = sniffFileContentType(file)
+	}
+	fmt.Fprintf(logWriter, "Downloaded %d bytes (%s", size, metadata.ContentType)
+	if metadata.Filename != "" {
+		fmt.Fprintf(logWriter, ", %s", metadata.Filename)
+	}
+	fmt.Fprintf(logWriter, "), sha256 %s\n", metadata.SHA256)
+
+	encoded, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		file.Close()
+		os.RemoveAll(dir)
+		return Result{}, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		os.RemoveAll(dir)
+		return Result{}, err
+	}
+
+	return Result{
+		Data:        &tempVideoReader{File: file, path: filePath, dir: dir},
+		Extension:   fileExtension(metadata),
+		ContentType: metadata.ContentType,
+		Thumbnail:   fileThumbnail(ctx, filePath, metadata.ContentType, logWriter),
+		Metadata:    &Sidecar{Data: encoded},
+	}, nil
+}
+
+// responseFilename is the server's name for the file: the Content-Disposition
+// filename (RFC 6266, including the filename* form), else the last segment of
+// the final URL's path.
+func responseFilename(resp *http.Response) string {
+	if disposition := resp.Header.Get("Content-Disposition"); disposition != "" {
+		if _, params, err := mime.ParseMediaType(disposition); err == nil {
+			if name := cleanFilename(params["filename"]); name != "" {
+				return name
+			}
+		}
+	}
+	name, err := url.PathUnescape(path.Base(resp.Request.URL.Path))
+	if err != nil || !strings.Contains(name, ".") || scriptExtensions[strings.ToLower(filepath.Ext(name))] {
+		return ""
+	}
+	return cleanFilename(name)
+}
+
+// scriptExtensions name the program that answered, not the file it sent:
+// "download.php?id=7" is not a PHP file.
+var scriptExtensions = map[string]bool{
+	".php": true, ".asp": true, ".aspx": true, ".jsp": true, ".cgi": true, ".pl": true, ".do": true,
+	".html": true, ".htm": true,
+}
+
+// cleanFilename drops any directory part and the characters that cannot
+// appear in a header or on a filesystem.
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' || r == '/' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "." || name == ".." {
+		return ""
+	}
+	return name
+}
+
+func sniffFileContentType(file *os.File) string {
+	head := make([]byte, 512)
+	n, _ := file.ReadAt(head, 0)
+	return http.DetectContentType(head[:n])
+}
+
+// fileExtension picks the stored extension: the server's filename's, else
+// the one its content type implies, else ".bin".
+func fileExtension(metadata FileMetadata) string {
+	// Only a short alphanumeric extension; the rest of a filename is the
+	// server's to choose and is served from the sidecar, not the key.
+	ext := strings.ToLower(filepath.Ext(metadata.Filename))
+	if len(ext) > 1 && len(ext) <= 10 && strings.Trim(ext[1:], "abcdefghijklmnopqrstuvwxyz0123456789") == "" {
+		return ext
+	}
+	if mediaType, _, err := mime.ParseMediaType(metadata.ContentType); err == nil {
+		if known := utils.FileExtensionForContentType(mediaType); known != "" {
+			return known
+		}
+	}
+	return ".bin"
+}
+
+// fileThumbnail previews an image directly and a PDF's first page through
+// pdftoppm when it is installed. Anything else has no preview.
+func fileThumbnail(ctx context.Context, filePath, contentType string, logWriter io.Writer) *Thumbnail {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		f, err := os.Open(filePath)
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+		return thumbnailFromReader(f, thumbnail.CropCenter, logWriter)
+	case mediaType == "application/pdf":
+		return pdfFirstPageThumbnail(ctx, filePath, logWriter)
+	default:
+		return nil
+	}
+}
+
+func pdfFirstPageThumbnail(ctx context.Context, filePath string, logWriter io.Writer) *Thumbnail {
+	renderCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	outBase := filePath + ".page1"
+	cmd := exec.CommandContext(renderCtx, "pdftoppm", "-png", "-f", "1", "-l", "1", "-singlefile", "-scale-to", "1280", filePath, outBase)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		fmt.Fprintf(logWriter, "Thumbnail generation skipped: pdftoppm: %v %s\n", err, strings.TrimSpace(string(output)))
+		return nil
+	}
+	// Removed here: the artifact's reader only cleans up its own file and
+	// an empty directory.
+	defer os.Remove(outBase + ".png")
+	f, err := os.Open(outBase + ".png")
+	if err != nil {
+		fmt.Fprintf(logWriter, "Thumbnail generation skipped: %v\n", err)
+		return nil
+	}
+	defer f.Close()
+	// A page's title block is at its top, as with a screenshot.
+	return thumbnailFromReader(f, thumbnail.CropTop, logWriter)
+}
+
+func thumbnailFromReader(r io.Reader, crop thumbnail.Crop, logWriter io.Writer) *Thumbnail {
+	t, err := thumbnail.FromReader(r, crop)
+	if err != nil {
+		fmt.Fprintf(logWriter, "Thumbnail generation skipped: %v\n", err)
+		return nil
+	}
+	fmt.Fprintf(logWriter, "Thumbnail generated: %dx%d, %d bytes\n", t.Width, t.Height, len(t.Data))
+	return &Thumbnail{Data: t.Data, Width: t.Width, Height: t.Height}
+}
@@ -0,0 +1,109 @@
+package archivers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for x := 0; x < 400; x++ {
+		img.Set(x, 150, color.RGBA{R: 200, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestFileArchiverKeepsBytesAndHeaders(t *testing.T) {
+	body := testPNG(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Disposition", `attachment; filename*=UTF-8''r%C3%A9sum%C3%A9%20chart.PNG`)
+		w.Header().Set("Last-Modified", "Tue, 01 Sep 2026 10:00:00 GMT")
+		w.Header().Set("ETag", `"abc123"`)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	var log strings.Builder
+	result, err := (&FileArchiver{}).Archive(context.Background(), server.URL+"/download.php?id=7", &log, nil, 1)
+	if err != nil {
+		t.Fatalf("archive: %v\n%s", err, log.String())
+	}
+	data := readResult(t, result)
+	if !bytes.Equal(data, body) {
+		t.Errorf("stored %d bytes, want the %d the server sent", len(data), len(body))
+	}
+	if result.Extension != ".png" {
+		t.Errorf("extension = %q", result.Extension)
+	}
+	if result.Thumbnail == nil || len(result.Thumbnail.Data) == 0 {
+		t.Errorf("no thumbnail for an image\n%s", log.String())
+	}
+
+	var metadata FileMetadata
+	if err := json.Unmarshal(result.Metadata.Data, &metadata); err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Filename != "résumé chart.PNG" || metadata.ContentType != "image/png" ||
+		metadata.ETag != `"abc123"` || metadata.LastModified != "Tue, 01 Sep 2026 10:00:00 GMT" ||
+		metadata.Size != int64(len(body)) || len(metadata.SHA256) != 64 {
+		t.Errorf("metadata = %+v", metadata)
+	}
+}
+
+func TestFileArchiverNamesFilesWithoutADisposition(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/files/data.tar.zst":
+			w.Header().Set("Content-Type", "application/octet-stream")
+		case "/get.php":
+			w.Header().Set("Content-Type", "application/zip")
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("PK\x03\x04 not really a zip"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		path, wantFilename, wantExtension string
+	}{
+		{"/files/data.tar.zst", "data.tar.zst", ".zst"},
+		{"/get.php", "", ".zip"},
+	}
+	for _, tt := range tests {
+		var log strings.Builder
+		result, err := (&FileArchiver{}).Archive(context.Background(), server.URL+tt.path, &log, nil, 1)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		readResult(t, result)
+		var metadata FileMetadata
+		json.Unmarshal(result.Metadata.Data, &metadata)
+		if metadata.Filename != tt.wantFilename || result.Extension != tt.wantExtension {
+			t.Errorf("%s: filename %q, extension %q; want %q, %q", tt.path, metadata.Filename, result.Extension, tt.wantFilename, tt.wantExtension)
+		}
+		if result.Thumbnail != nil {
+			t.Errorf("%s: unexpected thumbnail", tt.path)
+		}
+	}
+
+	var log strings.Builder
+	if _, err := (&FileArchiver{}).Archive(context.Background(), server.URL+"/missing.pdf", &log, nil, 1); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("a 404 should fail the archive, got %v", err)
+	}
+}
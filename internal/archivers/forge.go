@@ -0,0 +1,499 @@
+package archivers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"gorm.io/gorm"
+
+	"arker/internal/forge"
+	"arker/internal/utils"
+)
+
+// ForgeManifestFilename is the first entry of a forge bundle and the item's
+// normalized metadata sidecar. Every other entry is reachable from it.
+const ForgeManifestFilename = "forge.json"
+
+// ForgeManifest describes a forge bundle: the project's metadata and an index
+// of the threads, releases, README and wiki stored beside it. Paths are ZIP
+// entry names.
+type ForgeManifest struct {
+	URL        string            `json:"url"`
+	Kind       string            `json:"kind"`
+	Host       string            `json:"host"`
+	Project    string            `json:"project"`
+	Repository *forge.Repository `json:"repository"`
+	Readme     *ForgeReadme      `json:"readme,omitempty"`
+	Threads    []ForgeThread     `json:"threads"`
+	// ThreadsTruncated means the project has more issues and pull requests
+	// than the configured limit; the newest were kept.
+	ThreadsTruncated bool           `json:"threads_truncated,omitempty"`
+	Releases         []ForgeRelease `json:"releases"`
+	Wiki             *ForgeWiki     `json:"wiki,omitempty"`
+	// Warnings name the parts of the project that could not be saved. Any
+	// warning makes the capture partial.
+	Warnings     []string `json:"warnings,omitempty"`
+	Completeness string   `json:"completeness"`
+	RetrievedAt  string   `json:"retrieved_at"`
+}
+
+// ForgeReadme locates the stored README. HTMLPath is empty when the host
+// would not render it.
+type ForgeReadme struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	HTMLPath string `json:"html_path,omitempty"`
+}
+
+// ForgeThread is the index entry of one stored issue or pull request. The
+// thread itself, comments included, is the JSON document at Path.
+type ForgeThread struct {
+	Kind         string   `json:"kind"`
+	Number       int      `json:"number"`
+	Title        string   `json:"title"`
+	State        string   `json:"state"`
+	Author       string   `json:"author,omitempty"`
+	Labels       []string `json:"labels,omitempty"`
+	CreatedAt    string   `json:"created_at,omitempty"`
+	CommentCount int      `json:"comment_count"`
+	Path         string   `json:"path"`
+}
+
+// ForgeRelease is a release with the storage outcome of each asset.
+type ForgeRelease struct {
+	forge.Release
+	Assets []ForgeAsset `json:"assets"`
+}
+
+// ForgeAsset is a release asset. Exactly one of Path and Skipped is set.
+type ForgeAsset struct {
+	forge.Asset
+	Path    string `json:"path,omitempty"`
+	Stored  int64  `json:"stored_bytes,omitempty"`
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// ForgeWiki is the project's wiki, stored as a git checkout under Path with
+// its history in Path/.git.
+type ForgeWiki struct {
+	Path   string   `json:"path"`
+	Commit string   `json:"commit,omitempty"`
+	Pages  []string `json:"pages"`
+}
+
+// ForgeArchiver saves a project's public record from its host's REST API:
+// metadata, README, issues and pull requests with their discussion, releases
+// with their assets, and the wiki. The repository itself is the git
+// archiver's job.
+type ForgeArchiver struct {
+	// Client is used for API calls and asset downloads; nil means a default
+	// client with no overall timeout, since the job context bounds the run.
+	Client *http.Client
+	// CheckURL vets release asset URLs and their redirects, which the project
+	// chooses; nil means utils.ValidateURL.
+	CheckURL func(rawURL string) error
+}
+
+func (a *ForgeArchiver) Archive(ctx context.Context, rawURL string, logWriter io.Writer, db *gorm.DB, itemID uint) (Result, error) {
+	fmt.Fprintf(logWriter, "Starting forge archive for: %s\n", rawURL)
+
+	parsed, ok := utils.ParseForgeURL(rawURL)
+	if !ok {
+		return Result{}, fmt.Errorf("%s is not a project on a known forge host", rawURL)
+	}
+	project := forge.Project{Kind: parsed.Kind, Scheme: parsed.Scheme, Host: parsed.Host, Path: parsed.Path}
+	settings := utils.ForgeSettings()
+	token := utils.ForgeToken(project.Host)
+	client, err := forge.New(project, a.Client, token)
+	if err != nil {
+		return Result{}, err
+	}
+	checkURL := a.CheckURL
+	if checkURL == nil {
+		checkURL = utils.ValidateURL
+	}
+	client.CheckURLs(checkURL)
+	access := "anonymous"
+	if token != "" {
+		access = "authenticated"
+	}
+	fmt.Fprintf(logWriter, "Project %s on %s (%s API, %s)\n", project.Path, project.Host, project.Kind, access)
+
+	// The project record is the one part the capture cannot do without: a
+	// missing or private project, or an exhausted rate limit, fails the job.
+	repo, raw, err := client.Repository(ctx)
+	if err != nil {
+		fmt.Fprintf(logWriter, "Failed to read project metadata: %v\n", err)
+		return Result{}, err
+	}
+	fmt.Fprintf(logWriter, "Project: %s (%d stars, %d forks)\n", repo.FullName, repo.Stars, repo.Forks)
+
+	dir, err := os.MkdirTemp("", "forge-archive-")
+	if err != nil {
+		return Result{}, err
+	}
+	success := false
+	defer func() {
+		if !success {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	manifest := &ForgeManifest{
+		URL: rawURL, Kind: project.Kind, Host: project.Host, Project: project.Path,
+		Repository: repo, Threads: []ForgeThread{}, Releases: []ForgeRelease{},
+		RetrievedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	warn := func(format string, args ...any) {
+		message := fmt.Sprintf(format, args...)
+		fmt.Fprintf(logWriter, "WARNING: %s\n", message)
+		manifest.Warnings = append(manifest.Warnings, message)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "repository.json"), raw, 0o644); err != nil {
+		return Result{}, err
+	}
+
+	// Everything below is best effort: each part that fails is recorded and
+	// the rest of the project is still worth keeping. Only cancellation
+	// stops the run.
+	steps := []func() error{
+		func() error { return a.saveReadme(ctx, client, repo, dir, manifest, warn) },
+		func() error { return a.saveThreads(ctx, client, settings.MaxThreads, dir, manifest, warn, logWriter) },
+		func() error { return a.saveReleases(ctx, client, settings, dir, manifest, warn, logWriter) },
+		func() error { return a.saveWiki(ctx, project, repo, dir, manifest, warn, logWriter) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return Result{}, err
+		}
+		if err := ctx.Err(); err != nil {
+			return Result{}, err
+		}
+	}
+
+	manifest.Completeness = CompletenessComplete
+	if manifest.ThreadsTruncated || len(manifest.Warnings) > 0 {
+		manifest.Completeness = CompletenessPartial
+	}
+	fmt.Fprintf(logWriter, "Saved %d thread(s) and %d release(s); completeness: %s\n",
+		len(manifest.Threads), len(manifest.Releases), manifest.Completeness)
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to encode forge manifest: %w", err)
+	}
+
+	// Release assets can be gigabytes, so the bundle is streamed.
+	pipeReader, pipeWriter := io.Pipe()
+	success = true
+	go func() {
+		defer pipeWriter.Close()
+		defer os.RemoveAll(dir)
+
+		zipWriter := zip.NewWriter(pipeWriter)
+		if err := writeForgeZip(zipWriter, dir, manifestJSON); err != nil {
+			fmt.Fprintf(logWriter, "Error building forge ZIP: %v\n", err)
+			_ = zipWriter.Close()
+			pipeWriter.CloseWithError(err)
+			return
+		}
+		if err := zipWriter.Close(); err != nil {
+			fmt.Fprintf(logWriter, "Error finalizing forge ZIP: %v\n", err)
+			pipeWriter.CloseWithError(err)
+			return
+		}
+		fmt.Fprintf(logWriter, "Forge archive completed successfully\n")
+	}()
+
+	return Result{
+		Data:         pipeReader,
+		Extension:    ".zip",
+		ContentType:  "application/zip",
+		Metadata:     &Sidecar{Data: manifestJSON},
+		Completeness: manifest.Completeness,
+	}, nil
+}
+
+func (a *ForgeArchiver) saveReadme(ctx context.Context, client *forge.Client, repo *forge.Repository, dir string, manifest *ForgeManifest, warn func(string, ...any)) error {
+	readme, err := client.Readme(ctx, repo)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		warn("README not saved: %v", err)
+		return nil
+	}
+	if readme == nil {
+		return nil
+	}
+	entry := &ForgeReadme{Name: readme.Name, Path: "readme/" + forgeEntryName(readme.Name)}
+	if err := writeForgeFile(dir, entry.Path, readme.Raw); err != nil {
+		return err
+	}
+	if len(readme.HTML) > 0 {
+		entry.HTMLPath = "readme/readme.html"
+		if err := writeForgeFile(dir, entry.HTMLPath, readme.HTML); err != nil {
+			return err
+		}
+	}
+	manifest.Readme = entry
+	return nil
+}
+
+func (a *ForgeArchiver) saveThreads(ctx context.Context, client *forge.Client, limit int, dir string, manifest *ForgeManifest, warn func(string, ...any), logWriter io.Writer) error {
+	threads, truncated, err := client.Threads(ctx, limit)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		warn("issues and pull requests not saved: %v", err)
+		return nil
+	}
+	manifest.ThreadsTruncated = truncated
+	if truncated {
+		fmt.Fprintf(logWriter, "Project has more than %d issues and pull requests; keeping the newest\n", limit)
+	}
+	fmt.Fprintf(logWriter, "Fetching discussion of %d thread(s)\n", len(threads))
+
+	for i := range threads {
+		thread := &threads[i]
+		comments, err := client.Comments(ctx, thread)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			warn("comments of %s #%d not saved: %v", thread.Kind, thread.Number, err)
+		}
+		thread.Comments = comments
+		if thread.Comments == nil {
+			thread.Comments = []forge.Comment{}
+		}
+		prefix := "issue"
+		if thread.Kind == forge.ThreadPullRequest {
+			prefix = "pull"
+		}
+		entryPath := fmt.Sprintf("threads/%s-%d.json", prefix, thread.Number)
+		data, err := json.MarshalIndent(thread, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeForgeFile(dir, entryPath, data); err != nil {
+			return err
+		}
+		manifest.Threads = append(manifest.Threads, ForgeThread{
+			Kind: thread.Kind, Number: thread.Number, Title: thread.Title, State: thread.State,
+			Author: thread.Author, Labels: thread.Labels, CreatedAt: thread.CreatedAt,
+			CommentCount: len(thread.Comments), Path: entryPath,
+		})
+	}
+	return nil
+}
+
+func (a *ForgeArchiver) saveReleases(ctx context.Context, client *forge.Client, settings utils.ForgeConfig, dir string, manifest *ForgeManifest, warn func(string, ...any), logWriter io.Writer) error {
+	releases, err := client.Releases(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		warn("releases not saved: %v", err)
+		return nil
+	}
+	var total int64
+	for _, release := range releases {
+		entry := ForgeRelease{Release: release, Assets: []ForgeAsset{}}
+		releaseDir := "releases/" + forgeEntryName(release.Tag)
+		used := map[string]bool{}
+		for _, asset := range release.Assets {
+			stored := ForgeAsset{Asset: asset}
+			remaining := settings.MaxAssetsTotal - total
+			switch {
+			case asset.Size > settings.MaxAssetBytes:
+				stored.Skipped = fmt.Sprintf("larger than the per-asset limit of %d bytes", settings.MaxAssetBytes)
+			case asset.Size > remaining || remaining <= 0:
+				stored.Skipped = fmt.Sprintf("over the limit of %d bytes for all assets", settings.MaxAssetsTotal)
+			default:
+				name := uniqueForgeName(forgeEntryName(asset.Name), used)
+				entryPath := releaseDir + "/" + name
+				limit := min(settings.MaxAssetBytes, remaining)
+				n, err := downloadForgeAsset(ctx, client, asset.URL, filepath.Join(dir, filepath.FromSlash(entryPath)), limit)
+				total += n
+				if err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					stored.Skipped = err.Error()
+					break
+				}
+				stored.Path, stored.Stored = entryPath, n
+				fmt.Fprintf(logWriter, "Saved asset %s of %s (%d bytes)\n", asset.Name, release.Tag, n)
+			}
+			if stored.Skipped != "" {
+				warn("asset %s of %s not stored: %s", asset.Name, release.Tag, stored.Skipped)
+			}
+			entry.Assets = append(entry.Assets, stored)
+		}
+		manifest.Releases = append(manifest.Releases, entry)
+	}
+	return nil
+}
+
+func downloadForgeAsset(ctx context.Context, client *forge.Client, assetURL, dest string, limit int64) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return 0, err
+	}
+	file, err := os.Create(dest)
+	if err != nil {
+		return 0, err
+	}
+	n, err := client.Download(ctx, assetURL, file, limit)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dest)
+	}
+	return n, err
+}
+
+// saveWiki clones the wiki with its history. GitHub reports has_wiki for
+// projects that never wrote a page, and their wiki repository does not
+// exist; that is no wiki, not a failure.
+func (a *ForgeArchiver) saveWiki(ctx context.Context, project forge.Project, repo *forge.Repository, dir string, manifest *ForgeManifest, warn func(string, ...any), logWriter io.Writer) error {
+	if !repo.HasWiki {
+		return nil
+	}
+	installGitProtocols()
+	wikiDir := filepath.Join(dir, "wiki")
+	fmt.Fprintf(logWriter, "Cloning wiki from %s\n", project.WikiCloneURL())
+	cloned, err := git.PlainCloneContext(ctx, wikiDir, false, &git.CloneOptions{URL: project.WikiCloneURL()})
+	if err != nil {
+		os.RemoveAll(wikiDir)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, transport.ErrRepositoryNotFound) || errors.Is(err, transport.ErrEmptyRemoteRepository) ||
+			errors.Is(err, transport.ErrAuthenticationRequired) {
+			fmt.Fprintf(logWriter, "Project has no wiki pages\n")
+			return nil
+		}
+		warn("wiki not saved: %v", err)
+		return nil
+	}
+	wiki := &ForgeWiki{Path: "wiki", Pages: []string{}}
+	if head, err := cloned.Head(); err == nil {
+		wiki.Commit = head.Hash().String()
+	}
+	filepath.WalkDir(wikiDir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() {
+			rel, _ := filepath.Rel(wikiDir, p)
+			wiki.Pages = append(wiki.Pages, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(wiki.Pages)
+	fmt.Fprintf(logWriter, "Saved wiki with %d page(s)\n", len(wiki.Pages))
+	manifest.Wiki = wiki
+	return nil
+}
+
+// forgeEntryName turns a name chosen by the project (a tag, an asset file
+// name) into one safe ZIP path segment.
+func forgeEntryName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+func uniqueForgeName(name string, used map[string]bool) string {
+	candidate := name
+	ext := path.Ext(name)
+	for i := 2; used[strings.ToLower(candidate)]; i++ {
+		candidate = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+func writeForgeFile(dir, entryPath string, data []byte) error {
+	dest := filepath.Join(dir, filepath.FromSlash(entryPath))
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(dest, data, 0o644)
+}
+
+// writeForgeZip stores the manifest first, so the viewer can read it without
+// the rest, then every file under dir. Release assets are stored
+// uncompressed: they are almost always archives already.
+func writeForgeZip(zipWriter *zip.Writer, dir string, manifestJSON []byte) error {
+	header := &zip.FileHeader{Name: ForgeManifestFilename, Method: zip.Deflate}
+	header.SetModTime(time.Now())
+	writer, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(manifestJSON); err != nil {
+		return err
+	}
+	return filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		method := zip.Deflate
+		if strings.HasPrefix(name, "releases/") {
+			method = zip.Store
+		}
+		return addForgeFileToZip(zipWriter, p, name, method)
+	})
+}
+
+func addForgeFileToZip(zipWriter *zip.Writer, filePath, name string, method uint16) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header := &zip.FileHeader{Name: name, Method: method}
+	header.SetModTime(info.ModTime())
+	writer, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("add %s: %w", name, err)
+	}
+	_, err = io.Copy(writer, file)
+	return err
+}
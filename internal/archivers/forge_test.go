@@ -0,0 +1,131 @@
+package archivers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"arker/internal/utils"
+)
+
+func TestForgeArchiverBundlesProject(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		answers := map[string]string{
+			"/api/v1/repos/ana/lamp": `{"full_name":"ana/lamp","html_url":"` + server.URL + `/ana/lamp","default_branch":"main",
+				"has_wiki":true,"stars_count":2}`,
+			"/api/v1/repos/ana/lamp/raw/README.md": "# Lamp",
+			"/api/v1/repos/ana/lamp/issues": `[{"number":2,"title":"Flicker","state":"open","user":{"login":"ben"},"comments":1},
+				{"number":1,"title":"Switch","state":"closed","user":{"login":"ana"},"comments":0,"pull_request":{}}]`,
+			"/api/v1/repos/ana/lamp/issues/2/comments": `[{"user":{"login":"ana"},"body":"Seen it"}]`,
+			"/api/v1/repos/ana/lamp/releases": `[{"tag_name":"v1/rc","assets":[
+				{"name":"lamp.zip","browser_download_url":"` + server.URL + `/dl/lamp.zip","size":4},
+				{"name":"huge.iso","browser_download_url":"` + server.URL + `/dl/huge.iso","size":9999}]}]`,
+			"/dl/lamp.zip": "PK..",
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/markdown":
+			w.Write([]byte("<h1>Lamp</h1>"))
+		case r.URL.Path == "/api/v1/repos/ana/lamp/issues/1/comments":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		case answers[r.URL.Path] != "":
+			w.Write([]byte(answers[r.URL.Path]))
+		default:
+			// The wiki was never written, so its repository does not exist.
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	previous := utils.ForgeSettings()
+	utils.InitForge(utils.ForgeConfig{Hosts: map[string]string{host: utils.ForgeGitea}, MaxAssetBytes: 1000})
+	defer utils.InitForge(previous)
+
+	var log strings.Builder
+	result, err := (&ForgeArchiver{CheckURL: allowLoopback}).Archive(context.Background(), server.URL+"/ana/lamp/issues/2", &log, nil, 1)
+	if err != nil {
+		t.Fatalf("archive: %v\n%s", err, log.String())
+	}
+	data := readResult(t, result)
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archive.File[0].Name != ForgeManifestFilename {
+		t.Errorf("first entry = %s, want the manifest", archive.File[0].Name)
+	}
+	entries := map[string]string{}
+	for _, file := range archive.File {
+		rc, _ := file.Open()
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		entries[file.Name] = string(content)
+	}
+
+	var manifest ForgeManifest
+	if err := json.Unmarshal(result.Metadata.Data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Project != "ana/lamp" || manifest.Kind != utils.ForgeGitea || manifest.Repository.Stars != 2 {
+		t.Errorf("manifest = %+v", manifest)
+	}
+	if manifest.Readme == nil || entries[manifest.Readme.Path] != "# Lamp" || entries[manifest.Readme.HTMLPath] != "<h1>Lamp</h1>" {
+		t.Errorf("readme = %+v", manifest.Readme)
+	}
+	if len(manifest.Threads) != 2 || manifest.Threads[0].Path != "threads/issue-2.json" || manifest.Threads[1].Path != "threads/pull-1.json" {
+		t.Fatalf("threads = %+v", manifest.Threads)
+	}
+	if !strings.Contains(entries["threads/issue-2.json"], "Seen it") {
+		t.Errorf("issue thread = %s", entries["threads/issue-2.json"])
+	}
+
+	// A tag with a slash must not become a directory, and an asset over the
+	// limit is listed without being stored.
+	assets := manifest.Releases[0].Assets
+	if assets[0].Path != "releases/v1_rc/lamp.zip" || entries[assets[0].Path] != "PK.." {
+		t.Errorf("stored asset = %+v", assets[0])
+	}
+	if assets[1].Path != "" || assets[1].Skipped == "" {
+		t.Errorf("oversized asset = %+v", assets[1])
+	}
+
+	// The missing wiki is not a failure; the oversized asset and the failed
+	// comments are.
+	if manifest.Wiki != nil {
+		t.Errorf("wiki = %+v", manifest.Wiki)
+	}
+	if len(manifest.Warnings) != 2 || result.Completeness != CompletenessPartial || manifest.Completeness != CompletenessPartial {
+		t.Errorf("warnings = %q, completeness %s", manifest.Warnings, result.Completeness)
+	}
+	if entries["repository.json"] == "" {
+		t.Error("raw repository record missing")
+	}
+}
+
+func TestForgeArchiverFailsWithoutProject(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	previous := utils.ForgeSettings()
+	utils.InitForge(utils.ForgeConfig{Hosts: map[string]string{host: utils.ForgeGitLab}})
+	defer utils.InitForge(previous)
+
+	var log strings.Builder
+	if _, err := (&ForgeArchiver{}).Archive(context.Background(), server.URL+"/group/gone", &log, nil, 1); err == nil {
+		t.Error("archiving a missing project succeeded")
+	}
+	if _, err := (&ForgeArchiver{}).Archive(context.Background(), "https://example.com/a/b", &log, nil, 1); err == nil {
+		t.Error("archiving a URL on no forge succeeded")
+	}
+}
+
+// allowLoopback stands in for utils.ValidateURL, which refuses the test
+// servers' loopback addresses.
+func allowLoopback(string) error { return nil }
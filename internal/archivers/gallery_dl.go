@@ -101,7 +101,7 @@ func (a *GalleryDLArchiver) Archive(ctx context.Context, url string, logWriter i
 	// gallery-dl only reads the jar (there is a separate --cookies-export for
 	// writing), but reuse the per-run private copy anyway: it keeps a
 	// read-only mounted secret safe and matches how yt-dlp is invoked.
-	cookieArgs, cleanupCookies, err := utils.MediaCookieArgsForRun()
+	cookieArgs, cleanupCookies, err := utils.MediaCookieArgsForRun(url, logWriter)
 	if err != nil {
 		fmt.Fprintf(logWriter, "Failed to prepare gallery-dl cookies: %v\n", err)
 		return Result{}, err
@@ -3,24 +3,44 @@ package archivers
 import (
 	"archive/tar"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-
-	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing/transport/client"
-	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
-	"gorm.io/gorm"
 	"os"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"sync"
 	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"gorm.io/gorm"
+
+	"arker/internal/gitcache"
+	"arker/internal/storage"
+	"arker/internal/utils"
 )
 
-// GitArchiver
-type GitArchiver struct{}
+// GitArchiver stores a bare clone of a repository as a tar, with the LFS
+// objects its branches and tags point to under lfs/. Submodules are not
+// cloned into it: they are reported in Result.Submodules and captured on
+// their own.
+type GitArchiver struct {
+	// Store holds earlier captures. When it is set, a repository captured
+	// before is fetched on top of its latest completed capture and only the
+	// objects that capture lacks are stored, as a gitcache delta. Nil always
+	// stores a full clone.
+	Store storage.Storage
+	// LFSMaxBytes caps the LFS content fetched per capture. Objects past it
+	// are left out and the capture is partial; zero fetches none.
+	LFSMaxBytes int64
+	// CheckURL vets the LFS server, the download URLs it hands out and the
+	// redirects of both, which the repository chooses; nil means
+	// utils.ValidateURL.
+	CheckURL func(rawURL string) error
+}
 
 var (
 	gitHTTPClientOnce sync.Once
@@ -40,11 +60,30 @@ func getGitHTTPClient() *http.Client {
 		gitHTTPClient = &http.Client{
 			Transport: transport,
 			Timeout:   5 * time.Minute, // Overall request timeout
+			// The first URL was validated when it was submitted; a server
+			// redirecting elsewhere must not reach internal hosts either.
+			CheckRedirect: checkRedirects(utils.ValidateURL),
 		}
 	})
 	return gitHTTPClient
 }
 
+// maxRedirects matches net/http's own limit.
+const maxRedirects = 10
+
+// checkRedirects is a CheckRedirect that vets every hop with check.
+func checkRedirects(check func(rawURL string) error) func(*http.Request, []*http.Request) error {
+	return func(next *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		if err := check(next.URL.String()); err != nil {
+			return fmt.Errorf("refusing redirect to %s: %w", next.URL.Host, err)
+		}
+		return nil
+	}
+}
+
 var installGitProtocolsOnce sync.Once
 
 // installGitProtocols registers the pooled HTTP client for git http(s)
@@ -73,8 +112,8 @@ func (a *GitArchiver) Archive(ctx context.Context, url string, logWriter io.Writ
 	// Register the pooled HTTP client for git operations exactly once.
 	installGitProtocols()
 
-	// Extract repository URL for GitHub URLs with extra paths
-	repoURL := extractGitRepoURL(url)
+	// Reduce a link into the repository's web pages to the repository
+	repoURL := utils.GitRepoURL(url)
 	if repoURL != url {
 		fmt.Fprintf(logWriter, "Extracted repository URL: %s\n", repoURL)
 	}
@@ -86,18 +125,144 @@ func (a *GitArchiver) Archive(ctx context.Context, url string, logWriter io.Writ
 	}
 	cleanup := func() { os.RemoveAll(tempDir) }
 
-	fmt.Fprintf(logWriter, "Cloning repository to: %s\n", tempDir)
-	_, err = git.PlainCloneContext(ctx, tempDir, true, &git.CloneOptions{
-		URL:      repoURL,
-		Progress: logWriter,
-	})
+	var base *gitBase
+	var had map[string]bool
+	if a.Store != nil && db != nil {
+		base, err = findGitBase(db, a.Store, itemID, repoURL)
+		if err != nil {
+			fmt.Fprintf(logWriter, "Could not look for an earlier capture: %v\n", err)
+		}
+		if base != nil {
+			fmt.Fprintf(logWriter, "Fetching only what changed since capture %s\n", base.shortID)
+			had, err = a.fetchDelta(ctx, tempDir, repoURL, base, logWriter)
+			if err != nil {
+				if ctx.Err() != nil {
+					cleanup()
+					return Result{}, ctx.Err()
+				}
+				// Whatever went wrong with the earlier capture, a full clone
+				// does not depend on it.
+				fmt.Fprintf(logWriter, "Incremental fetch failed, storing a full clone instead: %v\n", err)
+				cleanup()
+				if tempDir, err = os.MkdirTemp("", "git-archive-"); err != nil {
+					return Result{}, err
+				}
+				cleanup = func() { os.RemoveAll(tempDir) }
+				base = nil
+			}
+		}
+	}
+
+	if base == nil {
+		fmt.Fprintf(logWriter, "Cloning repository to: %s\n", tempDir)
+		_, err = git.PlainCloneContext(ctx, tempDir, true, &git.CloneOptions{
+			URL:      repoURL,
+			Progress: logWriter,
+		})
+		if err != nil {
+			fmt.Fprintf(logWriter, "Failed to clone repository: %v\n", err)
+			cleanup()
+			return Result{}, err
+		}
+		fmt.Fprintf(logWriter, "Repository cloned successfully\n")
+	}
+
+	manifest, err := a.completeClone(ctx, tempDir, repoURL, logWriter)
 	if err != nil {
-		fmt.Fprintf(logWriter, "Failed to clone repository: %v\n", err)
 		cleanup()
 		return Result{}, err
 	}
-	fmt.Fprintf(logWriter, "Repository cloned successfully\n")
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		cleanup()
+		return Result{}, fmt.Errorf("failed to encode git manifest: %w", err)
+	}
+	result := Result{
+		ContentType:  "application/x-tar",
+		Metadata:     &Sidecar{Data: manifestJSON},
+		Completeness: manifest.Completeness,
+		Submodules:   manifest.Submodules,
+	}
 
+	if base != nil {
+		write, err := deltaWriter(tempDir, base, had, logWriter)
+		if err != nil {
+			cleanup()
+			return Result{}, err
+		}
+		result.Data = streamGitTar(ctx, logWriter, cleanup, write)
+		result.Extension = gitcache.DeltaExtension
+		return result, nil
+	}
+	write := func(tw *tar.Writer) error { return AddDirToTar(tw, tempDir, "") }
+	result.Data = streamGitTar(ctx, logWriter, cleanup, write)
+	result.Extension = ".tar"
+	return result, nil
+}
+
+// GitManifest is the metadata of a git capture: what the repository refers
+// to beyond its own objects, and how much of it the capture holds.
+type GitManifest struct {
+	URL string `json:"url"`
+	// Submodules are captured separately, each as a capture of its own
+	// repository linked to this one.
+	Submodules []GitSubmoduleRef `json:"submodules,omitempty"`
+	LFS        *GitLFSReport     `json:"lfs,omitempty"`
+	// Warnings name what could not be captured. Any warning, or any LFS
+	// object not stored, makes the capture partial.
+	Warnings     []string `json:"warnings,omitempty"`
+	Completeness string   `json:"completeness"`
+	RetrievedAt  string   `json:"retrieved_at"`
+}
+
+// completeClone finds the submodules and fetches the LFS objects of the
+// fresh clone or fetch in dir.
+func (a *GitArchiver) completeClone(ctx context.Context, dir, repoURL string, logWriter io.Writer) (*GitManifest, error) {
+	manifest := &GitManifest{URL: repoURL, RetrievedAt: time.Now().UTC().Format(time.RFC3339)}
+	warn := func(format string, args ...any) {
+		message := fmt.Sprintf(format, args...)
+		fmt.Fprintf(logWriter, "WARNING: %s\n", message)
+		manifest.Warnings = append(manifest.Warnings, message)
+	}
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	submodules, warnings, err := scanSubmodules(repo, repoURL)
+	if err != nil {
+		warn("submodules could not be listed: %v", err)
+	}
+	for _, w := range warnings {
+		warn("%s", w)
+	}
+	manifest.Submodules = submodules
+	if len(submodules) > 0 {
+		fmt.Fprintf(logWriter, "Found %d submodules\n", len(submodules))
+	}
+
+	checkURL := a.CheckURL
+	if checkURL == nil {
+		checkURL = utils.ValidateURL
+	}
+	manifest.LFS, err = fetchLFS(ctx, repo, dir, repoURL, a.LFSMaxBytes, checkURL, logWriter)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		warn("LFS objects could not be fetched: %v", err)
+	}
+
+	manifest.Completeness = CompletenessComplete
+	if len(manifest.Warnings) > 0 || (manifest.LFS != nil && len(manifest.LFS.Skipped) > 0) {
+		manifest.Completeness = CompletenessPartial
+	}
+	return manifest, nil
+}
+
+// streamGitTar runs write into a tar read from the returned reader, and
+// calls cleanup once the tar is complete or abandoned.
+func streamGitTar(ctx context.Context, logWriter io.Writer, cleanup func(), write func(*tar.Writer) error) io.Reader {
 	pr, pw := io.Pipe()
 
 	// Start context-aware tar creation in a goroutine
@@ -122,7 +287,7 @@ func (a *GitArchiver) Archive(ctx context.Context, url string, logWriter io.Writ
 		// Use a channel to signal completion
 		done := make(chan error, 1)
 		go func() {
-			done <- AddDirToTar(tw, tempDir, "")
+			done <- write(tw)
 		}()
 
 		// Wait for either completion or context cancellation
@@ -140,32 +305,7 @@ func (a *GitArchiver) Archive(ctx context.Context, url string, logWriter io.Writ
 		}
 	}()
 
-	return Result{Data: pr, Extension: ".tar", ContentType: "application/x-tar"}, nil
-}
-
-// extractGitRepoURL extracts the repository URL from GitHub URLs with extra paths and fragments
-func extractGitRepoURL(url string) string {
-	// First, strip any fragment (part after #)
-	if fragmentIndex := regexp.MustCompile(`#.*$`).FindStringIndex(url); fragmentIndex != nil {
-		url = url[:fragmentIndex[0]]
-	}
-
-	// GitHub repository URL pattern: https://github.com/owner/repo
-	githubPattern := regexp.MustCompile(`^(https?://github\.com/[^/]+/[^/]+)(/.*)?$`)
-
-	if matches := githubPattern.FindStringSubmatch(url); len(matches) > 1 {
-		return matches[1] // Return just the repo part
-	}
-
-	// GitLab repository URL pattern: https://gitlab.com/owner/repo
-	gitlabPattern := regexp.MustCompile(`^(https?://gitlab\.com/[^/]+/[^/]+)(/.*)?$`)
-
-	if matches := gitlabPattern.FindStringSubmatch(url); len(matches) > 1 {
-		return matches[1] // Return just the repo part
-	}
-
-	// For other URLs, return as-is
-	return url
+	return pr
 }
 
 // Helper to tar dir streaming.
@@ -0,0 +1,323 @@
+package archivers
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"gorm.io/gorm"
+
+	"arker/internal/gitcache"
+	"arker/internal/storage"
+	"arker/internal/utils"
+)
+
+// gitBase is the earlier capture an incremental capture builds on.
+type gitBase struct {
+	shortID    string
+	storageKey string
+	depth      int // deltas between it and a full capture, 0 for a full one
+}
+
+// findGitBase returns the latest completed git capture of the same
+// repository, or nil when there is none or its chain of deltas is already
+// as long as it may get.
+func findGitBase(db *gorm.DB, store storage.Storage, itemID uint, repoURL string) (*gitBase, error) {
+	want := canonicalGitRepo(repoURL)
+	if want == "" {
+		return nil, nil
+	}
+	var rows []struct {
+		StorageKey string
+		ShortID    string
+		Original   string
+	}
+	// The LIKE only narrows the candidates; spellings are compared below.
+	err := db.Table("archive_items").
+		Select("archive_items.storage_key, captures.short_id, archived_urls.original").
+		Joins("JOIN captures ON captures.id = archive_items.capture_id").
+		Joins("JOIN archived_urls ON archived_urls.id = captures.archived_url_id").
+		Where("archive_items.type = ? AND archive_items.status = ? AND archive_items.id <> ?", "git", "completed", itemID).
+		Where("archive_items.deleted_at IS NULL AND archive_items.storage_key <> ''").
+		Where("LOWER(archived_urls.original) LIKE ?", want+"%").
+		Order("archive_items.id DESC").
+		Limit(50).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if canonicalGitRepo(utils.GitRepoURL(row.Original)) != want {
+			continue
+		}
+		d, err := gitcache.ReadDelta(store, row.StorageKey)
+		if err != nil {
+			return nil, err
+		}
+		base := &gitBase{shortID: row.ShortID, storageKey: row.StorageKey}
+		if d != nil {
+			base.depth = d.Depth
+		}
+		if base.depth+1 > gitcache.MaxDeltaDepth {
+			return nil, nil
+		}
+		return base, nil
+	}
+	return nil, nil
+}
+
+// canonicalGitRepo reduces a repository URL to the form two captures of the
+// same repository share: scheme and host lowercased, the path without a
+// trailing slash or .git. Hosts treat owner and repository names without
+// regard to case, so the path is lowercased too.
+func canonicalGitRepo(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Host == "" && u.Scheme != "file") {
+		return ""
+	}
+	p := strings.TrimSuffix(strings.TrimRight(u.Path, "/"), ".git")
+	return strings.ToLower(u.Scheme + "://" + u.Host + p)
+}
+
+// fetchDelta rebuilds base's repository in dir and fetches the remote into
+// it. It returns the object and LFS files the rebuilt repository already
+// had, for deltaWriter to leave out.
+func (a *GitArchiver) fetchDelta(ctx context.Context, dir, repoURL string, base *gitBase, logWriter io.Writer) (map[string]bool, error) {
+	if _, err := gitcache.Unpack(a.Store, base.storageKey, dir); err != nil {
+		return nil, fmt.Errorf("rebuild capture %s: %w", base.shortID, err)
+	}
+	had, err := listContentFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// The same refs a clone keeps: branches under refs/remotes/origin, every
+	// tag, and the default branch as the one local branch.
+	remote := git.NewRemote(repo.Storer, &config.RemoteConfig{Name: "origin", URLs: []string{repoURL}})
+	advertised, err := remote.ListContext(ctx, &git.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	err = remote.FetchContext(ctx, &git.FetchOptions{
+		RefSpecs: []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+		Tags:     git.AllTags,
+		Prune:    true,
+		Force:    true,
+		Progress: logWriter,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil, err
+	}
+	if err := resetLocalBranch(repo, advertised); err != nil {
+		return nil, err
+	}
+	old := make(map[string]bool, len(had))
+	for _, name := range had {
+		old[name] = true
+	}
+	return old, nil
+}
+
+// deltaWriter returns a writer for the delta tar of the repository in dir:
+// the marker, the object and LFS files not in had, and the repository's
+// refs as they now stand.
+func deltaWriter(dir string, base *gitBase, had map[string]bool, logWriter io.Writer) (func(*tar.Writer) error, error) {
+	now, err := listContentFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	var added []string
+	for _, name := range now {
+		if !had[name] {
+			added = append(added, name)
+		}
+	}
+	fmt.Fprintf(logWriter, "Fetched %d new object files\n", len(added))
+	refs, err := listFiles(dir, "refs")
+	if err != nil {
+		return nil, err
+	}
+	names := append([]string{"HEAD", "config"}, refs...)
+	if _, err := os.Stat(filepath.Join(dir, "packed-refs")); err == nil {
+		names = append(names, "packed-refs")
+	}
+	names = append(names, added...)
+
+	marker, err := json.Marshal(gitcache.Delta{
+		ParentShortID:    base.shortID,
+		ParentStorageKey: base.storageKey,
+		Depth:            base.depth + 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func(tw *tar.Writer) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     gitcache.DeltaMarker,
+			Size:     int64(len(marker)),
+			Mode:     0644,
+			ModTime:  time.Unix(0, 0),
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(marker); err != nil {
+			return err
+		}
+		return addFilesToTar(tw, dir, names)
+	}, nil
+}
+
+// listContentFiles lists the files a delta stores only when they are new:
+// git objects and LFS objects. Neither ever changes once written.
+func listContentFiles(dir string) ([]string, error) {
+	objects, err := listFiles(dir, "objects")
+	if err != nil {
+		return nil, err
+	}
+	lfs, err := listFiles(dir, filepath.Join("lfs", "objects"))
+	if err != nil {
+		return nil, err
+	}
+	return append(objects, lfs...), nil
+}
+
+// resetLocalBranch points the one local branch a clone has at the remote's
+// default branch, following the remote if its default changed.
+func resetLocalBranch(repo *git.Repository, advertised []*plumbing.Reference) error {
+	var branch plumbing.ReferenceName
+	for _, ref := range advertised {
+		if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+			branch = ref.Target()
+		}
+	}
+	if branch == "" {
+		head, err := repo.Storer.Reference(plumbing.HEAD)
+		if err != nil {
+			return err
+		}
+		branch = head.Target()
+	}
+	tip, err := repo.Storer.Reference(plumbing.NewRemoteReferenceName("origin", branch.Short()))
+	if err != nil {
+		// An empty repository, or a HEAD naming no branch.
+		return nil
+	}
+	iter, err := repo.Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+	var stale []plumbing.ReferenceName
+	iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name().IsBranch() && ref.Name() != branch {
+			stale = append(stale, ref.Name())
+		}
+		return nil
+	})
+	for _, name := range stale {
+		if err := repo.Storer.RemoveReference(name); err != nil {
+			return err
+		}
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(branch, tip.Hash())); err != nil {
+		return err
+	}
+	return repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, branch))
+}
+
+// listFiles returns the regular files under dir/sub, as slash-separated
+// paths relative to dir, sorted.
+func listFiles(dir, sub string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(filepath.Join(dir, sub), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			names = append(names, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+// addFilesToTar writes the named files under dir, and the directories that
+// lead to them, normalized the way AddDirToTar normalizes a whole tree.
+func addFilesToTar(tw *tar.Writer, dir string, names []string) error {
+	sort.Strings(names)
+	written := map[string]bool{}
+	for _, name := range names {
+		var parents []string
+		for d := path.Dir(name); d != "."; d = path.Dir(d) {
+			parents = append([]string{d}, parents...)
+		}
+		for _, d := range parents {
+			if written[d] {
+				continue
+			}
+			written[d] = true
+			if err := tw.WriteHeader(&tar.Header{
+				Name:     d + "/",
+				Mode:     0755,
+				ModTime:  time.Unix(0, 0),
+				Typeflag: tar.TypeDir,
+			}); err != nil {
+				return err
+			}
+		}
+		f, err := os.Open(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		mode := int64(0644)
+		if fi.Mode()&0111 != 0 {
+			mode = 0755
+		}
+		err = tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Size:     fi.Size(),
+			Mode:     mode,
+			ModTime:  time.Unix(0, 0),
+			Typeflag: tar.TypeReg,
+		})
+		if err == nil {
+			_, err = io.Copy(tw, f)
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package archivers
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"arker/internal/gitcache"
+	"arker/internal/models"
+	"arker/internal/storage"
+)
+
+// TestGitArchiveStoresOnlyNewObjects captures a repository, lets it gain a
+// commit and a branch, and captures it again: the second capture is a delta
+// on the first that rebuilds into the whole repository.
+func TestGitArchiveStoresOnlyNewObjects(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available")
+	}
+	repo := t.TempDir()
+	runGit(t, repo, "init", "--quiet", "--initial-branch=main")
+	runGit(t, repo, "config", "user.email", "t@t.test")
+	runGit(t, repo, "config", "user.name", "t")
+	for _, size := range []int{200 << 10, 10} {
+		data := make([]byte, size)
+		rand.Read(data)
+		os.WriteFile(filepath.Join(repo, "file"), data, 0644)
+		runGit(t, repo, "add", ".")
+		runGit(t, repo, "commit", "--quiet", "-m", "commit")
+	}
+	repoURL := "file://" + repo
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.ArchivedURL{}, &models.Capture{}, &models.ArchiveItem{}); err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewMemoryStorage()
+	a := &GitArchiver{Store: store}
+	archivedURL := models.ArchivedURL{Original: repoURL, CanonicalURL: repoURL}
+	db.Create(&archivedURL)
+	capture := func(shortID string) (*models.ArchiveItem, Result) {
+		t.Helper()
+		c := models.Capture{ArchivedURLID: archivedURL.ID, ShortID: shortID, Timestamp: time.Now()}
+		db.Create(&c)
+		item := &models.ArchiveItem{CaptureID: c.ID, Type: "git", Status: "processing"}
+		db.Create(item)
+		res, err := a.Archive(context.Background(), repoURL, io.Discard, db, item.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := shortID + "/git" + res.Extension
+		w, _ := store.Writer(key)
+		if _, err := io.Copy(w, res.Data); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+		db.Model(item).Updates(map[string]any{"status": "completed", "storage_key": key, "extension": res.Extension})
+		return item, res
+	}
+
+	_, full := capture("first")
+	if full.Extension != ".tar" {
+		t.Fatalf("first capture extension = %q, want a full .tar", full.Extension)
+	}
+
+	os.WriteFile(filepath.Join(repo, "other"), []byte("new"), 0644)
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "--quiet", "-m", "third")
+	runGit(t, repo, "branch", "feature")
+	_, delta := capture("second")
+	if delta.Extension != gitcache.DeltaExtension {
+		t.Fatalf("second capture extension = %q, want %q", delta.Extension, gitcache.DeltaExtension)
+	}
+	fullSize, _ := store.Size("first/git.tar")
+	deltaSize, _ := store.Size("second/git" + gitcache.DeltaExtension)
+	if deltaSize*4 > fullSize {
+		t.Errorf("delta is %d bytes against the full capture's %d", deltaSize, fullSize)
+	}
+	d, err := gitcache.ReadDelta(store, "second/git"+gitcache.DeltaExtension)
+	if err != nil || d == nil || d.ParentShortID != "first" || d.Depth != 1 {
+		t.Errorf("delta marker = %+v, %v", d, err)
+	}
+
+	dir := t.TempDir()
+	if _, err := gitcache.Unpack(store, "second/git"+gitcache.DeltaExtension, dir); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "fsck", "--strict")
+	for _, ref := range []string{"HEAD", "refs/heads/main", "refs/remotes/origin/feature"} {
+		got, err := exec.Command("git", "-C", dir, "rev-parse", ref).Output()
+		want, _ := exec.Command("git", "-C", repo, "rev-parse", "HEAD").Output()
+		if err != nil || string(got) != string(want) {
+			t.Errorf("%s = %s, %v; want %s", ref, got, err, want)
+		}
+	}
+
+	// Nothing new upstream still records the refs as they stand.
+	_, again := capture("third")
+	if again.Extension != gitcache.DeltaExtension {
+		t.Errorf("unchanged capture extension = %q", again.Extension)
+	}
+	if d, _ := gitcache.ReadDelta(store, "third/git"+gitcache.DeltaExtension); d == nil || d.ParentShortID != "second" || d.Depth != 2 {
+		t.Errorf("unchanged capture marker = %+v", d)
+	}
+}
+
+func TestCanonicalGitRepo(t *testing.T) {
+	for _, tc := range []struct{ a, b string }{
+		{"https://github.com/Owner/Repo", "https://github.com/owner/repo.git"},
+		{"https://GitLab.com/group/project/", "https://gitlab.com/group/project"},
+	} {
+		if canonicalGitRepo(tc.a) != canonicalGitRepo(tc.b) || canonicalGitRepo(tc.a) == "" {
+			t.Errorf("%s and %s differ: %q %q", tc.a, tc.b, canonicalGitRepo(tc.a), canonicalGitRepo(tc.b))
+		}
+	}
+	if canonicalGitRepo("https://github.com/owner/repo") == canonicalGitRepo("https://github.com/owner/repo2") {
+		t.Error("different repositories share a canonical form")
+	}
+}
@@ -0,0 +1,449 @@
+package archivers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	formatcfg "github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// LFS objects are stored where git-lfs keeps them in a repository, so a
+// rebuilt capture works with git lfs as it is:
+// lfs/objects/<oid[0:2]>/<oid[2:4]>/<oid>.
+
+const (
+	lfsPointerVersion = "version https://git-lfs.github.com/spec/v1"
+	// lfsMaxPointerSize bounds the blobs read as candidate pointers. Real
+	// pointers are around 130 bytes.
+	lfsMaxPointerSize = 1024
+	lfsBatchSize      = 100
+	lfsMediaType      = "application/vnd.git-lfs+json"
+)
+
+// GitLFSReport is the LFS part of a git capture's metadata.
+type GitLFSReport struct {
+	// Objects counts the distinct LFS objects the branches and tags point to.
+	Objects int `json:"objects"`
+	// Stored counts those in the capture: fetched now, or kept by the
+	// capture this one builds on.
+	Stored       int   `json:"stored"`
+	Fetched      int   `json:"fetched"`
+	FetchedBytes int64 `json:"fetched_bytes"`
+	// Skipped names every object not stored and why. Any makes the capture
+	// partial.
+	Skipped []GitLFSSkipped `json:"skipped,omitempty"`
+}
+
+// GitLFSSkipped is an LFS object a capture does not hold.
+type GitLFSSkipped struct {
+	OID    string `json:"oid"`
+	Size   int64  `json:"size"`
+	Reason string `json:"reason"`
+}
+
+type lfsPointer struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// scanLFSPointers returns the LFS pointers in the trees of every branch and
+// tag, each object once, ordered by oid.
+func scanLFSPointers(repo *git.Repository) ([]lfsPointer, error) {
+	refs, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+	var tips []plumbing.Hash
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			tips = append(tips, ref.Hash())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[plumbing.Hash]bool{}
+	found := map[string]lfsPointer{}
+	var walk func(tree *object.Tree) error
+	walk = func(tree *object.Tree) error {
+		for _, e := range tree.Entries {
+			if seen[e.Hash] {
+				continue
+			}
+			seen[e.Hash] = true
+			switch e.Mode {
+			case filemode.Dir:
+				sub, err := repo.TreeObject(e.Hash)
+				if err != nil {
+					return err
+				}
+				if err := walk(sub); err != nil {
+					return err
+				}
+			case filemode.Regular, filemode.Executable:
+				p, ok, err := readLFSPointer(repo, e.Hash)
+				if err != nil {
+					return err
+				}
+				if ok {
+					found[p.OID] = p
+				}
+			}
+		}
+		return nil
+	}
+	for _, tip := range tips {
+		commit, err := peelToCommit(repo, tip)
+		if err != nil || commit == nil || seen[commit.TreeHash] {
+			continue
+		}
+		seen[commit.TreeHash] = true
+		tree, err := commit.Tree()
+		if err != nil {
+			return nil, err
+		}
+		if err := walk(tree); err != nil {
+			return nil, err
+		}
+	}
+
+	pointers := make([]lfsPointer, 0, len(found))
+	for _, p := range found {
+		pointers = append(pointers, p)
+	}
+	sort.Slice(pointers, func(i, j int) bool { return pointers[i].OID < pointers[j].OID })
+	return pointers, nil
+}
+
+// peelToCommit follows annotated tags down to a commit. Tags of trees and
+// blobs give nil.
+func peelToCommit(repo *git.Repository, h plumbing.Hash) (*object.Commit, error) {
+	for range 8 {
+		obj, err := repo.Object(plumbing.AnyObject, h)
+		if err != nil {
+			return nil, err
+		}
+		switch o := obj.(type) {
+		case *object.Commit:
+			return o, nil
+		case *object.Tag:
+			h = o.Target
+		default:
+			return nil, nil
+		}
+	}
+	return nil, nil
+}
+
+// readLFSPointer parses a blob as an LFS pointer file without reading blobs
+// too large to be one.
+func readLFSPointer(repo *git.Repository, h plumbing.Hash) (lfsPointer, bool, error) {
+	obj, err := repo.Storer.EncodedObject(plumbing.BlobObject, h)
+	if err != nil {
+		return lfsPointer{}, false, err
+	}
+	if obj.Size() > lfsMaxPointerSize || obj.Size() < int64(len(lfsPointerVersion)) {
+		return lfsPointer{}, false, nil
+	}
+	r, err := obj.Reader()
+	if err != nil {
+		return lfsPointer{}, false, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return lfsPointer{}, false, err
+	}
+	p, ok := parseLFSPointer(data)
+	return p, ok, nil
+}
+
+func parseLFSPointer(data []byte) (lfsPointer, bool) {
+	if !bytes.HasPrefix(data, []byte(lfsPointerVersion+"\n")) {
+		return lfsPointer{}, false
+	}
+	var p lfsPointer
+	sizeSeen := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), " ")
+		switch key {
+		case "oid":
+			oid, ok := strings.CutPrefix(value, "sha256:")
+			if !ok || len(oid) != 64 {
+				return lfsPointer{}, false
+			}
+			if _, err := hex.DecodeString(oid); err != nil {
+				return lfsPointer{}, false
+			}
+			p.OID = strings.ToLower(oid)
+		case "size":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return lfsPointer{}, false
+			}
+			p.Size, sizeSeen = n, true
+		}
+	}
+	return p, p.OID != "" && sizeSeen
+}
+
+// lfsObjectPath is where an object lives in the repository at dir.
+func lfsObjectPath(dir, oid string) string {
+	return filepath.Join(dir, "lfs", "objects", oid[0:2], oid[2:4], oid)
+}
+
+// lfsEndpoint is the LFS server of a repository: lfs.url from the
+// .lfsconfig on HEAD when the repository names one, otherwise the
+// "<repository>.git/info/lfs" every hosted LFS server answers on.
+func lfsEndpoint(repo *git.Repository, repoURL string) string {
+	if head, err := repo.Head(); err == nil {
+		if commit, err := repo.CommitObject(head.Hash()); err == nil {
+			if file, err := commit.File(".lfsconfig"); err == nil {
+				if content, err := file.Contents(); err == nil {
+					cfg := formatcfg.New()
+					if formatcfg.NewDecoder(strings.NewReader(content)).Decode(cfg) == nil {
+						if u := cfg.Section("lfs").Option("url"); u != "" {
+							return strings.TrimSuffix(u, "/")
+						}
+					}
+				}
+			}
+		}
+	}
+	u, err := url.Parse(repoURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	u.User = nil
+	u.RawQuery, u.Fragment = "", ""
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	if !strings.HasSuffix(u.Path, ".git") {
+		u.Path += ".git"
+	}
+	return u.String() + "/info/lfs"
+}
+
+// fetchLFS downloads the LFS objects the repository at dir points to into
+// its lfs directory, up to maxBytes of new content. Objects already there
+// (from the capture a delta builds on) are not fetched again. The repository
+// names the LFS server and the server names the download URLs, so each, and
+// each redirect, must pass checkURL; an object behind one that does not is
+// skipped. Failing objects are reported, not returned as errors; only
+// cancellation is.
+func fetchLFS(ctx context.Context, repo *git.Repository, dir, repoURL string, maxBytes int64, checkURL func(rawURL string) error, logWriter io.Writer) (*GitLFSReport, error) {
+	pointers, err := scanLFSPointers(repo)
+	if err != nil {
+		return nil, fmt.Errorf("scan for LFS pointers: %w", err)
+	}
+	if len(pointers) == 0 {
+		return nil, nil
+	}
+	report := &GitLFSReport{Objects: len(pointers)}
+	skip := func(p lfsPointer, reason string) {
+		report.Skipped = append(report.Skipped, GitLFSSkipped{OID: p.OID, Size: p.Size, Reason: reason})
+	}
+
+	var wanted []lfsPointer
+	budget := maxBytes
+	for _, p := range pointers {
+		if fi, err := os.Stat(lfsObjectPath(dir, p.OID)); err == nil && fi.Size() == p.Size {
+			report.Stored++
+			continue
+		}
+		if p.Size > budget {
+			skip(p, "over the LFS size limit")
+			continue
+		}
+		budget -= p.Size
+		wanted = append(wanted, p)
+	}
+	fmt.Fprintf(logWriter, "Found %d LFS objects: %d already stored, %d to fetch\n", len(pointers), report.Stored, len(wanted))
+
+	endpoint := lfsEndpoint(repo, repoURL)
+	if endpoint == "" && len(wanted) > 0 {
+		for _, p := range wanted {
+			skip(p, "no LFS server for this repository")
+		}
+		wanted = nil
+	}
+	if endpoint != "" && len(wanted) > 0 {
+		if err := checkURL(endpoint); err != nil {
+			reason := fmt.Sprintf("refusing LFS server %s: %v", endpoint, err)
+			for _, p := range wanted {
+				skip(p, reason)
+			}
+			wanted = nil
+		}
+	}
+	batchClient := *getGitHTTPClient()
+	batchClient.CheckRedirect = checkRedirects(checkURL)
+	// No overall timeout: objects can be gigabytes. The job's context bounds
+	// the download instead.
+	downloadClient := &http.Client{Transport: batchClient.Transport, CheckRedirect: batchClient.CheckRedirect}
+	for start := 0; start < len(wanted); start += lfsBatchSize {
+		batch := wanted[start:min(start+lfsBatchSize, len(wanted))]
+		actions, err := lfsBatch(ctx, &batchClient, endpoint, batch)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			for _, p := range batch {
+				skip(p, err.Error())
+			}
+			continue
+		}
+		for _, p := range batch {
+			action, ok := actions[p.OID]
+			if !ok {
+				skip(p, "the LFS server did not list it")
+				continue
+			}
+			if action.err != "" {
+				skip(p, action.err)
+				continue
+			}
+			if err := checkURL(action.href); err != nil {
+				skip(p, fmt.Sprintf("refusing download URL: %v", err))
+				continue
+			}
+			if err := downloadLFSObject(ctx, downloadClient, dir, p, action); err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				skip(p, err.Error())
+				continue
+			}
+			report.Fetched++
+			report.FetchedBytes += p.Size
+			report.Stored++
+		}
+	}
+	fmt.Fprintf(logWriter, "Fetched %d LFS objects (%d bytes); %d not stored\n", report.Fetched, report.FetchedBytes, len(report.Skipped))
+	return report, nil
+}
+
+// lfsAction is the batch API's answer for one object.
+type lfsAction struct {
+	href   string
+	header map[string]string
+	err    string
+}
+
+// lfsBatch asks the LFS server where to download objects from.
+func lfsBatch(ctx context.Context, client *http.Client, endpoint string, objects []lfsPointer) (map[string]lfsAction, error) {
+	body, err := json.Marshal(map[string]any{
+		"operation": "download",
+		"transfers": []string{"basic"},
+		"objects":   objects,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", lfsMediaType)
+	req.Header.Set("Content-Type", lfsMediaType)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("LFS batch request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("LFS batch request: %s", resp.Status)
+	}
+	var parsed struct {
+		Objects []struct {
+			OID     string `json:"oid"`
+			Actions map[string]struct {
+				Href   string            `json:"href"`
+				Header map[string]string `json:"header"`
+			} `json:"actions"`
+			Error *struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"objects"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("LFS batch response: %w", err)
+	}
+	actions := make(map[string]lfsAction, len(parsed.Objects))
+	for _, o := range parsed.Objects {
+		switch download, ok := o.Actions["download"]; {
+		case o.Error != nil:
+			actions[o.OID] = lfsAction{err: fmt.Sprintf("LFS server: %d %s", o.Error.Code, o.Error.Message)}
+		case !ok || download.Href == "":
+			actions[o.OID] = lfsAction{err: "the LFS server offered no download"}
+		default:
+			actions[o.OID] = lfsAction{href: download.Href, header: download.Header}
+		}
+	}
+	return actions, nil
+}
+
+// downloadLFSObject stores one object, checked against its pointer's oid
+// and size before it is put in place.
+func downloadLFSObject(ctx context.Context, client *http.Client, dir string, p lfsPointer, action lfsAction) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, action.href, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range action.header {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("download: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download: %s", resp.Status)
+	}
+
+	final := lfsObjectPath(dir, p.OID)
+	if err := os.MkdirAll(filepath.Dir(final), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(final), ".incoming-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(resp.Body, p.Size+1))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("download: %w", err)
+	}
+	if n != p.Size {
+		return fmt.Errorf("download: got %d bytes, the pointer says %d", n, p.Size)
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != p.OID {
+		return fmt.Errorf("download: content hashes to %s", got)
+	}
+	return os.Rename(tmp.Name(), final)
+}
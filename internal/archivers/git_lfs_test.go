@@ -0,0 +1,259 @@
+package archivers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"arker/internal/gitcache"
+	"arker/internal/models"
+	"arker/internal/storage"
+)
+
+func lfsPointerFile(content []byte) (string, string) {
+	sum := sha256.Sum256(content)
+	oid := hex.EncodeToString(sum[:])
+	return oid, fmt.Sprintf("%s\noid sha256:%s\nsize %d\n", lfsPointerVersion, oid, len(content))
+}
+
+// TestGitArchiveFetchesLFSAndListsSubmodules captures a repository with an
+// LFS file, an LFS file over the size limit and a submodule, then captures
+// it again as a delta that does not download the LFS object twice.
+func TestGitArchiveFetchesLFSAndListsSubmodules(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available")
+	}
+	asset := []byte("model weights")
+	assetOID, assetPointer := lfsPointerFile(asset)
+	_, hugePointer := lfsPointerFile(make([]byte, 1<<20))
+
+	var downloads atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/lfs/objects/batch":
+			var req struct {
+				Objects []lfsPointer `json:"objects"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			var objects []map[string]any
+			for _, o := range req.Objects {
+				objects = append(objects, map[string]any{
+					"oid":     o.OID,
+					"size":    o.Size,
+					"actions": map[string]any{"download": map[string]any{"href": server.URL + "/objects/" + o.OID}},
+				})
+			}
+			w.Header().Set("Content-Type", lfsMediaType)
+			json.NewEncoder(w).Encode(map[string]any{"objects": objects})
+		case r.URL.Path == "/objects/"+assetOID:
+			downloads.Add(1)
+			w.Write(asset)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	root := t.TempDir()
+	repo := filepath.Join(root, "repo")
+	os.Mkdir(repo, 0755)
+	runGit(t, repo, "init", "--quiet", "--initial-branch=main")
+	runGit(t, repo, "config", "user.email", "t@t.test")
+	runGit(t, repo, "config", "user.name", "t")
+	os.WriteFile(filepath.Join(repo, "weights.bin"), []byte(assetPointer), 0644)
+	os.WriteFile(filepath.Join(repo, "huge.bin"), []byte(hugePointer), 0644)
+	os.WriteFile(filepath.Join(repo, ".lfsconfig"), []byte("[lfs]\n\turl = "+server.URL+"/lfs\n"), 0644)
+	os.WriteFile(filepath.Join(repo, ".gitmodules"), []byte("[submodule \"lib\"]\n\tpath = vendor/lib\n\turl = ../lib.git\n"), 0644)
+	pinned := strings.Repeat("ab", 20)
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "update-index", "--add", "--cacheinfo", "160000,"+pinned+",vendor/lib")
+	runGit(t, repo, "commit", "--quiet", "-m", "commit")
+	repoURL := "file://" + repo
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.ArchivedURL{}, &models.Capture{}, &models.ArchiveItem{}); err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewMemoryStorage()
+	a := &GitArchiver{Store: store, LFSMaxBytes: 1 << 10, CheckURL: allowLoopback}
+	archivedURL := models.ArchivedURL{Original: repoURL, CanonicalURL: repoURL}
+	db.Create(&archivedURL)
+	capture := func(shortID string) (string, Result, GitManifest) {
+		t.Helper()
+		c := models.Capture{ArchivedURLID: archivedURL.ID, ShortID: shortID, Timestamp: time.Now()}
+		db.Create(&c)
+		item := &models.ArchiveItem{CaptureID: c.ID, Type: "git", Status: "processing"}
+		db.Create(item)
+		res, err := a.Archive(context.Background(), repoURL, io.Discard, db, item.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := shortID + "/git" + res.Extension
+		w, _ := store.Writer(key)
+		if _, err := io.Copy(w, res.Data); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+		db.Model(item).Updates(map[string]any{"status": "completed", "storage_key": key})
+		var manifest GitManifest
+		if err := json.Unmarshal(res.Metadata.Data, &manifest); err != nil {
+			t.Fatal(err)
+		}
+		return key, res, manifest
+	}
+
+	key, res, manifest := capture("first")
+	if res.Completeness != CompletenessPartial || manifest.Completeness != CompletenessPartial {
+		t.Errorf("completeness = %q, %q; an LFS object over the limit makes the capture partial", res.Completeness, manifest.Completeness)
+	}
+	lfs := manifest.LFS
+	if lfs == nil || lfs.Objects != 2 || lfs.Stored != 1 || lfs.Fetched != 1 || len(lfs.Skipped) != 1 || lfs.Skipped[0].Size != 1<<20 {
+		t.Errorf("lfs report = %+v", lfs)
+	}
+	want := []GitSubmoduleRef{{Path: "vendor/lib", URL: "file://" + filepath.Join(root, "lib.git"), Commit: pinned}}
+	if len(res.Submodules) != 1 || res.Submodules[0] != want[0] {
+		t.Errorf("submodules = %+v, want %+v", res.Submodules, want)
+	}
+	dir := t.TempDir()
+	if _, err := gitcache.Unpack(store, key, dir); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(lfsObjectPath(dir, assetOID)); err != nil || string(got) != string(asset) {
+		t.Errorf("stored LFS object = %q, %v", got, err)
+	}
+
+	key, res, manifest = capture("second")
+	if res.Extension != gitcache.DeltaExtension {
+		t.Fatalf("second capture extension = %q", res.Extension)
+	}
+	if downloads.Load() != 1 || manifest.LFS == nil || manifest.LFS.Stored != 1 || manifest.LFS.Fetched != 0 {
+		t.Errorf("second capture downloaded %d times, report %+v", downloads.Load(), manifest.LFS)
+	}
+	dir = t.TempDir()
+	if _, err := gitcache.Unpack(store, key, dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(lfsObjectPath(dir, assetOID)); err != nil {
+		t.Errorf("delta lost the LFS object of its parent: %v", err)
+	}
+}
+
+// TestFetchLFSRefusesInternalURLs has a repository's LFS server hand out a
+// download URL and a redirect into the link-local range, and then names
+// such a server itself; the objects are skipped, not fetched.
+func TestFetchLFSRefusesInternalURLs(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available")
+	}
+	files := map[string][]byte{"direct.bin": []byte("direct"), "href.bin": []byte("href"), "redirect.bin": []byte("redirect")}
+	oids := map[string]string{}
+	pointers := map[string]string{}
+	for name, content := range files {
+		oids[name], pointers[name] = lfsPointerFile(content)
+	}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/lfs/objects/batch":
+			hrefs := map[string]string{
+				oids["direct.bin"]:   server.URL + "/objects/direct",
+				oids["href.bin"]:     "http://169.254.169.254/latest/meta-data/",
+				oids["redirect.bin"]: server.URL + "/objects/redirect",
+			}
+			var objects []map[string]any
+			for oid, href := range hrefs {
+				objects = append(objects, map[string]any{"oid": oid, "actions": map[string]any{"download": map[string]any{"href": href}}})
+			}
+			json.NewEncoder(w).Encode(map[string]any{"objects": objects})
+		case "/objects/direct":
+			w.Write(files["direct.bin"])
+		case "/objects/redirect":
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	runGit(t, dir, "init", "--quiet", "--initial-branch=main")
+	runGit(t, dir, "config", "user.email", "t@t.test")
+	runGit(t, dir, "config", "user.name", "t")
+	for name, pointer := range pointers {
+		os.WriteFile(filepath.Join(dir, name), []byte(pointer), 0644)
+	}
+	os.WriteFile(filepath.Join(dir, ".lfsconfig"), []byte("[lfs]\n\turl = "+server.URL+"/lfs\n"), 0644)
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "--quiet", "-m", "commit")
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refuseLinkLocal := func(rawURL string) error {
+		if strings.Contains(rawURL, "169.254.") {
+			return errors.New("link-local address")
+		}
+		return nil
+	}
+	report, err := fetchLFS(context.Background(), repo, dir, "file://"+dir, 1<<10, refuseLinkLocal, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Fetched != 1 || len(report.Skipped) != 2 {
+		t.Fatalf("report = %+v, want the direct object fetched and two skipped", report)
+	}
+	for _, skipped := range report.Skipped {
+		if skipped.OID == oids["direct.bin"] || !strings.Contains(skipped.Reason, "refusing") {
+			t.Errorf("skipped %+v", skipped)
+		}
+	}
+
+	// A repository naming an internal LFS server gets no request sent to it.
+	os.RemoveAll(filepath.Join(dir, "lfs"))
+	refuseAll := func(string) error { return errors.New("internal address") }
+	report, err = fetchLFS(context.Background(), repo, dir, "file://"+dir, 1<<10, refuseAll, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Fetched != 0 || len(report.Skipped) != 3 || !strings.Contains(report.Skipped[0].Reason, "refusing LFS server") {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestParseLFSPointer(t *testing.T) {
+	oid, pointer := lfsPointerFile([]byte("x"))
+	if p, ok := parseLFSPointer([]byte(pointer)); !ok || p.OID != oid || p.Size != 1 {
+		t.Errorf("parseLFSPointer = %+v, %v", p, ok)
+	}
+	for _, data := range []string{
+		"just a small file\n",
+		lfsPointerVersion + "\noid sha256:abc\nsize 1\n",
+		lfsPointerVersion + "\noid sha256:" + oid + "\n",
+	} {
+		if _, ok := parseLFSPointer([]byte(data)); ok {
+			t.Errorf("%q parsed as a pointer", data)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package archivers
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+
+	"arker/internal/utils"
+)
+
+// GitSubmoduleRef is one submodule of a captured repository, as its default
+// branch pins it. The worker captures each as a repository of its own.
+type GitSubmoduleRef struct {
+	Path string `json:"path"`
+	// URL is where the submodule clones from, resolved against the parent
+	// repository when .gitmodules gives it relative or over SSH.
+	URL string `json:"url"`
+	// Commit is the gitlink: the commit the parent repository records.
+	Commit string `json:"commit"`
+}
+
+// scanSubmodules lists the submodules of the commit HEAD names. A submodule
+// whose URL cannot be cloned anonymously is returned as a warning instead.
+func scanSubmodules(repo *git.Repository, repoURL string) ([]GitSubmoduleRef, []string, error) {
+	head, err := repo.Head()
+	if err != nil {
+		if err == plumbing.ErrReferenceNotFound {
+			return nil, nil, nil // an empty repository
+		}
+		return nil, nil, err
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := tree.File(".gitmodules")
+	if err != nil {
+		return nil, nil, nil
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return nil, nil, err
+	}
+	modules := config.NewModules()
+	if err := modules.Unmarshal([]byte(content)); err != nil {
+		return nil, []string{fmt.Sprintf(".gitmodules could not be read: %v", err)}, nil
+	}
+
+	var refs []GitSubmoduleRef
+	var warnings []string
+	for _, m := range modules.Submodules {
+		// .gitmodules may name submodules the tree no longer has.
+		entry, err := tree.FindEntry(m.Path)
+		if err != nil || entry.Mode != filemode.Submodule {
+			continue
+		}
+		cloneURL, err := submoduleCloneURL(repoURL, m.URL)
+		if err == nil && !strings.HasPrefix(cloneURL, "file://") {
+			// Any public repository chooses these URLs, and each becomes a
+			// capture of its own.
+			if verr := utils.ValidateURL(cloneURL); verr != nil {
+				err = fmt.Errorf("refusing %s: %v", cloneURL, verr)
+			}
+		}
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("submodule %s: %v", m.Path, err))
+			continue
+		}
+		refs = append(refs, GitSubmoduleRef{Path: m.Path, URL: cloneURL, Commit: entry.Hash.String()})
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Path < refs[j].Path })
+	sort.Strings(warnings)
+	return refs, warnings, nil
+}
+
+// submoduleCloneURL turns a .gitmodules URL into one the git archiver can
+// clone without credentials. Relative URLs resolve against the parent
+// repository the way git resolves them, and SSH and git:// URLs become
+// https, which every public host serves the same repositories over.
+func submoduleCloneURL(parentURL, raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "./") || strings.HasPrefix(raw, "../") {
+		u, err := url.Parse(parentURL)
+		if err != nil {
+			return "", err
+		}
+		u.Path = path.Join("/"+strings.TrimSuffix(u.Path, "/"), raw)
+		u.RawPath = ""
+		return u.String(), nil
+	}
+	// scp-like syntax: [user@]host:path
+	if !strings.Contains(raw, "://") {
+		if host, p, ok := strings.Cut(raw, ":"); ok && !strings.Contains(host, "/") {
+			if _, h, found := strings.Cut(host, "@"); found {
+				host = h
+			}
+			return "https://" + host + "/" + strings.TrimPrefix(p, "/"), nil
+		}
+		return "", fmt.Errorf("unsupported URL %q", raw)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http", "https":
+	case "ssh", "git", "git+ssh", "ssh+git":
+		u.Scheme = "https"
+		u.Host = u.Hostname()
+	case "file":
+		// Only beside a local parent, which is a test fixture.
+		if !strings.HasPrefix(parentURL, "file://") {
+			return "", fmt.Errorf("unsupported URL %q", raw)
+		}
+	default:
+		return "", fmt.Errorf("unsupported URL %q", raw)
+	}
+	u.User = nil
+	return u.String(), nil
+}
@@ -0,0 +1,66 @@
+package archivers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func TestSubmoduleCloneURL(t *testing.T) {
+	parent := "https://github.com/owner/repo"
+	for _, tc := range []struct{ raw, want string }{
+		{"../lib.git", "https://github.com/owner/lib.git"},
+		{"../../other/lib", "https://github.com/other/lib"},
+		{"./nested", "https://github.com/owner/repo/nested"},
+		{"git@github.com:owner/lib.git", "https://github.com/owner/lib.git"},
+		{"ssh://git@gitlab.com:2222/group/lib.git", "https://gitlab.com/group/lib.git"},
+		{"git://git.sr.ht/~ana/lib", "https://git.sr.ht/~ana/lib"},
+		{"https://user@codeberg.org/ana/lib", "https://codeberg.org/ana/lib"},
+	} {
+		got, err := submoduleCloneURL(parent, tc.raw)
+		if err != nil || got != tc.want {
+			t.Errorf("submoduleCloneURL(%q) = %q, %v; want %q", tc.raw, got, err, tc.want)
+		}
+	}
+	for _, raw := range []string{"file:///etc/repo", "/srv/repo", "ftp://example.com/repo"} {
+		if got, err := submoduleCloneURL(parent, raw); err == nil {
+			t.Errorf("submoduleCloneURL(%q) = %q; want an error", raw, got)
+		}
+	}
+}
+
+// .gitmodules is the repository author's to write; a submodule pointing at an
+// internal address is a warning, not a capture.
+func TestScanSubmodulesRefusesInternalURLs(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "repo")
+	os.Mkdir(dir, 0755)
+	runGit(t, dir, "init", "--quiet", "--initial-branch=main")
+	runGit(t, dir, "config", "user.email", "t@t.test")
+	runGit(t, dir, "config", "user.name", "t")
+	os.WriteFile(filepath.Join(dir, ".gitmodules"), []byte("[submodule \"lib\"]\n\tpath = lib\n\turl = ../lib.git\n"+
+		"[submodule \"internal\"]\n\tpath = internal\n\turl = https://10.0.0.5/secret.git\n"), 0644)
+	pinned := strings.Repeat("ab", 20)
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "update-index", "--add", "--cacheinfo", "160000,"+pinned+",lib")
+	runGit(t, dir, "update-index", "--add", "--cacheinfo", "160000,"+pinned+",internal")
+	runGit(t, dir, "commit", "--quiet", "-m", "commit")
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs, warnings, err := scanSubmodules(repo, "file://"+dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 1 || refs[0].Path != "lib" {
+		t.Errorf("submodules = %+v; want only lib", refs)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "submodule internal: refusing https://10.0.0.5/secret.git") {
+		t.Errorf("warnings = %q", warnings)
+	}
+}
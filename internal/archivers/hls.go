@@ -0,0 +1,261 @@
+package archivers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"arker/internal/utils"
+)
+
+// HLSMasterPlaylist is the entry point of a packaged video, relative to the
+// package's root. Every other file is listed by it, directly or through a
+// rendition's media playlist.
+const HLSMasterPlaylist = "master.m3u8"
+
+// HLSRendition is one variant stream of a packaged video.
+type HLSRendition struct {
+	// Name is both the rendition's directory and how it is configured:
+	// "source" for the stream-copied original, "720p" for a transcode.
+	Name     string
+	Width    int64
+	Height   int64
+	Segments int
+	// PeakBandwidth and AverageBandwidth are bits per second measured from
+	// the segments written, which is what BANDWIDTH must describe.
+	PeakBandwidth    int64
+	AverageBandwidth int64
+}
+
+// HLSOutput is the output of PackageHLS: a directory holding the master
+// playlist and one subdirectory per rendition.
+type HLSOutput struct {
+	Dir        string
+	Renditions []HLSRendition
+	// Files are every file to store, as slash-separated paths relative to Dir,
+	// with the master playlist last so a package is never discoverable before
+	// everything it references is.
+	Files []string
+}
+
+// PackageHLS segments a downloaded video into fMP4 HLS under outDir.
+//
+// The "source" rendition is a stream copy: no quality is lost and it costs one
+// read of the file. Height renditions are transcoded with libx264 and only
+// made when they are smaller than the source; if that leaves nothing to make,
+// the source is copied instead.
+func PackageHLS(ctx context.Context, inputPath, outDir string, probe VideoProbe, cfg utils.HLSConfig, logWriter io.Writer) (*HLSOutput, error) {
+	if probe.VideoCodec == "" {
+		return nil, fmt.Errorf("no video stream to segment")
+	}
+	var sourceWidth, sourceHeight int64
+	if probe.Width != nil && probe.Height != nil {
+		sourceWidth, sourceHeight = *probe.Width, *probe.Height
+	}
+
+	plan := hlsRenditionPlan(cfg.Renditions, sourceHeight)
+	pkg := &HLSOutput{Dir: outDir}
+	for _, name := range plan {
+		rendition := HLSRendition{Name: name, Width: sourceWidth, Height: sourceHeight}
+		height := 0
+		if name != utils.HLSSourceRendition {
+			height, _ = strconv.Atoi(strings.TrimSuffix(name, "p"))
+			rendition.Height = int64(height)
+			rendition.Width = scaledWidth(sourceWidth, sourceHeight, int64(height))
+		}
+
+		dir := filepath.Join(outDir, name)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(logWriter, "Segmenting HLS rendition %s\n", name)
+		cmd := exec.CommandContext(ctx, "ffmpeg", hlsFFmpegArgs(inputPath, dir, height, cfg.SegmentSeconds)...)
+		if out, err := runProcessGroup(ctx, cmd); err != nil {
+			return nil, fmt.Errorf("ffmpeg %s: %w: %s", name, err, utils.TruncateForLog(strings.TrimSpace(out), 500))
+		}
+
+		files, err := measureHLSRendition(dir, &rendition)
+		if err != nil {
+			return nil, fmt.Errorf("rendition %s: %w", name, err)
+		}
+		for _, file := range files {
+			pkg.Files = append(pkg.Files, path.Join(name, file))
+		}
+		pkg.Renditions = append(pkg.Renditions, rendition)
+	}
+
+	if err := os.WriteFile(filepath.Join(outDir, HLSMasterPlaylist), []byte(buildHLSMaster(pkg.Renditions)), 0o644); err != nil {
+		return nil, err
+	}
+	pkg.Files = append(pkg.Files, HLSMasterPlaylist)
+	return pkg, nil
+}
+
+// hlsRenditionPlan returns the directory names to produce, in master playlist
+// order. Transcodes at or above the source height would only be bigger copies
+// of the same pixels and are dropped. An unknown source height keeps them all.
+func hlsRenditionPlan(configured []string, sourceHeight int64) []string {
+	var plan []string
+	for _, name := range configured {
+		if name == utils.HLSSourceRendition {
+			plan = append(plan, name)
+			continue
+		}
+		height, err := strconv.Atoi(name)
+		if err != nil || (sourceHeight > 0 && int64(height) >= sourceHeight) {
+			continue
+		}
+		plan = append(plan, fmt.Sprintf("%dp", height))
+	}
+	if len(plan) == 0 {
+		plan = []string{utils.HLSSourceRendition}
+	}
+	return plan
+}
+
+func hlsFFmpegArgs(inputPath, dir string, height, segmentSeconds int) []string {
+	args := []string{"-nostdin", "-hide_banner", "-loglevel", "error", "-y",
+		"-i", inputPath, "-map", "0:v:0", "-map", "0:a:0?"}
+	if height == 0 {
+		args = append(args, "-c", "copy")
+	} else {
+		args = append(args,
+			"-vf", fmt.Sprintf("scale=-2:%d", height),
+			"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p",
+			// Keyframes on the segment grid, so every transcoded segment is
+			// exactly the target length and starts independently.
+			"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", segmentSeconds),
+			"-c:a", "aac", "-b:a", "128k", "-ac", "2")
+	}
+	return append(args,
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(segmentSeconds),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_type", "fmp4",
+		"-hls_fmp4_init_filename", "init.mp4",
+		"-hls_segment_filename", filepath.Join(dir, "seg_%05d.m4s"),
+		filepath.Join(dir, "index.m3u8"))
+}
+
+// measureHLSRendition reads the media playlist ffmpeg wrote, checks that every
+// file it names exists, and fills in the rendition's segment count and
+// bandwidth. It returns the rendition's files, media playlist last.
+func measureHLSRendition(dir string, rendition *HLSRendition) ([]string, error) {
+	f, err := os.Open(filepath.Join(dir, "index.m3u8"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var files []string
+	var totalBytes int64
+	var totalSeconds, duration float64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			uri, ok := hlsAttribute(line, "URI")
+			if !ok {
+				return nil, fmt.Errorf("init segment without a URI")
+			}
+			if err := checkHLSFile(dir, uri); err != nil {
+				return nil, err
+			}
+			files = append(files, uri)
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			duration, _ = strconv.ParseFloat(value, 64)
+		case line == "" || strings.HasPrefix(line, "#"):
+		default:
+			if err := checkHLSFile(dir, line); err != nil {
+				return nil, err
+			}
+			info, err := os.Stat(filepath.Join(dir, line))
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, line)
+			rendition.Segments++
+			totalBytes += info.Size()
+			totalSeconds += duration
+			if duration > 0 {
+				if peak := int64(math.Ceil(float64(info.Size()*8) / duration)); peak > rendition.PeakBandwidth {
+					rendition.PeakBandwidth = peak
+				}
+			}
+			duration = 0
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if rendition.Segments == 0 {
+		return nil, fmt.Errorf("ffmpeg wrote no segments")
+	}
+	if totalSeconds > 0 {
+		rendition.AverageBandwidth = int64(math.Ceil(float64(totalBytes*8) / totalSeconds))
+	}
+	return append(files, "index.m3u8"), nil
+}
+
+// checkHLSFile refuses a playlist entry that is not a plain file in the
+// rendition's own directory. ffmpeg only writes those; anything else would be
+// stored under a key nothing serves.
+func checkHLSFile(dir, name string) error {
+	if name == "" || strings.ContainsAny(name, "/\\") || strings.Contains(name, "://") {
+		return fmt.Errorf("unexpected playlist entry %q", name)
+	}
+	if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+		return fmt.Errorf("playlist names %q, which was not written", name)
+	}
+	return nil
+}
+
+func hlsAttribute(line, name string) (string, bool) {
+	_, attrs, _ := strings.Cut(line, ":")
+	for _, attr := range strings.Split(attrs, ",") {
+		key, value, ok := strings.Cut(attr, "=")
+		if ok && strings.TrimSpace(key) == name {
+			return strings.Trim(strings.TrimSpace(value), `"`), true
+		}
+	}
+	return "", false
+}
+
+// buildHLSMaster writes the master playlist. Renditions are listed in the
+// order given, which puts the source first: players start on the first
+// variant before they have measured bandwidth.
+func buildHLSMaster(renditions []HLSRendition) string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	for _, r := range renditions {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d", max(r.PeakBandwidth, 1))
+		if r.AverageBandwidth > 0 {
+			fmt.Fprintf(&b, ",AVERAGE-BANDWIDTH=%d", r.AverageBandwidth)
+		}
+		if r.Width > 0 && r.Height > 0 {
+			fmt.Fprintf(&b, ",RESOLUTION=%dx%d", r.Width, r.Height)
+		}
+		fmt.Fprintf(&b, "\n%s/index.m3u8\n", r.Name)
+	}
+	return b.String()
+}
+
+// scaledWidth is the width ffmpeg's scale=-2:height produces: the source
+// aspect ratio, rounded to an even number.
+func scaledWidth(sourceWidth, sourceHeight, height int64) int64 {
+	if sourceWidth <= 0 || sourceHeight <= 0 {
+		return 0
+	}
+	width := int64(math.Round(float64(sourceWidth*height) / float64(sourceHeight)))
+	return width + width%2
+}
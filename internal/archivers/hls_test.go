@@ -0,0 +1,108 @@
+package archivers
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"arker/internal/testfixtures"
+	"arker/internal/utils"
+)
+
+func hlsTestProbe(width, height int64) VideoProbe {
+	return VideoProbe{VideoCodec: "h264", Width: &width, Height: &height}
+}
+
+func TestHLSRenditionPlan(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured []string
+		height     int64
+		want       []string
+	}{
+		{"source only", []string{"source"}, 1080, []string{"source"}},
+		{"ladder below the source", []string{"source", "720", "480"}, 1080, []string{"source", "720p", "480p"}},
+		{"rungs at or above the source dropped", []string{"source", "1080", "720", "480"}, 720, []string{"source", "480p"}},
+		{"nothing left falls back to a copy", []string{"720"}, 480, []string{"source"}},
+		{"unknown source height keeps the ladder", []string{"720", "480"}, 0, []string{"720p", "480p"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hlsRenditionPlan(tt.configured, tt.height); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("plan = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPackageHLSWritesMasterOverMeasuredRenditions(t *testing.T) {
+	bin := testfixtures.InstallFakeFFmpegHLS(t, testfixtures.FFmpegHLSFake{})
+	outDir := filepath.Join(t.TempDir(), "hls")
+	cfg := utils.HLSConfig{SegmentSeconds: 6, Renditions: []string{"source", "480"}}
+
+	out, err := PackageHLS(context.Background(), "/tmp/input.mp4", outDir, hlsTestProbe(1920, 1080), cfg, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantFiles := []string{
+		"source/init.mp4", "source/seg_00000.m4s", "source/seg_00001.m4s", "source/index.m3u8",
+		"480p/init.mp4", "480p/seg_00000.m4s", "480p/seg_00001.m4s", "480p/index.m3u8",
+		"master.m3u8",
+	}
+	if !reflect.DeepEqual(out.Files, wantFiles) {
+		t.Errorf("files = %v, want %v", out.Files, wantFiles)
+	}
+	source, low := out.Renditions[0], out.Renditions[1]
+	// 6000 bytes over 6s is the peak; 9000 bytes over 10s the average.
+	if source.Segments != 2 || source.PeakBandwidth != 8000 || source.AverageBandwidth != 7200 {
+		t.Errorf("source = %+v", source)
+	}
+	if low.Width != 854 || low.Height != 480 {
+		t.Errorf("480p = %dx%d, want the source aspect ratio at an even width", low.Width, low.Height)
+	}
+
+	master, err := os.ReadFile(filepath.Join(outDir, "master.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantMaster := "#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-INDEPENDENT-SEGMENTS\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=8000,AVERAGE-BANDWIDTH=7200,RESOLUTION=1920x1080\nsource/index.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=8000,AVERAGE-BANDWIDTH=7200,RESOLUTION=854x480\n480p/index.m3u8\n"
+	if string(master) != wantMaster {
+		t.Errorf("master =\n%s\nwant\n%s", master, wantMaster)
+	}
+
+	calls, _ := os.ReadFile(filepath.Join(bin, "calls.log"))
+	lines := strings.Split(strings.TrimSpace(string(calls)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "-c copy") || !strings.Contains(lines[1], "scale=-2:480") {
+		t.Errorf("ffmpeg calls = %q, want a stream copy then a 480p transcode", calls)
+	}
+}
+
+func TestPackageHLSFailures(t *testing.T) {
+	cfg := utils.HLSConfig{SegmentSeconds: 6, Renditions: []string{"source"}}
+	if _, err := PackageHLS(context.Background(), "in.mp4", t.TempDir(), VideoProbe{}, cfg, io.Discard); err == nil {
+		t.Error("an audio-only file was packaged")
+	}
+
+	testfixtures.InstallFakeFFmpegHLS(t, testfixtures.FFmpegHLSFake{FailSegment: true})
+	if _, err := PackageHLS(context.Background(), "in.mp4", t.TempDir(), hlsTestProbe(640, 360), cfg, io.Discard); err == nil || !strings.Contains(err.Error(), "codec not currently supported") {
+		t.Errorf("err = %v, want ffmpeg's own complaint", err)
+	}
+}
+
+func TestMeasureHLSRenditionRefusesForeignEntries(t *testing.T) {
+	dir := t.TempDir()
+	playlist := "#EXTM3U\n#EXTINF:6.0,\n../../etc/passwd\n#EXT-X-ENDLIST\n"
+	if err := os.WriteFile(filepath.Join(dir, "index.m3u8"), []byte(playlist), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := measureHLSRendition(dir, &HLSRendition{}); err == nil {
+		t.Error("a playlist naming a file outside its directory was accepted")
+	}
+}
@@ -0,0 +1,346 @@
+package archivers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"arker/internal/utils"
+)
+
+// Why a live recording stopped.
+const (
+	// LiveStopMaxDuration: the configured maximum window was reached while
+	// the stream was still live.
+	LiveStopMaxDuration = "max_duration"
+	// LiveStopStreamEnded: the broadcast ended and yt-dlp exited on its own.
+	LiveStopStreamEnded = "stream_ended"
+	// LiveStopInterrupted: yt-dlp failed mid-recording, or the worker was
+	// lost and a checkpoint was promoted in the recording's place.
+	LiveStopInterrupted = "interrupted"
+)
+
+// LiveCheckpointExtension is the extension of a recording stored as it was
+// captured, without the final remux: checkpoints, and a recording ffmpeg could
+// not remux. MPEG-TS is playable from any prefix, which is what makes it
+// safe to store while the stream is still being written.
+const LiveCheckpointExtension = ".ts"
+
+// mpegTSPacketSize is the fixed MPEG-TS packet length. Checkpoints are cut on
+// a packet boundary so the stored prefix never ends in a torn packet.
+const mpegTSPacketSize = 188
+
+// liveStopGrace is how long yt-dlp gets to finalize its output after SIGINT
+// before the process group is killed.
+const liveStopGrace = 30 * time.Second
+
+// LiveRecording is the window of a live stream that a capture holds. The
+// times are wall-clock times at which Arker was recording, not positions in
+// the broadcast: a stream joined at the live edge two hours in records from
+// its third hour.
+type LiveRecording struct {
+	StartedAt       string  `json:"started_at"`
+	EndedAt         string  `json:"ended_at"`
+	RecordedSeconds float64 `json:"recorded_seconds"`
+	// FromStart reports that yt-dlp was asked to record from the start of the
+	// broadcast. Extractors that cannot do so record from the live edge.
+	FromStart          bool    `json:"from_start"`
+	StopReason         string  `json:"stop_reason"`
+	MaxDurationSeconds float64 `json:"max_duration_seconds"`
+}
+
+// LiveCheckpoint is a snapshot of a recording still in progress: the prefix
+// of the MPEG-TS written so far, and metadata describing it as an interrupted
+// recording, which is what it becomes if nothing later replaces it.
+type LiveCheckpoint struct {
+	Data        io.Reader
+	Size        int64
+	Metadata    []byte
+	RawMetadata []byte
+}
+
+// LiveCheckpointFunc stores a checkpoint. An error is logged and the
+// recording continues; the next checkpoint tries again.
+type LiveCheckpointFunc func(ctx context.Context, checkpoint LiveCheckpoint) error
+
+type liveCheckpointKey struct{}
+
+// WithLiveCheckpoint returns a context carrying the function YtDlpArchiver
+// hands checkpoints of a live recording to. Without one, a live stream is
+// still recorded but nothing survives a crash.
+func WithLiveCheckpoint(ctx context.Context, fn LiveCheckpointFunc) context.Context {
+	return context.WithValue(ctx, liveCheckpointKey{}, fn)
+}
+
+func liveCheckpointFromContext(ctx context.Context) LiveCheckpointFunc {
+	fn, _ := ctx.Value(liveCheckpointKey{}).(LiveCheckpointFunc)
+	return fn
+}
+
+// liveOutput is what a finished live recording left behind.
+type liveOutput struct {
+	path      string
+	recording LiveRecording
+}
+
+// liveStatusFromProbe reads yt-dlp's live_status off the probe output, where
+// it is printed on the line before the language.
+func liveStatusFromProbe(output string) string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) < 2 {
+		return ""
+	}
+	return lines[len(lines)-2]
+}
+
+// liveDownloadArgs records a live stream into MPEG-TS rather than fragments
+// merged at the end, so the file on disk is playable at every moment, and
+// without a .part file, so the checkpoints can find it.
+func liveDownloadArgs(outputTemplate string, quality utils.VideoQuality, cfg utils.LiveConfig) []string {
+	args := quality.YtDlpFormatArgs()
+	args = append(args,
+		"--no-playlist",
+		"--write-thumbnail",
+		"--write-info-json",
+		"--no-clean-infojson",
+		"--hls-use-mpegts",
+		"--no-part",
+	)
+	if cfg.FromStart {
+		args = append(args, "--live-from-start")
+	}
+	return append(args, "--verbose", "-o", outputTemplate)
+}
+
+// recordLive starts cmd, a yt-dlp run against a live stream, and waits until
+// the stream ends or the configured window is reached, storing a checkpoint
+// of the growing file every interval. Reaching the window is not an error:
+// yt-dlp is asked to stop with SIGINT, as a person at a terminal would, which
+// lets it finalize the file, and is killed only if it does not.
+func (d *ytDlpDownload) recordLive(ctx context.Context, cmd *exec.Cmd, url string, cfg utils.LiveConfig, logWriter io.Writer) error {
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(logWriter, "Failed to start yt-dlp: %v\n", err)
+		return err
+	}
+	started := time.Now()
+	recording := LiveRecording{
+		StartedAt:          started.UTC().Format(time.RFC3339),
+		FromStart:          cfg.FromStart,
+		MaxDurationSeconds: cfg.MaxDuration.Seconds(),
+	}
+	fmt.Fprintf(logWriter, "Recording live stream for at most %s (checkpoint every %s)\n", cfg.MaxDuration, cfg.CheckpointInterval)
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	limit := time.NewTimer(cfg.MaxDuration)
+	defer limit.Stop()
+	checkpoints := time.NewTicker(cfg.CheckpointInterval)
+	defer checkpoints.Stop()
+	save := liveCheckpointFromContext(ctx)
+
+	var runErr error
+	var kill <-chan time.Time
+wait:
+	for {
+		select {
+		case runErr = <-exited:
+			break wait
+		case <-ctx.Done():
+			fmt.Fprintf(logWriter, "Context cancelled, killing yt-dlp process group\n")
+			_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			<-exited
+			return ctx.Err()
+		case <-limit.C:
+			fmt.Fprintf(logWriter, "Reached the maximum live recording duration %s; stopping yt-dlp\n", cfg.MaxDuration)
+			recording.StopReason = LiveStopMaxDuration
+			_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGINT)
+			kill = time.After(liveStopGrace)
+		case <-kill:
+			fmt.Fprintf(logWriter, "yt-dlp did not stop within %s; killing it\n", liveStopGrace)
+			_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-checkpoints.C:
+			if save != nil && recording.StopReason == "" {
+				d.checkpoint(ctx, url, recording, save, logWriter)
+			}
+		}
+	}
+
+	ended := time.Now()
+	if recording.StopReason == "" {
+		recording.StopReason = LiveStopStreamEnded
+		if runErr != nil {
+			recording.StopReason = LiveStopInterrupted
+		}
+	}
+	recording.EndedAt = ended.UTC().Format(time.RFC3339)
+	recording.RecordedSeconds = ended.Sub(started).Round(time.Second).Seconds()
+
+	path := findLiveMedia(d.tempBase)
+	if path == "" {
+		if runErr != nil {
+			fmt.Fprintf(logWriter, "yt-dlp live recording failed: %v\n", runErr)
+			return fmt.Errorf("yt-dlp live recording failed: %w", runErr)
+		}
+		return fmt.Errorf("yt-dlp live recording wrote no media")
+	}
+	if runErr != nil {
+		// yt-dlp commonly exits non-zero after SIGINT, and a failure an hour
+		// into a stream still leaves the hour: keep what was recorded.
+		fmt.Fprintf(logWriter, "yt-dlp exited with %v; keeping the recording made so far\n", runErr)
+	}
+	fmt.Fprintf(logWriter, "Live recording stopped (%s) after %s\n", recording.StopReason, ended.Sub(started).Round(time.Second))
+	d.live = &liveOutput{path: path, recording: recording}
+	return nil
+}
+
+// checkpoint hands the recording so far to save. Every failure is logged and
+// dropped: a checkpoint is insurance, and the recording it insures is still
+// running.
+func (d *ytDlpDownload) checkpoint(ctx context.Context, url string, recording LiveRecording, save LiveCheckpointFunc, logWriter io.Writer) {
+	path := findLiveMedia(d.tempBase)
+	if path == "" {
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(logWriter, "Live checkpoint skipped: %v\n", err)
+		return
+	}
+	defer file.Close()
+	if !isMPEGTS(file) {
+		fmt.Fprintf(logWriter, "Live checkpoint skipped: %s is not MPEG-TS and cannot be stored mid-recording\n", filepath.Base(path))
+		return
+	}
+	info, err := file.Stat()
+	if err != nil {
+		fmt.Fprintf(logWriter, "Live checkpoint skipped: %v\n", err)
+		return
+	}
+	size := info.Size() - info.Size()%mpegTSPacketSize
+	if size == 0 {
+		return
+	}
+
+	now := time.Now()
+	recording.StopReason = LiveStopInterrupted
+	recording.EndedAt = now.UTC().Format(time.RFC3339)
+	if started, err := time.Parse(time.RFC3339, recording.StartedAt); err == nil {
+		recording.RecordedSeconds = now.Sub(started).Round(time.Second).Seconds()
+	}
+	checkpoint := LiveCheckpoint{Data: io.NewSectionReader(file, 0, size), Size: size}
+	media := VideoMedia{Extension: LiveCheckpointExtension, ContentType: "video/mp2t", SizeBytes: size}
+	if metadata, sanitizedRaw, err := d.checkpointMetadata(url, media, now); err == nil {
+		metadata.Live = &recording
+		if metadataJSON, err := MarshalVideoMetadata(metadata); err == nil {
+			checkpoint.Metadata = metadataJSON
+			checkpoint.RawMetadata = sanitizedRaw
+		}
+	}
+	if err := save(ctx, checkpoint); err != nil {
+		fmt.Fprintf(logWriter, "Live checkpoint failed: %v\n", err)
+		return
+	}
+	fmt.Fprintf(logWriter, "Stored live checkpoint (%d bytes)\n", size)
+}
+
+// checkpointMetadata normalizes the info JSON yt-dlp wrote before it started
+// recording. A checkpoint without it is still stored; the metadata is
+// written again when the recording finishes.
+func (d *ytDlpDownload) checkpointMetadata(url string, media VideoMedia, archivedAt time.Time) (*VideoMetadata, []byte, error) {
+	infoPath, err := findYtDlpInfoJSON(d.tempBase)
+	if err != nil {
+		return nil, nil, err
+	}
+	rawInfo, err := os.ReadFile(infoPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return BuildYtDlpVideoArtifacts(rawInfo, url, d.version, media, archivedAt)
+}
+
+// isMPEGTS sniffs the sync byte that starts each of the first two packets.
+func isMPEGTS(file *os.File) bool {
+	header := make([]byte, mpegTSPacketSize+1)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return false
+	}
+	return header[0] == 0x47 && header[mpegTSPacketSize] == 0x47
+}
+
+// liveMediaSkipExtensions are the sidecars yt-dlp writes beside a recording.
+var liveMediaSkipExtensions = append([]string{".json", ".ytdl", ".part"}, append(thumbnailImageExtensions, subtitleFileExtensions...)...)
+
+// findLiveMedia returns the largest media file beside tempBase: the file the
+// stream is being written to. Returns "" before yt-dlp has written any.
+func findLiveMedia(tempBase string) string {
+	matches, err := filepath.Glob(tempBase + "*")
+	if err != nil {
+		return ""
+	}
+	best, bestSize := "", int64(0)
+	for _, match := range matches {
+		ext := strings.ToLower(filepath.Ext(match))
+		if slices.Contains(liveMediaSkipExtensions, ext) {
+			continue
+		}
+		info, err := os.Stat(match)
+		if err != nil || info.IsDir() || info.Size() <= bestSize {
+			continue
+		}
+		best, bestSize = match, info.Size()
+	}
+	return best
+}
+
+// liveMedia turns a finished recording into the file to store: remuxed to MP4
+// (M4A for an audio-only policy) with the index at the front so it seeks in a
+// browser, or the recording as captured when ffmpeg is missing or refuses it.
+func liveMedia(ctx context.Context, tempBase, recordedPath string, quality utils.VideoQuality, logWriter io.Writer) (string, VideoMedia, error) {
+	target := VideoMedia{Extension: ".mp4", ContentType: "video/mp4"}
+	if quality.AudioOnly {
+		target = VideoMedia{Extension: ".m4a", ContentType: "audio/mp4"}
+	}
+	remuxed := tempBase + ".live" + target.Extension
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-nostdin", "-y", "-i", recordedPath, "-c", "copy", "-movflags", "+faststart", remuxed)
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err == nil {
+		if info, statErr := os.Stat(remuxed); statErr == nil && info.Size() > 0 {
+			fmt.Fprintf(logWriter, "Remuxed live recording to %s\n", strings.TrimPrefix(target.Extension, "."))
+			return remuxed, target, nil
+		}
+		err = fmt.Errorf("ffmpeg wrote no output")
+	}
+	fmt.Fprintf(logWriter, "Could not remux live recording, storing it as recorded: %v %s\n", err, strings.TrimSpace(stderr.String()))
+
+	file, openErr := os.Open(recordedPath)
+	if openErr != nil {
+		return "", VideoMedia{}, openErr
+	}
+	defer file.Close()
+	if isMPEGTS(file) {
+		return recordedPath, VideoMedia{Extension: LiveCheckpointExtension, ContentType: "video/mp2t"}, nil
+	}
+	ext := strings.ToLower(filepath.Ext(recordedPath))
+	contentType := mime.TypeByExtension(ext)
+	if ext == "" || contentType == "" {
+		return "", VideoMedia{}, fmt.Errorf("live recording %s is in an unrecognized format", filepath.Base(recordedPath))
+	}
+	return recordedPath, VideoMedia{Extension: ext, ContentType: contentType}, nil
+}
@@ -0,0 +1,177 @@
+package archivers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"arker/internal/testfixtures"
+	"arker/internal/utils"
+)
+
+func useLiveSettings(t *testing.T, cfg utils.LiveConfig) {
+	t.Helper()
+	previous := utils.LiveSettings()
+	t.Cleanup(func() { utils.InitLive(previous) })
+	utils.InitLive(cfg)
+}
+
+type storedCheckpoint struct {
+	data     []byte
+	metadata VideoMetadata
+}
+
+// recordCheckpoints returns a context that collects every checkpoint the
+// archiver hands over.
+func recordCheckpoints(t *testing.T) (context.Context, func() []storedCheckpoint) {
+	var mu sync.Mutex
+	var stored []storedCheckpoint
+	ctx := WithLiveCheckpoint(context.Background(), func(ctx context.Context, checkpoint LiveCheckpoint) error {
+		data, err := io.ReadAll(checkpoint.Data)
+		if err != nil {
+			return err
+		}
+		var metadata VideoMetadata
+		if err := json.Unmarshal(checkpoint.Metadata, &metadata); err != nil {
+			t.Errorf("checkpoint metadata: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		stored = append(stored, storedCheckpoint{data: data, metadata: metadata})
+		return nil
+	})
+	return ctx, func() []storedCheckpoint {
+		mu.Lock()
+		defer mu.Unlock()
+		return stored
+	}
+}
+
+func readResult(t *testing.T, result Result) []byte {
+	t.Helper()
+	if closer, ok := result.Data.(io.Closer); ok {
+		defer closer.Close()
+	}
+	data, err := io.ReadAll(result.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestYtDlpArchiverRecordsALiveStreamUpToTheMaximum(t *testing.T) {
+	useLiveSettings(t, utils.LiveConfig{MaxDuration: time.Second, CheckpointInterval: 300 * time.Millisecond})
+	binDir := testfixtures.InstallFakeYtDlp(t, testfixtures.YtDlpFake{Fixture: "youtube_regular", Live: true})
+	ffmpegDir := testfixtures.InstallFakeFFmpegRemux(t, false)
+	url := testfixtures.Lookup(t, "youtube_regular").URL
+
+	ctx, checkpoints := recordCheckpoints(t)
+	var log strings.Builder
+	result, err := (&YtDlpArchiver{}).Archive(ctx, url, &log, nil, 1)
+	if err != nil {
+		t.Fatalf("archive: %v\n%s", err, log.String())
+	}
+	data := readResult(t, result)
+
+	if result.Extension != ".mp4" || !bytes.HasPrefix(data, []byte("REMUXED:")) {
+		t.Errorf("result = %s (%.8q); want the remuxed MP4", result.Extension, data)
+	}
+	if result.Completeness != CompletenessPartial {
+		t.Errorf("completeness = %q; a live window is never provably the whole stream", result.Completeness)
+	}
+	var metadata VideoMetadata
+	if err := json.Unmarshal(result.Metadata.Data, &metadata); err != nil {
+		t.Fatal(err)
+	}
+	live := metadata.Live
+	if live == nil || live.StopReason != LiveStopMaxDuration || live.MaxDurationSeconds != 1 || live.FromStart ||
+		live.StartedAt == "" || live.EndedAt == "" {
+		t.Fatalf("live = %+v", live)
+	}
+
+	args, _ := os.ReadFile(filepath.Join(binDir, "args.txt"))
+	if !strings.Contains(string(args), "--hls-use-mpegts") || strings.Contains(string(args), "--live-from-start") {
+		t.Errorf("yt-dlp args = %q; want an MPEG-TS recording from the live edge", args)
+	}
+	calls, _ := os.ReadFile(filepath.Join(ffmpegDir, "calls.log"))
+	if !strings.Contains(string(calls), "-c copy") || !strings.Contains(string(calls), "+faststart") {
+		t.Errorf("ffmpeg calls = %q; want a stream-copy remux", calls)
+	}
+
+	stored := checkpoints()
+	if len(stored) == 0 {
+		t.Fatalf("no checkpoints stored during a one-second recording\n%s", log.String())
+	}
+	for _, checkpoint := range stored {
+		if len(checkpoint.data) == 0 || len(checkpoint.data)%mpegTSPacketSize != 0 || checkpoint.data[0] != 0x47 {
+			t.Errorf("checkpoint of %d bytes is not whole MPEG-TS packets", len(checkpoint.data))
+		}
+		if checkpoint.metadata.Live == nil || checkpoint.metadata.Live.StopReason != LiveStopInterrupted ||
+			checkpoint.metadata.Media.Extension != LiveCheckpointExtension {
+			t.Errorf("checkpoint metadata = %+v; want an interrupted .ts recording", checkpoint.metadata)
+		}
+	}
+}
+
+func TestYtDlpArchiverKeepsAnEndedStreamAsRecordedWhenRemuxFails(t *testing.T) {
+	useLiveSettings(t, utils.LiveConfig{MaxDuration: time.Minute, FromStart: true})
+	binDir := testfixtures.InstallFakeYtDlp(t, testfixtures.YtDlpFake{Fixture: "youtube_regular", Live: true, LiveChunks: 3})
+	testfixtures.InstallFakeFFmpegRemux(t, true)
+	url := testfixtures.Lookup(t, "youtube_regular").URL
+
+	var log strings.Builder
+	result, err := (&YtDlpArchiver{}).Archive(context.Background(), url, &log, nil, 1)
+	if err != nil {
+		t.Fatalf("archive: %v\n%s", err, log.String())
+	}
+	data := readResult(t, result)
+
+	if result.Extension != LiveCheckpointExtension || result.ContentType != "video/mp2t" ||
+		!bytes.Equal(data, bytes.Repeat(testfixtures.LiveChunk, 3)) {
+		t.Errorf("result = %s %s, %d bytes; want the three recorded chunks as MPEG-TS", result.Extension, result.ContentType, len(data))
+	}
+	var metadata VideoMetadata
+	if err := json.Unmarshal(result.Metadata.Data, &metadata); err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Live == nil || metadata.Live.StopReason != LiveStopStreamEnded || !metadata.Live.FromStart {
+		t.Errorf("live = %+v; want a from-start recording of a stream that ended", metadata.Live)
+	}
+	if result.Completeness != CompletenessPartial {
+		t.Errorf("completeness = %q", result.Completeness)
+	}
+	args, _ := os.ReadFile(filepath.Join(binDir, "args.txt"))
+	if !strings.Contains(string(args), "--live-from-start") {
+		t.Errorf("yt-dlp args = %q; want --live-from-start", args)
+	}
+}
+
+func TestAudioArchiverRefusesLiveStreams(t *testing.T) {
+	testfixtures.InstallFakeYtDlp(t, testfixtures.YtDlpFake{Fixture: "youtube_regular", Live: true})
+	url := testfixtures.Lookup(t, "youtube_regular").URL
+
+	var log strings.Builder
+	if _, err := (&AudioArchiver{}).Archive(context.Background(), url, &log, nil, 1); err == nil || !strings.Contains(err.Error(), "live stream") {
+		t.Fatalf("audio archive of a live stream: %v", err)
+	}
+}
+
+func TestLiveStatusFromProbe(t *testing.T) {
+	for output, want := range map[string]string{
+		"A title\nNA\nsomeone\nis_live\nen\n":       "is_live",
+		"A title\n635\nsomeone\nnot_live\nNA\n":     "not_live",
+		"A multi\nline title\n635\nx\nwas_live\nNA": "was_live",
+		"NA": "",
+	} {
+		if got := liveStatusFromProbe(output); got != want {
+			t.Errorf("liveStatusFromProbe(%q) = %q, want %q", output, got, want)
+		}
+	}
+}
@@ -89,7 +89,13 @@ func (a *MHTMLArchiver) ArchiveWithPageContext(ctx context.Context, page playwri
 		return Result{Bundle: bundle}, err
 	}
 	fmt.Fprintf(logWriter, "MHTML archive completed successfully, size: %d bytes\n", len(dataStr))
-	return Result{Data: strings.NewReader(dataStr), Extension: ".mhtml", ContentType: "application/x-mhtml", Bundle: bundle}, nil
+	return Result{
+		Data:        strings.NewReader(dataStr),
+		Extension:   ".mhtml",
+		ContentType: "application/x-mhtml",
+		Bundle:      bundle,
+		Metadata:    readerSidecar(page, logWriter),
+	}, nil
 }
 
 // parseMHTMLSnapshot extracts the MHTML payload from a Page.captureSnapshot CDP
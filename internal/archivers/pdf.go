@@ -0,0 +1,117 @@
+package archivers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"io"
+
+	"github.com/mxschmitt/playwright-go"
+	"gorm.io/gorm"
+
+	"arker/internal/utils"
+)
+
+// pdfMargin is applied on every edge. Playwright's default of no margin
+// crowds text against the paper edge in a way no print stylesheet expects.
+const pdfMargin = "12mm"
+
+// PDFArchiver prints the loaded page to PDF the way a reader's browser would:
+// print stylesheet applied, backgrounds kept, and the text tagged so the
+// result is searchable and readable by assistive tools.
+type PDFArchiver struct {
+}
+
+func (a *PDFArchiver) Archive(ctx context.Context, url string, logWriter io.Writer, db *gorm.DB, itemID uint) (Result, error) {
+	fmt.Fprintf(logWriter, "Starting PDF archive for: %s\n", url)
+
+	// One sheet of paper per viewport, so the first screenful is the first
+	// printed page (see firstPageThumbnail).
+	width, height := utils.PDFPaperPixels(utils.PDFSettings().PaperSize)
+	contextOpts := playwright.BrowserNewContextOptions{
+		Viewport:          &playwright.Size{Width: width, Height: height},
+		DeviceScaleFactor: playwright.Float(2.0),
+	}
+
+	bundle, page, err := setupBrowserForArchiving(logWriter, contextOpts)
+	if err != nil {
+		return Result{Bundle: bundle}, err
+	}
+	// Note: PWBundle cleanup is deferred in the main worker loop.
+
+	if err = PerformCompletePageLoadWithContext(ctx, page, url, logWriter, true); err != nil {
+		return Result{Bundle: bundle}, err
+	}
+
+	return a.ArchiveWithPageContext(ctx, page, url, logWriter, bundle)
+}
+
+func (a *PDFArchiver) ArchiveWithPageContext(ctx context.Context, page playwright.Page, url string, logWriter io.Writer, bundle *PWBundle) (Result, error) {
+	select {
+	case <-ctx.Done():
+		return Result{Bundle: bundle}, ctx.Err()
+	default:
+	}
+
+	// Switch to print media before anything is captured, so the thumbnail
+	// shows the same layout the PDF does rather than the screen one.
+	fmt.Fprintf(logWriter, "Applying print stylesheet...\n")
+	if err := page.EmulateMedia(playwright.PageEmulateMediaOptions{Media: playwright.MediaPrint}); err != nil {
+		fmt.Fprintf(logWriter, "Warning: Could not emulate print media: %v\n", err)
+	}
+	if _, err := page.Evaluate(`() => window.scrollTo(0, 0)`); err != nil {
+		fmt.Fprintf(logWriter, "Warning: Could not scroll to top before printing: %v\n", err)
+	}
+
+	paper := utils.PDFSettings().PaperSize
+	fmt.Fprintf(logWriter, "Printing page to PDF (%s)...\n", paper)
+	data, err := page.PDF(playwright.PagePdfOptions{
+		Format:          playwright.String(paper),
+		PrintBackground: playwright.Bool(true),
+		Tagged:          playwright.Bool(true),
+		Outline:         playwright.Bool(true),
+		// An @page size in the stylesheet is the author's intent for print
+		// and wins over the configured default.
+		PreferCSSPageSize: playwright.Bool(true),
+		Margin: &playwright.Margin{
+			Top:    playwright.String(pdfMargin),
+			Right:  playwright.String(pdfMargin),
+			Bottom: playwright.String(pdfMargin),
+			Left:   playwright.String(pdfMargin),
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(logWriter, "Failed to print PDF: %v\n", err)
+		return Result{Bundle: bundle}, err
+	}
+	fmt.Fprintf(logWriter, "PDF printed, size: %d bytes\n", len(data))
+
+	return Result{
+		Data:        bytes.NewReader(data),
+		Extension:   ".pdf",
+		ContentType: "application/pdf",
+		Bundle:      bundle,
+		Thumbnail:   firstPageThumbnail(page, logWriter),
+	}, nil
+}
+
+// firstPageThumbnail previews the PDF's first page. The browser cannot
+// rasterize the PDF it just produced, but the viewport is one sheet of paper
+// wide and tall and the print stylesheet is active, so a viewport screenshot
+// is the first page's content as laid out for print.
+func firstPageThumbnail(page playwright.Page, logWriter io.Writer) *Thumbnail {
+	data, err := page.Screenshot(playwright.PageScreenshotOptions{
+		Type: (*playwright.ScreenshotType)(playwright.String("png")),
+	})
+	if err != nil {
+		fmt.Fprintf(logWriter, "Thumbnail generation skipped: %v\n", err)
+		return nil
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		fmt.Fprintf(logWriter, "Thumbnail generation skipped: %v\n", err)
+		return nil
+	}
+	return deriveThumbnail(img, logWriter)
+}
@@ -0,0 +1,211 @@
+package archivers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"arker/internal/utils"
+)
+
+// PlaylistListingSchemaVersion versions the stored playlist listing.
+const PlaylistListingSchemaVersion = "1"
+
+// DefaultPlaylistMaxEntries bounds how many videos one playlist capture
+// queues when PlaylistArchiver.MaxEntries is unset. A channel can hold
+// thousands of uploads; each is a full video download.
+const DefaultPlaylistMaxEntries = 200
+
+// PlaylistListing is what a playlist capture stores: the list as yt-dlp
+// enumerated it, before any video was archived. Per-video status lives on the
+// child captures and is served by the playlist manifest, not stored here.
+type PlaylistListing struct {
+	SchemaVersion string `json:"schema_version"`
+	URL           string `json:"url"`
+	ID            string `json:"id,omitempty"`
+	Title         string `json:"title,omitempty"`
+	Uploader      string `json:"uploader,omitempty"`
+	// Truncated is true when the playlist has more videos than were queued.
+	Truncated bool                   `json:"truncated"`
+	Entries   []PlaylistListingEntry `json:"entries"`
+	// Skipped counts listed entries that were not videos (nested playlists,
+	// entries without a URL) or repeated a video already listed.
+	Skipped int `json:"skipped,omitempty"`
+}
+
+// PlaylistListingEntry is one video of a listing.
+type PlaylistListingEntry struct {
+	Position        int     `json:"position"`
+	URL             string  `json:"url"`
+	ID              string  `json:"id,omitempty"`
+	Title           string  `json:"title,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+}
+
+// PlaylistArchiver lists a playlist or channel with yt-dlp's flat extraction,
+// which reads the list pages without resolving each video. It downloads no
+// media: the worker turns the listing it returns into one child capture per
+// video.
+type PlaylistArchiver struct {
+	// MaxEntries caps the videos taken from one playlist, first listed
+	// first. Zero means DefaultPlaylistMaxEntries.
+	MaxEntries int
+}
+
+func (a *PlaylistArchiver) Archive(ctx context.Context, url string, logWriter io.Writer, db *gorm.DB, itemID uint) (Result, error) {
+	fmt.Fprintf(logWriter, "Listing playlist: %s\n", url)
+
+	maxEntries := a.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultPlaylistMaxEntries
+	}
+
+	cookieArgs, cleanupCookies, err := utils.MediaCookieArgsForRun(url, logWriter)
+	if err != nil {
+		fmt.Fprintf(logWriter, "Failed to prepare yt-dlp cookies: %v\n", err)
+		return Result{}, err
+	}
+	defer cleanupCookies()
+
+	fetchURL := utils.PlaylistFetchURL(url)
+	if fetchURL != url {
+		fmt.Fprintf(logWriter, "Listing the channel's videos tab: %s\n", fetchURL)
+	}
+
+	// One entry past the cap tells a playlist of exactly maxEntries videos
+	// apart from a longer one without asking yt-dlp for the full count.
+	args := []string{"--flat-playlist", "--dump-single-json", "--playlist-end", strconv.Itoa(maxEntries + 1)}
+	args = append(args, utils.YtDlpImpersonateArgsForURL(url)...)
+	args = append(args, cookieArgs...)
+	args = append(args, utils.YtDlpProxyArgs()...)
+	args = append(args, fetchURL)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "yt-dlp", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	redactedLog := utils.NewRedactingWriter(logWriter, utils.YtDlpProxyRedactionSecrets())
+	if stderr.Len() > 0 {
+		fmt.Fprintf(redactedLog, "yt-dlp output:\n%s\n", stderr.String())
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return Result{}, ctx.Err()
+		}
+		return Result{}, fmt.Errorf("yt-dlp could not list the playlist: %v", err)
+	}
+
+	listing, err := parseFlatPlaylist(stdout.Bytes(), url, maxEntries)
+	if err != nil {
+		return Result{}, err
+	}
+	if len(listing.Entries) == 0 {
+		return Result{}, fmt.Errorf("playlist lists no videos")
+	}
+	fmt.Fprintf(logWriter, "Listed %d videos", len(listing.Entries))
+	if listing.Truncated {
+		fmt.Fprintf(logWriter, " (playlist is longer; capped at %d)", maxEntries)
+	}
+	if listing.Skipped > 0 {
+		fmt.Fprintf(logWriter, ", skipped %d non-video or repeated entries", listing.Skipped)
+	}
+	fmt.Fprintln(logWriter)
+
+	data, err := json.MarshalIndent(listing, "", "  ")
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Data:        bytes.NewReader(data),
+		Extension:   ".json",
+		ContentType: "application/json",
+		Playlist:    listing,
+	}, nil
+}
+
+// flatPlaylist is the part of yt-dlp's --flat-playlist JSON Arker reads.
+type flatPlaylist struct {
+	ID       string              `json:"id"`
+	Title    string              `json:"title"`
+	Uploader string              `json:"uploader"`
+	Channel  string              `json:"channel"`
+	Entries  []flatPlaylistEntry `json:"entries"`
+}
+
+type flatPlaylistEntry struct {
+	Type       string  `json:"_type"`
+	IEKey      string  `json:"ie_key"`
+	ID         string  `json:"id"`
+	URL        string  `json:"url"`
+	WebpageURL string  `json:"webpage_url"`
+	Title      string  `json:"title"`
+	Duration   float64 `json:"duration"`
+}
+
+// parseFlatPlaylist turns yt-dlp's flat listing into a PlaylistListing of at
+// most maxEntries videos.
+func parseFlatPlaylist(raw []byte, sourceURL string, maxEntries int) (*PlaylistListing, error) {
+	var flat flatPlaylist
+	if err := json.Unmarshal(raw, &flat); err != nil {
+		return nil, fmt.Errorf("yt-dlp returned an unreadable playlist listing: %w", err)
+	}
+	listing := &PlaylistListing{
+		SchemaVersion: PlaylistListingSchemaVersion,
+		URL:           sourceURL,
+		ID:            flat.ID,
+		Title:         flat.Title,
+		Uploader:      flat.Uploader,
+		Entries:       []PlaylistListingEntry{},
+	}
+	if listing.Uploader == "" {
+		listing.Uploader = flat.Channel
+	}
+
+	seen := make(map[string]bool, len(flat.Entries))
+	for i, entry := range flat.Entries {
+		entryURL := flatEntryURL(entry)
+		if entryURL == "" || seen[entryURL] {
+			listing.Skipped++
+			continue
+		}
+		if len(listing.Entries) == maxEntries {
+			listing.Truncated = true
+			break
+		}
+		seen[entryURL] = true
+		listing.Entries = append(listing.Entries, PlaylistListingEntry{
+			Position:        i + 1,
+			URL:             entryURL,
+			ID:              entry.ID,
+			Title:           entry.Title,
+			DurationSeconds: entry.Duration,
+		})
+	}
+	return listing, nil
+}
+
+// flatEntryURL returns the page URL of a listed video, or "" for an entry that
+// is not a video. YouTube flat entries sometimes carry only the video ID.
+func flatEntryURL(entry flatPlaylistEntry) string {
+	if entry.Type == "playlist" || strings.HasSuffix(entry.IEKey, "Tab") || strings.HasSuffix(entry.IEKey, "Playlist") {
+		return ""
+	}
+	for _, candidate := range []string{entry.URL, entry.WebpageURL} {
+		if parsed, err := url.Parse(candidate); err == nil && (parsed.Scheme == "https" || parsed.Scheme == "http") && parsed.Host != "" {
+			return candidate
+		}
+	}
+	if entry.IEKey == "Youtube" && entry.ID != "" {
+		return "https://www.youtube.com/watch?v=" + url.QueryEscape(entry.ID)
+	}
+	return ""
+}
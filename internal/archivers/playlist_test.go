@@ -0,0 +1,105 @@
+package archivers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"arker/internal/testfixtures"
+)
+
+// flatChannelListing is the shape yt-dlp --flat-playlist prints for a
+// YouTube channel's videos tab: url-type entries, some carrying only an ID.
+const flatChannelListing = `{
+  "_type": "playlist",
+  "id": "UCabc",
+  "title": "Someone - Videos",
+  "channel": "Someone",
+  "entries": [
+    {"_type": "url", "ie_key": "Youtube", "id": "aaa", "url": "https://www.youtube.com/watch?v=aaa", "title": "First", "duration": 61},
+    {"_type": "url", "ie_key": "Youtube", "id": "bbb", "title": "Second"},
+    {"_type": "url", "ie_key": "YoutubeTab", "url": "https://www.youtube.com/@someone/shorts", "title": "Shorts"},
+    {"_type": "url", "ie_key": "Youtube", "id": "aaa", "url": "https://www.youtube.com/watch?v=aaa", "title": "First again"},
+    {"_type": "url", "ie_key": "Youtube", "id": "ccc", "url": "https://www.youtube.com/watch?v=ccc", "title": "Third"}
+  ]
+}`
+
+func TestParseFlatPlaylist(t *testing.T) {
+	listing, err := parseFlatPlaylist([]byte(flatChannelListing), "https://www.youtube.com/@someone", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listing.Title != "Someone - Videos" || listing.Uploader != "Someone" || listing.Truncated {
+		t.Errorf("listing = %+v", listing)
+	}
+	want := []PlaylistListingEntry{
+		{Position: 1, URL: "https://www.youtube.com/watch?v=aaa", ID: "aaa", Title: "First", DurationSeconds: 61},
+		{Position: 2, URL: "https://www.youtube.com/watch?v=bbb", ID: "bbb", Title: "Second"},
+		{Position: 5, URL: "https://www.youtube.com/watch?v=ccc", ID: "ccc", Title: "Third"},
+	}
+	if len(listing.Entries) != len(want) {
+		t.Fatalf("entries = %+v", listing.Entries)
+	}
+	for i := range want {
+		if listing.Entries[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, listing.Entries[i], want[i])
+		}
+	}
+	if listing.Skipped != 2 {
+		t.Errorf("skipped = %d, want the tab and the repeat", listing.Skipped)
+	}
+
+	capped, _ := parseFlatPlaylist([]byte(flatChannelListing), "https://www.youtube.com/@someone", 2)
+	if len(capped.Entries) != 2 || !capped.Truncated {
+		t.Errorf("capped listing = %d entries, truncated %v; want 2, true", len(capped.Entries), capped.Truncated)
+	}
+	exact, _ := parseFlatPlaylist([]byte(flatChannelListing), "https://www.youtube.com/@someone", 3)
+	if exact.Truncated {
+		t.Error("a playlist exactly at the cap was reported truncated")
+	}
+
+	if _, err := parseFlatPlaylist([]byte("WARNING: not json"), "https://www.youtube.com/@someone", 2); err == nil {
+		t.Error("unreadable output was accepted")
+	}
+}
+
+func TestPlaylistArchiverListsTheVideosTab(t *testing.T) {
+	binDir := testfixtures.InstallFakeYtDlp(t, testfixtures.YtDlpFake{PlaylistJSON: []byte(flatChannelListing)})
+	var log strings.Builder
+	result, err := (&PlaylistArchiver{MaxEntries: 2}).Archive(context.Background(), "https://www.youtube.com/@someone", &log, nil, 0)
+	if err != nil {
+		t.Fatalf("Archive: %v\n%s", err, log.String())
+	}
+	if result.Playlist == nil || len(result.Playlist.Entries) != 2 || !result.Playlist.Truncated {
+		t.Fatalf("listing = %+v", result.Playlist)
+	}
+
+	stored, _ := io.ReadAll(result.Data)
+	var listing PlaylistListing
+	if err := json.Unmarshal(stored, &listing); err != nil || listing.SchemaVersion != PlaylistListingSchemaVersion || listing.URL != "https://www.youtube.com/@someone" {
+		t.Errorf("stored listing = %s (%v)", stored, err)
+	}
+
+	args, err := os.ReadFile(filepath.Join(binDir, "args.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	argv := strings.Split(strings.TrimSpace(string(args)), "\n")
+	if !hasArgPair(argv, "--playlist-end", "3") {
+		t.Errorf("args = %v, want --playlist-end one past the cap", argv)
+	}
+	if argv[len(argv)-1] != "https://www.youtube.com/@someone/videos" {
+		t.Errorf("fetched %s, want the channel's videos tab", argv[len(argv)-1])
+	}
+}
+
+func TestPlaylistArchiverFailsOnAnEmptyListing(t *testing.T) {
+	testfixtures.InstallFakeYtDlp(t, testfixtures.YtDlpFake{PlaylistJSON: []byte(`{"id": "PL1", "entries": []}`)})
+	if _, err := (&PlaylistArchiver{}).Archive(context.Background(), "https://www.youtube.com/playlist?list=PL1", io.Discard, nil, 0); err == nil {
+		t.Error("an empty playlist archived successfully")
+	}
+}
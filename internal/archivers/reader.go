@@ -0,0 +1,48 @@
+package archivers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mxschmitt/playwright-go"
+
+	"arker/internal/reader"
+)
+
+// EncodeReaderArticle is the reader-mode sidecar of an mhtml item, shared by
+// the inline extraction below and the backfill worker.
+func EncodeReaderArticle(article *reader.Article) ([]byte, error) {
+	return json.MarshalIndent(article, "", "  ")
+}
+
+// readerSidecar extracts the article from the loaded page. The live DOM is
+// the best source there is: lazy images have their real sources and
+// client-rendered text exists, neither of which is true of the raw HTML.
+//
+// Extraction is a bonus on top of the snapshot, so every failure is logged
+// and returns nil rather than failing the capture.
+func readerSidecar(page playwright.Page, logWriter io.Writer) *Sidecar {
+	content, err := page.Content()
+	if err != nil {
+		fmt.Fprintf(logWriter, "Reader extraction skipped: %v\n", err)
+		return nil
+	}
+	article, err := reader.Extract(strings.NewReader(content), page.URL(), reader.SourcePage)
+	if err != nil {
+		fmt.Fprintf(logWriter, "Reader extraction skipped: %v\n", err)
+		return nil
+	}
+	data, err := EncodeReaderArticle(article)
+	if err != nil {
+		fmt.Fprintf(logWriter, "Reader extraction skipped: %v\n", err)
+		return nil
+	}
+	if article.Readable {
+		fmt.Fprintf(logWriter, "Reader extraction: %q, %d words\n", article.Title, article.WordCount)
+	} else {
+		fmt.Fprintf(logWriter, "Reader extraction: no article found on this page\n")
+	}
+	return &Sidecar{Data: data}
+}
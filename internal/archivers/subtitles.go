@@ -4,15 +4,20 @@ import (
 	"html"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 )
 
 // Subtitle kinds. A manual track was written or reviewed by a person; an
-// automatic one is the platform's speech recognition. The difference matters to
-// anyone quoting an archive, so it is recorded rather than flattened.
+// automatic one is the platform's speech recognition; a machine one is Arker's
+// own local transcription, made because the platform offered nothing. The
+// difference matters to anyone quoting an archive, so it is recorded rather
+// than flattened.
 const (
-	SubtitleKindManual = "manual"
-	SubtitleKindAuto   = "auto"
+	SubtitleKindManual  = "manual"
+	SubtitleKindAuto    = "auto"
+	SubtitleKindMachine = "machine"
 )
 
 // MaxTranscriptBytes caps the derived plain-text transcript. A multi-hour
@@ -214,3 +219,107 @@ func SubtitleArtifactSuffix(lang, format string) string {
 	}
 	return ".sub." + lang + "." + format
 }
+
+// Cue is one timed caption line, in seconds from the start of the media.
+type Cue struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// vttTimestampPattern matches a cue timestamp: hours are optional in WebVTT,
+// and SRT separates milliseconds with a comma, so one pattern reads both.
+var vttTimestampPattern = regexp.MustCompile(`^(?:(\d+):)?(\d{1,2}):(\d{2})[.,](\d{1,3})$`)
+
+// CuesFromVTT parses a WebVTT (or SRT) track into timed cues.
+//
+// It undoes the same rolling window TranscriptFromVTT does, but keeps timings:
+// a line already shown by the previous cue is dropped, and a cue left with
+// nothing new only extends the previous cue's end. Each spoken line therefore
+// appears once, at the moment it first appeared on screen, which is what a
+// search result should seek to.
+func CuesFromVTT(vtt string) []Cue {
+	var cues []Cue
+	var previous []string
+	blocks := strings.Split(strings.ReplaceAll(vtt, "\r\n", "\n"), "\n\n")
+	for _, block := range blocks {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+		timing := -1
+		for i, line := range lines {
+			if cueTimingPattern.MatchString(line) {
+				timing = i
+				break
+			}
+		}
+		if timing < 0 {
+			continue
+		}
+		start, end, ok := parseCueTiming(lines[timing])
+		if !ok {
+			continue
+		}
+
+		var text []string
+		for _, line := range lines[timing+1:] {
+			line = subtitleTagPattern.ReplaceAllString(line, "")
+			line = html.UnescapeString(line)
+			line = strings.TrimSpace(strings.Join(strings.Fields(line), " "))
+			if line != "" {
+				text = append(text, line)
+			}
+		}
+		if len(text) == 0 {
+			continue
+		}
+
+		var fresh []string
+		for _, line := range text {
+			if !slices.Contains(previous, line) {
+				fresh = append(fresh, line)
+			}
+		}
+		previous = text
+		if len(fresh) == 0 {
+			if len(cues) > 0 && end > cues[len(cues)-1].End {
+				cues[len(cues)-1].End = end
+			}
+			continue
+		}
+		cues = append(cues, Cue{Start: start, End: end, Text: strings.Join(fresh, " ")})
+	}
+	return cues
+}
+
+// parseCueTiming reads "start --> end [settings]".
+func parseCueTiming(line string) (float64, float64, bool) {
+	left, right, found := strings.Cut(line, "-->")
+	if !found {
+		return 0, 0, false
+	}
+	fields := strings.Fields(right)
+	if len(fields) == 0 {
+		return 0, 0, false
+	}
+	start, ok := parseCueTimestamp(strings.TrimSpace(left))
+	if !ok {
+		return 0, 0, false
+	}
+	end, ok := parseCueTimestamp(fields[0])
+	if !ok || end < start {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+func parseCueTimestamp(value string) (float64, bool) {
+	m := vttTimestampPattern.FindStringSubmatch(value)
+	if m == nil {
+		return 0, false
+	}
+	hours, _ := strconv.Atoi(m[1])
+	minutes, _ := strconv.Atoi(m[2])
+	seconds, _ := strconv.Atoi(m[3])
+	fraction := m[4] + strings.Repeat("0", 3-len(m[4]))
+	millis, _ := strconv.Atoi(fraction)
+	return float64((hours*3600+minutes*60+seconds)*1000+millis) / 1000, true
+}
@@ -290,3 +290,55 @@ func TestSubtitleKindsPreferManualDeterministically(t *testing.T) {
 		t.Fatalf("kinds = %v, want none", kinds)
 	}
 }
+
+func TestCuesFromVTTKeepsTimingsAndCollapsesRollingCaptions(t *testing.T) {
+	cues := CuesFromVTT(youtubeAutoVTT)
+	want := []Cue{
+		{Start: 0.03, End: 2.679, Text: "all right so here we are in front of the"},
+		{Start: 2.679, End: 4.87, Text: "elephants the cool thing"},
+		{Start: 4.87, End: 8, Text: "about these guys is that they have really"},
+	}
+	if len(cues) != len(want) {
+		t.Fatalf("cues = %#v", cues)
+	}
+	for i := range want {
+		if cues[i] != want[i] {
+			t.Errorf("cue %d = %#v, want %#v", i, cues[i], want[i])
+		}
+	}
+}
+
+func TestCuesFromVTTReadsShortTimestampsAndSRT(t *testing.T) {
+	vtt := "WEBVTT\n\n01:02.5 --> 01:04.250\nHello &amp; <b>welcome</b>\n\nnot a cue\n"
+	cues := CuesFromVTT(vtt)
+	if len(cues) != 1 || cues[0].Start != 62.5 || cues[0].End != 64.25 || cues[0].Text != "Hello & welcome" {
+		t.Fatalf("vtt cues = %#v", cues)
+	}
+
+	srt := "1\r\n00:00:01,000 --> 00:00:02,500\r\nfirst line\r\nsecond line\r\n\r\n2\r\n00:00:03,000 --> 00:00:01,000\r\nbackwards\r\n"
+	cues = CuesFromVTT(srt)
+	if len(cues) != 1 || cues[0].Start != 1 || cues[0].End != 2.5 || cues[0].Text != "first line second line" {
+		t.Fatalf("srt cues = %#v; a cue ending before it starts must be dropped", cues)
+	}
+}
+
+func TestCuesFromRealYouTubeCaptions(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join("testdata", "youtube_captions.en.vtt"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	cues := CuesFromVTT(string(raw))
+	if len(cues) == 0 {
+		t.Fatal("no cues parsed from the real track")
+	}
+	var texts []string
+	for i, cue := range cues {
+		if cue.End < cue.Start || (i > 0 && cue.Start < cues[i-1].Start) {
+			t.Errorf("cue %d out of order: %#v", i, cue)
+		}
+		texts = append(texts, cue.Text)
+	}
+	if joined := strings.Join(texts, " "); strings.Count(joined, "elephants") != 1 {
+		t.Errorf("rolling window repeated itself: %q", joined)
+	}
+}
@@ -0,0 +1,161 @@
+package archivers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"arker/internal/utils"
+)
+
+// transcriptionUploadMargin is left on the job clock after transcribing. The
+// video still has to be stored when this returns, and a transcript is never
+// worth losing the video over.
+const transcriptionUploadMargin = 2 * time.Minute
+
+// whisperLanguagePattern reads the language whisper.cpp reports when asked to
+// detect it: "auto-detected language: en (p = 0.97)".
+var whisperLanguagePattern = regexp.MustCompile(`auto-detected language:\s*([A-Za-z-]+)`)
+
+// transcribeWithoutCaptions runs local speech-to-text over a downloaded video
+// and returns the VTT it produced as a "machine" subtitle track.
+//
+// Every failure is logged and reported as ok=false: the platform offered no
+// captions, so the worst case is the same archive Arker would have stored
+// without this step.
+func transcribeWithoutCaptions(ctx context.Context, videoPath, tempBase, lang string, duration *float64, logWriter io.Writer) (ExtraArtifact, SubtitleTrack, string, bool) {
+	cfg := utils.TranscriptionSettings()
+	if !cfg.Enabled() {
+		return ExtraArtifact{}, SubtitleTrack{}, "", false
+	}
+	if duration != nil && time.Duration(*duration*float64(time.Second)) > cfg.MaxDuration {
+		fmt.Fprintf(logWriter, "Skipping local transcription: video is %s, longer than the %s limit\n",
+			time.Duration(*duration*float64(time.Second)).Round(time.Second), cfg.MaxDuration)
+		return ExtraArtifact{}, SubtitleTrack{}, "", false
+	}
+
+	budget := cfg.Timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline) - transcriptionUploadMargin; remaining < budget {
+			budget = remaining
+		}
+	}
+	if budget <= 0 {
+		fmt.Fprintf(logWriter, "Skipping local transcription: not enough time left in this job\n")
+		return ExtraArtifact{}, SubtitleTrack{}, "", false
+	}
+	runCtx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+
+	fmt.Fprintf(logWriter, "No captions available; transcribing locally with %s\n", cfg.Binary)
+	started := time.Now()
+	vtt, detected, err := runWhisper(runCtx, cfg, videoPath, tempBase, lang)
+	if err != nil {
+		fmt.Fprintf(logWriter, "Local transcription failed: %v\n", err)
+		return ExtraArtifact{}, SubtitleTrack{}, "", false
+	}
+	if len(vtt) > maxSubtitleArtifactBytes {
+		fmt.Fprintf(logWriter, "Local transcription produced %d bytes, over the %d byte limit; discarding\n", len(vtt), maxSubtitleArtifactBytes)
+		return ExtraArtifact{}, SubtitleTrack{}, "", false
+	}
+	if text, _ := TranscriptFromVTT(string(vtt)); strings.TrimSpace(text) == "" {
+		// Music, silence, or a model that heard nothing: an empty track would
+		// only claim a transcript that does not exist.
+		fmt.Fprintf(logWriter, "Local transcription found no speech\n")
+		return ExtraArtifact{}, SubtitleTrack{}, "", false
+	}
+
+	trackLang := detected
+	if trackLang == "" {
+		trackLang = lang
+	}
+	if trackLang == "" {
+		trackLang = "und"
+	}
+	suffix := SubtitleArtifactSuffix(trackLang, "vtt")
+	fmt.Fprintf(logWriter, "Local transcription finished in %s (%s)\n", time.Since(started).Round(time.Second), trackLang)
+	return ExtraArtifact{NameSuffix: suffix, ContentType: subtitleContentType("vtt"), Data: vtt},
+		SubtitleTrack{Lang: trackLang, Kind: SubtitleKindMachine, Format: "vtt", ArtifactSuffix: suffix, SizeBytes: int64(len(vtt))},
+		string(vtt), true
+}
+
+// runWhisper decodes the audio with ffmpeg to the 16 kHz mono WAV whisper.cpp
+// requires, then transcribes it to VTT. Both files live beside the video under
+// tempBase, so the archiver's own cleanup sweeps them.
+func runWhisper(ctx context.Context, cfg utils.TranscriptionConfig, videoPath, tempBase, lang string) ([]byte, string, error) {
+	wavPath := tempBase + ".whisper.wav"
+	outBase := tempBase + ".whisper"
+	defer os.Remove(wavPath)
+
+	ffmpeg := exec.CommandContext(ctx, "ffmpeg", "-nostdin", "-hide_banner", "-loglevel", "error", "-y",
+		"-i", videoPath, "-vn", "-ar", "16000", "-ac", "1", "-c:a", "pcm_s16le", wavPath)
+	if out, err := runProcessGroup(ctx, ffmpeg); err != nil {
+		return nil, "", fmt.Errorf("extract audio: %w: %s", err, utils.TruncateForLog(strings.TrimSpace(out), 300))
+	}
+
+	whisperLang := "auto"
+	if lang != "" {
+		whisperLang, _, _ = strings.Cut(lang, "-")
+	}
+	args := []string{"-m", cfg.Model, "-f", wavPath, "-l", whisperLang, "-ovtt", "-of", outBase, "-np"}
+	if cfg.Threads > 0 {
+		args = append(args, "-t", strconv.Itoa(cfg.Threads))
+	}
+	whisper := exec.CommandContext(ctx, cfg.Binary, args...)
+	out, err := runProcessGroup(ctx, whisper)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w: %s", cfg.Binary, err, utils.TruncateForLog(strings.TrimSpace(out), 300))
+	}
+	vtt, err := os.ReadFile(outBase + ".vtt")
+	if err != nil {
+		return nil, "", fmt.Errorf("read transcription output: %w", err)
+	}
+	_ = os.Remove(outBase + ".vtt")
+
+	detected := ""
+	if m := whisperLanguagePattern.FindStringSubmatch(out); m != nil {
+		detected = utils.NormalizeSubtitleLang(m[1])
+	}
+	if detected == "" && whisperLang != "auto" {
+		detected = lang
+	}
+	return vtt, detected, nil
+}
+
+// runProcessGroup runs cmd in its own process group and kills the whole group
+// when ctx ends, the same treatment yt-dlp gets. Deployments commonly wrap
+// whisper.cpp in a shell script, and killing only the wrapper would leave the
+// transcriber running after the job gave up on it.
+func runProcessGroup(ctx context.Context, cmd *exec.Cmd) (string, error) {
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			if cmd.Process != nil {
+				_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			}
+		case <-done:
+		}
+	}()
+	err := cmd.Wait()
+	if ctx.Err() != nil {
+		return output.String(), ctx.Err()
+	}
+	return output.String(), err
+}
@@ -0,0 +1,148 @@
+package archivers
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"arker/internal/testfixtures"
+	"arker/internal/utils"
+)
+
+// enableTranscription configures local speech-to-text for one test.
+func enableTranscription(t *testing.T, cfg utils.TranscriptionConfig) {
+	t.Helper()
+	if cfg.Binary == "" {
+		cfg.Binary = "whisper-cli"
+	}
+	if cfg.Model == "" {
+		cfg.Model = "/models/ggml-base.bin"
+	}
+	utils.InitTranscription(cfg)
+	t.Cleanup(func() { utils.InitTranscription(utils.TranscriptionConfig{}) })
+}
+
+// archiveWithoutCaptions runs the real yt-dlp archiver against a fixture whose
+// captions were withheld and returns the result's extras and metadata.
+func archiveWithoutCaptions(t *testing.T, fake testfixtures.YtDlpFake) ([]ExtraArtifact, VideoMetadata, string) {
+	t.Helper()
+	c := testfixtures.Lookup(t, fake.Fixture)
+	testfixtures.InstallFakeYtDlp(t, fake)
+	var log strings.Builder
+	result, err := (&YtDlpArchiver{}).Archive(t.Context(), c.URL, &log, nil, 1)
+	if err != nil {
+		t.Fatalf("yt-dlp archive failed: %v\nlog:\n%s", err, log.String())
+	}
+	_, _ = io.Copy(io.Discard, result.Data)
+	if closer, ok := result.Data.(io.Closer); ok {
+		_ = closer.Close()
+	}
+	var meta VideoMetadata
+	if err := json.Unmarshal(result.Metadata.Data, &meta); err != nil {
+		t.Fatalf("decode metadata: %v", err)
+	}
+	return result.Extras, meta, log.String()
+}
+
+func fakeWhisperCalls(t *testing.T, binDir string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(binDir, "calls.log"))
+	if os.IsNotExist(err) {
+		return ""
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestVideoWithoutCaptionsIsTranscribedLocally(t *testing.T) {
+	enableTranscription(t, utils.TranscriptionConfig{Threads: 2})
+	bin := testfixtures.InstallFakeWhisper(t, testfixtures.WhisperFake{DetectedLanguage: "en"})
+
+	extras, meta, log := archiveWithoutCaptions(t, testfixtures.YtDlpFake{Fixture: "youtube_regular", NoSubtitles: true})
+
+	if len(meta.Subtitles) != 1 {
+		t.Fatalf("subtitles = %#v\nlog:\n%s", meta.Subtitles, log)
+	}
+	track := meta.Subtitles[0]
+	if track.Kind != SubtitleKindMachine || track.Lang != "en" || track.Format != "vtt" || track.ArtifactSuffix != ".sub.en.vtt" {
+		t.Errorf("track = %#v, want a machine en vtt track", track)
+	}
+	if meta.Transcript == nil || meta.Transcript.Source != SubtitleKindMachine ||
+		meta.Transcript.Text != "hello from the machine\nnobody captioned this video" {
+		t.Errorf("transcript = %#v", meta.Transcript)
+	}
+	if len(extras) != 1 || extras[0].NameSuffix != ".sub.en.vtt" || !strings.HasPrefix(string(extras[0].Data), "WEBVTT") {
+		t.Fatalf("extras = %#v", extras)
+	}
+
+	calls := fakeWhisperCalls(t, bin)
+	for _, want := range []string{"-ar 16000 -ac 1", "-m /models/ggml-base.bin", "-l auto", "-ovtt", "-t 2"} {
+		if !strings.Contains(calls, want) {
+			t.Errorf("invocations missing %q:\n%s", want, calls)
+		}
+	}
+}
+
+// The platform's own captions are the better record; local transcription
+// exists only for videos that have none.
+func TestCaptionedVideoIsNotTranscribed(t *testing.T) {
+	enableTranscription(t, utils.TranscriptionConfig{})
+	bin := testfixtures.InstallFakeWhisper(t, testfixtures.WhisperFake{})
+
+	_, meta, _ := archiveWithoutCaptions(t, testfixtures.YtDlpFake{Fixture: "youtube_regular"})
+	for _, track := range meta.Subtitles {
+		if track.Kind == SubtitleKindMachine {
+			t.Fatalf("a captioned video got a machine track: %#v", meta.Subtitles)
+		}
+	}
+	if calls := fakeWhisperCalls(t, bin); calls != "" {
+		t.Errorf("transcriber ran on a captioned video:\n%s", calls)
+	}
+}
+
+func TestTranscriptionFailureKeepsTheVideo(t *testing.T) {
+	for name, fake := range map[string]testfixtures.WhisperFake{
+		"transcriber fails": {Fail: true},
+		"no audio stream":   {FailAudio: true},
+		"no speech":         {VTT: "WEBVTT\n\n"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			enableTranscription(t, utils.TranscriptionConfig{})
+			testfixtures.InstallFakeWhisper(t, fake)
+
+			extras, meta, log := archiveWithoutCaptions(t, testfixtures.YtDlpFake{Fixture: "youtube_regular", NoSubtitles: true})
+			if len(meta.Subtitles) != 0 || meta.Transcript != nil || len(extras) != 0 {
+				t.Errorf("a failed transcription left a track: %#v", meta.Subtitles)
+			}
+			if !strings.Contains(log, "transcription") {
+				t.Errorf("log does not explain the missing transcript:\n%s", log)
+			}
+		})
+	}
+}
+
+func TestTranscriptionIsSkippedWhenDisabledOrTooLong(t *testing.T) {
+	bin := testfixtures.InstallFakeWhisper(t, testfixtures.WhisperFake{})
+
+	utils.InitTranscription(utils.TranscriptionConfig{Binary: "whisper-cli"})
+	t.Cleanup(func() { utils.InitTranscription(utils.TranscriptionConfig{}) })
+	if _, meta, _ := archiveWithoutCaptions(t, testfixtures.YtDlpFake{Fixture: "youtube_regular", NoSubtitles: true}); len(meta.Subtitles) != 0 {
+		t.Errorf("transcribed without a model configured: %#v", meta.Subtitles)
+	}
+
+	// youtube_regular runs 635 seconds.
+	enableTranscription(t, utils.TranscriptionConfig{MaxDuration: 5 * time.Minute})
+	_, meta, log := archiveWithoutCaptions(t, testfixtures.YtDlpFake{Fixture: "youtube_regular", NoSubtitles: true})
+	if len(meta.Subtitles) != 0 || !strings.Contains(log, "longer than the 5m0s limit") {
+		t.Errorf("a long video was transcribed: %#v\n%s", meta.Subtitles, log)
+	}
+	if calls := fakeWhisperCalls(t, bin); calls != "" {
+		t.Errorf("transcriber ran:\n%s", calls)
+	}
+}
@@ -56,12 +56,25 @@ type VideoMetadata struct {
 	// absent for most posts: a platform that exposes no captions is a fact
 	// about the post, not a failure of the capture, and must never affect
 	// whether the archive reads fulfilled.
-	Subtitles    []SubtitleTrack `json:"subtitles,omitempty"`
-	Transcript   *Transcript     `json:"transcript,omitempty"`
-	YtDlpVersion string          `json:"yt_dlp_version,omitempty"`
-	ArchivedAt   string          `json:"archived_at"`
-	Provenance   string          `json:"provenance"`
-	Provider     string          `json:"provider,omitempty"`
+	Subtitles  []SubtitleTrack `json:"subtitles,omitempty"`
+	Transcript *Transcript     `json:"transcript,omitempty"`
+	// Chapters are the provider's chapter markers, in playback order. Absent
+	// when the media has none.
+	Chapters []Chapter `json:"chapters,omitempty"`
+	// Audio holds the show and episode fields of an audio capture. Absent on
+	// videos, and on audio whose provider names neither.
+	Audio        *AudioDetails `json:"audio,omitempty"`
+	YtDlpVersion string        `json:"yt_dlp_version,omitempty"`
+	// QualityPolicy is the policy the capture was requested and downloaded
+	// under. Absent means the best available, which is also every capture
+	// made before policies existed.
+	QualityPolicy *utils.VideoQuality `json:"quality_policy,omitempty"`
+	// Live describes the recorded window of a stream that was live when it
+	// was captured. Absent on everything else.
+	Live       *LiveRecording `json:"live,omitempty"`
+	ArchivedAt string         `json:"archived_at"`
+	Provenance string         `json:"provenance"`
+	Provider   string         `json:"provider,omitempty"`
 }
 
 // VideoEngagement holds counts without treating a missing value as zero.
@@ -72,6 +85,24 @@ type VideoEngagement struct {
 	Reposts  *int64 `json:"reposts,omitempty"`
 }
 
+// Chapter is one chapter marker. EndSeconds is absent when the provider gives
+// only start times.
+type Chapter struct {
+	Title        string   `json:"title,omitempty"`
+	StartSeconds float64  `json:"start_seconds"`
+	EndSeconds   *float64 `json:"end_seconds,omitempty"`
+}
+
+// AudioDetails describes what an audio capture is an episode or track of.
+type AudioDetails struct {
+	Show          string `json:"show,omitempty"`
+	Episode       string `json:"episode,omitempty"`
+	EpisodeNumber *int64 `json:"episode_number,omitempty"`
+	SeasonNumber  *int64 `json:"season_number,omitempty"`
+	Artist        string `json:"artist,omitempty"`
+	Album         string `json:"album,omitempty"`
+}
+
 // VideoMedia describes the stored media file, plus provider format details
 // when they are available.
 type VideoMedia struct {
@@ -151,6 +182,7 @@ func BuildYtDlpVideoArtifacts(rawJSON []byte, sourceURL, toolVersion string, med
 			Reposts:  videoInt(raw, "repost_count"),
 		},
 		Tags:         videoStrings(raw, "tags", "categories"),
+		Chapters:     videoChapters(raw),
 		Media:        media,
 		YtDlpVersion: toolVersion,
 		ArchivedAt:   archivedAt.UTC().Format(time.RFC3339),
@@ -171,6 +203,32 @@ func BuildYtDlpVideoArtifacts(rawJSON []byte, sourceURL, toolVersion string, med
 	return metadata, sanitized, nil
 }
 
+// videoChapters reads yt-dlp's "chapters" list, skipping entries without a
+// start time.
+func videoChapters(raw map[string]interface{}) []Chapter {
+	entries, ok := raw["chapters"].([]interface{})
+	if !ok {
+		return nil
+	}
+	var chapters []Chapter
+	for _, entry := range entries {
+		fields, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		start := videoFloat(fields, "start_time")
+		if start == nil {
+			continue
+		}
+		chapters = append(chapters, Chapter{
+			Title:        videoString(fields, "title"),
+			StartSeconds: *start,
+			EndSeconds:   videoFloat(fields, "end_time"),
+		})
+	}
+	return chapters
+}
+
 // SanitizeURL strips embedded credentials and redacts sensitive query
 // parameters before a URL is stored in normalized metadata.
 func SanitizeURL(rawURL string, secrets []string) string {
@@ -35,6 +35,20 @@ func (r *tempVideoReader) Close() error {
 	return err2
 }
 
+type videoQualityKey struct{}
+
+// WithVideoQuality returns a context carrying the quality policy YtDlpArchiver
+// downloads under. It rides on the context rather than through Archive because
+// it is a per-job option that only this archiver reads.
+func WithVideoQuality(ctx context.Context, quality utils.VideoQuality) context.Context {
+	return context.WithValue(ctx, videoQualityKey{}, quality)
+}
+
+func videoQualityFromContext(ctx context.Context) utils.VideoQuality {
+	quality, _ := ctx.Value(videoQualityKey{}).(utils.VideoQuality)
+	return quality.Normalize()
+}
+
 // YtDlpArchiver downloads videos from YouTube, Vimeo, Instagram reels, TikTok
 // and other platforms via yt-dlp. It handles video only; a URL whose media is
 // photos (or a mixed photo/video carousel) belongs to GalleryDLArchiver, which
@@ -43,21 +57,119 @@ type YtDlpArchiver struct{}
 
 func (a *YtDlpArchiver) Archive(ctx context.Context, url string, logWriter io.Writer, db *gorm.DB, itemID uint) (Result, error) {
 	fmt.Fprintf(logWriter, "Starting video archive for: %s\n", url)
+	quality := videoQualityFromContext(ctx)
+
+	download, err := runYtDlpDownload(ctx, url, "video", logWriter, func(outputTemplate string) []string {
+		return ytDlpDownloadArgs(outputTemplate, quality)
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	defer download.cleanup()
+
+	media := VideoMedia{Extension: ".mp4", ContentType: "video/mp4"}
+	if quality.AudioOnly {
+		media = VideoMedia{Extension: ".m4a", ContentType: "audio/mp4"}
+	}
+	var outputPath string
+	if download.live != nil {
+		outputPath, media, err = liveMedia(ctx, download.tempBase, download.live.path, quality, logWriter)
+	} else {
+		outputPath, err = findDownloadedMedia(download.tempBase, media.Extension)
+	}
+	if err != nil {
+		fmt.Fprintf(logWriter, "Failed to find downloaded media: %v\n", err)
+		return Result{}, err
+	}
+
+	metadata, sanitizedRaw, rawInfo, err := download.metadata(url, outputPath, &media, logWriter)
+	if err != nil {
+		return Result{}, err
+	}
+	if !quality.IsZero() {
+		metadata.QualityPolicy = &quality
+	}
+	// A single video is structurally one asset: --no-playlist caps the run
+	// at one, and reaching here means the muxed file and both sidecars
+	// exist. There is nothing else to have missed, so this is the one place
+	// completeness needs no count from the extractor. A live recording is
+	// the exception: it holds a window of the stream, never provably all of
+	// it.
+	completeness := CompletenessComplete
+	if download.live != nil {
+		metadata.Live = &download.live.recording
+		completeness = CompletenessPartial
+	}
+	extras := download.captions(ctx, outputPath, rawInfo, metadata, logWriter)
 
+	metadataJSON, err := MarshalVideoMetadata(metadata)
+	if err != nil {
+		fmt.Fprintf(logWriter, "Failed to encode normalized video metadata: %v\n", err)
+		return Result{}, err
+	}
+
+	data, err := download.open(outputPath)
+	if err != nil {
+		fmt.Fprintf(logWriter, "Failed to open downloaded MP4: %v\n", err)
+		return Result{}, err
+	}
+
+	// Read the poster image before returning: the deferred cleanup sweeps every
+	// sibling temp file except the video, so it is gone the moment we return.
+	thumb := videoThumbnail(download.tempBase, outputPath, logWriter)
+
+	fmt.Fprintf(logWriter, "Video download completed successfully\n")
+
+	return Result{
+		Data:         data,
+		Extension:    media.Extension,
+		ContentType:  media.ContentType,
+		Thumbnail:    thumb,
+		Source:       "native",
+		Metadata:     &Sidecar{Data: metadataJSON},
+		RawMetadata:  &Sidecar{Data: sanitizedRaw},
+		Extras:       extras,
+		Completeness: completeness,
+	}, nil
+}
+
+// ytDlpDownload is one finished yt-dlp run. Everything it wrote sits beside
+// tempBase in a private temp directory that cleanup removes, apart from the
+// media file handed to the worker, which tempVideoReader removes on Close.
+type ytDlpDownload struct {
+	tempBase     string
+	version      string
+	detectedLang string
+	keep         string
+	// live is set when the URL was a live stream and a window of it was
+	// recorded instead of a finished file downloaded.
+	live *liveOutput
+}
+
+func (d *ytDlpDownload) cleanup() {
+	cleanupTempVideoFilesExcept(d.tempBase, d.keep)
+}
+
+// runYtDlpDownload checks that yt-dlp can reach url, then downloads it into a
+// fresh temp directory. downloadArgs supplies the format selection and
+// post-processing for an output template; the subtitle, impersonation,
+// referer, cookie and proxy arguments every run needs are added here. kind
+// ("video", "audio") names the media in the log and in errors.
+func runYtDlpDownload(ctx context.Context, url, kind string, logWriter io.Writer, downloadArgs func(outputTemplate string) []string) (*ytDlpDownload, error) {
 	// Check context before starting
 	select {
 	case <-ctx.Done():
-		return Result{}, ctx.Err()
+		return nil, ctx.Err()
 	default:
 	}
 
 	// One private cookies copy for both yt-dlp runs in this job; yt-dlp
 	// writes the jar back on exit, so it must not share a file with
 	// concurrent jobs.
-	cookieArgs, cleanupCookies, err := utils.YtDlpCookieArgsForRun()
+	cookieArgs, cleanupCookies, err := utils.MediaCookieArgsForRun(url, logWriter)
 	if err != nil {
 		fmt.Fprintf(logWriter, "Failed to prepare yt-dlp cookies: %v\n", err)
-		return Result{}, err
+		return nil, err
 	}
 	defer cleanupCookies()
 
@@ -82,12 +194,14 @@ func (a *YtDlpArchiver) Archive(ctx context.Context, url string, logWriter io.Wr
 	refererArgs = append(refererArgs, utils.YtDlpFormatFallbackArgsForURL(fetchURL)...)
 
 	// Prepare command arguments. The language is printed last and on its own so
-	// the subtitle filter can be built from the video's actual language rather
-	// than guessed; yt-dlp prints "NA" when it does not know.
-	testArgs := []string{"--print", "title,duration,uploader", "--print", "%(language)s"}
-
-	// First, test if yt-dlp can access the video
-	fmt.Fprintf(logWriter, "Testing video accessibility with yt-dlp...\n")
+	// the subtitle filter can be built from the media's actual language rather
+	// than guessed; yt-dlp prints "NA" when it does not know. The live status
+	// comes just before it, so a stream that is live right now is recorded
+	// rather than downloaded.
+	testArgs := []string{"--print", "title,duration,uploader", "--print", "%(live_status)s", "--print", "%(language)s"}
+
+	// First, test if yt-dlp can access the media
+	fmt.Fprintf(logWriter, "Testing %s accessibility with yt-dlp...\n", kind)
 	testCmd := exec.CommandContext(ctx, "yt-dlp")
 	testCmd.Args = append(testCmd.Args, testArgs...)
 	testCmd.Args = append(testCmd.Args, utils.YtDlpImpersonateArgsForURL(url)...)
@@ -98,35 +212,47 @@ func (a *YtDlpArchiver) Archive(ctx context.Context, url string, logWriter io.Wr
 	testOutput, err := testCmd.CombinedOutput()
 	if err != nil {
 		fmt.Fprintf(redactedLog, "yt-dlp test failed: %v\nOutput: %s\n", err, string(testOutput))
-		return Result{}, fmt.Errorf("yt-dlp cannot access video: %v", err)
+		return nil, fmt.Errorf("yt-dlp cannot access %s: %v", kind, err)
 	}
-	fmt.Fprintf(redactedLog, "Video info:\n%s\n", string(testOutput))
+	fmt.Fprintf(redactedLog, "%s info:\n%s\n", strings.ToUpper(kind[:1])+kind[1:], string(testOutput))
 	detectedLang := detectedLanguageFromProbe(string(testOutput))
 	if detectedLang != "" {
-		fmt.Fprintf(logWriter, "Detected video language: %s\n", detectedLang)
+		fmt.Fprintf(logWriter, "Detected %s language: %s\n", kind, detectedLang)
+	}
+	live := liveStatusFromProbe(string(testOutput)) == "is_live"
+	if live {
+		if kind != "video" {
+			fmt.Fprintf(logWriter, "%s is a live stream; only video captures can record one\n", url)
+			return nil, fmt.Errorf("%s is a live stream; capture it as a video to record it", url)
+		}
+		fmt.Fprintf(logWriter, "Detected a live stream\n")
 	}
 
 	// Check context before main download
 	select {
 	case <-ctx.Done():
-		return Result{}, ctx.Err()
+		return nil, ctx.Err()
 	default:
 	}
 
 	tempBase, err := createTempVideoBase()
 	if err != nil {
-		fmt.Fprintf(logWriter, "Failed to create temp video path: %v\n", err)
-		return Result{}, err
+		fmt.Fprintf(logWriter, "Failed to create temp %s path: %v\n", kind, err)
+		return nil, err
 	}
-	keepTempFile := ""
-	defer func() {
-		cleanupTempVideoFilesExcept(tempBase, keepTempFile)
-	}()
+	download := &ytDlpDownload{tempBase: tempBase, version: version, detectedLang: detectedLang}
 
 	outputTemplate := tempBase + ".%(ext)s"
+	liveCfg := utils.LiveSettings()
 	cmd := exec.CommandContext(ctx, "yt-dlp")
-	cmd.Args = append(cmd.Args, ytDlpDownloadArgs(outputTemplate)...)
-	cmd.Args = append(cmd.Args, utils.YtDlpSubtitleArgs(detectedLang)...)
+	if live {
+		// No subtitle arguments: a stream still in progress has no caption
+		// tracks to fetch yet.
+		cmd.Args = append(cmd.Args, liveDownloadArgs(outputTemplate, videoQualityFromContext(ctx), liveCfg)...)
+	} else {
+		cmd.Args = append(cmd.Args, downloadArgs(outputTemplate)...)
+		cmd.Args = append(cmd.Args, utils.YtDlpSubtitleArgs(detectedLang)...)
+	}
 	cmd.Args = append(cmd.Args, utils.YtDlpImpersonateArgsForURL(url)...)
 	cmd.Args = append(cmd.Args, refererArgs...)
 	cmd.Args = append(cmd.Args, cookieArgs...)
@@ -138,15 +264,23 @@ func (a *YtDlpArchiver) Archive(ctx context.Context, url string, logWriter io.Wr
 	// Set process group so we can kill the entire process tree on timeout
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
+	if live {
+		if err := download.recordLive(ctx, cmd, url, liveCfg, logWriter); err != nil {
+			download.cleanup()
+			return nil, err
+		}
+		return download, nil
+	}
+
 	fmt.Fprintf(logWriter, "Starting yt-dlp download process...\n")
 	if err = cmd.Start(); err != nil {
 		fmt.Fprintf(logWriter, "Failed to start yt-dlp: %v\n", err)
-		return Result{}, err
+		download.cleanup()
+		return nil, err
 	}
 
 	// Kill the whole process group when the context times out
 	done := make(chan struct{})
-	defer close(done)
 	go func() {
 		select {
 		case <-ctx.Done():
@@ -157,84 +291,78 @@ func (a *YtDlpArchiver) Archive(ctx context.Context, url string, logWriter io.Wr
 		case <-done:
 		}
 	}()
-
-	if err = cmd.Wait(); err != nil {
-		fmt.Fprintf(logWriter, "yt-dlp download failed: %v\n", err)
-		return Result{}, fmt.Errorf("yt-dlp download failed: %w", err)
-	}
-
-	outputPath, err := findDownloadedMP4(tempBase)
+	err = cmd.Wait()
+	close(done)
 	if err != nil {
-		fmt.Fprintf(logWriter, "Failed to find downloaded MP4: %v\n", err)
-		return Result{}, err
+		fmt.Fprintf(logWriter, "yt-dlp download failed: %v\n", err)
+		download.cleanup()
+		return nil, fmt.Errorf("yt-dlp download failed: %w", err)
 	}
+	return download, nil
+}
 
-	infoPath, err := findYtDlpInfoJSON(tempBase)
+// metadata reads the info JSON yt-dlp wrote and normalizes it against the
+// media file at outputPath, whose size it records in media. It returns the
+// normalized record, the sanitized raw record and the unsanitized info for
+// callers that read further fields from it.
+func (d *ytDlpDownload) metadata(url, outputPath string, media *VideoMedia, logWriter io.Writer) (*VideoMetadata, []byte, []byte, error) {
+	infoPath, err := findYtDlpInfoJSON(d.tempBase)
 	if err != nil {
 		fmt.Fprintf(logWriter, "Failed to find yt-dlp info JSON: %v\n", err)
-		return Result{}, err
+		return nil, nil, nil, err
 	}
 	rawInfo, err := os.ReadFile(infoPath)
 	if err != nil {
 		fmt.Fprintf(logWriter, "Failed to read yt-dlp info JSON: %v\n", err)
-		return Result{}, err
+		return nil, nil, nil, err
 	}
-	videoStat, err := os.Stat(outputPath)
+	mediaStat, err := os.Stat(outputPath)
 	if err != nil {
-		fmt.Fprintf(logWriter, "Failed to inspect downloaded MP4: %v\n", err)
-		return Result{}, err
+		fmt.Fprintf(logWriter, "Failed to inspect downloaded media: %v\n", err)
+		return nil, nil, nil, err
 	}
-	metadata, sanitizedRaw, err := BuildYtDlpVideoArtifacts(rawInfo, url, version, VideoMedia{
-		Extension:   ".mp4",
-		ContentType: "video/mp4",
-		SizeBytes:   videoStat.Size(),
-	}, time.Now())
+	media.SizeBytes = mediaStat.Size()
+	metadata, sanitizedRaw, err := BuildYtDlpVideoArtifacts(rawInfo, url, d.version, *media, time.Now())
 	if err != nil {
 		fmt.Fprintf(logWriter, "Failed to normalize yt-dlp info JSON: %v\n", err)
-		return Result{}, err
+		return nil, nil, nil, err
 	}
-	// Captions are read here, before the deferred cleanup sweeps the temp
-	// directory. A platform that exposes none is the normal case and must not
-	// disturb the capture, so every failure below is logged and dropped.
-	extras, tracks, contents := collectSubtitleArtifacts(tempBase, rawInfo, logWriter)
-	metadata.Subtitles = tracks
-	metadata.Transcript = BuildTranscript(tracks, contents, detectedLang)
-	logSubtitleOutcome(logWriter, metadata)
+	return metadata, sanitizedRaw, rawInfo, nil
+}
 
-	metadataJSON, err := MarshalVideoMetadata(metadata)
-	if err != nil {
-		fmt.Fprintf(logWriter, "Failed to encode normalized video metadata: %v\n", err)
-		return Result{}, err
+// captions collects the caption tracks yt-dlp wrote, or transcribes the media
+// locally when the platform published none, and records both on metadata.
+//
+// Captions are read here, before the deferred cleanup sweeps the temp
+// directory. A platform that exposes none is the normal case and must not
+// disturb the capture, so every failure is logged and dropped.
+func (d *ytDlpDownload) captions(ctx context.Context, outputPath string, rawInfo []byte, metadata *VideoMetadata, logWriter io.Writer) []ExtraArtifact {
+	extras, tracks, contents := collectSubtitleArtifacts(d.tempBase, rawInfo, logWriter)
+	if len(tracks) == 0 {
+		// Nothing from the platform: fall back to local speech-to-text when it
+		// is configured. The track is labelled "machine" so it is never
+		// mistaken for captions the platform itself published.
+		if extra, track, vtt, ok := transcribeWithoutCaptions(ctx, outputPath, d.tempBase, d.detectedLang, metadata.DurationSeconds, logWriter); ok {
+			extras = append(extras, extra)
+			tracks = append(tracks, track)
+			contents = map[string]string{track.ArtifactSuffix: vtt}
+		}
 	}
+	metadata.Subtitles = tracks
+	metadata.Transcript = BuildTranscript(tracks, contents, d.detectedLang)
+	logSubtitleOutcome(logWriter, metadata)
+	return extras
+}
 
+// open hands the media file at outputPath to the worker and exempts it from
+// cleanup; the returned reader deletes it, and the temp directory, on Close.
+func (d *ytDlpDownload) open(outputPath string) (io.ReadCloser, error) {
 	file, err := os.Open(outputPath)
 	if err != nil {
-		fmt.Fprintf(logWriter, "Failed to open downloaded MP4: %v\n", err)
-		return Result{}, err
+		return nil, err
 	}
-	keepTempFile = outputPath
-
-	// Read the poster image before returning: the deferred cleanup sweeps every
-	// sibling temp file except the video, so it is gone the moment we return.
-	thumb := videoThumbnail(tempBase, outputPath, logWriter)
-
-	fmt.Fprintf(logWriter, "Video download completed successfully\n")
-
-	return Result{
-		Data:        &tempVideoReader{File: file, path: outputPath, dir: filepath.Dir(tempBase)},
-		Extension:   ".mp4",
-		ContentType: "video/mp4",
-		Thumbnail:   thumb,
-		Source:      "native",
-		Metadata:    &Sidecar{Data: metadataJSON},
-		RawMetadata: &Sidecar{Data: sanitizedRaw},
-		Extras:      extras,
-		// A single video is structurally one asset: --no-playlist caps the run
-		// at one, and reaching here means the muxed file and both sidecars
-		// exist. There is nothing else to have missed, so this is the one place
-		// completeness needs no count from the extractor.
-		Completeness: CompletenessComplete,
-	}, nil
+	d.keep = outputPath
+	return &tempVideoReader{File: file, path: outputPath, dir: filepath.Dir(d.tempBase)}, nil
 }
 
 // detectedLanguageFromProbe reads the video's language off the probe output.
@@ -393,9 +521,9 @@ func logSubtitleOutcome(logWriter io.Writer, metadata *VideoMetadata) {
 	}
 }
 
-func ytDlpDownloadArgs(outputTemplate string) []string {
-	return []string{
-		"-f", "bestvideo+bestaudio/best",
+func ytDlpDownloadArgs(outputTemplate string, quality utils.VideoQuality) []string {
+	args := quality.YtDlpFormatArgs()
+	args = append(args,
 		"--no-playlist",
 		// Write the platform's own poster image next to the video. This is a
 		// far better preview than a frame grab: it is the image the uploader or
@@ -407,11 +535,13 @@ func ytDlpDownloadArgs(outputTemplate string) []string {
 		// sanitizes it before it ever reaches durable storage or an API response.
 		"--write-info-json",
 		"--no-clean-infojson",
-		"--merge-output-format", "mp4",
-		"--remux-video", "mp4",
-		"--verbose",
-		"-o", outputTemplate,
+	)
+	if quality.AudioOnly {
+		args = append(args, "--extract-audio", "--audio-format", "m4a")
+	} else {
+		args = append(args, "--merge-output-format", "mp4", "--remux-video", "mp4")
 	}
+	return append(args, "--verbose", "-o", outputTemplate)
 }
 
 func findYtDlpInfoJSON(tempBase string) (string, error) {
@@ -496,17 +626,23 @@ func createTempVideoBase() (string, error) {
 }
 
 func findDownloadedMP4(tempBase string) (string, error) {
-	path := tempBase + ".mp4"
+	return findDownloadedMedia(tempBase, ".mp4")
+}
+
+// findDownloadedMedia finds yt-dlp's final output with extension ext: ".mp4"
+// for a video, ".m4a" for an audio-only download.
+func findDownloadedMedia(tempBase, ext string) (string, error) {
+	path := tempBase + ext
 	if _, err := os.Stat(path); err == nil {
 		return path, nil
 	}
 
-	matches, err := filepath.Glob(tempBase + "*.mp4")
+	matches, err := filepath.Glob(tempBase + "*" + ext)
 	if err != nil {
 		return "", err
 	}
 	if len(matches) == 0 {
-		return "", fmt.Errorf("no MP4 output found for %s", tempBase)
+		return "", fmt.Errorf("no %s output found for %s", strings.ToUpper(strings.TrimPrefix(ext, ".")), tempBase)
 	}
 	return matches[0], nil
 }
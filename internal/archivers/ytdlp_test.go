@@ -2,6 +2,7 @@ package archivers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"image"
 	"image/color"
@@ -13,12 +14,14 @@ import (
 	"testing"
 	"time"
 
+	"arker/internal/testfixtures"
 	"arker/internal/thumbnail"
+	"arker/internal/utils"
 )
 
 func TestYtDlpDownloadArgsWriteRemuxedMP4File(t *testing.T) {
 	outputTemplate := "/tmp/arker-video.%(ext)s"
-	args := ytDlpDownloadArgs(outputTemplate)
+	args := ytDlpDownloadArgs(outputTemplate, utils.VideoQuality{})
 
 	if hasArgPair(args, "-o", "-") {
 		t.Fatal("yt-dlp download args write to stdout")
@@ -35,7 +38,7 @@ func TestYtDlpDownloadArgsWriteRemuxedMP4File(t *testing.T) {
 }
 
 func TestYtDlpDownloadArgsCaptureFullInfoJSON(t *testing.T) {
-	args := ytDlpDownloadArgs("/tmp/arker-video.%(ext)s")
+	args := ytDlpDownloadArgs("/tmp/arker-video.%(ext)s", utils.VideoQuality{})
 	for _, required := range []string{"--write-info-json", "--no-clean-infojson"} {
 		found := false
 		for _, arg := range args {
@@ -225,7 +228,7 @@ func hasArgPair(args []string, key, value string) bool {
 // and it is free -- it used to be explicitly discarded via --no-write-thumbnail.
 // This guards against that flag coming back.
 func TestYtDlpDownloadArgsRequestThumbnail(t *testing.T) {
-	args := ytDlpDownloadArgs("/tmp/arker-video-123.%(ext)s")
+	args := ytDlpDownloadArgs("/tmp/arker-video-123.%(ext)s", utils.VideoQuality{})
 
 	var hasWrite bool
 	for _, a := range args {
@@ -362,3 +365,68 @@ func TestVideoThumbnailFromRealImage(t *testing.T) {
 		t.Errorf("avg rgb(%d,%d,%d): want green-dominant (center band of a portrait poster)", sr/n, sg/n, sb/n)
 	}
 }
+
+func TestYtDlpDownloadArgsAudioOnlyExtractsM4A(t *testing.T) {
+	args := ytDlpDownloadArgs("/tmp/arker-video.%(ext)s", utils.VideoQuality{AudioOnly: true})
+	if !hasArgPair(args, "--audio-format", "m4a") {
+		t.Fatalf("audio-only args do not extract M4A: %v", args)
+	}
+	for _, arg := range args {
+		if arg == "--remux-video" || arg == "--merge-output-format" {
+			t.Fatalf("audio-only args still force an MP4 video: %v", args)
+		}
+	}
+	if !hasArgPair(args, "-f", "bestaudio[ext=m4a]/bestaudio/best") {
+		t.Fatalf("audio-only args do not select audio: %v", args)
+	}
+}
+
+func TestYtDlpArchiverDownloadsUnderTheContextQualityPolicy(t *testing.T) {
+	binDir := testfixtures.InstallFakeYtDlp(t, testfixtures.YtDlpFake{Fixture: "youtube_regular", NoSubtitles: true})
+	url := testfixtures.Lookup(t, "youtube_regular").URL
+
+	for _, tc := range []struct {
+		name        string
+		quality     utils.VideoQuality
+		format      string
+		extension   string
+		contentType string
+	}{
+		{"capped video", utils.VideoQuality{MaxHeight: 720}, "bestvideo[height<=720]+bestaudio/best[height<=720]", ".mp4", "video/mp4"},
+		{"audio only", utils.VideoQuality{AudioOnly: true}, "bestaudio[ext=m4a]/bestaudio/best", ".m4a", "audio/mp4"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var log strings.Builder
+			ctx := WithVideoQuality(context.Background(), tc.quality)
+			result, err := (&YtDlpArchiver{}).Archive(ctx, url, &log, nil, 1)
+			if err != nil {
+				t.Fatalf("archive: %v\n%s", err, log.String())
+			}
+			if closer, ok := result.Data.(io.Closer); ok {
+				defer closer.Close()
+			}
+
+			args, err := os.ReadFile(filepath.Join(binDir, "args.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !hasArgPair(strings.Split(strings.TrimSpace(string(args)), "\n"), "-f", tc.format) {
+				t.Errorf("yt-dlp was run with %q, want -f %s", args, tc.format)
+			}
+			if result.Extension != tc.extension || result.ContentType != tc.contentType {
+				t.Errorf("result = %s %s, want %s %s", result.Extension, result.ContentType, tc.extension, tc.contentType)
+			}
+
+			var metadata VideoMetadata
+			if err := json.Unmarshal(result.Metadata.Data, &metadata); err != nil {
+				t.Fatal(err)
+			}
+			if metadata.QualityPolicy == nil || *metadata.QualityPolicy != tc.quality {
+				t.Errorf("metadata quality_policy = %+v, want %+v", metadata.QualityPolicy, tc.quality)
+			}
+			if metadata.Media.Extension != tc.extension {
+				t.Errorf("metadata media extension = %q", metadata.Media.Extension)
+			}
+		})
+	}
+}
@@ -179,6 +179,16 @@ func (c *Client) BrowserReady() bool {
 	return c.Enabled() && c.cfg.CustomerID != "" && c.cfg.BrowserZone != "" && c.cfg.BrowserZonePassword != ""
 }
 
+// Ping reports whether the API answers with the configured key. The health
+// monitor calls it periodically; /status is free, so it costs nothing.
+func (c *Client) Ping(ctx context.Context) error {
+	if !c.Enabled() {
+		return fmt.Errorf("Bright Data API key not configured")
+	}
+	_, err := c.fetchCustomerID(ctx)
+	return sanitizeTransportError(err)
+}
+
 // browserWSEndpoint builds the CDP connect URL for a Browser API session.
 // A non-empty country pins the session's exit geography (the zone has the
 // "country" permission); empty lets Bright Data pick any peer.
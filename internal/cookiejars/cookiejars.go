@@ -0,0 +1,296 @@
+// Package cookiejars stores per-platform cookies.txt jars, encrypted at rest,
+// and picks the one a media job should use.
+//
+// The single YTDLP_COOKIES_FILE jar still works and remains the fallback for
+// hosts with no stored jar; stored jars exist so an expired Instagram session
+// can be replaced from the admin page instead of by a redeploy, and so one
+// platform can be spread across several accounts.
+package cookiejars
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"arker/internal/models"
+	"arker/internal/utils"
+)
+
+// ErrNoKey is returned by every Store operation when COOKIE_JAR_KEY is unset.
+// Storing logins unencrypted is not offered as a fallback.
+var ErrNoKey = errors.New("cookie jars are disabled: COOKIE_JAR_KEY is not set")
+
+// Store reads and writes models.CookieJar rows.
+type Store struct {
+	db   *gorm.DB
+	aead cipher.AEAD
+}
+
+// NewStore builds a store. The AES-256 key is the SHA-256 of secret, so any
+// long random string works as COOKIE_JAR_KEY. An empty secret yields a store
+// that lists jars but refuses to seal or open them.
+func NewStore(db *gorm.DB, secret string) (*Store, error) {
+	s := &Store{db: db}
+	if strings.TrimSpace(secret) == "" {
+		return s, nil
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	if s.aead, err = cipher.NewGCM(block); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Enabled reports whether the store has a key.
+func (s *Store) Enabled() bool {
+	return s != nil && s.aead != nil
+}
+
+func (s *Store) seal(host string, plaintext []byte) ([]byte, error) {
+	if !s.Enabled() {
+		return nil, ErrNoKey
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, plaintext, []byte(host)), nil
+}
+
+func (s *Store) open(host string, sealed []byte) ([]byte, error) {
+	if !s.Enabled() {
+		return nil, ErrNoKey
+	}
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, errors.New("sealed cookie jar is truncated")
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, []byte(host))
+	if err != nil {
+		// Almost always a changed COOKIE_JAR_KEY.
+		return nil, errors.New("cookie jar does not decrypt with the current COOKIE_JAR_KEY")
+	}
+	return plaintext, nil
+}
+
+// NormalizeHost reduces what an operator types ("https://www.Instagram.com/",
+// ".instagram.com") to the bare domain a jar is keyed by.
+func NormalizeHost(input string) (string, error) {
+	host := strings.ToLower(strings.TrimSpace(input))
+	if strings.Contains(host, "://") {
+		parsed, err := url.Parse(host)
+		if err != nil {
+			return "", fmt.Errorf("invalid host %q", input)
+		}
+		host = parsed.Hostname()
+	}
+	host, _, _ = strings.Cut(host, "/")
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "."), "www.")
+	if host == "" || !strings.Contains(host, ".") || strings.ContainsAny(host, " :@") {
+		return "", fmt.Errorf("invalid host %q: want a domain such as instagram.com", input)
+	}
+	return host, nil
+}
+
+// Add validates content as a Netscape cookies.txt, seals it and stores it as a
+// new enabled jar for host.
+func (s *Store) Add(host, label string, content []byte) (models.CookieJar, error) {
+	if !s.Enabled() {
+		return models.CookieJar{}, ErrNoKey
+	}
+	host, err := NormalizeHost(host)
+	if err != nil {
+		return models.CookieJar{}, err
+	}
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return models.CookieJar{}, errors.New("label is required")
+	}
+	summary, err := utils.ParseNetscapeCookies(content, time.Now())
+	if err != nil {
+		return models.CookieJar{}, fmt.Errorf("not a valid cookies.txt: %w", err)
+	}
+	if !coversHost(summary, host) {
+		return models.CookieJar{}, fmt.Errorf("the jar holds no cookies for %s", host)
+	}
+	sealed, err := s.seal(host, content)
+	if err != nil {
+		return models.CookieJar{}, err
+	}
+
+	jar := models.CookieJar{Host: host, Label: label, Sealed: sealed, Enabled: true, CookieCount: summary.Cookies}
+	for _, login := range summary.Logins {
+		if matchesHost(login.Domain, host) {
+			jar.LoginCookie = login.Name
+			break
+		}
+	}
+	if expires, ok := summary.LoginExpiry(host); ok {
+		jar.LoginExpiresAt = expires
+	}
+	if err := s.db.Create(&jar).Error; err != nil {
+		return models.CookieJar{}, err
+	}
+	return jar, nil
+}
+
+// coversHost reports whether any cookie in the jar would be sent to host. A
+// jar exported from the wrong site is the usual upload mistake.
+func coversHost(summary utils.CookieJarStatus, host string) bool {
+	for domain := range summary.Domains {
+		if matchesHost(domain, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesHost reports whether a cookie domain and a jar host name the same
+// site: either may be the subdomain (".www.instagram.com" cookies exist).
+func matchesHost(domain, host string) bool {
+	return domain == host || strings.HasSuffix(domain, "."+host) || strings.HasSuffix(host, "."+domain)
+}
+
+// hostForURL returns the hostname of rawURL, lowercased.
+func hostForURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// candidates returns the enabled jars covering rawURL's host, least recently
+// used first. The most specific host wins: jars for "old.reddit.com" are used
+// for that subdomain before any jar for "reddit.com".
+func (s *Store) candidates(rawURL string) ([]models.CookieJar, error) {
+	hostname := hostForURL(rawURL)
+	if hostname == "" {
+		return nil, nil
+	}
+	var hosts []string
+	for h := hostname; strings.Contains(h, "."); {
+		hosts = append(hosts, h)
+		_, h, _ = strings.Cut(h, ".")
+	}
+	if len(hosts) == 0 {
+		return nil, nil
+	}
+	var jars []models.CookieJar
+	// NULLs first is spelled out because Postgres sorts them last by default
+	// and SQLite first: a never-used jar must always be next in line.
+	if err := s.db.Where("host IN ? AND enabled = ?", hosts, true).
+		Order("CASE WHEN last_used_at IS NULL THEN 0 ELSE 1 END, last_used_at, id").
+		Find(&jars).Error; err != nil {
+		return nil, err
+	}
+	for _, host := range hosts {
+		var matched []models.CookieJar
+		for _, jar := range jars {
+			if jar.Host == host {
+				matched = append(matched, jar)
+			}
+		}
+		if len(matched) > 0 {
+			return matched, nil
+		}
+	}
+	return nil, nil
+}
+
+// Has reports whether an enabled jar covers rawURL. It does not decrypt, so
+// URL routing can ask it freely.
+func (s *Store) Has(rawURL string) bool {
+	if !s.Enabled() {
+		return false
+	}
+	jars, err := s.candidates(rawURL)
+	return err == nil && len(jars) > 0
+}
+
+// pickAttempts bounds how often Pick looks again after losing its jar to a
+// concurrent pick.
+const pickAttempts = 5
+
+// Pick returns the decrypted jar for rawURL's host: the least recently used
+// enabled one. advance records the use, which is what rotates the host's
+// accounts; a preliminary request (a duration probe) passes false so it sees
+// the jar its job's real run will get. ok is false when no jar covers the host.
+//
+// The advance only succeeds if the jar's use count is still the one read, so
+// two workers picking at once take different jars; the loser looks again.
+func (s *Store) Pick(rawURL string, advance bool) (content []byte, label string, ok bool, err error) {
+	if !s.Enabled() {
+		return nil, "", false, nil
+	}
+	for attempt := 1; ; attempt++ {
+		jars, err := s.candidates(rawURL)
+		if err != nil || len(jars) == 0 {
+			return nil, "", false, err
+		}
+		jar := jars[0]
+		content, err = s.open(jar.Host, jar.Sealed)
+		if err != nil {
+			return nil, "", false, fmt.Errorf("%s/%s: %w", jar.Host, jar.Label, err)
+		}
+		if !advance {
+			return content, jar.Host + "/" + jar.Label, true, nil
+		}
+		query := s.db.Model(&models.CookieJar{}).Where("id = ?", jar.ID)
+		if attempt < pickAttempts {
+			query = query.Where("use_count = ?", jar.UseCount)
+		}
+		// Past the last attempt the jar is shared rather than the job failed.
+		result := query.UpdateColumns(map[string]any{"last_used_at": time.Now(), "use_count": gorm.Expr("use_count + 1")})
+		if result.Error != nil {
+			return nil, "", false, result.Error
+		}
+		if result.RowsAffected > 0 {
+			return content, jar.Host + "/" + jar.Label, true, nil
+		}
+	}
+}
+
+// List returns every jar, grouped by host, for the admin page.
+func (s *Store) List() ([]models.CookieJar, error) {
+	var jars []models.CookieJar
+	err := s.db.Order("host, label, id").Find(&jars).Error
+	return jars, err
+}
+
+// SetEnabled enables or disables one jar.
+func (s *Store) SetEnabled(id uint, enabled bool) error {
+	result := s.db.Model(&models.CookieJar{}).Where("id = ?", id).Update("enabled", enabled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Delete permanently removes one jar. Unscoped: a soft-deleted row would keep
+// the sealed login in the database, which is what deleting it is for.
+func (s *Store) Delete(id uint) error {
+	result := s.db.Unscoped().Delete(&models.CookieJar{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package cookiejars
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"arker/internal/models"
+)
+
+func newTestStore(t *testing.T, secret string) *Store {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.CookieJar{}); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewStore(db, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func instagramJar(session string) []byte {
+	expires := strconv.FormatInt(time.Now().Add(90*24*time.Hour).Unix(), 10)
+	return []byte("# Netscape HTTP Cookie File\n" +
+		"#HttpOnly_.instagram.com\tTRUE\t/\tTRUE\t" + expires + "\tsessionid\t" + session + "\n" +
+		".instagram.com\tTRUE\t/\tTRUE\t0\tcsrftoken\tx\n")
+}
+
+func TestAddSealsAndRecordsTheLogin(t *testing.T) {
+	store := newTestStore(t, "test key")
+	jar, err := store.Add("https://www.Instagram.com/", "bot-1", instagramJar("secret-session"))
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if jar.Host != "instagram.com" || jar.CookieCount != 2 || jar.LoginCookie != "sessionid" || jar.LoginExpiresAt == nil {
+		t.Errorf("jar = %+v", jar)
+	}
+	if strings.Contains(string(jar.Sealed), "secret-session") {
+		t.Error("the session is stored in plaintext")
+	}
+
+	// The host is bound into the ciphertext: a row edited to another host
+	// does not decrypt.
+	if _, err := store.open("tiktok.com", jar.Sealed); err == nil {
+		t.Error("a jar opened under a different host")
+	}
+	other := newTestStore(t, "another key")
+	if _, err := other.open(jar.Host, jar.Sealed); err == nil || !strings.Contains(err.Error(), "COOKIE_JAR_KEY") {
+		t.Errorf("open with the wrong key = %v, want a COOKIE_JAR_KEY error", err)
+	}
+}
+
+func TestAddRejectsBadJars(t *testing.T) {
+	store := newTestStore(t, "test key")
+	for name, tc := range map[string]struct{ host, label, content string }{
+		"malformed":  {"instagram.com", "bot", ".instagram.com\tTRUE\t/\n"},
+		"wrong site": {"tiktok.com", "bot", string(instagramJar("s"))},
+		"no label":   {"instagram.com", " ", string(instagramJar("s"))},
+		"bad host":   {"localhost", "bot", string(instagramJar("s"))},
+		"empty jar":  {"instagram.com", "bot", "# Netscape HTTP Cookie File\n"},
+	} {
+		if _, err := store.Add(tc.host, tc.label, []byte(tc.content)); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+
+	disabled := newTestStore(t, "")
+	if _, err := disabled.Add("instagram.com", "bot", instagramJar("s")); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Add without a key = %v, want ErrNoKey", err)
+	}
+	if disabled.Has("https://www.instagram.com/p/ABC/") {
+		t.Error("a store without a key offered a jar")
+	}
+}
+
+func TestPickRotatesAccounts(t *testing.T) {
+	store := newTestStore(t, "test key")
+	for _, label := range []string{"bot-1", "bot-2"} {
+		if _, err := store.Add("instagram.com", label, instagramJar(label)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const post = "https://www.instagram.com/p/ABC/"
+
+	pick := func(advance bool) string {
+		t.Helper()
+		content, label, ok, err := store.Pick(post, advance)
+		if err != nil || !ok {
+			t.Fatalf("Pick = %v, %v", ok, err)
+		}
+		if !strings.Contains(string(content), strings.TrimPrefix(label, "instagram.com/")) {
+			t.Fatalf("jar %s returned another account's cookies", label)
+		}
+		return label
+	}
+
+	// A probe sees the jar the next run gets, without using it up.
+	if probe, run := pick(false), pick(true); probe != "instagram.com/bot-1" || run != probe {
+		t.Errorf("probe %s, run %s; want both bot-1", probe, run)
+	}
+	if next := pick(true); next != "instagram.com/bot-2" {
+		t.Errorf("second run used %s, want bot-2", next)
+	}
+	if again := pick(true); again != "instagram.com/bot-1" {
+		t.Errorf("third run used %s, want bot-1 again", again)
+	}
+
+	jars, _ := store.List()
+	if err := store.SetEnabled(jars[0].ID, false); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if label := pick(true); label != "instagram.com/bot-2" {
+			t.Errorf("run used disabled jar %s", label)
+		}
+	}
+
+	if _, _, ok, _ := store.Pick("https://www.tiktok.com/@x/video/1", true); ok {
+		t.Error("a jar was picked for an uncovered host")
+	}
+}
+
+func TestPickLosingARaceTakesTheNextJar(t *testing.T) {
+	store := newTestStore(t, "test key")
+	for _, label := range []string{"bot-1", "bot-2"} {
+		if _, err := store.Add("instagram.com", label, instagramJar(label)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Another worker takes bot-1 between this pick's read and its advance.
+	raced := false
+	err := store.db.Callback().Query().After("gorm:query").Register("test:race", func(tx *gorm.DB) {
+		if raced || tx.Statement.Table != "cookie_jars" {
+			return
+		}
+		raced = true
+		tx.Session(&gorm.Session{NewDB: true}).Model(&models.CookieJar{}).Where("label = ?", "bot-1").
+			UpdateColumns(map[string]any{"last_used_at": time.Now(), "use_count": gorm.Expr("use_count + 1")})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, label, ok, err := store.Pick("https://www.instagram.com/p/ABC/", true)
+	if err != nil || !ok || label != "instagram.com/bot-2" {
+		t.Fatalf("Pick = %s, %v, %v; want bot-2", label, ok, err)
+	}
+	jars, _ := store.List()
+	for _, jar := range jars {
+		if jar.UseCount != 1 {
+			t.Errorf("%s used %d times, want 1", jar.Label, jar.UseCount)
+		}
+	}
+}
+
+func TestPickPrefersTheMostSpecificHost(t *testing.T) {
+	store := newTestStore(t, "test key")
+	redditJar := func(domain string) []byte {
+		return []byte(domain + "\tTRUE\t/\tTRUE\t0\treddit_session\tx\n")
+	}
+	if _, err := store.Add("reddit.com", "main", redditJar(".reddit.com")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add("old.reddit.com", "old", redditJar("old.reddit.com")); err != nil {
+		t.Fatal(err)
+	}
+	if _, label, _, _ := store.Pick("https://old.reddit.com/r/golang", false); label != "old.reddit.com/old" {
+		t.Errorf("old.reddit.com used %s", label)
+	}
+	if _, label, _, _ := store.Pick("https://www.reddit.com/r/golang", false); label != "reddit.com/main" {
+		t.Errorf("www.reddit.com used %s", label)
+	}
+}
+
+func TestDeleteRemovesTheRow(t *testing.T) {
+	store := newTestStore(t, "test key")
+	jar, err := store.Add("instagram.com", "bot", instagramJar("s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(jar.ID); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	store.db.Unscoped().Model(&models.CookieJar{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d rows left after delete, want none", count)
+	}
+	if err := store.Delete(jar.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("second delete = %v, want not found", err)
+	}
+}
+
+func TestNormalizeHost(t *testing.T) {
+	for input, want := range map[string]string{
+		"instagram.com":               "instagram.com",
+		" https://www.Instagram.com/": "instagram.com",
+		".tiktok.com":                 "tiktok.com",
+		"old.reddit.com/r/golang":     "old.reddit.com",
+	} {
+		if got, err := NormalizeHost(input); err != nil || got != want {
+			t.Errorf("NormalizeHost(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"", "localhost", "user@instagram.com", "instagram.com:443"} {
+		if _, err := NormalizeHost(input); err == nil {
+			t.Errorf("NormalizeHost(%q) accepted", input)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+// Package feeds follows RSS, Atom and JSON Feed subscriptions: it polls each
+// subscribed feed, records the entries it has seen, and queues a capture of
+// every new entry's link and enclosures.
+package feeds
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Feed is a parsed feed, whatever its format.
+type Feed struct {
+	Title string
+	Link  string
+	Items []Item
+}
+
+// Item is one entry of a feed. Link and enclosure URLs are absolute.
+type Item struct {
+	// GUID identifies the entry across polls: the feed's own ID for it, or
+	// its link, or a hash of its title and date when the feed gives neither.
+	GUID       string
+	Title      string
+	Link       string
+	Summary    string
+	Published  *time.Time
+	Enclosures []Enclosure
+}
+
+// Enclosure is a file attached to an entry.
+type Enclosure struct {
+	URL    string
+	Type   string
+	Length int64
+}
+
+// ErrNotAFeed is returned for a document that is none of the formats.
+var ErrNotAFeed = errors.New("document is not an RSS, Atom or JSON feed")
+
+// Parse reads an RSS 2.0, RSS 1.0 (RDF), Atom or JSON Feed document. Relative
+// links are resolved against feedURL.
+func Parse(data []byte, feedURL string) (*Feed, error) {
+	base, err := url.Parse(feedURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid feed URL: %w", err)
+	}
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	var feed *Feed
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		feed, err = parseJSONFeed(trimmed)
+	} else {
+		feed, err = parseXMLFeed(trimmed)
+	}
+	if err != nil {
+		return nil, err
+	}
+	feed.Link = resolveLink(base, feed.Link)
+	for i := range feed.Items {
+		item := &feed.Items[i]
+		item.Link = resolveLink(base, item.Link)
+		kept := item.Enclosures[:0]
+		for _, enclosure := range item.Enclosures {
+			if enclosure.URL = resolveLink(base, enclosure.URL); enclosure.URL != "" {
+				kept = append(kept, enclosure)
+			}
+		}
+		item.Enclosures = kept
+		if item.GUID == "" {
+			item.GUID = item.Link
+		}
+		if item.GUID == "" {
+			item.GUID = syntheticGUID(item)
+		}
+	}
+	return feed, nil
+}
+
+// resolveLink makes a feed link absolute. Anything that is not http(s) once
+// resolved (mailto:, javascript:, a bare fragment) is dropped.
+func resolveLink(base *url.URL, link string) string {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return ""
+	}
+	ref, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	resolved := base.ResolveReference(ref)
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return ""
+	}
+	return resolved.String()
+}
+
+// syntheticGUID identifies an entry with neither an ID nor a link. Such an
+// entry is only recognized again while its title and date are unchanged.
+func syntheticGUID(item *Item) string {
+	var published string
+	if item.Published != nil {
+		published = item.Published.UTC().Format(time.RFC3339)
+	}
+	sum := sha256.Sum256([]byte(item.Title + "\x00" + published + "\x00" + item.Summary))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// xmlFeed covers the three XML formats at once: the root element's name says
+// which fields are filled.
+type xmlFeed struct {
+	XMLName xml.Name
+	// RSS 2.0 nests everything in <channel>; RSS 1.0 puts <item> beside it.
+	Channel struct {
+		Title string    `xml:"title"`
+		Links []string  `xml:"link"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	RDFItems []rssItem `xml:"item"`
+	// Atom
+	Title   string      `xml:"title"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	GUID        string   `xml:"guid"`
+	About       string   `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Title       string   `xml:"title"`
+	Links       []string `xml:"link"`
+	Description string   `xml:"description"`
+	PubDate     string   `xml:"pubDate"`
+	// Dublin Core date, used by RSS 1.0 and by RSS 2.0 feeds without pubDate.
+	Date       string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Enclosures []struct {
+		URL    string `xml:"url,attr"`
+		Type   string `xml:"type,attr"`
+		Length string `xml:"length,attr"`
+	} `xml:"enclosure"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Links     []atomLink `xml:"link"`
+	Summary   string     `xml:"summary"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+}
+
+func parseXMLFeed(data []byte) (*Feed, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	// Feeds still declare ISO-8859-1 and windows-1252; encoding/xml alone
+	// only reads UTF-8.
+	decoder.CharsetReader = charset.NewReaderLabel
+	// Feeds in the wild carry HTML entities (&nbsp;) and unescaped
+	// ampersands; a strict parser would drop the whole feed for one of them.
+	// Not AutoClose: HTML's void <link> is RSS's link element.
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+
+	var raw xmlFeed
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotAFeed, err)
+	}
+
+	switch strings.ToLower(raw.XMLName.Local) {
+	case "rss":
+		return rssFeed(raw.Channel.Title, rssLink(raw.Channel.Links), raw.Channel.Items), nil
+	case "rdf":
+		return rssFeed(raw.Channel.Title, rssLink(raw.Channel.Links), raw.RDFItems), nil
+	case "feed":
+		return atomFeed(raw), nil
+	}
+	return nil, ErrNotAFeed
+}
+
+func rssFeed(title, link string, items []rssItem) *Feed {
+	feed := &Feed{Title: strings.TrimSpace(title), Link: link}
+	for _, raw := range items {
+		item := Item{
+			GUID:      strings.TrimSpace(raw.GUID),
+			Title:     strings.TrimSpace(raw.Title),
+			Link:      rssLink(raw.Links),
+			Summary:   strings.TrimSpace(raw.Description),
+			Published: parseFeedTime(raw.PubDate, raw.Date),
+		}
+		if item.GUID == "" {
+			item.GUID = strings.TrimSpace(raw.About)
+		}
+		for _, enclosure := range raw.Enclosures {
+			item.Enclosures = append(item.Enclosures, Enclosure{
+				URL:    enclosure.URL,
+				Type:   strings.TrimSpace(enclosure.Type),
+				Length: parseLength(enclosure.Length),
+			})
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed
+}
+
+// rssLink picks the <link> text. Field names match any namespace, so an
+// <atom:link rel="self"/> beside it also lands here, with empty text.
+func rssLink(links []string) string {
+	for _, link := range links {
+		if link = strings.TrimSpace(link); link != "" {
+			return link
+		}
+	}
+	return ""
+}
+
+func atomFeed(raw xmlFeed) *Feed {
+	feed := &Feed{Title: strings.TrimSpace(raw.Title), Link: atomAlternate(raw.Links)}
+	for _, entry := range raw.Entries {
+		item := Item{
+			GUID:      strings.TrimSpace(entry.ID),
+			Title:     strings.TrimSpace(entry.Title),
+			Link:      atomAlternate(entry.Links),
+			Summary:   strings.TrimSpace(entry.Summary),
+			Published: parseFeedTime(entry.Published, entry.Updated),
+		}
+		for _, link := range entry.Links {
+			if strings.EqualFold(link.Rel, "enclosure") {
+				item.Enclosures = append(item.Enclosures, Enclosure{
+					URL:    link.Href,
+					Type:   strings.TrimSpace(link.Type),
+					Length: parseLength(link.Length),
+				})
+			}
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed
+}
+
+// atomAlternate picks an Atom element's main link: rel="alternate", which is
+// also what a link without rel means.
+func atomAlternate(links []atomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || strings.EqualFold(link.Rel, "alternate") {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+// jsonFeed is JSON Feed 1.0 and 1.1; they differ only in fields not read here.
+type jsonFeed struct {
+	Version     string `json:"version"`
+	Title       string `json:"title"`
+	HomePageURL string `json:"home_page_url"`
+	Items       []struct {
+		ID            json.RawMessage `json:"id"`
+		URL           string          `json:"url"`
+		ExternalURL   string          `json:"external_url"`
+		Title         string          `json:"title"`
+		Summary       string          `json:"summary"`
+		ContentText   string          `json:"content_text"`
+		DatePublished string          `json:"date_published"`
+		DateModified  string          `json:"date_modified"`
+		Attachments   []struct {
+			URL         string `json:"url"`
+			MimeType    string `json:"mime_type"`
+			SizeInBytes int64  `json:"size_in_bytes"`
+		} `json:"attachments"`
+	} `json:"items"`
+}
+
+func parseJSONFeed(data []byte) (*Feed, error) {
+	var raw jsonFeed
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotAFeed, err)
+	}
+	if !strings.HasPrefix(raw.Version, "https://jsonfeed.org/version/") {
+		return nil, ErrNotAFeed
+	}
+	feed := &Feed{Title: strings.TrimSpace(raw.Title), Link: raw.HomePageURL}
+	for _, entry := range raw.Items {
+		link := entry.URL
+		if link == "" {
+			link = entry.ExternalURL
+		}
+		summary := entry.Summary
+		if summary == "" {
+			summary = entry.ContentText
+		}
+		item := Item{
+			GUID:      jsonFeedID(entry.ID),
+			Title:     strings.TrimSpace(entry.Title),
+			Link:      link,
+			Summary:   strings.TrimSpace(summary),
+			Published: parseFeedTime(entry.DatePublished, entry.DateModified),
+		}
+		for _, attachment := range entry.Attachments {
+			item.Enclosures = append(item.Enclosures, Enclosure{
+				URL:    attachment.URL,
+				Type:   attachment.MimeType,
+				Length: attachment.SizeInBytes,
+			})
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed, nil
+}
+
+// jsonFeedID reads an item ID. The spec says string, but feeds generated
+// from database rows often emit a number.
+func jsonFeedID(raw json.RawMessage) string {
+	var id string
+	if err := json.Unmarshal(raw, &id); err == nil {
+		return strings.TrimSpace(id)
+	}
+	var number json.Number
+	if err := json.Unmarshal(raw, &number); err == nil {
+		return number.String()
+	}
+	return ""
+}
+
+// feedTimeLayouts are the date formats seen in feeds: RFC 3339 for Atom,
+// JSON Feed and Dublin Core, and RFC 822 with its common deviations for RSS.
+var feedTimeLayouts = []string{
+	time.RFC3339,
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"Mon, _2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// parseFeedTime returns the first of values that parses, or nil.
+func parseFeedTime(values ...string) *time.Time {
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		for _, layout := range feedTimeLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				return &t
+			}
+		}
+	}
+	return nil
+}
+
+func parseLength(value string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,198 @@
+package feeds
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+const rssFeedXML = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+  <channel>
+    <title>Example Radio</title>
+    <atom:link href="https://example.com/feed.xml" rel="self" type="application/rss+xml"/>
+    <link>https://example.com/</link>
+    <item>
+      <title>Episode 12: Tape Decks</title>
+      <link>/episodes/12</link>
+      <guid isPermaLink="false">example-radio-12</guid>
+      <pubDate>Tue, 06 Oct 2026 09:00:00 +0000</pubDate>
+      <description>Two hours on cassette&nbsp;decks.</description>
+      <enclosure url="https://cdn.example.com/12.mp3" type="audio/mpeg" length="52428800"/>
+    </item>
+    <item>
+      <title>Episode 11</title>
+      <link>https://example.com/episodes/11</link>
+      <pubDate>Tue, 29 Sep 2026 09:00:00 GMT</pubDate>
+    </item>
+  </channel>
+</rss>`
+
+func TestParseRSS(t *testing.T) {
+	feed, err := Parse([]byte(rssFeedXML), "https://example.com/feed.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Title != "Example Radio" || feed.Link != "https://example.com/" {
+		t.Errorf("feed = %q %q; the self link must not replace the channel link", feed.Title, feed.Link)
+	}
+	if len(feed.Items) != 2 {
+		t.Fatalf("items = %d, want 2", len(feed.Items))
+	}
+
+	first := feed.Items[0]
+	if first.GUID != "example-radio-12" || first.Link != "https://example.com/episodes/12" {
+		t.Errorf("first item = %+v", first)
+	}
+	if first.Summary != "Two hours on cassette decks." {
+		t.Errorf("summary = %q", first.Summary)
+	}
+	want := time.Date(2026, 10, 6, 9, 0, 0, 0, time.UTC)
+	if first.Published == nil || !first.Published.Equal(want) {
+		t.Errorf("published = %v, want %v", first.Published, want)
+	}
+	if len(first.Enclosures) != 1 || first.Enclosures[0].URL != "https://cdn.example.com/12.mp3" ||
+		first.Enclosures[0].Type != "audio/mpeg" || first.Enclosures[0].Length != 52428800 {
+		t.Errorf("enclosures = %+v", first.Enclosures)
+	}
+
+	// No guid: the link identifies the entry.
+	if feed.Items[1].GUID != "https://example.com/episodes/11" {
+		t.Errorf("second item GUID = %q", feed.Items[1].GUID)
+	}
+}
+
+func TestParseAtom(t *testing.T) {
+	const atom = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Project changelog</title>
+  <link href="https://example.org/" />
+  <link rel="self" href="https://example.org/atom.xml" />
+  <entry>
+    <id>tag:example.org,2026:release-2.4</id>
+    <title>Release 2.4</title>
+    <link rel="alternate" href="https://example.org/releases/2.4" />
+    <link rel="enclosure" href="https://example.org/2.4/notes.mp3" type="audio/mpeg" length="1234" />
+    <updated>2026-10-01T12:30:00Z</updated>
+    <summary>Faster builds.</summary>
+  </entry>
+</feed>`
+	feed, err := Parse([]byte(atom), "https://example.org/atom.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Title != "Project changelog" || feed.Link != "https://example.org/" {
+		t.Errorf("feed = %q %q", feed.Title, feed.Link)
+	}
+	if len(feed.Items) != 1 {
+		t.Fatalf("items = %d", len(feed.Items))
+	}
+	item := feed.Items[0]
+	if item.GUID != "tag:example.org,2026:release-2.4" || item.Link != "https://example.org/releases/2.4" {
+		t.Errorf("item = %+v", item)
+	}
+	if item.Published == nil || item.Published.Format(time.RFC3339) != "2026-10-01T12:30:00Z" {
+		t.Errorf("updated was not used as the date: %v", item.Published)
+	}
+	if len(item.Enclosures) != 1 || item.Enclosures[0].Length != 1234 {
+		t.Errorf("enclosures = %+v", item.Enclosures)
+	}
+}
+
+func TestParseRDF(t *testing.T) {
+	const rdf = `<?xml version="1.0"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <channel rdf:about="https://example.net/">
+    <title>Old school</title>
+    <link>https://example.net/</link>
+  </channel>
+  <item rdf:about="https://example.net/posts/1">
+    <title>First</title>
+    <link>https://example.net/posts/1</link>
+    <dc:date>2026-09-01T08:00:00+02:00</dc:date>
+  </item>
+</rdf:RDF>`
+	feed, err := Parse([]byte(rdf), "https://example.net/index.rdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Title != "Old school" || len(feed.Items) != 1 {
+		t.Fatalf("feed = %+v", feed)
+	}
+	if feed.Items[0].GUID != "https://example.net/posts/1" || feed.Items[0].Published == nil {
+		t.Errorf("item = %+v", feed.Items[0])
+	}
+}
+
+func TestParseJSONFeed(t *testing.T) {
+	const jsonFeed = `{
+  "version": "https://jsonfeed.org/version/1.1",
+  "title": "Microblog",
+  "home_page_url": "https://example.com/",
+  "items": [
+    {"id": 2041, "url": "https://example.com/2041", "content_text": "Hello", "date_published": "2026-10-10T10:00:00Z",
+     "attachments": [{"url": "https://example.com/2041.m4a", "mime_type": "audio/mp4", "size_in_bytes": 99}]},
+    {"id": "ext", "external_url": "https://elsewhere.example/post"}
+  ]
+}`
+	feed, err := Parse([]byte(jsonFeed), "https://example.com/feed.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Items) != 2 {
+		t.Fatalf("items = %d", len(feed.Items))
+	}
+	if feed.Items[0].GUID != "2041" || feed.Items[0].Summary != "Hello" || len(feed.Items[0].Enclosures) != 1 {
+		t.Errorf("first item = %+v", feed.Items[0])
+	}
+	if feed.Items[1].Link != "https://elsewhere.example/post" {
+		t.Errorf("external_url was not used as the link: %+v", feed.Items[1])
+	}
+}
+
+func TestParseLatin1RSS(t *testing.T) {
+	latin1 := []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n<rss version=\"2.0\"><channel><title>Caf\xe9</title>" +
+		"<item><title>Cr\xe8me</title><link>https://example.fr/1</link></item></channel></rss>")
+	feed, err := Parse(latin1, "https://example.fr/rss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Title != "Café" || feed.Items[0].Title != "Crème" {
+		t.Errorf("decoded %q / %q", feed.Title, feed.Items[0].Title)
+	}
+}
+
+func TestParseDropsUnusableLinksAndSynthesizesGUIDs(t *testing.T) {
+	const rss = `<rss version="2.0"><channel><title>x</title>
+  <item><title>No link</title><description>just text</description></item>
+  <item><title>Mail</title><link>mailto:editor@example.com</link>
+    <enclosure url="javascript:alert(1)" type="audio/mpeg"/></item>
+</channel></rss>`
+	feed, err := Parse([]byte(rss), "https://example.com/feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range feed.Items {
+		if item.Link != "" || len(item.Enclosures) != 0 {
+			t.Errorf("unusable link kept: %+v", item)
+		}
+		if item.GUID == "" {
+			t.Errorf("item %q has no GUID", item.Title)
+		}
+	}
+	if feed.Items[0].GUID == feed.Items[1].GUID {
+		t.Error("different entries got the same synthetic GUID")
+	}
+}
+
+func TestParseRejectsOtherDocuments(t *testing.T) {
+	for _, doc := range []string{
+		`<!DOCTYPE html><html><head><title>Blog</title></head><body></body></html>`,
+		`{"title": "not a feed"}`,
+		`plain text`,
+	} {
+		if _, err := Parse([]byte(doc), "https://example.com/"); !errors.Is(err, ErrNotAFeed) {
+			t.Errorf("Parse(%.30q) error = %v, want ErrNotAFeed", doc, err)
+		}
+	}
+}
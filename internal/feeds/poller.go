@@ -0,0 +1,466 @@
+package feeds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+
+	"arker/internal/models"
+	"arker/internal/utils"
+	"arker/internal/workers"
+)
+
+// MinInterval is the shortest per-feed poll interval accepted. Publishers
+// rate-limit aggressive pollers, and nothing is archived faster for it.
+const MinInterval = 5 * time.Minute
+
+// maxFeedBytes bounds a fetched feed. Full-content feeds of busy blogs run to
+// a few megabytes.
+const maxFeedBytes = 10 << 20
+
+const fetchTimeout = 30 * time.Second
+
+const feedUserAgent = "Arker feed follower"
+
+// Poller polls subscribed feeds and queues captures of their new entries.
+type Poller struct {
+	db          *gorm.DB
+	riverClient *river.Client[pgx.Tx]
+	client      *http.Client
+	// validateURL vets the feed URL when it is subscribed and before each
+	// fetch, every redirect of a fetch, and the entry links and enclosures
+	// the feed's publisher chooses before they are captured.
+	validateURL func(rawURL string) error
+	// interval is the poll interval of a subscription that sets none.
+	interval time.Duration
+	// mu serializes polls, so a "poll now" from the admin page and the
+	// scheduled pass never record the same entry twice.
+	mu sync.Mutex
+}
+
+// NewPoller builds a poller. riverClient may be nil in tests, in which case
+// captures are created but no jobs are enqueued.
+func NewPoller(db *gorm.DB, riverClient *river.Client[pgx.Tx], interval time.Duration) *Poller {
+	if interval < MinInterval {
+		interval = MinInterval
+	}
+	p := &Poller{
+		db:          db,
+		riverClient: riverClient,
+		validateURL: utils.ValidateURL,
+		interval:    interval,
+	}
+	p.client = &http.Client{Timeout: fetchTimeout, CheckRedirect: p.checkRedirect}
+	return p
+}
+
+// maxRedirects matches net/http's own limit.
+const maxRedirects = 10
+
+// checkRedirect refuses a redirect of a feed fetch to an address the feed
+// URL itself could not name.
+func (p *Poller) checkRedirect(next *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if err := p.validateURL(next.URL.String()); err != nil {
+		return fmt.Errorf("refusing redirect to %s: %w", next.URL.Host, err)
+	}
+	return nil
+}
+
+// DefaultInterval is the interval of a subscription that sets none.
+func (p *Poller) DefaultInterval() time.Duration {
+	return p.interval
+}
+
+// Start polls due feeds every tick until ctx ends, starting with an immediate
+// pass.
+func (p *Poller) Start(ctx context.Context, tick time.Duration) {
+	go func() {
+		p.PollDue(ctx)
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.PollDue(ctx)
+			}
+		}
+	}()
+}
+
+// PollDue polls every enabled subscription whose interval has elapsed since
+// its last poll. Failures are recorded on the subscription and logged.
+func (p *Poller) PollDue(ctx context.Context) {
+	var subs []models.FeedSubscription
+	if err := p.db.Where("enabled = ?", true).Order("id").Find(&subs).Error; err != nil {
+		slog.Error("Failed to load feed subscriptions", "error", err)
+		return
+	}
+	now := time.Now()
+	for i := range subs {
+		if ctx.Err() != nil {
+			return
+		}
+		if !p.due(&subs[i], now) {
+			continue
+		}
+		if err := p.Poll(ctx, &subs[i]); err != nil {
+			slog.Warn("Feed poll failed", "feed_id", subs[i].ID, "url", subs[i].URL, "error", err)
+		}
+	}
+}
+
+func (p *Poller) due(sub *models.FeedSubscription, now time.Time) bool {
+	if sub.LastPolledAt == nil {
+		return true
+	}
+	interval := sub.Interval
+	if interval <= 0 {
+		interval = p.interval
+	}
+	return !now.Before(sub.LastPolledAt.Add(interval))
+}
+
+// Poll fetches one feed, records its new entries and queues their captures,
+// then retries entries whose queueing failed earlier. The outcome is stored
+// on sub: LastError is the fetch or parse failure, or empty.
+func (p *Poller) Poll(ctx context.Context, sub *models.FeedSubscription) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// The first successful poll decides whether the entries already in the
+	// feed are captured or only marked seen.
+	firstPoll := sub.LastSuccessAt == nil
+
+	updates := map[string]interface{}{}
+	feed, validators, pollErr := p.fetch(ctx, sub)
+	queued := 0
+	if pollErr == nil && feed != nil {
+		var err error
+		queued, err = p.recordEntries(ctx, sub, feed, firstPoll && !sub.CaptureExisting)
+		if err != nil {
+			pollErr = err
+		} else {
+			// Validators are only kept once every entry is recorded, so a
+			// poll that stopped halfway refetches the whole feed next time.
+			updates["e_tag"] = validators.etag
+			updates["last_modified"] = validators.lastModified
+			if sub.Title == "" && feed.Title != "" {
+				updates["title"] = feed.Title
+			}
+		}
+	}
+	if pollErr == nil {
+		retried, err := p.retryFailedEntries(ctx, sub)
+		queued += retried
+		pollErr = err
+	}
+
+	now := time.Now()
+	updates["last_polled_at"] = now
+	updates["last_error"] = ""
+	if pollErr != nil {
+		updates["last_error"] = pollErr.Error()
+	} else {
+		updates["last_success_at"] = now
+	}
+	var entryCount int64
+	if err := p.db.Model(&models.FeedEntry{}).Where("feed_subscription_id = ?", sub.ID).Count(&entryCount).Error; err == nil {
+		updates["entry_count"] = int(entryCount)
+	}
+	if err := p.db.Model(&models.FeedSubscription{}).Where("id = ?", sub.ID).Updates(updates).Error; err != nil {
+		return fmt.Errorf("record poll: %w", err)
+	}
+	if err := p.db.First(sub, sub.ID).Error; err != nil {
+		return fmt.Errorf("reload subscription: %w", err)
+	}
+	if queued > 0 {
+		slog.Info("Queued captures from feed", "feed_id", sub.ID, "url", sub.URL, "captures", queued)
+	}
+	return pollErr
+}
+
+type feedValidators struct {
+	etag, lastModified string
+}
+
+// fetch GETs the feed, conditionally when the last poll left validators. A
+// nil feed with a nil error means the feed has not changed.
+func (p *Poller) fetch(ctx context.Context, sub *models.FeedSubscription) (*Feed, feedValidators, error) {
+	validators := feedValidators{etag: sub.ETag, lastModified: sub.LastModified}
+	// Checked on every poll: the host's DNS may have changed since the
+	// subscription was made.
+	if err := p.validateURL(sub.URL); err != nil {
+		return nil, validators, fmt.Errorf("invalid feed URL: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sub.URL, nil)
+	if err != nil {
+		return nil, validators, err
+	}
+	req.Header.Set("User-Agent", feedUserAgent)
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/feed+json, application/json;q=0.9, application/xml;q=0.9, text/xml;q=0.8, */*;q=0.5")
+	if sub.ETag != "" {
+		req.Header.Set("If-None-Match", sub.ETag)
+	}
+	if sub.LastModified != "" {
+		req.Header.Set("If-Modified-Since", sub.LastModified)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, validators, fmt.Errorf("fetch feed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, validators, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, validators, fmt.Errorf("fetch feed: HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedBytes+1))
+	if err != nil {
+		return nil, validators, fmt.Errorf("read feed: %w", err)
+	}
+	if len(body) > maxFeedBytes {
+		return nil, validators, fmt.Errorf("feed is larger than %d bytes", maxFeedBytes)
+	}
+
+	// Links resolve against the URL the feed was finally served from.
+	feed, err := Parse(body, resp.Request.URL.String())
+	if err != nil {
+		return nil, validators, err
+	}
+	return feed, feedValidators{etag: resp.Header.Get("ETag"), lastModified: resp.Header.Get("Last-Modified")}, nil
+}
+
+// recordEntries records every entry of feed not seen before and, unless
+// markOnly, queues its captures. Feeds list newest first; entries are
+// recorded oldest first so row order is publication order.
+func (p *Poller) recordEntries(ctx context.Context, sub *models.FeedSubscription, feed *Feed, markOnly bool) (int, error) {
+	queued := 0
+	seen := make(map[string]bool, len(feed.Items))
+	for i := len(feed.Items) - 1; i >= 0; i-- {
+		item := feed.Items[i]
+		if seen[item.GUID] {
+			continue // a feed that repeats an entry
+		}
+		seen[item.GUID] = true
+		if err := ctx.Err(); err != nil {
+			return queued, err
+		}
+
+		var count int64
+		if err := p.db.Model(&models.FeedEntry{}).
+			Where("feed_subscription_id = ? AND guid = ?", sub.ID, item.GUID).
+			Count(&count).Error; err != nil {
+			return queued, fmt.Errorf("look up entry: %w", err)
+		}
+		if count > 0 {
+			continue
+		}
+
+		entry := models.FeedEntry{
+			FeedSubscriptionID: sub.ID,
+			GUID:               item.GUID,
+			Title:              item.Title,
+			Link:               item.Link,
+			Summary:            item.Summary,
+			PublishedAt:        item.Published,
+		}
+		for _, enclosure := range item.Enclosures {
+			entry.Enclosures = append(entry.Enclosures, models.FeedEnclosure{
+				URL:    enclosure.URL,
+				Type:   enclosure.Type,
+				Length: enclosure.Length,
+			})
+		}
+		if err := p.db.Create(&entry).Error; err != nil {
+			return queued, fmt.Errorf("record entry %q: %w", item.GUID, err)
+		}
+		if markOnly {
+			continue
+		}
+		n, err := p.queueEntry(ctx, &entry)
+		queued += n
+		if err != nil {
+			return queued, err
+		}
+	}
+	return queued, nil
+}
+
+// retryFailedEntries queues what an earlier poll failed to. The entry carries
+// everything needed, so this works on a poll the feed answered with a 304.
+func (p *Poller) retryFailedEntries(ctx context.Context, sub *models.FeedSubscription) (int, error) {
+	var entries []models.FeedEntry
+	if err := p.db.Preload("Enclosures").
+		Where("feed_subscription_id = ? AND queue_error <> ?", sub.ID, "").
+		Order("id").Find(&entries).Error; err != nil {
+		return 0, fmt.Errorf("load failed entries: %w", err)
+	}
+	queued := 0
+	for i := range entries {
+		n, err := p.queueEntry(ctx, &entries[i])
+		queued += n
+		if err != nil {
+			return queued, err
+		}
+	}
+	return queued, nil
+}
+
+// queueEntry queues a capture of the entry's link and of each enclosure that
+// does not have one yet. A capture that cannot be queued (a type that is
+// down, a URL that fails validation) is recorded on the entry for a later
+// poll to retry; only a database failure is returned.
+func (p *Poller) queueEntry(ctx context.Context, entry *models.FeedEntry) (int, error) {
+	queued := 0
+	var failures []string
+	if entry.Link != "" && entry.ShortID == "" {
+		shortID, err := p.queueCapture(ctx, entry.Link)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", entry.Link, err))
+		} else {
+			entry.ShortID = shortID
+			queued++
+		}
+	}
+	for i := range entry.Enclosures {
+		enclosure := &entry.Enclosures[i]
+		if enclosure.ShortID != "" {
+			continue
+		}
+		if enclosure.URL == entry.Link && entry.ShortID != "" {
+			// Feeds that link an episode straight to its audio file.
+			enclosure.ShortID = entry.ShortID
+		} else {
+			shortID, err := p.queueCapture(ctx, enclosure.URL)
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", enclosure.URL, err))
+				continue
+			}
+			enclosure.ShortID = shortID
+			queued++
+		}
+		if err := p.db.Model(enclosure).Update("short_id", enclosure.ShortID).Error; err != nil {
+			return queued, fmt.Errorf("record enclosure capture: %w", err)
+		}
+	}
+
+	entry.QueueError = strings.Join(failures, "; ")
+	if err := p.db.Model(entry).Updates(map[string]interface{}{
+		"short_id":    entry.ShortID,
+		"queue_error": entry.QueueError,
+	}).Error; err != nil {
+		return queued, fmt.Errorf("record entry capture: %w", err)
+	}
+	return queued, nil
+}
+
+// queueCapture queues a capture of a URL taken from a feed. The feed is
+// third-party content, so the URL gets the same SSRF check as one submitted
+// through the API.
+func (p *Poller) queueCapture(ctx context.Context, rawURL string) (string, error) {
+	if err := p.validateURL(rawURL); err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	return workers.QueueCapture(ctx, p.db, p.riverClient, rawURL, nil, nil, false)
+}
+
+// Subscribe validates rawURL and stores a new enabled subscription. It does
+// not poll; the caller decides whether to wait for the first poll.
+func (p *Poller) Subscribe(rawURL string, interval time.Duration, captureExisting bool) (models.FeedSubscription, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return models.FeedSubscription{}, fmt.Errorf("invalid feed URL %q: want an http(s) URL", rawURL)
+	}
+	if err := p.validateURL(rawURL); err != nil {
+		return models.FeedSubscription{}, fmt.Errorf("invalid feed URL %q: %w", rawURL, err)
+	}
+	if interval != 0 && interval < MinInterval {
+		return models.FeedSubscription{}, fmt.Errorf("interval must be at least %s", MinInterval)
+	}
+
+	var count int64
+	if err := p.db.Model(&models.FeedSubscription{}).Where("url = ?", rawURL).Count(&count).Error; err != nil {
+		return models.FeedSubscription{}, err
+	}
+	if count > 0 {
+		return models.FeedSubscription{}, ErrAlreadySubscribed
+	}
+
+	sub := models.FeedSubscription{URL: rawURL, Interval: interval, Enabled: true, CaptureExisting: captureExisting}
+	if err := p.db.Create(&sub).Error; err != nil {
+		return models.FeedSubscription{}, err
+	}
+	return sub, nil
+}
+
+// ErrAlreadySubscribed is returned by Subscribe for a URL already followed.
+var ErrAlreadySubscribed = errors.New("feed is already subscribed")
+
+// List returns every subscription, oldest first.
+func (p *Poller) List() ([]models.FeedSubscription, error) {
+	var subs []models.FeedSubscription
+	err := p.db.Order("id").Find(&subs).Error
+	return subs, err
+}
+
+// Get loads one subscription.
+func (p *Poller) Get(id uint) (models.FeedSubscription, error) {
+	var sub models.FeedSubscription
+	err := p.db.First(&sub, id).Error
+	return sub, err
+}
+
+// SetEnabled pauses or resumes polling of a subscription.
+func (p *Poller) SetEnabled(id uint, enabled bool) error {
+	result := p.db.Model(&models.FeedSubscription{}).Where("id = ?", id).Update("enabled", enabled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Delete removes a subscription and its seen-entry records. The captures it
+// queued are archives like any other and stay.
+func (p *Poller) Delete(id uint) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		// Unscoped: a soft-deleted row would keep holding the feed URL's
+		// unique index, and the feed could never be subscribed again.
+		result := tx.Unscoped().Delete(&models.FeedSubscription{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		entryIDs := tx.Unscoped().Model(&models.FeedEntry{}).Select("id").Where("feed_subscription_id = ?", id)
+		if err := tx.Unscoped().Where("feed_entry_id IN (?)", entryIDs).Delete(&models.FeedEnclosure{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("feed_subscription_id = ?", id).Delete(&models.FeedEntry{}).Error
+	})
+}
@@ -0,0 +1,356 @@
+package feeds
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"arker/internal/models"
+	"arker/internal/utils"
+)
+
+var testDBSeq atomic.Uint64
+
+func newFeedTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := fmt.Sprintf("file:%s-%d?mode=memory&cache=shared", t.Name(), testDBSeq.Add(1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.APIKey{}, &models.ArchivedURL{}, &models.Capture{}, &models.ArchiveItem{}, &models.Config{},
+		&models.FeedSubscription{}, &models.FeedEntry{}, &models.FeedEnclosure{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// newTestPoller returns a poller whose URL check passes the test feeds'
+// reserved .example hosts, which do not resolve.
+func newTestPoller(db *gorm.DB) *Poller {
+	poller := NewPoller(db, nil, 0)
+	// The test feeds are served from loopback and the fixtures name hosts
+	// that need no DNS; anything else gets the real check.
+	poller.validateURL = func(rawURL string) error {
+		if strings.Contains(rawURL, ".example/") || strings.HasPrefix(rawURL, "https://example.com/") || strings.HasPrefix(rawURL, "http://127.0.0.1:") {
+			return nil
+		}
+		return utils.ValidateURL(rawURL)
+	}
+	return poller
+}
+
+// feedServer serves an RSS feed built from items, with an ETag that changes
+// whenever items do, and counts the fetches it answered with a 304.
+type feedServer struct {
+	mu          sync.Mutex
+	items       []string
+	notModified int
+}
+
+func (f *feedServer) set(items ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.items = items
+}
+
+func (f *feedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	etag := fmt.Sprintf(`"v%d"`, len(f.items))
+	if r.Header.Get("If-None-Match") == etag {
+		f.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", "application/rss+xml")
+	fmt.Fprint(w, `<rss version="2.0"><channel><title>Changelog</title>`)
+	// Newest first, as feeds list them.
+	for i := len(f.items) - 1; i >= 0; i-- {
+		fmt.Fprint(w, f.items[i])
+	}
+	fmt.Fprint(w, `</channel></rss>`)
+}
+
+func post(n int) string {
+	return fmt.Sprintf(`<item><title>Post %d</title><link>https://blog.example/posts/%d</link><guid>post-%d</guid></item>`, n, n, n)
+}
+
+func episode(n int) string {
+	return fmt.Sprintf(`<item><title>Episode %d</title><link>https://pod.example/%d</link><guid>ep-%d</guid>`+
+		`<enclosure url="https://cdn.pod.example/%d.mp3" type="audio/mpeg" length="100"/></item>`, n, n, n, n)
+}
+
+func capturedURL(t *testing.T, db *gorm.DB, shortID string) (string, []string) {
+	t.Helper()
+	var capture models.Capture
+	if err := db.Preload("ArchivedURL").Preload("ArchiveItems").Where("short_id = ?", shortID).First(&capture).Error; err != nil {
+		t.Fatalf("capture %q: %v", shortID, err)
+	}
+	var types []string
+	for _, item := range capture.ArchiveItems {
+		types = append(types, item.Type)
+	}
+	return capture.ArchivedURL.Original, types
+}
+
+func TestPollQueuesNewEntriesOnceAndUsesConditionalGET(t *testing.T) {
+	db := newFeedTestDB(t)
+	server := &feedServer{}
+	server.set(post(1), post(2))
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	poller := newTestPoller(db)
+	sub, err := poller.Subscribe(ts.URL, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := poller.Poll(context.Background(), &sub); err != nil {
+		t.Fatal(err)
+	}
+	if sub.Title != "Changelog" || sub.ETag != `"v2"` || sub.EntryCount != 2 || sub.LastSuccessAt == nil {
+		t.Errorf("subscription after first poll = %+v", sub)
+	}
+
+	var entries []models.FeedEntry
+	db.Order("id").Find(&entries)
+	if len(entries) != 2 || entries[0].GUID != "post-1" {
+		t.Fatalf("entries = %+v; want both, oldest first", entries)
+	}
+	for _, entry := range entries {
+		if entry.ShortID == "" {
+			t.Fatalf("entry %s was not captured", entry.GUID)
+		}
+		if original, _ := capturedURL(t, db, entry.ShortID); original != entry.Link {
+			t.Errorf("entry %s captured %s", entry.Link, original)
+		}
+	}
+
+	// Unchanged: the feed answers 304 and nothing is queued.
+	if err := poller.Poll(context.Background(), &sub); err != nil {
+		t.Fatal(err)
+	}
+	if server.notModified != 1 {
+		t.Errorf("second poll was not conditional (%d 304s)", server.notModified)
+	}
+
+	// One new post: only it is captured.
+	server.set(post(1), post(2), post(3))
+	if err := poller.Poll(context.Background(), &sub); err != nil {
+		t.Fatal(err)
+	}
+	var captures int64
+	db.Model(&models.Capture{}).Count(&captures)
+	if captures != 3 || sub.EntryCount != 3 {
+		t.Errorf("captures = %d, entries = %d after one new post; want 3 and 3", captures, sub.EntryCount)
+	}
+}
+
+func TestPollCapturesEnclosuresAsAudio(t *testing.T) {
+	db := newFeedTestDB(t)
+	server := &feedServer{}
+	server.set(episode(1))
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	poller := newTestPoller(db)
+	sub, _ := poller.Subscribe(ts.URL, 0, true)
+	if err := poller.Poll(context.Background(), &sub); err != nil {
+		t.Fatal(err)
+	}
+
+	var entry models.FeedEntry
+	if err := db.Preload("Enclosures").First(&entry).Error; err != nil {
+		t.Fatal(err)
+	}
+	if entry.ShortID == "" || len(entry.Enclosures) != 1 || entry.Enclosures[0].ShortID == "" {
+		t.Fatalf("entry = %+v", entry)
+	}
+	original, types := capturedURL(t, db, entry.Enclosures[0].ShortID)
+	if original != "https://cdn.pod.example/1.mp3" || len(types) != 1 || types[0] != utils.ArchiveTypeAudio {
+		t.Errorf("enclosure captured %s as %v, want the MP3 as audio", original, types)
+	}
+}
+
+func TestFirstPollCanMarkExistingEntriesSeen(t *testing.T) {
+	db := newFeedTestDB(t)
+	server := &feedServer{}
+	server.set(post(1), post(2))
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	poller := newTestPoller(db)
+	sub, _ := poller.Subscribe(ts.URL, 0, false)
+	if err := poller.Poll(context.Background(), &sub); err != nil {
+		t.Fatal(err)
+	}
+	var captures int64
+	db.Model(&models.Capture{}).Count(&captures)
+	if captures != 0 || sub.EntryCount != 2 {
+		t.Fatalf("captures = %d, entries = %d; existing entries should only be marked seen", captures, sub.EntryCount)
+	}
+
+	server.set(post(1), post(2), post(3))
+	if err := poller.Poll(context.Background(), &sub); err != nil {
+		t.Fatal(err)
+	}
+	var entry models.FeedEntry
+	db.Where("guid = ?", "post-3").First(&entry)
+	db.Model(&models.Capture{}).Count(&captures)
+	if captures != 1 || entry.ShortID == "" {
+		t.Errorf("captures = %d, new entry = %+v; want only the new post captured", captures, entry)
+	}
+}
+
+func TestPollRetriesEntriesThatCouldNotBeQueued(t *testing.T) {
+	db := newFeedTestDB(t)
+	server := &feedServer{}
+	server.set(post(1))
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	utils.SetArchiveTypeHealth(func(string) (string, bool) { return "playwright: failed to launch Chromium", true })
+	t.Cleanup(func() { utils.SetArchiveTypeHealth(nil) })
+
+	poller := newTestPoller(db)
+	sub, _ := poller.Subscribe(ts.URL, 0, true)
+	if err := poller.Poll(context.Background(), &sub); err != nil {
+		t.Fatal(err)
+	}
+	var entry models.FeedEntry
+	db.First(&entry)
+	if entry.ShortID != "" || !strings.Contains(entry.QueueError, "Chromium") {
+		t.Fatalf("entry = %+v; want the queue failure recorded", entry)
+	}
+
+	// Recovered; the feed itself has not changed and answers 304.
+	utils.SetArchiveTypeHealth(nil)
+	if err := poller.Poll(context.Background(), &sub); err != nil {
+		t.Fatal(err)
+	}
+	db.First(&entry, entry.ID)
+	if entry.ShortID == "" || entry.QueueError != "" || server.notModified != 1 {
+		t.Errorf("entry = %+v after recovery (%d 304s); want it captured from the stored row", entry, server.notModified)
+	}
+}
+
+func TestPollRefusesInternalURLs(t *testing.T) {
+	db := newFeedTestDB(t)
+	server := &feedServer{}
+	server.set(`<item><title>Metadata</title><link>http://169.254.169.254/latest/meta-data/</link><guid>imds</guid>` +
+		`<enclosure url="http://10.0.0.5/admin.mp3" type="audio/mpeg" length="100"/></item>`)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	poller := newTestPoller(db)
+	sub, _ := poller.Subscribe(ts.URL, 0, true)
+	if err := poller.Poll(context.Background(), &sub); err != nil {
+		t.Fatal(err)
+	}
+	var entry models.FeedEntry
+	db.Preload("Enclosures").First(&entry)
+	if entry.ShortID != "" || entry.Enclosures[0].ShortID != "" {
+		t.Errorf("entry = %+v; internal URLs were captured", entry)
+	}
+	if !strings.Contains(entry.QueueError, "169.254.169.254") || !strings.Contains(entry.QueueError, "10.0.0.5") {
+		t.Errorf("queue error = %q; want both refusals recorded", entry.QueueError)
+	}
+	var captures int64
+	db.Model(&models.Capture{}).Count(&captures)
+	if captures != 0 {
+		t.Errorf("%d captures created", captures)
+	}
+}
+
+func TestFeedFetchesRefuseInternalAddresses(t *testing.T) {
+	db := newFeedTestDB(t)
+	poller := newTestPoller(db)
+	if _, err := poller.Subscribe("http://169.254.169.254/latest/meta-data/", 0, true); err == nil {
+		t.Error("a link-local feed URL was subscribed")
+	}
+
+	// A feed that redirects inward is not followed.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://10.0.0.5/feed.xml", http.StatusFound)
+	}))
+	defer ts.Close()
+	sub, err := poller.Subscribe(ts.URL, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := poller.Poll(context.Background(), &sub); err == nil || !strings.Contains(err.Error(), "refusing redirect") {
+		t.Errorf("poll through an inward redirect = %v", err)
+	}
+
+	// A subscription whose host now fails the check is not fetched.
+	db.Model(&sub).Update("url", "http://10.0.0.5/feed.xml")
+	sub.URL = "http://10.0.0.5/feed.xml"
+	if err := poller.Poll(context.Background(), &sub); err == nil || !strings.Contains(err.Error(), "invalid feed URL") {
+		t.Errorf("poll of an internal feed = %v", err)
+	}
+}
+
+func TestPollRecordsFetchFailures(t *testing.T) {
+	db := newFeedTestDB(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<!DOCTYPE html><html><body>Moved to a new blog engine</body></html>`)
+	}))
+	defer ts.Close()
+
+	poller := newTestPoller(db)
+	sub, _ := poller.Subscribe(ts.URL, 0, false)
+	if err := poller.Poll(context.Background(), &sub); err == nil {
+		t.Fatal("an HTML page polled without error")
+	}
+	if sub.LastError == "" || sub.LastSuccessAt != nil || sub.LastPolledAt == nil {
+		t.Errorf("subscription = %+v; want the failure recorded and no success", sub)
+	}
+}
+
+func TestSubscribeValidates(t *testing.T) {
+	db := newFeedTestDB(t)
+	poller := newTestPoller(db)
+	if _, err := poller.Subscribe("ftp://example.com/feed", 0, true); err == nil {
+		t.Error("an ftp URL was accepted")
+	}
+	if _, err := poller.Subscribe("https://example.com/feed", MinInterval/2, true); err == nil {
+		t.Error("an interval under the minimum was accepted")
+	}
+	if _, err := poller.Subscribe("https://example.com/feed", 0, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := poller.Subscribe("https://example.com/feed", 0, true); err != ErrAlreadySubscribed {
+		t.Errorf("second subscription error = %v, want ErrAlreadySubscribed", err)
+	}
+}
+
+func TestDeleteAllowsResubscribing(t *testing.T) {
+	db := newFeedTestDB(t)
+	poller := newTestPoller(db)
+	sub, err := poller.Subscribe("https://example.com/feed", 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&models.FeedEntry{FeedSubscriptionID: sub.ID, GUID: "a", Enclosures: []models.FeedEnclosure{{URL: "https://example.com/a.mp3"}}})
+	if err := poller.Delete(sub.ID); err != nil {
+		t.Fatal(err)
+	}
+	var remaining int64
+	db.Unscoped().Model(&models.FeedEnclosure{}).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("%d enclosures left behind", remaining)
+	}
+	if _, err := poller.Subscribe("https://example.com/feed", 0, true); err != nil {
+		t.Errorf("resubscribing failed: %v", err)
+	}
+}
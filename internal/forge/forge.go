@@ -0,0 +1,472 @@
+// Package forge reads a project's public record from a code host's REST API:
+// repository metadata, issues and pull requests with their discussion,
+// releases and the README. GitHub, GitLab and Gitea (including Forgejo) are
+// supported, and all three are normalized into the same types so the
+// archiver and the viewer never need to know which host a project lived on.
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Kinds of forge, matching the values of utils.ForgeGitHub and friends.
+const (
+	GitHub = "github"
+	GitLab = "gitlab"
+	Gitea  = "gitea"
+)
+
+// Thread kinds. GitHub numbers issues and pull requests from one sequence;
+// GitLab does not, so a thread is only identified by kind and number.
+const (
+	ThreadIssue       = "issue"
+	ThreadPullRequest = "pull_request"
+)
+
+// Repository is the normalized metadata of a project.
+type Repository struct {
+	FullName      string   `json:"full_name"`
+	Description   string   `json:"description,omitempty"`
+	Homepage      string   `json:"homepage,omitempty"`
+	WebURL        string   `json:"web_url"`
+	CloneURL      string   `json:"clone_url,omitempty"`
+	DefaultBranch string   `json:"default_branch,omitempty"`
+	Language      string   `json:"language,omitempty"`
+	License       string   `json:"license,omitempty"`
+	Topics        []string `json:"topics,omitempty"`
+	Stars         int      `json:"stars"`
+	Forks         int      `json:"forks"`
+	OpenIssues    int      `json:"open_issues"`
+	Archived      bool     `json:"archived,omitempty"`
+	Fork          bool     `json:"fork,omitempty"`
+	HasWiki       bool     `json:"has_wiki"`
+	CreatedAt     string   `json:"created_at,omitempty"`
+	UpdatedAt     string   `json:"updated_at,omitempty"`
+	PushedAt      string   `json:"pushed_at,omitempty"`
+}
+
+// Thread is an issue or pull request and its discussion.
+type Thread struct {
+	Kind      string   `json:"kind"`
+	Number    int      `json:"number"`
+	Title     string   `json:"title"`
+	State     string   `json:"state"`
+	Author    string   `json:"author,omitempty"`
+	URL       string   `json:"url,omitempty"`
+	Body      string   `json:"body,omitempty"`
+	Labels    []string `json:"labels,omitempty"`
+	CreatedAt string   `json:"created_at,omitempty"`
+	UpdatedAt string   `json:"updated_at,omitempty"`
+	ClosedAt  string   `json:"closed_at,omitempty"`
+	MergedAt  string   `json:"merged_at,omitempty"`
+	// CommentCount is what the host reported; Comments is what was fetched.
+	CommentCount int       `json:"comment_count"`
+	Comments     []Comment `json:"comments"`
+}
+
+// Comment is one post in a thread. A review comment on a pull request names
+// the file it was left on.
+type Comment struct {
+	Author    string `json:"author,omitempty"`
+	Body      string `json:"body"`
+	CreatedAt string `json:"created_at,omitempty"`
+	URL       string `json:"url,omitempty"`
+	Path      string `json:"path,omitempty"`
+}
+
+// Release is a tagged release and its downloadable assets.
+type Release struct {
+	Tag         string  `json:"tag"`
+	Name        string  `json:"name,omitempty"`
+	Body        string  `json:"body,omitempty"`
+	Author      string  `json:"author,omitempty"`
+	URL         string  `json:"url,omitempty"`
+	Draft       bool    `json:"draft,omitempty"`
+	Prerelease  bool    `json:"prerelease,omitempty"`
+	CreatedAt   string  `json:"created_at,omitempty"`
+	PublishedAt string  `json:"published_at,omitempty"`
+	Assets      []Asset `json:"assets"`
+}
+
+// Asset is a file attached to a release. Size is zero where the host does not
+// say (GitLab's asset links).
+type Asset struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+}
+
+// Readme is the project's README as stored, and as the host renders it where
+// the host will.
+type Readme struct {
+	Name string
+	Raw  []byte
+	HTML []byte
+}
+
+// Project names a project on a forge. See utils.ParseForgeURL.
+type Project struct {
+	Kind   string
+	Scheme string
+	Host   string
+	Path   string
+}
+
+// WebURL is the project's home page.
+func (p Project) WebURL() string {
+	return p.Scheme + "://" + p.Host + "/" + p.Path
+}
+
+// WikiCloneURL is where all three hosts serve a project's wiki as a git
+// repository.
+func (p Project) WikiCloneURL() string {
+	return p.WebURL() + ".wiki.git"
+}
+
+// apiBase is the root of the host's REST API. A GitHub host other than
+// github.com is GitHub Enterprise, which serves the API under /api/v3.
+func (p Project) apiBase() string {
+	switch p.Kind {
+	case GitHub:
+		if p.Host == "github.com" {
+			return "https://api.github.com"
+		}
+		return p.Scheme + "://" + p.Host + "/api/v3"
+	case GitLab:
+		return p.Scheme + "://" + p.Host + "/api/v4"
+	default:
+		return p.Scheme + "://" + p.Host + "/api/v1"
+	}
+}
+
+// ErrNotFound is returned when the host does not know the project, or hides
+// it: private projects answer 404 to anonymous callers on every host.
+var ErrNotFound = errors.New("forge: project not found")
+
+// HTTPError is a non-success answer from the host's API.
+type HTTPError struct {
+	Status int
+	URL    string
+	// RateLimited means the host refused for quota rather than for the
+	// request itself. A retry after Reset will succeed.
+	RateLimited bool
+	Reset       time.Time
+}
+
+func (e *HTTPError) Error() string {
+	if e.RateLimited {
+		if !e.Reset.IsZero() {
+			return fmt.Sprintf("forge: rate limited by %s until %s", hostOf(e.URL), e.Reset.UTC().Format(time.RFC3339))
+		}
+		return fmt.Sprintf("forge: rate limited by %s", hostOf(e.URL))
+	}
+	return fmt.Sprintf("forge: %s answered %d", hostOf(e.URL), e.Status)
+}
+
+// Client reads one project's record.
+type Client struct {
+	project Project
+	http    *http.Client
+	token   string
+	api     api
+	// checkURL, when set, vets every asset URL and redirect before it is
+	// fetched.
+	checkURL func(rawURL string) error
+}
+
+// api is what differs between hosts.
+type api interface {
+	repository(ctx context.Context) (*Repository, json.RawMessage, error)
+	threads(ctx context.Context, limit int) ([]Thread, bool, error)
+	comments(ctx context.Context, thread *Thread) ([]Comment, error)
+	releases(ctx context.Context) ([]Release, error)
+	readme(ctx context.Context, repo *Repository) (*Readme, error)
+}
+
+// New returns a client for project. httpClient may be nil, for a client with
+// no overall timeout: the caller's context bounds every request, and a
+// release asset can take far longer than any API call. token may be empty for
+// anonymous access.
+func New(project Project, httpClient *http.Client, token string) (*Client, error) {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+	c := &Client{project: project, http: httpClient, token: token}
+	switch project.Kind {
+	case GitHub:
+		c.api = &githubAPI{c: c}
+	case GitLab:
+		c.api = &gitlabAPI{c: c, id: url.PathEscape(project.Path)}
+	case Gitea:
+		c.api = &giteaAPI{c: c}
+	default:
+		return nil, fmt.Errorf("forge: unknown kind %q", project.Kind)
+	}
+	return c, nil
+}
+
+// CheckURLs makes Download refuse an asset URL, or any redirect it leads to,
+// that check rejects. Asset links are chosen by the project, so the archiver
+// passes its SSRF check here.
+func (c *Client) CheckURLs(check func(rawURL string) error) {
+	c.checkURL = check
+}
+
+// Repository returns the normalized metadata and the host's own record.
+func (c *Client) Repository(ctx context.Context) (*Repository, json.RawMessage, error) {
+	return c.api.repository(ctx)
+}
+
+// Threads returns up to limit issues and pull requests, newest first, without
+// their comments. The bool reports whether the project has more than limit.
+func (c *Client) Threads(ctx context.Context, limit int) ([]Thread, bool, error) {
+	return c.api.threads(ctx, limit)
+}
+
+// Comments returns a thread's discussion in the order it was posted. An issue
+// the host reports no comments on costs no request; a pull request always
+// does, since GitHub's count leaves out review comments on the diff.
+func (c *Client) Comments(ctx context.Context, thread *Thread) ([]Comment, error) {
+	if thread.CommentCount == 0 && thread.Kind != ThreadPullRequest {
+		return nil, nil
+	}
+	return c.api.comments(ctx, thread)
+}
+
+// Releases returns the project's releases, newest first.
+func (c *Client) Releases(ctx context.Context) ([]Release, error) {
+	return c.api.releases(ctx)
+}
+
+// Readme returns the README on the default branch, or nil when the project
+// has none. repo must come from this client's Repository.
+func (c *Client) Readme(ctx context.Context, repo *Repository) (*Readme, error) {
+	return c.api.readme(ctx, repo)
+}
+
+// Download streams a release asset into w, refusing to write more than limit
+// bytes. Asset URLs may point off the API host (GitHub redirects to its CDN,
+// GitLab's direct asset URLs redirect wherever the project's link says), so
+// the token is only sent to the project's own host, on every hop.
+func (c *Client) Download(ctx context.Context, assetURL string, w io.Writer, limit int64) (int64, error) {
+	if err := c.vet(assetURL); err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, assetURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if c.project.Kind == GitHub {
+		req.Header.Set("Accept", "application/octet-stream")
+	}
+	c.authorize(req)
+	// net/http carries custom headers such as PRIVATE-TOKEN across hosts, so
+	// each hop drops the credentials and earns them again.
+	client := *c.http
+	client.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("forge: stopped after %d redirects", maxRedirects)
+		}
+		if err := c.vet(next.URL.String()); err != nil {
+			return err
+		}
+		next.Header.Del("Authorization")
+		next.Header.Del("PRIVATE-TOKEN")
+		c.authorize(next)
+		return nil
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, statusError(resp)
+	}
+	n, err := io.Copy(w, io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return n, err
+	}
+	if n > limit {
+		return n, fmt.Errorf("asset exceeds %d bytes", limit)
+	}
+	return n, nil
+}
+
+const userAgent = "Arker project archiver"
+
+// maxRedirects matches net/http's own limit.
+const maxRedirects = 10
+
+// vet applies the URL check, if there is one.
+func (c *Client) vet(rawURL string) error {
+	if c.checkURL == nil {
+		return nil
+	}
+	if err := c.checkURL(rawURL); err != nil {
+		return fmt.Errorf("forge: refusing %s: %w", hostOf(rawURL), err)
+	}
+	return nil
+}
+
+// maxAPIResponse bounds one API response. The largest are pages of 100
+// issues with long bodies.
+const maxAPIResponse = 32 << 20
+
+// authorize adds the token to requests for the project's own host and its
+// API host, and to nothing else.
+func (c *Client) authorize(req *http.Request) {
+	if c.token == "" {
+		return
+	}
+	host := strings.ToLower(req.URL.Host)
+	apiHost := hostOf(c.project.apiBase())
+	if host != strings.ToLower(c.project.Host) && host != apiHost {
+		return
+	}
+	switch c.project.Kind {
+	case GitLab:
+		req.Header.Set("PRIVATE-TOKEN", c.token)
+	case Gitea:
+		req.Header.Set("Authorization", "token "+c.token)
+	default:
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+}
+
+// do sends one API request and returns the body and the URL of the next page,
+// if the host says there is one.
+func (c *Client) do(ctx context.Context, method, rawURL, accept string, body io.Reader) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if accept == "" {
+		accept = "application/json"
+	}
+	req.Header.Set("Accept", accept)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c.authorize(req)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, "", statusError(resp)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAPIResponse+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxAPIResponse {
+		return nil, "", fmt.Errorf("forge: response from %s exceeds %d bytes", hostOf(rawURL), maxAPIResponse)
+	}
+	return data, nextPage(resp.Header.Get("Link")), nil
+}
+
+// getJSON fetches one document into v.
+func (c *Client) getJSON(ctx context.Context, rawURL string, v any) (json.RawMessage, error) {
+	data, _, err := c.do(ctx, http.MethodGet, rawURL, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, fmt.Errorf("forge: decoding %s: %w", hostOf(rawURL), err)
+	}
+	return data, nil
+}
+
+// paginate follows Link rel="next" from rawURL, which all three hosts send,
+// calling page with each decoded page until it returns false or the pages
+// run out.
+func paginate[T any](ctx context.Context, c *Client, rawURL string, page func([]T) bool) error {
+	for rawURL != "" {
+		data, next, err := c.do(ctx, http.MethodGet, rawURL, "", nil)
+		if err != nil {
+			return err
+		}
+		var items []T
+		if err := json.Unmarshal(data, &items); err != nil {
+			return fmt.Errorf("forge: decoding %s: %w", hostOf(rawURL), err)
+		}
+		if len(items) == 0 || !page(items) {
+			return nil
+		}
+		rawURL = next
+	}
+	return nil
+}
+
+var linkNextPattern = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?next"?`)
+
+func nextPage(link string) string {
+	if m := linkNextPattern.FindStringSubmatch(link); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// statusError turns a failed response into an HTTPError, recognizing the
+// hosts' rate-limit answers: GitHub's 403 with no quota left, and 429
+// everywhere.
+func statusError(resp *http.Response) error {
+	e := &HTTPError{Status: resp.StatusCode, URL: resp.Request.URL.String()}
+	if resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-RateLimit-Remaining") == "0") {
+		e.RateLimited = true
+		for _, header := range []string{"X-RateLimit-Reset", "RateLimit-Reset"} {
+			var reset int64
+			if _, err := fmt.Sscan(resp.Header.Get(header), &reset); err == nil && reset > 0 {
+				e.Reset = time.Unix(reset, 0)
+				break
+			}
+		}
+	}
+	return e
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return strings.ToLower(u.Host)
+}
+
+// user is a user as the hosts embed one: GitHub and Gitea name it by login,
+// GitLab by username.
+type user struct {
+	Login    string `json:"login"`
+	Username string `json:"username"`
+}
+
+func (u *user) name() string {
+	if u == nil {
+		return ""
+	}
+	if u.Login != "" {
+		return u.Login
+	}
+	return u.Username
+}
+
+// readmeNames are tried in order where the host has no README endpoint.
+var readmeNames = []string{"README.md", "README.markdown", "README.rst", "README.txt", "README", "readme.md"}
@@ -0,0 +1,330 @@
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeForge serves canned API answers keyed by method and request URI, and
+// records the headers and body of each request.
+type fakeForge struct {
+	server    *httptest.Server
+	responses map[string]string
+	headers   map[string]http.Header
+	bodies    map[string]string
+}
+
+func newFakeForge(t *testing.T, responses map[string]string) *fakeForge {
+	t.Helper()
+	f := &fakeForge{responses: responses, headers: map[string]http.Header{}, bodies: map[string]string{}}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Method + " " + r.URL.RequestURI()
+		f.headers[key] = r.Header.Clone()
+		body, _ := io.ReadAll(r.Body)
+		f.bodies[key] = string(body)
+		answer, ok := f.responses[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		answer = strings.ReplaceAll(answer, "{base}", f.server.URL)
+		// A first line of "next: <uri>" advertises a following page, as the
+		// real hosts do with a Link header.
+		if rest, found := strings.CutPrefix(answer, "next: "); found {
+			next, page, _ := strings.Cut(rest, "\n")
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s>; rel="next", <%s/last>; rel="last"`, f.server.URL, next, f.server.URL))
+			answer = page
+		}
+		w.Write([]byte(answer))
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeForge) project(kind, path string) Project {
+	return Project{Kind: kind, Scheme: "http", Host: strings.TrimPrefix(f.server.URL, "http://"), Path: path}
+}
+
+func TestGitHubProject(t *testing.T) {
+	f := newFakeForge(t, map[string]string{
+		"GET /api/v3/repos/octo/lamp": `{"full_name":"octo/lamp","description":"A lamp","html_url":"{base}/octo/lamp",
+			"default_branch":"main","stargazers_count":12,"forks_count":3,"open_issues_count":2,"has_wiki":true,
+			"topics":["hardware"],"license":{"spdx_id":"MIT","name":"MIT License"}}`,
+		"GET /api/v3/repos/octo/lamp/issues?state=all&sort=created&direction=desc&per_page=100": "next: /api/v3/repos/octo/lamp/issues?page=2\n" +
+			`[{"number":3,"title":"Fix the switch","state":"closed","user":{"login":"ana"},"body":"It clicks.","comments":0,
+			   "labels":[{"name":"bug"}],"pull_request":{"merged_at":"2024-02-02T00:00:00Z"}},
+			  {"number":2,"title":"Bulb flickers","state":"open","user":{"login":"ben"},"comments":1}]`,
+		"GET /api/v3/repos/octo/lamp/issues?page=2":                  `[{"number":1,"title":"First","state":"closed","user":{"login":"ana"},"comments":0}]`,
+		"GET /api/v3/repos/octo/lamp/issues/2/comments?per_page=100": `[{"user":{"login":"ana"},"body":"Same here","created_at":"2024-01-05T00:00:00Z"}]`,
+		"GET /api/v3/repos/octo/lamp/issues/3/comments?per_page=100": `[]`,
+		"GET /api/v3/repos/octo/lamp/pulls/3/comments?per_page=100":  `[{"user":{"login":"ben"},"body":"nit","path":"switch.c","created_at":"2024-02-01T00:00:00Z"}]`,
+		"GET /api/v3/repos/octo/lamp/releases?per_page=100": `[{"tag_name":"v1.0","name":"One","author":{"login":"ana"},
+			"assets":[{"name":"lamp.zip","browser_download_url":"{base}/dl/lamp.zip","content_type":"application/zip","size":4}]}]`,
+		"GET /api/v3/repos/octo/lamp/readme": `{"name":"README.md","encoding":"base64","content":"IyBMYW1w\n"}`,
+		"GET /dl/lamp.zip":                   "PK..",
+	})
+	c, err := New(f.project(GitHub, "octo/lamp"), nil, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	repo, raw, err := c.Repository(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.FullName != "octo/lamp" || repo.License != "MIT" || repo.Stars != 12 || !repo.HasWiki || len(raw) == 0 {
+		t.Errorf("repository = %+v", repo)
+	}
+	if got := f.headers["GET /api/v3/repos/octo/lamp"].Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Authorization = %q", got)
+	}
+
+	threads, truncated, err := c.Threads(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(threads) != 3 || truncated {
+		t.Fatalf("threads = %+v, truncated %v; want all three pages followed", threads, truncated)
+	}
+	if threads[0].Kind != ThreadPullRequest || threads[0].MergedAt == "" || threads[0].Labels[0] != "bug" {
+		t.Errorf("pull request = %+v", threads[0])
+	}
+	if threads[1].Kind != ThreadIssue || threads[1].Author != "ben" {
+		t.Errorf("issue = %+v", threads[1])
+	}
+	if limited, truncated, _ := c.Threads(ctx, 2); len(limited) != 2 || !truncated {
+		t.Errorf("limited threads = %d, truncated %v", len(limited), truncated)
+	}
+
+	comments, err := c.Comments(ctx, &threads[1])
+	if err != nil || len(comments) != 1 || comments[0].Author != "ana" {
+		t.Errorf("issue comments = %+v, %v", comments, err)
+	}
+	// The pull request reports no conversation, but its review comment on
+	// the diff is still fetched.
+	review, err := c.Comments(ctx, &threads[0])
+	if err != nil || len(review) != 1 || review[0].Path != "switch.c" {
+		t.Errorf("review comments = %+v, %v", review, err)
+	}
+	if none, err := c.Comments(ctx, &threads[2]); err != nil || none != nil {
+		t.Errorf("comments of an issue with none = %+v, %v", none, err)
+	}
+
+	releases, err := c.Releases(ctx)
+	if err != nil || len(releases) != 1 || releases[0].Assets[0].Size != 4 {
+		t.Fatalf("releases = %+v, %v", releases, err)
+	}
+	var asset bytes.Buffer
+	if n, err := c.Download(ctx, releases[0].Assets[0].URL, &asset, 10); err != nil || n != 4 || asset.String() != "PK.." {
+		t.Errorf("download = %d %q, %v", n, asset.String(), err)
+	}
+	if _, err := c.Download(ctx, releases[0].Assets[0].URL, &bytes.Buffer{}, 3); err == nil {
+		t.Error("download over the limit succeeded")
+	}
+
+	readme, err := c.Readme(ctx, repo)
+	if err != nil || readme == nil || readme.Name != "README.md" || string(readme.Raw) != "# Lamp" {
+		t.Errorf("readme = %+v, %v", readme, err)
+	}
+}
+
+func TestGitLabProject(t *testing.T) {
+	f := newFakeForge(t, map[string]string{
+		"GET /api/v4/projects/tools%2Fcli%2Fwidget?license=true": `{"path_with_namespace":"tools/cli/widget","web_url":"{base}/tools/cli/widget",
+			"default_branch":"main","star_count":5,"wiki_enabled":true,"tag_list":["cli"],"license":{"nickname":"GNU GPLv3"},
+			"readme_url":"{base}/tools/cli/widget/-/blob/main/docs/README.md"}`,
+		"GET /api/v4/projects/tools%2Fcli%2Fwidget/issues?scope=all&order_by=created_at&sort=desc&per_page=100": `[{"iid":4,"title":"Crash",
+			"state":"opened","author":{"username":"cy"},"labels":["bug"],"created_at":"2024-03-01T00:00:00Z","user_notes_count":2}]`,
+		"GET /api/v4/projects/tools%2Fcli%2Fwidget/merge_requests?scope=all&state=all&order_by=created_at&sort=desc&per_page=100": `[{"iid":4,
+			"title":"Fix crash","state":"merged","author":{"username":"dee"},"created_at":"2024-03-02T00:00:00Z","merged_at":"2024-03-03T00:00:00Z"}]`,
+		"GET /api/v4/projects/tools%2Fcli%2Fwidget/issues/4/notes?sort=asc&order_by=created_at&per_page=100": `[{"author":{"username":"dee"},"body":"Looking",
+			"created_at":"2024-03-01T01:00:00Z"},{"author":{"username":"bot"},"body":"changed the description","system":true}]`,
+		"GET /api/v4/projects/tools%2Fcli%2Fwidget/releases?per_page=100": `[{"tag_name":"v2","name":"Two","upcoming_release":true,
+			"assets":{"links":[{"name":"widget.tar.gz","url":"{base}/a","direct_asset_url":"{base}/direct"}]}}]`,
+		"GET /api/v4/projects/tools%2Fcli%2Fwidget/repository/files/docs%2FREADME.md/raw?ref=main": "# Widget",
+		"POST /api/v4/markdown": `{"html":"<h1>Widget</h1>"}`,
+	})
+	c, _ := New(f.project(GitLab, "tools/cli/widget"), nil, "tok")
+	ctx := context.Background()
+
+	repo, _, err := c.Repository(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.FullName != "tools/cli/widget" || repo.License != "GNU GPLv3" || repo.Topics[0] != "cli" || !repo.HasWiki {
+		t.Errorf("repository = %+v", repo)
+	}
+	if got := f.headers["GET /api/v4/projects/tools%2Fcli%2Fwidget?license=true"].Get("PRIVATE-TOKEN"); got != "tok" {
+		t.Errorf("PRIVATE-TOKEN = %q", got)
+	}
+
+	threads, _, err := c.Threads(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Issue 4 and merge request 4 are different threads, merged newest first.
+	if len(threads) != 2 || threads[0].Kind != ThreadPullRequest || threads[1].Kind != ThreadIssue || threads[1].Number != 4 {
+		t.Fatalf("threads = %+v", threads)
+	}
+	notes, err := c.Comments(ctx, &threads[1])
+	if err != nil || len(notes) != 1 || notes[0].Body != "Looking" {
+		t.Errorf("notes = %+v, %v; system notes must be dropped", notes, err)
+	}
+
+	releases, err := c.Releases(ctx)
+	if err != nil || len(releases) != 1 || !releases[0].Prerelease || !strings.HasSuffix(releases[0].Assets[0].URL, "/direct") {
+		t.Errorf("releases = %+v, %v", releases, err)
+	}
+
+	readme, err := c.Readme(ctx, repo)
+	if err != nil || readme == nil || readme.Name != "README.md" || string(readme.HTML) != "<h1>Widget</h1>" {
+		t.Errorf("readme = %+v, %v", readme, err)
+	}
+	var rendered map[string]any
+	json.Unmarshal([]byte(f.bodies["POST /api/v4/markdown"]), &rendered)
+	if rendered["text"] != "# Widget" || rendered["project"] != "tools/cli/widget" {
+		t.Errorf("markdown request = %v; relative links need the project", rendered)
+	}
+}
+
+func TestGiteaProject(t *testing.T) {
+	f := newFakeForge(t, map[string]string{
+		"GET /api/v1/repos/river/boat": `{"full_name":"river/boat","website":"https://boat.example","html_url":"{base}/river/boat",
+			"default_branch":"trunk","stars_count":7,"has_wiki":false,"licenses":["Apache-2.0"]}`,
+		"GET /api/v1/repos/river/boat/issues?state=all&limit=50": `[{"number":9,"title":"Leak","state":"open","user":{"login":"eve"},"comments":1},
+			{"number":8,"title":"Paint","state":"closed","user":{"login":"eve"},"pull_request":{"merged_at":null}}]`,
+		"GET /api/v1/repos/river/boat/issues/9/comments":       `[{"user":{"login":"fin"},"body":"Bail faster"}]`,
+		"GET /api/v1/repos/river/boat/issues/8/comments":       `[]`,
+		"GET /api/v1/repos/river/boat/releases?limit=50":       `[{"tag_name":"v0.1","assets":[{"name":"boat.bin","browser_download_url":"{base}/b","size":2}]}]`,
+		"GET /api/v1/repos/river/boat/raw/README.md?ref=trunk": "# Boat",
+		"POST /api/v1/markdown":                                "<h1>Boat</h1>",
+	})
+	c, _ := New(f.project(Gitea, "river/boat"), nil, "")
+	ctx := context.Background()
+
+	repo, _, err := c.Repository(ctx)
+	if err != nil || repo.Homepage != "https://boat.example" || repo.License != "Apache-2.0" || repo.HasWiki {
+		t.Fatalf("repository = %+v, %v", repo, err)
+	}
+	if got := f.headers["GET /api/v1/repos/river/boat"].Get("Authorization"); got != "" {
+		t.Errorf("anonymous request sent Authorization %q", got)
+	}
+	threads, _, err := c.Threads(ctx, 10)
+	if err != nil || len(threads) != 2 || threads[1].Kind != ThreadPullRequest {
+		t.Fatalf("threads = %+v, %v", threads, err)
+	}
+	if comments, err := c.Comments(ctx, &threads[0]); err != nil || len(comments) != 1 || comments[0].Author != "fin" {
+		t.Errorf("comments = %+v, %v", comments, err)
+	}
+	if releases, err := c.Releases(ctx); err != nil || releases[0].Assets[0].Name != "boat.bin" {
+		t.Errorf("releases = %+v, %v", releases, err)
+	}
+	readme, err := c.Readme(ctx, repo)
+	if err != nil || readme == nil || string(readme.Raw) != "# Boat" || string(readme.HTML) != "<h1>Boat</h1>" {
+		t.Errorf("readme = %+v, %v", readme, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/gone") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", "1893456000")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	gone, _ := New(Project{Kind: GitHub, Scheme: "http", Host: host, Path: "a/gone"}, nil, "")
+	if _, _, err := gone.Repository(context.Background()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing project error = %v, want ErrNotFound", err)
+	}
+
+	limited, _ := New(Project{Kind: GitHub, Scheme: "http", Host: host, Path: "a/b"}, nil, "")
+	_, _, err := limited.Repository(context.Background())
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || !httpErr.RateLimited || httpErr.Reset.Unix() != 1893456000 {
+		t.Errorf("rate limit error = %#v", err)
+	}
+}
+
+// The token belongs to the forge. An asset served from another host (GitHub
+// redirects downloads to its CDN) must not receive it.
+func TestTokenStaysOnForgeHost(t *testing.T) {
+	var cdnAuth string
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdnAuth = r.Header.Get("Authorization")
+		w.Write([]byte("data"))
+	}))
+	defer cdn.Close()
+	f := newFakeForge(t, map[string]string{})
+	c, _ := New(f.project(GitHub, "a/b"), nil, "secret")
+	if _, err := c.Download(context.Background(), cdn.URL+"/asset", &bytes.Buffer{}, 100); err != nil {
+		t.Fatal(err)
+	}
+	if cdnAuth != "" {
+		t.Errorf("CDN received Authorization %q", cdnAuth)
+	}
+}
+
+// A GitLab direct asset URL redirects to wherever the project's link points.
+// PRIVATE-TOKEN is not a header net/http strips on its own, so the client must,
+// and the URL check applies to each hop.
+func TestTokenNotForwardedOnRedirect(t *testing.T) {
+	var elsewhereToken string
+	elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		elsewhereToken = r.Header.Get("PRIVATE-TOKEN")
+		w.Write([]byte("data"))
+	}))
+	defer elsewhere.Close()
+	var forgeToken string
+	forgeHost := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forgeToken = r.Header.Get("PRIVATE-TOKEN")
+		http.Redirect(w, r, elsewhere.URL+"/payload", http.StatusFound)
+	}))
+	defer forgeHost.Close()
+	project := Project{Kind: GitLab, Scheme: "http", Host: strings.TrimPrefix(forgeHost.URL, "http://"), Path: "a/b"}
+	assetURL := forgeHost.URL + "/a/b/-/releases/v1/downloads/tool"
+
+	c, _ := New(project, nil, "secret")
+	var out bytes.Buffer
+	if _, err := c.Download(context.Background(), assetURL, &out, 100); err != nil {
+		t.Fatal(err)
+	}
+	if forgeToken != "secret" {
+		t.Errorf("forge received PRIVATE-TOKEN %q", forgeToken)
+	}
+	if elsewhereToken != "" || out.String() != "data" {
+		t.Errorf("redirect target received PRIVATE-TOKEN %q", elsewhereToken)
+	}
+
+	elsewhereHost := strings.TrimPrefix(elsewhere.URL, "http://")
+	c.CheckURLs(func(rawURL string) error {
+		if strings.Contains(rawURL, elsewhereHost) {
+			return errors.New("internal address")
+		}
+		return nil
+	})
+	elsewhereToken = "unset"
+	if _, err := c.Download(context.Background(), assetURL, &bytes.Buffer{}, 100); err == nil || !strings.Contains(err.Error(), "internal address") {
+		t.Errorf("redirect to a refused host: err = %v", err)
+	}
+	if _, err := c.Download(context.Background(), elsewhere.URL+"/payload", &bytes.Buffer{}, 100); err == nil {
+		t.Error("downloading a refused asset URL succeeded")
+	}
+	if elsewhereToken != "unset" {
+		t.Error("a refused host was contacted")
+	}
+}
@@ -0,0 +1,196 @@
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// giteaAPI speaks the Gitea API, v1, which Forgejo (and so Codeberg) serves
+// unchanged.
+type giteaAPI struct {
+	c *Client
+}
+
+func (g *giteaAPI) repoURL(suffix string) string {
+	return g.c.project.apiBase() + "/repos/" + g.c.project.Path + suffix
+}
+
+func (g *giteaAPI) repository(ctx context.Context) (*Repository, json.RawMessage, error) {
+	var r struct {
+		FullName      string   `json:"full_name"`
+		Description   string   `json:"description"`
+		Website       string   `json:"website"`
+		HTMLURL       string   `json:"html_url"`
+		CloneURL      string   `json:"clone_url"`
+		DefaultBranch string   `json:"default_branch"`
+		Language      string   `json:"language"`
+		Topics        []string `json:"topics"`
+		Licenses      []string `json:"licenses"`
+		Stars         int      `json:"stars_count"`
+		Forks         int      `json:"forks_count"`
+		OpenIssues    int      `json:"open_issues_count"`
+		Archived      bool     `json:"archived"`
+		Fork          bool     `json:"fork"`
+		HasWiki       bool     `json:"has_wiki"`
+		CreatedAt     string   `json:"created_at"`
+		UpdatedAt     string   `json:"updated_at"`
+	}
+	raw, err := g.c.getJSON(ctx, g.repoURL(""), &r)
+	if err != nil {
+		return nil, nil, err
+	}
+	repo := &Repository{
+		FullName: r.FullName, Description: r.Description, Homepage: r.Website,
+		WebURL: r.HTMLURL, CloneURL: r.CloneURL, DefaultBranch: r.DefaultBranch,
+		Language: r.Language, Topics: r.Topics, Stars: r.Stars, Forks: r.Forks,
+		OpenIssues: r.OpenIssues, Archived: r.Archived, Fork: r.Fork, HasWiki: r.HasWiki,
+		CreatedAt: r.CreatedAt, UpdatedAt: r.UpdatedAt,
+	}
+	if len(r.Licenses) > 0 {
+		repo.License = strings.Join(r.Licenses, ", ")
+	}
+	return repo, raw, nil
+}
+
+func (g *giteaAPI) threads(ctx context.Context, limit int) ([]Thread, bool, error) {
+	type giteaIssue struct {
+		Number    int    `json:"number"`
+		Title     string `json:"title"`
+		State     string `json:"state"`
+		User      *user  `json:"user"`
+		HTMLURL   string `json:"html_url"`
+		Body      string `json:"body"`
+		CreatedAt string `json:"created_at"`
+		UpdatedAt string `json:"updated_at"`
+		ClosedAt  string `json:"closed_at"`
+		Comments  int    `json:"comments"`
+		Labels    []struct {
+			Name string `json:"name"`
+		} `json:"labels"`
+		PullRequest *struct {
+			MergedAt string `json:"merged_at"`
+		} `json:"pull_request"`
+	}
+	var out []Thread
+	truncated := false
+	// Without a type filter the list holds pull requests too, newest first.
+	err := paginate(ctx, g.c, g.repoURL("/issues?state=all&limit=50"), func(page []giteaIssue) bool {
+		for _, issue := range page {
+			if len(out) == limit {
+				truncated = true
+				return false
+			}
+			t := Thread{
+				Kind: ThreadIssue, Number: issue.Number, Title: issue.Title, State: issue.State,
+				Author: issue.User.name(), URL: issue.HTMLURL, Body: issue.Body,
+				CreatedAt: issue.CreatedAt, UpdatedAt: issue.UpdatedAt, ClosedAt: issue.ClosedAt,
+				CommentCount: issue.Comments,
+			}
+			if issue.PullRequest != nil {
+				t.Kind = ThreadPullRequest
+				t.MergedAt = issue.PullRequest.MergedAt
+			}
+			for _, label := range issue.Labels {
+				t.Labels = append(t.Labels, label.Name)
+			}
+			out = append(out, t)
+		}
+		return true
+	})
+	return out, truncated, err
+}
+
+func (g *giteaAPI) comments(ctx context.Context, thread *Thread) ([]Comment, error) {
+	// Not paginated in Gitea: one call returns the whole conversation.
+	var page []struct {
+		User      *user  `json:"user"`
+		Body      string `json:"body"`
+		CreatedAt string `json:"created_at"`
+		HTMLURL   string `json:"html_url"`
+	}
+	if _, err := g.c.getJSON(ctx, g.repoURL(fmt.Sprintf("/issues/%d/comments", thread.Number)), &page); err != nil {
+		return nil, err
+	}
+	out := make([]Comment, 0, len(page))
+	for _, c := range page {
+		out = append(out, Comment{Author: c.User.name(), Body: c.Body, CreatedAt: c.CreatedAt, URL: c.HTMLURL})
+	}
+	return out, nil
+}
+
+func (g *giteaAPI) releases(ctx context.Context) ([]Release, error) {
+	type giteaRelease struct {
+		TagName     string `json:"tag_name"`
+		Name        string `json:"name"`
+		Body        string `json:"body"`
+		Author      *user  `json:"author"`
+		HTMLURL     string `json:"html_url"`
+		Draft       bool   `json:"draft"`
+		Prerelease  bool   `json:"prerelease"`
+		CreatedAt   string `json:"created_at"`
+		PublishedAt string `json:"published_at"`
+		Assets      []struct {
+			Name string `json:"name"`
+			URL  string `json:"browser_download_url"`
+			Size int64  `json:"size"`
+		} `json:"assets"`
+	}
+	var out []Release
+	err := paginate(ctx, g.c, g.repoURL("/releases?limit=50"), func(page []giteaRelease) bool {
+		for _, r := range page {
+			release := Release{
+				Tag: r.TagName, Name: r.Name, Body: r.Body, Author: r.Author.name(), URL: r.HTMLURL,
+				Draft: r.Draft, Prerelease: r.Prerelease, CreatedAt: r.CreatedAt, PublishedAt: r.PublishedAt,
+				Assets: []Asset{},
+			}
+			for _, a := range r.Assets {
+				release.Assets = append(release.Assets, Asset{Name: a.Name, URL: a.URL, Size: a.Size})
+			}
+			out = append(out, release)
+		}
+		return true
+	})
+	return out, err
+}
+
+// readme tries the usual names on the default branch, since Gitea has no
+// README endpoint, and renders Markdown with the instance's own renderer.
+func (g *giteaAPI) readme(ctx context.Context, repo *Repository) (*Readme, error) {
+	for _, name := range readmeNames {
+		rawURL := g.repoURL("/raw/" + url.PathEscape(name))
+		if repo.DefaultBranch != "" {
+			rawURL += "?ref=" + url.QueryEscape(repo.DefaultBranch)
+		}
+		raw, _, err := g.c.do(ctx, http.MethodGet, rawURL, "*/*", nil)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		readme := &Readme{Name: name, Raw: raw}
+		if isMarkdownName(name) {
+			body, _ := json.Marshal(map[string]any{"Text": string(raw), "Mode": "gfm", "Context": g.c.project.WebURL()})
+			if html, _, err := g.c.do(ctx, http.MethodPost, g.c.project.apiBase()+"/markdown", "text/html", bytes.NewReader(body)); err == nil {
+				readme.HTML = html
+			}
+		}
+		return readme, nil
+	}
+	return nil, nil
+}
+
+func isMarkdownName(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md", ".markdown":
+		return true
+	}
+	return false
+}
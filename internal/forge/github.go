@@ -0,0 +1,222 @@
+package forge
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// githubAPI speaks the GitHub REST API, v3.
+type githubAPI struct {
+	c *Client
+}
+
+func (g *githubAPI) repoURL(suffix string) string {
+	return g.c.project.apiBase() + "/repos/" + g.c.project.Path + suffix
+}
+
+func (g *githubAPI) repository(ctx context.Context) (*Repository, json.RawMessage, error) {
+	var r struct {
+		FullName      string   `json:"full_name"`
+		Description   string   `json:"description"`
+		Homepage      string   `json:"homepage"`
+		HTMLURL       string   `json:"html_url"`
+		CloneURL      string   `json:"clone_url"`
+		DefaultBranch string   `json:"default_branch"`
+		Language      string   `json:"language"`
+		Topics        []string `json:"topics"`
+		Stars         int      `json:"stargazers_count"`
+		Forks         int      `json:"forks_count"`
+		OpenIssues    int      `json:"open_issues_count"`
+		Archived      bool     `json:"archived"`
+		Fork          bool     `json:"fork"`
+		HasWiki       bool     `json:"has_wiki"`
+		CreatedAt     string   `json:"created_at"`
+		UpdatedAt     string   `json:"updated_at"`
+		PushedAt      string   `json:"pushed_at"`
+		License       *struct {
+			SPDXID string `json:"spdx_id"`
+			Name   string `json:"name"`
+		} `json:"license"`
+	}
+	raw, err := g.c.getJSON(ctx, g.repoURL(""), &r)
+	if err != nil {
+		return nil, nil, err
+	}
+	repo := &Repository{
+		FullName: r.FullName, Description: r.Description, Homepage: r.Homepage,
+		WebURL: r.HTMLURL, CloneURL: r.CloneURL, DefaultBranch: r.DefaultBranch,
+		Language: r.Language, Topics: r.Topics, Stars: r.Stars, Forks: r.Forks,
+		OpenIssues: r.OpenIssues, Archived: r.Archived, Fork: r.Fork, HasWiki: r.HasWiki,
+		CreatedAt: r.CreatedAt, UpdatedAt: r.UpdatedAt, PushedAt: r.PushedAt,
+	}
+	if r.License != nil {
+		repo.License = firstNonEmpty(r.License.SPDXID, r.License.Name)
+	}
+	return repo, raw, nil
+}
+
+type githubIssue struct {
+	Number    int    `json:"number"`
+	Title     string `json:"title"`
+	State     string `json:"state"`
+	User      *user  `json:"user"`
+	HTMLURL   string `json:"html_url"`
+	Body      string `json:"body"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+	ClosedAt  string `json:"closed_at"`
+	Comments  int    `json:"comments"`
+	Labels    []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	PullRequest *struct {
+		MergedAt string `json:"merged_at"`
+	} `json:"pull_request"`
+}
+
+func (g *githubAPI) threads(ctx context.Context, limit int) ([]Thread, bool, error) {
+	var out []Thread
+	truncated := false
+	// The issues endpoint lists pull requests too, marked by pull_request.
+	err := paginate(ctx, g.c, g.repoURL("/issues?state=all&sort=created&direction=desc&per_page=100"), func(page []githubIssue) bool {
+		for _, issue := range page {
+			if len(out) == limit {
+				truncated = true
+				return false
+			}
+			t := Thread{
+				Kind: ThreadIssue, Number: issue.Number, Title: issue.Title, State: issue.State,
+				Author: issue.User.name(), URL: issue.HTMLURL, Body: issue.Body,
+				CreatedAt: issue.CreatedAt, UpdatedAt: issue.UpdatedAt, ClosedAt: issue.ClosedAt,
+				CommentCount: issue.Comments,
+			}
+			if issue.PullRequest != nil {
+				t.Kind = ThreadPullRequest
+				t.MergedAt = issue.PullRequest.MergedAt
+			}
+			for _, label := range issue.Labels {
+				t.Labels = append(t.Labels, label.Name)
+			}
+			out = append(out, t)
+		}
+		return true
+	})
+	return out, truncated, err
+}
+
+type githubComment struct {
+	User      *user  `json:"user"`
+	Body      string `json:"body"`
+	CreatedAt string `json:"created_at"`
+	HTMLURL   string `json:"html_url"`
+	Path      string `json:"path"`
+}
+
+func (g *githubAPI) comments(ctx context.Context, thread *Thread) ([]Comment, error) {
+	var out []Comment
+	collect := func(page []githubComment) bool {
+		for _, c := range page {
+			out = append(out, Comment{Author: c.User.name(), Body: c.Body, CreatedAt: c.CreatedAt, URL: c.HTMLURL, Path: c.Path})
+		}
+		return true
+	}
+	if err := paginate(ctx, g.c, g.repoURL(fmt.Sprintf("/issues/%d/comments?per_page=100", thread.Number)), collect); err != nil {
+		return nil, err
+	}
+	// Review comments on the diff live apart from the conversation.
+	if thread.Kind == ThreadPullRequest {
+		if err := paginate(ctx, g.c, g.repoURL(fmt.Sprintf("/pulls/%d/comments?per_page=100", thread.Number)), collect); err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		sort.SliceStable(out, func(i, j int) bool { return out[i].CreatedAt < out[j].CreatedAt })
+	}
+	return out, nil
+}
+
+func (g *githubAPI) releases(ctx context.Context) ([]Release, error) {
+	type githubRelease struct {
+		TagName     string `json:"tag_name"`
+		Name        string `json:"name"`
+		Body        string `json:"body"`
+		Author      *user  `json:"author"`
+		HTMLURL     string `json:"html_url"`
+		Draft       bool   `json:"draft"`
+		Prerelease  bool   `json:"prerelease"`
+		CreatedAt   string `json:"created_at"`
+		PublishedAt string `json:"published_at"`
+		Assets      []struct {
+			Name        string `json:"name"`
+			URL         string `json:"browser_download_url"`
+			ContentType string `json:"content_type"`
+			Size        int64  `json:"size"`
+		} `json:"assets"`
+	}
+	var out []Release
+	err := paginate(ctx, g.c, g.repoURL("/releases?per_page=100"), func(page []githubRelease) bool {
+		for _, r := range page {
+			release := Release{
+				Tag: r.TagName, Name: r.Name, Body: r.Body, Author: r.Author.name(), URL: r.HTMLURL,
+				Draft: r.Draft, Prerelease: r.Prerelease, CreatedAt: r.CreatedAt, PublishedAt: r.PublishedAt,
+				Assets: []Asset{},
+			}
+			for _, a := range r.Assets {
+				release.Assets = append(release.Assets, Asset{Name: a.Name, URL: a.URL, ContentType: a.ContentType, Size: a.Size})
+			}
+			out = append(out, release)
+		}
+		return true
+	})
+	return out, err
+}
+
+func (g *githubAPI) readme(ctx context.Context, repo *Repository) (*Readme, error) {
+	var file struct {
+		Name     string `json:"name"`
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	if _, err := g.c.getJSON(ctx, g.repoURL("/readme"), &file); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	raw := []byte(file.Content)
+	if file.Encoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(stripNewlines(file.Content))
+		if err != nil {
+			return nil, fmt.Errorf("forge: decoding README: %w", err)
+		}
+		raw = decoded
+	}
+	readme := &Readme{Name: file.Name, Raw: raw}
+	// GitHub renders the README exactly as its own page shows it.
+	if html, _, err := g.c.do(ctx, http.MethodGet, g.repoURL("/readme"), "application/vnd.github.html", nil); err == nil {
+		readme.HTML = html
+	}
+	return readme, nil
+}
+
+func stripNewlines(s string) string {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\n' && s[i] != '\r' {
+			out = append(out, s[i])
+		}
+	}
+	return string(out)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" && v != "NOASSERTION" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,242 @@
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// gitlabAPI speaks the GitLab REST API, v4. Projects are addressed by their
+// URL-encoded namespace path, and issues and merge requests by their
+// per-project iid.
+type gitlabAPI struct {
+	c  *Client
+	id string
+	// readmeURL comes from the project record; GitLab has no README endpoint.
+	readmeURL string
+}
+
+func (g *gitlabAPI) projectURL(suffix string) string {
+	return g.c.project.apiBase() + "/projects/" + g.id + suffix
+}
+
+func (g *gitlabAPI) repository(ctx context.Context) (*Repository, json.RawMessage, error) {
+	var r struct {
+		PathWithNamespace string   `json:"path_with_namespace"`
+		Description       string   `json:"description"`
+		WebURL            string   `json:"web_url"`
+		HTTPURLToRepo     string   `json:"http_url_to_repo"`
+		DefaultBranch     string   `json:"default_branch"`
+		Topics            []string `json:"topics"`
+		TagList           []string `json:"tag_list"`
+		Stars             int      `json:"star_count"`
+		Forks             int      `json:"forks_count"`
+		OpenIssues        int      `json:"open_issues_count"`
+		Archived          bool     `json:"archived"`
+		WikiEnabled       bool     `json:"wiki_enabled"`
+		CreatedAt         string   `json:"created_at"`
+		LastActivityAt    string   `json:"last_activity_at"`
+		ReadmeURL         string   `json:"readme_url"`
+		ForkedFrom        *struct {
+			ID int `json:"id"`
+		} `json:"forked_from_project"`
+		License *struct {
+			Key      string `json:"key"`
+			Nickname string `json:"nickname"`
+			Name     string `json:"name"`
+		} `json:"license"`
+	}
+	raw, err := g.c.getJSON(ctx, g.projectURL("?license=true"), &r)
+	if err != nil {
+		return nil, nil, err
+	}
+	repo := &Repository{
+		FullName: r.PathWithNamespace, Description: r.Description,
+		WebURL: r.WebURL, CloneURL: r.HTTPURLToRepo, DefaultBranch: r.DefaultBranch,
+		Topics: r.Topics, Stars: r.Stars, Forks: r.Forks, OpenIssues: r.OpenIssues,
+		Archived: r.Archived, Fork: r.ForkedFrom != nil, HasWiki: r.WikiEnabled,
+		CreatedAt: r.CreatedAt, UpdatedAt: r.LastActivityAt,
+	}
+	if len(repo.Topics) == 0 {
+		repo.Topics = r.TagList
+	}
+	if r.License != nil {
+		repo.License = firstNonEmpty(r.License.Nickname, r.License.Name, r.License.Key)
+	}
+	g.readmeURL = r.ReadmeURL
+	return repo, raw, nil
+}
+
+type gitlabThread struct {
+	IID            int      `json:"iid"`
+	Title          string   `json:"title"`
+	State          string   `json:"state"`
+	Author         *user    `json:"author"`
+	WebURL         string   `json:"web_url"`
+	Description    string   `json:"description"`
+	Labels         []string `json:"labels"`
+	CreatedAt      string   `json:"created_at"`
+	UpdatedAt      string   `json:"updated_at"`
+	ClosedAt       string   `json:"closed_at"`
+	MergedAt       string   `json:"merged_at"`
+	UserNotesCount int      `json:"user_notes_count"`
+}
+
+// threads lists issues and merge requests separately, since GitLab keeps
+// them apart, and merges the two newest-first.
+func (g *gitlabAPI) threads(ctx context.Context, limit int) ([]Thread, bool, error) {
+	var out []Thread
+	truncated := false
+	for _, source := range []struct{ kind, path string }{
+		{ThreadIssue, "/issues?scope=all&order_by=created_at&sort=desc&per_page=100"},
+		{ThreadPullRequest, "/merge_requests?scope=all&state=all&order_by=created_at&sort=desc&per_page=100"},
+	} {
+		count := 0
+		err := paginate(ctx, g.c, g.projectURL(source.path), func(page []gitlabThread) bool {
+			for _, t := range page {
+				if count == limit {
+					truncated = true
+					return false
+				}
+				count++
+				out = append(out, Thread{
+					Kind: source.kind, Number: t.IID, Title: t.Title, State: t.State,
+					Author: t.Author.name(), URL: t.WebURL, Body: t.Description, Labels: t.Labels,
+					CreatedAt: t.CreatedAt, UpdatedAt: t.UpdatedAt, ClosedAt: t.ClosedAt, MergedAt: t.MergedAt,
+					CommentCount: t.UserNotesCount,
+				})
+			}
+			return true
+		})
+		// A project with issues or merge requests disabled answers 403 or
+		// 404 for that list only.
+		var httpErr *HTTPError
+		if errors.Is(err, ErrNotFound) || (errors.As(err, &httpErr) && httpErr.Status == http.StatusForbidden && !httpErr.RateLimited) {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].CreatedAt > out[j].CreatedAt })
+	if len(out) > limit {
+		out, truncated = out[:limit], true
+	}
+	return out, truncated, nil
+}
+
+func (g *gitlabAPI) comments(ctx context.Context, thread *Thread) ([]Comment, error) {
+	collection := "issues"
+	if thread.Kind == ThreadPullRequest {
+		collection = "merge_requests"
+	}
+	type note struct {
+		Author    *user  `json:"author"`
+		Body      string `json:"body"`
+		CreatedAt string `json:"created_at"`
+		System    bool   `json:"system"`
+		Position  *struct {
+			NewPath string `json:"new_path"`
+		} `json:"position"`
+	}
+	var out []Comment
+	err := paginate(ctx, g.c, g.projectURL(fmt.Sprintf("/%s/%d/notes?sort=asc&order_by=created_at&per_page=100", collection, thread.Number)), func(page []note) bool {
+		for _, n := range page {
+			// System notes are GitLab's own event log ("changed the
+			// description"), not discussion.
+			if n.System {
+				continue
+			}
+			c := Comment{Author: n.Author.name(), Body: n.Body, CreatedAt: n.CreatedAt}
+			if n.Position != nil {
+				c.Path = n.Position.NewPath
+			}
+			out = append(out, c)
+		}
+		return true
+	})
+	return out, err
+}
+
+func (g *gitlabAPI) releases(ctx context.Context) ([]Release, error) {
+	type gitlabRelease struct {
+		TagName     string `json:"tag_name"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Author      *user  `json:"author"`
+		CreatedAt   string `json:"created_at"`
+		ReleasedAt  string `json:"released_at"`
+		Upcoming    bool   `json:"upcoming_release"`
+		Links       struct {
+			Self string `json:"self"`
+		} `json:"_links"`
+		Assets struct {
+			Links []struct {
+				Name           string `json:"name"`
+				URL            string `json:"url"`
+				DirectAssetURL string `json:"direct_asset_url"`
+			} `json:"links"`
+		} `json:"assets"`
+	}
+	var out []Release
+	err := paginate(ctx, g.c, g.projectURL("/releases?per_page=100"), func(page []gitlabRelease) bool {
+		for _, r := range page {
+			release := Release{
+				Tag: r.TagName, Name: r.Name, Body: r.Description, Author: r.Author.name(), URL: r.Links.Self,
+				Prerelease: r.Upcoming, CreatedAt: r.CreatedAt, PublishedAt: r.ReleasedAt,
+				Assets: []Asset{},
+			}
+			for _, link := range r.Assets.Links {
+				assetURL := link.DirectAssetURL
+				if assetURL == "" {
+					assetURL = link.URL
+				}
+				release.Assets = append(release.Assets, Asset{Name: link.Name, URL: assetURL})
+			}
+			out = append(out, release)
+		}
+		return true
+	})
+	return out, err
+}
+
+// readme fetches the file the project record names as its README and
+// renders it with the instance's Markdown renderer.
+func (g *gitlabAPI) readme(ctx context.Context, repo *Repository) (*Readme, error) {
+	// readme_url is a web URL: <project>/-/blob/<branch>/<path>.
+	_, rest, found := strings.Cut(g.readmeURL, "/-/blob/")
+	if !found || repo.DefaultBranch == "" {
+		return nil, nil
+	}
+	filePath := strings.TrimPrefix(rest, repo.DefaultBranch+"/")
+	if filePath == rest || filePath == "" {
+		return nil, nil
+	}
+	raw, _, err := g.c.do(ctx, http.MethodGet,
+		g.projectURL("/repository/files/"+url.PathEscape(filePath)+"/raw?ref="+url.QueryEscape(repo.DefaultBranch)), "*/*", nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	name := filePath[strings.LastIndex(filePath, "/")+1:]
+	readme := &Readme{Name: name, Raw: raw}
+	if isMarkdownName(name) {
+		body, _ := json.Marshal(map[string]any{"text": string(raw), "gfm": true, "project": g.c.project.Path})
+		var rendered struct {
+			HTML string `json:"html"`
+		}
+		if data, _, err := g.c.do(ctx, http.MethodPost, g.c.project.apiBase()+"/markdown", "", bytes.NewReader(body)); err == nil &&
+			json.Unmarshal(data, &rendered) == nil {
+			readme.HTML = []byte(rendered.HTML)
+		}
+	}
+	return readme, nil
+}
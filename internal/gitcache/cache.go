@@ -0,0 +1,351 @@
+// Package gitcache keeps archived git repositories unpacked on local disk
+// for serving. Clones and the repository browser read the same directories.
+//
+// Each capture is unpacked at most once at a time, however many
+// requests arrive for it together. The cache holds to a byte budget by
+// evicting the least recently used repository that no request is reading,
+// and a directory is only served once its unpack has completed.
+package gitcache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"arker/internal/storage"
+)
+
+// markerName is written into a repository directory once its unpack has
+// completed. A directory without it is a partial unpack and is never served.
+const markerName = ".arker-cache.json"
+
+// tempPrefix marks directories being unpacked or being removed. Short IDs
+// never start with a dot, so these never collide with a repository.
+const tempPrefix = ".tmp-"
+
+// supersedeSep separates a short ID from the suffix of a directory unpacked
+// while the capture's previous directory was still being read.
+const supersedeSep = "@"
+
+type marker struct {
+	StorageKey string `json:"storage_key"`
+	Bytes      int64  `json:"bytes"`
+}
+
+type entry struct {
+	dir      string
+	key      string
+	bytes    int64
+	refs     int
+	lastUsed time.Time
+	// retired is set once a newer tar of the capture replaced this entry
+	// while requests were still reading it; the last release removes it.
+	retired bool
+}
+
+// Stats is a snapshot of the cache for the status endpoint.
+type Stats struct {
+	Repos        int   `json:"repos"`
+	InUse        int   `json:"in_use"`
+	Bytes        int64 `json:"bytes"`
+	BudgetBytes  int64 `json:"budget_bytes"`
+	Hits         int64 `json:"hits"`
+	Misses       int64 `json:"misses"`
+	Coalesced    int64 `json:"coalesced"`
+	Evictions    int64 `json:"evictions"`
+	UnpackErrors int64 `json:"unpack_errors"`
+	Repaired     int64 `json:"repaired"`
+}
+
+// Cache is the set of unpacked repositories under one root directory.
+type Cache struct {
+	root   string
+	budget int64
+	store  storage.Storage
+	group  singleflight.Group
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	bytes   int64
+	stats   Stats
+}
+
+// New opens the cache at root, keeping at most budget bytes unpacked; a
+// budget of 0 never evicts. Repositories already complete on disk are kept
+// and partial unpacks left by a crash are removed.
+func New(root string, budget int64, store storage.Storage) (*Cache, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	c := &Cache{root: root, budget: budget, store: store, entries: map[string]*entry{}}
+	dirs, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range dirs {
+		path := filepath.Join(root, d.Name())
+		if !d.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			os.RemoveAll(path)
+			continue
+		}
+		m, modified, err := readMarker(path)
+		if err != nil {
+			// Unpacked before this cache existed, or cut off mid-unpack.
+			// Either way it is rebuilt on the next request.
+			slog.Warn("Removing incomplete git cache directory", "dir", path, "error", err)
+			os.RemoveAll(path)
+			c.stats.Repaired++
+			continue
+		}
+		shortID, _, _ := strings.Cut(d.Name(), supersedeSep)
+		if old := c.entries[shortID]; old != nil {
+			// A superseded directory whose readers were cut off by the
+			// restart; keep the newer of the two.
+			if old.lastUsed.After(modified) {
+				os.RemoveAll(path)
+				continue
+			}
+			os.RemoveAll(old.dir)
+			c.bytes -= old.bytes
+		}
+		c.entries[shortID] = &entry{dir: path, key: m.StorageKey, bytes: m.Bytes, lastUsed: modified}
+		c.bytes += m.Bytes
+	}
+	c.mu.Lock()
+	c.evictLocked("")
+	c.mu.Unlock()
+	return c, nil
+}
+
+// Root is the directory repositories are unpacked under, one per short ID,
+// plus one for each newer tar unpacked while an older one was being read.
+func (c *Cache) Root() string {
+	return c.root
+}
+
+// Acquire returns the directory holding the capture's repository, unpacking
+// storageKey into it on first use. The directory is not evicted until
+// release is called, which must happen exactly once.
+func (c *Cache) Acquire(shortID, storageKey string) (dir string, release func(), err error) {
+	if shortID == "" || strings.HasPrefix(shortID, ".") || strings.ContainsAny(shortID, `/\`+supersedeSep) {
+		return "", nil, fmt.Errorf("gitcache: invalid short ID %q", shortID)
+	}
+	filled := false
+	for attempt := 0; attempt < 3; attempt++ {
+		c.mu.Lock()
+		if e := c.entries[shortID]; e != nil && c.validLocked(shortID, e, storageKey) {
+			e.refs++
+			e.lastUsed = time.Now()
+			if !filled {
+				c.stats.Hits++
+			}
+			c.mu.Unlock()
+			return e.dir, c.releaser(shortID, e), nil
+		}
+		c.mu.Unlock()
+
+		_, err, shared := c.group.Do(shortID, func() (any, error) {
+			return nil, c.fill(shortID, storageKey)
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		if shared {
+			c.mu.Lock()
+			c.stats.Coalesced++
+			c.mu.Unlock()
+		}
+		filled = true
+	}
+	// Evicted between every unpack and its use: the budget is far too small
+	// for the traffic.
+	return "", nil, errors.New("gitcache: repository evicted before use")
+}
+
+// validLocked reports whether a cached entry can be served for storageKey.
+// An entry holding another tar of the capture never is; fill replaces it. An
+// entry whose directory lost its marker is dropped when nothing is reading
+// it.
+func (c *Cache) validLocked(shortID string, e *entry, storageKey string) bool {
+	if e.key != storageKey {
+		return false
+	}
+	if _, err := os.Stat(filepath.Join(e.dir, markerName)); err != nil {
+		if e.refs == 0 {
+			c.removeLocked(shortID, e)
+			c.stats.Repaired++
+		}
+		return e.refs > 0
+	}
+	return true
+}
+
+func (c *Cache) releaser(shortID string, e *entry) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			e.refs--
+			e.lastUsed = time.Now()
+			if e.retired && e.refs == 0 {
+				c.bytes -= e.bytes
+				c.trashLocked(e.dir)
+				return
+			}
+			c.evictLocked("")
+		})
+	}
+}
+
+// fill unpacks a repository into a temporary directory and moves it into
+// place only once it is complete, so a crash or a corrupt tar never leaves
+// a directory that looks servable.
+func (c *Cache) fill(shortID, storageKey string) error {
+	c.mu.Lock()
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	tmp, err := os.MkdirTemp(c.root, tempPrefix+shortID+"-")
+	if err != nil {
+		return err
+	}
+	size, err := Unpack(c.store, storageKey, tmp)
+	if err == nil {
+		err = writeMarker(tmp, marker{StorageKey: storageKey, Bytes: size})
+	}
+	if err != nil {
+		os.RemoveAll(tmp)
+		c.mu.Lock()
+		c.stats.UnpackErrors++
+		c.mu.Unlock()
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old := c.entries[shortID]; old != nil {
+		if old.refs > 0 {
+			// Requests are still reading the previous tar: they keep its
+			// directory until they release it, and this one is served from
+			// now on.
+			old.retired = true
+			delete(c.entries, shortID)
+		} else {
+			c.removeLocked(shortID, old)
+		}
+	}
+	dir := filepath.Join(c.root, shortID)
+	if _, err := os.Stat(dir); err == nil {
+		// Still held by a retired entry's readers.
+		dir += fmt.Sprintf("%s%d", supersedeSep, time.Now().UnixNano())
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		os.RemoveAll(tmp)
+		c.stats.UnpackErrors++
+		return err
+	}
+	c.entries[shortID] = &entry{dir: dir, key: storageKey, bytes: size, lastUsed: time.Now()}
+	c.bytes += size
+	c.evictLocked(shortID)
+	return nil
+}
+
+// evictLocked removes idle repositories, least recently used first, until
+// the cache is within budget. keep is never evicted: it was just unpacked
+// for a request that has not acquired it yet.
+func (c *Cache) evictLocked(keep string) {
+	if c.budget <= 0 {
+		return
+	}
+	for c.bytes > c.budget {
+		var victim string
+		var oldest *entry
+		for id, e := range c.entries {
+			if id == keep || e.refs > 0 {
+				continue
+			}
+			if oldest == nil || e.lastUsed.Before(oldest.lastUsed) {
+				victim, oldest = id, e
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		c.removeLocked(victim, oldest)
+		c.stats.Evictions++
+	}
+}
+
+func (c *Cache) removeLocked(shortID string, e *entry) {
+	delete(c.entries, shortID)
+	c.bytes -= e.bytes
+	c.trashLocked(e.dir)
+}
+
+// trashLocked renames a directory out of the way, which is instant, and
+// deletes it in the background so the lock is not held for the removal.
+func (c *Cache) trashLocked(dir string) {
+	trash := filepath.Join(c.root, fmt.Sprintf("%s%s-%d", tempPrefix, filepath.Base(dir), time.Now().UnixNano()))
+	if err := os.Rename(dir, trash); err != nil {
+		os.RemoveAll(dir)
+		return
+	}
+	go os.RemoveAll(trash)
+}
+
+// Stats returns the cache's current counters.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Repos = len(c.entries)
+	s.Bytes = c.bytes
+	s.BudgetBytes = c.budget
+	for _, e := range c.entries {
+		if e.refs > 0 {
+			s.InUse++
+		}
+	}
+	return s
+}
+
+func readMarker(dir string) (marker, time.Time, error) {
+	var m marker
+	path := filepath.Join(dir, markerName)
+	info, err := os.Stat(path)
+	if err != nil {
+		return m, time.Time{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return m, time.Time{}, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, time.Time{}, err
+	}
+	// A repository without HEAD cannot be served whatever the marker says.
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil {
+		return m, time.Time{}, err
+	}
+	return m, info.ModTime(), nil
+}
+
+func writeMarker(dir string, m marker) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, markerName), data, 0644)
+}
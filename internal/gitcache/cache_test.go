@@ -0,0 +1,245 @@
+package gitcache
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"arker/internal/storage"
+)
+
+// countingStorage counts reads and can hold them until released, to line
+// up concurrent requests behind one unpack.
+type countingStorage struct {
+	*storage.MemoryStorage
+	reads atomic.Int32
+	gate  chan struct{}
+}
+
+func (s *countingStorage) Reader(key string) (io.ReadCloser, error) {
+	s.reads.Add(1)
+	if s.gate != nil {
+		<-s.gate
+	}
+	return s.MemoryStorage.Reader(key)
+}
+
+// putRepo stores a tar shaped like a bare repository, padded to size bytes.
+func putRepo(t *testing.T, store storage.Storage, key string, size int) {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	files := map[string]string{"HEAD": "ref: refs/heads/main\n", "objects/pack/data": strings.Repeat("x", size-len("ref: refs/heads/main\n"))}
+	for _, name := range []string{"HEAD", "objects/pack/data"} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg})
+		tw.Write([]byte(files[name]))
+	}
+	tw.Close()
+	w, _ := store.Writer(key)
+	w.Write(buf.Bytes())
+	w.Close()
+}
+
+func TestAcquireUnpacksOnceForConcurrentRequests(t *testing.T) {
+	store := &countingStorage{MemoryStorage: storage.NewMemoryStorage(), gate: make(chan struct{})}
+	putRepo(t, store, "a/git.tar", 100)
+	c, err := New(t.TempDir(), 0, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dir, release, err := c.Acquire("a", "a/git.tar")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer release()
+			if _, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// Let every request reach the cache before the one unpack proceeds.
+	for store.reads.Load() == 0 {
+		runtime.Gosched()
+	}
+	close(store.gate)
+	wg.Wait()
+
+	if n := store.reads.Load(); n != 1 {
+		t.Errorf("tar read %d times, want 1", n)
+	}
+	stats := c.Stats()
+	if stats.Misses != 1 || stats.Repos != 1 || stats.Bytes != 100 || stats.InUse != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if stats.Hits+stats.Coalesced+stats.Misses < 8 {
+		t.Errorf("stats = %+v; every request should be a hit, a miss or coalesced", stats)
+	}
+}
+
+func TestEvictsLeastRecentlyUsedIdleRepository(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	for _, id := range []string{"a", "b", "c"} {
+		putRepo(t, store, id+"/git.tar", 100)
+	}
+	root := t.TempDir()
+	c, _ := New(root, 250, store)
+
+	_, releaseA, _ := c.Acquire("a", "a/git.tar")
+	_, releaseB, _ := c.Acquire("b", "b/git.tar")
+	releaseB()
+	// a is older but still being read; b is the one that goes.
+	_, releaseC, err := c.Acquire("c", "c/git.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseC()
+	if _, err := os.Stat(filepath.Join(root, "b")); !os.IsNotExist(err) {
+		t.Errorf("idle repository b was not evicted: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a", "HEAD")); err != nil {
+		t.Errorf("repository a was evicted while in use: %v", err)
+	}
+	releaseA()
+	if stats := c.Stats(); stats.Evictions != 1 || stats.Bytes != 200 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+// A newer tar of a capture is served as soon as it is requested, even while
+// a clone is still reading the previous one (regression: the new unpack was
+// discarded and the stale repository served).
+func TestNewerTarServedWhileOlderIsInUse(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	putRepo(t, store, "a/git-1.tar", 100)
+	putRepo(t, store, "a/git-2.tar", 150)
+	c, _ := New(t.TempDir(), 0, store)
+
+	oldDir, releaseOld, err := c.Acquire("a", "a/git-1.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newDir, releaseNew, err := c.Acquire("a", "a/git-2.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newDir == oldDir {
+		t.Fatalf("newer tar served from the directory still in use: %s", newDir)
+	}
+	if m, _, err := readMarker(newDir); err != nil || m.StorageKey != "a/git-2.tar" {
+		t.Errorf("marker of the new directory = %+v, %v", m, err)
+	}
+	if _, err := os.Stat(filepath.Join(oldDir, "HEAD")); err != nil {
+		t.Errorf("directory removed while still in use: %v", err)
+	}
+
+	releaseOld()
+	if _, err := os.Stat(oldDir); !os.IsNotExist(err) {
+		t.Errorf("superseded directory kept after its last release: %v", err)
+	}
+	releaseNew()
+	if stats := c.Stats(); stats.Repos != 1 || stats.Bytes != 150 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if dir, release, err := c.Acquire("a", "a/git-2.tar"); err != nil || dir != newDir {
+		t.Errorf("Acquire after release = %s, %v; want %s", dir, err, newDir)
+	} else {
+		release()
+	}
+}
+
+// A corrupt tar leaves nothing behind that a later request could mistake
+// for a complete repository (regression: poisoned git cache served forever).
+func TestCorruptTarLeavesNoDirectory(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	w, _ := store.Writer("bad/key")
+	w.Write(bytes.Repeat([]byte{0xff}, 512))
+	w.Close()
+	root := t.TempDir()
+	c, _ := New(root, 0, store)
+
+	if _, _, err := c.Acquire("bad", "bad/key"); err == nil {
+		t.Fatal("expected a corrupt tar to fail")
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 0 {
+		t.Errorf("cache root holds %v after a failed unpack", entries)
+	}
+	if stats := c.Stats(); stats.UnpackErrors != 1 || stats.Repos != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestTarEntryOutsideRepositoryRejected(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "../escape", Mode: 0644, Size: 1, Typeflag: tar.TypeReg})
+	tw.Write([]byte("x"))
+	tw.Close()
+	w, _ := store.Writer("evil")
+	w.Write(buf.Bytes())
+	w.Close()
+	root := filepath.Join(t.TempDir(), "cache")
+	c, _ := New(root, 0, store)
+
+	if _, _, err := c.Acquire("evil", "evil"); err == nil {
+		t.Fatal("expected a tar escaping the repository to fail")
+	}
+	if _, err := os.Stat(filepath.Join(root, "..", "escape")); !os.IsNotExist(err) {
+		t.Errorf("file written outside the cache: %v", err)
+	}
+}
+
+func TestReopenKeepsCompleteAndRepairsPartialDirectories(t *testing.T) {
+	store := &countingStorage{MemoryStorage: storage.NewMemoryStorage()}
+	putRepo(t, store, "a/git.tar", 100)
+	root := t.TempDir()
+	c, _ := New(root, 0, store)
+	_, release, _ := c.Acquire("a", "a/git.tar")
+	release()
+
+	// A crash mid-unpack, an unpack from before markers existed, and a
+	// directory whose marker was lost after the fact.
+	os.MkdirAll(filepath.Join(root, ".tmp-b-123", "objects"), 0755)
+	os.MkdirAll(filepath.Join(root, "legacy", "objects"), 0755)
+	os.WriteFile(filepath.Join(root, "legacy", "HEAD"), []byte("ref: refs/heads/main\n"), 0644)
+
+	reopened, err := New(root, 0, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := reopened.Stats()
+	if stats.Repos != 1 || stats.Bytes != 100 || stats.Repaired != 1 {
+		t.Errorf("stats after reopening = %+v", stats)
+	}
+	for _, gone := range []string{".tmp-b-123", "legacy"} {
+		if _, err := os.Stat(filepath.Join(root, gone)); !os.IsNotExist(err) {
+			t.Errorf("%s survived reopening", gone)
+		}
+	}
+	if _, release, err := reopened.Acquire("a", "a/git.tar"); err != nil || store.reads.Load() != 1 {
+		t.Errorf("complete repository re-read after reopening: reads %d, %v", store.reads.Load(), err)
+	} else {
+		release()
+	}
+
+	os.Remove(filepath.Join(root, "a", markerName))
+	if _, release, err := reopened.Acquire("a", "a/git.tar"); err != nil || store.reads.Load() != 2 {
+		t.Errorf("repository without its marker served as is: reads %d, %v", store.reads.Load(), err)
+	} else {
+		release()
+	}
+}
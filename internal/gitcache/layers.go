@@ -0,0 +1,222 @@
+package gitcache
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"arker/internal/storage"
+)
+
+// A git capture is stored as a tar of a bare repository. An incremental
+// capture stores a delta instead: a tar holding DeltaMarker first, then only
+// the object files its parent capture lacks, and its own HEAD, config and
+// refs. The full repository is the parent's objects with the delta's on top,
+// read with the delta's refs; the parent may be a delta itself.
+
+// DeltaExtension is the stored extension of an incremental capture.
+const DeltaExtension = ".delta.tar"
+
+// DeltaMarker is the name of the first entry of a delta tar.
+const DeltaMarker = ".arker-delta.json"
+
+// MaxDeltaDepth bounds a chain of deltas. A capture that would go deeper
+// stores the whole repository again.
+const MaxDeltaDepth = 16
+
+// Delta is the contents of DeltaMarker.
+type Delta struct {
+	ParentShortID    string `json:"parent_short_id"`
+	ParentStorageKey string `json:"parent_storage_key"`
+	// Depth counts the deltas down to a full capture, this one included.
+	Depth int `json:"depth"`
+}
+
+const maxDeltaMarkerSize = 64 << 10
+
+// ReadDelta returns the delta header of a stored capture, or nil when the
+// capture holds the whole repository.
+func ReadDelta(store storage.Storage, key string) (*Delta, error) {
+	r, err := store.Reader(key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if hdr.Name != DeltaMarker {
+		return nil, nil
+	}
+	return parseDelta(tr)
+}
+
+func parseDelta(r io.Reader) (*Delta, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxDeltaMarkerSize))
+	if err != nil {
+		return nil, err
+	}
+	var d Delta
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("gitcache: bad delta marker: %w", err)
+	}
+	if d.ParentStorageKey == "" {
+		return nil, errors.New("gitcache: delta marker names no parent")
+	}
+	return &d, nil
+}
+
+// refEntry reports whether a tar entry belongs to a repository's refs rather
+// than its objects. Only the last layer's are kept.
+func refEntry(name string) bool {
+	name = strings.TrimPrefix(name, "./")
+	switch name {
+	case "HEAD", "config", "packed-refs", "refs", "refs/":
+		return true
+	}
+	return strings.HasPrefix(name, "refs/")
+}
+
+// eachEntry calls fn for every entry of the repository rebuilt from a
+// capture's layers: every layer's objects, the oldest first, and the refs of
+// the capture itself. Each layer is read once.
+func eachEntry(store storage.Storage, key string, fn func(*tar.Header, io.Reader) error) error {
+	return eachLayerEntry(store, key, 0, fn)
+}
+
+func eachLayerEntry(store storage.Storage, key string, depth int, fn func(*tar.Header, io.Reader) error) error {
+	r, err := store.Reader(key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err == nil && hdr.Name == DeltaMarker {
+		if err := eachParentEntry(store, key, tr, depth, fn); err != nil {
+			return err
+		}
+		hdr, err = tr.Next()
+	}
+	for ; err == nil; hdr, err = tr.Next() {
+		if depth > 0 && refEntry(hdr.Name) {
+			continue
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// eachParentEntry reads a delta's marker from tr and walks its parent.
+func eachParentEntry(store storage.Storage, key string, tr *tar.Reader, depth int, fn func(*tar.Header, io.Reader) error) error {
+	d, err := parseDelta(tr)
+	if err != nil {
+		return err
+	}
+	if depth >= MaxDeltaDepth {
+		return fmt.Errorf("gitcache: delta chain of %s is longer than %d", key, MaxDeltaDepth)
+	}
+	if err := eachLayerEntry(store, d.ParentStorageKey, depth+1, fn); err != nil {
+		return fmt.Errorf("parent %s: %w", d.ParentStorageKey, err)
+	}
+	return nil
+}
+
+// ParentKeys returns the storage keys of the layers beneath a stored
+// capture, its parent first. A full capture has none.
+func ParentKeys(store storage.Storage, key string) ([]string, error) {
+	var keys []string
+	for {
+		d, err := ReadDelta(store, key)
+		if err != nil {
+			return nil, err
+		}
+		if d == nil {
+			return keys, nil
+		}
+		if len(keys) >= MaxDeltaDepth {
+			return nil, fmt.Errorf("gitcache: delta chain of %s is longer than %d", key, MaxDeltaDepth)
+		}
+		keys = append(keys, d.ParentStorageKey)
+		key = d.ParentStorageKey
+	}
+}
+
+// WriteTar writes the whole repository of a stored capture to w as one tar,
+// the same a full capture of it would have stored.
+func WriteTar(w io.Writer, store storage.Storage, key string) error {
+	tw := tar.NewWriter(w)
+	dirs := map[string]bool{}
+	err := eachEntry(store, key, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Typeflag == tar.TypeDir {
+			if dirs[hdr.Name] {
+				return nil
+			}
+			dirs[hdr.Name] = true
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// Unpack writes the whole repository of a stored capture into dir and
+// returns the bytes written. Entries that would land outside dir are
+// rejected.
+func Unpack(store storage.Storage, key, dir string) (int64, error) {
+	var size int64
+	err := eachEntry(store, key, func(hdr *tar.Header, r io.Reader) error {
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if name == "." {
+			return nil
+		}
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("gitcache: tar entry %q escapes the repository", hdr.Name)
+		}
+		path := filepath.Join(dir, name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			return os.MkdirAll(path, 0755)
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode)&0777|0600)
+			if err != nil {
+				return err
+			}
+			n, err := io.Copy(f, r)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			size += n
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
@@ -0,0 +1,127 @@
+package gitcache
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"arker/internal/storage"
+)
+
+// putTar stores a tar of the given files, in order; a nil delta makes a
+// full capture.
+func putTar(t *testing.T, store storage.Storage, key string, delta *Delta, files ...string) {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	write := func(name, content string) {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	if delta != nil {
+		data, _ := json.Marshal(delta)
+		write(DeltaMarker, string(data))
+	}
+	for i := 0; i+1 < len(files); i += 2 {
+		write(files[i], files[i+1])
+	}
+	tw.Close()
+	w, _ := store.Writer(key)
+	w.Write(buf.Bytes())
+	w.Close()
+}
+
+func layeredStore(t *testing.T) storage.Storage {
+	store := storage.NewMemoryStorage()
+	putTar(t, store, "a/git.tar", nil,
+		"HEAD", "ref: refs/heads/main\n",
+		"refs/heads/main", "1111\n",
+		"refs/tags/gone", "1111\n",
+		"objects/pack/pack-1.pack", "first")
+	putTar(t, store, "b/git.delta.tar", &Delta{ParentShortID: "a", ParentStorageKey: "a/git.tar", Depth: 1},
+		"HEAD", "ref: refs/heads/trunk\n",
+		"refs/heads/trunk", "2222\n",
+		"objects/pack/pack-2.pack", "second")
+	putTar(t, store, "c/git.delta.tar", &Delta{ParentShortID: "b", ParentStorageKey: "b/git.delta.tar", Depth: 2},
+		"HEAD", "ref: refs/heads/trunk\n",
+		"refs/heads/trunk", "3333\n",
+		"objects/pack/pack-3.pack", "third")
+	return store
+}
+
+func TestUnpackStacksDeltasOnTheirParents(t *testing.T) {
+	store := layeredStore(t)
+	dir := t.TempDir()
+	if _, err := Unpack(store, "c/git.delta.tar", dir); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"HEAD":                     "ref: refs/heads/trunk\n",
+		"refs/heads/trunk":         "3333\n",
+		"objects/pack/pack-1.pack": "first",
+		"objects/pack/pack-2.pack": "second",
+		"objects/pack/pack-3.pack": "third",
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	// Refs come from the capture alone: a branch or tag gone since the
+	// parent was taken is gone from the rebuilt repository too.
+	for _, name := range []string{"refs/heads/main", "refs/tags/gone", DeltaMarker} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("%s left over from a parent", name)
+		}
+	}
+
+	d, err := ReadDelta(store, "c/git.delta.tar")
+	if err != nil || d == nil || d.ParentShortID != "b" || d.Depth != 2 {
+		t.Errorf("ReadDelta = %+v, %v", d, err)
+	}
+	if d, err := ReadDelta(store, "a/git.tar"); err != nil || d != nil {
+		t.Errorf("ReadDelta of a full capture = %+v, %v", d, err)
+	}
+}
+
+func TestWriteTarMergesLayers(t *testing.T) {
+	store := layeredStore(t)
+	var buf bytes.Buffer
+	if err := WriteTar(&buf, store, "c/git.delta.tar"); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	got := strings.Join(names, " ")
+	want := "objects/pack/pack-1.pack objects/pack/pack-2.pack HEAD refs/heads/trunk objects/pack/pack-3.pack"
+	if got != want {
+		t.Errorf("entries = %s\nwant %s", got, want)
+	}
+}
+
+func TestUnpackRejectsEndlessDeltaChains(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	putTar(t, store, "a/git.delta.tar", &Delta{ParentStorageKey: "b/git.delta.tar"}, "HEAD", "x")
+	putTar(t, store, "b/git.delta.tar", &Delta{ParentStorageKey: "a/git.delta.tar"}, "HEAD", "x")
+	if _, err := Unpack(store, "a/git.delta.tar", t.TempDir()); err == nil {
+		t.Error("a delta chain that loops unpacked")
+	}
+	if _, err := Unpack(store, "missing/git.delta.tar", t.TempDir()); err == nil {
+		t.Error("a missing capture unpacked")
+	}
+}
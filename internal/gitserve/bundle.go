@@ -0,0 +1,83 @@
+package gitserve
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// BundleContentType is served for a bundle. Git has no registered type for
+// one.
+const BundleContentType = "application/x-git-bundle"
+
+// ErrEmptyRepository is returned for a repository with no refs, which a
+// bundle cannot describe.
+var ErrEmptyRepository = errors.New("gitserve: repository has no refs")
+
+// WriteBundle writes the whole repository as a v2 git bundle, the format
+// `git bundle create` writes and `git clone` reads. An archived clone keeps
+// the host's branches under refs/remotes/origin; the bundle names them as
+// the branches they were, so a clone of it has every one.
+func WriteBundle(ctx context.Context, w io.Writer, s storer.Storer) error {
+	refs, err := listRefs(s)
+	if err != nil {
+		return err
+	}
+	named := map[string]plumbing.Hash{}
+	var names []string
+	set := func(name string, hash plumbing.Hash) {
+		if _, ok := named[name]; !ok {
+			names = append(names, name)
+		}
+		named[name] = hash
+	}
+	// refs/heads sorts before refs/remotes, so where the clone's own branch
+	// and the host's copy of it differ, the host's wins.
+	for _, r := range refs.refs {
+		if branch, ok := strings.CutPrefix(r.name, "refs/remotes/origin/"); ok {
+			if branch != "HEAD" {
+				set("refs/heads/"+branch, r.hash)
+			}
+			continue
+		}
+		set(r.name, r.hash)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return ErrEmptyRepository
+	}
+
+	req := &request{}
+	for _, name := range names {
+		req.wants = append(req.wants, named[name])
+	}
+	if !refs.headHash.IsZero() {
+		req.wants = append(req.wants, refs.headHash)
+	}
+	plan, err := newPlan(s, req, refs)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(ctxWriter{ctx: ctx, w: w})
+	fmt.Fprintf(bw, "# v2 git bundle\n")
+	if !refs.headHash.IsZero() {
+		fmt.Fprintf(bw, "%s HEAD\n", refs.headHash)
+	}
+	for _, name := range names {
+		fmt.Fprintf(bw, "%s %s\n", named[name], name)
+	}
+	fmt.Fprintf(bw, "\n")
+	if _, err := packfile.NewEncoder(bw, s, false).Encode(plan.objects, deltaWindow); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,95 @@
+package gitserve
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+func TestBundleHeader(t *testing.T) {
+	sr := newServedRepo(t, 2)
+	// An archived clone keeps the host's branches as remote-tracking refs.
+	sr.repo.Storer.SetReference(plumbing.NewHashReference("refs/remotes/origin/dev", sr.hashes[0]))
+	sr.repo.Storer.SetReference(plumbing.NewSymbolicReference("refs/remotes/origin/HEAD", "refs/remotes/origin/master"))
+
+	var buf bytes.Buffer
+	if err := WriteBundle(context.Background(), &buf, sr.repo.Storer); err != nil {
+		t.Fatal(err)
+	}
+	var header []string
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() && sc.Text() != "" {
+		header = append(header, sc.Text())
+	}
+	want := []string{
+		"# v2 git bundle",
+		sr.hashes[1].String() + " HEAD",
+		sr.hashes[0].String() + " refs/heads/dev",
+		sr.hashes[1].String() + " refs/heads/master",
+	}
+	if len(header) < len(want) {
+		t.Fatalf("header = %q", header)
+	}
+	for i, line := range want {
+		if header[i] != line {
+			t.Errorf("header line %d = %q, want %q", i, header[i], line)
+		}
+	}
+	if len(header) != 5 || !strings.HasSuffix(header[4], " refs/tags/v1") {
+		t.Errorf("header = %q, want the tag last", header)
+	}
+
+	empty, _ := git.Init(memory.NewStorage(), memfs.New())
+	if err := WriteBundle(context.Background(), &buf, empty.Storer); err != ErrEmptyRepository {
+		t.Errorf("empty repository = %v", err)
+	}
+}
+
+func TestGitClonesBundle(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available")
+	}
+	sr := newServedRepo(t, 3)
+	root := t.TempDir()
+	bundle := filepath.Join(root, "repo.bundle")
+	f, err := os.Create(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteBundle(context.Background(), f, sr.repo.Storer); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	run := func(dir string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(cmd.Environ(), "GIT_CONFIG_NOSYSTEM=1", "HOME="+t.TempDir())
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	run(root, "clone", "--quiet", bundle, "clone")
+	clone := filepath.Join(root, "clone")
+	run(clone, "bundle", "verify", "--quiet", bundle)
+	if got := run(clone, "rev-list", "--count", "HEAD"); got != "3" {
+		t.Errorf("clone has %s commits", got)
+	}
+	if got := run(clone, "tag"); got != "v1" {
+		t.Errorf("tags = %q", got)
+	}
+	run(clone, "fsck", "--strict")
+}
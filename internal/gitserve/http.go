@@ -0,0 +1,59 @@
+package gitserve
+
+import (
+	"compress/gzip"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// ServeHTTP answers one smart HTTP request for the repository in s. rest is
+// the request path below the repository, "/info/refs" or
+// "/git-upload-pack"; anything else, pushes included, is refused.
+func ServeHTTP(w http.ResponseWriter, r *http.Request, s storer.Storer, rest string) {
+	version := ProtocolVersion(r.Header.Get("Git-Protocol"))
+	w.Header().Set("Cache-Control", "no-cache")
+	switch {
+	case rest == "/info/refs" && r.Method == http.MethodGet:
+		switch r.URL.Query().Get("service") {
+		case "git-upload-pack":
+		case "git-receive-pack":
+			http.Error(w, "archived repositories are read-only", http.StatusForbidden)
+			return
+		default:
+			// The dumb protocol reads files out of the repository
+			// directory; every git since 1.6.6 speaks the smart one.
+			http.Error(w, "only smart HTTP clients are supported", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", AdvertisementContentType)
+		if err := AdvertiseRefs(w, s, version); err != nil {
+			log.Printf("git advertisement error: %v", err)
+		}
+	case rest == "/git-upload-pack" && r.Method == http.MethodPost:
+		if r.Header.Get("Content-Type") != RequestContentType {
+			http.Error(w, "unexpected content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, "bad gzip body", http.StatusBadRequest)
+				return
+			}
+			defer gz.Close()
+			body = gz
+		}
+		w.Header().Set("Content-Type", ResultContentType)
+		if err := UploadPack(r.Context(), w, body, s, version); err != nil {
+			log.Printf("git upload-pack error: %v", err)
+		}
+	case rest == "/git-receive-pack":
+		http.Error(w, "archived repositories are read-only", http.StatusForbidden)
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,106 @@
+package gitserve
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Special packets. Protocol v2 adds the delimiter between a request's
+// capabilities and its arguments, and between response sections.
+const (
+	flushPkt = "0000"
+	delimPkt = "0001"
+)
+
+// maxPktData is the most payload one pkt-line carries.
+const maxPktData = 65516
+
+type pktKind int
+
+const (
+	pktData pktKind = iota
+	pktFlush
+	pktDelim
+)
+
+// pktReader reads pkt-lines from a client request.
+type pktReader struct {
+	r   io.Reader
+	buf []byte
+}
+
+func newPktReader(r io.Reader) *pktReader {
+	return &pktReader{r: r, buf: make([]byte, maxPktData)}
+}
+
+// next returns the next packet's kind and, for data packets, its payload
+// without a trailing newline. The payload is only valid until the next call.
+func (p *pktReader) next() (pktKind, string, error) {
+	var head [4]byte
+	if _, err := io.ReadFull(p.r, head[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+		return 0, "", err
+	}
+	n, err := strconv.ParseUint(string(head[:]), 16, 16)
+	if err != nil {
+		return 0, "", fmt.Errorf("gitserve: bad pkt-line length %q", head[:])
+	}
+	switch {
+	case n == 0:
+		return pktFlush, "", nil
+	case n == 1:
+		return pktDelim, "", nil
+	case n < 4 || n-4 > maxPktData:
+		return 0, "", fmt.Errorf("gitserve: bad pkt-line length %d", n)
+	}
+	data := p.buf[:n-4]
+	if _, err := io.ReadFull(p.r, data); err != nil {
+		return 0, "", err
+	}
+	if len(data) > 0 && data[len(data)-1] == '\n' {
+		data = data[:len(data)-1]
+	}
+	return pktData, string(data), nil
+}
+
+// pktWriter writes pkt-lines and remembers the first write error, so a
+// response can be written straight through and checked once.
+type pktWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (p *pktWriter) write(s string) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = io.WriteString(p.w, s)
+}
+
+// line writes one text packet; the trailing newline is added.
+func (p *pktWriter) line(format string, args ...any) {
+	s := fmt.Sprintf(format, args...) + "\n"
+	p.write(fmt.Sprintf("%04x", len(s)+4) + s)
+}
+
+func (p *pktWriter) flush() { p.write(flushPkt) }
+func (p *pktWriter) delim() { p.write(delimPkt) }
+
+// band writes data on a side-band channel in packets of at most max bytes.
+func (p *pktWriter) band(channel byte, data []byte, max int) {
+	for len(data) > 0 && p.err == nil {
+		n := len(data)
+		if n > max-5 {
+			n = max - 5
+		}
+		p.write(fmt.Sprintf("%04x", n+5))
+		if p.err == nil {
+			_, p.err = p.w.Write(append([]byte{channel}, data[:n]...))
+		}
+		data = data[n:]
+	}
+}
@@ -0,0 +1,181 @@
+package gitserve
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+type ref struct {
+	name   string
+	hash   plumbing.Hash
+	peeled plumbing.Hash // the commit an annotated tag names; zero otherwise
+}
+
+type refList struct {
+	refs []ref
+	// head is HEAD's target branch; headHash is zero when it is unborn.
+	head     string
+	headHash plumbing.Hash
+}
+
+// listRefs reads every ref of the repository, sorted by name, and HEAD.
+func listRefs(s storer.Storer) (*refList, error) {
+	iter, err := s.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+	list := &refList{}
+	err = iter.ForEach(func(r *plumbing.Reference) error {
+		if r.Type() != plumbing.HashReference || !strings.HasPrefix(r.Name().String(), "refs/") {
+			return nil
+		}
+		entry := ref{name: r.Name().String(), hash: r.Hash()}
+		if tag, err := object.GetTag(s, r.Hash()); err == nil {
+			entry.peeled = peel(s, tag)
+		}
+		list.refs = append(list.refs, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list.refs, func(i, j int) bool { return list.refs[i].name < list.refs[j].name })
+
+	if head, err := s.Reference(plumbing.HEAD); err == nil {
+		switch head.Type() {
+		case plumbing.SymbolicReference:
+			list.head = head.Target().String()
+			for _, r := range list.refs {
+				if r.name == list.head {
+					list.headHash = r.hash
+				}
+			}
+		case plumbing.HashReference:
+			list.headHash = head.Hash()
+		}
+	}
+	return list, nil
+}
+
+// peel follows a chain of annotated tags to the object at its end.
+func peel(s storer.EncodedObjectStorer, tag *object.Tag) plumbing.Hash {
+	for i := 0; i < 16; i++ {
+		next, err := object.GetTag(s, tag.Target)
+		if err != nil {
+			return tag.Target
+		}
+		tag = next
+	}
+	return tag.Target
+}
+
+// capabilities advertised by protocol v0 and v1. Wants are accepted for
+// any commit in the repository: everything in an archive is public.
+func v0Capabilities(refs *refList) string {
+	caps := []string{
+		"multi_ack", "multi_ack_detailed", "side-band", "side-band-64k", "ofs-delta",
+		"shallow", "deepen-since", "deepen-not", "deepen-relative", "no-progress", "include-tag",
+		"allow-tip-sha1-in-want", "allow-reachable-sha1-in-want",
+	}
+	if refs.head != "" {
+		caps = append(caps, "symref=HEAD:"+refs.head)
+	}
+	return strings.Join(append(caps, "object-format=sha1", "agent="+agent), " ")
+}
+
+// writeV0Refs writes the ref advertisement of protocol v0: HEAD, then every
+// ref with its peeled tag line, capabilities on the first line.
+func writeV0Refs(p *pktWriter, refs *refList) {
+	caps := v0Capabilities(refs)
+	first := true
+	emit := func(hash plumbing.Hash, name string) {
+		if first {
+			p.line("%s %s\x00%s", hash, name, caps)
+			first = false
+			return
+		}
+		p.line("%s %s", hash, name)
+	}
+	if !refs.headHash.IsZero() {
+		emit(refs.headHash, "HEAD")
+	}
+	for _, r := range refs.refs {
+		emit(r.hash, r.name)
+		if !r.peeled.IsZero() {
+			emit(r.peeled, r.name+"^{}")
+		}
+	}
+	if first {
+		// An empty repository still has to say what it supports.
+		emit(plumbing.ZeroHash, "capabilities^{}")
+	}
+	p.flush()
+}
+
+// writeV2Capabilities writes protocol v2's capability advertisement.
+func writeV2Capabilities(p *pktWriter) {
+	p.line("version 2")
+	p.line("agent=%s", agent)
+	p.line("ls-refs=unborn")
+	p.line("fetch=shallow")
+	p.line("server-option")
+	p.line("object-format=sha1")
+	p.flush()
+}
+
+// lsRefs answers protocol v2's ls-refs command.
+func lsRefs(p *pktWriter, refs *refList, args []string) {
+	var symrefs, peelTags, unborn bool
+	var prefixes []string
+	for _, arg := range args {
+		switch {
+		case arg == "symrefs":
+			symrefs = true
+		case arg == "peel":
+			peelTags = true
+		case arg == "unborn":
+			unborn = true
+		case strings.HasPrefix(arg, "ref-prefix "):
+			prefixes = append(prefixes, strings.TrimPrefix(arg, "ref-prefix "))
+		}
+	}
+	wanted := func(name string) bool {
+		if len(prefixes) == 0 {
+			return true
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+	if wanted("HEAD") && (refs.head != "" || !refs.headHash.IsZero()) {
+		line := refs.headHash.String()
+		if refs.headHash.IsZero() {
+			line = "unborn"
+		}
+		line += " HEAD"
+		if symrefs && refs.head != "" {
+			line += " symref-target:" + refs.head
+		}
+		if !refs.headHash.IsZero() || unborn {
+			p.line("%s", line)
+		}
+	}
+	for _, r := range refs.refs {
+		if !wanted(r.name) {
+			continue
+		}
+		line := r.hash.String() + " " + r.name
+		if peelTags && !r.peeled.IsZero() {
+			line += " peeled:" + r.peeled.String()
+		}
+		p.line("%s", line)
+	}
+	p.flush()
+}
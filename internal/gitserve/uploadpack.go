@@ -0,0 +1,409 @@
+// Package gitserve serves archived repositories to git clients over smart
+// HTTP: the fetch side of the protocol (upload-pack), versions 0, 1 and 2,
+// including shallow clones. Pushes are not accepted.
+package gitserve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+const agent = "arker/1"
+
+// Content types of the smart HTTP exchange.
+const (
+	AdvertisementContentType = "application/x-git-upload-pack-advertisement"
+	RequestContentType       = "application/x-git-upload-pack-request"
+	ResultContentType        = "application/x-git-upload-pack-result"
+)
+
+// Side-band packet sizes, the pkt-line header and band byte included.
+const (
+	sideband    = 1000
+	sideband64k = 65520
+)
+
+// deltaWindow is how many objects the pack encoder compares for deltas.
+const deltaWindow = 10
+
+// ErrBadRequest reports a request the protocol does not allow.
+var ErrBadRequest = errors.New("gitserve: malformed request")
+
+// ProtocolVersion reads the version a client asks for in its Git-Protocol
+// header, such as "version=2". Anything unrecognized is version 0.
+func ProtocolVersion(header string) int {
+	for _, field := range strings.Split(header, ":") {
+		switch strings.TrimSpace(field) {
+		case "version=2":
+			return 2
+		case "version=1":
+			return 1
+		}
+	}
+	return 0
+}
+
+// AdvertiseRefs writes the body of GET info/refs?service=git-upload-pack.
+func AdvertiseRefs(w io.Writer, s storer.Storer, version int) error {
+	p := &pktWriter{w: w}
+	p.line("# service=git-upload-pack")
+	p.flush()
+	if version == 2 {
+		writeV2Capabilities(p)
+		return p.err
+	}
+	refs, err := listRefs(s)
+	if err != nil {
+		return err
+	}
+	if version == 1 {
+		p.line("version 1")
+	}
+	writeV0Refs(p, refs)
+	return p.err
+}
+
+// UploadPack answers a POST to git-upload-pack. Over HTTP every request
+// stands alone: the client repeats its wants and haves each round until it
+// says done, and only then is a pack sent.
+func UploadPack(ctx context.Context, w io.Writer, r io.Reader, s storer.Storer, version int) error {
+	refs, err := listRefs(s)
+	if err != nil {
+		return err
+	}
+	if version == 2 {
+		return uploadPackV2(ctx, w, newPktReader(r), s, refs)
+	}
+	return uploadPackV0(ctx, w, newPktReader(r), s, refs)
+}
+
+func uploadPackV0(ctx context.Context, w io.Writer, in *pktReader, s storer.Storer, refs *refList) error {
+	req := &request{}
+	p := &pktWriter{w: w}
+	// negotiating is set once the wants section has ended. A request that
+	// stops there only asks for the shallow list, and gets no ACK or NAK.
+	negotiating := false
+	haveSection := false
+	for {
+		kind, line, err := in.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if negotiating {
+			haveSection = true
+		}
+		if kind == pktFlush {
+			if len(req.wants) == 0 {
+				// The client needs nothing.
+				return nil
+			}
+			negotiating = true
+			continue
+		}
+		if kind != pktData {
+			return ErrBadRequest
+		}
+		if len(req.wants) == 0 && strings.HasPrefix(line, "want ") {
+			// The first want carries the client's capabilities.
+			want, caps, _ := strings.Cut(strings.TrimPrefix(line, "want "), " ")
+			line = "want " + want
+			for _, c := range strings.Fields(caps) {
+				switch c {
+				case "multi_ack":
+					req.ackMode = max(req.ackMode, 1)
+				case "multi_ack_detailed":
+					req.ackMode = 2
+				case "side-band":
+					req.sideband = max(req.sideband, sideband)
+				case "side-band-64k":
+					req.sideband = sideband64k
+				case "include-tag":
+					req.includeTag = true
+				case "no-progress":
+					req.noProgress = true
+				case "deepen-relative":
+					// A capability in v0, an argument in v2.
+					req.relative = true
+				}
+			}
+		}
+		if err := parseFetchLine(req, line); err != nil {
+			p.line("ERR upload-pack: %s", err)
+			return p.err
+		}
+	}
+	if len(req.wants) == 0 {
+		return nil
+	}
+	if err := checkRequest(s, req); err != nil {
+		p.line("ERR upload-pack: %s", err)
+		return p.err
+	}
+
+	var plan *plan
+	if req.deepening() || req.done {
+		var err error
+		if plan, err = newPlan(s, req, refs); err != nil {
+			return err
+		}
+	}
+	if req.deepening() {
+		for _, h := range plan.info.shallow {
+			p.line("shallow %s", h)
+		}
+		for _, h := range plan.info.unshallow {
+			p.line("unshallow %s", h)
+		}
+		p.flush()
+	}
+
+	if !haveSection {
+		return p.err
+	}
+	common := commonHaves(s, req.haves)
+	for i, h := range common {
+		switch {
+		case req.ackMode == 2:
+			p.line("ACK %s common", h)
+		case req.ackMode == 1:
+			p.line("ACK %s continue", h)
+		case i == 0:
+			p.line("ACK %s", h)
+		}
+	}
+	if !req.done {
+		if len(common) == 0 || req.ackMode > 0 {
+			p.line("NAK")
+		}
+		return p.err
+	}
+	switch {
+	case len(common) == 0:
+		p.line("NAK")
+	case req.ackMode > 0:
+		p.line("ACK %s", common[len(common)-1])
+	}
+	if p.err != nil {
+		return p.err
+	}
+	return writePack(ctx, p, s, plan, req)
+}
+
+func uploadPackV2(ctx context.Context, w io.Writer, in *pktReader, s storer.Storer, refs *refList) error {
+	p := &pktWriter{w: w}
+	kind, line, err := in.next()
+	if err != nil {
+		return err
+	}
+	if kind != pktData || !strings.HasPrefix(line, "command=") {
+		return ErrBadRequest
+	}
+	command := strings.TrimPrefix(line, "command=")
+	var args []string
+	inArgs := false
+	for {
+		kind, line, err := in.next()
+		if err != nil {
+			return err
+		}
+		if kind == pktFlush {
+			break
+		}
+		if kind == pktDelim {
+			inArgs = true
+			continue
+		}
+		// Capabilities before the delimiter (agent, object-format) need
+		// no answer.
+		if inArgs {
+			args = append(args, line)
+		}
+	}
+
+	switch command {
+	case "ls-refs":
+		lsRefs(p, refs, args)
+		return p.err
+	case "fetch":
+	default:
+		p.line("ERR unknown command %s", command)
+		return p.err
+	}
+
+	req := &request{sideband: sideband64k}
+	for _, arg := range args {
+		switch arg {
+		case "include-tag":
+			req.includeTag = true
+		case "no-progress":
+			req.noProgress = true
+		case "thin-pack", "ofs-delta":
+		default:
+			if err := parseFetchLine(req, arg); err != nil {
+				p.line("ERR %s", err)
+				return p.err
+			}
+		}
+	}
+	if err := checkRequest(s, req); err != nil {
+		p.line("ERR %s", err)
+		return p.err
+	}
+
+	if !req.done {
+		// Never "ready": the client keeps sending haves until it runs out
+		// and says done, which leaves the smallest pack.
+		p.line("acknowledgments")
+		common := commonHaves(s, req.haves)
+		for _, h := range common {
+			p.line("ACK %s", h)
+		}
+		if len(common) == 0 {
+			p.line("NAK")
+		}
+		p.flush()
+		return p.err
+	}
+
+	plan, err := newPlan(s, req, refs)
+	if err != nil {
+		return err
+	}
+	if req.deepening() {
+		p.line("shallow-info")
+		for _, h := range plan.info.shallow {
+			p.line("shallow %s", h)
+		}
+		for _, h := range plan.info.unshallow {
+			p.line("unshallow %s", h)
+		}
+		p.delim()
+	}
+	p.line("packfile")
+	if p.err != nil {
+		return p.err
+	}
+	return writePack(ctx, p, s, plan, req)
+}
+
+// parseFetchLine reads one line a fetch request shares between versions.
+func parseFetchLine(req *request, line string) error {
+	name, value, _ := strings.Cut(line, " ")
+	switch name {
+	case "want", "have", "shallow":
+		h, ok := parseHash(value)
+		if !ok {
+			return fmt.Errorf("invalid object name %q", value)
+		}
+		switch name {
+		case "want":
+			req.wants = append(req.wants, h)
+		case "have":
+			req.haves = append(req.haves, h)
+		case "shallow":
+			req.shallows = append(req.shallows, h)
+		}
+	case "deepen":
+		depth, err := strconv.Atoi(value)
+		if err != nil || depth < 1 {
+			return fmt.Errorf("invalid depth %q", value)
+		}
+		req.depth = depth
+	case "deepen-since":
+		ts, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid deepen-since %q", value)
+		}
+		req.since = time.Unix(ts, 0)
+	case "deepen-not":
+		req.notRefs = append(req.notRefs, value)
+	case "deepen-relative":
+		req.relative = true
+	case "done":
+		req.done = true
+	default:
+		// filter and want-ref are never advertised, so a client sending
+		// them is confused.
+		return fmt.Errorf("unsupported request %q", name)
+	}
+	return nil
+}
+
+// checkRequest rejects wants the repository cannot serve and combinations
+// of deepen arguments git itself refuses.
+func checkRequest(s storer.Storer, req *request) error {
+	if req.depth > 0 && (!req.since.IsZero() || len(req.notRefs) > 0) {
+		return errors.New("deepen cannot be combined with deepen-since or deepen-not")
+	}
+	if req.relative && req.depth == 0 {
+		return errors.New("deepen-relative needs deepen")
+	}
+	return checkWants(s, req.wants)
+}
+
+func parseHash(s string) (plumbing.Hash, bool) {
+	if !plumbing.IsHash(s) {
+		return plumbing.ZeroHash, false
+	}
+	return plumbing.NewHash(s), true
+}
+
+// writePack encodes the planned objects, multiplexed over the side band
+// when the client asked for one, and ends the response.
+func writePack(ctx context.Context, p *pktWriter, s storer.Storer, plan *plan, req *request) error {
+	var out io.Writer = ctxWriter{ctx: ctx, w: p.w}
+	if req.sideband > 0 {
+		if !req.noProgress {
+			p.band(2, []byte(fmt.Sprintf("Counting objects: %d, done.\n", len(plan.objects))), req.sideband)
+		}
+		out = ctxWriter{ctx: ctx, w: bandWriter{p: p, max: req.sideband}}
+	}
+	if _, err := packfile.NewEncoder(out, s, false).Encode(plan.objects, deltaWindow); err != nil {
+		if req.sideband > 0 && p.err == nil {
+			p.band(3, []byte("upload-pack: "+err.Error()+"\n"), req.sideband)
+		}
+		return err
+	}
+	if req.sideband > 0 {
+		p.flush()
+	}
+	return p.err
+}
+
+type bandWriter struct {
+	p   *pktWriter
+	max int
+}
+
+func (b bandWriter) Write(data []byte) (int, error) {
+	b.p.band(1, data, b.max)
+	if b.p.err != nil {
+		return 0, b.p.err
+	}
+	return len(data), nil
+}
+
+// ctxWriter stops a pack mid-stream once the client has gone away.
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (c ctxWriter) Write(data []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.w.Write(data)
+}
@@ -0,0 +1,214 @@
+package gitserve
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// servedRepo is a repository with a linear history served over smart HTTP;
+// commit adds to it while it is being served.
+type servedRepo struct {
+	t      *testing.T
+	repo   *git.Repository
+	url    string
+	hashes []plumbing.Hash
+	when   time.Time
+}
+
+func newServedRepo(t *testing.T, commits int) *servedRepo {
+	t.Helper()
+	repo, err := git.Init(memory.NewStorage(), memfs.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr := &servedRepo{t: t, repo: repo, when: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	for i := 0; i < commits; i++ {
+		sr.commit()
+	}
+	if _, err := repo.CreateTag("v1", sr.hashes[0], &git.CreateTagOptions{
+		Tagger: &object.Signature{Name: "Ana", When: sr.when}, Message: "First",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.StripPrefix("/repo", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeHTTP(w, r, repo.Storer, r.URL.Path)
+	})))
+	t.Cleanup(server.Close)
+	sr.url = server.URL + "/repo"
+	return sr
+}
+
+func (sr *servedRepo) commit() plumbing.Hash {
+	wt, _ := sr.repo.Worktree()
+	n := len(sr.hashes) + 1
+	f, _ := wt.Filesystem.Create(fmt.Sprintf("file%d.txt", n))
+	fmt.Fprintf(f, "content %d\n", n)
+	f.Close()
+	wt.Add(fmt.Sprintf("file%d.txt", n))
+	sr.when = sr.when.Add(24 * time.Hour)
+	h, err := wt.Commit(fmt.Sprintf("Commit %d", n), &git.CommitOptions{
+		Author: &object.Signature{Name: "Ana", Email: "ana@example.com", When: sr.when},
+	})
+	if err != nil {
+		sr.t.Fatal(err)
+	}
+	sr.hashes = append(sr.hashes, h)
+	return h
+}
+
+func TestGoGitClientClones(t *testing.T) {
+	sr := newServedRepo(t, 4)
+
+	full, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{URL: sr.url, Tags: git.AllTags})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countCommits(t, full); n != 4 {
+		t.Errorf("full clone has %d commits, want 4", n)
+	}
+	if _, err := full.Tag("v1"); err != nil {
+		t.Errorf("tag not cloned: %v", err)
+	}
+
+	shallow, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{URL: sr.url, Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countCommits(t, shallow); n != 1 {
+		t.Errorf("depth 1 clone has %d commits, want 1", n)
+	}
+	if boundary, _ := shallow.Storer.Shallow(); len(boundary) != 1 || boundary[0] != sr.hashes[3] {
+		t.Errorf("shallow boundary = %v, want the tip", boundary)
+	}
+}
+
+func countCommits(t *testing.T, repo *git.Repository) int {
+	t.Helper()
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	c, err := repo.CommitObject(head.Hash())
+	for err == nil {
+		n++
+		if c.NumParents() == 0 {
+			break
+		}
+		c, err = c.Parent(0)
+	}
+	return n
+}
+
+// TestGitClientProtocols drives the real git client through both protocol
+// versions: a full clone, a shallow clone deepened step by step, and an
+// incremental fetch after the repository gains a commit.
+func TestGitClientProtocols(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not available")
+	}
+	for _, version := range []string{"0", "2"} {
+		t.Run("v"+version, func(t *testing.T) {
+			sr := newServedRepo(t, 5)
+			run := func(dir string, args ...string) string {
+				t.Helper()
+				cmd := exec.Command("git", append([]string{"-c", "protocol.version=" + version}, args...)...)
+				cmd.Dir = dir
+				cmd.Env = append(cmd.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_CONFIG_NOSYSTEM=1", "HOME="+t.TempDir())
+				out, err := cmd.CombinedOutput()
+				if err != nil {
+					t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+				}
+				return strings.TrimSpace(string(out))
+			}
+			root := t.TempDir()
+
+			run(root, "clone", "--quiet", sr.url, "full")
+			full := filepath.Join(root, "full")
+			if got := run(full, "rev-list", "--count", "HEAD"); got != "5" {
+				t.Errorf("full clone has %s commits", got)
+			}
+			if got := run(full, "tag"); got != "v1" {
+				t.Errorf("tags = %q", got)
+			}
+			run(full, "fsck", "--strict")
+
+			run(root, "clone", "--quiet", "--depth", "2", sr.url, "shallow")
+			shallow := filepath.Join(root, "shallow")
+			if got := run(shallow, "rev-list", "--count", "HEAD"); got != "2" {
+				t.Errorf("depth 2 clone has %s commits", got)
+			}
+			run(shallow, "fetch", "--quiet", "--deepen=2")
+			if got := run(shallow, "rev-list", "--count", "HEAD"); got != "4" {
+				t.Errorf("deepened clone has %s commits", got)
+			}
+			run(shallow, "fetch", "--quiet", "--unshallow")
+			if got := run(shallow, "rev-list", "--count", "HEAD"); got != "5" {
+				t.Errorf("unshallowed clone has %s commits", got)
+			}
+			run(shallow, "fsck", "--strict")
+
+			since := sr.when.Add(-36 * time.Hour).Format(time.RFC3339)
+			run(root, "clone", "--quiet", "--shallow-since="+since, sr.url, "since")
+			if got := run(filepath.Join(root, "since"), "rev-list", "--count", "HEAD"); got != "2" {
+				t.Errorf("shallow-since clone has %s commits", got)
+			}
+			run(root, "clone", "--quiet", "--shallow-exclude=v1", sr.url, "exclude")
+			if got := run(filepath.Join(root, "exclude"), "rev-list", "--count", "HEAD"); got != "4" {
+				t.Errorf("shallow-exclude clone has %s commits", got)
+			}
+
+			tip := sr.commit()
+			run(full, "pull", "--quiet", "--ff-only")
+			if got := run(full, "rev-parse", "HEAD"); got != tip.String() {
+				t.Errorf("after fetch HEAD = %s, want %s", got, tip)
+			}
+			run(full, "fsck", "--strict")
+		})
+	}
+}
+
+func TestRefusesPushAndDumbClients(t *testing.T) {
+	sr := newServedRepo(t, 1)
+	for _, path := range []string{"/info/refs?service=git-receive-pack", "/info/refs"} {
+		resp, err := http.Get(sr.url + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%s = %d, want 403", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestAdvertisement(t *testing.T) {
+	sr := newServedRepo(t, 2)
+	var v0, v2 strings.Builder
+	if err := AdvertiseRefs(&v0, sr.repo.Storer, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"001e# service=git-upload-pack\n0000", sr.hashes[1].String() + " HEAD\x00", "symref=HEAD:refs/heads/master", "refs/tags/v1^{}", "shallow"} {
+		if !strings.Contains(v0.String(), want) {
+			t.Errorf("v0 advertisement lacks %q:\n%s", want, v0.String())
+		}
+	}
+	if err := AdvertiseRefs(&v2, sr.repo.Storer, 2); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(v2.String(), "version 2\n") || !strings.Contains(v2.String(), "fetch=shallow\n") {
+		t.Errorf("v2 advertisement = %q", v2.String())
+	}
+}
@@ -0,0 +1,319 @@
+package gitserve
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// request is a fetch as both protocol versions express it.
+type request struct {
+	wants    []plumbing.Hash
+	haves    []plumbing.Hash
+	shallows []plumbing.Hash // the client's current shallow boundary
+	depth    int
+	since    time.Time
+	// notRefs are refs whose history the client does not want (deepen-not).
+	notRefs  []string
+	relative bool // depth counts from the client's boundary, not the wants
+	done     bool
+
+	includeTag bool
+	noProgress bool
+	sideband   int // largest side-band packet, 0 for none
+	ackMode    int // 0 single ack, 1 multi_ack, 2 multi_ack_detailed
+}
+
+func (r *request) deepening() bool {
+	return r.depth > 0 || !r.since.IsZero() || len(r.notRefs) > 0
+}
+
+// shallowInfo is the change to the client's shallow boundary.
+type shallowInfo struct {
+	shallow   []plumbing.Hash
+	unshallow []plumbing.Hash
+}
+
+// plan decides what a fetch sends: the objects of the pack and, for a
+// shallow fetch, the client's new boundary.
+type plan struct {
+	s       storer.Storer
+	objects []plumbing.Hash
+	seen    map[plumbing.Hash]bool
+	info    shallowInfo
+}
+
+// commonHaves returns the haves the repository holds, in request order.
+func commonHaves(s storer.Storer, haves []plumbing.Hash) []plumbing.Hash {
+	var common []plumbing.Hash
+	for _, h := range haves {
+		if s.HasEncodedObject(h) == nil {
+			common = append(common, h)
+		}
+	}
+	return common
+}
+
+// checkWants rejects wants the repository cannot serve.
+func checkWants(s storer.Storer, wants []plumbing.Hash) error {
+	for _, want := range wants {
+		obj, err := s.EncodedObject(plumbing.AnyObject, want)
+		if err != nil {
+			return fmt.Errorf("not our ref %s", want)
+		}
+		if obj.Type() != plumbing.CommitObject && obj.Type() != plumbing.TagObject {
+			return fmt.Errorf("not a commit %s", want)
+		}
+	}
+	return nil
+}
+
+// newPlan works out the pack for a fetch. The client is taken to hold
+// every object reachable from its haves, except beyond its shallow
+// boundary, where it holds nothing.
+func newPlan(s storer.Storer, req *request, refs *refList) (*plan, error) {
+	p := &plan{s: s, seen: map[plumbing.Hash]bool{}}
+	clientShallow := map[plumbing.Hash]bool{}
+	for _, h := range req.shallows {
+		clientShallow[h] = true
+	}
+
+	// Mark what the client already has, so nothing of it is sent again.
+	had := map[plumbing.Hash]bool{}
+	if err := p.walkCommits(commonHaves(s, req.haves), func(c *object.Commit, _ int) ([]plumbing.Hash, error) {
+		had[c.Hash] = true
+		if err := p.markTree(c.TreeHash); err != nil {
+			return nil, err
+		}
+		if clientShallow[c.Hash] {
+			return nil, nil
+		}
+		return c.ParentHashes, nil
+	}); err != nil {
+		return nil, err
+	}
+	for h := range had {
+		p.seen[h] = true
+	}
+
+	// Peel the wants to commits; tags asked for by hash go in the pack.
+	var tips []plumbing.Hash
+	for _, want := range req.wants {
+		h := want
+		for {
+			tag, err := object.GetTag(s, h)
+			if err != nil {
+				break
+			}
+			p.add(h)
+			h = tag.Target
+		}
+		tips = append(tips, h)
+	}
+
+	excluded, err := p.excludedCommits(refs, req.notRefs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk from the tips. Without deepening the client's own commits and its
+	// shallow boundary stop the walk; with it the boundary is recomputed
+	// and the old one may move. limit is the depth at which the walk stops
+	// and leaves a new boundary, 0 for none.
+	newShallow := map[plumbing.Hash]bool{}
+	included := map[plumbing.Hash]bool{}
+	walk := func(tips []plumbing.Hash, deepen bool, limit int) error {
+		return p.walkCommits(tips, func(c *object.Commit, depth int) ([]plumbing.Hash, error) {
+			included[c.Hash] = true
+			if !had[c.Hash] {
+				p.add(c.Hash)
+				if err := p.addTree(c.TreeHash); err != nil {
+					return nil, err
+				}
+			}
+			if !deepen {
+				if had[c.Hash] || clientShallow[c.Hash] {
+					return nil, nil
+				}
+				return c.ParentHashes, nil
+			}
+			if len(c.ParentHashes) == 0 {
+				return nil, nil
+			}
+			if limit > 0 && depth >= limit {
+				newShallow[c.Hash] = true
+				return nil, nil
+			}
+			for _, parent := range c.ParentHashes {
+				cut := excluded[parent]
+				if !cut && !req.since.IsZero() {
+					pc, err := object.GetCommit(s, parent)
+					if err != nil {
+						return nil, err
+					}
+					cut = pc.Committer.When.Before(req.since)
+				}
+				if cut {
+					newShallow[c.Hash] = true
+					return nil, nil
+				}
+			}
+			return c.ParentHashes, nil
+		})
+	}
+	if req.relative {
+		// New commits down to what the client has, then depth more
+		// generations below its boundary, whose commits count as 1.
+		err = walk(tips, false, 0)
+		if err == nil {
+			err = walk(req.shallows, true, req.depth+1)
+		}
+	} else {
+		err = walk(tips, req.deepening(), req.depth)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if req.deepening() {
+		for h := range newShallow {
+			if !clientShallow[h] {
+				p.info.shallow = append(p.info.shallow, h)
+			}
+		}
+		for _, h := range req.shallows {
+			if included[h] && !newShallow[h] {
+				p.info.unshallow = append(p.info.unshallow, h)
+			}
+		}
+		plumbing.HashesSort(p.info.shallow)
+		plumbing.HashesSort(p.info.unshallow)
+	}
+
+	if req.includeTag {
+		for _, r := range refs.refs {
+			if r.peeled.IsZero() || p.seen[r.hash] || !included[r.peeled] {
+				continue
+			}
+			p.add(r.hash)
+		}
+	}
+	return p, nil
+}
+
+// excludedCommits resolves deepen-not refs, by full or short name, to
+// every commit reachable from them.
+func (p *plan) excludedCommits(refs *refList, names []string) (map[plumbing.Hash]bool, error) {
+	excluded := map[plumbing.Hash]bool{}
+	var tips []plumbing.Hash
+	for _, name := range names {
+		found := false
+		for _, r := range refs.refs {
+			if r.name == name || r.name == "refs/heads/"+name || r.name == "refs/tags/"+name {
+				tip := r.hash
+				if !r.peeled.IsZero() {
+					tip = r.peeled
+				}
+				tips = append(tips, tip)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("deepen-not is not a ref: %s", name)
+		}
+	}
+	err := p.walkCommits(tips, func(c *object.Commit, _ int) ([]plumbing.Hash, error) {
+		excluded[c.Hash] = true
+		return c.ParentHashes, nil
+	})
+	return excluded, err
+}
+
+// walkCommits visits commits breadth first from tips, each once at the
+// shortest distance from a tip (a tip is at 1). visit returns the parents
+// to continue to.
+func (p *plan) walkCommits(tips []plumbing.Hash, visit func(*object.Commit, int) ([]plumbing.Hash, error)) error {
+	type item struct {
+		hash  plumbing.Hash
+		depth int
+	}
+	visited := map[plumbing.Hash]bool{}
+	queue := make([]item, 0, len(tips))
+	for _, tip := range tips {
+		queue = append(queue, item{tip, 1})
+	}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if visited[next.hash] {
+			continue
+		}
+		visited[next.hash] = true
+		c, err := object.GetCommit(p.s, next.hash)
+		if err != nil {
+			return fmt.Errorf("commit %s: %w", next.hash, err)
+		}
+		parents, err := visit(c, next.depth)
+		if err != nil {
+			return err
+		}
+		for _, parent := range parents {
+			if !visited[parent] {
+				queue = append(queue, item{parent, next.depth + 1})
+			}
+		}
+	}
+	return nil
+}
+
+func (p *plan) add(h plumbing.Hash) {
+	if p.seen[h] {
+		return
+	}
+	p.seen[h] = true
+	p.objects = append(p.objects, h)
+}
+
+// addTree adds a tree and everything under it that is not already known.
+func (p *plan) addTree(h plumbing.Hash) error {
+	return p.eachTreeObject(h, p.add)
+}
+
+// markTree records a tree and everything under it as held by the client.
+func (p *plan) markTree(h plumbing.Hash) error {
+	return p.eachTreeObject(h, func(h plumbing.Hash) { p.seen[h] = true })
+}
+
+// eachTreeObject calls fn for the tree and each tree and blob below it,
+// skipping subtrees already seen: a subtree unchanged between commits is
+// walked once.
+func (p *plan) eachTreeObject(h plumbing.Hash, fn func(plumbing.Hash)) error {
+	if p.seen[h] {
+		return nil
+	}
+	tree, err := object.GetTree(p.s, h)
+	if err != nil {
+		return fmt.Errorf("tree %s: %w", h, err)
+	}
+	fn(h)
+	for _, e := range tree.Entries {
+		switch e.Mode {
+		case filemode.Submodule:
+			// A commit in another repository.
+		case filemode.Dir:
+			if err := p.eachTreeObject(e.Hash, fn); err != nil {
+				return err
+			}
+		default:
+			if !p.seen[e.Hash] {
+				fn(e.Hash)
+			}
+		}
+	}
+	return nil
+}
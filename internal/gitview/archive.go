@@ -0,0 +1,185 @@
+package gitview
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Source archive formats.
+const (
+	FormatTarGz = "tar.gz"
+	FormatZip   = "zip"
+)
+
+// WriteArchive writes the tree of a commit as a source archive, the way
+// `git archive` and a host's download links do: every file under prefix/,
+// timestamped with the commit, executables and symlinks kept, submodules as
+// empty directories. The commit hash is the archive's comment.
+func (r *Repository) WriteArchive(ctx context.Context, w io.Writer, commit *object.Commit, format, prefix string) error {
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+	var a archiveWriter
+	switch format {
+	case FormatTarGz:
+		a, err = newTarGzWriter(w, commit)
+	case FormatZip:
+		a, err = newZipWriter(w, commit)
+	default:
+		return fmt.Errorf("gitview: unknown archive format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+	if err := a.dir(prefix + "/"); err != nil {
+		return err
+	}
+
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		full := path.Join(prefix, name)
+		switch entry.Mode {
+		case filemode.Dir, filemode.Submodule:
+			err = a.dir(full + "/")
+		case filemode.Regular, filemode.Deprecated, filemode.Executable, filemode.Symlink:
+			var blob *object.Blob
+			if blob, err = r.repo.BlobObject(entry.Hash); err != nil {
+				return err
+			}
+			var content io.ReadCloser
+			if content, err = blob.Reader(); err != nil {
+				return err
+			}
+			err = a.file(full, entry.Mode, blob.Size, content)
+			content.Close()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return a.close()
+}
+
+// archiveWriter is one archive format.
+type archiveWriter interface {
+	dir(name string) error
+	file(name string, mode filemode.FileMode, size int64, content io.Reader) error
+	close() error
+}
+
+type tarGzWriter struct {
+	gz      *gzip.Writer
+	tw      *tar.Writer
+	modTime time.Time
+}
+
+func newTarGzWriter(w io.Writer, commit *object.Commit) (*tarGzWriter, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	// git archive's pax header, which `git get-tar-commit-id` reads.
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeXGlobalHeader,
+		Name:       "pax_global_header",
+		PAXRecords: map[string]string{"comment": commit.Hash.String()},
+		Format:     tar.FormatPAX,
+	}); err != nil {
+		return nil, err
+	}
+	return &tarGzWriter{gz: gz, tw: tw, modTime: commit.Committer.When}, nil
+}
+
+func (t *tarGzWriter) dir(name string) error {
+	return t.tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: name, Mode: 0775, ModTime: t.modTime})
+}
+
+func (t *tarGzWriter) file(name string, mode filemode.FileMode, size int64, content io.Reader) error {
+	hdr := &tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0664, Size: size, ModTime: t.modTime}
+	switch mode {
+	case filemode.Executable:
+		hdr.Mode = 0775
+	case filemode.Symlink:
+		target, err := io.ReadAll(content)
+		if err != nil {
+			return err
+		}
+		hdr = &tar.Header{Typeflag: tar.TypeSymlink, Name: name, Linkname: string(target), Mode: 0777, ModTime: t.modTime}
+		return t.tw.WriteHeader(hdr)
+	}
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := io.Copy(t.tw, content)
+	return err
+}
+
+func (t *tarGzWriter) close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	return t.gz.Close()
+}
+
+type zipWriter struct {
+	zw      *zip.Writer
+	modTime time.Time
+}
+
+func newZipWriter(w io.Writer, commit *object.Commit) (*zipWriter, error) {
+	zw := zip.NewWriter(w)
+	if err := zw.SetComment(commit.Hash.String()); err != nil {
+		return nil, err
+	}
+	return &zipWriter{zw: zw, modTime: commit.Committer.When}, nil
+}
+
+func (z *zipWriter) dir(name string) error {
+	hdr := &zip.FileHeader{Name: name, Modified: z.modTime}
+	hdr.SetMode(fs.ModeDir | 0775)
+	_, err := z.zw.CreateHeader(hdr)
+	return err
+}
+
+func (z *zipWriter) file(name string, mode filemode.FileMode, size int64, content io.Reader) error {
+	hdr := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: z.modTime}
+	switch mode {
+	case filemode.Executable:
+		hdr.SetMode(0775)
+	case filemode.Symlink:
+		hdr.SetMode(fs.ModeSymlink | 0777)
+		hdr.Method = zip.Store
+	default:
+		hdr.SetMode(0664)
+	}
+	w, err := z.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, content)
+	return err
+}
+
+func (z *zipWriter) close() error {
+	return z.zw.Close()
+}
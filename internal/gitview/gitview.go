@@ -0,0 +1,578 @@
+// Package gitview reads an archived repository for the web browser: its
+// branches and tags, trees, files, history and the diff of each commit. It
+// works on the stored repository directly through go-git, so nothing is
+// checked out and no git binary is involved.
+package gitview
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// ErrNotFound is returned for a revision or path the repository does not
+// have.
+var ErrNotFound = errors.New("gitview: not found")
+
+// Limits that keep one page cheap however large the repository is.
+const (
+	// MaxBlobSize is the largest file shown inline; larger ones are offered
+	// raw only.
+	MaxBlobSize = 1 << 20
+	// MaxDiffLines bounds the lines rendered for one commit.
+	MaxDiffLines = 5000
+)
+
+// Ref kinds.
+const (
+	RefBranch = "branch"
+	RefTag    = "tag"
+)
+
+// Ref is a branch or tag and the commit it names.
+type Ref struct {
+	Name string
+	Kind string
+	Hash string
+	Date time.Time
+}
+
+// Entry is one item of a tree listing.
+type Entry struct {
+	Name string
+	// Path is relative to the repository root.
+	Path      string
+	IsDir     bool
+	Submodule bool
+	// Commit is the commit a submodule entry pins.
+	Commit string
+	Size   int64
+}
+
+// File is a blob at a path. Content is nil when the file is binary or over
+// MaxBlobSize.
+type File struct {
+	Path    string
+	Size    int64
+	Binary  bool
+	Content []byte
+}
+
+// Commit is the summary of one commit.
+type Commit struct {
+	Hash        string
+	Author      string
+	AuthorEmail string
+	Date        time.Time
+	Subject     string
+	Body        string
+	Parents     []string
+}
+
+// Short is the abbreviated hash shown in listings.
+func (c Commit) Short() string {
+	if len(c.Hash) > 10 {
+		return c.Hash[:10]
+	}
+	return c.Hash
+}
+
+// Diff line kinds.
+const (
+	LineContext = "context"
+	LineAdded   = "added"
+	LineDeleted = "deleted"
+	// LineGap stands for unchanged lines left out; Old and New are the
+	// numbers the diff resumes at.
+	LineGap = "gap"
+)
+
+// DiffLine is one line of a file's diff, numbered on the side it exists on.
+type DiffLine struct {
+	Kind string
+	Old  int
+	New  int
+	Text string
+}
+
+// FileDiff is the change to one file in a commit.
+type FileDiff struct {
+	From   string
+	To     string
+	Status string // added, deleted, modified or renamed
+	Binary bool
+	Lines  []DiffLine
+}
+
+// Path names the file by its post-commit path, or the deleted one.
+func (d FileDiff) Path() string {
+	if d.To != "" {
+		return d.To
+	}
+	return d.From
+}
+
+// Repository browses one repository.
+type Repository struct {
+	repo *git.Repository
+}
+
+// Open opens a repository stored at dir, bare or not.
+func Open(dir string) (*Repository, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+	return New(repo), nil
+}
+
+// New wraps an already open repository.
+func New(repo *git.Repository) *Repository {
+	return &Repository{repo: repo}
+}
+
+// Refs lists branches and tags, each sorted by name. An archived clone keeps
+// the remote's branches as refs/remotes/origin/*; they are listed as
+// branches, since that is what they were on the host.
+func (r *Repository) Refs() (branches, tags []Ref, err error) {
+	iter, err := r.repo.References()
+	if err != nil {
+		return nil, nil, err
+	}
+	seen := map[string]bool{}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name()
+		var short, kind string
+		switch {
+		case name.IsBranch():
+			short, kind = name.Short(), RefBranch
+		case name.IsRemote() && strings.HasPrefix(name.String(), "refs/remotes/origin/"):
+			short, kind = strings.TrimPrefix(name.String(), "refs/remotes/origin/"), RefBranch
+			if short == "HEAD" {
+				return nil
+			}
+		case name.IsTag():
+			short, kind = name.Short(), RefTag
+		default:
+			return nil
+		}
+		if seen[kind+"\x00"+short] {
+			return nil
+		}
+		seen[kind+"\x00"+short] = true
+		out := Ref{Name: short, Kind: kind}
+		if commit, err := r.commitOf(ref); err == nil {
+			out.Hash, out.Date = commit.Hash.String(), commit.Committer.When
+		}
+		if kind == RefTag {
+			tags = append(tags, out)
+		} else {
+			branches = append(branches, out)
+		}
+		return nil
+	})
+	byName := func(refs []Ref) {
+		sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+	}
+	byName(branches)
+	byName(tags)
+	return branches, tags, err
+}
+
+// commitOf peels a reference, through an annotated tag, to its commit.
+func (r *Repository) commitOf(ref *plumbing.Reference) (*object.Commit, error) {
+	if ref.Type() == plumbing.SymbolicReference {
+		resolved, err := r.repo.Reference(ref.Name(), true)
+		if err != nil {
+			return nil, err
+		}
+		ref = resolved
+	}
+	hash := ref.Hash()
+	if tag, err := r.repo.TagObject(hash); err == nil {
+		commit, err := tag.Commit()
+		if err != nil {
+			return nil, err
+		}
+		return commit, nil
+	}
+	return r.repo.CommitObject(hash)
+}
+
+// DefaultBranch is the branch HEAD names, or "" when HEAD is detached or
+// missing.
+func (r *Repository) DefaultBranch() string {
+	head, err := r.repo.Reference(plumbing.HEAD, false)
+	if err != nil || head.Type() != plumbing.SymbolicReference {
+		return ""
+	}
+	return head.Target().Short()
+}
+
+// Resolve splits URL path segments into a revision and a path within it.
+// Branch names may contain slashes, so the longest prefix that names a
+// branch, tag or commit wins.
+func (r *Repository) Resolve(segments []string) (rev string, commit *object.Commit, rest string, err error) {
+	for n := len(segments); n >= 1; n-- {
+		candidate := strings.Join(segments[:n], "/")
+		if c, err := r.commit(candidate); err == nil {
+			return candidate, c, strings.Join(segments[n:], "/"), nil
+		}
+	}
+	return "", nil, "", ErrNotFound
+}
+
+// Commit looks up a revision: a branch, a tag or a full or abbreviated hash.
+func (r *Repository) Commit(rev string) (*object.Commit, error) {
+	return r.commit(rev)
+}
+
+func (r *Repository) commit(rev string) (*object.Commit, error) {
+	if rev == "" || strings.HasPrefix(rev, "-") {
+		return nil, ErrNotFound
+	}
+	for _, name := range []plumbing.ReferenceName{
+		plumbing.NewBranchReferenceName(rev),
+		plumbing.NewRemoteReferenceName("origin", rev),
+		plumbing.NewTagReferenceName(rev),
+	} {
+		if ref, err := r.repo.Reference(name, true); err == nil {
+			return r.commitOf(ref)
+		}
+	}
+	if !isHex(rev) || len(rev) < 4 || len(rev) > 40 {
+		return nil, ErrNotFound
+	}
+	if len(rev) == 40 {
+		if c, err := r.repo.CommitObject(plumbing.NewHash(rev)); err == nil {
+			return c, nil
+		}
+		return nil, ErrNotFound
+	}
+	hash, err := r.repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return r.repo.CommitObject(*hash)
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Tree lists a directory of a commit, directories first.
+func (r *Repository) Tree(commit *object.Commit, dir string) ([]Entry, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if tree, err = tree.Tree(dir); err != nil {
+			return nil, ErrNotFound
+		}
+	}
+	entries := make([]Entry, 0, len(tree.Entries))
+	for _, e := range tree.Entries {
+		entry := Entry{Name: e.Name, Path: path.Join(dir, e.Name)}
+		switch e.Mode {
+		case filemode.Dir:
+			entry.IsDir = true
+		case filemode.Submodule:
+			entry.Submodule = true
+			entry.Commit = e.Hash.String()
+		default:
+			if size, err := r.repo.Storer.EncodedObjectSize(e.Hash); err == nil {
+				entry.Size = size
+			}
+		}
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		return strings.ToLower(entries[i].Name) < strings.ToLower(entries[j].Name)
+	})
+	return entries, nil
+}
+
+// IsDir reports whether p is a directory in the commit. The root always is.
+func (r *Repository) IsDir(commit *object.Commit, p string) bool {
+	if p == "" {
+		return true
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return false
+	}
+	_, err = tree.Tree(p)
+	return err == nil
+}
+
+// File reads a file of a commit for display.
+func (r *Repository) File(commit *object.Commit, p string) (*File, error) {
+	f, err := commit.File(p)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	out := &File{Path: p, Size: f.Size}
+	if f.Size > MaxBlobSize {
+		return out, nil
+	}
+	reader, err := f.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if isBinary(content) {
+		out.Binary = true
+		return out, nil
+	}
+	out.Content = content
+	return out, nil
+}
+
+// Raw streams a file of a commit, whatever its size.
+func (r *Repository) Raw(commit *object.Commit, p string) (io.ReadCloser, int64, error) {
+	f, err := commit.File(p)
+	if err != nil {
+		return nil, 0, ErrNotFound
+	}
+	reader, err := f.Reader()
+	return reader, f.Size, err
+}
+
+// isBinary uses git's own test: a NUL byte in the first 8000 bytes.
+func isBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
+
+// Readme finds the README of a directory, preferring Markdown.
+func (r *Repository) Readme(entries []Entry) (Entry, bool) {
+	best, found := Entry{}, false
+	for _, e := range entries {
+		if e.IsDir || e.Submodule {
+			continue
+		}
+		lower := strings.ToLower(e.Name)
+		if lower != "readme" && !strings.HasPrefix(lower, "readme.") {
+			continue
+		}
+		if !found || (IsMarkdown(e.Name) && !IsMarkdown(best.Name)) {
+			best, found = e, true
+		}
+	}
+	return best, found
+}
+
+// IsMarkdown reports whether a file name is rendered as Markdown.
+func IsMarkdown(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md", ".markdown", ".mdown", ".mkd":
+		return true
+	}
+	return false
+}
+
+// Log returns up to limit commits reachable from commit, newest first,
+// after skipping skip of them. When p is set only commits that touch it are
+// listed. more reports whether the history continues.
+func (r *Repository) Log(commit *object.Commit, p string, skip, limit int) (commits []Commit, more bool, err error) {
+	opts := &git.LogOptions{From: commit.Hash, Order: git.LogOrderCommitterTime}
+	if p != "" {
+		prefix := p + "/"
+		opts.PathFilter = func(name string) bool { return name == p || strings.HasPrefix(name, prefix) }
+	}
+	iter, err := r.repo.Log(opts)
+	if err != nil {
+		return nil, false, err
+	}
+	defer iter.Close()
+	seen := 0
+	err = iter.ForEach(func(c *object.Commit) error {
+		seen++
+		if seen <= skip {
+			return nil
+		}
+		if len(commits) == limit {
+			more = true
+			return storer.ErrStop
+		}
+		commits = append(commits, summarize(c))
+		return nil
+	})
+	return commits, more, err
+}
+
+func summarize(c *object.Commit) Commit {
+	subject, body, _ := strings.Cut(strings.TrimSpace(c.Message), "\n")
+	out := Commit{
+		Hash: c.Hash.String(), Author: c.Author.Name, AuthorEmail: c.Author.Email, Date: c.Author.When,
+		Subject: strings.TrimSpace(subject), Body: strings.TrimSpace(body),
+	}
+	for _, parent := range c.ParentHashes {
+		out.Parents = append(out.Parents, parent.String())
+	}
+	return out
+}
+
+// Summary describes a commit without its diff.
+func (r *Repository) Summary(commit *object.Commit) Commit {
+	return summarize(commit)
+}
+
+// Diff is the change a commit made, against its first parent (or nothing,
+// for a root commit). truncated reports that MaxDiffLines cut it short.
+func (r *Repository) Diff(ctx context.Context, commit *object.Commit) (diffs []FileDiff, truncated bool, err error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, false, err
+	}
+	var parentTree *object.Tree
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return nil, false, err
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return nil, false, err
+		}
+	}
+	changes, err := object.DiffTreeWithOptions(ctx, parentTree, tree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, false, err
+	}
+	patch, err := changes.PatchContext(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	budget := MaxDiffLines
+	for _, fp := range patch.FilePatches() {
+		from, to := fp.Files()
+		d := FileDiff{Binary: fp.IsBinary()}
+		if from != nil {
+			d.From = from.Path()
+		}
+		if to != nil {
+			d.To = to.Path()
+		}
+		switch {
+		case from == nil:
+			d.Status = "added"
+		case to == nil:
+			d.Status = "deleted"
+		case d.From != d.To:
+			d.Status = "renamed"
+		default:
+			d.Status = "modified"
+		}
+		if !d.Binary {
+			if budget <= 0 {
+				truncated = true
+			} else {
+				d.Lines, budget = diffLines(fp.Chunks(), budget)
+				if budget <= 0 {
+					truncated = true
+				}
+			}
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs, truncated, nil
+}
+
+// diffContext is how many unchanged lines are kept around each change.
+const diffContext = 3
+
+// diffLines numbers a file's chunks, keeping diffContext unchanged lines
+// around each change and marking the gaps, and spends at most budget lines.
+func diffLines(chunks []fdiff.Chunk, budget int) ([]DiffLine, int) {
+	var out []DiffLine
+	oldLine, newLine := 1, 1
+	emit := func(line DiffLine) bool {
+		if budget == 0 {
+			return false
+		}
+		budget--
+		out = append(out, line)
+		return true
+	}
+	for i, chunk := range chunks {
+		lines := strings.SplitAfter(chunk.Content(), "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		if chunk.Type() == fdiff.Equal {
+			// Keep the tail of the context before a change and the head of
+			// the context after one; the middle becomes a gap.
+			head, tail := diffContext, diffContext
+			if i == 0 {
+				head = 0
+			}
+			if i == len(chunks)-1 {
+				tail = 0
+			}
+			if len(lines) > head+tail {
+				for _, text := range lines[:head] {
+					if !emit(DiffLine{Kind: LineContext, Old: oldLine, New: newLine, Text: strings.TrimSuffix(text, "\n")}) {
+						return out, 0
+					}
+					oldLine++
+					newLine++
+				}
+				skipped := len(lines) - head - tail
+				oldLine += skipped
+				newLine += skipped
+				if !emit(DiffLine{Kind: LineGap, Old: oldLine, New: newLine}) {
+					return out, 0
+				}
+				lines = lines[len(lines)-tail:]
+			}
+		}
+		for _, text := range lines {
+			line := DiffLine{Text: strings.TrimSuffix(text, "\n")}
+			switch chunk.Type() {
+			case fdiff.Add:
+				line.Kind, line.New = LineAdded, newLine
+				newLine++
+			case fdiff.Delete:
+				line.Kind, line.Old = LineDeleted, oldLine
+				oldLine++
+			default:
+				line.Kind, line.Old, line.New = LineContext, oldLine, newLine
+				oldLine++
+				newLine++
+			}
+			if !emit(line) {
+				return out, 0
+			}
+		}
+	}
+	return out, budget
+}
@@ -0,0 +1,263 @@
+package gitview
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// testRepo builds a small history: a root commit, a change to one line of a
+// long file, a binary file, a branch with a slash in its name and an
+// annotated tag.
+func testRepo(t *testing.T) (*Repository, []plumbing.Hash) {
+	t.Helper()
+	fs := memfs.New()
+	repo, err := git.Init(memory.NewStorage(), fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, _ := repo.Worktree()
+	when := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var hashes []plumbing.Hash
+	commit := func(message string, files map[string]string) {
+		for name, content := range files {
+			f, _ := fs.Create(name)
+			f.Write([]byte(content))
+			f.Close()
+			wt.Add(name)
+		}
+		when = when.Add(time.Hour)
+		hash, err := wt.Commit(message, &git.CommitOptions{Author: &object.Signature{Name: "Ana", Email: "ana@example.com", When: when}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+	}
+
+	var long strings.Builder
+	for i := 1; i <= 20; i++ {
+		fmt.Fprintf(&long, "line %d\n", i)
+	}
+	commit("Initial import\n\nWith a body.", map[string]string{
+		"README.md":   "# Lamp\n\n<script>alert(1)</script>\n",
+		"src/main.go": "package main\n",
+		"notes.txt":   long.String(),
+	})
+	commit("Change line ten", map[string]string{
+		"notes.txt":  strings.Replace(long.String(), "line 10\n", "line ten\n", 1),
+		"logo.bin":   "PNG\x00\x01",
+		"src/lib.go": "package main\n",
+	})
+	head, _ := repo.Head()
+	repo.Storer.SetReference(plumbing.NewHashReference("refs/heads/feature/x", hashes[0]))
+	if _, err := repo.CreateTag("v1.0", head.Hash(), &git.CreateTagOptions{
+		Tagger: &object.Signature{Name: "Ana", When: when}, Message: "One",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return New(repo), hashes
+}
+
+func TestRefsAndResolve(t *testing.T) {
+	r, hashes := testRepo(t)
+	branches, tags, err := r.Refs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(branches) != 2 || branches[0].Name != "feature/x" || branches[1].Name != "master" {
+		t.Errorf("branches = %+v", branches)
+	}
+	if len(tags) != 1 || tags[0].Hash != hashes[1].String() {
+		t.Errorf("tags = %+v; an annotated tag names its commit", tags)
+	}
+	if got := r.DefaultBranch(); got != "master" {
+		t.Errorf("default branch = %q", got)
+	}
+
+	rev, commit, rest, err := r.Resolve([]string{"feature", "x", "src", "main.go"})
+	if err != nil || rev != "feature/x" || commit.Hash != hashes[0] || rest != "src/main.go" {
+		t.Errorf("Resolve = %q %v %q %v", rev, commit, rest, err)
+	}
+	if _, commit, _, err := r.Resolve([]string{hashes[1].String()[:7]}); err != nil || commit.Hash != hashes[1] {
+		t.Errorf("abbreviated hash = %v, %v", commit, err)
+	}
+	if _, _, _, err := r.Resolve([]string{"nope"}); err != ErrNotFound {
+		t.Errorf("unknown revision = %v", err)
+	}
+}
+
+func TestTreeFileAndLog(t *testing.T) {
+	r, hashes := testRepo(t)
+	head, _ := r.Commit("master")
+
+	entries, err := r.Tree(head, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	if strings.Join(names, ",") != "src,logo.bin,notes.txt,README.md" {
+		t.Errorf("tree = %v; directories first, then by name", names)
+	}
+	if readme, ok := r.Readme(entries); !ok || readme.Name != "README.md" {
+		t.Errorf("readme = %+v", readme)
+	}
+	if !r.IsDir(head, "src") || r.IsDir(head, "notes.txt") {
+		t.Error("IsDir")
+	}
+
+	if f, err := r.File(head, "logo.bin"); err != nil || !f.Binary || f.Content != nil {
+		t.Errorf("binary file = %+v, %v", f, err)
+	}
+	if _, err := r.File(head, "missing"); err != ErrNotFound {
+		t.Errorf("missing file = %v", err)
+	}
+
+	commits, more, err := r.Log(head, "", 0, 1)
+	if err != nil || len(commits) != 1 || !more || commits[0].Subject != "Change line ten" {
+		t.Errorf("log = %+v, more %v, %v", commits, more, err)
+	}
+	commits, more, _ = r.Log(head, "", 1, 1)
+	if len(commits) != 1 || more || commits[0].Body != "With a body." || commits[0].Hash != hashes[0].String() {
+		t.Errorf("second page = %+v, more %v", commits, more)
+	}
+	if touched, _, _ := r.Log(head, "README.md", 0, 10); len(touched) != 1 {
+		t.Errorf("history of README.md = %d commits, want 1", len(touched))
+	}
+}
+
+func TestDiff(t *testing.T) {
+	r, _ := testRepo(t)
+	head, _ := r.Commit("master")
+	diffs, truncated, err := r.Diff(context.Background(), head)
+	if err != nil || truncated {
+		t.Fatal(err, truncated)
+	}
+	byPath := map[string]FileDiff{}
+	for _, d := range diffs {
+		byPath[d.Path()] = d
+	}
+	if d := byPath["logo.bin"]; d.Status != "added" || !d.Binary {
+		t.Errorf("logo.bin = %+v", d)
+	}
+	notes := byPath["notes.txt"]
+	if notes.Status != "modified" {
+		t.Fatalf("notes.txt = %+v", notes)
+	}
+	// Three lines of context either side of the change, with the rest
+	// collapsed into gaps.
+	var kinds []string
+	for _, line := range notes.Lines {
+		kinds = append(kinds, line.Kind)
+	}
+	want := "gap,context,context,context,deleted,added,context,context,context,gap"
+	if strings.Join(kinds, ",") != want {
+		t.Errorf("kinds = %v\nwant %s", kinds, want)
+	}
+	if notes.Lines[4].Old != 10 || notes.Lines[5].New != 10 || notes.Lines[5].Text != "line ten" {
+		t.Errorf("changed lines = %+v %+v", notes.Lines[4], notes.Lines[5])
+	}
+
+	root, _ := r.Commit("feature/x")
+	rootDiffs, _, err := r.Diff(context.Background(), root)
+	if err != nil || len(rootDiffs) != 3 || rootDiffs[0].Status != "added" {
+		t.Errorf("root diff = %+v, %v", rootDiffs, err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	html := string(RenderMarkdown([]byte("# Lamp\n\n<script>alert(1)</script>\n\n[x](javascript:alert(1))\n")))
+	if !strings.Contains(html, "<h1>Lamp</h1>") || strings.Contains(html, "<script") || strings.Contains(html, "javascript:") {
+		t.Errorf("markdown = %s", html)
+	}
+	code := string(Highlight("main.go", []byte("package main\n\nfunc main() {}\n")))
+	if !strings.Contains(code, `id="L3"`) || !strings.Contains(code, "<span") {
+		t.Errorf("highlight = %s", code)
+	}
+	if escaped := string(Highlight("x.unknownext", []byte("<b>hi</b>"))); strings.Contains(escaped, "<b>") {
+		t.Errorf("unknown file type not escaped: %s", escaped)
+	}
+}
+
+func TestWriteArchive(t *testing.T) {
+	r, hashes := testRepo(t)
+	commit, _ := r.Commit("v1.0")
+	want := []string{"lamp-v1.0/", "lamp-v1.0/README.md", "lamp-v1.0/logo.bin", "lamp-v1.0/notes.txt",
+		"lamp-v1.0/src/", "lamp-v1.0/src/lib.go", "lamp-v1.0/src/main.go"}
+
+	var tgz bytes.Buffer
+	if err := r.WriteArchive(context.Background(), &tgz, commit, FormatTarGz, "lamp-v1.0"); err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(&tgz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			if hdr.PAXRecords["comment"] != hashes[1].String() {
+				t.Errorf("pax comment = %q", hdr.PAXRecords["comment"])
+			}
+			continue
+		}
+		if !hdr.ModTime.Equal(commit.Committer.When) {
+			t.Errorf("%s modified %v, want the commit time", hdr.Name, hdr.ModTime)
+		}
+		if hdr.Name == "lamp-v1.0/src/main.go" {
+			if content, _ := io.ReadAll(tr); string(content) != "package main\n" {
+				t.Errorf("main.go = %q", content)
+			}
+		}
+		names = append(names, hdr.Name)
+	}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("tar entries = %v", names)
+	}
+
+	var zipped bytes.Buffer
+	if err := r.WriteArchive(context.Background(), &zipped, commit, FormatZip, "lamp-v1.0"); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(zipped.Bytes()), int64(zipped.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zr.Comment != hashes[1].String() {
+		t.Errorf("zip comment = %q", zr.Comment)
+	}
+	names = nil
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("zip entries = %v", names)
+	}
+
+	if err := r.WriteArchive(context.Background(), io.Discard, commit, "rar", "x"); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
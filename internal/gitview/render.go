@@ -0,0 +1,63 @@
+package gitview
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// markdown renders GitHub-flavoured Markdown. Raw HTML in the source is
+// dropped and javascript: links are neutralized, which is goldmark's
+// default: a README is the project's content, served from our origin.
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// RenderMarkdown renders a Markdown file to safe HTML.
+func RenderMarkdown(source []byte) template.HTML {
+	var out bytes.Buffer
+	if err := markdown.Convert(source, &out); err != nil {
+		return template.HTML("<pre>" + template.HTMLEscapeString(string(source)) + "</pre>")
+	}
+	return template.HTML(out.String())
+}
+
+// highlighter writes inline styles, so highlighted pages need no stylesheet
+// beyond the page's own, and anchors every line as #L<n>.
+var highlighter = chromahtml.New(
+	chromahtml.WithLineNumbers(true),
+	chromahtml.WithLinkableLineNumbers(true, "L"),
+	chromahtml.LineNumbersInTable(true),
+	chromahtml.TabWidth(4),
+)
+
+// Highlight renders a source file with syntax highlighting chosen by its
+// name, or by its content when the name says nothing.
+func Highlight(name string, source []byte) template.HTML {
+	lexer := lexers.Match(name)
+	if lexer == nil {
+		lexer = lexers.Analyse(string(source))
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+	iterator, err := lexer.Tokenise(nil, string(source))
+	if err != nil {
+		return plain(source)
+	}
+	var out bytes.Buffer
+	if err := highlighter.Format(&out, styles.Get("github"), iterator); err != nil {
+		return plain(source)
+	}
+	return template.HTML(out.String())
+}
+
+func plain(source []byte) template.HTML {
+	return template.HTML("<pre>" + template.HTMLEscapeString(strings.TrimRight(string(source), "\n")) + "</pre>")
+}
@@ -116,7 +116,7 @@ func RequestCapture(c *gin.Context, db *gorm.DB, riverClient *river.Client[pgx.T
 	// Admin re-archive always forces a real capture, never an alias.
 	shortID, err := workers.QueueCapture(c.Request.Context(), db, riverClient, u.Original, types, nil, true)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue capture"})
+		respondQueueError(c, err, "Failed to queue capture")
 		return
 	}
 
@@ -165,36 +165,9 @@ func RetryAllFailedJobs(c *gin.Context, db *gorm.DB, riverClient *river.Client[p
 
 	// Reset status to pending and enqueue new jobs
 	retriedCount := 0
-	for _, item := range items {
-		// Get the capture info for this item
-		var capture models.Capture
-		if err := db.Preload("ArchivedURL").First(&capture, item.CaptureID).Error; err != nil {
-			continue // Skip if we can't find the capture
-		}
-
-		// Update status to pending
-		if err := db.Model(&item).Update("status", "pending").Error; err != nil {
-			continue // Skip this item if update fails
-		}
-
-		// Queue new archive job
-		args := workers.ArchiveJobArgs{
-			CaptureID: 0, // Will be looked up by short_id and type
-			ShortID:   capture.ShortID,
-			Type:      item.Type,
-			URL:       capture.ArchivedURL.Original,
-		}
-
-		opts := &river.InsertOpts{
-			MaxAttempts: 3,
-			Tags:        []string{"archive", item.Type, "retry"},
-			UniqueOpts: river.UniqueOpts{
-				ByArgs:   true,
-				ByPeriod: 1 * time.Minute,
-			},
-		}
-
-		if _, err := riverClient.Insert(c.Request.Context(), args, opts); err == nil {
+	for i := range items {
+		// Skip items whose capture is gone or whose job could not be queued.
+		if err := workers.RequeueArchiveItem(c.Request.Context(), db, riverClient, &items[i], "retry"); err == nil {
 			retriedCount++
 		}
 	}
@@ -364,9 +337,9 @@ func AdminArchive(c *gin.Context, db *gorm.DB, riverClient *river.Client[pgx.Tx]
 	}
 
 	// Admin archive always forces a real capture, never an alias.
-	shortID, err := workers.QueueCapture(c.Request.Context(), db, riverClient, req.URL, req.Types, nil, true)
+	shortID, err := workers.QueueCaptureWithQuality(c.Request.Context(), db, riverClient, req.URL, req.Types, nil, true, req.VideoQuality())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue capture"})
+		respondQueueError(c, err, "Failed to queue capture")
 		return
 	}
 
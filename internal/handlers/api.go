@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
@@ -88,15 +89,27 @@ func ApiArchive(c *gin.Context, db *gorm.DB, riverClient *river.Client[pgx.Tx])
 	apiKey, _ := c.Get("api_key")
 	apiKeyID := apiKey.(*models.APIKey).ID
 
-	shortID, err := workers.QueueCapture(c.Request.Context(), db, riverClient, req.URL, req.Types, &apiKeyID, req.Force)
+	shortID, err := workers.QueueCaptureWithQuality(c.Request.Context(), db, riverClient, req.URL, req.Types, &apiKeyID, req.Force, req.VideoQuality())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue capture"})
+		respondQueueError(c, err, "Failed to queue capture")
 		return
 	}
 
 	c.JSON(http.StatusOK, archiveQueuedResponse(c, shortID))
 }
 
+// respondQueueError answers a failed capture request. A type refused because
+// its dependency is down is a 503 naming what is down, so the caller can
+// retry later or drop that type; anything else is a plain 500.
+func respondQueueError(c *gin.Context, err error, message string) {
+	var unavailable *workers.UnavailableTypesError
+	if errors.As(err, &unavailable) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": unavailable.Error(), "unavailable_types": unavailable.Reasons})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
 func archiveQueuedResponse(c *gin.Context, shortID string) gin.H {
 	return gin.H{
 		"url":        utils.BuildFullURL(c, shortID),
@@ -124,9 +137,9 @@ func ApiFindOrCreateArchive(c *gin.Context, db *gorm.DB, riverClient *river.Clie
 		return
 	}
 	apiKeyID := apiKey.(*models.APIKey).ID
-	result, err := workers.FindOrCreateCapture(c.Request.Context(), db, riverClient, req.URL, req.Types, &apiKeyID)
+	result, err := workers.FindOrCreateCaptureWithQuality(c.Request.Context(), db, riverClient, req.URL, req.Types, &apiKeyID, req.VideoQuality())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find or create capture"})
+		respondQueueError(c, err, "Failed to find or create capture")
 		return
 	}
 
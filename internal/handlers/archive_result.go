@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"path/filepath"
@@ -10,14 +11,18 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
 	"gorm.io/gorm"
 
 	"arker/internal/archivers"
 	"arker/internal/models"
 	"arker/internal/storage"
 	"arker/internal/utils"
+	"arker/internal/workers"
 )
 
 type archiveResultResponse struct {
@@ -31,6 +36,12 @@ type archiveResultResponse struct {
 	Items            []archiveResultItem `json:"items"`
 	Cost             archiveResultCost   `json:"cost"`
 	SocialPost       *socialPostResult   `json:"social_post"`
+	// Reader is the article text extracted from the web archive. Absent when
+	// the capture has no completed web archive.
+	Reader *readerResult `json:"reader,omitempty"`
+	// Manifest is the capture's newest signed manifest. Absent until one is
+	// signed.
+	Manifest *manifestResult `json:"manifest,omitempty"`
 }
 
 type archiveResultCost struct {
@@ -59,6 +70,51 @@ type archiveResultItem struct {
 	SizeBytes int64  `json:"size_bytes,omitempty"`
 }
 
+// readerResult is the reader-mode record of the web archive. Status is
+// "pending" while an archive captured before extraction existed is being
+// processed, and "ready" once the fields below are filled in; a ready result
+// with Readable false found no article on the page.
+type readerResult struct {
+	Status      string `json:"status"`
+	Readable    bool   `json:"readable"`
+	Title       string `json:"title,omitempty"`
+	Byline      string `json:"byline,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+	Published   string `json:"published,omitempty"`
+	LeadImage   string `json:"lead_image,omitempty"`
+	Excerpt     string `json:"excerpt,omitempty"`
+	Language    string `json:"language,omitempty"`
+	WordCount   int    `json:"word_count"`
+	Markdown    string `json:"markdown,omitempty"`
+	HTML        string `json:"html,omitempty"`
+	Source      string `json:"source,omitempty"`
+	ExtractedAt string `json:"extracted_at,omitempty"`
+	URL         string `json:"url"`
+	MarkdownURL string `json:"markdown_url,omitempty"`
+}
+
+// manifestResult describes the signed manifest and, once a TSA has stamped
+// it, the timestamp. The token is carried inline so a saved result is
+// self-contained evidence.
+type manifestResult struct {
+	URL        string           `json:"url"`
+	KeyID      string           `json:"key_id"`
+	SignedAt   string           `json:"signed_at"`
+	FileCount  int              `json:"file_count"`
+	TotalBytes int64            `json:"total_bytes"`
+	Timestamp  *timestampResult `json:"timestamp"`
+}
+
+type timestampResult struct {
+	Time         string `json:"time"`
+	TSA          string `json:"tsa"`
+	TSAURL       string `json:"tsa_url,omitempty"`
+	SerialNumber string `json:"serial_number"`
+	URL          string `json:"url"`
+	// Token is the TSA's DER reply, base64: what /manifest.tsr serves.
+	Token []byte `json:"token"`
+}
+
 type socialPostResult struct {
 	Status    string `json:"status"`
 	Terminal  bool   `json:"terminal"`
@@ -214,7 +270,7 @@ type socialFailure struct {
 
 // ApiArchiveResult returns one provider-neutral representation of a capture.
 // Aliases are resolved without redirecting so callers retain both identifiers.
-func ApiArchiveResult(c *gin.Context, store storage.Storage, db *gorm.DB) {
+func ApiArchiveResult(c *gin.Context, store storage.Storage, db *gorm.DB, riverClient *river.Client[pgx.Tx]) {
 	requested := c.Param("shortid")
 	var requestedCapture models.Capture
 	if err := db.Preload("ArchivedURL").Where("short_id = ?", requested).First(&requestedCapture).Error; err != nil {
@@ -265,9 +321,83 @@ func ApiArchiveResult(c *gin.Context, store storage.Storage, db *gorm.DB) {
 	}
 	response.Cost = cost
 	response.SocialPost = buildSocialPost(c, store, db, &canonical, response.SourceURL)
+	response.Reader = buildReaderResult(c, store, riverClient, &canonical)
+	response.Manifest = buildManifestResult(c, store, db, &canonical)
 	c.JSON(http.StatusOK, response)
 }
 
+// buildManifestResult reports the capture's newest signed manifest and its
+// timestamp.
+func buildManifestResult(c *gin.Context, store storage.Storage, db *gorm.DB, capture *models.Capture) *manifestResult {
+	record, stamp, err := latestManifestTimestamp(db, capture.ID)
+	if err != nil || record == nil {
+		return nil
+	}
+	out := &manifestResult{
+		URL:        fullPath(c, "archive/"+capture.ShortID+"/manifest.sig"),
+		KeyID:      record.KeyID,
+		SignedAt:   record.CreatedAt.UTC().Format(time.RFC3339),
+		FileCount:  record.FileCount,
+		TotalBytes: record.TotalBytes,
+	}
+	if stamp == nil {
+		return out
+	}
+	r, err := store.Reader(stamp.StorageKey)
+	if err != nil {
+		return out
+	}
+	defer r.Close()
+	token, err := io.ReadAll(r)
+	if err != nil {
+		return out
+	}
+	out.Timestamp = &timestampResult{
+		Time:         stamp.Time.UTC().Format(time.RFC3339Nano),
+		TSA:          stamp.TSAName,
+		TSAURL:       stamp.TSAURL,
+		SerialNumber: stamp.SerialNumber,
+		URL:          fullPath(c, "archive/"+capture.ShortID+"/manifest.tsr"),
+		Token:        token,
+	}
+	return out
+}
+
+// buildReaderResult reports the extracted article of the capture's web archive,
+// queueing extraction for an archive that predates it.
+func buildReaderResult(c *gin.Context, store storage.Storage, riverClient *river.Client[pgx.Tx], capture *models.Capture) *readerResult {
+	var item *models.ArchiveItem
+	for i := range capture.ArchiveItems {
+		if utils.ArchiveTypesEqual(capture.ArchiveItems[i].Type, utils.ArchiveTypeMHTML) {
+			item = &capture.ArchiveItems[i]
+			break
+		}
+	}
+	if item == nil || item.Status != "completed" || item.StorageKey == "" {
+		return nil
+	}
+	out := &readerResult{Status: "pending", URL: fullPath(c, "reader/"+capture.ShortID)}
+	article, err := readerArticle(store, item)
+	if err != nil {
+		return nil
+	}
+	if article == nil {
+		_ = workers.EnqueueReader(c.Request.Context(), riverClient, capture.ShortID)
+		return out
+	}
+	out.Status = "ready"
+	out.Readable = article.Readable
+	out.Title, out.Byline, out.SiteName = article.Title, article.Byline, article.SiteName
+	out.Published, out.LeadImage, out.Excerpt = article.Published, article.LeadImage, article.Excerpt
+	out.Language, out.WordCount = article.Language, article.WordCount
+	out.Markdown, out.HTML = article.Markdown, article.HTML
+	out.Source, out.ExtractedAt = article.Source, article.ExtractedAt
+	if article.Readable {
+		out.MarkdownURL = fullPath(c, "reader/"+capture.ShortID+"/markdown")
+	}
+	return out
+}
+
 func buildArchiveResultCost(db *gorm.DB, items []models.ArchiveItem) (archiveResultCost, error) {
 	cost := archiveResultCost{
 		Currency:  "USD",
@@ -317,7 +447,7 @@ func buildSocialPost(c *gin.Context, store storage.Storage, db *gorm.DB, capture
 	if social == nil {
 		result.Status, result.Terminal = "failed", true
 		code, message, retryable := "unsupported_url", "No social extractor was available for this recognized URL", false
-		if utils.IsGalleryDLURL(sourceURL) && utils.GalleryDLURLRequiresCookies(sourceURL) && !utils.MediaCookiesConfigured() {
+		if utils.IsGalleryDLURL(sourceURL) && utils.GalleryDLURLRequiresCookies(sourceURL) && !utils.MediaCookiesConfigured(sourceURL) {
 			code, message, retryable = "authentication_required", "Provider authentication is required and no credentials or fallback were available", true
 		}
 		result.Failure = &socialFailure{Code: code, Message: message, Retryable: retryable}
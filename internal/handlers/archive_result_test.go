@@ -22,7 +22,7 @@ import (
 func resultRouter(db *gorm.DB, store storage.Storage) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
-	r.GET("/api/v1/archive/:shortid", func(c *gin.Context) { ApiArchiveResult(c, store, db) })
+	r.GET("/api/v1/archive/:shortid", func(c *gin.Context) { ApiArchiveResult(c, store, db, nil) })
 	r.GET("/gallery/:shortid/raw", func(c *gin.Context) { ServeGalleryRawMetadata(c, store, db) })
 	return r
 }
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"arker/internal/models"
+	"arker/internal/storage"
+)
+
+// An audio capture is served by the video endpoints: the same record, under
+// its own media URL, reachable by the /audio/ aliases.
+func TestAudioCaptureIsServedByTheVideoEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newHandlerLogTestDB(t)
+	store := storage.NewMemoryStorage()
+	createVideoCapture(t, db, "aud01", "https://soundcloud.com/someone/a-track", map[string]string{"audio": "completed"})
+
+	metadataKey := "aud01/audio-fixture.metadata.json"
+	storeTestObject(t, store, metadataKey, []byte(`{"schema_version":"1","source_url":"https://soundcloud.com/someone/a-track","title":"A track","provenance":"native","engagement":{},"media":{"extension":".opus","content_type":"audio/ogg","size_bytes":8},"audio":{"show":"A show"},"chapters":[{"title":"Intro","start_seconds":0}],"archived_at":"2026-10-18T12:00:00Z"}`))
+	if err := db.Model(&models.ArchiveItem{}).
+		Where("type = ?", "audio").
+		Updates(map[string]interface{}{"storage_key": "aud01/audio-fixture.opus", "extension": ".opus", "metadata_key": metadataKey}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.GET("/audio/:shortid/manifest", func(c *gin.Context) { ServeVideoManifest(c, store, db) })
+	router.GET("/audio/:shortid", func(c *gin.Context) { ServeVideoDeepLink(c, db) })
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/audio/aud01/manifest", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("manifest status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var manifest struct {
+		MediaURL *string `json:"media_url"`
+		HLSURL   *string `json:"hls_url"`
+		Metadata struct {
+			Audio struct {
+				Show string `json:"show"`
+			} `json:"audio"`
+			Chapters []struct {
+				Title string `json:"title"`
+			} `json:"chapters"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.MediaURL == nil || *manifest.MediaURL != "/archive/aud01/audio" {
+		t.Errorf("media_url = %v, want /archive/aud01/audio", manifest.MediaURL)
+	}
+	if manifest.HLSURL != nil {
+		t.Errorf("an audio capture advertised HLS: %s", *manifest.HLSURL)
+	}
+	if manifest.Metadata.Audio.Show != "A show" || len(manifest.Metadata.Chapters) != 1 {
+		t.Errorf("metadata = %+v", manifest.Metadata)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/audio/aud01?t=42", nil))
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/aud01/audio?t=42" {
+		t.Errorf("deep link = %d %q, want a redirect to the audio tab", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestContentTypeForAudioArchives(t *testing.T) {
+	for ext, want := range map[string]string{".opus": "audio/ogg", ".m4a": "audio/mp4"} {
+		if got, attachment := contentTypeForArchive("audio", ext); got != want || attachment {
+			t.Errorf("contentTypeForArchive(audio, %s) = %s, %v; want %s inline", ext, got, attachment, want)
+		}
+	}
+}
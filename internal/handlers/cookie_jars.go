@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"arker/internal/cookiejars"
+)
+
+// maxCookieJarBytes bounds an upload. A browser export for one site is a few
+// kilobytes; a whole-profile export is still well under this.
+const maxCookieJarBytes = 1 << 20
+
+// cookieJarExpiringWithin is when the page starts warning about a login.
+const cookieJarExpiringWithin = 7 * 24 * time.Hour
+
+func CookieJarsGet(c *gin.Context, store *cookiejars.Store) {
+	jars, err := store.List()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Failed to load cookie jars")
+		return
+	}
+	now := time.Now()
+	c.HTML(http.StatusOK, "cookie_jars.html", gin.H{
+		"jars":      jars,
+		"enabled":   store.Enabled(),
+		"now":       now,
+		"warnAfter": now.Add(cookieJarExpiringWithin),
+	})
+}
+
+func CookieJarsCreate(c *gin.Context, store *cookiejars.Store) {
+	if !store.Enabled() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": cookiejars.ErrNoKey.Error()})
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCookieJarBytes+4096)
+	var req struct {
+		Host    string `json:"host"`
+		Label   string `json:"label"`
+		Content string `json:"content"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if len(req.Content) > maxCookieJarBytes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cookie jar is too large"})
+		return
+	}
+
+	jar, err := store.Add(req.Host, req.Label, []byte(req.Content))
+	if err != nil {
+		// Validation messages name the bad line or host and never echo a
+		// cookie value, so they are safe to return.
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":               jar.ID,
+		"host":             jar.Host,
+		"label":            jar.Label,
+		"cookies":          jar.CookieCount,
+		"login_cookie":     jar.LoginCookie,
+		"login_expires_at": jar.LoginExpiresAt,
+	})
+}
+
+func CookieJarsToggle(c *gin.Context, store *cookiejars.Store) {
+	id, ok := cookieJarID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if err := store.SetEnabled(id, req.Enabled); err != nil {
+		respondCookieJarError(c, err, "Failed to update cookie jar")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "enabled": req.Enabled})
+}
+
+func CookieJarsDelete(c *gin.Context, store *cookiejars.Store) {
+	id, ok := cookieJarID(c)
+	if !ok {
+		return
+	}
+	if err := store.Delete(id); err != nil {
+		respondCookieJarError(c, err, "Failed to delete cookie jar")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Cookie jar deleted"})
+}
+
+func cookieJarID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cookie jar ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func respondCookieJarError(c *gin.Context, err error, message string) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cookie jar not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"arker/internal/cookiejars"
+	"arker/internal/models"
+)
+
+func newCookieJarRouter(t *testing.T, secret string) (*gin.Engine, *gorm.DB) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite db: %v", err)
+	}
+	if err := db.AutoMigrate(&models.CookieJar{}); err != nil {
+		t.Fatalf("migrate sqlite db: %v", err)
+	}
+	store, err := cookiejars.NewStore(db, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.POST("/admin/cookie-jars", func(c *gin.Context) { CookieJarsCreate(c, store) })
+	router.POST("/admin/cookie-jars/:id/toggle", func(c *gin.Context) { CookieJarsToggle(c, store) })
+	router.DELETE("/admin/cookie-jars/:id", func(c *gin.Context) { CookieJarsDelete(c, store) })
+	return router, db
+}
+
+func sendCookieJarRequest(router *gin.Engine, method, path string, body any) (*httptest.ResponseRecorder, map[string]any) {
+	payload, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(string(payload)))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	var decoded map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &decoded)
+	return w, decoded
+}
+
+func TestCookieJarAdminLifecycle(t *testing.T) {
+	router, db := newCookieJarRouter(t, "test key")
+	content := ".instagram.com\tTRUE\t/\tTRUE\t0\tsessionid\tsecret\n"
+
+	w, body := sendCookieJarRequest(router, http.MethodPost, "/admin/cookie-jars",
+		map[string]string{"host": "www.instagram.com", "label": "bot-1", "content": content})
+	if w.Code != http.StatusOK || body["host"] != "instagram.com" || body["login_cookie"] != "sessionid" {
+		t.Fatalf("create = %d %v", w.Code, body)
+	}
+	if strings.Contains(w.Body.String(), "secret") {
+		t.Error("create response echoes a cookie value")
+	}
+	id := fmt.Sprint(body["id"])
+
+	w, _ = sendCookieJarRequest(router, http.MethodPost, "/admin/cookie-jars/"+id+"/toggle", map[string]bool{"enabled": false})
+	var jar models.CookieJar
+	db.First(&jar, id)
+	if w.Code != http.StatusOK || jar.Enabled {
+		t.Errorf("toggle = %d, enabled = %v; want disabled", w.Code, jar.Enabled)
+	}
+
+	if w, _ = sendCookieJarRequest(router, http.MethodDelete, "/admin/cookie-jars/"+id, nil); w.Code != http.StatusOK {
+		t.Errorf("delete = %d", w.Code)
+	}
+	if w, _ = sendCookieJarRequest(router, http.MethodDelete, "/admin/cookie-jars/"+id, nil); w.Code != http.StatusNotFound {
+		t.Errorf("second delete = %d, want 404", w.Code)
+	}
+}
+
+func TestCookieJarCreateRejectsInvalidJars(t *testing.T) {
+	router, _ := newCookieJarRouter(t, "test key")
+	w, body := sendCookieJarRequest(router, http.MethodPost, "/admin/cookie-jars",
+		map[string]string{"host": "instagram.com", "label": "bot", "content": "not a cookie jar"})
+	if w.Code != http.StatusBadRequest || !strings.Contains(fmt.Sprint(body["error"]), "cookies.txt") {
+		t.Errorf("invalid jar = %d %v, want 400 naming the format", w.Code, body)
+	}
+
+	disabled, _ := newCookieJarRouter(t, "")
+	w, _ = sendCookieJarRequest(disabled, http.MethodPost, "/admin/cookie-jars",
+		map[string]string{"host": "instagram.com", "label": "bot", "content": "x"})
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("create without a key = %d, want 503", w.Code)
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"arker/internal/models"
+	"arker/internal/storage"
 	"arker/internal/utils"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -28,8 +29,11 @@ func calculateQueuePosition(db *gorm.DB, item *models.ArchiveItem) int {
 //
 // This also resolves retired type names, so permalinks handed out before the
 // yt-dlp rename (/{shortid}/youtube) keep working forever.
+//
+// The reader tab shows the mhtml item's article, so it resolves to that item
+// too: its status and logs are the web archive's.
 func urlTypeToInternalType(urlType string) string {
-	if urlType == "web" {
+	if urlType == "web" || urlType == readerURLType {
 		return utils.ArchiveTypeMHTML
 	}
 	return utils.NormalizeArchiveType(urlType)
@@ -56,6 +60,16 @@ func getDisplayName(internalType string) string {
 		return "Video"
 	case utils.ArchiveTypeGalleryDl:
 		return "Media"
+	case utils.ArchiveTypePlaylist:
+		return "Playlist"
+	case utils.ArchiveTypeAudio:
+		return "Audio"
+	case utils.ArchiveTypePDF:
+		return "PDF"
+	case utils.ArchiveTypeFile:
+		return "File"
+	case utils.ArchiveTypeForge:
+		return "Project"
 	default:
 		return internalType
 	}
@@ -67,10 +81,14 @@ func defaultTypePreference(originalURL string) []string {
 	switch {
 	case utils.IsItchURL(originalURL):
 		return []string{utils.ArchiveTypeItch, utils.ArchiveTypeMHTML, utils.ArchiveTypeScreenshot, utils.ArchiveTypeYtDlp, utils.ArchiveTypeGit}
-	case utils.IsGitURL(originalURL):
-		return []string{utils.ArchiveTypeGit, utils.ArchiveTypeMHTML, utils.ArchiveTypeScreenshot, utils.ArchiveTypeYtDlp}
+	case utils.IsGitURL(originalURL) || utils.IsForgeURL(originalURL):
+		return []string{utils.ArchiveTypeGit, utils.ArchiveTypeForge, utils.ArchiveTypeMHTML, utils.ArchiveTypeScreenshot, utils.ArchiveTypeYtDlp}
 	case utils.IsGalleryDLURL(originalURL):
 		return []string{utils.ArchiveTypeGalleryDl, utils.ArchiveTypeMHTML, utils.ArchiveTypeScreenshot, utils.ArchiveTypeYtDlp, utils.ArchiveTypeGit}
+	case utils.IsPlaylistURL(originalURL):
+		return []string{utils.ArchiveTypePlaylist, utils.ArchiveTypeMHTML, utils.ArchiveTypeScreenshot}
+	case utils.IsAudioURL(originalURL):
+		return []string{utils.ArchiveTypeAudio, utils.ArchiveTypeMHTML, utils.ArchiveTypeScreenshot}
 	case utils.IsVideoURL(originalURL):
 		return []string{utils.ArchiveTypeYtDlp, utils.ArchiveTypeMHTML, utils.ArchiveTypeScreenshot, utils.ArchiveTypeGit}
 	default:
@@ -78,6 +96,24 @@ func defaultTypePreference(originalURL string) []string {
 	}
 }
 
+// fileViewKind tells the viewer how to show a file capture: "pdf" and "image"
+// are embedded, anything else ("") is offered as a download. It follows the
+// same extensions serving shows inline.
+func fileViewKind(item *models.ArchiveItem) string {
+	if !utils.ArchiveTypesEqual(item.Type, utils.ArchiveTypeFile) {
+		return ""
+	}
+	ct, attach := contentTypeForArchive(item.Type, item.Extension)
+	switch {
+	case attach:
+		return ""
+	case ct == "application/pdf":
+		return "pdf"
+	default:
+		return "image"
+	}
+}
+
 // archiveTab is one rendered tab in the viewer.
 type archiveTab struct {
 	URLType     string
@@ -102,6 +138,16 @@ func buildTabs(items []models.ArchiveItem, preference []string, currentURLType s
 			Status:      item.Status,
 			IsActive:    urlType == currentURLType,
 		})
+		// The reader view is the web archive's article, so it follows the web
+		// tab and shares its status rather than being an item of its own.
+		if utils.ArchiveTypesEqual(item.Type, utils.ArchiveTypeMHTML) {
+			tabs = append(tabs, archiveTab{
+				URLType:     readerURLType,
+				DisplayName: "Reader",
+				Status:      item.Status,
+				IsActive:    currentURLType == readerURLType,
+			})
+		}
 	}
 
 	for _, preferredType := range preference {
@@ -159,7 +205,7 @@ func selectDefaultType(items []models.ArchiveItem, preference []string) string {
 }
 
 // DisplayDefault serves the default archive type view directly (no redirect)
-func DisplayDefault(c *gin.Context, db *gorm.DB) {
+func DisplayDefault(c *gin.Context, store storage.Storage, db *gorm.DB) {
 	shortID := c.Param("shortid")
 	if redirectIfAlias(c, db, shortID) {
 		return
@@ -227,11 +273,15 @@ func DisplayDefault(c *gin.Context, db *gorm.DB) {
 		"git_repo_name":     gitRepoName,
 		"download_filename": filename,
 		"queue_position":    queuePosition,
+		"hls_url":           videoHLSURL(db, targetItem, shortID),
+		"file_view":         fileViewKind(targetItem),
+		"og":                buildSocialCard(c, store, &capture, archivedURL.Original),
+		"trusted_time":      trustedTimestamp(db, capture.ID),
 	})
 }
 
 // DisplayType shows a specific archive type page
-func DisplayType(c *gin.Context, db *gorm.DB) {
+func DisplayType(c *gin.Context, store storage.Storage, db *gorm.DB) {
 	shortID := c.Param("shortid")
 	urlType := c.Param("type")
 	if redirectIfAlias(c, db, shortID) {
@@ -240,6 +290,10 @@ func DisplayType(c *gin.Context, db *gorm.DB) {
 
 	// Convert URL type to internal type for database lookup
 	internalType := urlTypeToInternalType(urlType)
+	currentType := internalTypeToURLType(internalType)
+	if urlType == readerURLType {
+		currentType = readerURLType
+	}
 
 	var capture models.Capture
 	if err := db.Where("short_id = ?", shortID).Preload("ArchiveItems").First(&capture).Error; err != nil {
@@ -284,17 +338,21 @@ func DisplayType(c *gin.Context, db *gorm.DB) {
 	c.HTML(http.StatusOK, "display_type.html", gin.H{
 		"date":         capture.Timestamp.Format(time.RFC1123),
 		"timestamp":    capture.Timestamp.Format(time.RFC3339), // For JavaScript parsing
-		"tabs":         buildTabs(capture.ArchiveItems, defaultTypePreference(archivedURL.Original), internalTypeToURLType(internalType)),
+		"tabs":         buildTabs(capture.ArchiveItems, defaultTypePreference(archivedURL.Original), currentType),
 		"current_item": targetItem,
 		// Canonicalize rather than echoing urlType: a legacy /{id}/youtube
 		// permalink must still match the tab links, which are canonical.
-		"current_type":      internalTypeToURLType(internalType),
+		"current_type":      currentType,
 		"short_id":          shortID,
 		"host":              c.Request.Host,
 		"original_url":      archivedURL.Original,
 		"git_repo_name":     gitRepoName,
 		"download_filename": filename,
 		"queue_position":    queuePosition,
+		"hls_url":           videoHLSURL(db, targetItem, shortID),
+		"file_view":         fileViewKind(targetItem),
+		"og":                buildSocialCard(c, store, &capture, archivedURL.Original),
+		"trusted_time":      trustedTimestamp(db, capture.ID),
 	})
 }
 
@@ -100,8 +100,8 @@ func TestBuildTabsOrdersByPreferenceAndMarksActive(t *testing.T) {
 
 	tabs := buildTabs(archiveItems, preference, "screenshot")
 
-	if len(tabs) != 3 {
-		t.Fatalf("got %d tabs, want 3", len(tabs))
+	if len(tabs) != 4 {
+		t.Fatalf("got %d tabs, want 4", len(tabs))
 	}
 	if tabs[0].URLType != utils.ArchiveTypeGalleryDl {
 		t.Errorf("tabs[0] = %q, want gallery-dl first for an Instagram post", tabs[0].URLType)
@@ -113,10 +113,14 @@ func TestBuildTabsOrdersByPreferenceAndMarksActive(t *testing.T) {
 	if tabs[1].URLType != "web" || tabs[1].DisplayName != "Web" {
 		t.Errorf("tabs[1] = %+v, want the mhtml item exposed as web/Web", tabs[1])
 	}
-	if !tabs[2].IsActive {
-		t.Errorf("tabs[2] = %+v, want the screenshot tab marked active", tabs[2])
+	// The reader view belongs to the web archive and follows it.
+	if tabs[2].URLType != readerURLType || tabs[2].DisplayName != "Reader" || tabs[2].Status != "completed" {
+		t.Errorf("tabs[2] = %+v, want the reader tab after web", tabs[2])
 	}
-	if tabs[0].IsActive || tabs[1].IsActive {
+	if !tabs[3].IsActive {
+		t.Errorf("tabs[3] = %+v, want the screenshot tab marked active", tabs[3])
+	}
+	if tabs[0].IsActive || tabs[1].IsActive || tabs[2].IsActive {
 		t.Error("only the current tab may be marked active")
 	}
 }
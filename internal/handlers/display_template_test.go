@@ -309,3 +309,156 @@ async function fetch(url) {
 		})
 	}
 }
+
+// Clicking a transcript line has to move the player, and a deep link's ?t=
+// has to seek it before the first frame; both are checked by running the
+// page's own script against a stub player.
+func TestDisplayVideoCuesSeekThePlayer(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node is required for the rendered viewer JavaScript smoke test")
+	}
+	script := renderViewerScript(t, "yt-dlp", "cue01")
+
+	harness := fmt.Sprintf(`
+const hostConsole = globalThis.console;
+const errors = [];
+const console = { error: (...a) => errors.push(a.map(String).join(' ')), log: (...a) => hostConsole.log(...a) };
+
+class Element {
+  constructor(tagName) {
+    this.tagName = tagName.toUpperCase();
+    this.childNodes = [];
+    this.style = {};
+    this.className = '';
+    this._textContent = '';
+    this.listeners = {};
+    const classes = new Set();
+    this.classList = {
+      add: c => classes.add(c), remove: c => classes.delete(c), contains: c => classes.has(c),
+      toggle: (c, on) => on ? classes.add(c) : classes.delete(c),
+    };
+  }
+  appendChild(child) { this.childNodes.push(child); return child; }
+  set textContent(v) { this._textContent = String(v); this.childNodes = []; }
+  get textContent() { return this._textContent; }
+  set innerHTML(v) { this._innerHTML = String(v); this.childNodes = []; }
+  get innerHTML() { return this._innerHTML; }
+  addEventListener(event, cb) { (this.listeners[event] ||= []).push(cb); }
+  dispatch(event) { (this.listeners[event] || []).forEach(cb => cb()); }
+  scrollIntoView() {}
+  setAttribute() {}
+  focus() {}
+  select() {}
+}
+
+const player = new Element('video');
+player.readyState = 0;
+player.currentTime = 0;
+player.play = () => { player.playing = true; };
+const elements = new Map([
+  ['archive-time', new Element('span')],
+  ['past-archives-list', new Element('div')],
+  ['video-player', player],
+  ['video-cues', new Element('div')],
+  ['video-cues-list', new Element('div')],
+  ['video-cues-search', new Element('input')],
+]);
+elements.get('video-cues').style.display = 'none';
+let onDOMContentLoaded;
+const document = {
+  body: new Element('body'),
+  createElement: tag => new Element(tag),
+  getElementById: id => elements.get(id) || null,
+  addEventListener: (e, cb) => { if (e === 'DOMContentLoaded') onDOMContentLoaded = cb; },
+  execCommand: () => true,
+};
+const window = { location: { protocol: 'https:', host: 'archive.example.com', search: '?t=42' } };
+const navigator = { clipboard: { writeText: async () => {} } };
+const location = { reload() {} };
+const setInterval = () => 1;
+const clearInterval = () => {};
+
+async function fetch(url) {
+  if (url === '/video/cue01/manifest') {
+    return { ok: true, status: 200, json: async () => ({ metadata_available: false }) };
+  }
+  if (url === '/video/cue01/transcript/cues') {
+    return { ok: true, status: 200, json: async () => ({ cues: [
+      { index: 0, start: 1.5, end: 3, text: 'hello there' },
+      { index: 1, start: 75, end: 80, text: 'the elephants' },
+    ] }) };
+  }
+  if (url.startsWith('/web/past-archives?')) return { ok: true, status: 200, json: async () => [] };
+  throw new Error('unexpected fetch: ' + url);
+}
+
+%s
+
+(async () => {
+  onDOMContentLoaded();
+  await new Promise(resolve => globalThis.setTimeout(resolve, 20));
+
+  player.dispatch('loadedmetadata');
+  if (player.currentTime !== 42) throw new Error('?t= did not seek: ' + player.currentTime);
+
+  const list = elements.get('video-cues-list');
+  if (list.childNodes.length !== 2) throw new Error('cues rendered: ' + list.childNodes.length);
+  if (elements.get('video-cues').style.display === 'none') throw new Error('transcript panel stayed hidden');
+  if (list.childNodes[1].childNodes[0].textContent !== '1:15') throw new Error('cue time = ' + list.childNodes[1].childNodes[0].textContent);
+
+  list.childNodes[1].dispatch('click');
+  if (player.currentTime !== 75 || !player.playing) throw new Error('click did not jump to the cue');
+
+  const search = elements.get('video-cues-search');
+  search.value = 'ELEPH';
+  search.dispatch('input');
+  if (list.childNodes[0].style.display !== 'none' || list.childNodes[1].style.display !== '') {
+    throw new Error('search did not filter the cues');
+  }
+  if (errors.length) throw new Error('viewer logged errors: ' + errors.join(' | '));
+})().catch(error => { hostConsole.error(error.stack || String(error)); process.exitCode = 1; });
+`, script)
+
+	scriptPath := filepath.Join(t.TempDir(), "display-cues-smoke.js")
+	if err := os.WriteFile(scriptPath, []byte(harness), 0o600); err != nil {
+		t.Fatalf("write JavaScript harness: %v", err)
+	}
+	if output, err := exec.Command(node, scriptPath).CombinedOutput(); err != nil {
+		t.Fatalf("rendered viewer JavaScript failed: %v\n%s", err, output)
+	}
+}
+
+func TestDisplayShowsTrustedTimestamp(t *testing.T) {
+	tmpl, err := template.ParseFiles(filepath.Join("..", "..", "templates", "display_type.html"))
+	if err != nil {
+		t.Fatalf("parse display template: %v", err)
+	}
+	item := models.ArchiveItem{Type: "mhtml", Status: "completed", Extension: ".mhtml"}
+	data := map[string]interface{}{
+		"date":         time.Date(2026, 2, 3, 4, 0, 0, 0, time.UTC).Format(time.RFC1123),
+		"tabs":         []archiveTab{{URLType: "web", DisplayName: "Web", Status: "completed", IsActive: true}},
+		"current_item": &item,
+		"current_type": "web",
+		"short_id":     "done1",
+		"trusted_time": &models.CaptureTimestamp{TSAName: "CN=Example TSA", Time: time.Date(2026, 2, 3, 4, 5, 6, 0, time.UTC)},
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&rendered, "display_type.html", data); err != nil {
+		t.Fatalf("render display template: %v", err)
+	}
+	for _, want := range []string{`href="/archive/done1/manifest.tsr"`, "by CN=Example TSA", "Timestamped: Tue, 03 Feb 2026 04:05:06 UTC"} {
+		if !bytes.Contains(rendered.Bytes(), []byte(want)) {
+			t.Errorf("rendered page lacks %q", want)
+		}
+	}
+
+	delete(data, "trusted_time")
+	rendered.Reset()
+	if err := tmpl.ExecuteTemplate(&rendered, "display_type.html", data); err != nil {
+		t.Fatalf("render display template: %v", err)
+	}
+	if bytes.Contains(rendered.Bytes(), []byte("Timestamped:")) {
+		t.Error("untimestamped capture shows a timestamp")
+	}
+}
@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"arker/internal/feeds"
+	"arker/internal/models"
+	"arker/internal/utils"
+)
+
+// archivedFeedLimit is how many entries the archived feed lists, newest first.
+const archivedFeedLimit = 100
+
+func FeedsGet(c *gin.Context, poller *feeds.Poller) {
+	subs, err := poller.List()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Failed to load feed subscriptions")
+		return
+	}
+	c.HTML(http.StatusOK, "feeds.html", gin.H{
+		"feeds":           subs,
+		"defaultInterval": poller.DefaultInterval().String(),
+		"minInterval":     feeds.MinInterval.String(),
+	})
+}
+
+// FeedsCreate subscribes to a feed and polls it once before answering, so a
+// URL that is not a feed is reported on the spot. The subscription is kept
+// either way; a failed first poll is retried on schedule.
+func FeedsCreate(c *gin.Context, poller *feeds.Poller) {
+	var req struct {
+		URL             string `json:"url"`
+		Interval        string `json:"interval"`
+		CaptureExisting bool   `json:"capture_existing"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	var interval time.Duration
+	if req.Interval != "" {
+		parsed, err := time.ParseDuration(req.Interval)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid interval: use a duration such as 30m or 6h"})
+			return
+		}
+		interval = parsed
+	}
+
+	sub, err := poller.Subscribe(req.URL, interval, req.CaptureExisting)
+	if errors.Is(err, feeds.ErrAlreadySubscribed) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pollErr := poller.Poll(c.Request.Context(), &sub)
+	c.JSON(http.StatusOK, feedResponse(sub, pollErr))
+}
+
+func FeedsPoll(c *gin.Context, poller *feeds.Poller) {
+	id, ok := feedID(c)
+	if !ok {
+		return
+	}
+	sub, err := poller.Get(id)
+	if err != nil {
+		respondFeedError(c, err, "Failed to load feed")
+		return
+	}
+	pollErr := poller.Poll(c.Request.Context(), &sub)
+	c.JSON(http.StatusOK, feedResponse(sub, pollErr))
+}
+
+func FeedsToggle(c *gin.Context, poller *feeds.Poller) {
+	id, ok := feedID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if err := poller.SetEnabled(id, req.Enabled); err != nil {
+		respondFeedError(c, err, "Failed to update feed")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "enabled": req.Enabled})
+}
+
+func FeedsDelete(c *gin.Context, poller *feeds.Poller) {
+	id, ok := feedID(c)
+	if !ok {
+		return
+	}
+	if err := poller.Delete(id); err != nil {
+		respondFeedError(c, err, "Failed to delete feed")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Feed unsubscribed"})
+}
+
+// feedResponse describes a subscription after a poll. The poll's error is
+// also on the row as last_error; it is repeated as poll_error so a caller
+// can tell this poll's outcome from an earlier one's.
+func feedResponse(sub models.FeedSubscription, pollErr error) gin.H {
+	response := gin.H{
+		"id":             sub.ID,
+		"url":            sub.URL,
+		"title":          sub.Title,
+		"entries":        sub.EntryCount,
+		"last_polled_at": sub.LastPolledAt,
+		"archived_feed":  "/feeds/" + strconv.FormatUint(uint64(sub.ID), 10),
+	}
+	if pollErr != nil {
+		response["poll_error"] = pollErr.Error()
+	}
+	return response
+}
+
+func feedID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feed ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func respondFeedError(c *gin.Context, err error, message string) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Feed not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
+// archivedRSS is the RSS 2.0 document ArchivedFeed serves.
+type archivedRSS struct {
+	XMLName xml.Name           `xml:"rss"`
+	Version string             `xml:"version,attr"`
+	Channel archivedRSSChannel `xml:"channel"`
+}
+
+type archivedRSSChannel struct {
+	Title       string            `xml:"title"`
+	Link        string            `xml:"link"`
+	Description string            `xml:"description"`
+	Items       []archivedRSSItem `xml:"item"`
+}
+
+type archivedRSSItem struct {
+	Title       string                `xml:"title,omitempty"`
+	Link        string                `xml:"link"`
+	GUID        archivedRSSGUID       `xml:"guid"`
+	PubDate     string                `xml:"pubDate,omitempty"`
+	Description string                `xml:"description,omitempty"`
+	Source      *archivedRSSSource    `xml:"source,omitempty"`
+	Enclosure   *archivedRSSEnclosure `xml:"enclosure,omitempty"`
+}
+
+type archivedRSSGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type archivedRSSSource struct {
+	URL   string `xml:"url,attr"`
+	Value string `xml:",chardata"`
+}
+
+type archivedRSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length int64  `xml:"length,attr"`
+}
+
+// ArchivedFeed serves a subscription's captured entries as RSS 2.0, with
+// every link pointing at the archive instead of the publisher: an entry's
+// link at its capture, and its enclosure at the archived file once one is
+// stored. Entries that were only marked seen, or whose capture could not be
+// queued yet, are left out. The original GUIDs are kept so a reader that
+// already has an entry does not show it twice.
+//
+// No API key is required: it lists the same public captures as the viewer.
+func ArchivedFeed(c *gin.Context, db *gorm.DB) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.String(http.StatusNotFound, "Feed not found")
+		return
+	}
+	var sub models.FeedSubscription
+	if err := db.First(&sub, id).Error; err != nil {
+		c.String(http.StatusNotFound, "Feed not found")
+		return
+	}
+
+	var entries []models.FeedEntry
+	if err := db.Preload("Enclosures").
+		Where("feed_subscription_id = ?", sub.ID).
+		Where("short_id <> '' OR id IN (?)", db.Model(&models.FeedEnclosure{}).Select("feed_entry_id").Where("short_id <> ''")).
+		Order("id DESC").Limit(archivedFeedLimit).
+		Find(&entries).Error; err != nil {
+		c.String(http.StatusInternalServerError, "Failed to load feed entries")
+		return
+	}
+
+	title := sub.Title
+	if title == "" {
+		title = sub.URL
+	}
+	doc := archivedRSS{
+		Version: "2.0",
+		Channel: archivedRSSChannel{
+			Title:       title + " (archived)",
+			Link:        utils.BuildFullURL(c, "feeds/"+strconv.FormatUint(uint64(sub.ID), 10)),
+			Description: "Archived copies of the entries of " + sub.URL,
+		},
+	}
+	for _, entry := range entries {
+		item := archivedRSSItem{
+			Title:       entry.Title,
+			GUID:        archivedRSSGUID{Value: entry.GUID},
+			Description: entry.Summary,
+			Source:      &archivedRSSSource{URL: sub.URL, Value: title},
+		}
+		if entry.PublishedAt != nil {
+			item.PubDate = entry.PublishedAt.UTC().Format(time.RFC1123Z)
+		}
+		if entry.ShortID != "" {
+			item.Link = utils.BuildFullURL(c, entry.ShortID)
+		}
+		for _, enclosure := range entry.Enclosures {
+			if archived := archivedEnclosure(c, db, enclosure); archived != nil {
+				// RSS allows one enclosure per item; the first archived one
+				// is the episode in every feed that has more.
+				item.Enclosure = archived
+				break
+			}
+		}
+		if item.Link == "" {
+			// An entry whose only capture is its enclosure.
+			for _, enclosure := range entry.Enclosures {
+				if enclosure.ShortID != "" {
+					item.Link = utils.BuildFullURL(c, enclosure.ShortID)
+					break
+				}
+			}
+		}
+		doc.Channel.Items = append(doc.Channel.Items, item)
+	}
+
+	output, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Failed to render feed")
+		return
+	}
+	c.Data(http.StatusOK, "application/rss+xml; charset=utf-8", append([]byte(xml.Header), output...))
+}
+
+// archivedEnclosureTypes are the archive types an enclosure may be served as,
+// best first: the file itself, not a page about it.
+var archivedEnclosureTypes = []string{utils.ArchiveTypeAudio, utils.ArchiveTypeYtDlp}
+
+// archivedEnclosure points an enclosure at its stored file, or returns nil
+// while the capture has none completed. An alias capture's file is its
+// canonical capture's.
+func archivedEnclosure(c *gin.Context, db *gorm.DB, enclosure models.FeedEnclosure) *archivedRSSEnclosure {
+	if enclosure.ShortID == "" {
+		return nil
+	}
+	var capture models.Capture
+	if err := db.Where("short_id = ?", enclosure.ShortID).First(&capture).Error; err != nil {
+		return nil
+	}
+	if capture.AliasOfID != nil {
+		if err := db.First(&capture, *capture.AliasOfID).Error; err != nil {
+			return nil
+		}
+	}
+	for _, typ := range archivedEnclosureTypes {
+		var item models.ArchiveItem
+		if err := db.Where("capture_id = ? AND type = ? AND status = ?", capture.ID, typ, "completed").First(&item).Error; err != nil {
+			continue
+		}
+		contentType, _ := contentTypeForArchive(item.Type, item.Extension)
+		return &archivedRSSEnclosure{
+			URL:    utils.BuildFullURL(c, "archive/"+capture.ShortID+"/"+item.Type),
+			Type:   contentType,
+			Length: item.FileSize,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"arker/internal/models"
+)
+
+func TestArchivedFeedRewritesLinksIntoTheArchive(t *testing.T) {
+	db := newHandlerLogTestDB(t)
+	if err := db.AutoMigrate(&models.FeedSubscription{}, &models.FeedEntry{}, &models.FeedEnclosure{}); err != nil {
+		t.Fatal(err)
+	}
+	createVideoCapture(t, db, "post1", "https://pod.example/1", map[string]string{"mhtml": "completed"})
+	episode := createVideoCapture(t, db, "aud01", "https://cdn.pod.example/1.mp3", map[string]string{"audio": "completed"})
+	db.Model(&models.ArchiveItem{}).Where("capture_id = ?", episode.ID).Updates(map[string]interface{}{"extension": ".m4a", "file_size": 4096})
+	// The second episode's audio is still downloading.
+	createVideoCapture(t, db, "aud02", "https://cdn.pod.example/2.mp3", map[string]string{"audio": "pending"})
+
+	sub := models.FeedSubscription{URL: "https://pod.example/feed.xml", Title: "Example Radio", Enabled: true}
+	db.Create(&sub)
+	published := time.Date(2026, 10, 6, 9, 0, 0, 0, time.UTC)
+	db.Create(&models.FeedEntry{
+		FeedSubscriptionID: sub.ID, GUID: "ep-1", Title: "Episode 1", Link: "https://pod.example/1", ShortID: "post1", PublishedAt: &published,
+		Enclosures: []models.FeedEnclosure{{URL: "https://cdn.pod.example/1.mp3", Type: "audio/mpeg", ShortID: "aud01"}},
+	})
+	db.Create(&models.FeedEntry{
+		FeedSubscriptionID: sub.ID, GUID: "ep-2", Title: "Episode 2",
+		Enclosures: []models.FeedEnclosure{{URL: "https://cdn.pod.example/2.mp3", Type: "audio/mpeg", ShortID: "aud02"}},
+	})
+	// Marked seen when the feed was subscribed; never captured.
+	db.Create(&models.FeedEntry{FeedSubscriptionID: sub.ID, GUID: "ep-0", Title: "Episode 0", Link: "https://pod.example/0"})
+
+	router := gin.New()
+	router.GET("/feeds/:id", func(c *gin.Context) { ArchivedFeed(c, db) })
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/feeds/1", nil)
+	req.Host = "archive.example"
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+	}
+	var doc archivedRSS
+	if err := xml.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode: %v\n%s", err, w.Body.String())
+	}
+	items := doc.Channel.Items
+	if len(items) != 2 {
+		t.Fatalf("items = %+v; want the two captured entries only", items)
+	}
+
+	// Newest recorded first.
+	second, first := items[0], items[1]
+	if first.Link != "http://archive.example/post1" || first.GUID.Value != "ep-1" || first.PubDate == "" {
+		t.Errorf("first item = %+v", first)
+	}
+	if first.Enclosure == nil || first.Enclosure.URL != "http://archive.example/archive/aud01/audio" ||
+		first.Enclosure.Type != "audio/mp4" || first.Enclosure.Length != 4096 {
+		t.Errorf("first enclosure = %+v; want the stored M4A", first.Enclosure)
+	}
+	if second.Link != "http://archive.example/aud02" || second.Enclosure != nil {
+		t.Errorf("second item = %+v; want a link to the pending capture and no enclosure yet", second)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/feeds/99", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown feed status = %d, want 404", w.Code)
+	}
+}
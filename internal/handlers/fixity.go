@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+
+	"arker/internal/models"
+	"arker/internal/workers"
+)
+
+// fixityFailureRow is one item whose latest audit failed, as the admin page
+// lists it.
+type fixityFailureRow struct {
+	Audit   models.FixityAudit
+	ShortID string
+	Type    string
+	URL     string
+	// State is what has happened to the item since: "" while it can be
+	// recaptured, otherwise a note on the recapture already under way.
+	State string
+}
+
+// Recoverable reports whether the row offers a recapture.
+func (r fixityFailureRow) Recoverable() bool { return r.State == "" }
+
+func FixityGet(c *gin.Context, db *gorm.DB) {
+	rows, err := fixityFailureRows(db)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Failed to load fixity audits")
+		return
+	}
+	var audited int64
+	var lastAudit models.FixityAudit
+	db.Model(&models.FixityAudit{}).Distinct("archive_item_id").Count(&audited)
+	db.Order("id DESC").Limit(1).Find(&lastAudit)
+	var lastAuditAt *time.Time
+	if lastAudit.ID != 0 {
+		lastAuditAt = &lastAudit.CreatedAt
+	}
+	c.HTML(http.StatusOK, "fixity.html", gin.H{
+		"failures":    rows,
+		"audited":     audited,
+		"lastAuditAt": lastAuditAt,
+	})
+}
+
+// FixityAudit queues an audit pass now instead of at the next interval.
+func FixityAudit(c *gin.Context, riverClient *river.Client[pgx.Tx]) {
+	if err := workers.EnqueueFixityAudit(c.Request.Context(), riverClient); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue audit"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Audit queued"})
+}
+
+func FixityRecapture(c *gin.Context, db *gorm.DB, riverClient *river.Client[pgx.Tx]) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+	err = workers.RecaptureFixityFailure(c.Request.Context(), db, riverClient, uint(id))
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+	case errors.Is(err, workers.ErrNotRecoverable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue recapture"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "Recapture queued"})
+	}
+}
+
+// FixityRecaptureAll queues a recapture of every item that can have one.
+func FixityRecaptureAll(c *gin.Context, db *gorm.DB, riverClient *river.Client[pgx.Tx]) {
+	rows, err := fixityFailureRows(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load fixity audits"})
+		return
+	}
+	queued, recoverable := 0, 0
+	for _, row := range rows {
+		if !row.Recoverable() {
+			continue
+		}
+		recoverable++
+		if workers.RecaptureFixityFailure(c.Request.Context(), db, riverClient, row.Audit.ArchiveItemID) == nil {
+			queued++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Queued recaptures of %d of %d damaged items", queued, recoverable),
+	})
+}
+
+// fixityFailureRows joins each failing audit to its item and capture.
+func fixityFailureRows(db *gorm.DB) ([]fixityFailureRow, error) {
+	audits, err := workers.FixityFailures(db)
+	if err != nil {
+		return nil, err
+	}
+	if len(audits) == 0 {
+		return nil, nil
+	}
+	ids := make([]uint, len(audits))
+	for i, audit := range audits {
+		ids[i] = audit.ArchiveItemID
+	}
+	var items []models.ArchiveItem
+	if err := db.Where("id IN ?", ids).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	itemsByID := make(map[uint]models.ArchiveItem, len(items))
+	captureIDs := make([]uint, 0, len(items))
+	for _, item := range items {
+		itemsByID[item.ID] = item
+		captureIDs = append(captureIDs, item.CaptureID)
+	}
+	var captures []models.Capture
+	if err := db.Preload("ArchivedURL").Where("id IN ?", captureIDs).Find(&captures).Error; err != nil {
+		return nil, err
+	}
+	capturesByID := make(map[uint]models.Capture, len(captures))
+	for _, capture := range captures {
+		capturesByID[capture.ID] = capture
+	}
+
+	rows := make([]fixityFailureRow, 0, len(audits))
+	for _, audit := range audits {
+		item, ok := itemsByID[audit.ArchiveItemID]
+		if !ok {
+			// Deleted since; nothing left to repair.
+			continue
+		}
+		capture := capturesByID[item.CaptureID]
+		row := fixityFailureRow{
+			Audit:   audit,
+			ShortID: capture.ShortID,
+			Type:    item.Type,
+			URL:     capture.ArchivedURL.Original,
+		}
+		switch {
+		case item.Status == "pending" || item.Status == "processing":
+			row.State = "Recapture under way"
+		case item.Status == "failed":
+			row.State = "Recapture failed"
+		case item.StorageKey != workers.AuditedItemKey(audit):
+			row.State = "Recaptured; awaiting re-audit"
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
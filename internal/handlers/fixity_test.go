@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"arker/internal/models"
+)
+
+func TestFixityPageListsDamagedItems(t *testing.T) {
+	db := newHandlerLogTestDB(t)
+	if err := db.AutoMigrate(&models.FixityAudit{}, &models.FixityBaseline{}); err != nil {
+		t.Fatal(err)
+	}
+	item := func(shortID string, status, key string) models.ArchiveItem {
+		capture := createVideoCapture(t, db, shortID, "https://example.com/"+shortID, map[string]string{"mhtml": status})
+		var it models.ArchiveItem
+		db.Where("capture_id = ?", capture.ID).First(&it)
+		db.Model(&it).UpdateColumn("storage_key", key)
+		it.StorageKey = key
+		return it
+	}
+	damaged := item("dmg01", "completed", "dmg01/mhtml-aa.mhtml")
+	db.Create(&models.FixityAudit{ArchiveItemID: damaged.ID, StorageKey: damaged.StorageKey, Status: models.FixityStatusOK})
+	db.Create(&models.FixityAudit{ArchiveItemID: damaged.ID, StorageKey: damaged.StorageKey, Status: models.FixityStatusChecksumMismatch, ExpectedSize: 10, ActualSize: 10})
+	replaced := item("rpl01", "completed", "rpl01/mhtml-bb.mhtml")
+	db.Create(&models.FixityAudit{ArchiveItemID: replaced.ID, StorageKey: "rpl01/mhtml-aa.mhtml", Status: models.FixityStatusMissing, Error: "no such key"})
+	// Failed once, fine since.
+	healed := item("hea01", "completed", "hea01/mhtml-aa.mhtml")
+	db.Create(&models.FixityAudit{ArchiveItemID: healed.ID, StorageKey: healed.StorageKey, Status: models.FixityStatusError, Error: "timeout"})
+	db.Create(&models.FixityAudit{ArchiveItemID: healed.ID, StorageKey: healed.StorageKey, Status: models.FixityStatusOK})
+
+	rows, err := fixityFailureRows(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("rows = %+v", rows)
+	}
+	if rows[0].ShortID != "rpl01" || rows[0].Recoverable() || rows[0].State != "Recaptured; awaiting re-audit" {
+		t.Errorf("replaced row = %+v", rows[0])
+	}
+	if rows[1].ShortID != "dmg01" || !rows[1].Recoverable() || rows[1].URL != "https://example.com/dmg01" {
+		t.Errorf("damaged row = %+v", rows[1])
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.LoadHTMLFiles(filepath.Join("..", "..", "templates", "fixity.html"))
+	r.GET("/admin/fixity", func(c *gin.Context) { FixityGet(c, db) })
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/admin/fixity", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{"3 items audited", "checksum_mismatch", "no such key", fmt.Sprintf("recapture( %d )", damaged.ID), "Recaptured; awaiting re-audit"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page lacks %q", want)
+		}
+	}
+	if strings.Contains(body, "hea01") {
+		t.Error("page lists an item whose latest audit passed")
+	}
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"arker/internal/archivers"
+	"arker/internal/models"
+	"arker/internal/storage"
+	"arker/internal/utils"
+)
+
+// maxForgeManifestSize bounds the manifest read for the viewer. It indexes up
+// to FORGE_MAX_THREADS threads plus every release, so it stays small.
+const maxForgeManifestSize = 16 << 20
+
+// findForgeItem loads the completed forge item of a capture, answering 404
+// itself when there is none.
+func findForgeItem(c *gin.Context, db *gorm.DB, shortID string) (*models.ArchiveItem, bool) {
+	var item models.ArchiveItem
+	if err := db.Joins("JOIN captures ON captures.id = archive_items.capture_id").
+		Where("captures.short_id = ? AND archive_items.type = ?", shortID, utils.ArchiveTypeForge).
+		First(&item).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not a project capture"})
+		return nil, false
+	}
+	if item.Status != "completed" || item.StorageKey == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project capture not available"})
+		return nil, false
+	}
+	return &item, true
+}
+
+// ServeForgeManifest returns the index of a project capture: repository
+// metadata, threads, releases, README and wiki, with the bundle paths the
+// viewer fetches through ServeForgeFile.
+func ServeForgeManifest(c *gin.Context, store storage.Storage, db *gorm.DB) {
+	shortID := c.Param("shortid")
+	if redirectIfAlias(c, db, shortID) {
+		return
+	}
+	item, ok := findForgeItem(c, db, shortID)
+	if !ok {
+		return
+	}
+
+	var manifest []byte
+	if item.MetadataKey != "" {
+		if raw, err := readStoredJSON(store, item.MetadataKey, maxForgeManifestSize); err == nil {
+			manifest = raw
+		}
+	}
+	// The sidecar is a copy of the bundle's first entry, so the bundle can
+	// always answer for it.
+	if manifest == nil {
+		zr, cleanup, err := openGalleryZipItem(store, item)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Archive temporarily unavailable"})
+			return
+		}
+		defer cleanup()
+		if entry := findZipEntry(zr, archivers.ForgeManifestFilename); entry != nil {
+			manifest, _ = readGalleryZipEntry(entry, maxForgeManifestSize)
+		}
+	}
+	if manifest == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project manifest not available"})
+		return
+	}
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, "application/json; charset=utf-8", manifest)
+}
+
+// ServeForgeFile serves one entry of a project bundle: a thread, the README,
+// a wiki page or a release asset.
+func ServeForgeFile(c *gin.Context, store storage.Storage, db *gorm.DB) {
+	shortID := c.Param("shortid")
+	requested := c.Param("filepath")
+	if decoded, err := url.PathUnescape(requested); err == nil {
+		requested = decoded
+	}
+	requested = strings.TrimPrefix(requested, "/")
+	if requested == "" || path.Clean(requested) != requested || strings.HasPrefix(requested, "../") {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if redirectIfAlias(c, db, shortID) {
+		return
+	}
+	item, ok := findForgeItem(c, db, shortID)
+	if !ok {
+		return
+	}
+	zr, cleanup, err := openGalleryZipItem(store, item)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Archive temporarily unavailable"})
+		return
+	}
+	defer cleanup()
+	entry := findZipEntry(zr, requested)
+	if entry == nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	serveForgeEntry(c, shortID, entry)
+}
+
+func findZipEntry(zr *zip.Reader, name string) *zip.File {
+	for _, file := range zr.File {
+		if file.Name == name {
+			return file
+		}
+	}
+	return nil
+}
+
+// serveForgeEntry serves an entry with a type derived from its name alone.
+// Everything in the bundle came from the project, so HTML may not run
+// script and release assets are always downloads.
+func serveForgeEntry(c *gin.Context, shortID string, entry *zip.File) {
+	contents, err := entry.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file from archive"})
+		return
+	}
+	defer contents.Close()
+
+	c.Header("Content-Type", forgeEntryContentType(entry.Name))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "default-src 'none'; img-src * data:; style-src 'unsafe-inline'")
+	c.Header("ETag", fmt.Sprintf("\"%s-%d-%x\"", shortID, entry.UncompressedSize64, entry.CRC32))
+	if strings.HasPrefix(entry.Name, "releases/") {
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(entry.Name)}))
+	}
+
+	// Small entries are buffered so Range and If-None-Match work; release
+	// assets can be gigabytes and are streamed whole.
+	if entry.UncompressedSize64 <= maxGalleryEntrySize {
+		data, err := io.ReadAll(contents)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file from archive"})
+			return
+		}
+		http.ServeContent(c.Writer, c.Request, entry.Name, time.Time{}, bytes.NewReader(data))
+		return
+	}
+	c.Header("Content-Length", strconv.FormatUint(entry.UncompressedSize64, 10))
+	c.Status(http.StatusOK)
+	if c.Request.Method != http.MethodHead {
+		io.Copy(c.Writer, contents)
+	}
+}
+
+func forgeEntryContentType(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json":
+		return "application/json; charset=utf-8"
+	case ".html", ".htm":
+		return "text/html; charset=utf-8"
+	case ".md", ".markdown", ".txt", ".rst", ".org", ".adoc", ".mediawiki", ".textile", "":
+		return "text/plain; charset=utf-8"
+	}
+	// SVG and HTML under other names could carry script; see
+	// inlineFileContentTypes.
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" &&
+		!strings.HasPrefix(contentType, "text/html") && !strings.HasPrefix(contentType, "image/svg") {
+		return contentType
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"arker/internal/models"
+	"arker/internal/storage"
+)
+
+func forgeRouter(db *gorm.DB, store storage.Storage) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/forge/:shortid/manifest", func(c *gin.Context) { ServeForgeManifest(c, store, db) })
+	r.GET("/forge/:shortid/file/*filepath", func(c *gin.Context) { ServeForgeFile(c, store, db) })
+	return r
+}
+
+// storeForgeBundle gives the capture's forge item a stored bundle with the
+// given entries and no metadata sidecar, as the bundle alone must suffice.
+func storeForgeBundle(t *testing.T, db *gorm.DB, store storage.Storage, capture models.Capture, entries map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"forge.json", "readme/readme.html", "threads/issue-1.json", "releases/v1/lamp.zip"} {
+		if content, ok := entries[name]; ok {
+			w, _ := zw.Create(name)
+			w.Write([]byte(content))
+		}
+	}
+	zw.Close()
+	key := capture.ShortID + "/forge.zip"
+	w, _ := store.Writer(key)
+	w.Write(buf.Bytes())
+	w.Close()
+	if err := db.Model(&models.ArchiveItem{}).Where("capture_id = ? AND type = ?", capture.ID, "forge").
+		Updates(map[string]any{"storage_key": key, "extension": ".zip"}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServeForgeBundle(t *testing.T) {
+	db := newHandlerLogTestDB(t)
+	store := storage.NewMemoryStorage()
+	r := forgeRouter(db, store)
+	capture := createVideoCapture(t, db, "forge1", "https://github.com/octo/lamp", map[string]string{"forge": "completed"})
+	storeForgeBundle(t, db, store, capture, map[string]string{
+		"forge.json":           `{"project":"octo/lamp","threads":[{"path":"threads/issue-1.json"}]}`,
+		"readme/readme.html":   `<h1>Lamp</h1><script>alert(1)</script>`,
+		"threads/issue-1.json": `{"number":1,"comments":[]}`,
+		"releases/v1/lamp.zip": "PK..",
+	})
+
+	manifest := readerGet(r, "/forge/forge1/manifest")
+	if manifest.Code != http.StatusOK || !strings.Contains(manifest.Body.String(), `"octo/lamp"`) {
+		t.Fatalf("manifest = %d: %s", manifest.Code, manifest.Body.String())
+	}
+
+	readme := readerGet(r, "/forge/forge1/file/readme/readme.html")
+	if readme.Code != http.StatusOK || !strings.HasPrefix(readme.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("readme = %d %s", readme.Code, readme.Header().Get("Content-Type"))
+	}
+	if csp := readme.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "default-src 'none'") {
+		t.Errorf("project HTML served with CSP %q", csp)
+	}
+
+	thread := readerGet(r, "/forge/forge1/file/threads/issue-1.json")
+	if thread.Code != http.StatusOK || !strings.HasPrefix(thread.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("thread = %d %s", thread.Code, thread.Header().Get("Content-Type"))
+	}
+
+	asset := readerGet(r, "/forge/forge1/file/releases/v1/lamp.zip")
+	if asset.Body.String() != "PK.." || !strings.HasPrefix(asset.Header().Get("Content-Disposition"), "attachment") {
+		t.Errorf("asset = %q, disposition %q", asset.Body.String(), asset.Header().Get("Content-Disposition"))
+	}
+
+	for _, path := range []string{"/forge/forge1/file/threads/../forge.json", "/forge/forge1/file/missing.json", "/forge/forge1/file/"} {
+		if rec := readerGet(r, path); rec.Code != http.StatusNotFound && rec.Code != http.StatusMovedPermanently {
+			t.Errorf("%s = %d, want not found", path, rec.Code)
+		}
+	}
+	if rec := readerGet(r, "/forge/nope/manifest"); rec.Code != http.StatusNotFound {
+		t.Errorf("manifest of an unknown capture = %d", rec.Code)
+	}
+}
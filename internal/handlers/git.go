@@ -1,129 +1,64 @@
 package handlers
 
 import (
-	"archive/tar"
-	"github.com/gin-gonic/gin"
-	"io"
 	"log"
 	"net/http"
-	"net/http/cgi"
-	"os"
-	"path/filepath"
 	"strings"
-	"sync"
 
-	"arker/internal/models"
-	"arker/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/go-git/go-billy/v5/osfs"
+	gitobjcache "github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
 	"gorm.io/gorm"
-)
 
-var cacheMutex = sync.Mutex{}
+	"arker/internal/gitcache"
+	"arker/internal/gitserve"
+	"arker/internal/models"
+)
 
-func GitHandler(c *gin.Context, storage storage.Storage, db *gorm.DB, cacheRoot string) {
+// GitHandler serves a git capture to git clients over smart HTTP, so
+// `git clone <host>/git/<shortid>` works, shallow clones included.
+func GitHandler(c *gin.Context, db *gorm.DB, cache *gitcache.Cache) {
 	path := c.Param("path") // e.g., /hc139d/info/refs?service=git-upload-pack
-	if path == "" {
+	shortID, rest, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if shortID == "" {
 		c.Status(http.StatusBadRequest)
 		return
 	}
-	parts := strings.SplitN(path[1:], "/", 2)
-	if len(parts) < 1 {
-		c.Status(http.StatusBadRequest)
-		return
-	}
-	shortID := parts[0]
 	// Alias captures redirect to the canonical clone URL; git clients follow
 	// the redirect on the initial info/refs request and rebase from there.
 	if redirectIfAlias(c, db, shortID) {
 		return
 	}
-	var capture models.Capture
-	if db.Where("short_id = ?", shortID).First(&capture).Error != nil {
-		c.Status(http.StatusNotFound)
-		return
-	}
-	var item models.ArchiveItem
-	if db.Where("capture_id = ? AND type = ?", capture.ID, "git").First(&item).Error != nil {
+	item, err := findGitItem(db, shortID)
+	if err != nil {
 		c.Status(http.StatusNotFound)
 		return
 	}
-	if item.Status != "completed" {
-		c.Status(http.StatusNotFound)
+	dir, release, err := cache.Acquire(shortID, item.StorageKey)
+	if err != nil {
+		log.Printf("Unpack error: %v", err)
+		c.Status(http.StatusInternalServerError)
 		return
 	}
-	targetDir := filepath.Join(cacheRoot, shortID)
-	cacheMutex.Lock()
-	_, err := os.Stat(targetDir)
-	if os.IsNotExist(err) {
-		if err := unpackGit(item.StorageKey, targetDir, storage); err != nil {
-			cacheMutex.Unlock()
-			log.Printf("Unpack error: %v", err)
-			c.Status(http.StatusInternalServerError)
-			return
-		}
-	}
-	cacheMutex.Unlock()
-
-	env := append(os.Environ(),
-		"GIT_PROJECT_ROOT="+cacheRoot,
-		"GIT_HTTP_EXPORT_ALL=true",
-		"PATH_INFO="+path,
-		"QUERY_STRING="+c.Request.URL.RawQuery,
-		"REQUEST_METHOD="+c.Request.Method,
-		"CONTENT_TYPE="+c.GetHeader("Content-Type"),
-	)
-	h := &cgi.Handler{
-		Path: "/usr/bin/git",
-		Args: []string{"http-backend"},
-		Env:  env,
-	}
-	h.ServeHTTP(c.Writer, c.Request)
+	defer release()
+	repo := filesystem.NewStorage(osfs.New(dir), gitobjcache.NewObjectLRUDefault())
+	defer repo.Close()
+	gitserve.ServeHTTP(c.Writer, c.Request, repo, "/"+rest)
 }
 
-func unpackGit(key string, targetDir string, storage storage.Storage) (err error) {
-	r, err := storage.Reader(key)
-	if err != nil {
-		return err
+// findGitItem loads the completed git item of a capture.
+func findGitItem(db *gorm.DB, shortID string) (*models.ArchiveItem, error) {
+	var capture models.Capture
+	if err := db.Where("short_id = ?", shortID).First(&capture).Error; err != nil {
+		return nil, err
 	}
-	defer r.Close()
-	tr := tar.NewReader(r)
-	if err = os.MkdirAll(targetDir, 0755); err != nil {
-		return err
+	var item models.ArchiveItem
+	if err := db.Where("capture_id = ? AND type = ?", capture.ID, "git").First(&item).Error; err != nil {
+		return nil, err
 	}
-	// If unpacking fails partway, remove the partial directory so the stat-gate in
-	// GitHandler re-unpacks on the next request instead of serving a corrupt repo.
-	defer func() {
-		if err != nil {
-			os.RemoveAll(targetDir)
-		}
-	}()
-	for {
-		hdr, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
-		tpath := filepath.Join(targetDir, hdr.Name)
-		switch hdr.Typeflag {
-		case tar.TypeDir:
-			if err = os.MkdirAll(tpath, os.FileMode(hdr.Mode)); err != nil {
-				return err
-			}
-		case tar.TypeReg:
-			if err = os.MkdirAll(filepath.Dir(tpath), 0755); err != nil {
-				return err
-			}
-			f, err := os.OpenFile(tpath, os.O_CREATE|os.O_RDWR, os.FileMode(hdr.Mode))
-			if err != nil {
-				return err
-			}
-			if _, err = io.Copy(f, tr); err != nil {
-				f.Close()
-				return err
-			}
-			f.Close()
-		}
+	if item.Status != "completed" {
+		return nil, gorm.ErrRecordNotFound
 	}
-	return nil
+	return &item, nil
 }
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-git/go-billy/v5/osfs"
+	gitobjcache "github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+
+	"arker/internal/gitcache"
+	"arker/internal/gitserve"
+	"arker/internal/gitview"
+	"arker/internal/models"
+	"arker/internal/storage"
+	"arker/internal/utils"
+)
+
+// gitExportKindBundle is GitExport.Kind for a bundle; source archives use
+// their format's name.
+const gitExportKindBundle = "bundle"
+
+// gitExportFlight makes concurrent first requests for one export generate
+// it once.
+var gitExportFlight singleflight.Group
+
+// gitExportSource is a git capture an export is made from.
+type gitExportSource struct {
+	shortID  string
+	item     *models.ArchiveItem
+	repoName string
+	dir      string // the unpacked repository; empty until acquired
+	release  func()
+}
+
+// loadGitExportSource finds a capture's completed git item and names its
+// repository. It answers the request itself when there is nothing to export.
+func loadGitExportSource(c *gin.Context, db *gorm.DB) (*gitExportSource, bool) {
+	shortID := c.Param("shortid")
+	if redirectIfAlias(c, db, shortID) {
+		return nil, false
+	}
+	item, err := findGitItem(db, shortID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "git archive not found"})
+		return nil, false
+	}
+	src := &gitExportSource{shortID: shortID, item: item, repoName: "repo"}
+	var archivedURL models.ArchivedURL
+	if err := db.Joins("JOIN captures ON captures.archived_url_id = archived_urls.id").
+		Where("captures.id = ?", item.CaptureID).First(&archivedURL).Error; err == nil {
+		if name := utils.ExtractRepoName(utils.GitRepoURL(archivedURL.Original)); name != "" {
+			src.repoName = name
+		}
+	}
+	return src, true
+}
+
+func (s *gitExportSource) acquire(cache *gitcache.Cache) error {
+	if s.dir != "" {
+		return nil
+	}
+	dir, release, err := cache.Acquire(s.shortID, s.item.StorageKey)
+	if err != nil {
+		return err
+	}
+	s.dir, s.release = dir, release
+	return nil
+}
+
+func (s *gitExportSource) close() {
+	if s.release != nil {
+		s.release()
+	}
+}
+
+// ServeGitBundle serves /archive/:shortid/git/bundle: the whole repository
+// as a git bundle, which `git clone <file>` reads like a remote.
+func ServeGitBundle(c *gin.Context, store storage.Storage, db *gorm.DB, cache *gitcache.Cache) {
+	src, ok := loadGitExportSource(c, db)
+	if !ok {
+		return
+	}
+	defer src.close()
+	serveGitExport(c, store, db, cache, src, models.GitExport{Kind: gitExportKindBundle}, "",
+		src.repoName+".bundle", gitserve.BundleContentType,
+		func(ctx context.Context, w io.Writer) error {
+			repo := filesystem.NewStorage(osfs.New(src.dir), gitobjcache.NewObjectLRUDefault())
+			defer repo.Close()
+			return gitserve.WriteBundle(ctx, w, repo)
+		})
+}
+
+// ServeGitTarball serves /archive/:shortid/git/tarball/<ref>: the files of
+// a branch, tag or commit as a source archive, like a code host's download
+// links. <ref> may end in .tar.gz, .tgz or .zip to choose the format;
+// without one it is a .tar.gz.
+//
+// An archive is stored once per commit and format, under the commit's full
+// hash, and its files sit under a directory named for the commit, so every
+// ref to one commit shares it. A branch or tag also gets an alias row, so
+// the next request for it is answered without opening the repository; an
+// abbreviated hash does not, since anyone can spell one many ways.
+func ServeGitTarball(c *gin.Context, store storage.Storage, db *gorm.DB, cache *gitcache.Cache) {
+	ref := strings.Trim(c.Param("ref"), "/")
+	format := gitview.FormatTarGz
+	for suffix, f := range map[string]string{".tar.gz": gitview.FormatTarGz, ".tgz": gitview.FormatTarGz, ".zip": gitview.FormatZip} {
+		if trimmed, found := strings.CutSuffix(ref, suffix); found {
+			ref, format = trimmed, f
+			break
+		}
+	}
+	if ref == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no branch, tag or commit named"})
+		return
+	}
+	src, ok := loadGitExportSource(c, db)
+	if !ok {
+		return
+	}
+	defer src.close()
+
+	// Named like a host names its archives: the repository and the ref.
+	filename := src.repoName + "-" + strings.ReplaceAll(ref, "/", "-") + "." + format
+	contentType := "application/gzip"
+	if format == gitview.FormatZip {
+		contentType = "application/zip"
+	}
+	// A capture never changes, so neither does what a ref names in it.
+	if export, found, err := findGitExport(db, src.item.ID, format, ref); err == nil && found {
+		serveStoredGitExport(c, store, export, filename, contentType)
+		return
+	}
+
+	if err := src.acquire(cache); err != nil {
+		log.Printf("Unpack error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "the archived repository could not be opened"})
+		return
+	}
+	repo, err := gitview.Open(src.dir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "the archived repository could not be opened"})
+		return
+	}
+	commit, err := repo.Commit(ref)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no such branch, tag or commit"})
+		return
+	}
+	hash := commit.Hash.String()
+	alias := ""
+	if !strings.HasPrefix(hash, strings.ToLower(ref)) {
+		alias = ref
+	}
+	serveGitExport(c, store, db, cache, src, models.GitExport{Kind: format, Ref: hash, Commit: hash}, alias,
+		filename, contentType,
+		func(ctx context.Context, w io.Writer) error {
+			return repo.WriteArchive(ctx, w, commit, format, src.repoName+"-"+hash)
+		})
+}
+
+// serveGitExport serves an export from storage, generating and storing it
+// first if this is the first request for it. want names the export; alias,
+// if set, is another ref to record it under.
+func serveGitExport(c *gin.Context, store storage.Storage, db *gorm.DB, cache *gitcache.Cache, src *gitExportSource, want models.GitExport, alias, filename, contentType string, generate func(context.Context, io.Writer) error) {
+	export, found, err := findGitExport(db, src.item.ID, want.Kind, want.Ref)
+	if err == nil && !found {
+		if c.Request.Method == http.MethodHead {
+			// Not generated yet; its size is not known until it is.
+			c.Header("Content-Type", contentType)
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+			c.Status(http.StatusOK)
+			return
+		}
+		flightKey := fmt.Sprintf("%d/%s/%s", src.item.ID, want.Kind, want.Ref)
+		var v any
+		v, err, _ = gitExportFlight.Do(flightKey, func() (any, error) {
+			if err := src.acquire(cache); err != nil {
+				return nil, err
+			}
+			return storeGitExport(store, db, src.item, want, generate)
+		})
+		if err == nil {
+			export = v.(models.GitExport)
+		}
+	}
+	if err != nil {
+		log.Printf("Git export %s %s of %s failed: %v", want.Kind, want.Ref, src.shortID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "the download could not be generated"})
+		return
+	}
+	if alias != "" {
+		// A concurrent request may have recorded it already; either row
+		// names the same file.
+		db.Create(&models.GitExport{ArchiveItemID: export.ArchiveItemID, Kind: export.Kind, Ref: alias,
+			Commit: export.Commit, StorageKey: export.StorageKey, Size: export.Size})
+	}
+	serveStoredGitExport(c, store, export, filename, contentType)
+}
+
+// findGitExport looks up an export already stored.
+func findGitExport(db *gorm.DB, itemID uint, kind, ref string) (models.GitExport, bool, error) {
+	var export models.GitExport
+	err := db.Where("archive_item_id = ? AND kind = ? AND ref = ?", itemID, kind, ref).First(&export).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return export, false, nil
+	}
+	return export, err == nil, err
+}
+
+func serveStoredGitExport(c *gin.Context, store storage.Storage, export models.GitExport, filename, contentType string) {
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	c.Header("Content-Length", fmt.Sprintf("%d", export.Size))
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Header("ETag", fmt.Sprintf("\"%s\"", export.StorageKey))
+	if c.Request.Method == http.MethodHead {
+		c.Status(http.StatusOK)
+		return
+	}
+	r, err := store.Reader(export.StorageKey)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	defer r.Close()
+	if _, err := io.Copy(c.Writer, r); err != nil {
+		log.Printf("Error streaming git export %s: %v", export.StorageKey, err)
+	}
+}
+
+// storeGitExport generates an export into a temporary file, so a failure
+// never leaves a partial file in storage, then stores it beside the capture
+// and records it. Another server may have stored the same export meanwhile;
+// its row wins and this copy is left unused.
+func storeGitExport(store storage.Storage, db *gorm.DB, item *models.ArchiveItem, export models.GitExport, generate func(context.Context, io.Writer) error) (models.GitExport, error) {
+	tmp, err := os.CreateTemp("", "arker-git-export-")
+	if err != nil {
+		return models.GitExport{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	// Generation outlives the request that started it: others may be waiting
+	// on the same export.
+	if err := generate(context.Background(), tmp); err != nil {
+		return models.GitExport{}, err
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return models.GitExport{}, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return models.GitExport{}, err
+	}
+
+	nonce := make([]byte, 4)
+	rand.Read(nonce)
+	name := export.Kind
+	if export.Commit != "" {
+		name = "source-" + export.Commit + "." + export.Kind
+	}
+	// The bucket forbids overwrites, so every attempt writes a fresh key.
+	keyBase := strings.TrimSuffix(item.StorageKey, item.Extension)
+	export.StorageKey = fmt.Sprintf("%s-%s.%s", keyBase, hex.EncodeToString(nonce), name)
+	w, err := store.Writer(export.StorageKey)
+	if err != nil {
+		return models.GitExport{}, err
+	}
+	if _, err := io.Copy(w, tmp); err != nil {
+		w.Close()
+		return models.GitExport{}, err
+	}
+	if err := w.Close(); err != nil {
+		return models.GitExport{}, err
+	}
+
+	export.ArchiveItemID = item.ID
+	export.Size = size
+	if err := db.Create(&export).Error; err != nil {
+		if existing, found, _ := findGitExport(db, item.ID, export.Kind, export.Ref); found {
+			return existing, nil
+		}
+		return models.GitExport{}, err
+	}
+	return export, nil
+}
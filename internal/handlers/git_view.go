@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"gorm.io/gorm"
+
+	"arker/internal/gitcache"
+	"arker/internal/gitview"
+	"arker/internal/models"
+)
+
+// gitViewPageSize is how many commits one page of history lists.
+const gitViewPageSize = 50
+
+// gitViewCSP forbids script on repository pages. Rendered READMEs are
+// already stripped of raw HTML; this is the second line.
+const gitViewCSP = "default-src 'none'; img-src 'self' https: data:; style-src 'unsafe-inline'"
+
+type gitViewCrumb struct {
+	Name string
+	URL  string
+}
+
+type gitViewEntry struct {
+	gitview.Entry
+	URL string
+}
+
+type gitViewCommit struct {
+	gitview.Commit
+	URL string
+}
+
+type gitViewRef struct {
+	gitview.Ref
+	TreeURL string
+	LogURL  string
+}
+
+// gitViewURL builds a browser URL. rev and p are escaped segment by segment
+// so branch names and paths with slashes stay readable.
+func gitViewURL(shortID, view, rev, p string) string {
+	out := "/git-view/" + url.PathEscape(shortID) + "/" + view
+	for _, part := range []string{rev, p} {
+		if part == "" {
+			continue
+		}
+		for _, segment := range strings.Split(part, "/") {
+			out += "/" + url.PathEscape(segment)
+		}
+	}
+	return out
+}
+
+// GitView serves the repository browser of a git capture:
+//
+//	/git-view/:shortid                      the default branch's tree
+//	/git-view/:shortid/refs                 branches and tags
+//	/git-view/:shortid/tree/<rev>/<path>    a directory, with its README
+//	/git-view/:shortid/blob/<rev>/<path>    a file, highlighted or rendered
+//	/git-view/:shortid/raw/<rev>/<path>     a file's bytes
+//	/git-view/:shortid/log/<rev>/<path>     history, optionally of one path
+//	/git-view/:shortid/commit/<hash>        one commit and its diff
+//
+// <rev> is a branch, tag or commit hash; a URL naming a hash never changes
+// what it shows.
+func GitView(c *gin.Context, db *gorm.DB, cache *gitcache.Cache) {
+	shortID := c.Param("shortid")
+	if redirectIfAlias(c, db, shortID) {
+		return
+	}
+	item, err := findGitItem(db, shortID)
+	if err != nil {
+		gitViewError(c, shortID, http.StatusNotFound, "This capture has no archived repository.")
+		return
+	}
+	dir, release, err := cache.Acquire(shortID, item.StorageKey)
+	if err != nil {
+		log.Printf("Unpack error: %v", err)
+		gitViewError(c, shortID, http.StatusInternalServerError, "The archived repository could not be opened.")
+		return
+	}
+	defer release()
+	repo, err := gitview.Open(dir)
+	if err != nil {
+		gitViewError(c, shortID, http.StatusInternalServerError, "The archived repository could not be opened.")
+		return
+	}
+
+	var segments []string
+	if rest := strings.Trim(c.Param("path"), "/"); rest != "" {
+		segments = strings.Split(rest, "/")
+	}
+	if len(segments) == 0 {
+		rev := repo.DefaultBranch()
+		if _, err := repo.Commit(rev); err != nil {
+			branches, _, _ := repo.Refs()
+			if len(branches) == 0 {
+				gitViewError(c, shortID, http.StatusNotFound, "The archived repository is empty.")
+				return
+			}
+			rev = branches[0].Name
+		}
+		c.Redirect(http.StatusFound, gitViewURL(shortID, "tree", rev, ""))
+		return
+	}
+
+	view, args := segments[0], segments[1:]
+	data := gin.H{"short_id": shortID, "view": view, "refs_url": gitViewURL(shortID, "refs", "", "")}
+	if view == "refs" {
+		gitViewRefs(c, repo, shortID, data)
+		return
+	}
+	if view == "commit" {
+		gitViewCommitPage(c, repo, shortID, args, data)
+		return
+	}
+	if view != "tree" && view != "blob" && view != "raw" && view != "log" {
+		gitViewError(c, shortID, http.StatusNotFound, "No such page.")
+		return
+	}
+	rev, commit, p, err := repo.Resolve(args)
+	if err != nil {
+		gitViewError(c, shortID, http.StatusNotFound, "No such branch, tag or commit.")
+		return
+	}
+	data["rev"] = rev
+	data["crumbs"] = gitViewCrumbs(shortID, rev, p)
+	data["path"] = p
+	data["tree_url"] = gitViewURL(shortID, "tree", rev, "")
+	data["log_url"] = gitViewURL(shortID, "log", rev, p)
+
+	switch view {
+	case "tree":
+		if !repo.IsDir(commit, p) {
+			c.Redirect(http.StatusFound, gitViewURL(shortID, "blob", rev, p))
+			return
+		}
+		gitViewTree(c, repo, commit, shortID, rev, p, gitViewSubmodules(db, item.CaptureID), data)
+	case "blob":
+		if repo.IsDir(commit, p) {
+			c.Redirect(http.StatusFound, gitViewURL(shortID, "tree", rev, p))
+			return
+		}
+		gitViewBlob(c, repo, commit, shortID, rev, p, data)
+	case "raw":
+		gitViewRaw(c, repo, commit, p)
+	case "log":
+		gitViewLog(c, repo, commit, shortID, rev, p, data)
+	}
+}
+
+func gitViewCrumbs(shortID, rev, p string) []gitViewCrumb {
+	crumbs := []gitViewCrumb{{Name: rev, URL: gitViewURL(shortID, "tree", rev, "")}}
+	if p == "" {
+		return crumbs
+	}
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		crumb := gitViewCrumb{Name: part}
+		if i < len(parts)-1 {
+			crumb.URL = gitViewURL(shortID, "tree", rev, strings.Join(parts[:i+1], "/"))
+		}
+		crumbs = append(crumbs, crumb)
+	}
+	return crumbs
+}
+
+func gitViewRender(c *gin.Context, status int, data gin.H) {
+	c.Header("Content-Security-Policy", gitViewCSP)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.HTML(status, "git_view.html", data)
+}
+
+func gitViewError(c *gin.Context, shortID string, status int, message string) {
+	gitViewRender(c, status, gin.H{"short_id": shortID, "view": "error", "error": message})
+}
+
+func gitViewRefs(c *gin.Context, repo *gitview.Repository, shortID string, data gin.H) {
+	branches, tags, err := repo.Refs()
+	if err != nil {
+		gitViewError(c, shortID, http.StatusInternalServerError, "The repository's references could not be read.")
+		return
+	}
+	wrap := func(refs []gitview.Ref) []gitViewRef {
+		out := make([]gitViewRef, 0, len(refs))
+		for _, ref := range refs {
+			out = append(out, gitViewRef{Ref: ref, TreeURL: gitViewURL(shortID, "tree", ref.Name, ""), LogURL: gitViewURL(shortID, "log", ref.Name, "")})
+		}
+		return out
+	}
+	data["default_branch"] = repo.DefaultBranch()
+	data["branches"] = wrap(branches)
+	data["tags"] = wrap(tags)
+	gitViewRender(c, http.StatusOK, data)
+}
+
+// gitViewSubmodules maps the path of each submodule of a capture to the
+// short ID of the capture of its repository.
+func gitViewSubmodules(db *gorm.DB, captureID uint) map[string]string {
+	var rows []models.GitSubmodule
+	if err := db.Preload("ChildCapture").Where("parent_capture_id = ?", captureID).Find(&rows).Error; err != nil {
+		return nil
+	}
+	children := make(map[string]string, len(rows))
+	for _, row := range rows {
+		children[row.Path] = row.ChildCapture.ShortID
+	}
+	return children
+}
+
+// gitViewTree lists a directory. A submodule links to the commit it pins in
+// the capture of its repository, when the parent capture made one.
+func gitViewTree(c *gin.Context, repo *gitview.Repository, commit *object.Commit, shortID, rev, p string, submodules map[string]string, data gin.H) {
+	entries, err := repo.Tree(commit, p)
+	if err != nil {
+		gitViewError(c, shortID, http.StatusNotFound, "No such directory.")
+		return
+	}
+	listing := make([]gitViewEntry, 0, len(entries))
+	for _, entry := range entries {
+		view := "blob"
+		if entry.IsDir {
+			view = "tree"
+		}
+		e := gitViewEntry{Entry: entry}
+		if !entry.Submodule {
+			e.URL = gitViewURL(shortID, view, rev, entry.Path)
+		} else if child := submodules[entry.Path]; child != "" {
+			e.URL = gitViewURL(child, "tree", entry.Commit, "")
+		}
+		listing = append(listing, e)
+	}
+	data["entries"] = listing
+	if p != "" {
+		parent := path.Dir(p)
+		if parent == "." {
+			parent = ""
+		}
+		data["parent_url"] = gitViewURL(shortID, "tree", rev, parent)
+	}
+	summary := repo.Summary(commit)
+	data["commit"] = gitViewCommit{Commit: summary, URL: gitViewURL(shortID, "commit", summary.Hash, "")}
+	if readme, ok := repo.Readme(entries); ok {
+		if file, err := repo.File(commit, readme.Path); err == nil && file.Content != nil {
+			data["readme_name"] = readme.Name
+			if gitview.IsMarkdown(readme.Name) {
+				data["readme_html"] = gitview.RenderMarkdown(file.Content)
+			} else {
+				data["readme_text"] = string(file.Content)
+			}
+		}
+	}
+	gitViewRender(c, http.StatusOK, data)
+}
+
+func gitViewBlob(c *gin.Context, repo *gitview.Repository, commit *object.Commit, shortID, rev, p string, data gin.H) {
+	file, err := repo.File(commit, p)
+	if err != nil {
+		gitViewError(c, shortID, http.StatusNotFound, "No such file.")
+		return
+	}
+	data["file"] = file
+	data["raw_url"] = gitViewURL(shortID, "raw", rev, p)
+	if file.Content != nil {
+		// Markdown is shown rendered unless ?plain asks for the source.
+		if _, plain := c.GetQuery("plain"); gitview.IsMarkdown(p) && !plain {
+			data["rendered"] = gitview.RenderMarkdown(file.Content)
+			data["source_url"] = gitViewURL(shortID, "blob", rev, p) + "?plain"
+		} else {
+			data["code"] = gitview.Highlight(path.Base(p), file.Content)
+		}
+	}
+	gitViewRender(c, http.StatusOK, data)
+}
+
+// gitViewRaw serves a file's bytes. Text is labelled as plain text and
+// everything else as a download, so nothing from the repository renders as
+// a page on this origin.
+func gitViewRaw(c *gin.Context, repo *gitview.Repository, commit *object.Commit, p string) {
+	reader, size, err := repo.Raw(commit, p)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	defer reader.Close()
+	head := make([]byte, 8000)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	head = head[:n]
+	if strings.IndexByte(string(head), 0) >= 0 {
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Disposition", "attachment; filename="+strconv.Quote(path.Base(p)))
+	} else {
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+	}
+	c.Header("Content-Security-Policy", "sandbox")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Length", strconv.FormatInt(size, 10))
+	c.Status(http.StatusOK)
+	c.Writer.Write(head)
+	io.Copy(c.Writer, reader)
+}
+
+func gitViewLog(c *gin.Context, repo *gitview.Repository, commit *object.Commit, shortID, rev, p string, data gin.H) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	if page < 1 {
+		page = 1
+	}
+	commits, more, err := repo.Log(commit, p, (page-1)*gitViewPageSize, gitViewPageSize)
+	if err != nil {
+		gitViewError(c, shortID, http.StatusInternalServerError, "The history could not be read.")
+		return
+	}
+	listing := make([]gitViewCommit, 0, len(commits))
+	for _, entry := range commits {
+		listing = append(listing, gitViewCommit{Commit: entry, URL: gitViewURL(shortID, "commit", entry.Hash, "")})
+	}
+	data["commits"] = listing
+	logURL := gitViewURL(shortID, "log", rev, p)
+	if page > 1 {
+		data["prev_url"] = logURL + "?page=" + strconv.Itoa(page-1)
+	}
+	if more {
+		data["next_url"] = logURL + "?page=" + strconv.Itoa(page+1)
+	}
+	gitViewRender(c, http.StatusOK, data)
+}
+
+type gitViewDiff struct {
+	gitview.FileDiff
+	URL string
+}
+
+func gitViewCommitPage(c *gin.Context, repo *gitview.Repository, shortID string, args []string, data gin.H) {
+	if len(args) != 1 {
+		gitViewError(c, shortID, http.StatusNotFound, "No such commit.")
+		return
+	}
+	commit, err := repo.Commit(args[0])
+	if err != nil {
+		gitViewError(c, shortID, http.StatusNotFound, "No such commit.")
+		return
+	}
+	summary := repo.Summary(commit)
+	// A commit page is addressed by its full hash so the URL is stable.
+	if args[0] != summary.Hash {
+		c.Redirect(http.StatusFound, gitViewURL(shortID, "commit", summary.Hash, ""))
+		return
+	}
+	diffs, truncated, err := repo.Diff(c.Request.Context(), commit)
+	if err != nil {
+		gitViewError(c, shortID, http.StatusInternalServerError, "The commit's changes could not be read.")
+		return
+	}
+	files := make([]gitViewDiff, 0, len(diffs))
+	for _, d := range diffs {
+		entry := gitViewDiff{FileDiff: d}
+		if d.Status != "deleted" {
+			entry.URL = gitViewURL(shortID, "blob", summary.Hash, d.To)
+		}
+		files = append(files, entry)
+	}
+	parents := make([]gitViewCrumb, 0, len(summary.Parents))
+	for _, parent := range summary.Parents {
+		parents = append(parents, gitViewCrumb{Name: parent[:10], URL: gitViewURL(shortID, "commit", parent, "")})
+	}
+	data["commit"] = gitViewCommit{Commit: summary, URL: gitViewURL(shortID, "commit", summary.Hash, "")}
+	data["tree_url"] = gitViewURL(shortID, "tree", summary.Hash, "")
+	data["parents"] = parents
+	data["diffs"] = files
+	data["truncated"] = truncated
+	data["max_lines"] = gitview.MaxDiffLines
+	gitViewRender(c, http.StatusOK, data)
+}
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"gorm.io/gorm"
+
+	"arker/internal/archivers"
+	"arker/internal/gitcache"
+	"arker/internal/models"
+	"arker/internal/storage"
+)
+
+func gitViewRouter(t *testing.T, db *gorm.DB, store storage.Storage) *gin.Engine {
+	t.Helper()
+	cache, err := gitcache.New(t.TempDir(), 0, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.LoadHTMLFiles(filepath.Join("..", "..", "templates", "git_view.html"))
+	r.GET("/git-view/:shortid", func(c *gin.Context) { GitView(c, db, cache) })
+	r.GET("/git-view/:shortid/*path", func(c *gin.Context) { GitView(c, db, cache) })
+	return r
+}
+
+// storeGitRepo commits files to a fresh repository, one commit per map, and
+// stores its .git directory as the capture's git item, the way the git
+// archiver lays out its tar. It returns the commit hashes.
+func storeGitRepo(t *testing.T, db *gorm.DB, store storage.Storage, capture models.Capture, commits ...map[string]string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, _ := repo.Worktree()
+	when := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var hashes []string
+	for i, files := range commits {
+		for name, content := range files {
+			os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			wt.Add(name)
+		}
+		hash, err := wt.Commit("Commit "+string(rune('A'+i)), &git.CommitOptions{
+			Author: &object.Signature{Name: "Ana", Email: "ana@example.com", When: when.Add(time.Duration(i) * time.Hour)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash.String())
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := archivers.AddDirToTar(tw, filepath.Join(dir, ".git"), ""); err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+	key := capture.ShortID + "/git.tar"
+	w, _ := store.Writer(key)
+	w.Write(buf.Bytes())
+	w.Close()
+	if err := db.Model(&models.ArchiveItem{}).Where("capture_id = ? AND type = ?", capture.ID, "git").
+		Update("storage_key", key).Error; err != nil {
+		t.Fatal(err)
+	}
+	return hashes
+}
+
+func TestGitViewBrowsesRepository(t *testing.T) {
+	db := newHandlerLogTestDB(t)
+	store := storage.NewMemoryStorage()
+	r := gitViewRouter(t, db, store)
+	capture := createVideoCapture(t, db, "repo1", "https://git.example/octo/lamp.git", map[string]string{"git": "completed"})
+	hashes := storeGitRepo(t, db, store, capture,
+		map[string]string{"README.md": "# Lamp\n\n<script>alert(1)</script>\n", "src/main.go": "package main\n"},
+		map[string]string{"src/main.go": "package main\n\nfunc main() {}\n", "logo.bin": "PNG\x00\x01"},
+	)
+
+	root := readerGet(r, "/git-view/repo1")
+	if root.Code != http.StatusFound || root.Header().Get("Location") != "/git-view/repo1/tree/master" {
+		t.Fatalf("root = %d %q", root.Code, root.Header().Get("Location"))
+	}
+
+	tree := readerGet(r, "/git-view/repo1/tree/master")
+	body := tree.Body.String()
+	if tree.Code != http.StatusOK || !strings.Contains(body, `href="/git-view/repo1/tree/master/src"`) || !strings.Contains(body, "<h1>Lamp</h1>") {
+		t.Fatalf("tree = %d: %s", tree.Code, body)
+	}
+	if strings.Contains(body, "<script>") {
+		t.Error("README script rendered into the page")
+	}
+	if csp := tree.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "default-src 'none'") {
+		t.Errorf("tree served with CSP %q", csp)
+	}
+
+	blob := readerGet(r, "/git-view/repo1/blob/master/src/main.go")
+	if blob.Code != http.StatusOK || !strings.Contains(blob.Body.String(), `id="L3"`) {
+		t.Errorf("blob = %d: %s", blob.Code, blob.Body.String())
+	}
+	if rec := readerGet(r, "/git-view/repo1/tree/master/src/main.go"); rec.Code != http.StatusFound || rec.Header().Get("Location") != "/git-view/repo1/blob/master/src/main.go" {
+		t.Errorf("tree of a file = %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	old := readerGet(r, "/git-view/repo1/raw/"+hashes[0]+"/src/main.go")
+	if old.Body.String() != "package main\n" || !strings.HasPrefix(old.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("raw at first commit = %q %s", old.Body.String(), old.Header().Get("Content-Type"))
+	}
+	bin := readerGet(r, "/git-view/repo1/raw/master/logo.bin")
+	if bin.Header().Get("Content-Type") != "application/octet-stream" || !strings.HasPrefix(bin.Header().Get("Content-Disposition"), "attachment") {
+		t.Errorf("binary raw = %s, %s", bin.Header().Get("Content-Type"), bin.Header().Get("Content-Disposition"))
+	}
+
+	history := readerGet(r, "/git-view/repo1/log/master")
+	if !strings.Contains(history.Body.String(), "/git-view/repo1/commit/"+hashes[0]) || !strings.Contains(history.Body.String(), "Commit B") {
+		t.Errorf("log = %s", history.Body.String())
+	}
+
+	commit := readerGet(r, "/git-view/repo1/commit/"+hashes[1])
+	if commit.Code != http.StatusOK || !strings.Contains(commit.Body.String(), "+func main() {}") {
+		t.Errorf("commit = %d: %s", commit.Code, commit.Body.String())
+	}
+	if rec := readerGet(r, "/git-view/repo1/commit/"+hashes[1][:7]); rec.Header().Get("Location") != "/git-view/repo1/commit/"+hashes[1] {
+		t.Errorf("abbreviated commit redirects to %q", rec.Header().Get("Location"))
+	}
+
+	refs := readerGet(r, "/git-view/repo1/refs")
+	if !strings.Contains(refs.Body.String(), `href="/git-view/repo1/tree/master"`) {
+		t.Errorf("refs = %s", refs.Body.String())
+	}
+
+	for _, path := range []string{"/git-view/repo1/tree/nope", "/git-view/repo1/blob/master/missing", "/git-view/repo1/bogus", "/git-view/nope"} {
+		if rec := readerGet(r, path); rec.Code != http.StatusNotFound {
+			t.Errorf("%s = %d, want not found", path, rec.Code)
+		}
+	}
+}
+
+// An incremental capture downloads as the whole repository, its parent's
+// objects included, not as the delta it is stored as.
+func TestServeArchiveRebuildsGitDelta(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newHandlerLogTestDB(t)
+	store := storage.NewMemoryStorage()
+	base := createVideoCapture(t, db, "base1", "https://git.example/octo/lamp", map[string]string{"git": "completed"})
+	storeGitRepo(t, db, store, base, map[string]string{"README.md": "hi\n"})
+	capture := createVideoCapture(t, db, "next1", "https://git.example/octo/lamp.git", map[string]string{"git": "completed"})
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	marker, _ := json.Marshal(gitcache.Delta{ParentShortID: "base1", ParentStorageKey: "base1/git.tar", Depth: 1})
+	for _, f := range []struct{ name, body string }{{gitcache.DeltaMarker, string(marker)}, {"HEAD", "ref: refs/heads/trunk\n"}} {
+		tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.body)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(f.body))
+	}
+	tw.Close()
+	key := "next1/git" + gitcache.DeltaExtension
+	w, _ := store.Writer(key)
+	w.Write(buf.Bytes())
+	w.Close()
+	db.Model(&models.ArchiveItem{}).Where("capture_id = ?", capture.ID).
+		Updates(map[string]any{"storage_key": key, "extension": gitcache.DeltaExtension})
+
+	r := gin.New()
+	r.GET("/archive/:shortid/:type", func(c *gin.Context) { ServeArchive(c, store, db) })
+	resp := readerGet(r, "/archive/next1/git")
+	if resp.Code != http.StatusOK || resp.Header().Get("Content-Type") != "application/x-tar" ||
+		!strings.HasSuffix(resp.Header().Get("Content-Disposition"), `.tar"`) {
+		t.Fatalf("download = %d %v", resp.Code, resp.Header())
+	}
+	tr := tar.NewReader(resp.Body)
+	objects, head := 0, ""
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		switch {
+		case strings.HasPrefix(hdr.Name, "objects/") && hdr.Typeflag == tar.TypeReg:
+			objects++
+		case hdr.Name == "HEAD":
+			data, _ := io.ReadAll(tr)
+			head += string(data)
+		case hdr.Name == gitcache.DeltaMarker:
+			t.Error("the delta marker was downloaded")
+		}
+	}
+	if objects == 0 || head != "ref: refs/heads/trunk\n" {
+		t.Errorf("download has %d object files and HEAD %q", objects, head)
+	}
+}
+
+func TestGitExports(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newHandlerLogTestDB(t)
+	if err := db.AutoMigrate(&models.GitExport{}); err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewMemoryStorage()
+	cache, err := gitcache.New(t.TempDir(), 0, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.GET("/archive/:shortid/git/bundle", func(c *gin.Context) { ServeGitBundle(c, store, db, cache) })
+	r.GET("/archive/:shortid/git/tarball/*ref", func(c *gin.Context) { ServeGitTarball(c, store, db, cache) })
+	capture := createVideoCapture(t, db, "repo1", "https://github.com/octo/lamp", map[string]string{"git": "completed"})
+	hashes := storeGitRepo(t, db, store, capture,
+		map[string]string{"README.md": "# Lamp\n"},
+		map[string]string{"src/main.go": "package main\n"},
+	)
+
+	bundle := readerGet(r, "/archive/repo1/git/bundle")
+	if bundle.Code != http.StatusOK || !strings.HasPrefix(bundle.Body.String(), "# v2 git bundle\n") ||
+		bundle.Header().Get("Content-Disposition") != `attachment; filename="lamp.bundle"` {
+		t.Fatalf("bundle = %d %v", bundle.Code, bundle.Header())
+	}
+	if again := readerGet(r, "/archive/repo1/git/bundle"); again.Body.String() != bundle.Body.String() ||
+		again.Header().Get("ETag") != bundle.Header().Get("ETag") {
+		t.Error("second bundle request was not served from storage")
+	}
+
+	tarball := readerGet(r, "/archive/repo1/git/tarball/"+hashes[0])
+	if tarball.Code != http.StatusOK || tarball.Header().Get("Content-Type") != "application/gzip" {
+		t.Fatalf("tarball = %d %v", tarball.Code, tarball.Header())
+	}
+	gz, err := gzip.NewReader(tarball.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		if hdr.Typeflag != tar.TypeXGlobalHeader {
+			names = append(names, hdr.Name)
+		}
+	}
+	prefix := "lamp-" + hashes[0]
+	if strings.Join(names, ",") != prefix+"/,"+prefix+"/README.md" {
+		t.Errorf("tarball of the first commit = %v", names)
+	}
+
+	zipped := readerGet(r, "/archive/repo1/git/tarball/master.zip")
+	zr, err := zip.NewReader(bytes.NewReader(zipped.Body.Bytes()), int64(zipped.Body.Len()))
+	if err != nil || zr.Comment != hashes[1] || zipped.Header().Get("Content-Disposition") != `attachment; filename="lamp-master.zip"` {
+		t.Errorf("zip = %v %v, %v", zipped.Header(), zr, err)
+	}
+
+	// Abbreviations of a commit already exported share its archive and add
+	// no rows.
+	for _, abbrev := range []string{hashes[1][:7] + ".zip", hashes[1][:12] + ".zip", hashes[1] + ".zip"} {
+		again := readerGet(r, "/archive/repo1/git/tarball/"+abbrev)
+		if again.Code != http.StatusOK || again.Header().Get("ETag") != zipped.Header().Get("ETag") {
+			t.Errorf("%s = %d, ETag %q; want the master archive", abbrev, again.Code, again.Header().Get("ETag"))
+		}
+	}
+
+	var exports []models.GitExport
+	db.Order("id").Find(&exports)
+	if len(exports) != 4 || exports[0].Kind != "bundle" || exports[2].Ref != hashes[1] ||
+		exports[3].Ref != "master" || exports[3].StorageKey != exports[2].StorageKey {
+		t.Errorf("exports = %+v", exports)
+	}
+	for _, export := range exports {
+		if ok, _ := store.Exists(export.StorageKey); !ok {
+			t.Errorf("export %s not stored", export.StorageKey)
+		}
+	}
+
+	for _, path := range []string{"/archive/repo1/git/tarball/nope.zip", "/archive/repo1/git/tarball/", "/archive/nope/git/bundle"} {
+		if rec := readerGet(r, path); rec.Code != http.StatusNotFound {
+			t.Errorf("%s = %d, want not found", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+
+	"arker/internal/manifest"
+	"arker/internal/models"
+	"arker/internal/storage"
+	"arker/internal/timestamp"
+	"arker/internal/workers"
+)
+
+// ServeCaptureManifest serves /archive/:shortid/manifest.sig: the newest
+// signed manifest of a capture, a DSSE envelope that `arker verify` checks
+// downloads against.
+//
+// A capture settled before signing existed has no manifest yet. The first
+// request for it queues one and answers 202, as does a request for a
+// capture whose items are still running.
+func ServeCaptureManifest(c *gin.Context, store storage.Storage, db *gorm.DB, riverClient *river.Client[pgx.Tx]) {
+	shortID := c.Param("shortid")
+	if redirectIfAlias(c, db, shortID) {
+		return
+	}
+	var capture models.Capture
+	if err := db.Preload("ArchiveItems").Where("short_id = ?", shortID).First(&capture).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "archive not found"})
+		return
+	}
+
+	var record models.CaptureManifest
+	err := db.Where("capture_id = ?", capture.ID).Order("id DESC").First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		settled, stored := true, false
+		for _, item := range capture.ArchiveItems {
+			switch item.Status {
+			case "completed":
+				stored = true
+			case "failed":
+			default:
+				settled = false
+			}
+		}
+		if settled && !stored {
+			c.JSON(http.StatusNotFound, gin.H{"error": "capture stored nothing to sign"})
+			return
+		}
+		if settled {
+			_ = workers.EnqueueManifest(c.Request.Context(), riverClient, shortID)
+		}
+		c.Header("Retry-After", "30")
+		c.JSON(http.StatusAccepted, gin.H{"status": "pending"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "manifest lookup failed"})
+		return
+	}
+
+	r, err := store.Reader(record.StorageKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "stored manifest could not be read"})
+		return
+	}
+	defer r.Close()
+	c.Header("Content-Type", manifest.EnvelopeContentType)
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s-manifest.sig\"", shortID))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, r); err != nil {
+		log.Printf("Error streaming manifest %s: %v", record.StorageKey, err)
+	}
+}
+
+// ServeManifestTimestamp serves /archive/:shortid/manifest.tsr: the RFC 3161
+// reply timestamping the manifest /archive/:shortid/manifest.sig serves. It
+// is DER as the TSA sent it, for `openssl ts -verify -data manifest.sig`.
+func ServeManifestTimestamp(c *gin.Context, store storage.Storage, db *gorm.DB) {
+	shortID := c.Param("shortid")
+	if redirectIfAlias(c, db, shortID) {
+		return
+	}
+	var capture models.Capture
+	if err := db.Where("short_id = ?", shortID).First(&capture).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "archive not found"})
+		return
+	}
+	_, stamp, err := latestManifestTimestamp(db, capture.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "timestamp lookup failed"})
+		return
+	}
+	if stamp == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "manifest is not timestamped"})
+		return
+	}
+
+	r, err := store.Reader(stamp.StorageKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "stored timestamp could not be read"})
+		return
+	}
+	defer r.Close()
+	c.Header("Content-Type", timestamp.ReplyContentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-manifest.tsr\"", shortID))
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, r); err != nil {
+		log.Printf("Error streaming timestamp %s: %v", stamp.StorageKey, err)
+	}
+}
+
+// latestManifestTimestamp returns a capture's newest manifest and its
+// timestamp. Either is nil when there is none: a manifest re-signed after a
+// retry is untimestamped until its own stamp comes back, and an older
+// manifest's stamp does not vouch for it.
+func latestManifestTimestamp(db *gorm.DB, captureID uint) (*models.CaptureManifest, *models.CaptureTimestamp, error) {
+	var record models.CaptureManifest
+	if err := db.Where("capture_id = ?", captureID).Order("id DESC").First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	var stamp models.CaptureTimestamp
+	if err := db.Where("capture_manifest_id = ?", record.ID).First(&stamp).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &record, nil, nil
+		}
+		return nil, nil, err
+	}
+	return &record, &stamp, nil
+}
+
+// trustedTimestamp returns the timestamp shown on a capture's page, or nil.
+func trustedTimestamp(db *gorm.DB, captureID uint) *models.CaptureTimestamp {
+	_, stamp, err := latestManifestTimestamp(db, captureID)
+	if err != nil {
+		return nil
+	}
+	return stamp
+}
+
+// ServeManifestKey serves the public key capture manifests are signed with.
+func ServeManifestKey(c *gin.Context, signer *manifest.Signer) {
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, manifest.NewPublicKeyDocument(signer.PublicKey()))
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"arker/internal/manifest"
+	"arker/internal/models"
+	"arker/internal/storage"
+	"arker/internal/timestamp"
+)
+
+func TestServeCaptureManifest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newHandlerLogTestDB(t)
+	if err := db.AutoMigrate(&models.CaptureManifest{}); err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewMemoryStorage()
+	_, key, _ := ed25519.GenerateKey(nil)
+	signer := manifest.NewSigner(key)
+	r := gin.New()
+	r.GET("/archive/:shortid/manifest.sig", func(c *gin.Context) { ServeCaptureManifest(c, store, db, nil) })
+	r.GET("/.well-known/arker-manifest-key", func(c *gin.Context) { ServeManifestKey(c, signer) })
+
+	signed := createVideoCapture(t, db, "done1", "https://example.com/a", map[string]string{"mhtml": "completed"})
+	createVideoCapture(t, db, "busy1", "https://example.com/b", map[string]string{"mhtml": "completed", "screenshot": "processing"})
+	createVideoCapture(t, db, "fail1", "https://example.com/c", map[string]string{"mhtml": "failed"})
+
+	if rec := readerGet(r, "/archive/done1/manifest.sig"); rec.Code != http.StatusAccepted || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("unsigned capture = %d", rec.Code)
+	}
+	if rec := readerGet(r, "/archive/busy1/manifest.sig"); rec.Code != http.StatusAccepted {
+		t.Errorf("capture in progress = %d", rec.Code)
+	}
+	for _, path := range []string{"/archive/fail1/manifest.sig", "/archive/nope/manifest.sig"} {
+		if rec := readerGet(r, path); rec.Code != http.StatusNotFound {
+			t.Errorf("%s = %d, want not found", path, rec.Code)
+		}
+	}
+
+	envelope, _ := signer.Sign(&manifest.Manifest{Version: manifest.Version, ShortID: "done1"})
+	w, _ := store.Writer("done1/manifest-00.sig.json")
+	w.Write(envelope)
+	w.Close()
+	db.Create(&models.CaptureManifest{CaptureID: signed.ID, StorageKey: "done1/manifest-00.sig.json", KeyID: signer.KeyID()})
+
+	rec := readerGet(r, "/archive/done1/manifest.sig")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != manifest.EnvelopeContentType {
+		t.Fatalf("signed capture = %d %v", rec.Code, rec.Header())
+	}
+	keyDoc := readerGet(r, "/.well-known/arker-manifest-key")
+	pub, err := manifest.ParsePublicKey(keyDoc.Body.Bytes())
+	if err != nil {
+		t.Fatalf("published key: %v", err)
+	}
+	if m, err := manifest.Open(rec.Body.Bytes(), pub); err != nil || m.ShortID != "done1" {
+		t.Errorf("served manifest = %v, %v", m, err)
+	}
+	var doc manifest.PublicKeyDocument
+	json.Unmarshal(keyDoc.Body.Bytes(), &doc)
+	if doc.KeyID != signer.KeyID() || doc.Algorithm != "ed25519" {
+		t.Errorf("key document = %+v", doc)
+	}
+}
+
+func TestManifestTimestampServedAndExported(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newHandlerLogTestDB(t)
+	if err := db.AutoMigrate(&models.CaptureManifest{}, &models.CaptureTimestamp{}); err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewMemoryStorage()
+	r := resultRouter(db, store)
+	r.GET("/archive/:shortid/manifest.tsr", func(c *gin.Context) { ServeManifestTimestamp(c, store, db) })
+
+	capture := createVideoCapture(t, db, "done1", "https://example.com/a", map[string]string{"mhtml": "completed"})
+	if rec := readerGet(r, "/archive/done1/manifest.tsr"); rec.Code != http.StatusNotFound {
+		t.Errorf("unsigned capture = %d", rec.Code)
+	}
+	if _, body := getResult(t, r, "done1"); body["manifest"] != nil {
+		t.Errorf("manifest before signing = %#v", body["manifest"])
+	}
+
+	signed := models.CaptureManifest{CaptureID: capture.ID, StorageKey: "done1/manifest-00.sig.json", KeyID: "0011223344556677", FileCount: 1, TotalBytes: 4}
+	db.Create(&signed)
+	_, body := getResult(t, r, "done1")
+	got, ok := body["manifest"].(map[string]any)
+	if !ok || got["url"] != "https://archive.test/archive/done1/manifest.sig" || got["key_id"] != "0011223344556677" || got["timestamp"] != nil {
+		t.Errorf("unstamped manifest = %#v", body["manifest"])
+	}
+
+	reply := []byte("DER reply")
+	w, _ := store.Writer("done1/timestamp-00.tsr")
+	w.Write(reply)
+	w.Close()
+	stampedAt := time.Date(2026, 2, 3, 4, 5, 6, 0, time.UTC)
+	db.Create(&models.CaptureTimestamp{
+		CaptureManifestID: signed.ID, CaptureID: capture.ID, StorageKey: "done1/timestamp-00.tsr",
+		TSAURL: "https://tsa.example/", TSAName: "CN=Example TSA", Time: stampedAt, SerialNumber: "42",
+	})
+
+	rec := readerGet(r, "/archive/done1/manifest.tsr")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != timestamp.ReplyContentType || rec.Body.String() != string(reply) {
+		t.Fatalf("timestamp = %d %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+	_, body = getResult(t, r, "done1")
+	stamp, _ := body["manifest"].(map[string]any)["timestamp"].(map[string]any)
+	if stamp == nil || stamp["time"] != "2026-02-03T04:05:06Z" || stamp["tsa"] != "CN=Example TSA" || stamp["serial_number"] != "42" ||
+		stamp["url"] != "https://archive.test/archive/done1/manifest.tsr" || stamp["token"] != base64.StdEncoding.EncodeToString(reply) {
+		t.Errorf("exported timestamp = %#v", stamp)
+	}
+	if got := trustedTimestamp(db, capture.ID); got == nil || !got.Time.Equal(stampedAt) {
+		t.Errorf("display timestamp = %+v", got)
+	}
+
+	// A manifest signed again after a retry is not vouched for by the old
+	// stamp.
+	db.Create(&models.CaptureManifest{CaptureID: capture.ID, StorageKey: "done1/manifest-01.sig.json"})
+	if rec := readerGet(r, "/archive/done1/manifest.tsr"); rec.Code != http.StatusNotFound {
+		t.Errorf("re-signed manifest = %d", rec.Code)
+	}
+	if trustedTimestamp(db, capture.ID) != nil {
+		t.Error("display shows the old manifest's timestamp")
+	}
+}
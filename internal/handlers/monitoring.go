@@ -7,6 +7,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
+	"arker/internal/gitcache"
+	"arker/internal/health"
 	"arker/internal/monitoring"
 )
 
@@ -112,3 +114,25 @@ func DBStorageStatusHandler(db *gorm.DB) gin.HandlerFunc {
 		})
 	}
 }
+
+// GitCacheStatusHandler reports how many repositories are unpacked for
+// serving, their size against the budget, and hit, miss and eviction counts.
+func GitCacheStatusHandler(cache *gitcache.Cache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, cache.Stats())
+	}
+}
+
+// HealthDetailHandler serves the health monitor's latest per-dependency
+// report. Any check down makes it a 503, like BrowserStatusHandler on a leak;
+// degraded checks still answer 200.
+func HealthDetailHandler(monitor *health.Monitor) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := monitor.Report()
+		if report.Status == health.StatusDown {
+			c.JSON(http.StatusServiceUnavailable, report)
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
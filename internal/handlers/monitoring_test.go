@@ -1,14 +1,22 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+
+	"arker/internal/health"
+	"arker/internal/models"
+	"arker/internal/utils"
 )
 
 func TestHealthCheckReportsHealthyDatabase(t *testing.T) {
@@ -34,3 +42,70 @@ func TestHealthCheckReportsHealthyDatabase(t *testing.T) {
 		t.Fatalf("payload = %v, want only the status field", body)
 	}
 }
+
+func TestHealthDetailReportsEachCheck(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	status := health.StatusDegraded
+	monitor := health.NewMonitor(time.Minute,
+		health.Check{Name: "yt-dlp", ArchiveTypes: []string{"yt-dlp"}, Run: func(context.Context) health.Result {
+			return health.Result{Status: status, Version: "2024.01.01", Message: "stale"}
+		}},
+		health.Check{Name: "storage", Run: func(context.Context) health.Result { return health.Result{} }},
+	)
+	monitor.RunOnce(t.Context())
+
+	router := gin.New()
+	router.GET("/health/detail", HealthDetailHandler(monitor))
+	get := func() (int, health.Report) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health/detail", nil))
+		var report health.Report
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatalf("decode report: %v", err)
+		}
+		return w.Code, report
+	}
+
+	code, report := get()
+	if code != http.StatusOK || report.Status != health.StatusDegraded || len(report.Checks) != 2 {
+		t.Fatalf("degraded = %d %+v, want 200 with both checks", code, report)
+	}
+	if report.Checks[0].Version != "2024.01.01" || report.Checks[1].Status != health.StatusOK {
+		t.Errorf("checks = %+v", report.Checks)
+	}
+
+	status = health.StatusDown
+	monitor.RunOnce(t.Context())
+	code, report = get()
+	if code != http.StatusServiceUnavailable || report.UnavailableTypes["yt-dlp"] != "yt-dlp: stale" {
+		t.Errorf("down = %d %+v, want 503 naming yt-dlp", code, report)
+	}
+}
+
+func TestCaptureRequestForADownTypeIs503(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newHandlerLogTestDB(t)
+	u := models.ArchivedURL{Original: "https://example.com/page"}
+	if err := db.Create(&u).Error; err != nil {
+		t.Fatal(err)
+	}
+	utils.SetArchiveTypeHealth(func(string) (string, bool) { return "storage: open for write: read-only file system", true })
+	t.Cleanup(func() { utils.SetArchiveTypeHealth(nil) })
+
+	router := gin.New()
+	router.POST("/admin/url/:id/capture", func(c *gin.Context) { RequestCapture(c, db, nil) })
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/admin/url/%d/capture", u.ID), nil))
+
+	var body struct {
+		Error            string            `json:"error"`
+		UnavailableTypes map[string]string `json:"unavailable_types"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusServiceUnavailable || body.UnavailableTypes["mhtml"] == "" {
+		t.Fatalf("status = %d body = %s, want 503 naming the refused types", w.Code, w.Body.String())
+	}
+	if !strings.HasPrefix(body.Error, "archive types temporarily unavailable: mhtml (storage: ") {
+		t.Errorf("error = %q", body.Error)
+	}
+}
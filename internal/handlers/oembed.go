@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"arker/internal/models"
+	"arker/internal/storage"
+)
+
+// Default dimensions of the embedded player. 16:9 like the thumbnails,
+// which is what most of the embedded media is.
+const (
+	oembedDefaultWidth  = 640
+	oembedDefaultHeight = 360
+)
+
+// oembedResponse is an oEmbed 1.0 response. Only the fields a given type uses
+// are emitted: "link" has no html, width or height.
+type oembedResponse struct {
+	Version         string `json:"version"`
+	Type            string `json:"type"`
+	Title           string `json:"title,omitempty"`
+	AuthorName      string `json:"author_name,omitempty"`
+	ProviderName    string `json:"provider_name"`
+	ProviderURL     string `json:"provider_url"`
+	CacheAge        int    `json:"cache_age,omitempty"`
+	ThumbnailURL    string `json:"thumbnail_url,omitempty"`
+	ThumbnailWidth  int    `json:"thumbnail_width,omitempty"`
+	ThumbnailHeight int    `json:"thumbnail_height,omitempty"`
+	HTML            string `json:"html,omitempty"`
+	Width           int    `json:"width,omitempty"`
+	Height          int    `json:"height,omitempty"`
+}
+
+// ServeOEmbed answers oEmbed discovery for archive pages.
+//
+// The url parameter is any link into a capture (/:shortid or /:shortid/:type);
+// only its path is read, so the same archive previews identically whichever
+// hostname the consumer saw it under. Aliases resolve to their canonical
+// capture without a redirect, because oEmbed consumers do not follow them.
+func ServeOEmbed(c *gin.Context, store storage.Storage, db *gorm.DB) {
+	if format := c.Query("format"); format != "" && format != "json" {
+		// The spec's answer for an unsupported format.
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "only format=json is supported"})
+		return
+	}
+	target, err := url.Parse(c.Query("url"))
+	if err != nil || c.Query("url") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url parameter is required"})
+		return
+	}
+	shortID := strings.SplitN(strings.Trim(target.Path, "/"), "/", 2)[0]
+	if shortID == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "archive not found"})
+		return
+	}
+
+	var capture models.Capture
+	if err := db.Where("short_id = ?", shortID).First(&capture).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "archive not found"})
+		return
+	}
+	if capture.AliasOfID != nil {
+		canonicalID := *capture.AliasOfID
+		capture = models.Capture{}
+		if err := db.First(&capture, canonicalID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "archive not found"})
+			return
+		}
+	}
+	if err := db.Model(&capture).Association("ArchiveItems").Find(&capture.ArchiveItems); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var archivedURL models.ArchivedURL
+	db.First(&archivedURL, capture.ArchivedURLID)
+
+	card := buildSocialCard(c, store, &capture, archivedURL.Original)
+	response := oembedResponse{
+		Version:         "1.0",
+		Type:            "link",
+		Title:           card.Title,
+		AuthorName:      card.Author,
+		ProviderName:    "Arker",
+		ProviderURL:     fullPath(c, ""),
+		CacheAge:        3600,
+		ThumbnailURL:    card.Image,
+		ThumbnailWidth:  card.ImageWidth,
+		ThumbnailHeight: card.ImageHeight,
+	}
+	if card.EmbedURL != "" {
+		width, height := oembedDimensions(c.Query("maxwidth"), c.Query("maxheight"))
+		response.Type = "rich"
+		if card.Kind == "video" {
+			response.Type = "video"
+		}
+		response.Width, response.Height = width, height
+		response.HTML = fmt.Sprintf(`<iframe src="%s" width="%d" height="%d" frameborder="0" allowfullscreen loading="lazy" title="%s"></iframe>`,
+			html.EscapeString(card.EmbedURL), width, height, html.EscapeString(card.Title))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// oembedDimensions fits the default player inside the consumer's maxwidth and
+// maxheight while keeping its aspect ratio. The spec forbids exceeding
+// either limit, however small. Unparseable limits are ignored.
+func oembedDimensions(maxWidth, maxHeight string) (int, int) {
+	width, height := oembedDefaultWidth, oembedDefaultHeight
+	if w, err := strconv.Atoi(maxWidth); err == nil && w > 0 && w < width {
+		width = w
+		height = max(width*oembedDefaultHeight/oembedDefaultWidth, 1)
+	}
+	if h, err := strconv.Atoi(maxHeight); err == nil && h > 0 && h < height {
+		height = h
+		width = height * oembedDefaultWidth / oembedDefaultHeight
+	}
+	return width, height
+}
+
+// ServeEmbed renders the bare player that oEmbed iframes point at: just the
+// video, or the gallery slides, with a link back to the full archive page.
+// Captures with nothing playable 404 rather than embedding an empty frame.
+func ServeEmbed(c *gin.Context, store storage.Storage, db *gorm.DB) {
+	shortID := c.Param("shortid")
+	if redirectIfAlias(c, db, shortID) {
+		return
+	}
+	var capture models.Capture
+	if err := db.Where("short_id = ?", shortID).Preload("ArchiveItems").First(&capture).Error; err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	item := embeddableItem(capture.ArchiveItems)
+	if item == nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	var archivedURL models.ArchivedURL
+	db.First(&archivedURL, capture.ArchivedURLID)
+	card := buildSocialCard(c, store, &capture, archivedURL.Original)
+
+	// This page exists to be framed by other sites, unlike the rest of the UI.
+	c.Header("Content-Security-Policy", "frame-ancestors *")
+	c.HTML(http.StatusOK, "embed.html", gin.H{
+		"short_id":      shortID,
+		"kind":          card.Kind,
+		"title":         card.Title,
+		"original_host": card.OriginalHost,
+		"archive_url":   card.URL,
+		"poster_url":    card.Image,
+		"hls_url":       videoHLSURL(db, item, shortID),
+	})
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"arker/internal/models"
+	"arker/internal/storage"
+)
+
+func oembedRouter(db *gorm.DB, store storage.Storage) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.LoadHTMLFiles(
+		filepath.Join("..", "..", "templates", "display_type.html"),
+		filepath.Join("..", "..", "templates", "embed.html"),
+	)
+	r.GET("/oembed", func(c *gin.Context) { ServeOEmbed(c, store, db) })
+	r.GET("/embed/:shortid", func(c *gin.Context) { ServeEmbed(c, store, db) })
+	r.GET("/:shortid", func(c *gin.Context) { DisplayDefault(c, store, db) })
+	return r
+}
+
+func getOEmbed(t *testing.T, r http.Handler, query string) (int, map[string]any) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/oembed?"+query, nil)
+	req.Host = "archive.example.com"
+	r.ServeHTTP(rec, req)
+	var body map[string]any
+	_ = json.Unmarshal(rec.Body.Bytes(), &body)
+	return rec.Code, body
+}
+
+// The player never exceeds the consumer's limits, even below what would be
+// a comfortable size (regression: maxwidth under 200 was raised to 200).
+func TestOEmbedDimensionsNeverExceedLimits(t *testing.T) {
+	for _, tc := range []struct {
+		maxWidth, maxHeight string
+		width, height       int
+	}{
+		{"", "", 640, 360},
+		{"320", "", 320, 180},
+		{"120", "", 120, 67},
+		{"", "90", 160, 90},
+		{"1000", "junk", 640, 360},
+	} {
+		width, height := oembedDimensions(tc.maxWidth, tc.maxHeight)
+		if width != tc.width || height != tc.height {
+			t.Errorf("oembedDimensions(%q, %q) = %dx%d, want %dx%d", tc.maxWidth, tc.maxHeight, width, height, tc.width, tc.height)
+		}
+	}
+}
+
+func TestOEmbedForVideoUsesNormalizedPost(t *testing.T) {
+	db := newHandlerLogTestDB(t)
+	store := storage.NewMemoryStorage()
+	seedCaptionedVideo(t, db, store, "oem01", false)
+
+	target := url.QueryEscape("https://archive.example.com/oem01/yt-dlp")
+	code, body := getOEmbed(t, oembedRouter(db, store), "url="+target+"&maxwidth=320")
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, body %#v", code, body)
+	}
+	if body["version"] != "1.0" || body["type"] != "video" {
+		t.Fatalf("oembed = %#v", body)
+	}
+	if body["title"] != "Me at the zoo" {
+		t.Errorf("title = %v, want the post title", body["title"])
+	}
+	if body["width"] != float64(320) || body["height"] != float64(180) {
+		t.Errorf("size = %vx%v, want the player scaled to maxwidth", body["width"], body["height"])
+	}
+	html, _ := body["html"].(string)
+	if !strings.Contains(html, `src="http://archive.example.com/embed/oem01"`) {
+		t.Errorf("html = %q, want an iframe of the embed player", html)
+	}
+	if body["thumbnail_url"] != "http://archive.example.com/thumb/oem01" {
+		t.Errorf("thumbnail_url = %v", body["thumbnail_url"])
+	}
+}
+
+// A capture with nothing playable still gets a preview, just not a player.
+func TestOEmbedForWebCaptureIsALink(t *testing.T) {
+	db := newHandlerLogTestDB(t)
+	store := storage.NewMemoryStorage()
+	createVideoCapture(t, db, "oem02", "https://example.org/post", map[string]string{"mhtml": "completed"})
+
+	code, body := getOEmbed(t, oembedRouter(db, store), "url="+url.QueryEscape("https://archive.example.com/oem02"))
+	if code != http.StatusOK || body["type"] != "link" {
+		t.Fatalf("status = %d, oembed = %#v", code, body)
+	}
+	if _, present := body["html"]; present {
+		t.Errorf("link response carried html: %#v", body)
+	}
+	if body["title"] != "Archive of example.org" {
+		t.Errorf("title = %v", body["title"])
+	}
+}
+
+func TestOEmbedResolvesAliasesWithoutRedirect(t *testing.T) {
+	db := newHandlerLogTestDB(t)
+	store := storage.NewMemoryStorage()
+	seedCaptionedVideo(t, db, store, "oem03", false)
+	var canonical models.Capture
+	db.Where("short_id = ?", "oem03").First(&canonical)
+	alias := models.Capture{ArchivedURLID: canonical.ArchivedURLID, ShortID: "oem04", AliasOfID: &canonical.ID, Timestamp: canonical.Timestamp}
+	if err := db.Create(&alias).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	code, body := getOEmbed(t, oembedRouter(db, store), "url="+url.QueryEscape("https://archive.example.com/oem04"))
+	if code != http.StatusOK || body["type"] != "video" {
+		t.Fatalf("status = %d, oembed = %#v", code, body)
+	}
+	if !strings.Contains(body["html"].(string), "/embed/oem03") {
+		t.Errorf("html = %q, want the canonical capture's player", body["html"])
+	}
+}
+
+func TestOEmbedRejectsUnknownArchivesAndFormats(t *testing.T) {
+	db := newHandlerLogTestDB(t)
+	r := oembedRouter(db, storage.NewMemoryStorage())
+
+	if code, _ := getOEmbed(t, r, "url="+url.QueryEscape("https://archive.example.com/nope1")); code != http.StatusNotFound {
+		t.Errorf("unknown capture = %d, want 404", code)
+	}
+	if code, _ := getOEmbed(t, r, "url=x&format=xml"); code != http.StatusNotImplemented {
+		t.Errorf("format=xml = %d, want 501", code)
+	}
+	if code, _ := getOEmbed(t, r, ""); code != http.StatusBadRequest {
+		t.Errorf("missing url = %d, want 400", code)
+	}
+}
+
+func TestDisplayPageCarriesSocialCardTags(t *testing.T) {
+	db := newHandlerLogTestDB(t)
+	store := storage.NewMemoryStorage()
+	seedCaptionedVideo(t, db, store, "oem05", false)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/oem05", nil)
+	req.Host = "archive.example.com"
+	oembedRouter(db, store).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	page := rec.Body.String()
+	for _, want := range []string{
+		`<meta property="og:title" content="Me at the zoo">`,
+		`<meta property="og:image" content="http://archive.example.com/thumb/oem05">`,
+		`<meta property="og:video" content="http://archive.example.com/archive/oem05/yt-dlp">`,
+		`<meta name="twitter:card" content="player">`,
+		`<meta name="arker:original-host" content="youtube.com">`,
+		`type="application/json+oembed"`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("display page is missing %s", want)
+		}
+	}
+}
+
+func TestEmbedPlayer(t *testing.T) {
+	db := newHandlerLogTestDB(t)
+	store := storage.NewMemoryStorage()
+	seedCaptionedVideo(t, db, store, "oem06", false)
+	createVideoCapture(t, db, "oem07", "https://example.org/", map[string]string{"mhtml": "completed"})
+	r := oembedRouter(db, store)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/embed/oem06", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `<video src="/archive/oem06/yt-dlp"`) {
+		t.Fatalf("embed = %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Security-Policy"); got != "frame-ancestors *" {
+		t.Errorf("embed CSP = %q, want framing allowed", got)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/embed/oem07", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("embed of a web-only capture = %d, want 404", rec.Code)
+	}
+}
+
+func TestClipCardTextCutsAtAWord(t *testing.T) {
+	if got := clipCardText("short\n caption", 50); got != "short caption" {
+		t.Errorf("short text = %q", got)
+	}
+	if got := clipCardText("the quick brown fox jumps over the lazy dog", 20); got != "the quick brown fox…" {
+		t.Errorf("clipped = %q", got)
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"arker/internal/models"
+	"arker/internal/storage"
+	"arker/internal/thumbnail"
+	"arker/internal/utils"
+)
+
+// socialCardDescriptionLimit keeps og:description inside what link-preview
+// crawlers actually display. Most cut at around 200 characters; longer text
+// only costs page weight.
+const socialCardDescriptionLimit = 200
+
+// socialCard is what a link preview of a capture shows: the Open Graph and
+// Twitter card tags on the display page, and the oEmbed response.
+//
+// Title and author come from the normalized post record when the capture is a
+// social post, so a shared archive link previews as the post it preserves
+// rather than as "Archive of youtube.com". Everything else falls back to the
+// original host, which is always known.
+type socialCard struct {
+	Title        string
+	Description  string
+	Author       string
+	OriginalHost string
+	URL          string
+	Image        string
+	ImageWidth   int
+	ImageHeight  int
+	// Kind is "video" or "gallery" when the capture has a completed item the
+	// embed player can show, and empty otherwise.
+	Kind      string
+	EmbedURL  string
+	OEmbedURL string
+	// VideoURL is the stored media itself, advertised as og:video so players
+	// that support inline video do not need the embed page at all.
+	VideoURL string
+}
+
+// buildSocialCard describes a capture for link previews. It never fails: a
+// missing or unreadable metadata sidecar just leaves the generic card.
+func buildSocialCard(c *gin.Context, store storage.Storage, capture *models.Capture, originalURL string) socialCard {
+	host := hostLabel(originalURL)
+	card := socialCard{
+		Title:        "Archive of " + originalURL,
+		OriginalHost: host,
+		URL:          fullPath(c, capture.ShortID),
+		Image:        ThumbnailURL(c, capture.ShortID),
+		ImageWidth:   thumbnail.Width,
+		ImageHeight:  thumbnail.Height,
+	}
+	if host != "" {
+		card.Title = "Archive of " + host
+	}
+	card.Description = fmt.Sprintf("Archived %s from %s", capture.Timestamp.UTC().Format("January 2, 2006"), originalURL)
+
+	if item := embeddableItem(capture.ArchiveItems); item != nil {
+		card.Kind = embedKind(item)
+		card.EmbedURL = fullPath(c, "embed/"+capture.ShortID)
+		if card.Kind == "video" {
+			card.VideoURL = fullPath(c, fmt.Sprintf("archive/%s/%s", capture.ShortID, utils.ArchiveTypeYtDlp))
+		}
+	}
+	card.OEmbedURL = fullPath(c, "oembed") + "?format=json&url=" + url.QueryEscape(card.URL)
+
+	if !utils.IsSocialMediaPostURL(originalURL) {
+		return card
+	}
+	social := selectSocialItem(capture.ArchiveItems, originalURL)
+	if social == nil || social.Status != "completed" {
+		return card
+	}
+	scratch := &socialPostResult{}
+	if utils.ArchiveTypesEqual(social.Type, utils.ArchiveTypeYtDlp) {
+		buildVideoSocial(c, store, capture.ShortID, social, scratch)
+	} else {
+		buildGallerySocial(c, store, capture.ShortID, social, scratch)
+	}
+	post := scratch.Post
+	if post == nil {
+		return card
+	}
+	if post.Author != nil {
+		switch {
+		case post.Author.DisplayName != "":
+			card.Author = post.Author.DisplayName
+		case post.Author.Username != "":
+			card.Author = "@" + strings.TrimPrefix(post.Author.Username, "@")
+		}
+	}
+	// Photo posts rarely have a title, so the caption stands in for one.
+	title := post.Title
+	if title == "" {
+		title = clipCardText(post.Text, 90)
+	}
+	if title != "" {
+		card.Title = title
+		if card.Author != "" {
+			card.Title = card.Author + ": " + title
+		}
+	} else if card.Author != "" {
+		card.Title = fmt.Sprintf("%s on %s", card.Author, host)
+	}
+	if text := clipCardText(post.Text, socialCardDescriptionLimit); text != "" && text != title {
+		card.Description = text + " — " + card.Description
+	}
+	return card
+}
+
+// embeddableItem returns the item the embed player shows. Video wins over a
+// gallery, matching which tab the viewer opens first for a URL routed to both.
+func embeddableItem(items []models.ArchiveItem) *models.ArchiveItem {
+	var gallery *models.ArchiveItem
+	for i := range items {
+		item := &items[i]
+		if item.Status != "completed" || item.StorageKey == "" {
+			continue
+		}
+		switch {
+		case utils.ArchiveTypesEqual(item.Type, utils.ArchiveTypeYtDlp):
+			return item
+		case utils.ArchiveTypesEqual(item.Type, utils.ArchiveTypeGalleryDl) && gallery == nil:
+			gallery = item
+		}
+	}
+	return gallery
+}
+
+func embedKind(item *models.ArchiveItem) string {
+	if utils.ArchiveTypesEqual(item.Type, utils.ArchiveTypeYtDlp) {
+		return "video"
+	}
+	return "gallery"
+}
+
+// clipCardText flattens text to one line and cuts it at a word boundary.
+func clipCardText(text string, limit int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	cut := string(runes[:limit])
+	if i := strings.LastIndex(cut, " "); i > limit/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"arker/internal/archivers"
+	"arker/internal/models"
+	"arker/internal/storage"
+	"arker/internal/utils"
+)
+
+// maxPlaylistListingSize caps the stored listing read back for the manifest.
+// A capped playlist of a few hundred entries is tens of kilobytes.
+const maxPlaylistListingSize = 8 * 1024 * 1024
+
+// playlistManifestResponse is the public playlist contract: the playlist
+// capture's own status, then every video with the status of the capture that
+// holds it. It reads the way the gallery manifest does: a consumer polls it
+// until capture_status settles, then until no entry is pending.
+type playlistManifestResponse struct {
+	SchemaVersion string `json:"schema_version"`
+	ShortID       string `json:"short_id"`
+	URL           string `json:"url"`
+	CaptureStatus string `json:"capture_status"`
+	Title         string `json:"title,omitempty"`
+	Uploader      string `json:"uploader,omitempty"`
+	// Truncated is true when the playlist had more videos than were queued.
+	Truncated  bool                    `json:"truncated"`
+	EntryCount int                     `json:"entry_count"`
+	Counts     map[string]int          `json:"status_counts"`
+	Entries    []playlistManifestEntry `json:"entries"`
+	ArchiveURL *string                 `json:"archive_url"`
+}
+
+// playlistManifestEntry is one video. ShortID is the child capture made for
+// this playlist; when the video had already been archived it is an alias, and
+// CanonicalShortID names the capture that actually holds the video. Status is
+// that capture's video status.
+type playlistManifestEntry struct {
+	Position         int     `json:"position"`
+	URL              string  `json:"url"`
+	VideoID          string  `json:"video_id,omitempty"`
+	Title            string  `json:"title,omitempty"`
+	DurationSeconds  float64 `json:"duration_seconds,omitempty"`
+	ShortID          string  `json:"short_id"`
+	CanonicalShortID string  `json:"canonical_short_id"`
+	Aliased          bool    `json:"aliased"`
+	Status           string  `json:"status"`
+	ArchiveURL       string  `json:"archive_url"`
+	ManifestURL      string  `json:"manifest_url"`
+}
+
+// ServePlaylistManifest lists a playlist capture's videos in playlist order,
+// each with its own capture and status. Like the other manifests it is keyless
+// and returns 200 while the playlist is still being listed, with no entries.
+func ServePlaylistManifest(c *gin.Context, store storage.Storage, db *gorm.DB) {
+	shortID := c.Param("shortid")
+	if redirectIfAlias(c, db, shortID) {
+		return
+	}
+
+	var capture models.Capture
+	if err := db.Where("short_id = ?", shortID).Preload("ArchivedURL").Preload("ArchiveItems").First(&capture).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	var item *models.ArchiveItem
+	for i := range capture.ArchiveItems {
+		if utils.ArchiveTypesEqual(capture.ArchiveItems[i].Type, utils.ArchiveTypePlaylist) {
+			item = &capture.ArchiveItems[i]
+			break
+		}
+	}
+	if item == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not a playlist capture"})
+		return
+	}
+
+	response := playlistManifestResponse{
+		SchemaVersion: archivers.PlaylistListingSchemaVersion,
+		ShortID:       shortID,
+		URL:           capture.ArchivedURL.Original,
+		CaptureStatus: item.Status,
+		Counts:        map[string]int{},
+		// Never null: consumers iterate this unconditionally.
+		Entries: []playlistManifestEntry{},
+	}
+	if item.Status == "completed" && item.StorageKey != "" {
+		if listing, err := readPlaylistListing(store, item.StorageKey); err == nil {
+			response.Title = listing.Title
+			response.Uploader = listing.Uploader
+			response.Truncated = listing.Truncated
+		}
+		archiveURL := fullPath(c, fmt.Sprintf("archive/%s/%s", shortID, utils.ArchiveTypePlaylist))
+		response.ArchiveURL = &archiveURL
+	}
+
+	entries, err := loadPlaylistEntries(db, capture.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load playlist entries"})
+		return
+	}
+	for _, entry := range entries {
+		entry.ArchiveURL = fullPath(c, entry.CanonicalShortID)
+		entry.ManifestURL = fullPath(c, fmt.Sprintf("video/%s/manifest", entry.CanonicalShortID))
+		response.Entries = append(response.Entries, entry)
+		response.Counts[entry.Status]++
+	}
+	response.EntryCount = len(response.Entries)
+	c.JSON(http.StatusOK, response)
+}
+
+// loadPlaylistEntries returns a playlist's entries in order, each resolved to
+// the capture holding its video and that capture's video status.
+func loadPlaylistEntries(db *gorm.DB, playlistCaptureID uint) ([]playlistManifestEntry, error) {
+	var rows []models.PlaylistEntry
+	if err := db.Where("playlist_capture_id = ?", playlistCaptureID).
+		Preload("ChildCapture").Order("position, id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	// Resolve aliases in one query: an alias owns no items, its canonical
+	// capture does.
+	holderIDs := make([]uint, 0, len(rows))
+	for _, row := range rows {
+		holderIDs = append(holderIDs, playlistHolderID(row.ChildCapture))
+	}
+	var holders []models.Capture
+	if len(holderIDs) > 0 {
+		if err := db.Where("id IN ?", holderIDs).Preload("ArchiveItems").Find(&holders).Error; err != nil {
+			return nil, err
+		}
+	}
+	byID := make(map[uint]models.Capture, len(holders))
+	for _, holder := range holders {
+		byID[holder.ID] = holder
+	}
+
+	entries := make([]playlistManifestEntry, 0, len(rows))
+	for _, row := range rows {
+		holder := byID[playlistHolderID(row.ChildCapture)]
+		entries = append(entries, playlistManifestEntry{
+			Position:         row.Position,
+			URL:              row.URL,
+			VideoID:          row.VideoID,
+			Title:            row.Title,
+			DurationSeconds:  row.DurationSeconds,
+			ShortID:          row.ChildCapture.ShortID,
+			CanonicalShortID: holder.ShortID,
+			Aliased:          row.ChildCapture.AliasOfID != nil,
+			Status:           playlistVideoStatus(holder),
+		})
+	}
+	return entries, nil
+}
+
+func playlistHolderID(child models.Capture) uint {
+	if child.AliasOfID != nil {
+		return *child.AliasOfID
+	}
+	return child.ID
+}
+
+// playlistVideoStatus is the status of a capture's video item, or "missing"
+// when the capture has none (it was found, not made, and lost its row).
+func playlistVideoStatus(capture models.Capture) string {
+	for _, item := range capture.ArchiveItems {
+		if utils.ArchiveTypesEqual(item.Type, utils.ArchiveTypeYtDlp) {
+			return item.Status
+		}
+	}
+	return "missing"
+}
+
+func readPlaylistListing(store storage.Storage, key string) (archivers.PlaylistListing, error) {
+	var listing archivers.PlaylistListing
+	r, err := store.Reader(key)
+	if err != nil {
+		return listing, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, maxPlaylistListingSize))
+	if err != nil {
+		return listing, err
+	}
+	err = json.Unmarshal(data, &listing)
+	return listing, err
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"arker/internal/models"
+	"arker/internal/storage"
+	"arker/internal/utils"
+)
+
+// playlistManifestBody mirrors the public playlist manifest contract, decoded
+// into its own struct for the same reason galleryManifestBody is.
+type playlistManifestBody struct {
+	SchemaVersion string         `json:"schema_version"`
+	ShortID       string         `json:"short_id"`
+	CaptureStatus string         `json:"capture_status"`
+	Title         string         `json:"title"`
+	Truncated     bool           `json:"truncated"`
+	EntryCount    int            `json:"entry_count"`
+	Counts        map[string]int `json:"status_counts"`
+	Entries       []struct {
+		Position         int    `json:"position"`
+		URL              string `json:"url"`
+		ShortID          string `json:"short_id"`
+		CanonicalShortID string `json:"canonical_short_id"`
+		Aliased          bool   `json:"aliased"`
+		Status           string `json:"status"`
+		ArchiveURL       string `json:"archive_url"`
+		ManifestURL      string `json:"manifest_url"`
+	} `json:"entries"`
+	ArchiveURL *string `json:"archive_url"`
+}
+
+func getPlaylistManifest(t *testing.T, router *gin.Engine, shortID string) (*httptest.ResponseRecorder, playlistManifestBody) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/playlist/"+shortID+"/manifest", nil)
+	req.Host = "archive.test"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var body playlistManifestBody
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode manifest: %v (body %s)", err, rec.Body.String())
+		}
+	}
+	return rec, body
+}
+
+func TestServePlaylistManifestResolvesAliasedVideos(t *testing.T) {
+	db := newHandlerLogTestDB(t)
+	if err := db.AutoMigrate(&models.PlaylistEntry{}); err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewMemoryStorage()
+	writer, _ := store.Writer("archive/pl001/playlist.json")
+	writer.Write([]byte(`{"schema_version":"1","title":"Talks","truncated":true,"entries":[]}`))
+	writer.Close()
+
+	playlist := createVideoCapture(t, db, "pl001", "https://www.youtube.com/playlist?list=PL1", nil)
+	if err := db.Create(&models.ArchiveItem{CaptureID: playlist.ID, Type: utils.ArchiveTypePlaylist, Status: "completed", StorageKey: "archive/pl001/playlist.json"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	fresh := createVideoCapture(t, db, "vid01", "https://www.youtube.com/watch?v=aaa", map[string]string{utils.ArchiveTypeYtDlp: "processing"})
+	earlier := createVideoCapture(t, db, "old01", "https://www.youtube.com/watch?v=bbb", map[string]string{utils.ArchiveTypeYtDlp: "completed"})
+	alias := models.Capture{ArchivedURLID: earlier.ArchivedURLID, ShortID: "als01", AliasOfID: &earlier.ID}
+	if err := db.Create(&alias).Error; err != nil {
+		t.Fatal(err)
+	}
+	// Stored out of order: the manifest is ordered by position.
+	for _, entry := range []models.PlaylistEntry{
+		{PlaylistCaptureID: playlist.ID, Position: 2, URL: "https://www.youtube.com/watch?v=bbb", ChildCaptureID: alias.ID},
+		{PlaylistCaptureID: playlist.ID, Position: 1, URL: "https://www.youtube.com/watch?v=aaa", ChildCaptureID: fresh.ID},
+	} {
+		if err := db.Create(&entry).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/playlist/:shortid/manifest", func(c *gin.Context) { ServePlaylistManifest(c, store, db) })
+
+	rec, manifest := getPlaylistManifest(t, router, "pl001")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if manifest.CaptureStatus != "completed" || manifest.Title != "Talks" || !manifest.Truncated || manifest.EntryCount != 2 {
+		t.Errorf("envelope = %+v", manifest)
+	}
+	if manifest.ArchiveURL == nil || *manifest.ArchiveURL != "https://archive.test/archive/pl001/playlist" {
+		t.Errorf("archive_url = %v", manifest.ArchiveURL)
+	}
+	if manifest.Counts["processing"] != 1 || manifest.Counts["completed"] != 1 {
+		t.Errorf("status_counts = %v", manifest.Counts)
+	}
+
+	first, second := manifest.Entries[0], manifest.Entries[1]
+	if first.Position != 1 || first.ShortID != "vid01" || first.CanonicalShortID != "vid01" || first.Aliased || first.Status != "processing" {
+		t.Errorf("entries[0] = %+v", first)
+	}
+	if second.Position != 2 || second.ShortID != "als01" || second.CanonicalShortID != "old01" || !second.Aliased || second.Status != "completed" {
+		t.Errorf("entries[1] = %+v, want the alias resolved to the earlier capture", second)
+	}
+	if second.ArchiveURL != "https://archive.test/old01" || second.ManifestURL != "https://archive.test/video/old01/manifest" {
+		t.Errorf("entries[1] URLs = %s, %s", second.ArchiveURL, second.ManifestURL)
+	}
+}
+
+func TestServePlaylistManifestWhileListing(t *testing.T) {
+	db := newHandlerLogTestDB(t)
+	if err := db.AutoMigrate(&models.PlaylistEntry{}); err != nil {
+		t.Fatal(err)
+	}
+	playlist := createVideoCapture(t, db, "pl002", "https://www.youtube.com/@someone", nil)
+	db.Create(&models.ArchiveItem{CaptureID: playlist.ID, Type: utils.ArchiveTypePlaylist, Status: "pending"})
+	createVideoCapture(t, db, "web01", "https://example.com/", map[string]string{utils.ArchiveTypeMHTML: "completed"})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/playlist/:shortid/manifest", func(c *gin.Context) { ServePlaylistManifest(c, storage.NewMemoryStorage(), db) })
+
+	rec, manifest := getPlaylistManifest(t, router, "pl002")
+	if rec.Code != http.StatusOK || manifest.CaptureStatus != "pending" || manifest.ArchiveURL != nil || manifest.Entries == nil || len(manifest.Entries) != 0 {
+		t.Errorf("pending manifest = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec, _ := getPlaylistManifest(t, router, "web01"); rec.Code != http.StatusNotFound {
+		t.Errorf("non-playlist capture status = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+
+	"arker/internal/models"
+	"arker/internal/reader"
+	"arker/internal/storage"
+	"arker/internal/utils"
+	"arker/internal/workers"
+)
+
+// maxReaderArticleSize bounds the reader sidecar read for one request. An
+// article is text; anything near this is not one.
+const maxReaderArticleSize = 16 * 1024 * 1024
+
+// Reader endpoint formats.
+const (
+	readerFormatHTML     = "html"
+	readerFormatMarkdown = "markdown"
+	readerFormatJSON     = "json"
+)
+
+// readerURLType is the viewer tab showing the mhtml item's extracted article.
+// It is not an archive type: it has no item of its own.
+const readerURLType = "reader"
+
+// readerArticle loads the extracted article of a completed mhtml item. A nil
+// article with a nil error means none has been extracted yet.
+func readerArticle(store storage.Storage, item *models.ArchiveItem) (*reader.Article, error) {
+	if item.MetadataKey == "" {
+		return nil, nil
+	}
+	raw, err := readStoredJSON(store, item.MetadataKey, maxReaderArticleSize)
+	if err != nil {
+		return nil, err
+	}
+	var article reader.Article
+	if err := json.Unmarshal(raw, &article); err != nil {
+		return nil, err
+	}
+	return &article, nil
+}
+
+// ServeReader returns the reader-mode article of a capture's web archive as a
+// standalone HTML page, Markdown or the stored JSON record.
+//
+// An mhtml item captured before extraction existed has no article yet. The
+// first request for it queues extraction from the stored snapshot and answers
+// 202, so the viewer and API clients can simply ask again.
+func ServeReader(c *gin.Context, store storage.Storage, db *gorm.DB, riverClient *river.Client[pgx.Tx], format string) {
+	shortID := c.Param("shortid")
+	if redirectIfAlias(c, db, shortID) {
+		return
+	}
+	var item models.ArchiveItem
+	if err := db.Joins("JOIN captures ON captures.id = archive_items.capture_id").
+		Where("captures.short_id = ? AND archive_items.type = ?", shortID, utils.ArchiveTypeMHTML).
+		First(&item).Error; err != nil || item.Status != "completed" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no web archive is available for this capture"})
+		return
+	}
+
+	article, err := readerArticle(store, &item)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "stored article could not be read"})
+		return
+	}
+	if article == nil {
+		_ = workers.EnqueueReader(c.Request.Context(), riverClient, shortID)
+		c.Header("Retry-After", "5")
+		if format == readerFormatHTML {
+			c.Data(http.StatusAccepted, "text/html; charset=utf-8", []byte(readerPendingPage))
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"status": "pending"})
+		return
+	}
+
+	c.Header("X-Content-Type-Options", "nosniff")
+	switch format {
+	case readerFormatJSON:
+		c.JSON(http.StatusOK, article)
+	case readerFormatMarkdown:
+		if !article.Readable {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no article was found on this page"})
+			return
+		}
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(article.Markdown))
+	default:
+		// The article markup is already reduced to structural elements, but
+		// the page is served from the archive's own origin, so it still gets
+		// a policy that forbids script outright.
+		c.Header("Content-Security-Policy", "default-src 'none'; img-src * data:; style-src 'unsafe-inline'")
+		var out bytes.Buffer
+		if err := readerPageTemplate.Execute(&out, readerPageData{Article: article, Body: template.HTML(article.HTML)}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "article could not be rendered"})
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", out.Bytes())
+	}
+}
+
+type readerPageData struct {
+	Article *reader.Article
+	Body    template.HTML
+}
+
+const readerPendingPage = `<!doctype html><html><head><meta charset="utf-8"><meta http-equiv="refresh" content="5"><title>Extracting article</title></head>` +
+	`<body style="font-family: system-ui, sans-serif; color: #555; padding: 2rem;">Extracting the article from this archive. This page will refresh.</body></html>`
+
+var readerPageTemplate = template.Must(template.New("reader").Parse(`<!doctype html>
+<html{{with .Article.Language}} lang="{{.}}"{{end}}>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Article.Title}}</title>
+<style>
+body { font-family: Georgia, serif; font-size: 1.15rem; line-height: 1.6; color: #222; max-width: 40rem; margin: 2rem auto; padding: 0 1rem; }
+header { font-family: system-ui, sans-serif; margin-bottom: 2rem; }
+h1 { line-height: 1.2; margin-bottom: 0.5rem; }
+.meta { color: #666; font-size: 0.95rem; }
+img { max-width: 100%; height: auto; }
+pre { overflow-x: auto; background: #f5f5f5; padding: 0.75rem; }
+blockquote { border-left: 3px solid #ccc; margin-left: 0; padding-left: 1rem; color: #444; }
+table { border-collapse: collapse; } td, th { border: 1px solid #ddd; padding: 0.25rem 0.5rem; }
+</style>
+</head>
+<body>
+<header>
+{{with .Article.Title}}<h1>{{.}}</h1>{{end}}
+<div class="meta">{{with .Article.Byline}}{{.}}{{end}}{{if and .Article.Byline .Article.Published}} · {{end}}{{with .Article.Published}}<time>{{.}}</time>{{end}}{{with .Article.SiteName}}<div>{{.}}</div>{{end}}</div>
+</header>
+{{if .Article.Readable}}<article>
+{{.Body}}
+</article>{{else}}<p class="meta">No article text was found on this page. The Web tab shows the full capture.</p>{{end}}
+</body>
+</html>
+`))
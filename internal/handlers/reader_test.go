@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"arker/internal/archivers"
+	"arker/internal/models"
+	"arker/internal/reader"
+	"arker/internal/storage"
+)
+
+func readerRouter(db *gorm.DB, store storage.Storage) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/reader/:shortid", func(c *gin.Context) { ServeReader(c, store, db, nil, readerFormatHTML) })
+	r.GET("/reader/:shortid/markdown", func(c *gin.Context) { ServeReader(c, store, db, nil, readerFormatMarkdown) })
+	r.GET("/reader/:shortid/json", func(c *gin.Context) { ServeReader(c, store, db, nil, readerFormatJSON) })
+	r.GET("/api/v1/archive/:shortid", func(c *gin.Context) { ApiArchiveResult(c, store, db, nil) })
+	return r
+}
+
+// storeReaderArticle gives the capture's mhtml item a stored article.
+func storeReaderArticle(t *testing.T, db *gorm.DB, store storage.Storage, capture models.Capture, article *reader.Article) {
+	t.Helper()
+	data, err := archivers.EncodeReaderArticle(article)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := capture.ShortID + "/mhtml-n.metadata.json"
+	w, _ := store.Writer(key)
+	w.Write(data)
+	w.Close()
+	if err := db.Model(&models.ArchiveItem{}).Where("capture_id = ? AND type = ?", capture.ID, "mhtml").
+		Updates(map[string]any{"metadata_key": key, "storage_key": capture.ShortID + "/mhtml-n.mhtml"}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readerGet(r http.Handler, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestServeReaderFormats(t *testing.T) {
+	db := newHandlerLogTestDB(t)
+	store := storage.NewMemoryStorage()
+	r := readerRouter(db, store)
+	capture := createVideoCapture(t, db, "read1", "https://blog.example/tides", map[string]string{"mhtml": "completed"})
+	storeReaderArticle(t, db, store, capture, &reader.Article{
+		Readable: true, Title: "Reading the <tides>", Byline: "Sam Lee", WordCount: 120,
+		HTML: "<p>The tide tables.</p>", Markdown: "The tide tables.", Source: reader.SourcePage,
+	})
+
+	page := readerGet(r, "/reader/read1")
+	if page.Code != http.StatusOK || !strings.Contains(page.Body.String(), "<p>The tide tables.</p>") {
+		t.Fatalf("html = %d %s", page.Code, page.Body.String())
+	}
+	// The title is page text, not markup; only the sanitized body is trusted.
+	if !strings.Contains(page.Body.String(), "Reading the &lt;tides&gt;") {
+		t.Errorf("title was not escaped: %s", page.Body.String())
+	}
+	if csp := page.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "default-src 'none'") {
+		t.Errorf("Content-Security-Policy = %q", csp)
+	}
+
+	md := readerGet(r, "/reader/read1/markdown")
+	if md.Code != http.StatusOK || md.Body.String() != "The tide tables." || !strings.HasPrefix(md.Header().Get("Content-Type"), "text/markdown") {
+		t.Fatalf("markdown = %d %q %q", md.Code, md.Header().Get("Content-Type"), md.Body.String())
+	}
+	if js := readerGet(r, "/reader/read1/json"); js.Code != http.StatusOK || !strings.Contains(js.Body.String(), `"byline":"Sam Lee"`) {
+		t.Fatalf("json = %d %s", js.Code, js.Body.String())
+	}
+}
+
+func TestServeReaderPendingAndMissing(t *testing.T) {
+	db := newHandlerLogTestDB(t)
+	store := storage.NewMemoryStorage()
+	r := readerRouter(db, store)
+	createVideoCapture(t, db, "old01", "https://blog.example/old", map[string]string{"mhtml": "completed"})
+	createVideoCapture(t, db, "run01", "https://blog.example/run", map[string]string{"mhtml": "processing"})
+
+	// Captured before extraction existed: queued, and the caller is told to
+	// come back rather than that there is nothing.
+	if rec := readerGet(r, "/reader/old01/json"); rec.Code != http.StatusAccepted || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("legacy capture = %d %v", rec.Code, rec.Header())
+	}
+	if rec := readerGet(r, "/reader/old01"); rec.Code != http.StatusAccepted || !strings.Contains(rec.Body.String(), "refresh") {
+		t.Fatalf("legacy capture page = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := readerGet(r, "/reader/run01/json"); rec.Code != http.StatusNotFound {
+		t.Errorf("incomplete web archive = %d, want 404", rec.Code)
+	}
+	if rec := readerGet(r, "/reader/none1/json"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown capture = %d, want 404", rec.Code)
+	}
+}
+
+// An unreadable page still has a record, but no Markdown to serve.
+func TestServeReaderUnreadablePage(t *testing.T) {
+	db := newHandlerLogTestDB(t)
+	store := storage.NewMemoryStorage()
+	r := readerRouter(db, store)
+	capture := createVideoCapture(t, db, "srch1", "https://search.example/?q=tides", map[string]string{"mhtml": "completed"})
+	storeReaderArticle(t, db, store, capture, &reader.Article{Title: "Search", WordCount: 12, Source: reader.SourcePage})
+
+	if rec := readerGet(r, "/reader/srch1/markdown"); rec.Code != http.StatusNotFound {
+		t.Errorf("markdown of unreadable page = %d, want 404", rec.Code)
+	}
+	if rec := readerGet(r, "/reader/srch1"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "No article text") {
+		t.Errorf("page of unreadable page = %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestApiArchiveResultIncludesReader(t *testing.T) {
+	db := newHandlerLogTestDB(t)
+	store := storage.NewMemoryStorage()
+	r := readerRouter(db, store)
+	capture := createVideoCapture(t, db, "read2", "https://blog.example/tides", map[string]string{"mhtml": "completed", "screenshot": "completed"})
+	storeReaderArticle(t, db, store, capture, &reader.Article{
+		Readable: true, Title: "Reading the tides", Published: "2024-03-02T07:15:00Z", LeadImage: "https://blog.example/a.jpg",
+		WordCount: 120, HTML: "<p>The tide tables.</p>", Markdown: "The tide tables.", Source: reader.SourcePage,
+	})
+
+	_, body := getResult(t, r, "read2")
+	got, ok := body["reader"].(map[string]any)
+	if !ok {
+		t.Fatalf("reader = %#v", body["reader"])
+	}
+	if got["status"] != "ready" || got["readable"] != true || got["title"] != "Reading the tides" || got["word_count"] != float64(120) {
+		t.Errorf("reader = %#v", got)
+	}
+	if got["markdown"] != "The tide tables." || got["published"] != "2024-03-02T07:15:00Z" || got["lead_image"] != "https://blog.example/a.jpg" {
+		t.Errorf("reader = %#v", got)
+	}
+	if got["url"] != "https://archive.test/reader/read2" || got["markdown_url"] != "https://archive.test/reader/read2/markdown" {
+		t.Errorf("reader links = %v, %v", got["url"], got["markdown_url"])
+	}
+
+	createVideoCapture(t, db, "old02", "https://blog.example/old", map[string]string{"mhtml": "completed"})
+	db.Model(&models.ArchiveItem{}).Where("type = ? AND metadata_key = ''", "mhtml").Update("storage_key", "old02/mhtml-n.mhtml")
+	_, legacy := getResult(t, r, "old02")
+	if pending, ok := legacy["reader"].(map[string]any); !ok || pending["status"] != "pending" {
+		t.Errorf("legacy reader = %#v", legacy["reader"])
+	}
+
+	createVideoCapture(t, db, "shot1", "https://blog.example/shot", map[string]string{"screenshot": "completed"})
+	if _, noWeb := getResult(t, r, "shot1"); noWeb["reader"] != nil {
+		t.Errorf("reader without a web archive = %#v", noWeb["reader"])
+	}
+}
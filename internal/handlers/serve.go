@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"arker/internal/gitcache"
 	"arker/internal/models"
 	"arker/internal/storage"
 	"arker/internal/utils"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"strings"
 	"time"
@@ -73,12 +77,20 @@ func ServeArchive(c *gin.Context, storageInstance storage.Storage, db *gorm.DB)
 }
 
 func serveArchiveContent(c *gin.Context, storageInstance storage.Storage, item models.ArchiveItem, capture models.Capture, archivedURL models.ArchivedURL) {
+	if utils.ArchiveTypesEqual(item.Type, utils.ArchiveTypeGit) && item.Extension == gitcache.DeltaExtension {
+		serveGitDelta(c, storageInstance, item, capture, archivedURL)
+		return
+	}
 	ct, attach := contentTypeForArchive(item.Type, item.Extension)
 	filename := utils.GenerateArchiveFilename(capture, archivedURL, item.Extension)
 	contentDisposition := ""
 	if attach {
 		contentDisposition = fmt.Sprintf("attachment; filename=\"%s\"", filename)
 	}
+	if utils.ArchiveTypesEqual(item.Type, utils.ArchiveTypeFile) {
+		ct, contentDisposition = fileServeHeaders(storageInstance, item, ct, attach, filename)
+		c.Header("X-Content-Type-Options", "nosniff")
+	}
 
 	// R2 ignores response-content-type and response-content-disposition on
 	// presigned HEAD requests. Answer HEAD from the completed archive item's
@@ -109,9 +121,10 @@ func serveArchiveContent(c *gin.Context, storageInstance storage.Storage, item m
 			c.AbortWithStatus(http.StatusTemporaryRedirect)
 			return
 		}
-		if err != nil {
+		// ErrNoDirectURL: the copy being served is on a backend that streams.
+		if err != nil && !errors.Is(err, storage.ErrNoDirectURL) {
 			log.Printf("Failed to generate direct archive URL for short_id=%s storage_key=%s: %v", capture.ShortID, item.StorageKey, err)
-		} else {
+		} else if err == nil {
 			log.Printf("Direct archive URL was empty for short_id=%s storage_key=%s", capture.ShortID, item.StorageKey)
 		}
 	}
@@ -161,6 +174,26 @@ func serveArchiveContent(c *gin.Context, storageInstance storage.Storage, item m
 	}
 }
 
+// serveGitDelta downloads an incremental git capture as the whole
+// repository, rebuilt from the captures it builds on: a delta alone is not a
+// repository anyone can use. Its size is not known until it is written.
+func serveGitDelta(c *gin.Context, storageInstance storage.Storage, item models.ArchiveItem, capture models.Capture, archivedURL models.ArchivedURL) {
+	filename := utils.GenerateArchiveFilename(capture, archivedURL, ".tar")
+	c.Header("Content-Type", "application/x-tar")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	c.Header("ETag", fmt.Sprintf("\"%s-full\"", item.StorageKey))
+	if c.Request.Method == http.MethodHead {
+		c.Status(http.StatusOK)
+		return
+	}
+	if err := gitcache.WriteTar(c.Writer, storageInstance, item.StorageKey); err != nil {
+		log.Printf("Error rebuilding git capture %s: %v", item.StorageKey, err)
+		if !c.Writer.Written() {
+			c.Status(http.StatusInternalServerError)
+		}
+	}
+}
+
 func contentTypeForArchive(typ, extension string) (string, bool) {
 	switch utils.NormalizeArchiveType(typ) {
 	case utils.ArchiveTypeMHTML:
@@ -176,18 +209,89 @@ func contentTypeForArchive(typ, extension string) (string, bool) {
 		switch strings.ToLower(extension) {
 		case ".webm":
 			return "video/webm", false
+		case ".m4a":
+			// An audio-only quality policy.
+			return "audio/mp4", false
+		case ".ts":
+			// A live recording kept as captured: a checkpoint, or one
+			// ffmpeg could not remux.
+			return "video/mp2t", false
 		default:
 			return "video/mp4", false
 		}
+	case utils.ArchiveTypeAudio:
+		if strings.EqualFold(extension, ".opus") {
+			return "audio/ogg", false
+		}
+		return "audio/mp4", false
+	case utils.ArchiveTypePDF:
+		// Inline, so the viewer tab can embed the browser's PDF reader.
+		return "application/pdf", false
+	case utils.ArchiveTypeFile:
+		// Only types a browser renders without running anything of the
+		// document's are shown inline; the rest download.
+		if ct, ok := inlineFileContentTypes[strings.ToLower(extension)]; ok {
+			return ct, false
+		}
+		if ct := mime.TypeByExtension(extension); ct != "" {
+			return ct, true
+		}
+		return "application/octet-stream", true
 	case utils.ArchiveTypeGit:
 		return "application/x-tar", true
-	case utils.ArchiveTypeItch, utils.ArchiveTypeGalleryDl:
+	case utils.ArchiveTypeItch, utils.ArchiveTypeGalleryDl, utils.ArchiveTypeForge:
 		return "application/zip", true
+	case utils.ArchiveTypePlaylist:
+		return "application/json", false
 	default:
 		return "application/octet-stream", true
 	}
 }
 
+// inlineFileContentTypes are the file extensions served inline. SVG is
+// absent on purpose: it can carry script, and would run it on this origin.
+var inlineFileContentTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".avif": "image/avif",
+}
+
+// maxFileMetadataSize bounds the file sidecar read on every download.
+const maxFileMetadataSize = 64 << 10
+
+// fileServeHeaders serves a file capture under the name its server gave it
+// and, for a download, the type it declared. A missing or unreadable sidecar
+// falls back to the generated name and the extension's type.
+func fileServeHeaders(store storage.Storage, item models.ArchiveItem, ct string, attach bool, fallbackName string) (string, string) {
+	disposition := "inline"
+	if attach {
+		disposition = "attachment"
+	}
+	filename := fallbackName
+	if item.MetadataKey != "" {
+		var metadata struct {
+			ContentType string `json:"content_type"`
+			Filename    string `json:"filename"`
+		}
+		if raw, err := readStoredJSON(store, item.MetadataKey, maxFileMetadataSize); err == nil && json.Unmarshal(raw, &metadata) == nil {
+			if metadata.Filename != "" {
+				filename = metadata.Filename
+			}
+			if mediaType, params, err := mime.ParseMediaType(metadata.ContentType); attach && err == nil && !utils.IsPageContentType(mediaType) {
+				ct = mime.FormatMediaType(mediaType, params)
+			}
+		}
+	}
+	if formatted := mime.FormatMediaType(disposition, map[string]string{"filename": filename}); formatted != "" {
+		return ct, formatted
+	}
+	return ct, fmt.Sprintf("%s; filename=\"%s\"", disposition, fallbackName)
+}
+
 func ServeMHTMLAsHTML(c *gin.Context, storageInstance storage.Storage, db *gorm.DB) {
 	shortID := c.Param("shortid")
 	if redirectIfAlias(c, db, shortID) {
@@ -426,6 +426,61 @@ func TestServeArchiveContentNonSeekableStorageStreams(t *testing.T) {
 	}
 }
 
+func TestServeArchiveContentServesFilesUnderTheirOriginalName(t *testing.T) {
+	tests := []struct {
+		name, extension, metadata string
+		wantType, wantDisposition string
+	}{
+		{
+			name:            "pdf shown inline",
+			extension:       ".pdf",
+			metadata:        `{"content_type":"application/pdf","filename":"Annual Report.pdf"}`,
+			wantType:        "application/pdf",
+			wantDisposition: `inline; filename="Annual Report.pdf"`,
+		},
+		{
+			name:            "zip downloads with the declared type and a non-ASCII name",
+			extension:       ".zip",
+			metadata:        `{"content_type":"application/x-zip-compressed","filename":"données.zip"}`,
+			wantType:        "application/x-zip-compressed",
+			wantDisposition: `attachment; filename*=utf-8''donn%C3%A9es.zip`,
+		},
+		{
+			name:            "svg is never inline",
+			extension:       ".svg",
+			metadata:        `{"content_type":"image/svg+xml","filename":"logo.svg"}`,
+			wantType:        "image/svg+xml",
+			wantDisposition: `attachment; filename=logo.svg`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storageInstance := storage.NewMemoryStorage()
+			writeTestStorageObject(t, storageInstance, "test/file-n"+tt.extension, "bytes")
+			writeTestStorageObject(t, storageInstance, "test/file-n.metadata.json", tt.metadata)
+			c, recorder := newArchiveContentTestContext(http.MethodGet, "")
+
+			serveArchiveContent(c, storageInstance, models.ArchiveItem{
+				Type:        "file",
+				StorageKey:  "test/file-n" + tt.extension,
+				MetadataKey: "test/file-n.metadata.json",
+				Extension:   tt.extension,
+				FileSize:    5,
+			}, models.Capture{ShortID: "test"}, models.ArchivedURL{Original: "https://example.com/get?id=1"})
+
+			if got := recorder.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+			if got := recorder.Header().Get("Content-Disposition"); got != tt.wantDisposition {
+				t.Errorf("Content-Disposition = %q, want %q", got, tt.wantDisposition)
+			}
+			if got := recorder.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("X-Content-Type-Options = %q", got)
+			}
+		})
+	}
+}
+
 func TestContentTypeForArchiveUsesYoutubeExtension(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -448,6 +503,11 @@ func TestContentTypeForArchiveUsesYoutubeExtension(t *testing.T) {
 			extension: ".WEBM",
 			wantType:  "video/webm",
 		},
+		{
+			name:      "live recording kept as MPEG-TS",
+			extension: ".ts",
+			wantType:  "video/mp2t",
+		},
 		{
 			name:      "unknown video extension defaults to mp4",
 			extension: "",
@@ -494,6 +554,13 @@ func TestContentTypeForArchiveKeepsDownloadsAttached(t *testing.T) {
 			wantType:   "application/zip",
 			wantAttach: true,
 		},
+		{
+			name:       "pdf is shown inline by the viewer",
+			typ:        "pdf",
+			extension:  ".pdf",
+			wantType:   "application/pdf",
+			wantAttach: false,
+		},
 		{
 			name:       "default",
 			typ:        "unknown",
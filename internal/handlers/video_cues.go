@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"arker/internal/archivers"
+	"arker/internal/storage"
+)
+
+// Search bounds. The query cap keeps a pathological request from scanning a
+// multi-hour track once per character; the match cap keeps a search for "the"
+// from returning the whole transcript.
+const (
+	maxCueSearchQuery   = 200
+	maxCueSearchMatches = 200
+)
+
+type videoCue struct {
+	Index int     `json:"index"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+	// URL deep-links to the player at this cue. Only set on search results,
+	// where it is the point of the response.
+	URL string `json:"url,omitempty"`
+}
+
+type videoCuesResponse struct {
+	ShortID     string     `json:"short_id"`
+	Lang        string     `json:"lang"`
+	Kind        string     `json:"kind"`
+	SubtitleURL string     `json:"subtitle_url"`
+	Cues        []videoCue `json:"cues"`
+}
+
+type videoSearchResponse struct {
+	ShortID   string     `json:"short_id"`
+	Query     string     `json:"query"`
+	Lang      string     `json:"lang"`
+	Kind      string     `json:"kind"`
+	Matches   []videoCue `json:"matches"`
+	Truncated bool       `json:"truncated,omitempty"`
+}
+
+// selectCueTrack picks the track to time against. An explicit language wins;
+// otherwise the track the plain-text transcript was derived from, so the timed
+// and untimed views of one archive say the same thing. Only formats the cue
+// parser reads are candidates.
+func selectCueTrack(tracks []archivers.SubtitleTrack, transcript *archivers.Transcript, lang string) (archivers.SubtitleTrack, bool) {
+	var candidates []archivers.SubtitleTrack
+	for _, track := range tracks {
+		format := strings.ToLower(track.Format)
+		if format == "" || format == "vtt" || format == "srt" {
+			candidates = append(candidates, track)
+		}
+	}
+	match := func(want func(archivers.SubtitleTrack) bool) (archivers.SubtitleTrack, bool) {
+		for _, track := range candidates {
+			if want(track) {
+				return track, true
+			}
+		}
+		return archivers.SubtitleTrack{}, false
+	}
+	if lang != "" {
+		if track, ok := match(func(t archivers.SubtitleTrack) bool { return strings.EqualFold(t.Lang, lang) }); ok {
+			return track, true
+		}
+		return match(func(t archivers.SubtitleTrack) bool { return sameBaseLanguage(t.Lang, lang) })
+	}
+	if transcript != nil {
+		if track, ok := match(func(t archivers.SubtitleTrack) bool {
+			return t.Lang == transcript.Lang && t.Kind == transcript.Source
+		}); ok {
+			return track, true
+		}
+	}
+	return match(func(archivers.SubtitleTrack) bool { return true })
+}
+
+// sameBaseLanguage compares language codes ignoring region, so ?lang=en finds
+// an en-US track.
+func sameBaseLanguage(a, b string) bool {
+	a, _, _ = strings.Cut(strings.ToLower(a), "-")
+	b, _, _ = strings.Cut(strings.ToLower(b), "-")
+	return a != "" && a == b
+}
+
+// loadVideoCues resolves the request to a video item and parses the chosen
+// track. It writes the error response itself and reports whether to continue.
+func loadVideoCues(c *gin.Context, store storage.Storage, db *gorm.DB, shortID string) (archivers.SubtitleTrack, []archivers.Cue, bool) {
+	item, ok := findVideoItem(c, db, shortID)
+	if !ok {
+		return archivers.SubtitleTrack{}, nil, false
+	}
+	tracks, transcript := videoSubtitleTracks(store, &item)
+	track, found := selectCueTrack(tracks, transcript, c.Query("lang"))
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no timed transcript is available for this archive"})
+		return track, nil, false
+	}
+	key := subtitleStorageKey(&item, track)
+	if key == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no timed transcript is available for this archive"})
+		return track, nil, false
+	}
+	data, err := readStoredJSONRaw(store, key, maxSubtitleServeSize)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "subtitle track temporarily unavailable"})
+		return track, nil, false
+	}
+	return track, archivers.CuesFromVTT(string(data)), true
+}
+
+// ServeVideoCues returns the transcript as timed cues, parsed from the stored
+// caption track on request. The track is the record; nothing derived from it
+// is persisted, so a parser improvement applies to every existing archive.
+func ServeVideoCues(c *gin.Context, store storage.Storage, db *gorm.DB) {
+	shortID := c.Param("shortid")
+	if redirectIfAlias(c, db, shortID) {
+		return
+	}
+	track, cues, ok := loadVideoCues(c, store, db, shortID)
+	if !ok {
+		return
+	}
+	out := make([]videoCue, 0, len(cues))
+	for i, cue := range cues {
+		out = append(out, videoCue{Index: i, Start: cue.Start, End: cue.End, Text: cue.Text})
+	}
+	c.JSON(http.StatusOK, videoCuesResponse{
+		ShortID: shortID, Lang: track.Lang, Kind: track.Kind,
+		SubtitleURL: fullPath(c, fmt.Sprintf("video/%s/subtitle/%s", shortID, url.PathEscape(subtitleRequestName(track)))),
+		Cues:        out,
+	})
+}
+
+// ServeVideoSearch finds the cues containing a phrase. Matching is
+// case-insensitive on whitespace-normalized text, which is as much as can be
+// promised of automatic captions.
+func ServeVideoSearch(c *gin.Context, store storage.Storage, db *gorm.DB) {
+	shortID := c.Param("shortid")
+	if redirectIfAlias(c, db, shortID) {
+		return
+	}
+	query := strings.Join(strings.Fields(c.Query("q")), " ")
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q parameter is required"})
+		return
+	}
+	if len(query) > maxCueSearchQuery {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("q must be at most %d bytes", maxCueSearchQuery)})
+		return
+	}
+	track, cues, ok := loadVideoCues(c, store, db, shortID)
+	if !ok {
+		return
+	}
+
+	response := videoSearchResponse{ShortID: shortID, Query: query, Lang: track.Lang, Kind: track.Kind, Matches: []videoCue{}}
+	needle := strings.ToLower(query)
+	for i, cue := range cues {
+		if !strings.Contains(strings.ToLower(cue.Text), needle) {
+			continue
+		}
+		if len(response.Matches) == maxCueSearchMatches {
+			response.Truncated = true
+			break
+		}
+		response.Matches = append(response.Matches, videoCue{
+			Index: i, Start: cue.Start, End: cue.End, Text: cue.Text,
+			URL: videoDeepLink(c, shortID, cue.Start),
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// videoDeepLink is the shareable link to a moment in an archived video. Whole
+// seconds, rounded down, so the player starts just before the words.
+func videoDeepLink(c *gin.Context, shortID string, start float64) string {
+	return fullPath(c, fmt.Sprintf("video/%s?t=%d", shortID, int64(math.Floor(start))))
+}
+
+// ServeVideoDeepLink sends /video/:shortid?t=N to the video tab, keeping the
+// start time for the player. It exists so deep links stay stable whatever the
+// viewer's own URL scheme becomes.
+func ServeVideoDeepLink(c *gin.Context, db *gorm.DB) {
+	shortID := c.Param("shortid")
+	if redirectIfAlias(c, db, shortID) {
+		return
+	}
+	item, ok := findVideoItem(c, db, shortID)
+	if !ok {
+		return
+	}
+	target := "/" + shortID + "/" + internalTypeToURLType(item.Type)
+	if t, err := strconv.ParseFloat(c.Query("t"), 64); err == nil && t > 0 && !math.IsInf(t, 0) {
+		target += "?t=" + strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	c.Redirect(http.StatusFound, target)
+}
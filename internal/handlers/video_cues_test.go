@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"arker/internal/archivers"
+	"arker/internal/storage"
+)
+
+func cueRouter(db *gorm.DB, store storage.Storage) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/video/:shortid/transcript/cues", func(c *gin.Context) { ServeVideoCues(c, store, db) })
+	r.GET("/video/:shortid/search", func(c *gin.Context) { ServeVideoSearch(c, store, db) })
+	r.GET("/video/:shortid", func(c *gin.Context) { ServeVideoDeepLink(c, db) })
+	return r
+}
+
+func getCueJSON(t *testing.T, r http.Handler, path string, out any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Host = "archive.example.com"
+	r.ServeHTTP(rec, req)
+	if out != nil {
+		_ = json.Unmarshal(rec.Body.Bytes(), out)
+	}
+	return rec.Code
+}
+
+func TestServeVideoCuesReturnsTimedLines(t *testing.T) {
+	db := newHandlerLogTestDB(t)
+	store := storage.NewMemoryStorage()
+	seedCaptionedVideo(t, db, store, "cue01", true)
+
+	var body videoCuesResponse
+	if code := getCueJSON(t, cueRouter(db, store), "/video/cue01/transcript/cues", &body); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if body.Lang != "en" || body.Kind != archivers.SubtitleKindAuto {
+		t.Errorf("track = %s/%s", body.Lang, body.Kind)
+	}
+	if len(body.Cues) != 1 || body.Cues[0].Start != 1 || body.Cues[0].End != 2 || body.Cues[0].Text != "all right so here we are" {
+		t.Fatalf("cues = %#v", body.Cues)
+	}
+	if body.SubtitleURL != "http://archive.example.com/video/cue01/subtitle/en.vtt" {
+		t.Errorf("subtitle_url = %q", body.SubtitleURL)
+	}
+
+	if code := getCueJSON(t, cueRouter(db, store), "/video/cue01/transcript/cues?lang=de", nil); code != http.StatusNotFound {
+		t.Errorf("missing language = %d, want 404", code)
+	}
+}
+
+func TestServeVideoSearchDeepLinksMatches(t *testing.T) {
+	db := newHandlerLogTestDB(t)
+	store := storage.NewMemoryStorage()
+	seedCaptionedVideo(t, db, store, "cue02", true)
+	r := cueRouter(db, store)
+
+	var body videoSearchResponse
+	if code := getCueJSON(t, r, "/video/cue02/search?q=HERE++we", &body); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if body.Query != "HERE we" || len(body.Matches) != 1 {
+		t.Fatalf("search = %#v", body)
+	}
+	if body.Matches[0].URL != "http://archive.example.com/video/cue02?t=1" {
+		t.Errorf("deep link = %q", body.Matches[0].URL)
+	}
+
+	body = videoSearchResponse{}
+	getCueJSON(t, r, "/video/cue02/search?q=elephant", &body)
+	if body.Matches == nil || len(body.Matches) != 0 {
+		t.Errorf("no-match search = %#v, want an empty list", body.Matches)
+	}
+	if code := getCueJSON(t, r, "/video/cue02/search?q=+", nil); code != http.StatusBadRequest {
+		t.Errorf("blank query = %d, want 400", code)
+	}
+}
+
+func TestServeVideoCuesWithoutCaptions(t *testing.T) {
+	db := newHandlerLogTestDB(t)
+	store := storage.NewMemoryStorage()
+	seedCaptionedVideo(t, db, store, "cue03", false)
+
+	if code := getCueJSON(t, cueRouter(db, store), "/video/cue03/search?q=zoo", nil); code != http.StatusNotFound {
+		t.Errorf("search without captions = %d, want 404", code)
+	}
+}
+
+func TestVideoDeepLinkRedirectsToTheVideoTab(t *testing.T) {
+	db := newHandlerLogTestDB(t)
+	store := storage.NewMemoryStorage()
+	seedCaptionedVideo(t, db, store, "cue04", true)
+	r := cueRouter(db, store)
+
+	for path, want := range map[string]string{
+		"/video/cue04?t=83":   "/cue04/yt-dlp?t=83",
+		"/video/cue04":        "/cue04/yt-dlp",
+		"/video/cue04?t=junk": "/cue04/yt-dlp",
+		"/video/cue04?t=-5":   "/cue04/yt-dlp",
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusFound || rec.Header().Get("Location") != want {
+			t.Errorf("GET %s = %d %q, want 302 %q", path, rec.Code, rec.Header().Get("Location"), want)
+		}
+	}
+	if code := getCueJSON(t, r, "/video/nope9?t=1", nil); code != http.StatusNotFound {
+		t.Errorf("unknown capture = %d, want 404", code)
+	}
+}
+
+func TestSelectCueTrackFollowsTheTranscript(t *testing.T) {
+	tracks := []archivers.SubtitleTrack{
+		{Lang: "de", Kind: archivers.SubtitleKindManual, Format: "vtt"},
+		{Lang: "en-US", Kind: archivers.SubtitleKindAuto, Format: "vtt"},
+		{Lang: "en-US", Kind: archivers.SubtitleKindAuto, Format: "json3"},
+	}
+	got, ok := selectCueTrack(tracks, &archivers.Transcript{Lang: "en-US", Source: archivers.SubtitleKindAuto}, "")
+	if !ok || got.Lang != "en-US" || got.Format != "vtt" {
+		t.Errorf("transcript track = %#v", got)
+	}
+	got, ok = selectCueTrack(tracks, nil, "en")
+	if !ok || got.Lang != "en-US" {
+		t.Errorf("base-language match = %#v", got)
+	}
+	if _, ok := selectCueTrack(tracks[2:], nil, ""); ok {
+		t.Error("a json3-only archive offered cues the parser cannot read")
+	}
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+
+	"arker/internal/archivers"
+	"arker/internal/models"
+	"arker/internal/storage"
+	"arker/internal/utils"
+	"arker/internal/workers"
+)
+
+// maxHLSPlaylistSize bounds a playlist read to answer one request. A media
+// playlist for a ten-hour stream at six-second segments is about 400 KB.
+const maxHLSPlaylistSize = 8 * 1024 * 1024
+
+// hlsFilePattern is every file name a package can contain below its
+// rendition directory. Anything else is not a file this route serves.
+var hlsFilePattern = regexp.MustCompile(`^(index\.m3u8|init\.mp4|seg_[0-9]{5}\.m4s)$`)
+
+// readyHLSPackage returns an item's stored HLS package, or nil when it has
+// none ready.
+func readyHLSPackage(db *gorm.DB, itemID uint) *models.HLSPackage {
+	var pkg models.HLSPackage
+	if err := db.Where("archive_item_id = ? AND status = ?", itemID, models.HLSStatusReady).First(&pkg).Error; err != nil {
+		return nil
+	}
+	return &pkg
+}
+
+// videoHLSURL is the master playlist path for a video item with a ready
+// package, or "" otherwise.
+func videoHLSURL(db *gorm.DB, item *models.ArchiveItem, shortID string) string {
+	if item == nil || item.Status != "completed" || !utils.ArchiveTypesEqual(item.Type, utils.ArchiveTypeYtDlp) {
+		return ""
+	}
+	if readyHLSPackage(db, item.ID) == nil {
+		return ""
+	}
+	return fmt.Sprintf("/video/%s/hls/%s", shortID, archivers.HLSMasterPlaylist)
+}
+
+// ServeVideoHLS serves one file of a video's HLS package.
+//
+// Playlists are answered here: they are small, and the relative URIs inside
+// them have to resolve against this route. Init and media segments redirect to
+// a presigned URL when the storage backend can produce one, so a seek costs
+// one small object fetch from the bucket rather than a proxied range request.
+//
+// A request for the master playlist of a completed video with no package yet
+// queues one, which is how videos archived before packaging existed get theirs.
+// A video already evaluated is not queued again, unless it was skipped as too
+// short and the minimum has been lowered since.
+func ServeVideoHLS(c *gin.Context, store storage.Storage, db *gorm.DB, riverClient *river.Client[pgx.Tx]) {
+	shortID := c.Param("shortid")
+	if redirectIfAlias(c, db, shortID) {
+		return
+	}
+	item, ok := findVideoItem(c, db, shortID)
+	if !ok {
+		return
+	}
+	name := strings.TrimPrefix(c.Param("name"), "/")
+
+	var pkg models.HLSPackage
+	err := db.Where("archive_item_id = ?", item.ID).First(&pkg).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if name == archivers.HLSMasterPlaylist && item.Status == "completed" {
+			if err := workers.EnqueueHLS(c.Request.Context(), riverClient, shortID, item.Type); err != nil {
+				log.Printf("Failed to queue HLS packaging for short_id=%s: %v", shortID, err)
+			}
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "no HLS stream is available for this archive"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if name == archivers.HLSMasterPlaylist && workers.HLSSkipLifted(&pkg) {
+		if err := workers.EnqueueHLS(c.Request.Context(), riverClient, shortID, item.Type); err != nil {
+			log.Printf("Failed to queue HLS packaging for short_id=%s: %v", shortID, err)
+		}
+	}
+	if pkg.Status != models.HLSStatusReady || !hlsPackageHasFile(&pkg, name) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no HLS stream is available for this archive"})
+		return
+	}
+
+	key := pkg.KeyPrefix + name
+	contentType := hlsContentType(name)
+	if strings.HasSuffix(name, ".m3u8") {
+		data, err := readStoredJSONRaw(store, key, maxHLSPlaylistSize)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "HLS stream temporarily unavailable"})
+			return
+		}
+		// A package is never rewritten, but the master URL is stable per
+		// video, so it should not outlive a package being added.
+		if name == archivers.HLSMasterPlaylist {
+			c.Header("Cache-Control", "public, max-age=300")
+		} else {
+			c.Header("Cache-Control", "public, max-age=86400")
+		}
+		c.Data(http.StatusOK, contentType, data)
+		return
+	}
+
+	if directStorage, ok := store.(storage.DirectURLStorage); ok {
+		directURL, err := directStorage.DirectURL(c.Request.Context(), key, storage.DirectURLOptions{
+			Method:      c.Request.Method,
+			ContentType: contentType,
+		})
+		if err == nil && directURL != "" {
+			c.Header("Location", directURL)
+			c.AbortWithStatus(http.StatusTemporaryRedirect)
+			return
+		}
+		if err != nil && !errors.Is(err, storage.ErrNoDirectURL) {
+			log.Printf("Failed to generate direct HLS URL for short_id=%s key=%s: %v", shortID, key, err)
+		}
+	}
+
+	reader, err := store.Reader(key)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "HLS stream temporarily unavailable"})
+		return
+	}
+	defer reader.Close()
+	c.Header("Content-Type", contentType)
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	if size, err := store.Size(key); err == nil {
+		c.Header("Content-Length", fmt.Sprintf("%d", size))
+	}
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		log.Printf("Error streaming HLS file %s: %v", key, err)
+	}
+}
+
+// hlsPackageHasFile reports whether name is a file of this package: the
+// master playlist, or a well-formed file name inside one of its recorded
+// renditions. The request never names a storage key directly.
+func hlsPackageHasFile(pkg *models.HLSPackage, name string) bool {
+	if name == archivers.HLSMasterPlaylist {
+		return true
+	}
+	rendition, file := path.Split(name)
+	rendition = strings.TrimSuffix(rendition, "/")
+	if rendition == "" || strings.Contains(rendition, "/") || !hlsFilePattern.MatchString(file) {
+		return false
+	}
+	for _, recorded := range strings.Split(pkg.Renditions, ",") {
+		if recorded == rendition {
+			return true
+		}
+	}
+	return false
+}
+
+func hlsContentType(name string) string {
+	switch path.Ext(name) {
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".m4s":
+		return "video/iso.segment"
+	default:
+		return "video/mp4"
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"arker/internal/models"
+	"arker/internal/storage"
+)
+
+func newHLSHandlerTest(t *testing.T, withPackage bool) (*gorm.DB, storage.Storage, *gin.Engine) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db := newHandlerLogTestDB(t)
+	if err := db.AutoMigrate(&models.HLSPackage{}); err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewMemoryStorage()
+	createVideoCapture(t, db, "long1", "https://www.youtube.com/watch?v=stream", map[string]string{"yt-dlp": "completed"})
+	db.Model(&models.ArchiveItem{}).Where("type = ?", "yt-dlp").Update("storage_key", "long1/yt-dlp-a.mp4")
+
+	if withPackage {
+		var item models.ArchiveItem
+		db.Where("type = ?", "yt-dlp").First(&item)
+		prefix := "long1/yt-dlp-a.hls-n1/"
+		storeTestObject(t, store, prefix+"master.m3u8", []byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=8000\nsource/index.m3u8\n"))
+		storeTestObject(t, store, prefix+"source/index.m3u8", []byte("#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:6.0,\nseg_00000.m4s\n#EXT-X-ENDLIST\n"))
+		storeTestObject(t, store, prefix+"source/seg_00000.m4s", []byte("segment-bytes"))
+		if err := db.Create(&models.HLSPackage{ArchiveItemID: item.ID, Status: models.HLSStatusReady, KeyPrefix: prefix, Renditions: "source", SegmentCount: 1}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	router := gin.New()
+	router.GET("/video/:shortid/hls/*name", func(c *gin.Context) { ServeVideoHLS(c, store, db, nil) })
+	router.GET("/video/:shortid/manifest", func(c *gin.Context) { ServeVideoManifest(c, store, db) })
+	return db, store, router
+}
+
+func TestServeVideoHLSServesPackageFiles(t *testing.T) {
+	_, _, router := newHLSHandlerTest(t, true)
+
+	tests := []struct {
+		path        string
+		contentType string
+		body        string
+	}{
+		{"/video/long1/hls/master.m3u8", "application/vnd.apple.mpegurl", "source/index.m3u8"},
+		{"/video/long1/hls/source/index.m3u8", "application/vnd.apple.mpegurl", "seg_00000.m4s"},
+		{"/video/long1/hls/source/seg_00000.m4s", "video/iso.segment", "segment-bytes"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s = %d: %s", tt.path, rec.Code, rec.Body.String())
+			continue
+		}
+		if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("GET %s content type = %q, want %q", tt.path, got, tt.contentType)
+		}
+		if !strings.Contains(rec.Body.String(), tt.body) {
+			t.Errorf("GET %s body = %q, want it to contain %q", tt.path, rec.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestServeVideoHLSRefusesNamesOutsideThePackage(t *testing.T) {
+	_, _, router := newHLSHandlerTest(t, true)
+
+	for _, path := range []string{
+		"/video/long1/hls/source/../../yt-dlp-a.mp4",
+		"/video/long1/hls/720p/index.m3u8",
+		"/video/long1/hls/source/other.mp4",
+		"/video/long1/hls/source/nested/seg_00000.m4s",
+		"/video/long1/hls/",
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound && rec.Code != http.StatusMovedPermanently {
+			t.Errorf("GET %s = %d, want 404", path, rec.Code)
+		}
+	}
+}
+
+func TestServeVideoHLSWithoutAPackage(t *testing.T) {
+	_, _, router := newHLSHandlerTest(t, false)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/video/long1/hls/master.m3u8", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404 before a package exists", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/video/long1/manifest", nil))
+	var manifest struct {
+		HLSURL *string `json:"hls_url"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.HLSURL != nil {
+		t.Errorf("hls_url = %q without a package", *manifest.HLSURL)
+	}
+}
+
+func TestServeVideoManifestAdvertisesReadyHLS(t *testing.T) {
+	_, _, router := newHLSHandlerTest(t, true)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/video/long1/manifest", nil))
+	var manifest struct {
+		HLSURL *string `json:"hls_url"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.HLSURL == nil || *manifest.HLSURL != "/video/long1/hls/master.m3u8" {
+		t.Errorf("hls_url = %v, want the master playlist", manifest.HLSURL)
+	}
+}
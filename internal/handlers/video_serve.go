@@ -18,10 +18,13 @@ import (
 const maxVideoMetadataSize = 32 * 1024 * 1024
 
 type videoManifestResponse struct {
-	SchemaVersion             string          `json:"schema_version"`
-	ShortID                   string          `json:"short_id"`
-	CaptureStatus             string          `json:"capture_status"`
-	MediaURL                  *string         `json:"media_url"`
+	SchemaVersion string  `json:"schema_version"`
+	ShortID       string  `json:"short_id"`
+	CaptureStatus string  `json:"capture_status"`
+	MediaURL      *string `json:"media_url"`
+	// HLSURL is the adaptive-streaming master playlist, present only for
+	// videos long enough to have been packaged. MediaURL is always the archive.
+	HLSURL                    *string         `json:"hls_url"`
 	MetadataAvailable         bool            `json:"metadata_available"`
 	Metadata                  json.RawMessage `json:"metadata"`
 	RawMetadataURL            *string         `json:"raw_metadata_url"`
@@ -89,8 +92,11 @@ func ServeVideoManifest(c *gin.Context, store storage.Storage, db *gorm.DB) {
 		Provenance:        item.Source,
 	}
 	if item.Status == "completed" && item.StorageKey != "" {
-		mediaURL := fmt.Sprintf("/archive/%s/%s", shortID, utils.ArchiveTypeYtDlp)
+		mediaURL := fmt.Sprintf("/archive/%s/%s", shortID, utils.NormalizeArchiveType(item.Type))
 		response.MediaURL = &mediaURL
+		if hlsURL := videoHLSURL(db, &item, shortID); hlsURL != "" {
+			response.HLSURL = &hlsURL
+		}
 	}
 
 	if item.MetadataKey == "" {
@@ -167,10 +173,14 @@ func ServeVideoRawMetadata(c *gin.Context, store storage.Storage, db *gorm.DB) {
 	_, _ = io.Copy(c.Writer, reader)
 }
 
+// lookupVideoItem finds the capture's yt-dlp item. An audio item is one too,
+// with the same normalized metadata, captions and transcript, so the /video/
+// endpoints (and their /audio/ aliases) serve it unchanged.
 func lookupVideoItem(db *gorm.DB, shortID string) (models.ArchiveItem, error) {
+	types := append(utils.ArchiveTypeMatchValues(utils.ArchiveTypeYtDlp), utils.ArchiveTypeAudio)
 	var item models.ArchiveItem
 	if err := db.Joins("JOIN captures ON captures.id = archive_items.capture_id").
-		Where("captures.short_id = ? AND archive_items.type IN ?", shortID, utils.ArchiveTypeMatchValues(utils.ArchiveTypeYtDlp)).
+		Where("captures.short_id = ? AND archive_items.type IN ?", shortID, types).
 		First(&item).Error; err != nil {
 		return models.ArchiveItem{}, err
 	}
@@ -18,7 +18,7 @@ import (
 func subtitleRouter(db *gorm.DB, store storage.Storage) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
-	r.GET("/api/v1/archive/:shortid", func(c *gin.Context) { ApiArchiveResult(c, store, db) })
+	r.GET("/api/v1/archive/:shortid", func(c *gin.Context) { ApiArchiveResult(c, store, db, nil) })
 	r.GET("/video/:shortid/transcript", func(c *gin.Context) { ServeVideoTranscript(c, store, db) })
 	r.GET("/video/:shortid/subtitle/:name", func(c *gin.Context) { ServeVideoSubtitle(c, store, db) })
 	return r
@@ -0,0 +1,261 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"arker/internal/storage"
+	"arker/internal/utils"
+)
+
+// StorageProbeKey is rewritten on every storage check. One fixed key keeps
+// the probe from accumulating objects: the Storage interface has no delete.
+const StorageProbeKey = "health/probe"
+
+// ytDlpVersionDate reads the release date yt-dlp uses as its version
+// ("2025.06.30", nightlies "2025.06.30.232851").
+var ytDlpVersionDate = regexp.MustCompile(`^(\d{4})\.(\d{2})\.(\d{2})`)
+
+// CommandCheck runs a tool's version command. The tool is down when the
+// command fails; its first output line is reported as the version.
+func CommandCheck(name string, archiveTypes []string, argv ...string) Check {
+	return Check{
+		Name:         name,
+		ArchiveTypes: archiveTypes,
+		Run: func(ctx context.Context) Result {
+			version, err := commandVersion(ctx, argv)
+			if err != nil {
+				return Result{Status: StatusDown, Message: err.Error()}
+			}
+			return Result{Status: StatusOK, Version: version}
+		},
+	}
+}
+
+// YtDlpCheck is CommandCheck plus staleness. yt-dlp versions are release
+// dates, and sites break old releases: a yt-dlp older than staleAfter still
+// runs, but is the first suspect when video captures start failing.
+func YtDlpCheck(archiveTypes []string, staleAfter time.Duration) Check {
+	check := CommandCheck("yt-dlp", archiveTypes, "yt-dlp", "--version")
+	versionOnly := check.Run
+	check.Run = func(ctx context.Context) Result {
+		result := versionOnly(ctx)
+		if result.Status != StatusOK {
+			return result
+		}
+		released, ok := YtDlpReleaseDate(result.Version)
+		if !ok {
+			return result
+		}
+		age := time.Since(released)
+		result.Details = map[string]any{"released": released.Format("2006-01-02"), "age_days": int(age.Hours() / 24)}
+		if staleAfter > 0 && age > staleAfter {
+			result.Status = StatusDegraded
+			result.Message = fmt.Sprintf("yt-dlp %s is %d days old; update it", result.Version, int(age.Hours()/24))
+		}
+		return result
+	}
+	return check
+}
+
+// YtDlpReleaseDate parses the release date out of a yt-dlp version string.
+func YtDlpReleaseDate(version string) (time.Time, bool) {
+	m := ytDlpVersionDate.FindStringSubmatch(strings.TrimSpace(version))
+	if m == nil {
+		return time.Time{}, false
+	}
+	released, err := time.Parse("2006.01.02", m[1]+"."+m[2]+"."+m[3])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return released, true
+}
+
+func commandVersion(ctx context.Context, argv []string) (string, error) {
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		detail := utils.TruncateForLog(strings.TrimSpace(output.String()), 200)
+		if detail == "" {
+			return "", fmt.Errorf("%s: %v", argv[0], err)
+		}
+		return "", fmt.Errorf("%s: %v: %s", argv[0], err, detail)
+	}
+	version, _, _ := strings.Cut(strings.TrimSpace(output.String()), "\n")
+	return strings.TrimSpace(version), nil
+}
+
+// PlaywrightCheck launches headless Chromium and opens a page, the first
+// thing every browser-backed archiver does.
+func PlaywrightCheck(archiveTypes []string, timeout time.Duration) Check {
+	return Check{
+		Name:         "playwright",
+		ArchiveTypes: archiveTypes,
+		// The launch has its own timeout; leave room for it to report.
+		Timeout: timeout + 5*time.Second,
+		Run: func(ctx context.Context) Result {
+			if err := utils.CheckPlaywrightAvailability(timeout); err != nil {
+				return Result{Status: StatusDown, Message: err.Error()}
+			}
+			return Result{Status: StatusOK}
+		},
+	}
+}
+
+// StorageCheck writes a random token to StorageProbeKey and reads it back.
+// Storage down means no archive of any type can be saved.
+func StorageCheck(store storage.Storage, archiveTypes []string) Check {
+	return Check{
+		Name:         "storage",
+		ArchiveTypes: archiveTypes,
+		Run: func(ctx context.Context) Result {
+			if err := storageRoundTrip(store); err != nil {
+				return Result{Status: StatusDown, Message: err.Error()}
+			}
+			return Result{Status: StatusOK}
+		},
+	}
+}
+
+func storageRoundTrip(store storage.Storage) error {
+	token := make([]byte, 16)
+	_, _ = rand.Read(token)
+	want := hex.EncodeToString(token)
+
+	w, err := store.Writer(StorageProbeKey)
+	if err != nil {
+		return fmt.Errorf("open for write: %w", err)
+	}
+	if _, err := io.WriteString(w, want); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("write: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("commit write: %w", err)
+	}
+
+	r, err := store.Reader(StorageProbeKey)
+	if err != nil {
+		return fmt.Errorf("open for read: %w", err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(io.LimitReader(r, 1024))
+	if err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	if string(got) != want {
+		return fmt.Errorf("read back different bytes than were written")
+	}
+	return nil
+}
+
+// DatabaseCheck pings the database. Without it no capture can be created or
+// updated, so every type is refused.
+func DatabaseCheck(db *gorm.DB, archiveTypes []string) Check {
+	return Check{
+		Name:         "database",
+		ArchiveTypes: archiveTypes,
+		Run: func(ctx context.Context) Result {
+			sqlDB, err := db.DB()
+			if err == nil {
+				err = sqlDB.PingContext(ctx)
+			}
+			if err != nil {
+				return Result{Status: StatusDown, Message: "database connection failed"}
+			}
+			return Result{Status: StatusOK}
+		},
+	}
+}
+
+// CookiesCheck inspects the media cookie jar. An unreadable jar is down for
+// the tools that load it; expired logins and logins about to expire are
+// degraded, since public media still archives without them.
+func CookiesCheck(archiveTypes []string, warnWithin time.Duration) Check {
+	return Check{
+		Name:         "cookies",
+		ArchiveTypes: archiveTypes,
+		Run: func(ctx context.Context) Result {
+			now := time.Now()
+			jar, err := utils.InspectYtDlpCookies(now)
+			if err != nil {
+				return Result{Status: StatusDown, Message: err.Error()}
+			}
+			result := Result{Status: StatusOK, Details: map[string]any{"jar": jar}}
+			switch {
+			case !jar.Configured:
+				result.Message = "no cookie jar configured"
+			case len(jar.ExpiredDomains) > 0:
+				result.Status = StatusDegraded
+				result.Message = "cookies expired for " + strings.Join(jar.ExpiredDomains, ", ")
+			case jar.EarliestExpiry != nil && jar.EarliestExpiry.Sub(now) < warnWithin:
+				result.Status = StatusDegraded
+				result.Message = "cookies expire " + jar.EarliestExpiry.Format(time.RFC3339)
+			}
+			return result
+		},
+	}
+}
+
+// BrightDataCheck calls the Bright Data API. The fallback is a second chance,
+// so an unreachable API is degraded, never a reason to refuse a type.
+func BrightDataCheck(ping func(ctx context.Context) error) Check {
+	return Check{
+		Name: "brightdata",
+		Run: func(ctx context.Context) Result {
+			if err := ping(ctx); err != nil {
+				return Result{Status: StatusDegraded, Message: utils.TruncateForLog(err.Error(), 200)}
+			}
+			return Result{Status: StatusOK}
+		},
+	}
+}
+
+// QueueLagCheck measures how long the oldest runnable River job has been
+// waiting. Lag past warnAfter is degraded: workers are saturated or stuck,
+// and new captures will sit pending that long before starting.
+func QueueLagCheck(db *gorm.DB, warnAfter time.Duration) Check {
+	return Check{
+		Name: "queue",
+		Run: func(ctx context.Context) Result {
+			now := time.Now()
+			var waiting int64
+			if err := db.WithContext(ctx).Table("river_job").Where("state = ? AND scheduled_at <= ?", "available", now).
+				Count(&waiting).Error; err != nil {
+				return Result{Status: StatusDegraded, Message: "queue query failed"}
+			}
+			// The oldest row rather than MIN(scheduled_at): an aggregate comes
+			// back untyped on some drivers, a plain column never does.
+			var oldest []time.Time
+			if err := db.WithContext(ctx).Table("river_job").Where("state = ? AND scheduled_at <= ?", "available", now).
+				Order("scheduled_at").Limit(1).Pluck("scheduled_at", &oldest).Error; err != nil {
+				return Result{Status: StatusDegraded, Message: "queue query failed"}
+			}
+			var lag time.Duration
+			if len(oldest) == 1 && now.After(oldest[0]) {
+				lag = now.Sub(oldest[0])
+			}
+			result := Result{Status: StatusOK, Details: map[string]any{
+				"waiting_jobs": waiting,
+				"lag_seconds":  int64(lag.Seconds()),
+			}}
+			if warnAfter > 0 && lag > warnAfter {
+				result.Status = StatusDegraded
+				result.Message = fmt.Sprintf("oldest waiting job has been queued for %s", lag.Round(time.Second))
+			}
+			return result
+		},
+	}
+}
@@ -0,0 +1,263 @@
+// Package health runs periodic checks of everything an archive job depends
+// on — extractor binaries, the browser, storage, the cookie jar, the Bright
+// Data API, the job queue — and keeps the latest result of each.
+//
+// The results serve two purposes: /health/detail reports them, and the capture
+// queue asks the monitor which archive types cannot run right now, so a
+// request for one is refused up front instead of being queued to fail three
+// River attempts later.
+package health
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status is the outcome of one check.
+type Status string
+
+const (
+	StatusOK Status = "ok"
+	// StatusDegraded works but needs attention: a stale yt-dlp, cookies about
+	// to expire, a queue falling behind. Archive types are not refused.
+	StatusDegraded Status = "degraded"
+	// StatusDown means the dependency does not work. The check's archive
+	// types are refused until a later run finds it back up.
+	StatusDown Status = "down"
+)
+
+// severity orders statuses so the overall report is the worst of its checks.
+func (s Status) severity() int {
+	switch s {
+	case StatusDown:
+		return 2
+	case StatusDegraded:
+		return 1
+	}
+	return 0
+}
+
+// Result is the latest outcome of one check.
+type Result struct {
+	Name    string         `json:"name"`
+	Status  Status         `json:"status"`
+	Message string         `json:"message,omitempty"`
+	Version string         `json:"version,omitempty"`
+	Details map[string]any `json:"details,omitempty"`
+	// ArchiveTypes are refused while this check is down.
+	ArchiveTypes []string  `json:"archive_types,omitempty"`
+	CheckedAt    time.Time `json:"checked_at"`
+	DurationMS   int64     `json:"duration_ms"`
+}
+
+// Check is one dependency probe. Run fills in Status, Message, Version and
+// Details; the monitor fills in the rest.
+type Check struct {
+	Name string
+	// ArchiveTypes lists the archive types that cannot succeed while this
+	// check is down. Empty for checks that only inform (queue lag, Bright
+	// Data): their failure makes jobs slower or less likely, not impossible.
+	ArchiveTypes []string
+	// Timeout bounds one run; zero uses DefaultCheckTimeout. A run that times
+	// out is reported down.
+	Timeout time.Duration
+	Run     func(ctx context.Context) Result
+}
+
+// DefaultCheckTimeout bounds a check that does not set its own.
+const DefaultCheckTimeout = 30 * time.Second
+
+// Report is what /health/detail serves.
+type Report struct {
+	Status Status `json:"status"`
+	// CheckedAt is when the oldest result was taken; zero before the first
+	// run completes.
+	CheckedAt time.Time `json:"checked_at"`
+	Checks    []Result  `json:"checks"`
+	// UnavailableTypes maps each refused archive type to the reason.
+	UnavailableTypes map[string]string `json:"unavailable_types"`
+}
+
+// Monitor runs a fixed set of checks and holds their latest results.
+type Monitor struct {
+	checks   []Check
+	interval time.Duration
+
+	mu      sync.RWMutex
+	results map[string]Result
+}
+
+// NewMonitor builds a monitor. Nothing runs until RunOnce or Start.
+func NewMonitor(interval time.Duration, checks ...Check) *Monitor {
+	return &Monitor{
+		checks:   checks,
+		interval: interval,
+		results:  make(map[string]Result, len(checks)),
+	}
+}
+
+// RunOnce runs every check concurrently and records the results. It returns
+// once all have finished or timed out.
+func (m *Monitor) RunOnce(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, check := range m.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := runCheck(ctx, check)
+			m.mu.Lock()
+			previous, seen := m.results[check.Name]
+			m.results[check.Name] = result
+			m.mu.Unlock()
+			if !seen || previous.Status != result.Status {
+				logTransition(result)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Start runs the checks every interval until ctx ends. It does not run them
+// immediately; callers that need results before serving call RunOnce first.
+func (m *Monitor) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.RunOnce(ctx)
+			}
+		}
+	}()
+}
+
+// runCheck runs one check under its timeout. A check that panics or outlives
+// its timeout is down: a probe that hangs is as good as a dependency that does.
+func runCheck(ctx context.Context, check Check) Result {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	started := time.Now()
+	done := make(chan Result, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- Result{Status: StatusDown, Message: "check panicked"}
+			}
+		}()
+		done <- check.Run(runCtx)
+	}()
+
+	var result Result
+	select {
+	case result = <-done:
+	case <-runCtx.Done():
+		result = Result{Status: StatusDown, Message: "check timed out after " + timeout.String()}
+	}
+	if result.Status == "" {
+		result.Status = StatusOK
+	}
+	result.Name = check.Name
+	result.ArchiveTypes = check.ArchiveTypes
+	result.CheckedAt = started.UTC()
+	result.DurationMS = time.Since(started).Milliseconds()
+	return result
+}
+
+func logTransition(result Result) {
+	attrs := []any{"check", result.Name, "status", result.Status}
+	if result.Message != "" {
+		attrs = append(attrs, "message", result.Message)
+	}
+	if result.Version != "" {
+		attrs = append(attrs, "version", result.Version)
+	}
+	switch result.Status {
+	case StatusDown:
+		slog.Error("Health check down", attrs...)
+	case StatusDegraded:
+		slog.Warn("Health check degraded", attrs...)
+	default:
+		slog.Info("Health check ok", attrs...)
+	}
+}
+
+// Report returns the latest results in check order.
+func (m *Monitor) Report() Report {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	report := Report{Status: StatusOK, Checks: make([]Result, 0, len(m.checks)), UnavailableTypes: map[string]string{}}
+	for _, check := range m.checks {
+		result, ok := m.results[check.Name]
+		if !ok {
+			continue
+		}
+		report.Checks = append(report.Checks, result)
+		if result.Status.severity() > report.Status.severity() {
+			report.Status = result.Status
+		}
+		if report.CheckedAt.IsZero() || result.CheckedAt.Before(report.CheckedAt) {
+			report.CheckedAt = result.CheckedAt
+		}
+		if result.Status == StatusDown {
+			for _, archiveType := range result.ArchiveTypes {
+				report.UnavailableTypes[archiveType] = joinReason(report.UnavailableTypes[archiveType], result)
+			}
+		}
+	}
+	return report
+}
+
+// Unavailable reports whether archiveType's dependency is down and why. A
+// check that has not run yet counts as up: refusing every request while the
+// first Playwright launch is still in progress would be a self-inflicted
+// outage.
+func (m *Monitor) Unavailable(archiveType string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var reasons []string
+	for _, check := range m.checks {
+		result, ok := m.results[check.Name]
+		if !ok || result.Status != StatusDown {
+			continue
+		}
+		for _, t := range result.ArchiveTypes {
+			if t == archiveType {
+				reasons = append(reasons, describe(result))
+				break
+			}
+		}
+	}
+	if len(reasons) == 0 {
+		return "", false
+	}
+	sort.Strings(reasons)
+	return strings.Join(reasons, "; "), true
+}
+
+func describe(result Result) string {
+	if result.Message == "" {
+		return result.Name + " is down"
+	}
+	return result.Name + ": " + result.Message
+}
+
+func joinReason(existing string, result Result) string {
+	if existing == "" {
+		return describe(result)
+	}
+	return existing + "; " + describe(result)
+}
@@ -0,0 +1,204 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"arker/internal/storage"
+)
+
+func staticCheck(name string, status Status, types ...string) Check {
+	return Check{
+		Name:         name,
+		ArchiveTypes: types,
+		Run: func(context.Context) Result {
+			return Result{Status: status, Message: name + " says " + string(status)}
+		},
+	}
+}
+
+func TestMonitorRefusesOnlyTypesOfDownChecks(t *testing.T) {
+	m := NewMonitor(time.Minute,
+		staticCheck("playwright", StatusDown, "mhtml", "screenshot"),
+		staticCheck("yt-dlp", StatusDegraded, "yt-dlp"),
+		staticCheck("gallery-dl", StatusOK, "gallery-dl"),
+	)
+	if _, down := m.Unavailable("mhtml"); down {
+		t.Fatal("a type was refused before any check ran")
+	}
+
+	m.RunOnce(t.Context())
+
+	if reason, down := m.Unavailable("mhtml"); !down || reason != "playwright: playwright says down" {
+		t.Errorf("mhtml = %q, %v; want refused with the check's message", reason, down)
+	}
+	for _, typ := range []string{"yt-dlp", "gallery-dl", "git"} {
+		if _, down := m.Unavailable(typ); down {
+			t.Errorf("%s refused, but its dependency is not down", typ)
+		}
+	}
+
+	report := m.Report()
+	if report.Status != StatusDown || len(report.Checks) != 3 {
+		t.Fatalf("report = %+v", report)
+	}
+	if report.Checks[0].Name != "playwright" || report.Checks[2].Name != "gallery-dl" {
+		t.Errorf("checks out of registration order: %+v", report.Checks)
+	}
+	if len(report.UnavailableTypes) != 2 || report.UnavailableTypes["screenshot"] == "" {
+		t.Errorf("unavailable types = %v", report.UnavailableTypes)
+	}
+	if report.CheckedAt.IsZero() {
+		t.Error("report has no check time")
+	}
+}
+
+func TestMonitorRecoversWhenTheDependencyComesBack(t *testing.T) {
+	status := StatusDown
+	m := NewMonitor(time.Minute, Check{
+		Name:         "gallery-dl",
+		ArchiveTypes: []string{"gallery-dl"},
+		Run:          func(context.Context) Result { return Result{Status: status} },
+	})
+	m.RunOnce(t.Context())
+	if reason, down := m.Unavailable("gallery-dl"); !down || reason != "gallery-dl is down" {
+		t.Fatalf("gallery-dl = %q, %v; want refused", reason, down)
+	}
+	status = StatusOK
+	m.RunOnce(t.Context())
+	if _, down := m.Unavailable("gallery-dl"); down {
+		t.Error("gallery-dl still refused after its check passed")
+	}
+}
+
+func TestHungOrPanickingCheckIsDown(t *testing.T) {
+	m := NewMonitor(time.Minute,
+		Check{Name: "hang", Timeout: 20 * time.Millisecond, Run: func(ctx context.Context) Result {
+			<-ctx.Done()
+			time.Sleep(50 * time.Millisecond)
+			return Result{Status: StatusOK}
+		}},
+		Check{Name: "panic", Run: func(context.Context) Result { panic("boom") }},
+	)
+	m.RunOnce(t.Context())
+	for _, result := range m.Report().Checks {
+		if result.Status != StatusDown {
+			t.Errorf("%s = %s, want down", result.Name, result.Status)
+		}
+	}
+}
+
+func TestStorageCheckRoundTrips(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	result := runCheck(t.Context(), StorageCheck(store, []string{"mhtml"}))
+	if result.Status != StatusOK {
+		t.Fatalf("storage = %+v", result)
+	}
+	r, err := store.Reader(StorageProbeKey)
+	if err != nil {
+		t.Fatalf("probe object missing: %v", err)
+	}
+	defer r.Close()
+	if data, _ := io.ReadAll(r); len(data) != 32 {
+		t.Errorf("probe = %q, want a 16-byte hex token", data)
+	}
+
+	result = runCheck(t.Context(), StorageCheck(brokenStorage{store}, []string{"mhtml"}))
+	if result.Status != StatusDown || !strings.Contains(result.Message, "open for write") {
+		t.Errorf("broken storage = %+v, want down", result)
+	}
+}
+
+type brokenStorage struct{ storage.Storage }
+
+func (brokenStorage) Writer(string) (io.WriteCloser, error) {
+	return nil, errors.New("read-only file system")
+}
+
+// installTool puts an executable script named name on a private PATH.
+func installTool(t *testing.T, name, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestYtDlpCheckReportsVersionAndStaleness(t *testing.T) {
+	installTool(t, "yt-dlp", "echo 2020.01.02\n")
+
+	result := runCheck(t.Context(), YtDlpCheck([]string{"yt-dlp"}, 0))
+	if result.Status != StatusOK || result.Version != "2020.01.02" || result.Details["released"] != "2020-01-02" {
+		t.Errorf("without a staleness limit = %+v", result)
+	}
+
+	result = runCheck(t.Context(), YtDlpCheck([]string{"yt-dlp"}, 60*24*time.Hour))
+	if result.Status != StatusDegraded || !strings.Contains(result.Message, "days old") {
+		t.Errorf("stale yt-dlp = %+v, want degraded", result)
+	}
+}
+
+func TestCommandCheckDownWhenTheToolFails(t *testing.T) {
+	installTool(t, "gallery-dl", "echo 'ModuleNotFoundError: requests' >&2\nexit 1\n")
+	result := runCheck(t.Context(), CommandCheck("gallery-dl", []string{"gallery-dl"}, "gallery-dl", "--version"))
+	if result.Status != StatusDown || !strings.Contains(result.Message, "ModuleNotFoundError") {
+		t.Errorf("broken gallery-dl = %+v, want down with its stderr", result)
+	}
+	if len(result.ArchiveTypes) != 1 || result.ArchiveTypes[0] != "gallery-dl" {
+		t.Errorf("archive types = %v", result.ArchiveTypes)
+	}
+}
+
+func TestYtDlpReleaseDate(t *testing.T) {
+	for version, want := range map[string]string{
+		"2025.06.30":        "2025-06-30",
+		"2025.06.30.232851": "2025-06-30",
+		" 2024.12.03\n":     "2024-12-03",
+	} {
+		got, ok := YtDlpReleaseDate(version)
+		if !ok || got.Format("2006-01-02") != want {
+			t.Errorf("YtDlpReleaseDate(%q) = %v, %v; want %s", version, got, ok, want)
+		}
+	}
+	if _, ok := YtDlpReleaseDate("1.28.5"); ok {
+		t.Error("a semver version parsed as a release date")
+	}
+}
+
+func TestQueueLagCheck(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec(`CREATE TABLE river_job (id INTEGER PRIMARY KEY, state TEXT, scheduled_at DATETIME)`).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	check := QueueLagCheck(db, 15*time.Minute)
+	if result := runCheck(t.Context(), check); result.Status != StatusOK || result.Details["waiting_jobs"] != int64(0) {
+		t.Errorf("empty queue = %+v", result)
+	}
+
+	now := time.Now()
+	db.Exec(`INSERT INTO river_job (state, scheduled_at) VALUES (?, ?), (?, ?), (?, ?)`,
+		"available", now.Add(-time.Hour),
+		"running", now.Add(-2*time.Hour),
+		"available", now.Add(time.Hour))
+	result := runCheck(t.Context(), check)
+	if result.Status != StatusDegraded || result.Details["waiting_jobs"] != int64(1) {
+		t.Errorf("lagging queue = %+v, want degraded with one runnable job", result)
+	}
+	if lag, _ := result.Details["lag_seconds"].(int64); lag < 3500 {
+		t.Errorf("lag = %d seconds, want about an hour", lag)
+	}
+}
@@ -0,0 +1,247 @@
+// Package manifest describes everything a capture stored, with the size and
+// SHA-256 of each file, and signs the description with the instance's
+// ed25519 key. Anyone holding the public key can then check that a
+// downloaded capture is byte for byte what the archive stored.
+//
+// A signed manifest is a DSSE envelope (the format in-toto and Sigstore use):
+// the manifest JSON is the payload, and the signature covers the payload
+// together with its type, so neither can be swapped on its own.
+package manifest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Version is the manifest format written.
+const Version = 1
+
+// PayloadType identifies a capture manifest inside an envelope.
+const PayloadType = "application/vnd.arker.capture-manifest+json"
+
+// EnvelopeContentType is served for a signed manifest.
+const EnvelopeContentType = "application/vnd.dsse.envelope.v1+json"
+
+// File roles. An artifact is the item's product; the others are stored
+// beside it.
+const (
+	RoleArtifact    = "artifact"
+	RoleMetadata    = "metadata"
+	RoleRawMetadata = "raw-metadata"
+	RoleExtra       = "extra" // a caption track or transcript
+	RoleThumbnail   = "thumbnail"
+	// An incremental git capture stores a delta on top of earlier captures'
+	// layers, and serves the whole repository rebuilt from them. Its
+	// repository file has the delta's key but the rebuilt tar's digest.
+	RoleRepository  = "repository"
+	RoleParentLayer = "parent-layer"
+)
+
+// ErrBadSignature is returned when no signature in an envelope verifies
+// under the key given.
+var ErrBadSignature = errors.New("manifest: signature does not verify")
+
+// Manifest lists what one capture stored.
+type Manifest struct {
+	Version    int       `json:"version"`
+	ShortID    string    `json:"short_id"`
+	URL        string    `json:"url"`
+	CapturedAt time.Time `json:"captured_at"`
+	SignedAt   time.Time `json:"signed_at"`
+	Items      []Item    `json:"items"`
+}
+
+// Item is one completed archive item of the capture.
+type Item struct {
+	Type         string `json:"type"`
+	Completeness string `json:"completeness,omitempty"`
+	Files        []File `json:"files"`
+}
+
+// File is one stored object.
+type File struct {
+	Role   string `json:"role"`
+	Key    string `json:"key"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Match finds the file with the given size and digest. Content, not name,
+// identifies a file: downloads are named for the page, not the storage key.
+func (m *Manifest) Match(size int64, sha256Hex string) (Item, File, bool) {
+	for _, item := range m.Items {
+		for _, f := range item.Files {
+			if f.Size == size && strings.EqualFold(f.SHA256, sha256Hex) {
+				return item, f, true
+			}
+		}
+	}
+	return Item{}, File{}, false
+}
+
+// Keys returns the storage key of every file listed.
+func (m *Manifest) Keys() []string {
+	var keys []string
+	for _, item := range m.Items {
+		for _, f := range item.Files {
+			keys = append(keys, f.Key)
+		}
+	}
+	return keys
+}
+
+// Hash reads r to the end and returns its size and hex SHA-256.
+func Hash(r io.Reader) (int64, string, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return n, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Envelope is a DSSE envelope. Payload and Sig are base64 in JSON.
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     []byte      `json:"payload"`
+	Signatures  []Signature `json:"signatures"`
+}
+
+// Signature is one signature over an envelope's payload.
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   []byte `json:"sig"`
+}
+
+// pae is DSSE's pre-authentication encoding, the bytes actually signed.
+func pae(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// KeyID names a public key: the first 16 hex digits of its SHA-256.
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Signer signs manifests with one instance key.
+type Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+// NewSigner returns a signer for key.
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{key: key, keyID: KeyID(key.Public().(ed25519.PublicKey))}
+}
+
+// PublicKey is the key signatures verify under.
+func (s *Signer) PublicKey() ed25519.PublicKey { return s.key.Public().(ed25519.PublicKey) }
+
+// KeyID names the signer's key.
+func (s *Signer) KeyID() string { return s.keyID }
+
+// Sign encodes m and returns it as a signed envelope in JSON.
+func (s *Signer) Sign(m *Manifest) ([]byte, error) {
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(Envelope{
+		PayloadType: PayloadType,
+		Payload:     payload,
+		Signatures:  []Signature{{KeyID: s.keyID, Sig: ed25519.Sign(s.key, pae(PayloadType, payload))}},
+	}, "", "  ")
+}
+
+// Open checks a signed envelope against pub and returns the manifest in it.
+func Open(envelopeJSON []byte, pub ed25519.PublicKey) (*Manifest, error) {
+	var env Envelope
+	if err := json.Unmarshal(envelopeJSON, &env); err != nil {
+		return nil, fmt.Errorf("manifest: reading envelope: %w", err)
+	}
+	if env.PayloadType != PayloadType {
+		return nil, fmt.Errorf("manifest: envelope holds %q, not a capture manifest", env.PayloadType)
+	}
+	signed := pae(env.PayloadType, env.Payload)
+	verified := false
+	for _, sig := range env.Signatures {
+		if ed25519.Verify(pub, signed, sig.Sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrBadSignature
+	}
+	var m Manifest
+	if err := json.Unmarshal(env.Payload, &m); err != nil {
+		return nil, fmt.Errorf("manifest: reading payload: %w", err)
+	}
+	return &m, nil
+}
+
+// GenerateKey returns a new private key in the form ParsePrivateKey reads.
+func GenerateKey() (string, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key.Seed()), nil
+}
+
+// ParsePrivateKey reads a base64 ed25519 key: the 32-byte seed or the
+// 64-byte private key.
+func ParsePrivateKey(encoded string) (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("manifest: private key is not base64: %w", err)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	}
+	return nil, fmt.Errorf("manifest: private key is %d bytes, want %d or %d", len(raw), ed25519.SeedSize, ed25519.PrivateKeySize)
+}
+
+// PublicKeyDocument is how an instance publishes its key.
+type PublicKeyDocument struct {
+	KeyID     string `json:"keyid"`
+	Algorithm string `json:"algorithm"`
+	PublicKey []byte `json:"public_key"`
+}
+
+// NewPublicKeyDocument describes pub.
+func NewPublicKeyDocument(pub ed25519.PublicKey) PublicKeyDocument {
+	return PublicKeyDocument{KeyID: KeyID(pub), Algorithm: "ed25519", PublicKey: pub}
+}
+
+// ParsePublicKey reads a public key as published (a PublicKeyDocument) or
+// as bare base64.
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	raw := []byte(nil)
+	var doc PublicKeyDocument
+	if err := json.Unmarshal(data, &doc); err == nil {
+		if doc.Algorithm != "" && doc.Algorithm != "ed25519" {
+			return nil, fmt.Errorf("manifest: key algorithm %q is not ed25519", doc.Algorithm)
+		}
+		raw = doc.PublicKey
+	} else if raw, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(data))); err != nil {
+		return nil, fmt.Errorf("manifest: public key is neither a key document nor base64")
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("manifest: public key is %d bytes, want %d", len(raw), ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(raw), nil
+}
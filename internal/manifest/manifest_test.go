@@ -0,0 +1,96 @@
+package manifest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testManifest() *Manifest {
+	return &Manifest{
+		Version:    Version,
+		ShortID:    "abc12",
+		URL:        "https://example.com/post",
+		CapturedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		SignedAt:   time.Date(2024, 1, 1, 0, 5, 0, 0, time.UTC),
+		Items: []Item{{Type: "mhtml", Files: []File{
+			{Role: RoleArtifact, Key: "abc12/mhtml-00.mhtml", Size: 5, SHA256: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		}}},
+	}
+}
+
+func TestSignAndOpen(t *testing.T) {
+	seed, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParsePrivateKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := NewSigner(key)
+	envelope, err := signer.Sign(testManifest())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Open(envelope, signer.PublicKey())
+	if err != nil {
+		t.Fatalf("Open = %v", err)
+	}
+	if m.ShortID != "abc12" || len(m.Keys()) != 1 {
+		t.Errorf("manifest = %+v", m)
+	}
+	size, digest, _ := Hash(strings.NewReader("hello"))
+	if item, file, ok := m.Match(size, digest); !ok || item.Type != "mhtml" || file.Role != RoleArtifact {
+		t.Errorf("Match = %v %v %v", item, file, ok)
+	}
+	if _, _, ok := m.Match(size, strings.Repeat("0", 64)); ok {
+		t.Error("a different digest matched")
+	}
+
+	var env Envelope
+	json.Unmarshal(envelope, &env)
+	if env.Signatures[0].KeyID != KeyID(signer.PublicKey()) || len(env.Signatures[0].KeyID) != 16 {
+		t.Errorf("keyid = %q", env.Signatures[0].KeyID)
+	}
+	env.Payload = bytes.Replace(env.Payload, []byte(`"size":5`), []byte(`"size":6`), 1)
+	tampered, _ := json.Marshal(env)
+	if _, err := Open(tampered, signer.PublicKey()); err != ErrBadSignature {
+		t.Errorf("tampered payload = %v", err)
+	}
+
+	other, _, _ := ed25519.GenerateKey(nil)
+	if _, err := Open(envelope, other); err != ErrBadSignature {
+		t.Errorf("other key = %v", err)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	for _, encoded := range []string{
+		base64.StdEncoding.EncodeToString(priv.Seed()),
+		base64.StdEncoding.EncodeToString(priv) + "\n",
+	} {
+		if key, err := ParsePrivateKey(encoded); err != nil || !key.Equal(priv) {
+			t.Errorf("ParsePrivateKey = %v", err)
+		}
+	}
+	if _, err := ParsePrivateKey("c2hvcnQ="); err == nil {
+		t.Error("short private key accepted")
+	}
+
+	doc, _ := json.Marshal(NewPublicKeyDocument(pub))
+	for _, data := range [][]byte{doc, []byte(base64.StdEncoding.EncodeToString(pub))} {
+		if key, err := ParsePublicKey(data); err != nil || !key.Equal(pub) {
+			t.Errorf("ParsePublicKey(%s) = %v", data, err)
+		}
+	}
+	if _, err := ParsePublicKey([]byte(`{"algorithm":"rsa","public_key":"AAAA"}`)); err == nil {
+		t.Error("non-ed25519 key accepted")
+	}
+}
@@ -78,6 +78,10 @@ type ArchiveItem struct {
 	StorageKey string
 	Extension  string // .webp, .mhtml, .tar.zst, .mp4, etc.
 	FileSize   int64  // file size in bytes
+	// Checksum is the hex SHA-256 of the object at StorageKey, taken from the
+	// bytes as they were written. Empty for items stored before checksums
+	// were kept; the first fixity audit fills it in from what it reads.
+	Checksum string
 	// MetadataKey points at a stable normalized JSON sidecar. RawMetadataKey
 	// points at the sanitized extractor/provider record used to build it. Both
 	// are empty for archive types without sidecars and for older video captures;
@@ -115,8 +119,94 @@ type ArchiveItem struct {
 	ThumbnailWidth  int
 	ThumbnailHeight int
 	ThumbnailStatus string `gorm:"index"` // "" | pending | ready | unavailable
+
+	// QualityPolicy is the utils.VideoQuality the item was requested with, as
+	// JSON. Empty is the default best-available policy, and is what every
+	// type other than yt-dlp and playlist always stores.
+	QualityPolicy string
+}
+
+// FixityAudit is one re-read of an item's stored objects, each checked
+// against the size and checksum recorded when it was written (or, for the
+// files beside the artifact, first audited). Rows are kept, so an item's
+// history shows when damage first appeared; the newest row per item is its
+// current standing. A failing row describes the first object that failed; a
+// passing one describes the artifact.
+type FixityAudit struct {
+	gorm.Model
+	ArchiveItemID uint `gorm:"index;not null"`
+	// StorageKey is the object the row describes, and Role its manifest role
+	// (artifact, metadata, thumbnail, ...). Empty on rows from before the
+	// files beside the artifact were audited.
+	StorageKey string
+	Role       string
+	// ItemKey is the item's StorageKey at the time, which a recapture later
+	// replaces along with every file beside it. Empty on older rows, whose
+	// StorageKey is always the item's.
+	ItemKey          string
+	Status           string `gorm:"index"`
+	ExpectedSize     int64
+	ActualSize       int64
+	ExpectedChecksum string
+	ActualChecksum   string
+	Error            string
+	DurationMs       int64
+}
+
+// Fixity audit status values for FixityAudit.Status.
+const (
+	FixityStatusOK = "ok"
+	// FixityStatusBaselined is an item with no recorded checksum whose size
+	// matched; the checksum read was adopted.
+	FixityStatusBaselined        = "baselined"
+	FixityStatusMissing          = "missing"
+	FixityStatusSizeMismatch     = "size_mismatch"
+	FixityStatusChecksumMismatch = "checksum_mismatch"
+	// FixityStatusError is a read that failed for another reason, such as a
+	// storage outage. It says nothing about the object and is retried on the
+	// next pass.
+	FixityStatusError = "error"
+)
+
+// FixityBaseline is the size and checksum the first audit read for a stored
+// object that records none of its own: a metadata sidecar, thumbnail,
+// caption track or git parent layer. Later audits hold the object to it.
+// Objects are never rewritten, so one row per key serves every item sharing
+// it.
+type FixityBaseline struct {
+	gorm.Model
+	StorageKey string `gorm:"uniqueIndex;not null"`
+	Size       int64
+	Checksum   string
+}
+
+// StorageReplica is the state of one stored object on one storage backend,
+// when replicated storage is configured. Backend is the backend's name (its
+// location, without credentials), so renaming a bucket starts its rows over.
+type StorageReplica struct {
+	gorm.Model
+	ObjectKey string `gorm:"uniqueIndex:idx_storage_replicas_object_backend;not null"`
+	Backend   string `gorm:"uniqueIndex:idx_storage_replicas_object_backend;not null"`
+	Status    string `gorm:"index"`
+	Size      int64
+	// Error is why the last copy to this backend, or read from it, failed.
+	Error string
+	// Attempts counts failed repairs, so the ones that keep failing go last.
+	Attempts   int
+	VerifiedAt *time.Time
 }
 
+// Replica status values for StorageReplica.Status.
+const (
+	ReplicaStatusOK = "ok"
+	// ReplicaStatusPending is a copy not made yet: the write to this backend
+	// failed, or the object predates the backend.
+	ReplicaStatusPending = "pending"
+	// ReplicaStatusMissing is a copy that was there and is gone: a read found
+	// the object absent.
+	ReplicaStatusMissing = "missing"
+)
+
 // Archive item source values for ArchiveItem.Source.
 const (
 	ArchiveSourceNative     = "native"
@@ -169,3 +259,210 @@ type ArchiveItemLog struct {
 	Chunk         string      `gorm:"type:text;not null"`
 	CreatedAt     time.Time   `gorm:"not null"`
 }
+
+// CookieJar is one platform account's cookies.txt, uploaded from the admin
+// cookie jar page and handed to yt-dlp and gallery-dl for URLs on Host.
+// Several enabled jars for one host are used in rotation, least recently used
+// first, so one account's rate limit or checkpoint does not stall the rest.
+//
+// Content is sealed with AES-GCM under COOKIE_JAR_KEY: a database dump or
+// backup must not be a set of working logins. Everything else on the row is
+// derived from the plaintext at upload time so the admin page can show it
+// without decrypting.
+type CookieJar struct {
+	gorm.Model
+	// Host is a bare domain ("instagram.com"); it covers its subdomains.
+	Host  string `gorm:"index;not null"`
+	Label string `gorm:"not null"`
+	// Sealed is nonce || AES-GCM ciphertext, with Host as additional data so
+	// a row copied onto another host fails to open.
+	Sealed      []byte `gorm:"not null"`
+	Enabled     bool   `gorm:"default:true"`
+	CookieCount int
+	// LoginCookie names the recognized login cookie, empty when none was
+	// found. LoginExpiresAt is its expiry; nil for a browser-session cookie
+	// or when there is no login cookie.
+	LoginCookie    string
+	LoginExpiresAt *time.Time
+	LastUsedAt     *time.Time
+	UseCount       int64
+}
+
+// PlaylistEntry is one video of a playlist capture, in listing order. Each
+// entry owns a child capture of its video: a full capture queued for it, or an
+// alias of an existing capture when the video was already archived. The
+// playlist capture's own "playlist" item only records the listing; the videos
+// live on the children.
+type PlaylistEntry struct {
+	gorm.Model
+	PlaylistCaptureID uint `gorm:"index:idx_playlist_entries_capture_position,priority:1;not null"`
+	// Position counts from 1, as the platform numbers the playlist.
+	Position int    `gorm:"index:idx_playlist_entries_capture_position,priority:2"`
+	URL      string `gorm:"not null"`
+	// VideoID is the platform's ID for the video, as yt-dlp reports it.
+	VideoID         string
+	Title           string
+	DurationSeconds float64
+	ChildCaptureID  uint    `gorm:"index;not null"`
+	ChildCapture    Capture `gorm:"foreignKey:ChildCaptureID"`
+}
+
+// GitSubmodule is one submodule of a git capture. Each owns a child capture
+// of the submodule's repository: a git capture queued for it, or an alias of
+// one already made since the capture it descends from began, which is also
+// what ends submodule cycles.
+type GitSubmodule struct {
+	gorm.Model
+	ParentCaptureID uint   `gorm:"uniqueIndex:idx_git_submodules_parent_path,priority:1;not null"`
+	Path            string `gorm:"uniqueIndex:idx_git_submodules_parent_path,priority:2;not null"`
+	URL             string `gorm:"not null"`
+	// Commit is the commit the parent repository pins.
+	Commit         string
+	ChildCaptureID uint    `gorm:"index;not null"`
+	ChildCapture   Capture `gorm:"foreignKey:ChildCaptureID"`
+}
+
+// GitExport is a download generated from a git capture the first time it is
+// asked for and kept in storage after: a bundle of the whole repository, or
+// a source archive of one branch, tag or commit. Like an HLS package it is
+// derived, not an archive item of its own. A row is written only once the
+// file is fully stored, so a row always names a complete file.
+type GitExport struct {
+	gorm.Model
+	ArchiveItemID uint `gorm:"uniqueIndex:idx_git_exports_item_kind_ref,priority:1;not null"`
+	// Kind is "bundle", "tar.gz" or "zip".
+	Kind string `gorm:"uniqueIndex:idx_git_exports_item_kind_ref,priority:2;not null"`
+	// Ref is the full hash of a source archive's commit, or a branch or tag
+	// name in an alias row sharing that archive's StorageKey. Empty for a
+	// bundle.
+	Ref string `gorm:"uniqueIndex:idx_git_exports_item_kind_ref,priority:3"`
+	// Commit is the commit Ref resolved to.
+	Commit     string
+	StorageKey string `gorm:"not null"`
+	Size       int64
+}
+
+// CaptureManifest is a signed list of what a capture stored: every completed
+// item's artifact and sidecars, each with its size and SHA-256 as read back
+// from storage. The signed envelope is itself stored, append-only like the
+// artifacts. A capture whose items change afterwards (a failed item retried)
+// is signed again; the newest row is the one served.
+type CaptureManifest struct {
+	gorm.Model
+	CaptureID  uint   `gorm:"index;not null"`
+	StorageKey string `gorm:"not null"`
+	// KeyID names the key it was signed with (manifest.KeyID).
+	KeyID      string
+	FileCount  int
+	TotalBytes int64
+}
+
+// CaptureTimestamp is an RFC 3161 timestamp over a capture manifest: a
+// time-stamping authority's signed word that the manifest, byte for byte as
+// stored, existed at Time. The TSA's reply is stored beside the manifest;
+// the row is written only once the reply has verified, so Time is trusted.
+type CaptureTimestamp struct {
+	gorm.Model
+	CaptureManifestID uint   `gorm:"uniqueIndex;not null"`
+	CaptureID         uint   `gorm:"index;not null"`
+	StorageKey        string `gorm:"not null"`
+	TSAURL            string
+	// TSAName is the authority as its token names it.
+	TSAName      string
+	Time         time.Time
+	SerialNumber string
+}
+
+// HLSPackage is the adaptive-streaming copy of an archived video: fMP4
+// segments and playlists cut from the stored MP4 after it completed. The MP4
+// stays the archive of record; this is a serving format derived from it, and
+// like a thumbnail it is not an archive item of its own.
+//
+// A row is written once the package is fully stored (Status ready), or when
+// the video can never be packaged (Status unavailable). No row means not
+// attempted yet, or too short to be worth it.
+type HLSPackage struct {
+	gorm.Model
+	ArchiveItemID uint `gorm:"uniqueIndex;not null"`
+	Status        string
+	// KeyPrefix is the storage prefix every file sits under, ending in "/":
+	// the item's key base plus a per-attempt nonce. Files are addressed by
+	// their path in the package, e.g. KeyPrefix + "source/index.m3u8".
+	KeyPrefix string
+	// Renditions is the comma-separated rendition directories, master
+	// playlist order ("source,480p"). Serving only answers for these.
+	Renditions   string
+	SegmentCount int
+	TotalBytes   int64
+	Detail       string
+	// DurationSeconds is the video's length on a skipped row, so lowering
+	// HLS_MIN_DURATION can tell which skipped videos now qualify.
+	DurationSeconds float64
+}
+
+// HLS package status values for HLSPackage.Status. A skipped video was
+// shorter than the minimum when it was evaluated.
+const (
+	HLSStatusReady       = "ready"
+	HLSStatusUnavailable = "unavailable"
+	HLSStatusSkipped     = "skipped"
+)
+
+// FeedSubscription is an RSS, Atom or JSON Feed URL that is polled on a
+// schedule; every entry it publishes is captured once. ETag and LastModified
+// are the validators of the last complete poll, sent back as a conditional
+// GET so an unchanged feed costs a 304.
+type FeedSubscription struct {
+	gorm.Model
+	URL   string `gorm:"unique;not null"`
+	Title string
+	// Interval is how often the feed is polled; zero uses the configured
+	// default.
+	Interval time.Duration
+	Enabled  bool `gorm:"default:true"`
+	// CaptureExisting is false when the entries already in the feed at its
+	// first poll were only marked seen: a subscription to a long-running blog
+	// follows it from now on instead of capturing its whole front page.
+	CaptureExisting bool
+	ETag            string
+	LastModified    string
+	LastPolledAt    *time.Time
+	// LastSuccessAt is the last poll that fetched and recorded the feed; nil
+	// until the first one, which is the poll CaptureExisting applies to.
+	LastSuccessAt *time.Time
+	// LastError is the last poll's failure, empty once a poll succeeds.
+	LastError  string
+	EntryCount int
+}
+
+// FeedEntry is one entry of a subscribed feed, recorded the first time a poll
+// sees its GUID. The row is the feed's seen-GUID set: an entry that has one
+// is never captured again, whatever the feed later does to its link or text.
+type FeedEntry struct {
+	gorm.Model
+	FeedSubscriptionID uint   `gorm:"uniqueIndex:idx_feed_entries_feed_guid,priority:1;not null"`
+	GUID               string `gorm:"uniqueIndex:idx_feed_entries_feed_guid,priority:2;not null"`
+	Title              string
+	Link               string
+	Summary            string `gorm:"type:text"`
+	PublishedAt        *time.Time
+	// ShortID is the capture of Link; empty when the entry has no link, when
+	// it was only marked seen, or until queueing it succeeds.
+	ShortID string
+	// QueueError is the last failure to queue a capture of the link or an
+	// enclosure. Entries with one are retried by the next poll that fetches
+	// the feed; the others never are.
+	QueueError string
+	Enclosures []FeedEnclosure `gorm:"foreignKey:FeedEntryID"`
+}
+
+// FeedEnclosure is one attachment of a feed entry (a podcast episode's audio
+// file), captured separately from the entry's page.
+type FeedEnclosure struct {
+	gorm.Model
+	FeedEntryID uint   `gorm:"index;not null"`
+	URL         string `gorm:"not null"`
+	Type        string
+	Length      int64
+	ShortID     string
+}
@@ -0,0 +1,274 @@
+package reader
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// renderMarkdown converts sanitized article markup to CommonMark. It only
+// has to handle the elements sanitize keeps.
+func renderMarkdown(root *html.Node) string {
+	var w markdownWriter
+	w.blocks(root, "")
+	return strings.TrimSpace(w.b.String()) + "\n"
+}
+
+type markdownWriter struct {
+	b strings.Builder
+}
+
+// blocks writes the block-level children of n, each prefixed by indent on
+// every line (for list items and quotes).
+func (w *markdownWriter) blocks(n *html.Node, indent string) {
+	var inline []*html.Node
+	flush := func() {
+		if text := tidyInline(w.inlineText(inline)); text != "" {
+			w.paragraph(indent, text)
+		}
+		inline = nil
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && isMarkdownBlock(c.DataAtom) {
+			flush()
+			w.block(c, indent)
+			continue
+		}
+		inline = append(inline, c)
+	}
+	flush()
+}
+
+func isMarkdownBlock(a atom.Atom) bool {
+	switch a {
+	case atom.P, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Ul, atom.Ol,
+		atom.Blockquote, atom.Pre, atom.Hr, atom.Table, atom.Figure, atom.Dl, atom.Li,
+		atom.Figcaption, atom.Div:
+		return true
+	}
+	return false
+}
+
+func (w *markdownWriter) paragraph(indent, text string) {
+	for _, line := range strings.Split(text, "\n") {
+		w.b.WriteString(strings.TrimRight(indent+line, " "))
+		w.b.WriteByte('\n')
+	}
+	w.b.WriteString(strings.TrimRight(indent, " "))
+	w.b.WriteByte('\n')
+}
+
+func (w *markdownWriter) block(n *html.Node, indent string) {
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		if text := collapseSpace(w.inline(n)); text != "" {
+			w.paragraph(indent, strings.Repeat("#", level)+" "+text)
+		}
+	case atom.Ul, atom.Ol:
+		number := 1
+		for li := n.FirstChild; li != nil; li = li.NextSibling {
+			if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+				continue
+			}
+			marker := "- "
+			if n.DataAtom == atom.Ol {
+				marker = fmt.Sprintf("%d. ", number)
+				number++
+			}
+			w.listItem(li, indent, marker)
+		}
+		w.b.WriteString(strings.TrimRight(indent, " ") + "\n")
+	case atom.Blockquote:
+		w.blocks(n, indent+"> ")
+	case atom.Pre:
+		code := textContent(n)
+		fence := "```"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		w.paragraph(indent, fence+"\n"+strings.TrimRight(code, "\n")+"\n"+fence)
+	case atom.Hr:
+		w.paragraph(indent, "---")
+	case atom.Table:
+		w.table(n, indent)
+	case atom.Dl:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			text := collapseSpace(w.inline(c))
+			if c.DataAtom == atom.Dt {
+				text = "**" + text + "**"
+			}
+			w.paragraph(indent, text)
+		}
+	default:
+		// p, figure, figcaption, div and stray li: their content in order.
+		w.blocks(n, indent)
+	}
+}
+
+// listItem writes one item, its first line after the marker and everything
+// else indented under it, so nested lists and paragraphs stay inside.
+func (w *markdownWriter) listItem(li *html.Node, indent, marker string) {
+	var item markdownWriter
+	item.blocks(li, "")
+	lines := strings.Split(strings.TrimSpace(item.b.String()), "\n")
+	pad := strings.Repeat(" ", len(marker))
+	for i, line := range lines {
+		prefix := indent + pad
+		if i == 0 {
+			prefix = indent + marker
+		}
+		if line == "" {
+			prefix = strings.TrimRight(indent, " ")
+		}
+		w.b.WriteString(prefix + line + "\n")
+	}
+}
+
+func (w *markdownWriter) table(n *html.Node, indent string) {
+	var rows [][]string
+	walk(n, func(c *html.Node) bool {
+		if c.Type != html.ElementNode || c.DataAtom != atom.Tr {
+			return true
+		}
+		var row []string
+		for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+			if cell.Type == html.ElementNode && (cell.DataAtom == atom.Td || cell.DataAtom == atom.Th) {
+				row = append(row, strings.ReplaceAll(collapseSpace(w.inline(cell)), "|", `\|`))
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+		return false
+	})
+	if len(rows) == 0 {
+		return
+	}
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	var lines []string
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", columns))
+		}
+	}
+	w.paragraph(indent, strings.Join(lines, "\n"))
+}
+
+func (w *markdownWriter) inline(n *html.Node) string {
+	var children []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		children = append(children, c)
+	}
+	return w.inlineText(children)
+}
+
+// inlineText renders a run of inline nodes. Block elements nested where
+// inline content is expected (a paragraph in a table cell) are flattened.
+func (w *markdownWriter) inlineText(nodes []*html.Node) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		switch n.Type {
+		case html.TextNode:
+			b.WriteString(escapeMarkdown(strings.Join(strings.Fields(n.Data), " "), n.Data))
+		case html.ElementNode:
+			b.WriteString(w.inlineElement(n))
+		}
+	}
+	return b.String()
+}
+
+func (w *markdownWriter) inlineElement(n *html.Node) string {
+	inner := func() string { return strings.TrimSpace(w.inline(n)) }
+	switch n.DataAtom {
+	case atom.Br:
+		return "\\\n"
+	case atom.Strong, atom.B:
+		return wrapInline("**", inner())
+	case atom.Em, atom.I, atom.Cite:
+		return wrapInline("_", inner())
+	case atom.Del, atom.S:
+		return wrapInline("~~", inner())
+	case atom.Code:
+		code := textContent(n)
+		fence := "`"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		return fence + code + fence
+	case atom.A:
+		text := inner()
+		href := attr(n, "href")
+		if href == "" {
+			return text
+		}
+		if text == "" {
+			text = href
+		}
+		return "[" + text + "](" + markdownURL(href) + ")"
+	case atom.Img:
+		return "![" + escapeMarkdown(attr(n, "alt"), "") + "](" + markdownURL(attr(n, "src")) + ")"
+	default:
+		text := w.inline(n)
+		if isMarkdownBlock(n.DataAtom) {
+			return " " + strings.TrimSpace(text) + " "
+		}
+		return text
+	}
+}
+
+var (
+	repeatedSpaces = regexp.MustCompile(` {2,}`)
+	spacedBreaks   = regexp.MustCompile(` *\n *`)
+)
+
+// tidyInline collapses the spacing left where inline elements and text nodes
+// meet.
+func tidyInline(text string) string {
+	text = repeatedSpaces.ReplaceAllString(text, " ")
+	return strings.TrimSpace(spacedBreaks.ReplaceAllString(text, "\n"))
+}
+
+func wrapInline(marker, text string) string {
+	if text == "" {
+		return ""
+	}
+	return marker + text + marker
+}
+
+// escapeMarkdown escapes the characters that would turn prose into markup,
+// restoring the single spaces around the text that collapsing removed.
+func escapeMarkdown(text, original string) string {
+	var b strings.Builder
+	if original != "" && strings.TrimLeft(original, " \t\r\n") != original {
+		b.WriteByte(' ')
+	}
+	for _, r := range text {
+		switch r {
+		case '\\', '`', '*', '_', '[', ']', '<', '>', '#':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	if original != "" && text != "" && strings.TrimRight(original, " \t\r\n") != original {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+func markdownURL(u string) string {
+	return strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29").Replace(u)
+}
@@ -0,0 +1,862 @@
+// Package reader extracts the article text of a captured page: the part a
+// person came to read, without navigation, comments, advertising or script.
+//
+// It is a compact implementation of the readability heuristics browsers use
+// for their reader modes. Block elements are scored by the amount of prose
+// they hold, scores propagate to their ancestors, and the best ancestor plus
+// its related siblings is kept. It runs on markup alone, so the same code
+// serves a live Playwright page and an MHTML snapshot stored years ago.
+package reader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Article is the normalized reader-mode record of one page.
+type Article struct {
+	// Readable is false when no part of the page holds enough prose to be
+	// an article: a search page, a login wall, an app shell. The page
+	// metadata is still filled in as far as it goes.
+	Readable  bool   `json:"readable"`
+	Title     string `json:"title,omitempty"`
+	Byline    string `json:"byline,omitempty"`
+	SiteName  string `json:"site_name,omitempty"`
+	Published string `json:"published,omitempty"` // RFC 3339 when the page's date parses, else as stated
+	LeadImage string `json:"lead_image,omitempty"`
+	Excerpt   string `json:"excerpt,omitempty"`
+	Language  string `json:"language,omitempty"`
+	WordCount int    `json:"word_count"`
+	// HTML is the article body reduced to structural markup: headings,
+	// paragraphs, lists, quotes, code, tables, figures and absolute links and
+	// image sources. No scripts, styles, classes or event attributes survive,
+	// so it is safe to embed.
+	HTML     string `json:"html,omitempty"`
+	Markdown string `json:"markdown,omitempty"`
+	// Source says what the text was extracted from: SourcePage or
+	// SourceMHTML.
+	Source      string `json:"source"`
+	ExtractedAt string `json:"extracted_at"`
+}
+
+// Extraction sources for Article.Source.
+const (
+	SourcePage  = "page"
+	SourceMHTML = "mhtml"
+)
+
+// minReadableWords is the least prose an article can hold. Below it the
+// "article" is a caption, a cookie notice or a list of links.
+const minReadableWords = 80
+
+// Extract parses an HTML document and returns its article. pageURL resolves
+// relative links and images; source is recorded as Article.Source.
+func Extract(doc io.Reader, pageURL, source string) (*Article, error) {
+	root, err := html.Parse(doc)
+	if err != nil {
+		return nil, fmt.Errorf("reader: parsing document: %w", err)
+	}
+	base, _ := url.Parse(pageURL)
+	if href := findBaseHref(root); href != "" && base != nil {
+		if resolved, err := base.Parse(href); err == nil {
+			base = resolved
+		}
+	}
+
+	meta := collectMetadata(root)
+	article := &Article{
+		Title:       meta.title(),
+		Byline:      meta.byline,
+		SiteName:    meta.siteName,
+		Published:   normalizeDate(meta.published),
+		Excerpt:     meta.description,
+		Language:    meta.language,
+		Source:      source,
+		ExtractedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if meta.image != "" {
+		article.LeadImage = resolveURL(base, meta.image, false)
+	}
+
+	body := findFirst(root, atom.Body)
+	if body == nil {
+		return article, nil
+	}
+	prune(body)
+	content := assemble(topCandidate(body))
+	cleaned := sanitize(content, base)
+	removeTitleHeading(cleaned, article.Title)
+
+	text := collapseSpace(textContent(cleaned))
+	article.WordCount = len(strings.Fields(text))
+	if article.WordCount < minReadableWords {
+		return article, nil
+	}
+	article.Readable = true
+
+	var out bytes.Buffer
+	for c := cleaned.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&out, c); err != nil {
+			return nil, fmt.Errorf("reader: rendering article: %w", err)
+		}
+	}
+	article.HTML = strings.TrimSpace(out.String())
+	article.Markdown = renderMarkdown(cleaned)
+	if article.Excerpt == "" {
+		article.Excerpt = firstParagraph(cleaned)
+	}
+	if article.LeadImage == "" {
+		if img := findFirst(cleaned, atom.Img); img != nil {
+			article.LeadImage = attr(img, "src")
+		}
+	}
+	return article, nil
+}
+
+// --- metadata -------------------------------------------------------------
+
+type pageMetadata struct {
+	metaTitle, jsonTitle, docTitle, heading string
+	byline, siteName, published             string
+	image, description, language            string
+}
+
+func (m pageMetadata) title() string {
+	for _, title := range []string{m.metaTitle, m.jsonTitle, cleanDocumentTitle(m.docTitle), m.heading} {
+		if title = collapseSpace(title); title != "" {
+			return title
+		}
+	}
+	return ""
+}
+
+// cleanDocumentTitle drops a " | Site Name" style suffix from a <title>, but
+// only when what is left still reads like a headline.
+func cleanDocumentTitle(title string) string {
+	title = collapseSpace(title)
+	for _, sep := range []string{" | ", " - ", " — ", " – ", " :: ", " · "} {
+		if i := strings.LastIndex(title, sep); i > 0 {
+			if head := strings.TrimSpace(title[:i]); len(strings.Fields(head)) >= 3 {
+				return head
+			}
+		}
+	}
+	return title
+}
+
+var articleTypes = map[string]bool{
+	"Article": true, "NewsArticle": true, "BlogPosting": true, "Report": true,
+	"ScholarlyArticle": true, "TechArticle": true, "OpinionNewsArticle": true,
+	"AnalysisNewsArticle": true, "ReportageNewsArticle": true, "SocialMediaPosting": true,
+}
+
+func collectMetadata(root *html.Node) pageMetadata {
+	var m pageMetadata
+	metas := map[string]string{}
+	var bylineNode string
+	walk(root, func(n *html.Node) bool {
+		if n.Type != html.ElementNode {
+			return true
+		}
+		switch n.DataAtom {
+		case atom.Html:
+			m.language = attr(n, "lang")
+		case atom.Title:
+			if m.docTitle == "" {
+				m.docTitle = textContent(n)
+			}
+		case atom.Meta:
+			key := strings.ToLower(attr(n, "property"))
+			if key == "" {
+				key = strings.ToLower(attr(n, "name"))
+			}
+			if key == "" {
+				key = strings.ToLower(attr(n, "itemprop"))
+			}
+			if content := strings.TrimSpace(attr(n, "content")); key != "" && content != "" {
+				if _, seen := metas[key]; !seen {
+					metas[key] = content
+				}
+			}
+		case atom.Script:
+			if strings.EqualFold(attr(n, "type"), "application/ld+json") {
+				m.applyJSONLD(textContent(n))
+			}
+			return false
+		case atom.H1:
+			if m.heading == "" {
+				m.heading = textContent(n)
+			}
+		case atom.Time:
+			if m.published == "" && strings.EqualFold(attr(n, "itemprop"), "datePublished") {
+				m.published = attr(n, "datetime")
+			}
+		}
+		if bylineNode == "" && isBylineNode(n) {
+			if text := collapseSpace(textContent(n)); text != "" && len(text) < 100 {
+				bylineNode = text
+			}
+		}
+		return true
+	})
+
+	m.metaTitle = firstNonEmpty(metas["og:title"], metas["twitter:title"], metas["dc.title"])
+	m.byline = firstNonEmpty(m.byline, metas["author"], metas["article:author"], metas["dc.creator"], bylineNode)
+	if strings.HasPrefix(m.byline, "http://") || strings.HasPrefix(m.byline, "https://") {
+		// article:author is often a profile URL, which is not a name.
+		m.byline = bylineNode
+	}
+	m.siteName = firstNonEmpty(metas["og:site_name"], m.siteName, metas["application-name"])
+	m.published = firstNonEmpty(metas["article:published_time"], m.published, metas["datepublished"],
+		metas["date"], metas["dc.date"], metas["publish-date"])
+	m.image = firstNonEmpty(metas["og:image"], metas["og:image:url"], metas["twitter:image"], m.image)
+	m.description = firstNonEmpty(metas["og:description"], metas["description"], metas["twitter:description"])
+	return m
+}
+
+var bylinePattern = regexp.MustCompile(`(?i)byline|author|writtenby|p-author`)
+
+func isBylineNode(n *html.Node) bool {
+	if strings.EqualFold(attr(n, "rel"), "author") || strings.EqualFold(attr(n, "itemprop"), "author") {
+		return true
+	}
+	return bylinePattern.MatchString(attr(n, "class") + " " + attr(n, "id"))
+}
+
+// applyJSONLD reads schema.org article data, which many publishers fill in
+// more carefully than their visible markup.
+func (m *pageMetadata) applyJSONLD(raw string) {
+	var decoded any
+	if err := json.Unmarshal([]byte(raw), &decoded); err != nil {
+		return
+	}
+	var visit func(v any)
+	visit = func(v any) {
+		switch value := v.(type) {
+		case []any:
+			for _, entry := range value {
+				visit(entry)
+			}
+		case map[string]any:
+			if graph, ok := value["@graph"]; ok {
+				visit(graph)
+			}
+			if !isArticleType(value["@type"]) {
+				return
+			}
+			if m.jsonTitle == "" {
+				m.jsonTitle = jsonString(value["headline"])
+			}
+			if m.byline == "" {
+				m.byline = jsonName(value["author"])
+			}
+			if m.published == "" {
+				m.published = jsonString(value["datePublished"])
+			}
+			if m.image == "" {
+				m.image = jsonURL(value["image"])
+			}
+			if m.siteName == "" {
+				m.siteName = jsonName(value["publisher"])
+			}
+		}
+	}
+	visit(decoded)
+}
+
+func isArticleType(v any) bool {
+	switch typ := v.(type) {
+	case string:
+		return articleTypes[typ]
+	case []any:
+		for _, t := range typ {
+			if s, ok := t.(string); ok && articleTypes[s] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonString(v any) string {
+	s, _ := v.(string)
+	return strings.TrimSpace(s)
+}
+
+// jsonName reads a schema.org Person or Organization, a list of them, or a
+// plain string.
+func jsonName(v any) string {
+	switch value := v.(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case map[string]any:
+		return jsonString(value["name"])
+	case []any:
+		var names []string
+		for _, entry := range value {
+			if name := jsonName(entry); name != "" {
+				names = append(names, name)
+			}
+		}
+		return strings.Join(names, ", ")
+	}
+	return ""
+}
+
+func jsonURL(v any) string {
+	switch value := v.(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case map[string]any:
+		return jsonString(value["url"])
+	case []any:
+		for _, entry := range value {
+			if u := jsonURL(entry); u != "" {
+				return u
+			}
+		}
+	}
+	return ""
+}
+
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+}
+
+// normalizeDate returns a page's publication date as RFC 3339 when it is in
+// a format we recognise, and as the page stated it otherwise.
+func normalizeDate(value string) string {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC().Format(time.RFC3339)
+		}
+	}
+	return value
+}
+
+// --- candidate selection --------------------------------------------------
+
+var (
+	unlikelyPattern = regexp.MustCompile(`(?i)-ad-|ai2html|banner|breadcrumbs|combx|comment|community|cover-wrap|disqus|extra|footer|gdpr|header|legends|menu|related|remark|replies|rss|shoutbox|sidebar|skyscraper|social|sponsor|supplemental|ad-break|agegate|pagination|pager|popup|yom-remote|share|cookie|newsletter|subscribe|promo|consent`)
+	maybePattern    = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positivePattern = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	negativePattern = regexp.MustCompile(`(?i)-ad-|hidden|^hid$| hid$| hid |^hid |banner|combx|comment|com-|contact|foot|footer|footnote|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+)
+
+// removedElements never hold article text.
+var removedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Iframe: true,
+	atom.Object: true, atom.Embed: true, atom.Form: true, atom.Button: true,
+	atom.Input: true, atom.Select: true, atom.Textarea: true, atom.Svg: true,
+	atom.Canvas: true, atom.Nav: true, atom.Footer: true, atom.Aside: true,
+	atom.Header: true, atom.Template: true, atom.Dialog: true, atom.Link: true,
+	atom.Meta: true,
+}
+
+// prune removes everything that cannot be article text before scoring:
+// non-content elements, hidden elements, and containers whose class or id
+// marks them as page furniture.
+func prune(root *html.Node) {
+	var remove []*html.Node
+	walk(root, func(n *html.Node) bool {
+		if n == root {
+			return true
+		}
+		switch n.Type {
+		case html.CommentNode:
+			remove = append(remove, n)
+			return false
+		case html.ElementNode:
+		default:
+			return true
+		}
+		if removedElements[n.DataAtom] || isHidden(n) {
+			remove = append(remove, n)
+			return false
+		}
+		if n.DataAtom != atom.Article && n.DataAtom != atom.Main && n.DataAtom != atom.A {
+			match := attr(n, "class") + " " + attr(n, "id")
+			if unlikelyPattern.MatchString(match) && !maybePattern.MatchString(match) {
+				remove = append(remove, n)
+				return false
+			}
+			if role := attr(n, "role"); role == "navigation" || role == "complementary" || role == "banner" || role == "dialog" {
+				remove = append(remove, n)
+				return false
+			}
+		}
+		return true
+	})
+	for _, n := range remove {
+		if n.Parent != nil {
+			n.Parent.RemoveChild(n)
+		}
+	}
+}
+
+func isHidden(n *html.Node) bool {
+	if hasAttr(n, "hidden") || strings.EqualFold(attr(n, "aria-hidden"), "true") {
+		return true
+	}
+	style := strings.ToLower(strings.ReplaceAll(attr(n, "style"), " ", ""))
+	return strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden")
+}
+
+// blockElements end a paragraph. A <div> with none of these inside it is
+// scored as a paragraph itself, as sites that never use <p> need.
+var blockElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Blockquote: true, atom.Dl: true,
+	atom.Div: true, atom.Figure: true, atom.H1: true, atom.H2: true, atom.H3: true,
+	atom.H4: true, atom.H5: true, atom.H6: true, atom.Hr: true, atom.Li: true,
+	atom.Main: true, atom.Ol: true, atom.P: true, atom.Pre: true, atom.Section: true,
+	atom.Table: true, atom.Ul: true,
+}
+
+// topCandidate returns the element that holds the most article prose, along
+// with every candidate's final score.
+func topCandidate(body *html.Node) (*html.Node, map[*html.Node]float64) {
+	scores := map[*html.Node]float64{}
+	var order []*html.Node
+	initialize := func(n *html.Node) {
+		if _, ok := scores[n]; ok {
+			return
+		}
+		order = append(order, n)
+		scores[n] = tagWeight(n) + classWeight(n)
+	}
+
+	walk(body, func(n *html.Node) bool {
+		if n.Type != html.ElementNode {
+			return true
+		}
+		scorable := n.DataAtom == atom.P || n.DataAtom == atom.Pre || n.DataAtom == atom.Td ||
+			(n.DataAtom == atom.Div && !hasBlockChild(n))
+		if !scorable {
+			return true
+		}
+		text := collapseSpace(textContent(n))
+		if len(text) < 25 {
+			return true
+		}
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text))/100, 3)
+		level := 0
+		for ancestor := n.Parent; ancestor != nil && ancestor.Type == html.ElementNode && level < 3; ancestor = ancestor.Parent {
+			initialize(ancestor)
+			switch level {
+			case 0:
+				scores[ancestor] += score
+			case 1:
+				scores[ancestor] += score / 2
+			default:
+				scores[ancestor] += score / float64(level*3)
+			}
+			level++
+		}
+		return n.DataAtom == atom.Div
+	})
+
+	var best *html.Node
+	bestScore := 0.0
+	for _, n := range order {
+		score := scores[n] * (1 - linkDensity(n))
+		scores[n] = score
+		if best == nil || score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	if best == nil {
+		return body, scores
+	}
+	// A wrapper holding nothing but the candidate is the same content with
+	// its siblings in reach.
+	for best.Parent != nil && best.Parent != body && onlyElementChild(best.Parent) == best {
+		scores[best.Parent] = bestScore
+		best = best.Parent
+	}
+	return best, scores
+}
+
+func tagWeight(n *html.Node) float64 {
+	switch n.DataAtom {
+	case atom.Div, atom.Article, atom.Main:
+		return 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		return 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li, atom.Form:
+		return -3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		return -5
+	}
+	return 0
+}
+
+func classWeight(n *html.Node) float64 {
+	weight := 0.0
+	for _, value := range []string{attr(n, "class"), attr(n, "id")} {
+		if value == "" {
+			continue
+		}
+		if negativePattern.MatchString(value) {
+			weight -= 25
+		}
+		if positivePattern.MatchString(value) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// assemble returns the top candidate together with the siblings that look
+// like more of the same article: well-scored ones, and plain paragraphs that
+// are prose rather than links.
+func assemble(top *html.Node, scoreOf map[*html.Node]float64) *html.Node {
+	container := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	if top.Parent == nil || top.DataAtom == atom.Body {
+		container.AppendChild(cloneNode(top))
+		return container
+	}
+	threshold := math.Max(10, scoreOf[top]*0.2)
+	for sibling := top.Parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+		include := sibling == top
+		if !include && sibling.Type == html.ElementNode {
+			if score, ok := scoreOf[sibling]; ok && score >= threshold {
+				include = true
+			} else if sibling.DataAtom == atom.P {
+				text := collapseSpace(textContent(sibling))
+				density := linkDensity(sibling)
+				include = (len(text) > 80 && density < 0.25) ||
+					(len(text) > 0 && density == 0 && strings.Contains(text, ". "))
+			}
+		}
+		if include {
+			container.AppendChild(cloneNode(sibling))
+		}
+	}
+	return container
+}
+
+// --- sanitizing -----------------------------------------------------------
+
+// keptElements survive into the article, with only keptAttributes on them.
+// Every other element is unwrapped: its children stay, the element goes.
+var keptElements = map[atom.Atom]bool{
+	atom.P: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true,
+	atom.H5: true, atom.H6: true, atom.Ul: true, atom.Ol: true, atom.Li: true,
+	atom.Blockquote: true, atom.Pre: true, atom.Code: true, atom.Em: true,
+	atom.I: true, atom.Strong: true, atom.B: true, atom.A: true, atom.Img: true,
+	atom.Figure: true, atom.Figcaption: true, atom.Table: true, atom.Thead: true,
+	atom.Tbody: true, atom.Tr: true, atom.Th: true, atom.Td: true, atom.Br: true,
+	atom.Hr: true, atom.Dl: true, atom.Dt: true, atom.Dd: true, atom.Sub: true,
+	atom.Sup: true, atom.Del: true, atom.S: true, atom.Q: true, atom.Cite: true,
+	atom.Abbr: true, atom.Mark: true, atom.Small: true, atom.Time: true,
+}
+
+var keptAttributes = map[string]bool{
+	"href": true, "src": true, "alt": true, "title": true, "colspan": true, "rowspan": true, "datetime": true,
+}
+
+// sanitize rebuilds the assembled content from kept elements only, resolving
+// links and images against the page and dropping what no longer says
+// anything: empty paragraphs, images without a source, link-farm lists.
+func sanitize(content *html.Node, base *url.URL) *html.Node {
+	out := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	var copyChildren func(src, dst *html.Node)
+	copyChildren = func(src, dst *html.Node) {
+		for c := src.FirstChild; c != nil; c = c.NextSibling {
+			switch c.Type {
+			case html.TextNode:
+				dst.AppendChild(&html.Node{Type: html.TextNode, Data: c.Data})
+			case html.ElementNode:
+				if !keptElements[c.DataAtom] {
+					copyChildren(c, dst)
+					continue
+				}
+				if (c.DataAtom == atom.Ul || c.DataAtom == atom.Ol || c.DataAtom == atom.Table || c.DataAtom == atom.Dl) &&
+					isLinkFarm(c) {
+					continue
+				}
+				if c.DataAtom == atom.A && resolveURL(base, attr(c, "href"), true) == "" {
+					// A script or fragment link is only its text here.
+					copyChildren(c, dst)
+					continue
+				}
+				el := &html.Node{Type: html.ElementNode, Data: c.Data, DataAtom: c.DataAtom}
+				for _, a := range c.Attr {
+					if !keptAttributes[a.Key] {
+						continue
+					}
+					switch a.Key {
+					case "href":
+						if resolved := resolveURL(base, a.Val, true); resolved != "" {
+							el.Attr = append(el.Attr, html.Attribute{Key: "href", Val: resolved})
+						}
+					case "src":
+					default:
+						el.Attr = append(el.Attr, html.Attribute{Key: a.Key, Val: a.Val})
+					}
+				}
+				if c.DataAtom == atom.Img {
+					src := resolveURL(base, imageSource(c), false)
+					if src == "" {
+						continue
+					}
+					el.Attr = append(el.Attr, html.Attribute{Key: "src", Val: src})
+				}
+				copyChildren(c, el)
+				dst.AppendChild(el)
+			}
+		}
+	}
+	copyChildren(content, out)
+	dropEmpty(out)
+	return out
+}
+
+// imageSource finds an image's real source, including the data-src and
+// srcset a lazy loader may not have swapped in yet.
+func imageSource(n *html.Node) string {
+	for _, key := range []string{"data-src", "data-original", "data-lazy-src"} {
+		if v := attr(n, key); v != "" {
+			return v
+		}
+	}
+	if src := attr(n, "src"); src != "" && !strings.HasPrefix(src, "data:") {
+		return src
+	}
+	if srcset := attr(n, "srcset"); srcset != "" {
+		first := strings.TrimSpace(strings.Split(srcset, ",")[0])
+		return strings.Fields(first + " ")[0]
+	}
+	return ""
+}
+
+// isLinkFarm reports a list or table that is mostly links: a "related
+// stories" block or a tag cloud, not part of the article.
+func isLinkFarm(n *html.Node) bool {
+	text := collapseSpace(textContent(n))
+	return len(text) > 0 && linkDensity(n) > 0.5 && len(strings.Fields(text)) < 200
+}
+
+// dropEmpty removes elements left with no text and no image.
+func dropEmpty(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode {
+			dropEmpty(c)
+			switch c.DataAtom {
+			case atom.Img, atom.Br, atom.Hr, atom.Td, atom.Th:
+			default:
+				if strings.TrimSpace(textContent(c)) == "" && findFirst(c, atom.Img) == nil {
+					n.RemoveChild(c)
+				}
+			}
+		}
+		c = next
+	}
+}
+
+// removeTitleHeading drops a leading heading that repeats the title, which
+// Article.Title already carries.
+func removeTitleHeading(n *html.Node, title string) {
+	if title == "" {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode && strings.TrimSpace(c.Data) == "" {
+			continue
+		}
+		if c.Type == html.ElementNode && (c.DataAtom == atom.H1 || c.DataAtom == atom.H2) &&
+			strings.EqualFold(collapseSpace(textContent(c)), title) {
+			n.RemoveChild(c)
+		}
+		return
+	}
+}
+
+func resolveURL(base *url.URL, raw string, allowMailto bool) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || strings.HasPrefix(raw, "#") {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.String()
+	case "mailto":
+		if allowMailto {
+			return u.String()
+		}
+	}
+	return ""
+}
+
+func firstParagraph(n *html.Node) string {
+	p := findFirst(n, atom.P)
+	if p == nil {
+		return ""
+	}
+	text := collapseSpace(textContent(p))
+	if len(text) > 300 {
+		cut := strings.LastIndex(text[:300], " ")
+		if cut < 200 {
+			cut = 300
+		}
+		text = strings.TrimRight(text[:cut], ",;: ") + "…"
+	}
+	return text
+}
+
+// --- tree helpers ---------------------------------------------------------
+
+// walk visits n and its descendants depth-first; visit returns false to skip
+// a node's children.
+func walk(n *html.Node, visit func(*html.Node) bool) {
+	if !visit(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		walk(c, visit)
+		c = next
+	}
+}
+
+func findFirst(n *html.Node, a atom.Atom) *html.Node {
+	var found *html.Node
+	walk(n, func(c *html.Node) bool {
+		if found != nil {
+			return false
+		}
+		if c.Type == html.ElementNode && c.DataAtom == a {
+			found = c
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+func findBaseHref(root *html.Node) string {
+	if base := findFirst(root, atom.Base); base != nil {
+		return attr(base, "href")
+	}
+	return ""
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	walk(n, func(c *html.Node) bool {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+		return true
+	})
+	return b.String()
+}
+
+func linkDensity(n *html.Node) float64 {
+	total := len(collapseSpace(textContent(n)))
+	if total == 0 {
+		return 0
+	}
+	links := 0
+	walk(n, func(c *html.Node) bool {
+		if c.Type == html.ElementNode && c.DataAtom == atom.A {
+			links += len(collapseSpace(textContent(c)))
+			return false
+		}
+		return true
+	})
+	return float64(links) / float64(total)
+}
+
+func hasBlockChild(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && blockElements[c.DataAtom] {
+			return true
+		}
+	}
+	return false
+}
+
+func onlyElementChild(n *html.Node) *html.Node {
+	var only *html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c.Type == html.ElementNode:
+			if only != nil {
+				return nil
+			}
+			only = c
+		case c.Type == html.TextNode && strings.TrimSpace(c.Data) != "":
+			return nil
+		}
+	}
+	return only
+}
+
+func cloneNode(n *html.Node) *html.Node {
+	clone := &html.Node{Type: n.Type, Data: n.Data, DataAtom: n.DataAtom, Namespace: n.Namespace}
+	clone.Attr = append([]html.Attribute(nil), n.Attr...)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		clone.AppendChild(cloneNode(c))
+	}
+	return clone
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
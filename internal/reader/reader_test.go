@@ -0,0 +1,167 @@
+package reader
+
+import (
+	"strings"
+	"testing"
+)
+
+const articlePage = `<!DOCTYPE html>
+<html lang="en-GB">
+<head>
+<title>Rivers are rising across the valley | The Valley Times</title>
+<meta property="og:site_name" content="The Valley Times">
+<meta property="og:image" content="/images/flood.jpg">
+<meta name="description" content="Heavy rain has pushed three rivers past their banks.">
+<base href="https://news.example/2024/">
+<script type="application/ld+json">
+{"@context":"https://schema.org","@type":"NewsArticle","headline":"Rivers are rising across the valley",
+ "author":[{"@type":"Person","name":"Ana Ruiz"}],"datePublished":"2024-03-02T08:15:00+01:00"}
+</script>
+<script>window.tracking = true;</script>
+</head>
+<body>
+<header class="site-header"><nav><a href="/">Home</a> <a href="/news">News</a></nav></header>
+<div class="cookie-banner">We use cookies to improve your experience. Accept all?</div>
+<main>
+<article class="story">
+<h1>Rivers are rising across the valley</h1>
+<p>Heavy rain over the weekend has pushed three rivers past their banks, flooding fields, roads and, in the lower
+town, the ground floors of more than forty homes. Emergency crews worked through the night to move residents to
+the school hall, which the council opened as a shelter on Saturday evening.</p>
+<p>"We have not seen the water this high since 1998," said the harbour master, who has measured the level at the
+old bridge every morning for twenty years. The forecast offers little relief, with more rain expected until
+Wednesday and the ground already saturated.</p>
+<figure><img data-src="river.jpg" src="data:image/gif;base64,R0lGOD" alt="The old bridge"><figcaption>The old bridge on Sunday.</figcaption></figure>
+<h2>What residents should do</h2>
+<ul><li>Move valuables <strong>upstairs</strong>.</li><li>Keep to marked routes; see the <a href="/routes">route map</a>.</li></ul>
+<p onclick="steal()" style="color:red">Read the council's <a href="javascript:alert(1)">advice</a> in full and <em>check</em> on your neighbours.</p>
+<div class="share-tools"><a href="https://twitter.example/share">Share</a></div>
+</article>
+</main>
+<aside class="sidebar"><h3>Most read</h3><ul><li><a href="/a">A story</a></li><li><a href="/b">Another one</a></li></ul></aside>
+<footer>Copyright The Valley Times</footer>
+</body>
+</html>`
+
+func TestExtractFindsArticleAndMetadata(t *testing.T) {
+	article, err := Extract(strings.NewReader(articlePage), "https://news.example/2024/rivers", SourcePage)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if !article.Readable {
+		t.Fatalf("expected a readable article, got %d words", article.WordCount)
+	}
+	checks := map[string][2]string{
+		"title":      {article.Title, "Rivers are rising across the valley"},
+		"byline":     {article.Byline, "Ana Ruiz"},
+		"site name":  {article.SiteName, "The Valley Times"},
+		"published":  {article.Published, "2024-03-02T07:15:00Z"},
+		"lead image": {article.LeadImage, "https://news.example/images/flood.jpg"},
+		"excerpt":    {article.Excerpt, "Heavy rain has pushed three rivers past their banks."},
+		"language":   {article.Language, "en-GB"},
+		"source":     {article.Source, SourcePage},
+	}
+	for name, check := range checks {
+		if check[0] != check[1] {
+			t.Errorf("%s = %q, want %q", name, check[0], check[1])
+		}
+	}
+
+	for _, want := range []string{
+		"harbour master",
+		`<img alt="The old bridge" src="https://news.example/2024/river.jpg"/>`,
+		`<a href="https://news.example/routes">route map</a>`,
+		"<h2>What residents should do</h2>",
+	} {
+		if !strings.Contains(article.HTML, want) {
+			t.Errorf("article HTML is missing %q:\n%s", want, article.HTML)
+		}
+	}
+	for _, unwanted := range []string{
+		"cookies", "Most read", "Copyright", "Share", "tracking", "onclick", "style=", "javascript:",
+		"class=", "<h1>",
+	} {
+		if strings.Contains(article.HTML, unwanted) {
+			t.Errorf("article HTML should not contain %q:\n%s", unwanted, article.HTML)
+		}
+	}
+	if article.WordCount < 100 || article.WordCount > 160 {
+		t.Errorf("word count = %d, want the article's ~130 words", article.WordCount)
+	}
+}
+
+func TestExtractMarkdown(t *testing.T) {
+	article, err := Extract(strings.NewReader(articlePage), "https://news.example/2024/rivers", SourcePage)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	for _, want := range []string{
+		"## What residents should do\n",
+		"- Move valuables **upstairs**.\n",
+		"- Keep to marked routes; see the [route map](https://news.example/routes).\n",
+		"![The old bridge](https://news.example/2024/river.jpg)",
+		"Read the council's advice in full and _check_ on your neighbours.",
+	} {
+		if !strings.Contains(article.Markdown, want) {
+			t.Errorf("markdown is missing %q:\n%s", want, article.Markdown)
+		}
+	}
+}
+
+func TestExtractReportsUnreadablePages(t *testing.T) {
+	page := `<html><head><title>Sign in</title><meta property="og:title" content="Sign in to Example"></head>
+<body><form><input name="user"><input name="password" type="password"><button>Sign in</button></form>
+<p>Forgot your password?</p></body></html>`
+	article, err := Extract(strings.NewReader(page), "https://example.com/login", SourceMHTML)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if article.Readable {
+		t.Fatalf("a login page should not be readable: %+v", article)
+	}
+	if article.Title != "Sign in to Example" {
+		t.Errorf("title = %q, metadata should still be collected", article.Title)
+	}
+	if article.HTML != "" || article.Markdown != "" {
+		t.Errorf("an unreadable page should carry no article body, got %q", article.HTML)
+	}
+}
+
+func TestMarkdownTablesCodeAndQuotes(t *testing.T) {
+	page := `<html><body><article>
+<p>` + strings.Repeat("This paragraph pads the article out to a readable length, as articles are. ", 8) + `</p>
+<blockquote><p>A quoted line.</p></blockquote>
+<pre><code>go test ./...
+</code></pre>
+<table><tr><th>River</th><th>Level</th></tr><tr><td>Ouse</td><td>4.2 m</td></tr></table>
+<ol><li>First</li><li>Second</li></ol>
+</article></body></html>`
+	article, err := Extract(strings.NewReader(page), "https://example.com/", SourcePage)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	for _, want := range []string{
+		"> A quoted line.\n",
+		"```\ngo test ./...\n```\n",
+		"| River | Level |\n| --- | --- |\n| Ouse | 4.2 m |\n",
+		"1. First\n2. Second\n",
+	} {
+		if !strings.Contains(article.Markdown, want) {
+			t.Errorf("markdown is missing %q:\n%s", want, article.Markdown)
+		}
+	}
+}
+
+func TestNormalizeDate(t *testing.T) {
+	cases := map[string]string{
+		"2024-03-02":                "2024-03-02T00:00:00Z",
+		"2024-03-02T10:00:00+02:00": "2024-03-02T08:00:00Z",
+		"March 2, 2024":             "2024-03-02T00:00:00Z",
+		"last Tuesday":              "last Tuesday",
+	}
+	for in, want := range cases {
+		if got := normalizeDate(in); got != want {
+			t.Errorf("normalizeDate(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"context"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 )
@@ -70,7 +72,41 @@ func (s *FSStorage) Size(key string) (int64, error) {
 	return info.Size(), nil
 }
 
+// Delete removes the file for key; a missing file is not an error.
+func (s *FSStorage) Delete(key string) error {
+	path := filepath.Join(s.baseDir, key)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 func (s *FSStorage) SeekableReader(key string) (ReadSeekCloser, error) {
 	path := filepath.Join(s.baseDir, key)
 	return os.Open(path)
 }
+
+// Walk calls fn for every file under the base directory, keyed by its path
+// relative to it.
+func (s *FSStorage) Walk(ctx context.Context, fn func(key string, size int64) error) error {
+	return filepath.WalkDir(s.baseDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.baseDir, path)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(rel), info.Size())
+	})
+}
@@ -2,8 +2,10 @@ package storage
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"sort"
 	"sync"
 )
 
@@ -74,6 +76,31 @@ func (ms *MemoryStorage) Exists(key string) (bool, error) {
 	return exists, nil
 }
 
+// Walk calls fn for every stored key, in key order
+func (ms *MemoryStorage) Walk(ctx context.Context, fn func(key string, size int64) error) error {
+	ms.mu.RLock()
+	keys := make([]string, 0, len(ms.data))
+	for key := range ms.data {
+		keys = append(keys, key)
+	}
+	ms.mu.RUnlock()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		size, err := ms.Size(key)
+		if err != nil {
+			continue // deleted since
+		}
+		if err := fn(key, size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // memoryWriter implements io.WriteCloser for in-memory storage
 type memoryWriter struct {
 	storage *MemoryStorage
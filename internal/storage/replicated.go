@@ -0,0 +1,526 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"arker/internal/models"
+)
+
+// ErrNoDirectURL is returned by DirectURL when the backend holding an object
+// cannot serve it directly; the caller should stream it instead.
+var ErrNoDirectURL = errors.New("object cannot be served directly")
+
+// Lister is implemented by backends that can enumerate their objects.
+type Lister interface {
+	// Walk calls fn for every stored object, in no particular order.
+	Walk(ctx context.Context, fn func(key string, size int64) error) error
+}
+
+// Deleter is implemented by backends that can remove an object. Deleting a
+// key that is not stored is not an error.
+type Deleter interface {
+	Delete(key string) error
+}
+
+// Backend is one named storage location of a ReplicatedStorage.
+type Backend struct {
+	// Name identifies the backend in StorageReplica rows. It must stay the
+	// same across restarts: rows under an old name are ignored.
+	Name    string
+	Storage Storage
+}
+
+// ReplicatedStorage keeps every object on a primary backend and on one or
+// more secondaries, and records each copy's state in storage_replicas.
+//
+// Writes go to the primary and fail if it fails. Once the primary has the
+// object, each secondary's copy is recorded as pending and left to Repair,
+// so neither a slow nor an unreachable secondary holds up a capture. Reads
+// try the primary and then each secondary in order, so an object lost from
+// one backend is still served while it is repaired.
+type ReplicatedStorage struct {
+	db       *gorm.DB
+	backends []Backend // primary first
+	// onPending is called after a write leaves secondary copies pending.
+	onPending func()
+}
+
+// NewReplicatedStorage creates a replicated storage over primary and
+// secondaries.
+func NewReplicatedStorage(db *gorm.DB, primary Backend, secondaries ...Backend) *ReplicatedStorage {
+	return &ReplicatedStorage{db: db, backends: append([]Backend{primary}, secondaries...)}
+}
+
+// OnPending sets fn to be called, in its own goroutine, each time a write
+// leaves secondary copies pending, so a repair pass can be scheduled without
+// waiting for the next periodic one. It must be set before any write.
+func (s *ReplicatedStorage) OnPending(fn func()) {
+	s.onPending = fn
+}
+
+// Backends returns the backends, primary first.
+func (s *ReplicatedStorage) Backends() []Backend {
+	return s.backends
+}
+
+// Writer returns a writer to the primary. Closing it records the object's
+// replicas.
+func (s *ReplicatedStorage) Writer(key string) (io.WriteCloser, error) {
+	w, err := s.backends[0].Storage.Writer(key)
+	if err != nil {
+		return nil, err
+	}
+	return &replicatingWriter{WriteCloser: w, storage: s, key: key}, nil
+}
+
+type replicatingWriter struct {
+	io.WriteCloser
+	storage *ReplicatedStorage
+	key     string
+	closed  bool
+}
+
+func (w *replicatingWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	w.storage.replicate(w.key)
+	return nil
+}
+
+// replicate records the primary's copy of key and a pending copy on each
+// secondary, which Repair makes. Failures are recorded, not returned: the
+// object is stored.
+func (s *ReplicatedStorage) replicate(key string) {
+	primary := s.backends[0]
+	size, err := primary.Storage.Size(key)
+	if err != nil {
+		slog.Warn("Replicated storage: sizing new object", "key", key, "backend", primary.Name, "error", err)
+	}
+	s.record(key, primary.Name, models.ReplicaStatusOK, size, nil)
+	if len(s.backends) == 1 {
+		return
+	}
+	for _, secondary := range s.backends[1:] {
+		s.record(key, secondary.Name, models.ReplicaStatusPending, 0, nil)
+	}
+	if s.onPending != nil {
+		go s.onPending()
+	}
+}
+
+// Reader opens key on the first backend that can open it.
+func (s *ReplicatedStorage) Reader(key string) (io.ReadCloser, error) {
+	var firstErr error
+	for i, backend := range s.backends {
+		r, err := backend.Storage.Reader(key)
+		if err == nil {
+			if i > 0 {
+				slog.Warn("Replicated storage: read failed over", "key", key, "backend", backend.Name, "error", firstErr)
+			}
+			return r, nil
+		}
+		s.noteFailedRead(key, backend)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// SeekableReader opens key on the first backend that holds it and supports
+// seeking.
+func (s *ReplicatedStorage) SeekableReader(key string) (ReadSeekCloser, error) {
+	var firstErr error
+	for _, backend := range s.backends {
+		seekable, ok := backend.Storage.(SeekableStorage)
+		if !ok {
+			continue
+		}
+		// S3's seekable reader opens lazily, so a missing object would only
+		// surface mid-response; ask first.
+		exists, err := backend.Storage.Exists(key)
+		if err == nil && !exists {
+			s.noteFailedRead(key, backend)
+			err = fmt.Errorf("%s: object %s not found", backend.Name, key)
+		}
+		if err == nil {
+			var r ReadSeekCloser
+			if r, err = seekable.SeekableReader(key); err == nil {
+				return r, nil
+			}
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		firstErr = errors.New("no backend supports seekable reads")
+	}
+	return nil, firstErr
+}
+
+// DirectURL returns a direct URL from the first backend holding key, or
+// ErrNoDirectURL when that backend cannot serve directly.
+func (s *ReplicatedStorage) DirectURL(ctx context.Context, key string, opts DirectURLOptions) (string, error) {
+	for _, backend := range s.backends {
+		if exists, err := backend.Storage.Exists(key); err != nil || !exists {
+			continue
+		}
+		direct, ok := backend.Storage.(DirectURLStorage)
+		if !ok {
+			return "", ErrNoDirectURL
+		}
+		return direct.DirectURL(ctx, key, opts)
+	}
+	return "", ErrNoDirectURL
+}
+
+// Exists reports whether any backend holds key.
+func (s *ReplicatedStorage) Exists(key string) (bool, error) {
+	var firstErr error
+	for _, backend := range s.backends {
+		exists, err := backend.Storage.Exists(key)
+		if err == nil && exists {
+			return true, nil
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return false, firstErr
+}
+
+// Size returns key's size from the first backend that can report it.
+func (s *ReplicatedStorage) Size(key string) (int64, error) {
+	var firstErr error
+	for _, backend := range s.backends {
+		size, err := backend.Storage.Size(key)
+		if err == nil {
+			return size, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return 0, firstErr
+}
+
+// Delete removes key from every backend and drops the replica rows of the
+// copies it removed. A backend that cannot delete, or refuses to, keeps its
+// copy and its row, and the first such failure is returned.
+func (s *ReplicatedStorage) Delete(key string) error {
+	var firstErr error
+	for _, backend := range s.backends {
+		deleter, ok := backend.Storage.(Deleter)
+		if !ok {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("backend %s cannot delete objects", backend.Name)
+			}
+			continue
+		}
+		if err := deleter.Delete(key); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("backend %s: %w", backend.Name, err)
+			}
+			continue
+		}
+		if err := s.db.Unscoped().Where("object_key = ? AND backend = ?", key, backend.Name).Delete(&models.StorageReplica{}).Error; err != nil {
+			slog.Error("Replicated storage: dropping replica row", "key", key, "backend", backend.Name, "error", err)
+		}
+	}
+	return firstErr
+}
+
+// noteFailedRead records backend's copy of key as missing when the backend
+// confirms it is absent. Other failures (an outage) say nothing about the
+// copy and are not recorded.
+func (s *ReplicatedStorage) noteFailedRead(key string, backend Backend) {
+	if exists, err := backend.Storage.Exists(key); err == nil && !exists {
+		s.record(key, backend.Name, models.ReplicaStatusMissing, 0, errors.New("object not found on read"))
+	}
+}
+
+// record upserts one replica's state. A database failure is logged: the
+// repair pass finds unrecorded objects again through Backfill.
+func (s *ReplicatedStorage) record(key, backend, status string, size int64, cause error) {
+	replica := models.StorageReplica{ObjectKey: key, Backend: backend, Status: status, Size: size}
+	updates := []string{"status", "error", "updated_at"}
+	if cause != nil {
+		replica.Error = cause.Error()
+	}
+	if status == models.ReplicaStatusOK {
+		now := time.Now()
+		replica.VerifiedAt = &now
+		updates = append(updates, "size", "attempts", "verified_at")
+	}
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "object_key"}, {Name: "backend"}},
+		DoUpdates: clause.AssignmentColumns(updates),
+	}).Create(&replica).Error
+	if err != nil {
+		slog.Error("Replicated storage: recording replica state", "key", key, "backend", backend, "status", status, "error", err)
+	}
+}
+
+// RepairResult summarizes a Repair pass.
+type RepairResult struct {
+	Repaired int
+	Failed   int
+}
+
+// Repair copies up to limit pending or missing replicas from a backend that
+// still holds the object, fewest failed attempts first. A copy already in
+// place is recorded without copying, which matters for buckets that refuse
+// overwrites. Where an archive item records the object's checksum, both the
+// copy in place and a new copy must match it; otherwise only sizes are
+// compared.
+func (s *ReplicatedStorage) Repair(ctx context.Context, limit int) (RepairResult, error) {
+	var result RepairResult
+	names := make([]string, len(s.backends))
+	for i, backend := range s.backends {
+		names[i] = backend.Name
+	}
+	var replicas []models.StorageReplica
+	err := s.db.
+		Where("status IN ? AND backend IN ?", []string{models.ReplicaStatusPending, models.ReplicaStatusMissing}, names).
+		Order("attempts, id").
+		Limit(limit).
+		Find(&replicas).Error
+	if err != nil {
+		return result, fmt.Errorf("replicas: selecting repairs: %w", err)
+	}
+	for _, replica := range replicas {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		size, err := s.repairOne(replica)
+		if err != nil {
+			result.Failed++
+			s.db.Model(&replica).Updates(map[string]interface{}{
+				"error":    err.Error(),
+				"attempts": gorm.Expr("attempts + 1"),
+			})
+			slog.Warn("Replicated storage: repair failed", "key", replica.ObjectKey, "backend", replica.Backend, "attempts", replica.Attempts+1, "error", err)
+			continue
+		}
+		result.Repaired++
+		s.record(replica.ObjectKey, replica.Backend, models.ReplicaStatusOK, size, nil)
+	}
+	return result, nil
+}
+
+// repairOne restores replica from the first other backend holding the
+// object, and returns the object's size.
+func (s *ReplicatedStorage) repairOne(replica models.StorageReplica) (int64, error) {
+	var target Backend
+	for _, backend := range s.backends {
+		if backend.Name == replica.Backend {
+			target = backend
+		}
+	}
+	checksum, err := s.recordedChecksum(replica.ObjectKey)
+	if err != nil {
+		return 0, err
+	}
+	var mismatch error
+	for _, source := range s.backends {
+		if source.Name == target.Name {
+			continue
+		}
+		size, err := source.Storage.Size(replica.ObjectKey)
+		if err != nil {
+			continue
+		}
+		if existing, err := target.Storage.Size(replica.ObjectKey); err == nil && existing == size {
+			if checksum == "" {
+				return size, nil
+			}
+			if sum, err := hashObject(target.Storage, replica.ObjectKey); err == nil && sum == checksum {
+				return size, nil
+			}
+		}
+		copied, sum, err := copyObject(source.Storage, target.Storage, replica.ObjectKey)
+		if err != nil {
+			return 0, fmt.Errorf("copying from %s: %w", source.Name, err)
+		}
+		if copied != size {
+			return 0, fmt.Errorf("copied %d bytes from %s, which holds %d", copied, source.Name, size)
+		}
+		if checksum != "" && sum != checksum {
+			// A damaged source; another backend may hold the right bytes.
+			mismatch = fmt.Errorf("copy from %s has SHA-256 %s, want %s", source.Name, sum, checksum)
+			continue
+		}
+		return size, nil
+	}
+	if mismatch != nil {
+		return 0, mismatch
+	}
+	return 0, errors.New("no other backend holds the object")
+}
+
+// recordedChecksum returns the SHA-256 an archive item recorded for key, or
+// "" when none did.
+func (s *ReplicatedStorage) recordedChecksum(key string) (string, error) {
+	var sums []string
+	err := s.db.Model(&models.ArchiveItem{}).
+		Where("storage_key = ? AND checksum <> ''", key).
+		Limit(1).
+		Pluck("checksum", &sums).Error
+	if err != nil {
+		return "", fmt.Errorf("looking up checksum: %w", err)
+	}
+	if len(sums) == 0 {
+		return "", nil
+	}
+	return sums[0], nil
+}
+
+// Backfill walks the primary and records a pending replica on every
+// secondary for each object that has no row there yet, so objects stored
+// before a secondary was added are copied by later Repair passes. It returns
+// how many objects it walked.
+func (s *ReplicatedStorage) Backfill(ctx context.Context) (int, error) {
+	primary := s.backends[0]
+	lister, ok := primary.Storage.(Lister)
+	if !ok {
+		return 0, fmt.Errorf("primary %s cannot list its objects", primary.Name)
+	}
+	const batchSize = 500
+	var batch []models.StorageReplica
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := s.db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(batch, batchSize).Error
+		batch = batch[:0]
+		return err
+	}
+	walked := 0
+	err := lister.Walk(ctx, func(key string, size int64) error {
+		walked++
+		now := time.Now()
+		batch = append(batch, models.StorageReplica{ObjectKey: key, Backend: primary.Name, Status: models.ReplicaStatusOK, Size: size, VerifiedAt: &now})
+		for _, secondary := range s.backends[1:] {
+			batch = append(batch, models.StorageReplica{ObjectKey: key, Backend: secondary.Name, Status: models.ReplicaStatusPending})
+		}
+		if len(batch) >= batchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return walked, err
+	}
+	return walked, flush()
+}
+
+// copyObject copies key from src to dst and returns the bytes copied and
+// their hex SHA-256.
+func copyObject(src, dst Storage, key string) (int64, string, error) {
+	r, err := src.Reader(key)
+	if err != nil {
+		return 0, "", err
+	}
+	defer r.Close()
+	w, err := dst.Writer(key)
+	if err != nil {
+		return 0, "", err
+	}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, hash), r)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	return n, hex.EncodeToString(hash.Sum(nil)), err
+}
+
+// hashObject returns the hex SHA-256 of key in store.
+func hashObject(store Storage, key string) (string, error) {
+	r, err := store.Reader(key)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// OpenBackend opens a backend from a location URL and names it by that URL
+// without its credentials or options:
+//
+//	file:///srv/arker-replica
+//	s3://ACCESS_KEY:SECRET@bucket/prefix?endpoint=https://...&region=auto&path_style=true
+//
+// An s3 URL without credentials uses the default AWS credential chain.
+func OpenBackend(ctx context.Context, location, tempDir string) (Backend, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return Backend{}, fmt.Errorf("invalid storage location %q: %w", location, err)
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Path == "" {
+			return Backend{}, fmt.Errorf("storage location %q has no path", location)
+		}
+		return Backend{Name: "file://" + u.Path, Storage: NewFSStorage(u.Path)}, nil
+	case "s3":
+		if u.Host == "" {
+			return Backend{}, fmt.Errorf("storage location %q has no bucket", location)
+		}
+		query := u.Query()
+		pathStyle, _ := strconv.ParseBool(query.Get("path_style"))
+		cfg := S3Config{
+			Endpoint:       query.Get("endpoint"),
+			Region:         query.Get("region"),
+			Bucket:         u.Host,
+			Prefix:         strings.Trim(u.Path, "/"),
+			ForcePathStyle: pathStyle,
+			TempDir:        tempDir,
+		}
+		if cfg.Region == "" {
+			cfg.Region = "us-east-1"
+		}
+		if u.User != nil {
+			cfg.AccessKeyID = u.User.Username()
+			cfg.SecretAccessKey, _ = u.User.Password()
+		}
+		store, err := NewS3Storage(ctx, cfg)
+		if err != nil {
+			return Backend{}, err
+		}
+		return Backend{Name: S3BackendName(cfg.Bucket, cfg.Prefix), Storage: store}, nil
+	default:
+		return Backend{}, fmt.Errorf("storage location %q: scheme must be file or s3", location)
+	}
+}
+
+// S3BackendName is the backend name of a bucket and key prefix.
+func S3BackendName(bucket, prefix string) string {
+	name := "s3://" + bucket
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		name += "/" + prefix
+	}
+	return name
+}
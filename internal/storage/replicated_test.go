@@ -0,0 +1,378 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"arker/internal/models"
+)
+
+// flakyStorage fails on demand, and can refuse overwrites the way a locked
+// bucket does.
+type flakyStorage struct {
+	*MemoryStorage
+	down        bool
+	noOverwrite bool
+	writes      int
+}
+
+var errBackendDown = errors.New("backend down")
+
+func (f *flakyStorage) Writer(key string) (io.WriteCloser, error) {
+	if f.down {
+		return nil, errBackendDown
+	}
+	if exists, _ := f.MemoryStorage.Exists(key); exists && f.noOverwrite {
+		return nil, errors.New("overwrite refused")
+	}
+	f.writes++
+	return f.MemoryStorage.Writer(key)
+}
+
+func (f *flakyStorage) Reader(key string) (io.ReadCloser, error) {
+	if f.down {
+		return nil, errBackendDown
+	}
+	return f.MemoryStorage.Reader(key)
+}
+
+func (f *flakyStorage) Delete(key string) error {
+	if f.down {
+		return errBackendDown
+	}
+	return f.MemoryStorage.Delete(key)
+}
+
+func (f *flakyStorage) Exists(key string) (bool, error) {
+	if f.down {
+		return false, errBackendDown
+	}
+	return f.MemoryStorage.Exists(key)
+}
+
+func (f *flakyStorage) Size(key string) (int64, error) {
+	if f.down {
+		return 0, errBackendDown
+	}
+	return f.MemoryStorage.Size(key)
+}
+
+func newReplicatedTestStorage(t *testing.T) (*ReplicatedStorage, *gorm.DB, *flakyStorage, *flakyStorage) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.StorageReplica{}, &models.ArchiveItem{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	primary := &flakyStorage{MemoryStorage: NewMemoryStorage()}
+	secondary := &flakyStorage{MemoryStorage: NewMemoryStorage()}
+	store := NewReplicatedStorage(db, Backend{Name: "primary", Storage: primary}, Backend{Name: "secondary", Storage: secondary})
+	return store, db, primary, secondary
+}
+
+func writeObject(t *testing.T, store Storage, key, data string) {
+	t.Helper()
+	w, err := store.Writer(key)
+	if err != nil {
+		t.Fatalf("writer: %v", err)
+	}
+	io.WriteString(w, data)
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
+
+func readObject(t *testing.T, store Storage, key string) string {
+	t.Helper()
+	r, err := store.Reader(key)
+	if err != nil {
+		t.Fatalf("reader: %v", err)
+	}
+	defer r.Close()
+	data, _ := io.ReadAll(r)
+	return string(data)
+}
+
+func replicaStates(t *testing.T, db *gorm.DB, key string) map[string]models.StorageReplica {
+	t.Helper()
+	var replicas []models.StorageReplica
+	db.Where("object_key = ?", key).Find(&replicas)
+	states := map[string]models.StorageReplica{}
+	for _, replica := range replicas {
+		states[replica.Backend] = replica
+	}
+	return states
+}
+
+func repair(t *testing.T, store *ReplicatedStorage) RepairResult {
+	t.Helper()
+	result, err := store.Repair(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("Repair: %v", err)
+	}
+	return result
+}
+
+func TestReplicatedStorageWritesEveryBackend(t *testing.T) {
+	store, db, primary, secondary := newReplicatedTestStorage(t)
+	notified := make(chan struct{}, 1)
+	store.OnPending(func() { notified <- struct{}{} })
+	writeObject(t, store, "abc12/mhtml-aa.mhtml", "page")
+
+	// The write only records the secondary's copy; repair makes it.
+	if secondary.writes != 0 {
+		t.Errorf("secondary written %d times during the write", secondary.writes)
+	}
+	if got := replicaStates(t, db, "abc12/mhtml-aa.mhtml")["secondary"]; got.Status != models.ReplicaStatusPending {
+		t.Errorf("secondary replica after the write = %+v", got)
+	}
+	select {
+	case <-notified:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnPending was not called")
+	}
+	if result := repair(t, store); result.Repaired != 1 {
+		t.Fatalf("Repair = %+v", result)
+	}
+
+	for name, backend := range map[string]*flakyStorage{"primary": primary, "secondary": secondary} {
+		if got := readObject(t, backend, "abc12/mhtml-aa.mhtml"); got != "page" {
+			t.Errorf("%s holds %q", name, got)
+		}
+	}
+	states := replicaStates(t, db, "abc12/mhtml-aa.mhtml")
+	for _, name := range []string{"primary", "secondary"} {
+		if got := states[name]; got.Status != models.ReplicaStatusOK || got.Size != 4 || got.VerifiedAt == nil {
+			t.Errorf("%s replica = %+v", name, got)
+		}
+	}
+}
+
+func TestReplicatedStorageDeleteKeepsCopiesItCannotRemove(t *testing.T) {
+	store, db, primary, secondary := newReplicatedTestStorage(t)
+	writeObject(t, store, "abc12/yt-dlp-aa.ts", "live")
+	if result := repair(t, store); result.Repaired != 1 {
+		t.Fatalf("Repair = %+v", result)
+	}
+
+	secondary.down = true
+	if err := store.Delete("abc12/yt-dlp-aa.ts"); !errors.Is(err, errBackendDown) {
+		t.Fatalf("Delete with the secondary down = %v", err)
+	}
+	if exists, _ := primary.Exists("abc12/yt-dlp-aa.ts"); exists {
+		t.Error("primary still holds the object")
+	}
+	states := replicaStates(t, db, "abc12/yt-dlp-aa.ts")
+	if _, ok := states["primary"]; ok {
+		t.Errorf("primary replica row kept: %+v", states["primary"])
+	}
+	if got := states["secondary"]; got.Status != models.ReplicaStatusOK {
+		t.Errorf("secondary replica = %+v; want it kept", got)
+	}
+
+	secondary.down = false
+	if err := store.Delete("abc12/yt-dlp-aa.ts"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if exists, _ := store.Exists("abc12/yt-dlp-aa.ts"); exists {
+		t.Error("object still stored")
+	}
+	if states := replicaStates(t, db, "abc12/yt-dlp-aa.ts"); len(states) != 0 {
+		t.Errorf("replica rows left: %+v", states)
+	}
+}
+
+func TestReplicatedStorageLeavesFailedCopiesForRepair(t *testing.T) {
+	store, db, _, secondary := newReplicatedTestStorage(t)
+	secondary.down = true
+	// A secondary outage does not fail the write.
+	writeObject(t, store, "abc12/mhtml-aa.mhtml", "page")
+	if got := replicaStates(t, db, "abc12/mhtml-aa.mhtml")["secondary"]; got.Status != models.ReplicaStatusPending {
+		t.Fatalf("secondary replica = %+v", got)
+	}
+
+	// Still down: the repair fails and is counted.
+	result, err := store.Repair(context.Background(), 10)
+	if err != nil || result.Failed != 1 {
+		t.Fatalf("Repair = %+v, %v", result, err)
+	}
+	got := replicaStates(t, db, "abc12/mhtml-aa.mhtml")["secondary"]
+	if got.Attempts != 1 || !strings.Contains(got.Error, "backend down") {
+		t.Errorf("failed replica = %+v", got)
+	}
+
+	secondary.down = false
+	result, err = store.Repair(context.Background(), 10)
+	if err != nil || result.Repaired != 1 {
+		t.Fatalf("Repair = %+v, %v", result, err)
+	}
+	if got := readObject(t, secondary, "abc12/mhtml-aa.mhtml"); got != "page" {
+		t.Errorf("secondary holds %q", got)
+	}
+	got = replicaStates(t, db, "abc12/mhtml-aa.mhtml")["secondary"]
+	if got.Status != models.ReplicaStatusOK || got.Error != "" || got.Attempts != 0 || got.Size != 4 {
+		t.Errorf("repaired replica = %+v", got)
+	}
+}
+
+func TestReplicatedStorageReadsFailOver(t *testing.T) {
+	store, db, primary, _ := newReplicatedTestStorage(t)
+	writeObject(t, store, "abc12/mhtml-aa.mhtml", "page")
+	writeObject(t, store, "abc12/mhtml-bb.mhtml", "other")
+	repair(t, store)
+
+	// An outage fails over without calling the copy missing.
+	primary.down = true
+	if got := readObject(t, store, "abc12/mhtml-bb.mhtml"); got != "other" {
+		t.Errorf("read during outage = %q", got)
+	}
+	if size, err := store.Size("abc12/mhtml-bb.mhtml"); err != nil || size != 5 {
+		t.Errorf("Size during outage = %d, %v", size, err)
+	}
+	if got := replicaStates(t, db, "abc12/mhtml-bb.mhtml")["primary"]; got.Status != models.ReplicaStatusOK {
+		t.Errorf("primary replica after outage = %+v", got)
+	}
+	primary.down = false
+
+	// A lost object is served from the secondary, recorded, and restored.
+	primary.Delete("abc12/mhtml-aa.mhtml")
+	if got := readObject(t, store, "abc12/mhtml-aa.mhtml"); got != "page" {
+		t.Errorf("failed-over read = %q", got)
+	}
+	if exists, err := store.Exists("abc12/mhtml-aa.mhtml"); err != nil || !exists {
+		t.Errorf("Exists = %v, %v", exists, err)
+	}
+	if got := replicaStates(t, db, "abc12/mhtml-aa.mhtml")["primary"]; got.Status != models.ReplicaStatusMissing {
+		t.Fatalf("primary replica = %+v", got)
+	}
+	if _, err := store.Repair(context.Background(), 10); err != nil {
+		t.Fatal(err)
+	}
+	if got := readObject(t, primary, "abc12/mhtml-aa.mhtml"); got != "page" {
+		t.Errorf("restored primary holds %q", got)
+	}
+	if got := replicaStates(t, db, "abc12/mhtml-aa.mhtml")["primary"]; got.Status != models.ReplicaStatusOK {
+		t.Errorf("restored replica = %+v", got)
+	}
+
+	// Gone everywhere.
+	if _, err := store.Reader("abc12/nothing"); err == nil {
+		t.Error("reading a missing object succeeded")
+	}
+}
+
+func TestReplicatedStorageBackfillsExistingObjects(t *testing.T) {
+	store, db, primary, secondary := newReplicatedTestStorage(t)
+	// Stored before the secondary was added; one of them was copied by hand.
+	writeObject(t, primary.MemoryStorage, "old01/mhtml-aa.mhtml", "old page")
+	writeObject(t, primary.MemoryStorage, "old02/mhtml-aa.mhtml", "copied")
+	writeObject(t, secondary.MemoryStorage, "old02/mhtml-aa.mhtml", "copied")
+	secondary.noOverwrite = true
+
+	walked, err := store.Backfill(context.Background())
+	if err != nil || walked != 2 {
+		t.Fatalf("Backfill = %d, %v", walked, err)
+	}
+	// A second walk adds nothing.
+	if _, err := store.Backfill(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&models.StorageReplica{}).Count(&count)
+	if count != 4 {
+		t.Fatalf("%d replica rows, want 4", count)
+	}
+
+	result, err := store.Repair(context.Background(), 10)
+	if err != nil || result.Repaired != 2 || result.Failed != 0 {
+		t.Fatalf("Repair = %+v, %v", result, err)
+	}
+	if got := readObject(t, secondary, "old01/mhtml-aa.mhtml"); got != "old page" {
+		t.Errorf("secondary holds %q", got)
+	}
+	if secondary.writes != 1 {
+		t.Errorf("secondary written %d times; the copy already there must not be rewritten", secondary.writes)
+	}
+}
+
+func TestReplicatedStorageRepairChecksRecordedChecksums(t *testing.T) {
+	store, db, primary, secondary := newReplicatedTestStorage(t)
+	const key = "abc12/mhtml-aa.mhtml"
+	writeObject(t, store, key, "page")
+	sum := sha256.Sum256([]byte("page"))
+	db.Create(&models.ArchiveItem{StorageKey: key, Checksum: hex.EncodeToString(sum[:])})
+
+	// A same-size copy with other bytes is not taken as repaired.
+	writeObject(t, secondary.MemoryStorage, key, "PAGE")
+	if result := repair(t, store); result.Repaired != 1 {
+		t.Fatalf("Repair = %+v", result)
+	}
+	if got := readObject(t, secondary, key); got != "page" {
+		t.Errorf("secondary holds %q after repair", got)
+	}
+
+	// A damaged source is not copied.
+	writeObject(t, primary.MemoryStorage, key, "PAGE")
+	db.Model(&models.StorageReplica{}).Where("object_key = ? AND backend = ?", key, "secondary").Update("status", models.ReplicaStatusMissing)
+	secondary.Delete(key)
+	if result := repair(t, store); result.Failed != 1 {
+		t.Fatalf("Repair from a damaged source = %+v", result)
+	}
+	if got := replicaStates(t, db, key)["secondary"]; !strings.Contains(got.Error, "SHA-256") {
+		t.Errorf("failed replica = %+v", got)
+	}
+}
+
+func TestOpenBackendNamesLocationsWithoutCredentials(t *testing.T) {
+	backend, err := OpenBackend(context.Background(), "file:///srv/replica", t.TempDir())
+	if err != nil || backend.Name != "file:///srv/replica" {
+		t.Fatalf("file backend = %+v, %v", backend, err)
+	}
+	if _, ok := backend.Storage.(*FSStorage); !ok {
+		t.Errorf("file backend is %T", backend.Storage)
+	}
+
+	backend, err = OpenBackend(context.Background(), "s3://AKID:s3cr%2Ft@archive/arker/?endpoint=https://s3.example.com&region=auto&path_style=true", t.TempDir())
+	if err != nil || backend.Name != "s3://archive/arker" {
+		t.Fatalf("s3 backend = %+v, %v", backend, err)
+	}
+	s3Store, ok := backend.Storage.(*S3Storage)
+	if !ok || s3Store.bucket != "archive" || s3Store.prefix != "arker" {
+		t.Errorf("s3 backend = %#v", backend.Storage)
+	}
+
+	for _, bad := range []string{"ftp://host/path", "s3:///prefix", "file://"} {
+		if _, err := OpenBackend(context.Background(), bad, t.TempDir()); err == nil {
+			t.Errorf("OpenBackend(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestFSStorageWalkListsKeys(t *testing.T) {
+	store := NewFSStorage(t.TempDir())
+	writeObject(t, store, "abc12/mhtml-aa.mhtml", "page")
+	writeObject(t, store, "abc12/hls-aa/seg-0001.ts", "segment")
+
+	got := map[string]int64{}
+	err := store.Walk(context.Background(), func(key string, size int64) error {
+		got[key] = size
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["abc12/mhtml-aa.mhtml"] != 4 || got["abc12/hls-aa/seg-0001.ts"] != 7 {
+		t.Errorf("walked %v", got)
+	}
+}
@@ -190,6 +190,44 @@ func (s *S3Storage) Size(key string) (int64, error) {
 	return *result.ContentLength, nil
 }
 
+// Delete removes an object. In a versioned bucket this only adds a delete
+// marker; the version itself stays until the bucket's lifecycle rules expire
+// it, and a bucket lock may refuse the delete outright.
+func (s *S3Storage) Delete(key string) error {
+	ctx := context.Background()
+
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.buildKey(key)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete object from S3: %w", err)
+	}
+	return nil
+}
+
+// Walk lists every object under the configured prefix
+func (s *S3Storage) Walk(ctx context.Context, fn func(key string, size int64) error) error {
+	prefix := s.buildKey("")
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list objects: %w", err)
+		}
+		for _, object := range page.Contents {
+			key := strings.TrimPrefix(aws.ToString(object.Key), prefix)
+			if err := fn(key, aws.ToInt64(object.Size)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // SeekableReader creates a seekable reader (not fully seekable for S3, but supports range reads)
 func (s *S3Storage) SeekableReader(key string) (ReadSeekCloser, error) {
 	return &s3SeekableReader{
@@ -85,8 +85,32 @@ type YtDlpFake struct {
 
 	// Version is what "--version" reports.
 	Version string
+
+	// PlaylistJSON is what a --flat-playlist --dump-single-json listing run
+	// prints. Without it, a listing run fails like FailProbe does.
+	PlaylistJSON []byte
+
+	// Live makes the URL a stream that is live right now: both probes report
+	// live_status is_live with no duration, and the download run appends a
+	// LiveChunk to its output every 100ms until it is interrupted with
+	// SIGINT or has written LiveChunks chunks.
+	Live bool
+
+	// LiveChunks is how many chunks the stream lasts before it ends on its
+	// own. Zero means it never does.
+	LiveChunks int
 }
 
+// LiveChunk is what the fake yt-dlp appends to a live recording per tick:
+// four MPEG-TS packets, each opening with the 0x47 sync byte.
+var LiveChunk = func() []byte {
+	chunk := bytes.Repeat([]byte{0xff}, 4*188)
+	for i := 0; i < len(chunk); i += 188 {
+		chunk[i] = 0x47
+	}
+	return chunk
+}()
+
 // GalleryDlFake configures the fake gallery-dl. The zero value replays every
 // slide of the named fixture as a clean success.
 type GalleryDlFake struct {
@@ -170,9 +194,18 @@ func InstallFakeYtDlp(t *testing.T, cfg YtDlpFake) string {
 			}
 		}
 	}
+	// The archiver's probe also prints the live status and then the
+	// language; the duration probe prints the live status after the duration.
+	liveStatus := "not_live"
+	if cfg.Live {
+		liveStatus, duration = "is_live", "NA"
+		writeStageFile(t, stage, "live", nil)
+		writeStageFile(t, stage, "live_chunks", []byte(fmt.Sprintf("%d\n", cfg.LiveChunks)))
+		writeStageFile(t, stage, "live_chunk.ts", LiveChunk)
+	}
 	writeStageFile(t, stage, "print.txt",
-		[]byte(strings.Join([]string{title, duration, uploader}, "\n")+"\n"))
-	writeStageFile(t, stage, "duration.txt", []byte(duration+"\n"))
+		[]byte(strings.Join([]string{title, duration, uploader, liveStatus, "NA"}, "\n")+"\n"))
+	writeStageFile(t, stage, "duration.txt", []byte(duration+"\n"+liveStatus+"\n"))
 
 	video := cfg.VideoBytes
 	if video == nil {
@@ -184,6 +217,9 @@ func InstallFakeYtDlp(t *testing.T, cfg YtDlpFake) string {
 		writeStageFile(t, outDir, "payload.jpg", PlaceholderJPEG(t, 640, 360))
 	}
 
+	if cfg.PlaylistJSON != nil {
+		writeStageFile(t, stage, "playlist.json", cfg.PlaylistJSON)
+	}
 	if cfg.FailProbe {
 		writeStageFile(t, stage, "probe_fail", nil)
 	}
@@ -236,6 +272,120 @@ func InstallFakeGalleryDl(t *testing.T, cfg GalleryDlFake) string {
 	return installScript(t, "gallery-dl", fmt.Sprintf(galleryDlScript, stage))
 }
 
+// WhisperFake configures the fake speech-to-text pair: a whisper.cpp-style CLI
+// and the ffmpeg it needs to decode audio first. The zero value transcribes
+// every video to DefaultWhisperVTT and reports no detected language.
+type WhisperFake struct {
+	// VTT is what the transcriber writes. Defaults to DefaultWhisperVTT.
+	VTT string
+
+	// DetectedLanguage is reported on stderr the way whisper.cpp reports
+	// language detection. Empty reports none.
+	DetectedLanguage string
+
+	// Fail makes the transcriber exit non-zero without writing output.
+	Fail bool
+
+	// FailAudio makes ffmpeg fail, the shape of a video with no audio stream.
+	FailAudio bool
+}
+
+// DefaultWhisperVTT is the fake transcriber's default output.
+const DefaultWhisperVTT = "WEBVTT\n\n00:00:00.000 --> 00:00:02.500\n hello from the machine\n\n00:00:02.500 --> 00:00:05.000\n nobody captioned this video\n"
+
+// InstallFakeWhisper puts fake "whisper-cli" and "ffmpeg" binaries earlier on
+// PATH and returns the directory holding them. Each run appends its argv to
+// <dir>/calls.log so a test can assert on how Arker invoked them.
+func InstallFakeWhisper(t *testing.T, cfg WhisperFake) string {
+	t.Helper()
+	stage := t.TempDir()
+	vtt := cfg.VTT
+	if vtt == "" {
+		vtt = DefaultWhisperVTT
+	}
+	writeStageFile(t, stage, "out.vtt", []byte(vtt))
+	if cfg.DetectedLanguage != "" {
+		writeStageFile(t, stage, "detected.txt",
+			[]byte(fmt.Sprintf("whisper_full_with_state: auto-detected language: %s (p = 0.97)\n", cfg.DetectedLanguage)))
+	}
+	if cfg.Fail {
+		writeStageFile(t, stage, "whisper_fail", nil)
+	}
+	if cfg.FailAudio {
+		writeStageFile(t, stage, "ffmpeg_fail", nil)
+	}
+
+	binDir := installScript(t, "whisper-cli", fmt.Sprintf(whisperScript, stage))
+	writeStageFile(t, binDir, "ffmpeg", []byte(fmt.Sprintf(ffmpegScript, stage)))
+	if err := os.Chmod(filepath.Join(binDir, "ffmpeg"), 0o755); err != nil {
+		t.Fatalf("chmod fake ffmpeg: %v", err)
+	}
+	// The calls log lives beside the binaries so the returned directory is
+	// all a test needs.
+	t.Setenv("FAKE_WHISPER_CALLS", filepath.Join(binDir, "calls.log"))
+	return binDir
+}
+
+// FFmpegHLSFake configures the fake ffprobe/ffmpeg pair the HLS packager
+// runs. The zero value probes every input as a one-hour 1920x1080 H.264 video
+// and segments it into two segments per rendition.
+type FFmpegHLSFake struct {
+	// DurationSeconds is what ffprobe reports. Defaults to 3600.
+	DurationSeconds float64
+
+	// NoVideo makes ffprobe report an audio-only file.
+	NoVideo bool
+
+	// FailSegment makes ffmpeg exit non-zero without writing output, the
+	// shape of a codec the fMP4 muxer refuses.
+	FailSegment bool
+}
+
+// InstallFakeFFmpegHLS puts fake "ffprobe" and "ffmpeg" binaries earlier on
+// PATH and returns the directory holding them. ffmpeg writes a media
+// playlist, an init segment and two media segments beside the playlist path
+// it is given (its last argument), and appends its argv to calls.log in the
+// returned directory.
+func InstallFakeFFmpegHLS(t *testing.T, cfg FFmpegHLSFake) string {
+	t.Helper()
+	stage := t.TempDir()
+	duration := cfg.DurationSeconds
+	if duration == 0 {
+		duration = 3600
+	}
+	streams := `{"codec_type":"video","codec_name":"h264","width":1920,"height":1080,"avg_frame_rate":"30/1"},`
+	if cfg.NoVideo {
+		streams = ""
+	}
+	writeStageFile(t, stage, "probe.json", []byte(fmt.Sprintf(
+		`{"streams":[%s{"codec_type":"audio","codec_name":"aac"}],"format":{"duration":"%g","bit_rate":"4000000"}}`,
+		streams, duration)))
+	if cfg.FailSegment {
+		writeStageFile(t, stage, "segment_fail", nil)
+	}
+
+	binDir := installScript(t, "ffprobe", fmt.Sprintf(ffprobeHLSScript, stage))
+	writeStageFile(t, binDir, "ffmpeg", []byte(fmt.Sprintf(ffmpegHLSScript, stage)))
+	if err := os.Chmod(filepath.Join(binDir, "ffmpeg"), 0o755); err != nil {
+		t.Fatalf("chmod fake ffmpeg: %v", err)
+	}
+	return binDir
+}
+
+// InstallFakeFFmpegRemux puts a fake "ffmpeg" earlier on PATH that remuxes
+// the way a live recording is finished: it copies its -i input to its last
+// argument behind a "REMUXED:" marker, so a test can tell the remuxed file from
+// the recording. With fail set it exits non-zero without writing output.
+// Each run's argv is appended to calls.log in the returned directory.
+func InstallFakeFFmpegRemux(t *testing.T, fail bool) string {
+	t.Helper()
+	stage := t.TempDir()
+	if fail {
+		writeStageFile(t, stage, "remux_fail", nil)
+	}
+	return installScript(t, "ffmpeg", fmt.Sprintf(ffmpegRemuxScript, stage))
+}
+
 // installScript writes an executable script named after the tool into a fresh
 // directory and prepends that directory to PATH for the rest of the test.
 func installScript(t *testing.T, name, body string) string {
@@ -327,16 +477,23 @@ func jsonNumberField(t *testing.T, data []byte, key string) string {
 	return "0"
 }
 
-// ytDlpScript is the fake yt-dlp. It recognizes the three ways Arker invokes
+// ytDlpScript is the fake yt-dlp. It recognizes the four ways Arker invokes
 // yt-dlp: --version (utils.YtDlpVersion), --print (the accessibility check in
-// ytdlp.go and the duration probe in utils.ProbeYtDlpDuration), and the real
-// download run, whose -o template tells it where to put the staged output.
+// ytdlp.go and the duration probe in utils.ProbeYtDlpDuration), the playlist
+// listing (--flat-playlist), and the real download run, whose -o template
+// tells it where to put the staged output. Every run's arguments are recorded
+// one per line in args.txt beside the script, in the directory
+// InstallFakeYtDlp returns, for tests that assert on them.
 const ytDlpScript = `#!/bin/sh
 # Fake yt-dlp installed by internal/testfixtures.InstallFakeYtDlp.
 STAGE='%s'
 
+printf '%%s\n' "$@" > "$(dirname "$0")/args.txt"
+
 print_mode=0
+flat_playlist=0
 skip_download=0
+audio_format=''
 out_template=''
 while [ $# -gt 0 ]; do
 	case "$1" in
@@ -351,6 +508,13 @@ while [ $# -gt 0 ]; do
 	--skip-download)
 		skip_download=1
 		;;
+	--flat-playlist)
+		flat_playlist=1
+		;;
+	--audio-format)
+		shift
+		audio_format="$1"
+		;;
 	-o)
 		shift
 		out_template="$1"
@@ -359,6 +523,15 @@ while [ $# -gt 0 ]; do
 	shift
 done
 
+if [ "$flat_playlist" = 1 ]; then
+	if [ ! -f "$STAGE/playlist.json" ]; then
+		cat "$STAGE/error.txt" >&2
+		exit "$(cat "$STAGE/exit_code")"
+	fi
+	cat "$STAGE/playlist.json"
+	exit 0
+fi
+
 if [ "$print_mode" = 1 ]; then
 	if [ -f "$STAGE/probe_fail" ]; then
 		cat "$STAGE/error.txt" >&2
@@ -379,9 +552,36 @@ fi
 
 # Arker passes -o "<tempbase>.%%(ext)s"; strip the template to get the base.
 base=$(printf '%%s' "$out_template" | sed 's/\.%%(ext)s$//')
+
+# A live stream: the sidecars land first, then the recording grows until the
+# stream ends or Arker interrupts it.
+if [ -f "$STAGE/live" ]; then
+	for staged in "$STAGE"/out/*; do
+		[ -e "$staged" ] || continue
+		name=$(basename "$staged")
+		[ "$name" = payload.mp4 ] && continue
+		cp "$staged" "$base${name#payload}"
+	done
+	trap 'echo "ERROR: Interrupted by user" >&2; exit 1' INT
+	limit=$(cat "$STAGE/live_chunks")
+	n=0
+	while [ "$limit" = 0 ] || [ "$n" -lt "$limit" ]; do
+		cat "$STAGE/live_chunk.ts" >> "$base.mp4"
+		n=$((n + 1))
+		sleep 0.1
+	done
+	exit 0
+fi
+
 for staged in "$STAGE"/out/*; do
 	[ -e "$staged" ] || continue
 	name=$(basename "$staged")
+	# --extract-audio replaces the video with the audio in the asked format.
+	# A rule list such as "webm>opus/m4a" converts the MP4 by its fallback,
+	# the last rule.
+	if [ -n "$audio_format" ] && [ "$name" = payload.mp4 ]; then
+		name="payload.${audio_format##*/}"
+	fi
 	cp "$staged" "$base${name#payload}"
 done
 exit 0
@@ -419,3 +619,110 @@ if [ -n "$dest" ]; then
 fi
 exit "$(cat "$STAGE/exit_code")"
 `
+
+// whisperScript is the fake whisper.cpp CLI. Arker passes -of <base> and
+// -ovtt and reads <base>.vtt afterwards; the fake copies the staged VTT there.
+const whisperScript = `#!/bin/sh
+# Fake whisper-cli installed by internal/testfixtures.InstallFakeWhisper.
+STAGE='%s'
+echo "whisper-cli $*" >> "$FAKE_WHISPER_CALLS"
+
+out_base=''
+while [ $# -gt 0 ]; do
+	case "$1" in
+	-of)
+		shift
+		out_base="$1"
+		;;
+	esac
+	shift
+done
+
+if [ -f "$STAGE/whisper_fail" ]; then
+	echo "error: failed to initialize whisper context" >&2
+	exit 3
+fi
+[ -f "$STAGE/detected.txt" ] && cat "$STAGE/detected.txt" >&2
+cp "$STAGE/out.vtt" "$out_base.vtt"
+exit 0
+`
+
+// ffmpegScript is the fake audio decoder. It writes a placeholder to the last
+// argument, which is where Arker asks for the WAV.
+const ffmpegScript = `#!/bin/sh
+# Fake ffmpeg installed by internal/testfixtures.InstallFakeWhisper.
+STAGE='%s'
+echo "ffmpeg $*" >> "$FAKE_WHISPER_CALLS"
+
+if [ -f "$STAGE/ffmpeg_fail" ]; then
+	echo "Output file #0 does not contain any stream" >&2
+	exit 1
+fi
+for last; do :; done
+printf 'RIFF-FIXTURE-WAV' > "$last"
+exit 0
+`
+
+// ffprobeHLSScript drains the input Arker pipes in and prints the staged
+// probe, the way ProbeVideo reads ffprobe.
+const ffprobeHLSScript = `#!/bin/sh
+# Fake ffprobe installed by internal/testfixtures.InstallFakeFFmpegHLS.
+STAGE='%s'
+cat > /dev/null
+cat "$STAGE/probe.json"
+`
+
+// ffmpegHLSScript is the fake segmenter. Real segments are placeholders of
+// different sizes, so bandwidth measurement has something to measure.
+const ffmpegHLSScript = `#!/bin/sh
+# Fake ffmpeg installed by internal/testfixtures.InstallFakeFFmpegHLS.
+STAGE='%s'
+echo "ffmpeg $*" >> "$(dirname "$0")/calls.log"
+
+if [ -f "$STAGE/segment_fail" ]; then
+	echo "Could not find tag for codec in stream #0, codec not currently supported in container" >&2
+	exit 1
+fi
+for last; do :; done
+dir=$(dirname "$last")
+mkdir -p "$dir"
+printf 'INIT' > "$dir/init.mp4"
+head -c 6000 /dev/zero > "$dir/seg_00000.m4s"
+head -c 3000 /dev/zero > "$dir/seg_00001.m4s"
+cat > "$last" <<'PLAYLIST'
+#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-MAP:URI="init.mp4"
+#EXTINF:6.000000,
+seg_00000.m4s
+#EXTINF:4.000000,
+seg_00001.m4s
+#EXT-X-ENDLIST
+PLAYLIST
+exit 0
+`
+
+// ffmpegRemuxScript is the fake remuxer InstallFakeFFmpegRemux installs.
+const ffmpegRemuxScript = `#!/bin/sh
+# Fake ffmpeg installed by internal/testfixtures.InstallFakeFFmpegRemux.
+STAGE='%s'
+echo "ffmpeg $*" >> "$(dirname "$0")/calls.log"
+
+if [ -f "$STAGE/remux_fail" ]; then
+	echo "Invalid data found when processing input" >&2
+	exit 1
+fi
+input=''
+while [ $# -gt 1 ]; do
+	if [ "$1" = -i ]; then
+		shift
+		input="$1"
+	fi
+	shift
+done
+{ printf 'REMUXED:'; cat "$input"; } > "$1"
+exit 0
+`
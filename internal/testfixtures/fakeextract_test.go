@@ -37,14 +37,14 @@ func TestFakeYtDlpAnswersEveryInvocationArkerMakes(t *testing.T) {
 	}
 
 	// utils.ProbeYtDlpDuration: --skip-download, and the first line must
-	// parse as a duration.
-	out, err = exec.Command("yt-dlp", "--print", "duration", "--no-playlist",
+	// parse as a duration, followed by the live status.
+	out, err = exec.Command("yt-dlp", "--print", "duration", "--print", "live_status", "--no-playlist",
 		"--skip-download", "https://www.youtube.com/watch?v=aqz-KE-bpKQ").Output()
 	if err != nil {
 		t.Fatalf("duration probe: %v", err)
 	}
-	if got := strings.TrimSpace(string(out)); got != "635" {
-		t.Errorf("duration probe = %q, want the fixture's duration 635", got)
+	if got := strings.TrimSpace(string(out)); got != "635\nnot_live" {
+		t.Errorf("duration probe = %q, want the fixture's duration 635 and not_live", got)
 	}
 }
 
@@ -232,3 +232,42 @@ func TestSomeFixturesDeliberatelyHaveNoSubtitles(t *testing.T) {
 		}
 	}
 }
+
+func TestFakeWhisperWritesWhereArkerReads(t *testing.T) {
+	bin := InstallFakeWhisper(t, WhisperFake{DetectedLanguage: "de"})
+	dir := t.TempDir()
+	wav := filepath.Join(dir, "video.whisper.wav")
+
+	if out, err := exec.Command("ffmpeg", "-y", "-i", filepath.Join(dir, "video.mp4"), "-vn", wav).CombinedOutput(); err != nil {
+		t.Fatalf("ffmpeg: %v\n%s", err, out)
+	}
+	if _, err := os.Stat(wav); err != nil {
+		t.Fatalf("fake ffmpeg did not write its last argument: %v", err)
+	}
+
+	out, err := exec.Command("whisper-cli", "-m", "model.bin", "-f", wav, "-l", "auto", "-ovtt", "-of", filepath.Join(dir, "video.whisper")).CombinedOutput()
+	if err != nil {
+		t.Fatalf("whisper-cli: %v\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "auto-detected language: de") {
+		t.Errorf("detection line missing: %q", out)
+	}
+	vtt, err := os.ReadFile(filepath.Join(dir, "video.whisper.vtt"))
+	if err != nil || string(vtt) != DefaultWhisperVTT {
+		t.Fatalf("vtt = %q, %v", vtt, err)
+	}
+	calls, _ := os.ReadFile(filepath.Join(bin, "calls.log"))
+	if strings.Count(string(calls), "\n") != 2 {
+		t.Errorf("calls.log = %q, want both invocations", calls)
+	}
+}
+
+func TestFakeWhisperFailures(t *testing.T) {
+	InstallFakeWhisper(t, WhisperFake{Fail: true, FailAudio: true})
+	if err := exec.Command("ffmpeg", "-i", "in.mp4", filepath.Join(t.TempDir(), "out.wav")).Run(); err == nil {
+		t.Error("FailAudio ffmpeg exited 0")
+	}
+	if err := exec.Command("whisper-cli", "-of", filepath.Join(t.TempDir(), "x")).Run(); err == nil {
+		t.Error("Fail whisper-cli exited 0")
+	}
+}
@@ -0,0 +1,516 @@
+// Package timestamp obtains and checks RFC 3161 trusted timestamps: a
+// time-stamping authority's (TSA's) signed statement that it was shown a
+// digest at a given time. Stamping a capture's manifest proves the capture
+// existed no later than that time, on the word of a third party rather than
+// the archive's own clock.
+//
+// Only what timestamping needs of CMS is implemented: SHA-256 requests, and
+// verification of the single SignerInfo a TSA returns, with its certificate
+// chained to a caller-supplied root pool.
+package timestamp
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Content types of RFC 3161 over HTTP.
+const (
+	QueryContentType = "application/timestamp-query"
+	ReplyContentType = "application/timestamp-reply"
+)
+
+// maxResponseSize bounds a TSA reply; real ones are a few kilobytes.
+const maxResponseSize = 1 << 20
+
+// Object identifiers used by requests, tokens and their signatures.
+var (
+	OIDSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	OIDSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	OIDTSTInfo    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+
+	OIDAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	OIDAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECPublicKey     = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidEd25519         = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// ErrMismatch is returned when a token stamps some other digest.
+var ErrMismatch = errors.New("timestamp: token is for a different digest")
+
+// MessageImprint is the digest a token vouches for.
+type MessageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint MessageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+}
+
+// PKIStatusInfo is the status of a TSA reply.
+type PKIStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+// Reply statuses that carry a token.
+const (
+	StatusGranted         = 0
+	StatusGrantedWithMods = 1
+)
+
+// TimeStampResp is a TSA reply. TimeStampToken is a CMS ContentInfo.
+type TimeStampResp struct {
+	Status         PKIStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+// ContentInfo wraps CMS content. Content holds the [0] EXPLICIT wrapper;
+// its Bytes are the encoded SignedData.
+type ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0"`
+}
+
+// SignedData is the CMS structure a token signs its TSTInfo with.
+type SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo EncapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []SignerInfo  `asn1:"set"`
+}
+
+// EncapsulatedContentInfo carries the signed content. EContent holds the
+// [0] EXPLICIT wrapper around an OCTET STRING.
+type EncapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// SignerInfo is one signature over the content. SID is an
+// IssuerAndSerialNumber or a [0] SubjectKeyIdentifier; SignedAttrs is
+// [0] IMPLICIT.
+type SignerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// IssuerAndSerialNumber names a signer's certificate.
+type IssuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// Attribute is one CMS attribute; Values is the SET of its values.
+type Attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// TSTInfo is what a TSA signs. GenTime is kept raw: TSAs commonly send
+// fractional seconds, which encoding/asn1 refuses.
+type TSTInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint MessageImprint
+	SerialNumber   *big.Int
+	GenTime        asn1.RawValue
+	Accuracy       Accuracy         `asn1:"optional"`
+	Ordering       bool             `asn1:"optional"`
+	Nonce          *big.Int         `asn1:"optional"`
+	TSA            asn1.RawValue    `asn1:"optional,tag:0"`
+	Extensions     []pkix.Extension `asn1:"optional,tag:1"`
+}
+
+// Accuracy is how far GenTime may be from the true time.
+type Accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+// Token is a verified timestamp.
+type Token struct {
+	// Time is when the TSA saw the digest, within Accuracy.
+	Time     time.Time
+	Accuracy time.Duration
+	// SerialNumber is unique among the TSA's tokens.
+	SerialNumber *big.Int
+	Policy       asn1.ObjectIdentifier
+	// TSA names the authority: the name it gave in the token, or the
+	// subject of the certificate it signed with.
+	TSA           string
+	Signer        *x509.Certificate
+	HashedMessage []byte
+	Nonce         *big.Int
+}
+
+// Authority is a TSA reached over HTTP.
+type Authority struct {
+	URL string
+	// Roots verify the TSA's certificate; nil means the system roots.
+	Roots *x509.CertPool
+	// Client sends requests; nil means a client with a one-minute timeout.
+	Client *http.Client
+}
+
+// Stamp asks the authority to timestamp a SHA-256 digest. It returns the
+// TSA's reply, DER-encoded as received, and the verified token in it.
+func (a *Authority) Stamp(ctx context.Context, digest []byte) ([]byte, *Token, error) {
+	if len(digest) != sha256.Size {
+		return nil, nil, fmt.Errorf("timestamp: digest is %d bytes, want a SHA-256", len(digest))
+	}
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, nil, err
+	}
+	query, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: MessageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: OIDSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: digest,
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.URL, bytes.NewReader(query))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", QueryContentType)
+	req.Header.Set("Accept", ReplyContentType)
+	client := a.Client
+	if client == nil {
+		client = &http.Client{Timeout: time.Minute}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("timestamp: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("timestamp: %s answered %s", a.URL, resp.Status)
+	}
+	reply, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, nil, fmt.Errorf("timestamp: reading reply: %w", err)
+	}
+
+	token, err := Verify(reply, digest, a.Roots)
+	if err != nil {
+		return nil, nil, err
+	}
+	if token.Nonce == nil || token.Nonce.Cmp(nonce) != 0 {
+		return nil, nil, errors.New("timestamp: reply does not answer this request (nonce differs)")
+	}
+	return reply, token, nil
+}
+
+// Verify checks a TSA reply, or a bare token, against a SHA-256 digest: the
+// token must stamp that digest and be signed by a certificate for time
+// stamping that chains to roots (nil means the system roots) as of the
+// stamped time.
+func Verify(data, digest []byte, roots *x509.CertPool) (*Token, error) {
+	tokenDER := data
+	var resp TimeStampResp
+	if rest, err := asn1.Unmarshal(data, &resp); err == nil && len(rest) == 0 {
+		if resp.Status.Status != StatusGranted && resp.Status.Status != StatusGrantedWithMods {
+			return nil, fmt.Errorf("timestamp: request refused (status %d: %s)",
+				resp.Status.Status, strings.Join(resp.Status.StatusString, "; "))
+		}
+		if len(resp.TimeStampToken.FullBytes) == 0 {
+			return nil, errors.New("timestamp: reply carries no token")
+		}
+		tokenDER = resp.TimeStampToken.FullBytes
+	}
+
+	var ci ContentInfo
+	if rest, err := asn1.Unmarshal(tokenDER, &ci); err != nil || len(rest) != 0 {
+		return nil, errors.New("timestamp: not a timestamp reply or token")
+	}
+	if !ci.ContentType.Equal(OIDSignedData) {
+		return nil, fmt.Errorf("timestamp: token content is %v, not signed data", ci.ContentType)
+	}
+	var sd SignedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("timestamp: reading signed data: %w", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(OIDTSTInfo) {
+		return nil, fmt.Errorf("timestamp: token signs %v, not a TSTInfo", sd.EncapContentInfo.EContentType)
+	}
+	var eContent []byte
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent.Bytes, &eContent); err != nil {
+		return nil, fmt.Errorf("timestamp: reading signed content: %w", err)
+	}
+	var info TSTInfo
+	if _, err := asn1.Unmarshal(eContent, &info); err != nil {
+		return nil, fmt.Errorf("timestamp: reading TSTInfo: %w", err)
+	}
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(OIDSHA256) ||
+		!bytes.Equal(info.MessageImprint.HashedMessage, digest) {
+		return nil, ErrMismatch
+	}
+	genTime, err := parseGenTime(info.GenTime)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("timestamp: token has %d signers, want 1", len(sd.SignerInfos))
+	}
+	si := sd.SignerInfos[0]
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("timestamp: reading certificates: %w", err)
+	}
+	signer, err := findSigner(si.SID, certs)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSignerInfo(si, signer, eContent); err != nil {
+		return nil, err
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs {
+		if cert != signer {
+			intermediates.AddCert(cert)
+		}
+	}
+	if _, err := signer.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   genTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}); err != nil {
+		return nil, fmt.Errorf("timestamp: TSA certificate: %w", err)
+	}
+
+	token := &Token{
+		Time: genTime,
+		Accuracy: time.Duration(info.Accuracy.Seconds)*time.Second +
+			time.Duration(info.Accuracy.Millis)*time.Millisecond +
+			time.Duration(info.Accuracy.Micros)*time.Microsecond,
+		SerialNumber:  info.SerialNumber,
+		Policy:        info.Policy,
+		TSA:           tsaName(info.TSA, signer),
+		Signer:        signer,
+		HashedMessage: info.MessageImprint.HashedMessage,
+		Nonce:         info.Nonce,
+	}
+	return token, nil
+}
+
+// checkSignerInfo checks that si signs content with signer's key. A TSA
+// always signs attributes (RFC 3161 requires the signing-certificate one),
+// so a SignerInfo without them is refused.
+func checkSignerInfo(si SignerInfo, signer *x509.Certificate, content []byte) error {
+	if len(si.SignedAttrs.FullBytes) == 0 {
+		return errors.New("timestamp: token has no signed attributes")
+	}
+	hash, ok := digestHash(si.DigestAlgorithm.Algorithm)
+	if !ok {
+		return fmt.Errorf("timestamp: unsupported digest algorithm %v", si.DigestAlgorithm.Algorithm)
+	}
+	var contentType asn1.ObjectIdentifier
+	var messageDigest []byte
+	rest := si.SignedAttrs.Bytes
+	for len(rest) > 0 {
+		var attr Attribute
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			return fmt.Errorf("timestamp: reading signed attributes: %w", err)
+		}
+		switch {
+		case attr.Type.Equal(OIDAttributeContentType):
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &contentType); err != nil {
+				return fmt.Errorf("timestamp: reading content type: %w", err)
+			}
+		case attr.Type.Equal(OIDAttributeMessageDigest):
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &messageDigest); err != nil {
+				return fmt.Errorf("timestamp: reading message digest: %w", err)
+			}
+		}
+	}
+	if !contentType.Equal(OIDTSTInfo) {
+		return errors.New("timestamp: signed attributes name another content type")
+	}
+	h := hash.New()
+	h.Write(content)
+	if !bytes.Equal(h.Sum(nil), messageDigest) {
+		return errors.New("timestamp: signed attributes do not match the content")
+	}
+
+	algorithm, ok := signatureAlgorithm(si.SignatureAlgorithm.Algorithm, hash)
+	if !ok {
+		return fmt.Errorf("timestamp: unsupported signature algorithm %v", si.SignatureAlgorithm.Algorithm)
+	}
+	// The signature covers the attributes encoded as a SET, not with the
+	// [0] IMPLICIT tag they are carried under.
+	signed := append([]byte(nil), si.SignedAttrs.FullBytes...)
+	signed[0] = 0x31
+	if err := signer.CheckSignature(algorithm, signed, si.Signature); err != nil {
+		return fmt.Errorf("timestamp: signature does not verify: %w", err)
+	}
+	return nil
+}
+
+// findSigner picks the certificate a SignerInfo names.
+func findSigner(sid asn1.RawValue, certs []*x509.Certificate) (*x509.Certificate, error) {
+	switch {
+	case sid.Class == asn1.ClassUniversal && sid.Tag == asn1.TagSequence:
+		var ias IssuerAndSerialNumber
+		if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+			return nil, fmt.Errorf("timestamp: reading signer identifier: %w", err)
+		}
+		for _, cert := range certs {
+			if cert.SerialNumber.Cmp(ias.SerialNumber) == 0 && bytes.Equal(cert.RawIssuer, ias.Issuer.FullBytes) {
+				return cert, nil
+			}
+		}
+	case sid.Class == asn1.ClassContextSpecific && sid.Tag == 0:
+		for _, cert := range certs {
+			if bytes.Equal(cert.SubjectKeyId, sid.Bytes) {
+				return cert, nil
+			}
+		}
+	}
+	return nil, errors.New("timestamp: token does not include the TSA's certificate")
+}
+
+func digestHash(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	switch {
+	case oid.Equal(OIDSHA256):
+		return crypto.SHA256, true
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, true
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+// signatureAlgorithm maps a SignerInfo's signature algorithm to x509's.
+// CMS often names only the key type and leaves the hash to the digest
+// algorithm.
+func signatureAlgorithm(oid asn1.ObjectIdentifier, hash crypto.Hash) (x509.SignatureAlgorithm, bool) {
+	switch {
+	case oid.Equal(oidEd25519):
+		return x509.PureEd25519, true
+	case oid.Equal(oidSHA256WithRSA):
+		return x509.SHA256WithRSA, true
+	case oid.Equal(oidSHA384WithRSA):
+		return x509.SHA384WithRSA, true
+	case oid.Equal(oidSHA512WithRSA):
+		return x509.SHA512WithRSA, true
+	case oid.Equal(oidECDSAWithSHA256):
+		return x509.ECDSAWithSHA256, true
+	case oid.Equal(oidECDSAWithSHA384):
+		return x509.ECDSAWithSHA384, true
+	case oid.Equal(oidECDSAWithSHA512):
+		return x509.ECDSAWithSHA512, true
+	case oid.Equal(oidRSAEncryption):
+		switch hash {
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, true
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, true
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, true
+		}
+	case oid.Equal(oidECPublicKey):
+		switch hash {
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, true
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, true
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, true
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, false
+}
+
+// parseGenTime reads a GeneralizedTime, fractional seconds included.
+func parseGenTime(raw asn1.RawValue) (time.Time, error) {
+	if raw.Class != asn1.ClassUniversal || raw.Tag != asn1.TagGeneralizedTime {
+		return time.Time{}, errors.New("timestamp: token time is not a GeneralizedTime")
+	}
+	t, err := time.Parse("20060102150405Z0700", string(raw.Bytes))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("timestamp: reading token time: %w", err)
+	}
+	return t.UTC(), nil
+}
+
+// tsaName returns the directory name a token gives its TSA, or the signer's
+// subject when it gives none.
+func tsaName(raw asn1.RawValue, signer *x509.Certificate) string {
+	// tsa is [0] EXPLICIT GeneralName; directoryName is [4] EXPLICIT Name.
+	var general asn1.RawValue
+	if _, err := asn1.Unmarshal(raw.Bytes, &general); err == nil &&
+		general.Class == asn1.ClassContextSpecific && general.Tag == 4 {
+		var rdns pkix.RDNSequence
+		if _, err := asn1.Unmarshal(general.Bytes, &rdns); err == nil {
+			var name pkix.Name
+			name.FillFromRDNSequence(&rdns)
+			return name.String()
+		}
+	}
+	return signer.Subject.String()
+}
+
+// Digest is the SHA-256 a token over data stamps.
+func Digest(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// LoadRoots reads PEM certificates into a pool.
+func LoadRoots(pemData []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, errors.New("timestamp: no certificates in PEM data")
+	}
+	return pool, nil
+}
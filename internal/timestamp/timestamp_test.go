@@ -0,0 +1,124 @@
+package timestamp_test
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"arker/internal/timestamp"
+	"arker/internal/timestamp/tsatest"
+)
+
+func TestStampAndVerify(t *testing.T) {
+	tsa := tsatest.NewServer()
+	defer tsa.Close()
+	stamped := time.Date(2026, 3, 4, 5, 6, 7, 890e6, time.UTC)
+	tsa.SetNow(func() time.Time { return stamped })
+
+	digest := timestamp.Digest([]byte("manifest bytes"))
+	reply, token, err := tsa.Authority().Stamp(context.Background(), digest)
+	if err != nil {
+		t.Fatalf("Stamp: %v", err)
+	}
+	if !token.Time.Equal(stamped) {
+		t.Errorf("Time = %v, want %v (fractional seconds kept)", token.Time, stamped)
+	}
+	if token.Accuracy != time.Second {
+		t.Errorf("Accuracy = %v, want 1s", token.Accuracy)
+	}
+	if !token.Policy.Equal(tsatest.Policy) {
+		t.Errorf("Policy = %v", token.Policy)
+	}
+	if !strings.Contains(token.TSA, "tsatest TSA") {
+		t.Errorf("TSA = %q, want the signer's subject", token.TSA)
+	}
+	if token.SerialNumber.Int64() != 1 {
+		t.Errorf("SerialNumber = %v, want 1", token.SerialNumber)
+	}
+
+	// The stored reply verifies later on its own.
+	again, err := timestamp.Verify(reply, digest, tsa.Roots)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !again.Time.Equal(stamped) {
+		t.Errorf("re-verified Time = %v", again.Time)
+	}
+
+	// So does the bare token inside it.
+	var resp timestamp.TimeStampResp
+	if _, err := asn1.Unmarshal(reply, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := timestamp.Verify(resp.TimeStampToken.FullBytes, digest, tsa.Roots); err != nil {
+		t.Errorf("Verify(token): %v", err)
+	}
+
+	if _, err := timestamp.Verify(reply, timestamp.Digest([]byte("other")), tsa.Roots); !errors.Is(err, timestamp.ErrMismatch) {
+		t.Errorf("Verify(other digest) = %v, want ErrMismatch", err)
+	}
+	if _, err := timestamp.Verify(reply, digest, x509.NewCertPool()); err == nil {
+		t.Error("Verify with an unrelated root succeeded")
+	}
+
+	// A flipped byte in the signed content breaks the signature or the
+	// attributes that bind it.
+	tampered := append([]byte(nil), reply...)
+	i := strings.Index(string(tampered), stamped.Format("20060102150405"))
+	if i < 0 {
+		t.Fatal("time not found in reply")
+	}
+	tampered[i+3]++
+	if _, err := timestamp.Verify(tampered, digest, tsa.Roots); err == nil {
+		t.Error("Verify of a tampered reply succeeded")
+	}
+}
+
+func TestStampRefused(t *testing.T) {
+	tsa := tsatest.NewServer()
+	defer tsa.Close()
+	tsa.Refuse(true)
+
+	_, _, err := tsa.Authority().Stamp(context.Background(), timestamp.Digest([]byte("x")))
+	if err == nil || !strings.Contains(err.Error(), "refused by test") {
+		t.Fatalf("Stamp = %v, want the TSA's refusal", err)
+	}
+	if _, _, err := tsa.Authority().Stamp(context.Background(), []byte("short")); err == nil {
+		t.Error("Stamp accepted a digest that is not SHA-256")
+	}
+}
+
+// TestOpenSSLVerifies checks the stand-in's replies, and so this package's
+// reading of them, against an independent implementation.
+func TestOpenSSLVerifies(t *testing.T) {
+	openssl, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Skip("openssl not installed")
+	}
+	tsa := tsatest.NewServer()
+	defer tsa.Close()
+
+	dir := t.TempDir()
+	data := []byte("signed manifest envelope")
+	reply, _, err := tsa.Authority().Stamp(context.Background(), timestamp.Digest(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string][]byte{"data": data, "reply.tsr": reply, "ca.pem": tsa.RootPEM} {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command(openssl, "ts", "-verify", "-data", "data", "-in", "reply.tsr", "-CAfile", "ca.pem")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("openssl ts -verify: %v\n%s", err, out)
+	}
+}
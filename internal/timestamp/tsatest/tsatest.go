@@ -0,0 +1,290 @@
+// Package tsatest runs a local RFC 3161 time-stamping authority, so
+// timestamping can be tested without a network or a real TSA.
+//
+// This is a test-only package by convention (nothing outside _test.go files
+// imports it), in the same spirit as net/http/httptest.
+package tsatest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"time"
+
+	"arker/internal/timestamp"
+)
+
+var (
+	oidECDSAWithSHA256           = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidAttributeSigningCertV2    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidKPTimeStamping            = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}
+)
+
+// Policy is the policy the stand-in stamps under.
+var Policy = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+
+// Server is a running stand-in TSA. It signs with an ECDSA key whose
+// certificate is issued by a throwaway root.
+type Server struct {
+	*httptest.Server
+	// Roots holds the stand-in's root certificate.
+	Roots *x509.CertPool
+	// RootPEM is that root, PEM-encoded.
+	RootPEM []byte
+	// Cert is the certificate tokens are signed with.
+	Cert *x509.Certificate
+
+	key *ecdsa.PrivateKey
+
+	mu       sync.Mutex
+	now      func() time.Time
+	refuse   bool
+	requests int
+	serial   int64
+}
+
+// NewServer starts a stand-in TSA. Close it when done.
+func NewServer() *Server {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	// Valid for years either side of now, so tests can stamp any time.
+	notBefore := time.Now().AddDate(-10, 0, 0)
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "tsatest root"},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.AddDate(20, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		panic(err)
+	}
+	root, _ := x509.ParseCertificate(rootDER)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	// RFC 3161 requires the time-stamping EKU, alone and critical; x509
+	// only writes it non-critical, so the extension is built by hand.
+	eku, _ := asn1.Marshal([]asn1.ObjectIdentifier{oidKPTimeStamping})
+	leafTemplate := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		Subject:         pkix.Name{CommonName: "tsatest TSA", Organization: []string{"Arker tests"}},
+		NotBefore:       notBefore,
+		NotAfter:        notBefore.AddDate(20, 0, 0),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtraExtensions: []pkix.Extension{{Id: oidExtensionExtendedKeyUsage, Critical: true, Value: eku}},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, root, &key.PublicKey, rootKey)
+	if err != nil {
+		panic(err)
+	}
+	leaf, _ := x509.ParseCertificate(leafDER)
+
+	s := &Server{
+		Roots:   x509.NewCertPool(),
+		RootPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootDER}),
+		Cert:    leaf,
+		key:     key,
+		now:     time.Now,
+	}
+	s.Roots.AddCert(root)
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// SetNow fixes the time the stand-in stamps.
+func (s *Server) SetNow(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+// Refuse makes the stand-in reject requests with a "rejection" status.
+func (s *Server) Refuse(refuse bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refuse = refuse
+}
+
+// Requests reports how many requests the stand-in has answered.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Authority returns an authority for the stand-in that trusts its root.
+func (s *Server) Authority() *timestamp.Authority {
+	return &timestamp.Authority{URL: s.URL, Roots: s.Roots, Client: s.Client()}
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint timestamp.MessageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+}
+
+type essCertIDv2 struct {
+	CertHash []byte
+}
+
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != timestamp.QueryContentType {
+		http.Error(w, "expected a timestamp query", http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req timeStampReq
+	if _, err := asn1.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests++
+	s.serial++
+	serial, now, refuse := s.serial, s.now(), s.refuse
+	s.mu.Unlock()
+
+	var resp timestamp.TimeStampResp
+	if refuse {
+		resp.Status = timestamp.PKIStatusInfo{Status: 2, StatusString: []string{"refused by test"}}
+	} else if resp.TimeStampToken, err = s.token(req, serial, now); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out, err := asn1.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", timestamp.ReplyContentType)
+	w.Write(out)
+}
+
+// token signs a TSTInfo for req as a CMS SignedData.
+func (s *Server) token(req timeStampReq, serial int64, now time.Time) (asn1.RawValue, error) {
+	info, err := asn1.Marshal(timestamp.TSTInfo{
+		Version:        1,
+		Policy:         Policy,
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   big.NewInt(serial),
+		GenTime: asn1.RawValue{
+			Tag:   asn1.TagGeneralizedTime,
+			Bytes: []byte(now.UTC().Format("20060102150405.000Z")),
+		},
+		Accuracy: timestamp.Accuracy{Seconds: 1},
+		Nonce:    req.Nonce,
+	})
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	infoDigest := sha256.Sum256(info)
+	certDigest := sha256.Sum256(s.Cert.Raw)
+
+	var attrs [][]byte
+	for _, a := range []struct {
+		oid   asn1.ObjectIdentifier
+		value any
+	}{
+		{timestamp.OIDAttributeContentType, timestamp.OIDTSTInfo},
+		{timestamp.OIDAttributeMessageDigest, infoDigest[:]},
+		{oidAttributeSigningCertV2, signingCertificateV2{Certs: []essCertIDv2{{CertHash: certDigest[:]}}}},
+	} {
+		value, err := asn1.Marshal(a.value)
+		if err != nil {
+			return asn1.RawValue{}, err
+		}
+		attr, err := asn1.Marshal(timestamp.Attribute{
+			Type:   a.oid,
+			Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: value},
+		})
+		if err != nil {
+			return asn1.RawValue{}, err
+		}
+		attrs = append(attrs, attr)
+	}
+	// DER orders a SET OF by encoding.
+	sort.Slice(attrs, func(i, j int) bool { return bytes.Compare(attrs[i], attrs[j]) < 0 })
+	attrBytes := bytes.Join(attrs, nil)
+	signedSet, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrBytes})
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	signedDigest := sha256.Sum256(signedSet)
+	signature, err := ecdsa.SignASN1(rand.Reader, s.key, signedDigest[:])
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+
+	sha256ID := pkix.AlgorithmIdentifier{Algorithm: timestamp.OIDSHA256, Parameters: asn1.NullRawValue}
+	eContent, err := asn1.Marshal(info)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	sid, err := asn1.Marshal(timestamp.IssuerAndSerialNumber{
+		Issuer:       asn1.RawValue{FullBytes: s.Cert.RawIssuer},
+		SerialNumber: s.Cert.SerialNumber,
+	})
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	signedData, err := asn1.Marshal(timestamp.SignedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256ID},
+		EncapContentInfo: timestamp.EncapsulatedContentInfo{
+			EContentType: timestamp.OIDTSTInfo,
+			EContent:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: eContent},
+		},
+		Certificates: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: s.Cert.Raw},
+		SignerInfos: []timestamp.SignerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    sha256ID,
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrBytes},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256},
+			Signature:          signature,
+		}},
+	})
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	contentInfo, err := asn1.Marshal(timestamp.ContentInfo{
+		ContentType: timestamp.OIDSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	return asn1.RawValue{FullBytes: contentInfo}, nil
+}
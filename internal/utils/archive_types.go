@@ -13,6 +13,21 @@ const (
 	ArchiveTypeYtDlp      = "yt-dlp"
 	ArchiveTypeGalleryDl  = "gallery-dl"
 	ArchiveTypeItch       = "itch"
+	// ArchiveTypePlaylist enumerates a playlist or channel with yt-dlp and
+	// queues one child capture per video; its own artifact is the listing.
+	ArchiveTypePlaylist = "playlist"
+	// ArchiveTypeAudio is a podcast episode or music track downloaded with
+	// yt-dlp, audio only.
+	ArchiveTypeAudio = "audio"
+	// ArchiveTypePDF is a web page printed to PDF by the browser, with the
+	// page's print stylesheet applied.
+	ArchiveTypePDF = "pdf"
+	// ArchiveTypeFile is a non-HTML URL (a PDF, an image, a ZIP, any
+	// download) stored byte for byte as the server sent it.
+	ArchiveTypeFile = "file"
+	// ArchiveTypeForge is a project's record on its code host -- issues,
+	// pull requests, releases, wiki and metadata -- read from the host's API.
+	ArchiveTypeForge = "forge"
 )
 
 // canonicalArchiveTypes is the set of types the system creates today.
@@ -23,6 +38,11 @@ var canonicalArchiveTypes = []string{
 	ArchiveTypeYtDlp,
 	ArchiveTypeGalleryDl,
 	ArchiveTypeItch,
+	ArchiveTypePlaylist,
+	ArchiveTypeAudio,
+	ArchiveTypePDF,
+	ArchiveTypeFile,
+	ArchiveTypeForge,
 }
 
 // legacyArchiveTypeAliases maps retired type names to their canonical form.
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// audioEnclosureExtensions are the file extensions of a bare audio file, the
+// shape of a podcast feed's enclosure URL.
+var audioEnclosureExtensions = map[string]bool{
+	".mp3":  true,
+	".m4a":  true,
+	".aac":  true,
+	".opus": true,
+	".ogg":  true,
+	".oga":  true,
+	".flac": true,
+	".wav":  true,
+}
+
+// soundCloudReservedPaths are the first path segments of SoundCloud pages
+// that are not an artist.
+var soundCloudReservedPaths = map[string]bool{
+	"discover": true, "search": true, "stream": true, "upload": true, "charts": true,
+	"you": true, "pages": true, "settings": true, "messages": true, "notifications": true,
+}
+
+// soundCloudArtistTabs are the second path segments of an artist's pages
+// that list tracks rather than naming one.
+var soundCloudArtistTabs = map[string]bool{
+	"sets": true, "tracks": true, "albums": true, "likes": true, "reposts": true,
+	"popular-tracks": true, "followers": true, "following": true, "comments": true,
+}
+
+// IsAudioURL reports whether a URL names one audio episode or track.
+//
+// Shapes recognized:
+//
+//	soundcloud.com/<artist>/<track>, on.soundcloud.com/<code>
+//	<artist>.bandcamp.com/track/<slug>
+//	mixcloud.com/<user>/<show>
+//	podcasts.apple.com/.../id<show>?i=<episode>
+//	audioboom.com/posts/<id>
+//	any http(s) URL whose path ends in an audio file extension
+//
+// Like IsPlaylistURL, this recognizes single items only: a SoundCloud set, a
+// Bandcamp album or an Apple Podcasts show page is many episodes, not one.
+func IsAudioURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return false
+	}
+	if IsAudioEnclosureURL(rawURL) {
+		return true
+	}
+	hostname := strings.ToLower(parsed.Hostname())
+	segments := splitPathSegments(parsed.Path)
+
+	switch {
+	case hostname == "on.soundcloud.com":
+		return len(segments) == 1
+	case hostMatches(hostname, "soundcloud.com"):
+		return len(segments) == 2 &&
+			!soundCloudReservedPaths[strings.ToLower(segments[0])] &&
+			!soundCloudArtistTabs[strings.ToLower(segments[1])]
+	case hostMatches(hostname, "bandcamp.com"):
+		return len(segments) == 2 && strings.EqualFold(segments[0], "track")
+	case hostMatches(hostname, "mixcloud.com"):
+		return len(segments) == 2
+	case hostname == "podcasts.apple.com":
+		return parsed.Query().Get("i") != ""
+	case hostMatches(hostname, "audioboom.com"):
+		return len(segments) == 2 && strings.EqualFold(segments[0], "posts")
+	}
+	return false
+}
+
+// IsAudioEnclosureURL reports whether a URL points straight at an audio file
+// rather than at a page. Only the path is checked: enclosure URLs usually
+// carry tracking or signing query parameters.
+func IsAudioEnclosureURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return false
+	}
+	return audioEnclosureExtensions[strings.ToLower(path.Ext(parsed.Path))]
+}
@@ -0,0 +1,53 @@
+package utils
+
+import "testing"
+
+func TestIsAudioURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://soundcloud.com/someone/a-track", true},
+		{"https://m.soundcloud.com/someone/a-track?si=abc", true},
+		{"https://on.soundcloud.com/AbCdEf", true},
+		{"https://someone.bandcamp.com/track/a-song", true},
+		{"https://www.mixcloud.com/someone/a-mix/", true},
+		{"https://podcasts.apple.com/us/podcast/a-show/id1234567?i=1000650000001", true},
+		{"https://audioboom.com/posts/8412345-an-episode", true},
+		{"https://cdn.example.com/feeds/episode-12.mp3", true},
+		{"https://dts.podtrac.com/redirect.mp3/example.com/ep12.mp3?utm_source=feed", true},
+		{"http://example.com/audio/episode.M4A", true},
+		{"https://example.com/sounds/clip.opus", true},
+
+		// Lists of tracks and the pages around them are not one item.
+		{"https://soundcloud.com/someone", false},
+		{"https://soundcloud.com/someone/sets/an-album", false},
+		{"https://soundcloud.com/someone/tracks", false},
+		{"https://soundcloud.com/discover/sets", false},
+		{"https://someone.bandcamp.com/album/an-album", false},
+		{"https://someone.bandcamp.com/", false},
+		{"https://www.mixcloud.com/someone/", false},
+		{"https://podcasts.apple.com/us/podcast/a-show/id1234567", false},
+		{"https://audioboom.com/channels/123", false},
+		{"https://example.com/episode-12", false},
+		{"https://example.com/mp3/list", false},
+		{"ftp://example.com/episode.mp3", false},
+	}
+	for _, tt := range tests {
+		if got := IsAudioURL(tt.url); got != tt.want {
+			t.Errorf("IsAudioURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestIsAudioEnclosureURLChecksThePathOnly(t *testing.T) {
+	if !IsAudioEnclosureURL("https://cdn.example.com/ep12.mp3?token=abc.mp4") {
+		t.Error("an MP3 path with a signed query is an enclosure")
+	}
+	if IsAudioEnclosureURL("https://example.com/player?file=ep12.mp3") {
+		t.Error("a page whose query names an MP3 is not an enclosure")
+	}
+	if IsAudioEnclosureURL("https://soundcloud.com/someone/a-track") {
+		t.Error("a track page is not an enclosure")
+	}
+}
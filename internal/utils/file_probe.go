@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// remoteContentProbe answers what a URL actually serves, which only a request
+// can tell: "/download?id=7" is as likely a ZIP as a page. It is installed at
+// startup rather than called unconditionally so that routing stays a pure
+// function in tests and wherever no probe is configured.
+var remoteContentProbe atomic.Value // of contentProbe
+
+type contentProbe struct {
+	probe func(rawURL string) string
+}
+
+// SetRemoteContentProbe installs the function GetArchiveTypes asks for a URL's
+// media type. It returns "" when it cannot tell, which keeps the URL routed as
+// a web page. A nil probe disables probing.
+func SetRemoteContentProbe(probe func(rawURL string) string) {
+	remoteContentProbe.Store(contentProbe{probe: probe})
+}
+
+// RemoteContentType returns the probed media type of a URL, or "" when no
+// probe is installed or it could not tell.
+func RemoteContentType(rawURL string) string {
+	p, _ := remoteContentProbe.Load().(contentProbe)
+	if p.probe == nil {
+		return ""
+	}
+	return p.probe(rawURL)
+}
+
+// IsPageContentType reports whether a media type is something the browser
+// archivers capture meaningfully: an HTML or XHTML document. Everything else
+// (PDFs, images, archives, octet streams) renders as a blank page or a
+// download prompt in a browser and belongs to the file archiver.
+func IsPageContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// probeSniffBytes is how much of the body is read when the server sends no
+// Content-Type; http.DetectContentType looks at no more than this.
+const probeSniffBytes = 512
+
+// NewHTTPContentProbe returns a probe that asks the server with a HEAD
+// request, falling back to a ranged GET when HEAD is refused, and sniffs the
+// first bytes when neither response names a type. The URL and every redirect
+// must pass ValidateURL; a refused one is a probe that could not tell.
+func NewHTTPContentProbe(timeout time.Duration) func(rawURL string) string {
+	return newHTTPContentProbe(timeout, ValidateURL)
+}
+
+func newHTTPContentProbe(timeout time.Duration, validate func(rawURL string) error) func(rawURL string) string {
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return validate(req.URL.String())
+		},
+	}
+	return func(rawURL string) string {
+		if validate(rawURL) != nil {
+			return ""
+		}
+		if contentType := probeContentType(client, http.MethodHead, rawURL); contentType != "" {
+			return contentType
+		}
+		return probeContentType(client, http.MethodGet, rawURL)
+	}
+}
+
+func probeContentType(client *http.Client, method, rawURL string) string {
+	req, err := http.NewRequest(method, rawURL, nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	if method == http.MethodGet {
+		req.Header.Set("Range", "bytes=0-511")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return ""
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		return contentType
+	}
+	if method == http.MethodHead {
+		return ""
+	}
+	head, err := io.ReadAll(io.LimitReader(resp.Body, probeSniffBytes))
+	if err != nil || len(head) == 0 {
+		return ""
+	}
+	return http.DetectContentType(head)
+}
+
+// fileExtensions are the extensions stored for common document types when the
+// server names no file. The system MIME table is consulted after these, but
+// its contents vary by host and its first answer is often odd (".jfif").
+var fileExtensions = map[string]string{
+	"application/pdf":             ".pdf",
+	"application/zip":             ".zip",
+	"application/gzip":            ".gz",
+	"application/x-tar":           ".tar",
+	"application/x-7z-compressed": ".7z",
+	"application/epub+zip":        ".epub",
+	"application/json":            ".json",
+	"application/xml":             ".xml",
+	"text/xml":                    ".xml",
+	"text/plain":                  ".txt",
+	"text/csv":                    ".csv",
+	"image/png":                   ".png",
+	"image/jpeg":                  ".jpg",
+	"image/gif":                   ".gif",
+	"image/webp":                  ".webp",
+	"image/avif":                  ".avif",
+	"image/svg+xml":               ".svg",
+	"application/msword":          ".doc",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   ".docx",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         ".xlsx",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": ".pptx",
+}
+
+// FileExtensionForContentType returns the extension to store a document of
+// this media type under, or "" when none is known.
+func FileExtensionForContentType(mediaType string) string {
+	mediaType = strings.ToLower(mediaType)
+	if ext, ok := fileExtensions[mediaType]; ok {
+		return ext
+	}
+	if mediaType == "application/octet-stream" {
+		return ""
+	}
+	if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
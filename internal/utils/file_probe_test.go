@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetArchiveTypesRoutesProbedDocumentsToFile(t *testing.T) {
+	t.Cleanup(func() { SetRemoteContentProbe(nil) })
+	probed := map[string]string{
+		"https://example.com/report":       "application/pdf",
+		"https://example.com/page":         "text/html; charset=utf-8",
+		"https://example.com/feed-episode": "audio/mpeg",
+	}
+	var asked []string
+	SetRemoteContentProbe(func(rawURL string) string {
+		asked = append(asked, rawURL)
+		return probed[rawURL]
+	})
+
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{"https://example.com/report", []string{ArchiveTypeFile}},
+		{"https://example.com/page", []string{ArchiveTypeMHTML, ArchiveTypeScreenshot}},
+		{"https://example.com/feed-episode", []string{ArchiveTypeAudio}},
+		{"https://example.com/unreachable", []string{ArchiveTypeMHTML, ArchiveTypeScreenshot}},
+	}
+	for _, tt := range tests {
+		if got := GetArchiveTypes(tt.url); !slices.Equal(got, tt.want) {
+			t.Errorf("GetArchiveTypes(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+
+	asked = nil
+	GetArchiveTypes("https://www.youtube.com/watch?v=dQw4w9WgXcQ")
+	GetArchiveTypes("https://github.com/user/repo")
+	if len(asked) != 0 {
+		t.Errorf("probed %v; URLs a site rule claims are never probed", asked)
+	}
+}
+
+func TestHTTPContentProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/head":
+			w.Header().Set("Content-Type", "application/zip")
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "application/pdf")
+		case "/sniff":
+			w.Header()["Content-Type"] = nil
+			w.Write([]byte("%PDF-1.7\n"))
+		case "/internal":
+			http.Redirect(w, r, "http://10.0.0.5/report.pdf", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// The test server is on loopback, which ValidateURL refuses.
+	probe := newHTTPContentProbe(2*time.Second, func(rawURL string) error {
+		if strings.HasPrefix(rawURL, server.URL) {
+			return nil
+		}
+		return ValidateURL(rawURL)
+	})
+	for path, want := range map[string]string{
+		"/head":     "application/zip",
+		"/no-head":  "application/pdf",
+		"/sniff":    "application/pdf",
+		"/missing":  "",
+		"/internal": "",
+	} {
+		if got := probe(server.URL + path); got != want {
+			t.Errorf("probe(%s) = %q, want %q", path, got, want)
+		}
+	}
+	if got := NewHTTPContentProbe(time.Second)(server.URL + "/head"); got != "" {
+		t.Errorf("probing a loopback URL answered %q", got)
+	}
+}
+
+func TestIsPageContentType(t *testing.T) {
+	for contentType, want := range map[string]bool{
+		"text/html":                    true,
+		"TEXT/HTML; charset=utf-8":     true,
+		"application/xhtml+xml":        true,
+		"application/pdf":              false,
+		"application/octet-stream":     false,
+		"image/png":                    false,
+		"text/plain; charset=us-ascii": false,
+	} {
+		if got := IsPageContentType(contentType); got != want {
+			t.Errorf("IsPageContentType(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
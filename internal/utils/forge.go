@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Forge kinds: the REST API a code host speaks. Forgejo (Codeberg) speaks
+// Gitea's.
+const (
+	ForgeGitHub = "github"
+	ForgeGitLab = "gitlab"
+	ForgeGitea  = "gitea"
+)
+
+// ForgeConfig controls the forge (project) archive type.
+type ForgeConfig struct {
+	// Hosts maps a lowercase host (with port, if any) to its forge kind.
+	// The public hosts are always known; these add self-hosted instances.
+	Hosts map[string]string
+	// Tokens maps a host to an API token. Anonymous access works, but
+	// GitHub allows it 60 requests an hour.
+	Tokens map[string]string
+	// MaxThreads caps the issues and pull requests saved per project, newest
+	// first. A project with more is marked partial.
+	MaxThreads int
+	// MaxAssetBytes caps one release asset, and MaxAssetsTotal all of them.
+	// Assets over either are listed but not stored.
+	MaxAssetBytes  int64
+	MaxAssetsTotal int64
+}
+
+var (
+	forgeMu  sync.RWMutex
+	forgeCfg = ForgeConfig{MaxThreads: 1000, MaxAssetBytes: 2 << 30, MaxAssetsTotal: 4 << 30}
+)
+
+// publicForgeHosts are the hosts recognized without configuration.
+var publicForgeHosts = map[string]string{
+	"github.com":   ForgeGitHub,
+	"gitlab.com":   ForgeGitLab,
+	"codeberg.org": ForgeGitea,
+	"gitea.com":    ForgeGitea,
+}
+
+// ParseForgeHosts reads a FORGE_HOSTS value: comma-separated host=kind pairs
+// such as "git.example.org=gitea,code.example.com=gitlab".
+func ParseForgeHosts(value string) (map[string]string, error) {
+	hosts := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		host, kind, ok := strings.Cut(pair, "=")
+		host, kind = strings.ToLower(strings.TrimSpace(host)), strings.ToLower(strings.TrimSpace(kind))
+		if !ok || host == "" {
+			return nil, fmt.Errorf("%q is not host=kind", pair)
+		}
+		switch kind {
+		case ForgeGitHub, ForgeGitLab, ForgeGitea:
+		case "forgejo":
+			kind = ForgeGitea
+		default:
+			return nil, fmt.Errorf("unknown forge kind %q for %s: want github, gitlab or gitea", kind, host)
+		}
+		hosts[host] = kind
+	}
+	return hosts, nil
+}
+
+// ParseForgeTokens reads a FORGE_TOKENS value: comma-separated host=token
+// pairs.
+func ParseForgeTokens(value string) (map[string]string, error) {
+	tokens := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		host, token, ok := strings.Cut(pair, "=")
+		host, token = strings.ToLower(strings.TrimSpace(host)), strings.TrimSpace(token)
+		if !ok || host == "" || token == "" {
+			return nil, fmt.Errorf("FORGE_TOKENS entry for %q is not host=token", host)
+		}
+		tokens[host] = token
+	}
+	return tokens, nil
+}
+
+// InitForge installs the forge configuration and returns it with defaults
+// filled in.
+func InitForge(cfg ForgeConfig) ForgeConfig {
+	if cfg.MaxThreads <= 0 {
+		cfg.MaxThreads = 1000
+	}
+	if cfg.MaxAssetBytes <= 0 {
+		cfg.MaxAssetBytes = 2 << 30
+	}
+	if cfg.MaxAssetsTotal <= 0 {
+		cfg.MaxAssetsTotal = 4 << 30
+	}
+	forgeMu.Lock()
+	forgeCfg = cfg
+	forgeMu.Unlock()
+	return cfg
+}
+
+// ForgeSettings returns the active configuration.
+func ForgeSettings() ForgeConfig {
+	forgeMu.RLock()
+	defer forgeMu.RUnlock()
+	return forgeCfg
+}
+
+// ForgeToken returns the configured API token for a host, if any.
+func ForgeToken(host string) string {
+	return ForgeSettings().Tokens[strings.ToLower(host)]
+}
+
+// ForgeProject is a project on a code host, as named by its web URL.
+type ForgeProject struct {
+	Kind   string
+	Scheme string
+	// Host includes the port when the URL names one.
+	Host string
+	// Path is "owner/repo" on GitHub and Gitea, and the full namespace path
+	// ("group/subgroup/project") on GitLab.
+	Path string
+}
+
+// WebURL is the project's home page.
+func (p ForgeProject) WebURL() string {
+	return p.Scheme + "://" + p.Host + "/" + p.Path
+}
+
+// ParseForgeURL recognizes a project URL on a known forge host. Any page
+// inside the project (an issue, a file, a release) names the project too.
+func ParseForgeURL(rawURL string) (ForgeProject, bool) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ForgeProject{}, false
+	}
+	host := strings.ToLower(u.Host)
+	kind, ok := ForgeSettings().Hosts[host]
+	if !ok {
+		kind, ok = publicForgeHosts[strings.TrimPrefix(host, "www.")]
+		host = strings.TrimPrefix(host, "www.")
+	}
+	if !ok {
+		return ForgeProject{}, false
+	}
+
+	path := strings.Trim(u.Path, "/")
+	var segments []string
+	if kind == ForgeGitLab {
+		// GitLab namespaces nest, and everything below a project sits after
+		// a "/-/" separator.
+		if before, _, found := strings.Cut(path, "/-/"); found {
+			path = before
+		}
+		segments = strings.Split(path, "/")
+	} else {
+		segments = strings.Split(path, "/")
+		if len(segments) > 2 {
+			segments = segments[:2]
+		}
+	}
+	if len(segments) < 2 || isNonRepoPath([]string{strings.ToLower(segments[0]), segments[1]}) {
+		return ForgeProject{}, false
+	}
+	last := len(segments) - 1
+	segments[last] = strings.TrimSuffix(segments[last], ".git")
+	for _, segment := range segments {
+		if segment == "" {
+			return ForgeProject{}, false
+		}
+	}
+	return ForgeProject{Kind: kind, Scheme: u.Scheme, Host: host, Path: strings.Join(segments, "/")}, true
+}
+
+// IsForgeURL reports whether a URL names a project on a known forge host.
+func IsForgeURL(rawURL string) bool {
+	_, ok := ParseForgeURL(rawURL)
+	return ok
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseForgeURL(t *testing.T) {
+	previous := ForgeSettings()
+	t.Cleanup(func() { InitForge(previous) })
+	InitForge(ForgeConfig{Hosts: map[string]string{"git.example.org:3000": ForgeGitea}})
+
+	tests := []struct {
+		url  string
+		want ForgeProject
+		ok   bool
+	}{
+		{"https://github.com/hackclub/arker", ForgeProject{ForgeGitHub, "https", "github.com", "hackclub/arker"}, true},
+		{"https://www.github.com/hackclub/arker.git", ForgeProject{ForgeGitHub, "https", "github.com", "hackclub/arker"}, true},
+		{"https://github.com/hackclub/arker/issues/12", ForgeProject{ForgeGitHub, "https", "github.com", "hackclub/arker"}, true},
+		{"https://gitlab.com/group/sub/project/-/merge_requests/3", ForgeProject{ForgeGitLab, "https", "gitlab.com", "group/sub/project"}, true},
+		{"https://codeberg.org/ana/lamp/releases", ForgeProject{ForgeGitea, "https", "codeberg.org", "ana/lamp"}, true},
+		{"http://git.example.org:3000/ana/lamp", ForgeProject{ForgeGitea, "http", "git.example.org:3000", "ana/lamp"}, true},
+		{"https://github.com/hackclub", ForgeProject{}, false},
+		{"https://github.com/settings/profile", ForgeProject{}, false},
+		{"https://example.com/ana/lamp", ForgeProject{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseForgeURL(tt.url)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("ParseForgeURL(%q) = %+v, %v; want %+v, %v", tt.url, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseForgeHostsAndTokens(t *testing.T) {
+	hosts, err := ParseForgeHosts(" Git.Example.org=forgejo , code.example.com=gitlab")
+	if err != nil || hosts["git.example.org"] != ForgeGitea || hosts["code.example.com"] != ForgeGitLab {
+		t.Errorf("hosts = %v, %v", hosts, err)
+	}
+	if _, err := ParseForgeHosts("git.example.org=sourcehut"); err == nil {
+		t.Error("unknown kind accepted")
+	}
+	tokens, err := ParseForgeTokens("github.com=ghp_x")
+	if err != nil || tokens["github.com"] != "ghp_x" {
+		t.Errorf("tokens = %v, %v", tokens, err)
+	}
+	if _, err := ParseForgeTokens("github.com"); err == nil {
+		t.Error("token without a host accepted")
+	}
+}
+
+func TestGetArchiveTypesAddsForgeForConfiguredHosts(t *testing.T) {
+	previous := ForgeSettings()
+	t.Cleanup(func() { InitForge(previous) })
+	InitForge(ForgeConfig{Hosts: map[string]string{"code.example.com": ForgeGitLab}})
+
+	types := GetArchiveTypes("https://code.example.com/team/tool")
+	if !slices.Contains(types, ArchiveTypeForge) {
+		t.Errorf("types = %v; a configured forge host gets a forge capture", types)
+	}
+}
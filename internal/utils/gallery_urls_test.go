@@ -175,7 +175,7 @@ func TestIsGalleryDLURLRejectsBareHosts(t *testing.T) {
 // success. Coverage is the fallback client's own answer, per URL and archive
 // type: a login-only site it does not cover stays excluded.
 func TestShouldCreateGalleryDLItemWithBrightDataFallback(t *testing.T) {
-	if MediaCookiesConfigured() {
+	if MediaCookiesConfigured("https://www.instagram.com/p/ABC123/") {
 		t.Skip("test requires no cookie jar configured")
 	}
 
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+)
+
+// GitRepoURL reduces a URL somewhere inside a repository's web pages, such as
+// a file, a commit or an issue, to the URL the repository clones from. Forge
+// hosts (GitHub, GitLab, Codeberg and other Gitea or Forgejo instances,
+// including those named in FORGE_HOSTS) keep their project path, Bitbucket
+// keeps owner/repo and sourcehut keeps ~owner/repo. Any other URL is returned
+// without its fragment.
+func GitRepoURL(raw string) string {
+	raw, _, _ = strings.Cut(raw, "#")
+	if p, ok := ParseForgeURL(raw); ok {
+		return p.WebURL()
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return raw
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	switch host {
+	case "bitbucket.org":
+		if len(segments) >= 2 && segments[0] != "" && segments[1] != "" && !isNonRepoPath(segments) {
+			return u.Scheme + "://" + host + "/" + segments[0] + "/" + segments[1]
+		}
+	case "git.sr.ht":
+		if len(segments) >= 2 && strings.HasPrefix(segments[0], "~") && segments[1] != "" {
+			return u.Scheme + "://" + host + "/" + segments[0] + "/" + segments[1]
+		}
+	}
+	return raw
+}
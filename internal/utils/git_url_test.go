@@ -0,0 +1,28 @@
+package utils
+
+import "testing"
+
+func TestGitRepoURL(t *testing.T) {
+	previous := ForgeSettings()
+	t.Cleanup(func() { InitForge(previous) })
+	InitForge(ForgeConfig{Hosts: map[string]string{"code.example.org": ForgeGitea}})
+
+	tests := []struct{ url, want string }{
+		{"https://github.com/owner/repo/tree/main/src#L10", "https://github.com/owner/repo"},
+		{"https://gitlab.com/group/sub/project/-/blob/main/README.md", "https://gitlab.com/group/sub/project"},
+		{"https://codeberg.org/ana/lamp/src/branch/main", "https://codeberg.org/ana/lamp"},
+		{"https://gitea.com/ana/lamp.git", "https://gitea.com/ana/lamp"},
+		{"https://code.example.org/ana/lamp/commits", "https://code.example.org/ana/lamp"},
+		{"https://bitbucket.org/team/tool/src/master/", "https://bitbucket.org/team/tool"},
+		{"https://git.sr.ht/~ana/lamp/tree/main/item/README", "https://git.sr.ht/~ana/lamp"},
+		{"https://example.com/repos/lamp.git#readme", "https://example.com/repos/lamp.git"},
+	}
+	for _, tt := range tests {
+		if got := GitRepoURL(tt.url); got != tt.want {
+			t.Errorf("GitRepoURL(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+	if !IsGitURL("https://code.example.org/ana/lamp") || !IsGitURL("https://gitea.com/ana/lamp") {
+		t.Error("forge projects are not detected as git repositories")
+	}
+}
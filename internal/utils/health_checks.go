@@ -2,126 +2,63 @@ package utils
 
 import (
 	"fmt"
-	"github.com/mxschmitt/playwright-go"
-	"os/exec"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
+
+	"github.com/mxschmitt/playwright-go"
 )
 
-// HealthCheckConfig holds configuration for health checks
-type HealthCheckConfig struct {
-	CheckYtDlp      bool
-	CheckGalleryDl  bool
-	CheckPlaywright bool
-	CheckAria2c     bool
-	CheckItchDl     bool
-	Timeout         time.Duration
-}
+// archiveTypeHealth holds the health monitor's answer to "can this archive
+// type run right now". It lives here, like the Bright Data fallback hook,
+// because the capture queue consults it and must not import the monitor.
+var archiveTypeHealth atomic.Value // of archiveTypeHealthHook
 
-// DefaultHealthCheckConfig returns a sensible default health check configuration
-func DefaultHealthCheckConfig() HealthCheckConfig {
-	return HealthCheckConfig{
-		CheckYtDlp:      true,
-		CheckGalleryDl:  true,
-		CheckPlaywright: true,
-		CheckAria2c:     true,
-		CheckItchDl:     true,
-		Timeout:         10 * time.Second,
-	}
+type archiveTypeHealthHook struct {
+	unavailable func(archiveType string) (string, bool)
 }
 
-// RunHealthChecks performs startup health checks
-func RunHealthChecks(config HealthCheckConfig) error {
-	if config.CheckYtDlp {
-		if err := CheckYtDlpAvailability(config.Timeout); err != nil {
-			return fmt.Errorf("yt-dlp health check failed: %v", err)
-		}
-	}
-
-	if config.CheckGalleryDl {
-		if err := CheckGalleryDlAvailability(config.Timeout); err != nil {
-			return fmt.Errorf("gallery-dl health check failed: %v", err)
-		}
-	}
-
-	if config.CheckAria2c {
-		if err := CheckAria2cAvailability(config.Timeout); err != nil {
-			return fmt.Errorf("aria2c health check failed: %v", err)
-		}
-	}
-
-	if config.CheckPlaywright {
-		if err := CheckPlaywrightAvailability(config.Timeout); err != nil {
-			return fmt.Errorf("playwright health check failed: %v", err)
-		}
-	}
-
-	if config.CheckItchDl {
-		if err := CheckItchDlAvailability(config.Timeout); err != nil {
-			return fmt.Errorf("itch-dl health check failed: %v", err)
-		}
-	}
-
-	return nil
+// SetArchiveTypeHealth is called once at startup with the health monitor's
+// lookup. unavailable returns the reason a type's dependency is down. Passing
+// nil (the default) treats every type as available.
+func SetArchiveTypeHealth(unavailable func(archiveType string) (string, bool)) {
+	archiveTypeHealth.Store(archiveTypeHealthHook{unavailable: unavailable})
 }
 
-// CheckYtDlpAvailability checks if yt-dlp is available and working
-func CheckYtDlpAvailability(timeout time.Duration) error {
-	done := make(chan error, 1)
-
-	go func() {
-		cmd := exec.Command("yt-dlp", "--version")
-		done <- cmd.Run()
-	}()
-
-	select {
-	case err := <-done:
-		if err != nil {
-			return fmt.Errorf("yt-dlp not available or not working: %v", err)
-		}
+// UnavailableArchiveTypes returns type -> reason for every requested type
+// whose dependency the last health check found down, or nil when all can run.
+func UnavailableArchiveTypes(types []string) map[string]string {
+	hook, _ := archiveTypeHealth.Load().(archiveTypeHealthHook)
+	if hook.unavailable == nil {
 		return nil
-	case <-time.After(timeout):
-		return fmt.Errorf("yt-dlp health check timed out after %v", timeout)
 	}
-}
-
-// CheckGalleryDlAvailability checks if gallery-dl is available and working
-func CheckGalleryDlAvailability(timeout time.Duration) error {
-	done := make(chan error, 1)
-
-	go func() {
-		cmd := exec.Command("gallery-dl", "--version")
-		done <- cmd.Run()
-	}()
-
-	select {
-	case err := <-done:
-		if err != nil {
-			return fmt.Errorf("gallery-dl not available or not working: %v", err)
+	var reasons map[string]string
+	for _, t := range types {
+		canonical := NormalizeArchiveType(t)
+		if reason, down := hook.unavailable(canonical); down {
+			if reasons == nil {
+				reasons = make(map[string]string)
+			}
+			reasons[canonical] = reason
 		}
-		return nil
-	case <-time.After(timeout):
-		return fmt.Errorf("gallery-dl health check timed out after %v", timeout)
 	}
+	return reasons
 }
 
-// CheckAria2cAvailability checks if aria2c is available and working
-func CheckAria2cAvailability(timeout time.Duration) error {
-	done := make(chan error, 1)
-
-	go func() {
-		cmd := exec.Command("aria2c", "--version")
-		done <- cmd.Run()
-	}()
-
-	select {
-	case err := <-done:
-		if err != nil {
-			return fmt.Errorf("aria2c not available or not working: %v", err)
-		}
-		return nil
-	case <-time.After(timeout):
-		return fmt.Errorf("aria2c health check timed out after %v", timeout)
+// DescribeUnavailableArchiveTypes renders UnavailableArchiveTypes' result as
+// one sentence, in type order so the message is stable.
+func DescribeUnavailableArchiveTypes(reasons map[string]string) string {
+	types := make([]string, 0, len(reasons))
+	for t := range reasons {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	parts := make([]string, 0, len(types))
+	for _, t := range types {
+		parts = append(parts, fmt.Sprintf("%s (%s)", t, reasons[t]))
 	}
+	return "archive types temporarily unavailable: " + strings.Join(parts, ", ")
 }
 
 // CheckPlaywrightAvailability checks if Playwright can create a browser instance
@@ -164,27 +101,3 @@ func CheckPlaywrightAvailability(timeout time.Duration) error {
 		return fmt.Errorf("playwright health check timed out after %v", timeout)
 	}
 }
-
-// CheckItchDlAvailability checks if itch-dl is available and working
-func CheckItchDlAvailability(timeout time.Duration) error {
-	done := make(chan error, 1)
-
-	go func() {
-		// Check if itch-dl is available
-		cmd := exec.Command("python3", "-m", "itch_dl", "--help")
-		_, err := cmd.CombinedOutput()
-		if err != nil {
-			done <- fmt.Errorf("itch-dl not available: %v", err)
-			return
-		}
-
-		done <- nil
-	}()
-
-	select {
-	case err := <-done:
-		return err
-	case <-time.After(timeout):
-		return fmt.Errorf("itch-dl health check timed out after %v", timeout)
-	}
-}
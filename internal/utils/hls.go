@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HLSSourceRendition names the rendition that is the archived stream itself,
+// segmented without re-encoding.
+const HLSSourceRendition = "source"
+
+// HLSConfig controls the adaptive-streaming copy made of long videos after
+// they are archived. It is off by default: segmenting costs a second full read
+// of every long video and, with extra renditions, a transcode.
+type HLSConfig struct {
+	Enabled bool
+	// MinDuration skips videos shorter than this. A ten-minute MP4 seeks fine
+	// with range requests; the problem HLS solves is multi-hour streams.
+	MinDuration time.Duration
+	// SegmentSeconds is the target segment length. Stream-copied segments
+	// split on keyframes, so real segments are at least this long.
+	SegmentSeconds int
+	// Renditions are HLSSourceRendition and/or lower heights in pixels to
+	// transcode to, e.g. [source 720 480]. A height at or above the source's
+	// own is skipped for that video.
+	Renditions []string
+	// Timeout bounds one packaging job, transcodes included.
+	Timeout time.Duration
+}
+
+var (
+	hlsMu  sync.RWMutex
+	hlsCfg HLSConfig
+)
+
+// Defaults applied by InitHLS when a field is left zero.
+const (
+	defaultHLSMinDuration    = 20 * time.Minute
+	defaultHLSSegmentSeconds = 6
+	defaultHLSTimeout        = 3 * time.Hour
+)
+
+// ParseHLSRenditions reads a comma-separated HLS_RENDITIONS value such as
+// "source,720,480". Heights are returned highest first, after the source.
+func ParseHLSRenditions(value string) ([]string, error) {
+	var source bool
+	var heights []int
+	seen := map[int]bool{}
+	for _, part := range strings.Split(value, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		if part == HLSSourceRendition {
+			source = true
+			continue
+		}
+		height, err := strconv.Atoi(strings.TrimSuffix(part, "p"))
+		if err != nil || height < 144 || height > 4320 {
+			return nil, fmt.Errorf("invalid HLS rendition %q: want %q or a height between 144 and 4320", part, HLSSourceRendition)
+		}
+		if !seen[height] {
+			seen[height] = true
+			heights = append(heights, height)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(heights)))
+
+	var renditions []string
+	if source {
+		renditions = append(renditions, HLSSourceRendition)
+	}
+	for _, height := range heights {
+		renditions = append(renditions, strconv.Itoa(height))
+	}
+	if len(renditions) == 0 {
+		renditions = []string{HLSSourceRendition}
+	}
+	return renditions, nil
+}
+
+// InitHLS installs the HLS configuration and returns it with defaults filled
+// in.
+func InitHLS(cfg HLSConfig) HLSConfig {
+	if cfg.MinDuration <= 0 {
+		cfg.MinDuration = defaultHLSMinDuration
+	}
+	if cfg.SegmentSeconds <= 0 {
+		cfg.SegmentSeconds = defaultHLSSegmentSeconds
+	}
+	if len(cfg.Renditions) == 0 {
+		cfg.Renditions = []string{HLSSourceRendition}
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultHLSTimeout
+	}
+	hlsMu.Lock()
+	hlsCfg = cfg
+	hlsMu.Unlock()
+	return cfg
+}
+
+// HLSSettings returns the active configuration.
+func HLSSettings() HLSConfig {
+	hlsMu.RLock()
+	defer hlsMu.RUnlock()
+	return hlsCfg
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHLSRenditions(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{"", []string{"source"}, false},
+		{"source", []string{"source"}, false},
+		{"720p, source,480,720", []string{"source", "720", "480"}, false},
+		{"480,1080p", []string{"1080", "480"}, false},
+		{" Source ,", []string{"source"}, false},
+		{"99", nil, true},
+		{"8k", nil, true},
+		{"source,original", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseHLSRenditions(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseHLSRenditions(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseHLSRenditions(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// LiveConfig controls how a live stream is recorded. yt-dlp on its own either
+// refuses a stream that is still live or follows it until it ends, which for a
+// 24/7 channel is never; Arker records a bounded window instead.
+type LiveConfig struct {
+	// MaxDuration is the longest window recorded from one stream. The
+	// recording is stopped cleanly when it is reached.
+	MaxDuration time.Duration
+	// FromStart asks yt-dlp to record from the start of the broadcast rather
+	// than the live edge. Only some extractors (YouTube) support it; the rest
+	// record from the live edge regardless.
+	FromStart bool
+	// CheckpointInterval is how often the growing recording is stored while
+	// it runs, so a crash or a lost worker still leaves a playable file.
+	CheckpointInterval time.Duration
+}
+
+var (
+	liveMu  sync.RWMutex
+	liveCfg = LiveConfig{
+		MaxDuration:        defaultLiveMaxDuration,
+		CheckpointInterval: defaultLiveCheckpointInterval,
+	}
+)
+
+// Defaults applied by InitLive when a field is left zero.
+const (
+	defaultLiveMaxDuration        = 2 * time.Hour
+	defaultLiveCheckpointInterval = 10 * time.Minute
+)
+
+// InitLive installs the live recording configuration and returns it with
+// defaults filled in.
+func InitLive(cfg LiveConfig) LiveConfig {
+	if cfg.MaxDuration <= 0 {
+		cfg.MaxDuration = defaultLiveMaxDuration
+	}
+	if cfg.CheckpointInterval <= 0 {
+		cfg.CheckpointInterval = defaultLiveCheckpointInterval
+	}
+	liveMu.Lock()
+	liveCfg = cfg
+	liveMu.Unlock()
+	return cfg
+}
+
+// LiveSettings returns the active configuration.
+func LiveSettings() LiveConfig {
+	liveMu.RLock()
+	defer liveMu.RUnlock()
+	return liveCfg
+}
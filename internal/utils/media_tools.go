@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"fmt"
+	"io"
 	"strings"
 	"sync/atomic"
 )
@@ -13,13 +15,63 @@ import (
 // name for a gallery-dl invocation.
 
 // MediaCookieArgsForRun returns --cookies arguments pointing at a fresh private
-// copy of the configured cookie jar, plus a cleanup function to call once the
+// copy of the cookie jar for rawURL, plus a cleanup function to call once the
 // tool exits. Both yt-dlp and gallery-dl accept a Netscape cookies.txt via
-// --cookies. Returns no arguments when no cookies are configured.
-func MediaCookieArgsForRun() ([]string, func(), error) {
+// --cookies.
+//
+// A jar stored for the URL's host (the admin cookie jar page) wins over the
+// YTDLP_COOKIES_FILE/B64 jar, and a host with several accounts hands them out
+// in rotation; the chosen jar is named in logWriter, never its contents.
+// Returns no arguments when neither is configured.
+func MediaCookieArgsForRun(rawURL string, logWriter io.Writer) ([]string, func(), error) {
+	return mediaCookieArgs(rawURL, true, logWriter)
+}
+
+// MediaCookieArgsForProbe is MediaCookieArgsForRun for a preliminary request
+// (the yt-dlp duration probe) that belongs to a job whose real run has not
+// started yet. It uses the jar that run will get, without advancing the
+// rotation: otherwise the probe and the download would always land on
+// different accounts of a two-account host.
+func MediaCookieArgsForProbe(rawURL string) ([]string, func(), error) {
+	return mediaCookieArgs(rawURL, false, nil)
+}
+
+func mediaCookieArgs(rawURL string, advance bool, logWriter io.Writer) ([]string, func(), error) {
+	source, _ := mediaCookieJars.Load().(mediaCookieJarSource)
+	if source.pick != nil {
+		content, label, ok, err := source.pick(rawURL, advance)
+		if err != nil {
+			return nil, func() {}, fmt.Errorf("failed to load cookie jar: %w", err)
+		}
+		if ok {
+			if logWriter != nil {
+				fmt.Fprintf(logWriter, "Using cookie jar %q\n", label)
+			}
+			return writeRunCookies(content)
+		}
+	}
 	return YtDlpCookieArgsForRun()
 }
 
+// mediaCookieJars holds the stored per-host jars. Like the Bright Data hook
+// below, it is installed at startup because the store needs the database and
+// the encryption key, and routing must not import either.
+var mediaCookieJars atomic.Value // of mediaCookieJarSource
+
+type mediaCookieJarSource struct {
+	// pick returns the jar to use for rawURL and a label naming it. advance
+	// records the use, moving the host's rotation on to its next account.
+	pick func(rawURL string, advance bool) ([]byte, string, bool, error)
+	// has reports whether any enabled jar covers rawURL, without decrypting.
+	has func(rawURL string) bool
+}
+
+// SetMediaCookieJars installs the stored cookie jars. Nil functions (the
+// default) leave only the environment-configured jar.
+func SetMediaCookieJars(pick func(rawURL string, advance bool) ([]byte, string, bool, error), has func(rawURL string) bool) {
+	mediaCookieJars.Store(mediaCookieJarSource{pick: pick, has: has})
+}
+
 // MediaProxyArgs returns --proxy arguments for a media tool invocation, or nil
 // when no proxy is configured. Both tools spell the flag --proxy and accept
 // http/https/socks5 URLs.
@@ -27,11 +79,15 @@ func MediaProxyArgs() []string {
 	return YtDlpProxyArgs()
 }
 
-// MediaCookiesConfigured reports whether a cookie jar is available. Sites that
+// MediaCookiesConfigured reports whether a cookie jar is available for rawURL:
+// a stored jar for its host, or the environment-configured jar. Sites that
 // serve nothing to logged-out clients are not worth queueing without one: the
 // job cannot succeed, and the requests it spends still count against the rate
 // limits of the sites that can.
-func MediaCookiesConfigured() bool {
+func MediaCookiesConfigured(rawURL string) bool {
+	if source, _ := mediaCookieJars.Load().(mediaCookieJarSource); source.has != nil && source.has(rawURL) {
+		return true
+	}
 	ytDlpCookiesMu.RLock()
 	defer ytDlpCookiesMu.RUnlock()
 	return ytDlpCookiesFilePath != ""
@@ -473,3 +473,47 @@ func (sc *StreamingConverter) decodePart(data []byte, encoding string) ([]byte,
 		return nil, fmt.Errorf("unsupported encoding: %s", encoding)
 	}
 }
+
+// MainDocument returns the decoded HTML document of an MHTML snapshot and the
+// URL it was captured from, without reading past that part: the document comes
+// first in a Chromium snapshot, ahead of megabytes of images and fonts.
+func (sc *StreamingConverter) MainDocument(input io.Reader) ([]byte, string, error) {
+	msg, err := mail.ReadMessage(input)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read mail message: %w", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse media type: %w", err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/related") || params["boundary"] == "" {
+		return nil, "", fmt.Errorf("not a multipart/related message, got: %s", mediaType)
+	}
+	location := msg.Header.Get("Snapshot-Content-Location")
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, "", fmt.Errorf("no HTML part found")
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read multipart: %w", err)
+		}
+		if !strings.HasPrefix(part.Header.Get("Content-Type"), "text/html") {
+			continue
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read HTML part: %w", err)
+		}
+		decoded, err := sc.decodePart(data, part.Header.Get("Content-Transfer-Encoding"))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decode HTML part: %w", err)
+		}
+		if location == "" {
+			location = part.Header.Get("Content-Location")
+		}
+		return decoded, location, nil
+	}
+}
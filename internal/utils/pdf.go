@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// PDFConfig controls the print-to-PDF capture of web pages.
+type PDFConfig struct {
+	// PaperSize is a Playwright paper format such as "A4" or "Letter".
+	PaperSize string
+	// Default adds a PDF to every web page capture. Without it the type is
+	// only created when a client asks for it by name.
+	Default bool
+}
+
+var (
+	pdfMu  sync.RWMutex
+	pdfCfg = PDFConfig{PaperSize: defaultPDFPaperSize}
+)
+
+const defaultPDFPaperSize = "A4"
+
+// pdfPaperSizes are the formats Chromium's print backend understands, with
+// their size in CSS pixels (96 dpi), keyed by their lowercase spelling.
+var pdfPaperSizes = map[string]struct {
+	name          string
+	width, height int
+}{
+	"letter":  {"Letter", 816, 1056},
+	"legal":   {"Legal", 816, 1344},
+	"tabloid": {"Tabloid", 1056, 1632},
+	"ledger":  {"Ledger", 1632, 1056},
+	"a0":      {"A0", 3179, 4494},
+	"a1":      {"A1", 2245, 3179},
+	"a2":      {"A2", 1587, 2245},
+	"a3":      {"A3", 1123, 1587},
+	"a4":      {"A4", 794, 1123},
+	"a5":      {"A5", 559, 794},
+	"a6":      {"A6", 397, 559},
+}
+
+// ParsePDFPaperSize reads a PDF_PAPER_SIZE value case-insensitively and
+// returns the format's canonical spelling. Empty means the default.
+func ParsePDFPaperSize(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultPDFPaperSize, nil
+	}
+	size, ok := pdfPaperSizes[strings.ToLower(value)]
+	if !ok {
+		return "", fmt.Errorf("unknown paper size %q: want Letter, Legal, Tabloid, Ledger or A0-A6", value)
+	}
+	return size.name, nil
+}
+
+// PDFPaperPixels returns a paper format's size in CSS pixels, falling back to
+// the default format for an unknown name.
+func PDFPaperPixels(paperSize string) (width, height int) {
+	size, ok := pdfPaperSizes[strings.ToLower(paperSize)]
+	if !ok {
+		size = pdfPaperSizes[strings.ToLower(defaultPDFPaperSize)]
+	}
+	return size.width, size.height
+}
+
+// InitPDF installs the PDF configuration and returns it with defaults filled
+// in.
+func InitPDF(cfg PDFConfig) PDFConfig {
+	if cfg.PaperSize == "" {
+		cfg.PaperSize = defaultPDFPaperSize
+	}
+	pdfMu.Lock()
+	pdfCfg = cfg
+	pdfMu.Unlock()
+	return cfg
+}
+
+// PDFSettings returns the active configuration.
+func PDFSettings() PDFConfig {
+	pdfMu.RLock()
+	defer pdfMu.RUnlock()
+	return pdfCfg
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParsePDFPaperSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", "A4", false},
+		{"a4", "A4", false},
+		{" letter ", "Letter", false},
+		{"TABLOID", "Tabloid", false},
+		{"A7", "", true},
+		{"210x297mm", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePDFPaperSize(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParsePDFPaperSize(%q) = %q, %v; want %q (error %v)", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestPDFPaperPixels(t *testing.T) {
+	if w, h := PDFPaperPixels("Letter"); w != 816 || h != 1056 {
+		t.Errorf("Letter = %dx%d, want 816x1056", w, h)
+	}
+	if w, h := PDFPaperPixels("unknown"); w != 794 || h != 1123 {
+		t.Errorf("unknown = %dx%d, want the A4 default", w, h)
+	}
+}
+
+func TestGetArchiveTypesAddsPDFOnlyWhenDefault(t *testing.T) {
+	previous := PDFSettings()
+	t.Cleanup(func() { InitPDF(previous) })
+
+	InitPDF(PDFConfig{})
+	if types := GetArchiveTypes("https://example.com/article"); slices.Contains(types, ArchiveTypePDF) {
+		t.Errorf("types = %v; pdf should be opt-in", types)
+	}
+
+	InitPDF(PDFConfig{Default: true})
+	want := []string{ArchiveTypeMHTML, ArchiveTypeScreenshot, ArchiveTypePDF}
+	if types := GetArchiveTypes("https://example.com/article"); !slices.Equal(types, want) {
+		t.Errorf("types = %v, want %v", types, want)
+	}
+	if types := GetArchiveTypes("https://example.com/episode.mp3"); slices.Contains(types, ArchiveTypePDF) {
+		t.Errorf("types = %v; a bare audio file is not printed", types)
+	}
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+)
+
+// youTubeChannelTabs are the channel tabs that list videos. Any other tab
+// (community, about, playlists) is not a list of videos to archive.
+var youTubeChannelTabs = map[string]bool{
+	"videos":  true,
+	"shorts":  true,
+	"streams": true,
+}
+
+// youTubeChannelPrefixes are the path prefixes a channel is addressed by
+// besides its @handle.
+var youTubeChannelPrefixes = map[string]bool{
+	"channel": true,
+	"c":       true,
+	"user":    true,
+}
+
+// IsPlaylistURL reports whether a URL names a list of videos rather than one
+// video: a YouTube playlist or channel, or a Vimeo showcase or channel.
+//
+// Shapes recognized:
+//
+//	youtube.com/playlist?list=PL...
+//	youtube.com/@handle, /channel/UC..., /c/name, /user/name
+//	  (optionally followed by /videos, /shorts or /streams)
+//	vimeo.com/showcase/123, vimeo.com/album/123
+//	vimeo.com/channels/staffpicks
+//
+// A watch URL carrying a list= parameter is still one video: that is what the
+// person was watching, and yt-dlp's --no-playlist archives exactly it. A Vimeo
+// channel URL ending in a video ID is likewise one video.
+func IsPlaylistURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return false
+	}
+	hostname := strings.ToLower(parsed.Hostname())
+	segments := splitPathSegments(parsed.Path)
+
+	switch {
+	case hostMatches(hostname, "youtube.com"):
+		return youTubePlaylistShape(parsed, segments)
+	case hostMatches(hostname, "vimeo.com") && hostname != vimeoPlayerHost:
+		if len(segments) != 2 {
+			return false
+		}
+		switch strings.ToLower(segments[0]) {
+		case "showcase", "album":
+			return isAllDigits(segments[1])
+		case "channels":
+			return !isAllDigits(segments[1])
+		}
+	}
+	return false
+}
+
+func youTubePlaylistShape(parsed *url.URL, segments []string) bool {
+	if len(segments) == 0 {
+		return false
+	}
+	if strings.EqualFold(segments[0], "playlist") {
+		return len(segments) == 1 && parsed.Query().Get("list") != ""
+	}
+	channel, rest := youTubeChannelRoot(segments)
+	if channel == 0 {
+		return false
+	}
+	switch len(rest) {
+	case 0:
+		return true
+	case 1:
+		return youTubeChannelTabs[strings.ToLower(rest[0])]
+	default:
+		return false
+	}
+}
+
+// youTubeChannelRoot returns how many leading segments address a channel (0
+// when the path is not a channel) and the segments after them.
+func youTubeChannelRoot(segments []string) (int, []string) {
+	if strings.HasPrefix(segments[0], "@") && len(segments[0]) > 1 {
+		return 1, segments[1:]
+	}
+	if len(segments) >= 2 && youTubeChannelPrefixes[strings.ToLower(segments[0])] {
+		return 2, segments[2:]
+	}
+	return 0, nil
+}
+
+// PlaylistFetchURL returns the URL the playlist archiver hands yt-dlp. A bare
+// YouTube channel URL becomes its /videos tab: asked for the channel itself,
+// yt-dlp lists the channel's tabs (Videos, Shorts, Live) as nested playlists
+// instead of listing videos. Everything else is fetched as submitted.
+func PlaylistFetchURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || !hostMatches(strings.ToLower(parsed.Hostname()), "youtube.com") {
+		return rawURL
+	}
+	segments := splitPathSegments(parsed.Path)
+	if len(segments) == 0 {
+		return rawURL
+	}
+	if root, rest := youTubeChannelRoot(segments); root > 0 && len(rest) == 0 {
+		parsed.Path = "/" + strings.Join(segments, "/") + "/videos"
+		return parsed.String()
+	}
+	return rawURL
+}
@@ -0,0 +1,60 @@
+package utils
+
+import "testing"
+
+func TestIsPlaylistURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want bool
+	}{
+		{"youtube playlist", "https://www.youtube.com/playlist?list=PLabc", true},
+		{"youtube handle", "https://www.youtube.com/@someone", true},
+		{"youtube handle videos tab", "https://www.youtube.com/@someone/videos", true},
+		{"youtube handle shorts tab", "https://m.youtube.com/@someone/shorts", true},
+		{"youtube channel id", "https://www.youtube.com/channel/UCabc", true},
+		{"youtube custom url", "https://www.youtube.com/c/someone/streams", true},
+		{"youtube legacy user", "https://www.youtube.com/user/someone", true},
+		{"vimeo showcase", "https://vimeo.com/showcase/1234567", true},
+		{"vimeo album", "https://vimeo.com/album/1234567", true},
+		{"vimeo channel", "https://vimeo.com/channels/staffpicks", true},
+
+		// One video, even when it was opened from a list.
+		{"youtube watch in a playlist", "https://www.youtube.com/watch?v=abc&list=PLabc", false},
+		{"youtube short", "https://www.youtube.com/shorts/abc", false},
+		{"vimeo channel video", "https://vimeo.com/channels/staffpicks/76979871", false},
+		{"vimeo video", "https://vimeo.com/76979871", false},
+
+		// Lists, but not of videos.
+		{"youtube playlist without list", "https://www.youtube.com/playlist", false},
+		{"youtube community tab", "https://www.youtube.com/@someone/community", false},
+		{"youtube bare @", "https://www.youtube.com/@", false},
+		{"youtube home", "https://www.youtube.com/", false},
+		{"vimeo showcase name", "https://vimeo.com/showcase/recent", false},
+		{"vimeo player", "https://player.vimeo.com/video/76979871", false},
+		{"other host", "https://example.com/@someone", false},
+		{"not http", "ftp://www.youtube.com/@someone", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPlaylistURL(tt.url); got != tt.want {
+				t.Errorf("IsPlaylistURL(%q) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlaylistFetchURL(t *testing.T) {
+	tests := map[string]string{
+		"https://www.youtube.com/@someone":            "https://www.youtube.com/@someone/videos",
+		"https://www.youtube.com/channel/UCabc/":      "https://www.youtube.com/channel/UCabc/videos",
+		"https://www.youtube.com/@someone/shorts":     "https://www.youtube.com/@someone/shorts",
+		"https://www.youtube.com/playlist?list=PLabc": "https://www.youtube.com/playlist?list=PLabc",
+		"https://vimeo.com/channels/staffpicks":       "https://vimeo.com/channels/staffpicks",
+	}
+	for in, want := range tests {
+		if got := PlaylistFetchURL(in); got != want {
+			t.Errorf("PlaylistFetchURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
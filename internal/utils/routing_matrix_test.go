@@ -65,6 +65,8 @@ func TestArchiveTypeMatrixWithoutCookies(t *testing.T) {
 	base := []string{ArchiveTypeMHTML, ArchiveTypeScreenshot}
 	withYtDlp := append(append([]string{}, base...), ArchiveTypeYtDlp)
 	withGallery := append(append([]string{}, base...), ArchiveTypeGalleryDl)
+	withPlaylist := append(append([]string{}, base...), ArchiveTypePlaylist)
+	withAudio := append(append([]string{}, base...), ArchiveTypeAudio)
 
 	tests := []struct {
 		platform string
@@ -79,6 +81,25 @@ func TestArchiveTypeMatrixWithoutCookies(t *testing.T) {
 		{"vimeo", "https://vimeo.com/76979871", withYtDlp},
 		{"vimeo unlisted hash", "https://vimeo.com/76979871/a1b2c3d4e5", withYtDlp},
 		{"vimeo player", "https://player.vimeo.com/video/76979871", withYtDlp},
+		{"youtube watch in a playlist", "https://www.youtube.com/watch?v=abc&list=PL123", withYtDlp},
+
+		// --- playlists: listed, then one child capture per video ---
+		{"youtube playlist", "https://www.youtube.com/playlist?list=PL123", withPlaylist},
+		{"youtube channel handle", "https://www.youtube.com/@someone", withPlaylist},
+		{"youtube channel videos tab", "https://www.youtube.com/@someone/videos", withPlaylist},
+		{"vimeo showcase", "https://vimeo.com/showcase/1234567", withPlaylist},
+
+		// --- audio: episode and track pages, and bare audio files alone ---
+		{"soundcloud track", "https://soundcloud.com/someone/a-track", withAudio},
+		{"bandcamp track", "https://someone.bandcamp.com/track/a-song", withAudio},
+		{"mixcloud show", "https://www.mixcloud.com/someone/a-mix/", withAudio},
+		{"apple podcasts episode", "https://podcasts.apple.com/us/podcast/a-show/id1234567?i=1000650000001", withAudio},
+		{"audioboom post", "https://audioboom.com/posts/8412345-an-episode", withAudio},
+		{"podcast enclosure", "https://cdn.example.com/feeds/episode-12.mp3?source=feed", []string{ArchiveTypeAudio}},
+		{"soundcloud set", "https://soundcloud.com/someone/sets/an-album", base},
+		{"bandcamp album", "https://someone.bandcamp.com/album/an-album", base},
+		{"apple podcasts show", "https://podcasts.apple.com/us/podcast/a-show/id1234567", base},
+
 		{"instagram reel", "https://www.instagram.com/reel/DPAid-WDi67/", withYtDlp},
 		{"tiktok video", "https://www.tiktok.com/@someone/video/7412345678901234567", withYtDlp},
 		{"tiktok vm short link", "https://vm.tiktok.com/ZMabcdefg/", withYtDlp},
@@ -118,8 +139,8 @@ func TestArchiveTypeMatrixWithoutCookies(t *testing.T) {
 		{"facebook post permalink", "https://www.facebook.com/NASA/posts/pfbid02abcDEF/", base},
 
 		// --- ordinary URL behavior must not change ---
-		{"github repo", "https://github.com/hackclub/arker", append(append([]string{}, base...), ArchiveTypeGit)},
-		{"gitlab repo", "https://gitlab.com/group/project", append(append([]string{}, base...), ArchiveTypeGit)},
+		{"github repo", "https://github.com/hackclub/arker", append(append([]string{}, base...), ArchiveTypeGit, ArchiveTypeForge)},
+		{"gitlab repo", "https://gitlab.com/group/project", append(append([]string{}, base...), ArchiveTypeGit, ArchiveTypeForge)},
 		{"bare .git URL", "https://example.com/thing.git", append(append([]string{}, base...), ArchiveTypeGit)},
 		{"itch game", "https://someone.itch.io/some-game", append(append([]string{}, base...), ArchiveTypeItch)},
 		{"plain page", "https://example.com/article", base},
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os/exec"
@@ -21,6 +22,9 @@ type TimeoutConfig struct {
 	YtDlpDurationOverhead time.Duration // Extra time for extraction, muxing, and upload
 	GalleryDlTimeout      time.Duration // Max time for gallery-dl operations
 	ItchTimeout           time.Duration // Max time for itch-dl operations
+	PlaylistTimeout       time.Duration // Max time for listing a playlist and queueing its videos
+	FileTimeout           time.Duration // Max time for downloading a non-HTML file
+	ForgeTimeout          time.Duration // Max time for reading a project from its forge's API
 	PageLoadTimeout       time.Duration // Max time for page loading
 }
 
@@ -40,7 +44,14 @@ func DefaultTimeoutConfig() TimeoutConfig {
 		GalleryDlTimeout: 20 * time.Minute,
 		// itch-dl downloads whole game builds; the 2-minute default it used to
 		// inherit was never enough for anything but the smallest game.
-		ItchTimeout:     30 * time.Minute,
+		ItchTimeout: 30 * time.Minute,
+		// Listing only, no media: a large channel takes yt-dlp a few minutes
+		// to page through.
+		PlaylistTimeout: 15 * time.Minute,
+		// A document is one request, but it can be a multi-gigabyte ISO.
+		FileTimeout: 30 * time.Minute,
+		// One request per thread with comments, plus every release asset.
+		ForgeTimeout:    60 * time.Minute,
 		PageLoadTimeout: 30 * time.Second, // Page loading should be quick
 	}
 }
@@ -90,12 +101,18 @@ func TimeoutForJobType(jobType string) time.Duration {
 	switch NormalizeArchiveType(jobType) {
 	case ArchiveTypeGit:
 		return config.GitCloneTimeout
-	case ArchiveTypeYtDlp:
+	case ArchiveTypeYtDlp, ArchiveTypeAudio:
 		return config.YtDlpTimeout
 	case ArchiveTypeGalleryDl:
 		return config.GalleryDlTimeout
 	case ArchiveTypeItch:
 		return config.ItchTimeout
+	case ArchiveTypePlaylist:
+		return config.PlaylistTimeout
+	case ArchiveTypeFile:
+		return config.FileTimeout
+	case ArchiveTypeForge:
+		return config.ForgeTimeout
 	default:
 		return config.ArchiveTimeout
 	}
@@ -118,17 +135,58 @@ func EstimateYtDlpTimeout(duration time.Duration) time.Duration {
 	return estimated
 }
 
+// archiveJobMargin is what a River job timeout allows beyond the archiver's
+// own, for storing the result and everything around it.
+const archiveJobMargin = 30 * time.Minute
+
+// ArchiveJobTimeout is the client-wide River job timeout: past the longest
+// any archiver runs by default.
+func ArchiveJobTimeout() time.Duration {
+	return DefaultTimeoutConfig().YtDlpMaxTimeout + archiveJobMargin
+}
+
+// LiveRecordingTimeout is an archiver's budget for a live stream: the
+// recording stops itself at LIVE_MAX_DURATION, then needs the usual overhead
+// for remuxing and upload.
+func LiveRecordingTimeout() time.Duration {
+	return LiveSettings().MaxDuration + DefaultTimeoutConfig().YtDlpDurationOverhead
+}
+
+// ArchiveJobTimeoutFor is the River job timeout of one archive job type. A
+// video or audio job may turn out to be a live stream, so it gets at least
+// the live recording window, however long LIVE_MAX_DURATION is set.
+func ArchiveJobTimeoutFor(jobType string) time.Duration {
+	timeout := ArchiveJobTimeout()
+	switch NormalizeArchiveType(jobType) {
+	case ArchiveTypeYtDlp, ArchiveTypeAudio:
+		timeout = max(timeout, LiveRecordingTimeout()+archiveJobMargin)
+	}
+	return timeout
+}
+
 // TimeoutForArchiveJob returns the timeout for a specific archive job.
 func TimeoutForArchiveJob(ctx context.Context, jobType, url string, logWriter io.Writer) time.Duration {
 	return timeoutForArchiveJob(ctx, jobType, url, logWriter, ProbeYtDlpDuration)
 }
 
 func timeoutForArchiveJob(ctx context.Context, jobType, url string, logWriter io.Writer, probeDuration func(context.Context, string) (time.Duration, error)) time.Duration {
-	if NormalizeArchiveType(jobType) != ArchiveTypeYtDlp {
+	// Audio is a yt-dlp download too, and a three-hour podcast needs the same
+	// duration-scaled budget as a three-hour video.
+	if typ := NormalizeArchiveType(jobType); typ != ArchiveTypeYtDlp && typ != ArchiveTypeAudio {
 		return TimeoutForJobType(jobType)
 	}
 
 	duration, err := probeDuration(ctx, url)
+	if errors.Is(err, ErrYtDlpLiveStream) {
+		// A live stream has no duration; the recording stops itself at the
+		// configured maximum, so the job needs that plus the usual overhead
+		// for remuxing and upload.
+		timeout := LiveRecordingTimeout()
+		if logWriter != nil {
+			fmt.Fprintf(logWriter, "Detected a live stream, using recording timeout %s\n", timeout.Round(time.Second))
+		}
+		return timeout
+	}
 	if err != nil {
 		timeout := EstimateYtDlpTimeout(0)
 		if logWriter != nil {
@@ -144,13 +202,18 @@ func timeoutForArchiveJob(ctx context.Context, jobType, url string, logWriter io
 	return timeout
 }
 
-// ProbeYtDlpDuration asks yt-dlp for the video duration without downloading media.
+// ErrYtDlpLiveStream is returned by ProbeYtDlpDuration for a stream that is
+// live right now and so has no duration yet.
+var ErrYtDlpLiveStream = errors.New("yt-dlp reports a live stream")
+
+// ProbeYtDlpDuration asks yt-dlp for the video duration without downloading
+// media. A stream that is currently live yields ErrYtDlpLiveStream.
 func ProbeYtDlpDuration(ctx context.Context, url string) (time.Duration, error) {
 	config := DefaultTimeoutConfig()
 	probeCtx, cancel := context.WithTimeout(ctx, config.YtDlpProbeTimeout)
 	defer cancel()
 
-	cookieArgs, cleanupCookies, err := YtDlpCookieArgsForRun()
+	cookieArgs, cleanupCookies, err := MediaCookieArgsForProbe(url)
 	if err != nil {
 		return 0, fmt.Errorf("yt-dlp cookies unavailable for duration probe: %w", err)
 	}
@@ -160,7 +223,7 @@ func ProbeYtDlpDuration(ctx context.Context, url string) (time.Duration, error)
 	// would time-box itself off a probe that cannot succeed.
 	fetchURL := YtDlpFetchURL(url)
 
-	args := []string{"--print", "duration", "--no-playlist", "--skip-download"}
+	args := []string{"--print", "duration", "--print", "live_status", "--no-playlist", "--skip-download"}
 	args = append(args, YtDlpImpersonateArgsForURL(url)...)
 	args = append(args, YtDlpRefererArgsForURL(fetchURL)...)
 	args = append(args, cookieArgs...)
@@ -184,7 +247,13 @@ func ProbeYtDlpDuration(ctx context.Context, url string) (time.Duration, error)
 }
 
 func parseYtDlpDuration(output []byte) (time.Duration, error) {
-	for _, line := range strings.Split(string(output), "\n") {
+	lines := strings.Split(string(output), "\n")
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "is_live" {
+			return 0, ErrYtDlpLiveStream
+		}
+	}
+	for _, line := range lines {
 		line = strings.TrimSpace(line)
 		if line == "" {
 			continue
@@ -78,6 +78,17 @@ func TestTimeoutForArchiveJobFallsBackWhenYoutubeProbeFails(t *testing.T) {
 	}
 }
 
+func TestTimeoutForArchiveJobScalesAudioWithDuration(t *testing.T) {
+	duration := 3 * time.Hour
+
+	got := timeoutForArchiveJob(context.Background(), ArchiveTypeAudio, "https://soundcloud.com/someone/a-long-set", nil, func(context.Context, string) (time.Duration, error) {
+		return duration, nil
+	})
+	if want := EstimateYtDlpTimeout(duration); got != want {
+		t.Fatalf("timeoutForArchiveJob(audio) = %s, want %s", got, want)
+	}
+}
+
 func TestTimeoutForArchiveJobDoesNotProbeNonYoutubeJobs(t *testing.T) {
 	probed := false
 
@@ -112,3 +123,52 @@ func TestParseYtDlpDurationRejectsInvalidOutput(t *testing.T) {
 		t.Fatal("parseYtDlpDuration accepted invalid output")
 	}
 }
+
+func TestTimeoutForArchiveJobSizesLiveStreamsFromTheRecordingWindow(t *testing.T) {
+	previous := LiveSettings()
+	t.Cleanup(func() { InitLive(previous) })
+	InitLive(LiveConfig{MaxDuration: 4 * time.Hour})
+
+	var logs bytes.Buffer
+	got := timeoutForArchiveJob(context.Background(), ArchiveTypeYtDlp, "https://www.youtube.com/watch?v=jfKfPfyJRdk", &logs, func(context.Context, string) (time.Duration, error) {
+		return 0, ErrYtDlpLiveStream
+	})
+	// Longer than YtDlpMaxTimeout: the window is configured, not estimated.
+	if want := 4*time.Hour + DefaultTimeoutConfig().YtDlpDurationOverhead; got != want {
+		t.Fatalf("timeoutForArchiveJob(live) = %s, want %s", got, want)
+	}
+	if !bytes.Contains(logs.Bytes(), []byte("Detected a live stream")) {
+		t.Fatalf("timeoutForArchiveJob did not log the live decision: %q", logs.String())
+	}
+}
+
+func TestParseYtDlpDurationDetectsLiveStreams(t *testing.T) {
+	if _, err := parseYtDlpDuration([]byte("NA\nis_live\n")); !errors.Is(err, ErrYtDlpLiveStream) {
+		t.Fatalf("parseYtDlpDuration(live) error = %v, want ErrYtDlpLiveStream", err)
+	}
+	// A finished broadcast has a duration like any other video.
+	got, err := parseYtDlpDuration([]byte("7200\nwas_live\n"))
+	if err != nil || got != 2*time.Hour {
+		t.Fatalf("parseYtDlpDuration(was_live) = %s, %v", got, err)
+	}
+}
+
+func TestArchiveJobTimeoutCoversTheLiveWindow(t *testing.T) {
+	previous := LiveSettings()
+	t.Cleanup(func() { InitLive(previous) })
+
+	InitLive(LiveConfig{MaxDuration: 2 * time.Hour})
+	if got := ArchiveJobTimeoutFor(ArchiveTypeYtDlp); got != ArchiveJobTimeout() {
+		t.Errorf("yt-dlp job timeout with a 2h window = %s, want the client default %s", got, ArchiveJobTimeout())
+	}
+
+	InitLive(LiveConfig{MaxDuration: 6 * time.Hour})
+	for _, typ := range []string{ArchiveTypeYtDlp, ArchiveTypeAudio} {
+		if got := ArchiveJobTimeoutFor(typ); got <= LiveRecordingTimeout() {
+			t.Errorf("%s job timeout = %s, shorter than the %s live recording", typ, got, LiveRecordingTimeout())
+		}
+	}
+	if got := ArchiveJobTimeoutFor(ArchiveTypeMHTML); got != ArchiveJobTimeout() {
+		t.Errorf("mhtml job timeout = %s, want the client default", got)
+	}
+}
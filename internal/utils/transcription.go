@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// TranscriptionConfig controls local speech-to-text for videos that arrive
+// without captions. It is off unless a model is configured: the binary alone
+// is useless, and shipping a default model would add hundreds of megabytes to
+// every deployment that never asked for this.
+type TranscriptionConfig struct {
+	// Binary is a whisper.cpp-compatible CLI ("whisper-cli", or the older
+	// "main"). It must accept -m, -f, -l, -t, -ovtt, -of and -np.
+	Binary string
+	// Model is the path to the ggml model file.
+	Model string
+	// MaxDuration skips videos longer than this. Transcription runs on the
+	// worker's CPU inside the archive job, so the short uploads that lack
+	// captions (TikToks, reels) are the target, not hour-long streams.
+	MaxDuration time.Duration
+	// Timeout bounds one transcription run. A stuck run costs the transcript,
+	// never the video.
+	Timeout time.Duration
+	// Threads is passed to -t. Zero lets the binary choose.
+	Threads int
+}
+
+// Enabled reports whether there is enough configuration to run.
+func (c TranscriptionConfig) Enabled() bool {
+	return c.Binary != "" && c.Model != ""
+}
+
+var (
+	transcriptionMu  sync.RWMutex
+	transcriptionCfg TranscriptionConfig
+)
+
+// Defaults applied by InitTranscription when a field is left zero.
+const (
+	defaultTranscriptionMaxDuration = 15 * time.Minute
+	defaultTranscriptionTimeout     = 10 * time.Minute
+)
+
+// InitTranscription installs the speech-to-text configuration and returns it
+// with defaults filled in.
+func InitTranscription(cfg TranscriptionConfig) TranscriptionConfig {
+	cfg.Binary = strings.TrimSpace(cfg.Binary)
+	cfg.Model = strings.TrimSpace(cfg.Model)
+	if cfg.MaxDuration <= 0 {
+		cfg.MaxDuration = defaultTranscriptionMaxDuration
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTranscriptionTimeout
+	}
+	if cfg.Threads < 0 {
+		cfg.Threads = 0
+	}
+	transcriptionMu.Lock()
+	transcriptionCfg = cfg
+	transcriptionMu.Unlock()
+	return cfg
+}
+
+// TranscriptionSettings returns the active configuration.
+func TranscriptionSettings() TranscriptionConfig {
+	transcriptionMu.RLock()
+	defer transcriptionMu.RUnlock()
+	return transcriptionCfg
+}
@@ -44,6 +44,7 @@ func IsGitURL(url string) bool {
 		"gitlab.com/",
 		"bitbucket.org/",
 		"codeberg.org/",
+		"gitea.com/",
 	}
 
 	for _, platform := range platforms {
@@ -63,7 +64,8 @@ func IsGitURL(url string) bool {
 		}
 	}
 
-	return false
+	// Self-hosted forges named in FORGE_HOSTS
+	return IsForgeURL(url)
 }
 
 // Check if path segments indicate a non-repository URL
@@ -316,8 +318,10 @@ func IsFacebookURL(url string) bool {
 // than video, and routing them here is what produced a ~87% yt-dlp failure rate
 // on /p/ URLs. They are handled by IsGalleryDLURL instead. TikTok photo posts
 // are excluded for the same reason: yt-dlp cannot download a slideshow.
+// Playlists and channels are excluded too: they are many videos, and belong
+// to the playlist archiver (see IsPlaylistURL).
 func IsVideoURL(url string) bool {
-	if IsInstagramPhotoPostURL(url) || IsTikTokPhotoPostURL(url) {
+	if IsInstagramPhotoPostURL(url) || IsTikTokPhotoPostURL(url) || IsPlaylistURL(url) {
 		return false
 	}
 	return IsYouTubeURL(url) || IsVimeoURL(url) || IsInstagramURL(url) || IsTikTokURL(url) || IsFacebookURL(url)
@@ -461,7 +465,7 @@ func ShouldCreateGalleryDLItem(rawURL string) bool {
 	if !IsGalleryDLURL(rawURL) {
 		return false
 	}
-	if GalleryDLURLRequiresCookies(rawURL) && !MediaCookiesConfigured() {
+	if GalleryDLURLRequiresCookies(rawURL) && !MediaCookiesConfigured(rawURL) {
 		// Without cookies the native run is guaranteed to fail, but a
 		// configured Bright Data fallback gives the item a real path to
 		// success, so it is worth creating (and paying for) after the native
@@ -526,8 +530,52 @@ func IsItchURL(url string) bool {
 
 // Get archive types based on URL patterns
 func GetArchiveTypes(url string) []string {
+	// A bare audio file is not a page: a browser would render its own media
+	// player, so the audio is the whole capture.
+	if IsAudioEnclosureURL(url) {
+		return []string{ArchiveTypeAudio}
+	}
+
+	// Neither is any other document that is not a page.
+	if probeable(url) {
+		if contentType := RemoteContentType(url); contentType != "" && !IsPageContentType(contentType) {
+			if strings.HasPrefix(strings.ToLower(contentType), "audio/") {
+				return []string{ArchiveTypeAudio}
+			}
+			return []string{ArchiveTypeFile}
+		}
+	}
+	return pageArchiveTypes(url)
+}
+
+// probeable reports whether GetArchiveTypes asks the content probe about a
+// URL. Only URLs no site rule claims are probed: those rules all describe
+// HTML pages, and a request per submission to YouTube would be wasted.
+func probeable(url string) bool {
+	return !IsItchURL(url) && !IsSocialMediaPostURL(url) && !IsPlaylistURL(url) && !IsAudioURL(url) && !IsGitURL(url) && !IsForgeURL(url)
+}
+
+// ContentProbeOutcomes returns every type list GetArchiveTypes could give url
+// depending on what the content probe answers (the page types, a file, or
+// audio), or nil when it would not probe. A caller that can answer from an
+// earlier capture under any of them need not make the probe's request.
+func ContentProbeOutcomes(url string) [][]string {
+	p, _ := remoteContentProbe.Load().(contentProbe)
+	if p.probe == nil || IsAudioEnclosureURL(url) || !probeable(url) {
+		return nil
+	}
+	return [][]string{pageArchiveTypes(url), {ArchiveTypeFile}, {ArchiveTypeAudio}}
+}
+
+// pageArchiveTypes is GetArchiveTypes for a URL known to serve a page.
+func pageArchiveTypes(url string) []string {
 	types := []string{ArchiveTypeMHTML, ArchiveTypeScreenshot}
 
+	// The printed PDF is opt-in: it is a third full browser session per page.
+	if PDFSettings().Default {
+		types = append(types, ArchiveTypePDF)
+	}
+
 	// Add itch archiver for itch.io URLs
 	if IsItchURL(url) {
 		types = append(types, ArchiveTypeItch)
@@ -544,11 +592,27 @@ func GetArchiveTypes(url string) []string {
 		types = append(types, ArchiveTypeYtDlp)
 	}
 
+	// Playlists and channels get one child capture per video instead.
+	if IsPlaylistURL(url) {
+		types = append(types, ArchiveTypePlaylist)
+	}
+
+	// Podcast episodes and music tracks keep only their audio.
+	if IsAudioURL(url) {
+		types = append(types, ArchiveTypeAudio)
+	}
+
 	// Add Git archiver for Git repository URLs
 	if IsGitURL(url) {
 		types = append(types, ArchiveTypeGit)
 	}
 
+	// A project on a code host also has issues, releases and a wiki that
+	// the repository does not hold.
+	if IsForgeURL(url) {
+		types = append(types, ArchiveTypeForge)
+	}
+
 	return types
 }
 
@@ -233,6 +233,9 @@ type ArchiveRequest struct {
 	// Force skips capture aliasing: even when a fresh capture of the same URL
 	// exists, a full re-archive is performed. Admin paths always force.
 	Force bool `json:"force,omitempty"`
+	// Quality limits what video and playlist items download. Absent is the
+	// best available.
+	Quality *VideoQuality `json:"quality,omitempty"`
 }
 
 func (r *ArchiveRequest) Validate() error {
@@ -254,5 +257,20 @@ func (r *ArchiveRequest) Validate() error {
 		}
 	}
 
+	if r.Quality != nil {
+		if err := r.Quality.Validate(); err != nil {
+			return fmt.Errorf("invalid quality: %v", err)
+		}
+	}
+
 	return nil
 }
+
+// VideoQuality returns the requested policy, or the default one when the
+// request names none.
+func (r *ArchiveRequest) VideoQuality() VideoQuality {
+	if r.Quality == nil {
+		return VideoQuality{}
+	}
+	return r.Quality.Normalize()
+}
@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// VideoQuality is a per-request policy for what yt-dlp downloads. The zero
+// value is the historical behavior, the best video and best audio available,
+// so a request that names no policy and an archive captured before policies
+// existed mean the same thing.
+type VideoQuality struct {
+	// MaxHeight caps the video's height in pixels (e.g. 720). Zero is no cap.
+	MaxHeight int `json:"max_height,omitempty"`
+	// MaxFilesizeMB caps each downloaded format, in MiB. It is checked against
+	// the sizes the platform reports, so a format of unknown size is still
+	// allowed. Zero is no cap.
+	MaxFilesizeMB int64 `json:"max_filesize_mb,omitempty"`
+	// AudioOnly keeps only the best audio stream, stored as M4A.
+	AudioOnly bool `json:"audio_only,omitempty"`
+	// PreferCodec ranks formats of this video codec first when several fit
+	// the caps. It is a preference, not a requirement: a video not offered in
+	// the codec is still archived.
+	PreferCodec string `json:"prefer_codec,omitempty"`
+}
+
+// videoQualityCodecs maps the accepted PreferCodec names to yt-dlp's format
+// sort codec names.
+var videoQualityCodecs = map[string]string{
+	"h264": "h264",
+	"h265": "h265",
+	"vp9":  "vp9",
+	"av1":  "av01",
+}
+
+// IsZero reports whether q is the default best-available policy.
+func (q VideoQuality) IsZero() bool {
+	return q == VideoQuality{}
+}
+
+// Normalize lower-cases the codec and maps its common aliases, so equal
+// policies compare equal however they were spelled.
+func (q VideoQuality) Normalize() VideoQuality {
+	q.PreferCodec = strings.ToLower(strings.TrimSpace(q.PreferCodec))
+	switch q.PreferCodec {
+	case "avc", "avc1":
+		q.PreferCodec = "h264"
+	case "hevc":
+		q.PreferCodec = "h265"
+	case "av01":
+		q.PreferCodec = "av1"
+	}
+	return q
+}
+
+// Validate rejects a policy yt-dlp could not honor as asked.
+func (q VideoQuality) Validate() error {
+	q = q.Normalize()
+	if q.MaxHeight != 0 && (q.MaxHeight < 144 || q.MaxHeight > 4320) {
+		return fmt.Errorf("max_height must be between 144 and 4320, got %d", q.MaxHeight)
+	}
+	if q.MaxFilesizeMB < 0 {
+		return fmt.Errorf("max_filesize_mb must not be negative")
+	}
+	if q.PreferCodec != "" {
+		if _, ok := videoQualityCodecs[q.PreferCodec]; !ok {
+			return fmt.Errorf("prefer_codec must be one of h264, h265, vp9 or av1, got %q", q.PreferCodec)
+		}
+		if q.AudioOnly {
+			return fmt.Errorf("prefer_codec is a video codec and does not apply to audio_only")
+		}
+	}
+	return nil
+}
+
+// YtDlpFormatArgs returns the format selection arguments for this policy.
+// Caps are filters in the selector, so a video with no format under them
+// fails the download rather than quietly archiving something larger.
+func (q VideoQuality) YtDlpFormatArgs() []string {
+	q = q.Normalize()
+	if q.IsZero() {
+		return []string{"-f", "bestvideo+bestaudio/best"}
+	}
+
+	var sizeFilter string
+	if q.MaxFilesizeMB > 0 {
+		// The "?" lets formats of unknown size through; filesize_approx covers
+		// platforms that only estimate.
+		sizeFilter = fmt.Sprintf("[filesize<=?%dM][filesize_approx<=?%dM]", q.MaxFilesizeMB, q.MaxFilesizeMB)
+	}
+	if q.AudioOnly {
+		// M4A first: extracting it to M4A is a copy, where anything else is
+		// a transcode to AAC.
+		return []string{"-f", "bestaudio[ext=m4a]" + sizeFilter + "/bestaudio" + sizeFilter + "/best" + sizeFilter}
+	}
+
+	filter := sizeFilter
+	if q.MaxHeight > 0 {
+		filter = "[height<=" + strconv.Itoa(q.MaxHeight) + "]" + filter
+	}
+	args := []string{"-f", "bestvideo" + filter + "+bestaudio/best" + filter}
+	if q.PreferCodec != "" {
+		args = append(args, "-S", "vcodec:"+videoQualityCodecs[q.PreferCodec])
+	}
+	return args
+}
+
+// Satisfies reports whether an archive made under policy q is good enough to
+// answer a request for policy requested. An archive with fewer limits answers
+// a request with more: a request's caps say what it can do without, and an
+// existing larger copy costs nothing to reuse. The reverse never holds, and an
+// audio-only archive only ever answers an audio-only request.
+func (q VideoQuality) Satisfies(requested VideoQuality) bool {
+	q, requested = q.Normalize(), requested.Normalize()
+	if q.AudioOnly && !requested.AudioOnly {
+		return false
+	}
+	if !capCovers(int64(q.MaxHeight), int64(requested.MaxHeight)) && !requested.AudioOnly {
+		return false
+	}
+	if !capCovers(q.MaxFilesizeMB, requested.MaxFilesizeMB) {
+		return false
+	}
+	if requested.PreferCodec != "" && !requested.AudioOnly && q.PreferCodec != requested.PreferCodec {
+		return false
+	}
+	return true
+}
+
+// capCovers reports whether a limit of have (zero for none) is at least as
+// permissive as a limit of want.
+func capCovers(have, want int64) bool {
+	if have == 0 {
+		return true
+	}
+	return want != 0 && have >= want
+}
+
+// EncodeVideoQuality is the ArchiveItem.QualityPolicy column value for q:
+// empty for the default policy, so unrestricted items stay indistinguishable
+// from those archived before policies existed.
+func EncodeVideoQuality(q VideoQuality) string {
+	q = q.Normalize()
+	if q.IsZero() {
+		return ""
+	}
+	data, _ := json.Marshal(q)
+	return string(data)
+}
+
+// DecodeVideoQuality reads an ArchiveItem.QualityPolicy column value. An empty
+// or unreadable value is the default policy.
+func DecodeVideoQuality(value string) VideoQuality {
+	var q VideoQuality
+	if value == "" || json.Unmarshal([]byte(value), &q) != nil {
+		return VideoQuality{}
+	}
+	return q.Normalize()
+}
+
+// ArchiveTypeUsesVideoQuality reports whether items of this type record and
+// honor a quality policy. Playlists carry theirs down to every child video.
+func ArchiveTypeUsesVideoQuality(archiveType string) bool {
+	return ArchiveTypesEqual(archiveType, ArchiveTypeYtDlp) || ArchiveTypesEqual(archiveType, ArchiveTypePlaylist)
+}
+
+// EnsureQualityPolicySchema adds archive_items.quality_policy on PostgreSQL,
+// for the same reason EnsureCompletenessSchema exists. Existing rows read as
+// empty, which is the default policy they were archived under.
+func EnsureQualityPolicySchema(db *gorm.DB) error {
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+	if err := db.Exec(`ALTER TABLE archive_items ADD COLUMN IF NOT EXISTS quality_policy text`).Error; err != nil {
+		return fmt.Errorf("add archive_items.quality_policy column: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVideoQualityYtDlpFormatArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		quality VideoQuality
+		want    []string
+	}{
+		{"default is unchanged", VideoQuality{}, []string{"-f", "bestvideo+bestaudio/best"}},
+		{"height", VideoQuality{MaxHeight: 720}, []string{"-f", "bestvideo[height<=720]+bestaudio/best[height<=720]"}},
+		{"height and size", VideoQuality{MaxHeight: 1080, MaxFilesizeMB: 500},
+			[]string{"-f", "bestvideo[height<=1080][filesize<=?500M][filesize_approx<=?500M]+bestaudio/best[height<=1080][filesize<=?500M][filesize_approx<=?500M]"}},
+		{"codec", VideoQuality{PreferCodec: "AV1"}, []string{"-f", "bestvideo+bestaudio/best", "-S", "vcodec:av01"}},
+		{"audio only", VideoQuality{AudioOnly: true}, []string{"-f", "bestaudio[ext=m4a]/bestaudio/best"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.quality.YtDlpFormatArgs(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("YtDlpFormatArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVideoQualityValidate(t *testing.T) {
+	valid := []VideoQuality{{}, {MaxHeight: 144}, {MaxHeight: 4320, PreferCodec: "hevc"}, {AudioOnly: true, MaxFilesizeMB: 50}}
+	for _, q := range valid {
+		if err := q.Validate(); err != nil {
+			t.Errorf("%+v: %v", q, err)
+		}
+	}
+	invalid := []VideoQuality{{MaxHeight: 100}, {MaxHeight: 8000}, {MaxFilesizeMB: -1}, {PreferCodec: "mpeg2"}, {AudioOnly: true, PreferCodec: "h264"}}
+	for _, q := range invalid {
+		if err := q.Validate(); err == nil {
+			t.Errorf("%+v was accepted", q)
+		}
+	}
+}
+
+func TestVideoQualityColumnRoundTrip(t *testing.T) {
+	if got := EncodeVideoQuality(VideoQuality{}); got != "" {
+		t.Errorf("default policy encodes as %q, want empty like a legacy row", got)
+	}
+	q := VideoQuality{MaxHeight: 720, PreferCodec: "avc"}
+	if got := DecodeVideoQuality(EncodeVideoQuality(q)); got != (VideoQuality{MaxHeight: 720, PreferCodec: "h264"}) {
+		t.Errorf("round trip = %+v", got)
+	}
+	if got := DecodeVideoQuality("{not json"); !got.IsZero() {
+		t.Errorf("unreadable column decoded as %+v", got)
+	}
+}
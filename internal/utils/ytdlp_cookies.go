@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 var (
@@ -127,7 +130,12 @@ func YtDlpCookieArgsForRun() ([]string, func(), error) {
 	if err != nil {
 		return nil, func() {}, fmt.Errorf("failed to read yt-dlp cookies file: %w", err)
 	}
+	return writeRunCookies(content)
+}
 
+// writeRunCookies writes one run's private copy of a cookie jar and returns
+// the --cookies arguments for it.
+func writeRunCookies(content []byte) ([]string, func(), error) {
 	tmp, err := os.CreateTemp("", "yt-dlp-cookies-run-*.txt")
 	if err != nil {
 		return nil, func() {}, fmt.Errorf("failed to create per-run yt-dlp cookies file: %w", err)
@@ -147,3 +155,169 @@ func YtDlpCookieArgsForRun() ([]string, func(), error) {
 
 	return []string{"--cookies", path}, cleanup, nil
 }
+
+// CookieJarStatus summarizes a Netscape cookies.txt for health reporting and
+// the admin cookie jar page. It carries the names of recognized login cookies
+// but never a cookie value.
+type CookieJarStatus struct {
+	Configured bool `json:"configured"`
+	Cookies    int  `json:"cookies"`
+	Expired    int  `json:"expired"`
+	// Domains lists each cookie domain with the latest expiry among its
+	// cookies; nil means only session cookies, which never expire on disk.
+	Domains map[string]*time.Time `json:"domains,omitempty"`
+	// EarliestExpiry is the soonest any domain loses its last live cookie.
+	EarliestExpiry *time.Time `json:"earliest_expiry,omitempty"`
+	// ExpiredDomains lists domains whose every cookie has expired: logins
+	// there are gone and need a fresh export.
+	ExpiredDomains []string `json:"expired_domains,omitempty"`
+	// Logins lists the cookies that carry a platform login. Their expiry, not
+	// the jar's, is when archiving starts failing.
+	Logins []CookieLogin `json:"logins,omitempty"`
+}
+
+// CookieLogin is one recognized login-session cookie.
+type CookieLogin struct {
+	Domain string `json:"domain"`
+	Name   string `json:"name"`
+	// Expires is nil for a browser-session cookie, which carries no date.
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// loginCookieNames names the cookie that holds the signed-in session on each
+// platform Arker archives behind a login.
+var loginCookieNames = map[string][]string{
+	"instagram.com": {"sessionid"},
+	"facebook.com":  {"xs"},
+	"tiktok.com":    {"sessionid", "sid_tt"},
+	"youtube.com":   {"__Secure-3PSID", "SID"},
+	"x.com":         {"auth_token"},
+	"twitter.com":   {"auth_token"},
+	"reddit.com":    {"reddit_session", "token_v2"},
+	"pinterest.com": {"_pinterest_sess"},
+	"vimeo.com":     {"vimeo"},
+}
+
+func isLoginCookie(domain, name string) bool {
+	for site, names := range loginCookieNames {
+		if hostMatches(domain, site) && slices.Contains(names, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// InspectYtDlpCookies reads the configured cookies file and reports how many
+// cookies it holds and when each domain's login runs out. An unreadable file
+// is an error: every yt-dlp and gallery-dl run would fail on it.
+func InspectYtDlpCookies(now time.Time) (CookieJarStatus, error) {
+	ytDlpCookiesMu.RLock()
+	path := ytDlpCookiesFilePath
+	ytDlpCookiesMu.RUnlock()
+	if path == "" {
+		return CookieJarStatus{}, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return CookieJarStatus{Configured: true}, fmt.Errorf("failed to read yt-dlp cookies file: %w", err)
+	}
+	// Lenient: this jar is already in use, and yt-dlp skips lines it cannot
+	// read too.
+	status, _ := summarizeNetscapeCookies(content, now, false)
+	return status, nil
+}
+
+// ParseNetscapeCookies validates a Netscape cookies.txt and summarizes it.
+// Every non-comment line must have the seven tab-separated fields with a
+// numeric expiry, and the jar must hold at least one cookie: a jar that
+// yt-dlp would half-read is rejected up front rather than discovered by a
+// failed capture.
+func ParseNetscapeCookies(content []byte, now time.Time) (CookieJarStatus, error) {
+	return summarizeNetscapeCookies(content, now, true)
+}
+
+func summarizeNetscapeCookies(content []byte, now time.Time, strict bool) (CookieJarStatus, error) {
+	status := CookieJarStatus{Configured: true, Domains: make(map[string]*time.Time)}
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimRight(line, "\r"), "#HttpOnly_"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 7 {
+			if strict {
+				return CookieJarStatus{}, fmt.Errorf("line %d: want 7 tab-separated fields, got %d", i+1, len(fields))
+			}
+			continue
+		}
+		domain := strings.TrimPrefix(strings.ToLower(fields[0]), ".")
+		expiry, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil || domain == "" {
+			if strict {
+				return CookieJarStatus{}, fmt.Errorf("line %d: invalid domain or expiry", i+1)
+			}
+			continue
+		}
+		status.Cookies++
+		var expires *time.Time
+		if expiry != 0 {
+			at := time.Unix(expiry, 0).UTC()
+			expires = &at
+		}
+		if isLoginCookie(domain, fields[5]) {
+			status.Logins = append(status.Logins, CookieLogin{Domain: domain, Name: fields[5], Expires: expires})
+		}
+
+		latest, seen := status.Domains[domain]
+		if expires == nil {
+			// Session cookie: yt-dlp sends it on every run, so the domain's
+			// login never runs out on disk.
+			status.Domains[domain] = nil
+			continue
+		}
+		if !expires.After(now) {
+			status.Expired++
+		}
+		// A nil latest is a session cookie, which already outlives any date.
+		if !seen || (latest != nil && expires.After(*latest)) {
+			status.Domains[domain] = expires
+		}
+	}
+	if strict && status.Cookies == 0 {
+		return CookieJarStatus{}, fmt.Errorf("no cookies found; export the jar in Netscape cookies.txt format")
+	}
+
+	for domain, latest := range status.Domains {
+		if latest == nil {
+			continue
+		}
+		if !latest.After(now) {
+			status.ExpiredDomains = append(status.ExpiredDomains, domain)
+			continue
+		}
+		if status.EarliestExpiry == nil || latest.Before(*status.EarliestExpiry) {
+			status.EarliestExpiry = latest
+		}
+	}
+	slices.Sort(status.ExpiredDomains)
+	return status, nil
+}
+
+// LoginExpiry is when the jar's login for host runs out: the latest expiry
+// among its login cookies for that host, nil when the login is a session
+// cookie. ok is false when the jar holds no recognized login for host.
+func (s CookieJarStatus) LoginExpiry(host string) (expires *time.Time, ok bool) {
+	for _, login := range s.Logins {
+		if !hostMatches(login.Domain, host) && !hostMatches(host, login.Domain) {
+			continue
+		}
+		if login.Expires == nil {
+			return nil, true
+		}
+		if !ok || (expires != nil && login.Expires.After(*expires)) {
+			expires = login.Expires
+		}
+		ok = true
+	}
+	return expires, ok
+}
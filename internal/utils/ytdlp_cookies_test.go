@@ -2,9 +2,13 @@ package utils
 
 import (
 	"encoding/base64"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func resetYtDlpCookies(t *testing.T) {
@@ -208,3 +212,142 @@ func TestInitYtDlpCookiesFileTakesPrecedenceOverBase64(t *testing.T) {
 		t.Fatalf("InitYtDlpCookies path = %q, want file path %q", path, cookiesPath)
 	}
 }
+
+func TestInspectYtDlpCookiesReportsExpiryPerDomain(t *testing.T) {
+	resetYtDlpCookies(t)
+	now := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	soon := now.Add(48 * time.Hour).Unix()
+	past := now.Add(-time.Hour).Unix()
+	content := "# Netscape HTTP Cookie File\n" +
+		"#HttpOnly_.instagram.com\tTRUE\t/\tTRUE\t" + itoa(soon) + "\tsessionid\tsecret\n" +
+		".instagram.com\tTRUE\t/\tTRUE\t" + itoa(past) + "\tcsrftoken\tx\n" +
+		".tiktok.com\tTRUE\t/\tTRUE\t" + itoa(past) + "\tsid_tt\ty\n" +
+		".youtube.com\tTRUE\t/\tTRUE\t0\tPREF\tz\n" +
+		"malformed line\n"
+	cookiesPath := filepath.Join(t.TempDir(), "cookies.txt")
+	if err := os.WriteFile(cookiesPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InitYtDlpCookies(cookiesPath, "", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	jar, err := InspectYtDlpCookies(now)
+	if err != nil {
+		t.Fatalf("InspectYtDlpCookies: %v", err)
+	}
+	if !jar.Configured || jar.Cookies != 4 || jar.Expired != 2 {
+		t.Errorf("jar = %+v, want 4 cookies with 2 expired", jar)
+	}
+	if len(jar.ExpiredDomains) != 1 || jar.ExpiredDomains[0] != "tiktok.com" {
+		t.Errorf("expired domains = %v, want [tiktok.com]", jar.ExpiredDomains)
+	}
+	if jar.EarliestExpiry == nil || jar.EarliestExpiry.Unix() != soon {
+		t.Errorf("earliest expiry = %v, want the instagram session's", jar.EarliestExpiry)
+	}
+	if latest, ok := jar.Domains["youtube.com"]; !ok || latest != nil {
+		t.Errorf("session-only domain = %v, %v; want present with no expiry", latest, ok)
+	}
+
+	if err := os.Remove(cookiesPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InspectYtDlpCookies(now); err == nil {
+		t.Error("a vanished cookies file was not reported")
+	}
+}
+
+func TestInspectYtDlpCookiesUnconfigured(t *testing.T) {
+	resetYtDlpCookies(t)
+	if _, err := InitYtDlpCookies("", "", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	jar, err := InspectYtDlpCookies(time.Now())
+	if err != nil || jar.Configured {
+		t.Errorf("jar = %+v, %v; want unconfigured and no error", jar, err)
+	}
+}
+
+func itoa(n int64) string { return strconv.FormatInt(n, 10) }
+
+func TestParseNetscapeCookiesIsStrict(t *testing.T) {
+	now := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	session := now.Add(30 * 24 * time.Hour).Unix()
+	jar, err := ParseNetscapeCookies([]byte("# Netscape HTTP Cookie File\n\n"+
+		"#HttpOnly_.instagram.com\tTRUE\t/\tTRUE\t"+itoa(session)+"\tsessionid\tsecret\n"+
+		".instagram.com\tTRUE\t/\tTRUE\t0\tcsrftoken\tx\n"), now)
+	if err != nil {
+		t.Fatalf("ParseNetscapeCookies: %v", err)
+	}
+	if jar.Cookies != 2 || len(jar.Logins) != 1 || jar.Logins[0].Name != "sessionid" {
+		t.Errorf("jar = %+v, want 2 cookies and the sessionid login", jar)
+	}
+	if expires, ok := jar.LoginExpiry("instagram.com"); !ok || expires == nil || expires.Unix() != session {
+		t.Errorf("login expiry = %v, %v; want the sessionid expiry", expires, ok)
+	}
+	if _, ok := jar.LoginExpiry("tiktok.com"); ok {
+		t.Error("a login was reported for a host the jar has none for")
+	}
+
+	for name, content := range map[string]string{
+		"malformed line": ".instagram.com\tTRUE\t/\tTRUE\t0\tsessionid\n",
+		"bad expiry":     ".instagram.com\tTRUE\t/\tTRUE\tsoon\tsessionid\tsecret\n",
+		"no cookies":     "# Netscape HTTP Cookie File\n",
+		"json export":    `[{"domain": ".instagram.com", "name": "sessionid"}]`,
+	} {
+		if _, err := ParseNetscapeCookies([]byte(content), now); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestMediaCookieArgsPreferStoredJar(t *testing.T) {
+	resetYtDlpCookies(t)
+	t.Cleanup(func() { mediaCookieJars.Store(mediaCookieJarSource{}) })
+	envJar := filepath.Join(t.TempDir(), "cookies.txt")
+	if err := os.WriteFile(envJar, []byte("# env jar\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InitYtDlpCookies(envJar, "", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	var advances []bool
+	SetMediaCookieJars(func(rawURL string, advance bool) ([]byte, string, bool, error) {
+		if !strings.Contains(rawURL, "instagram.com") {
+			return nil, "", false, nil
+		}
+		advances = append(advances, advance)
+		return []byte("# stored jar\n"), "instagram.com/bot-1", true, nil
+	}, func(rawURL string) bool { return strings.Contains(rawURL, "instagram.com") })
+
+	var log strings.Builder
+	args, cleanup, err := MediaCookieArgsForRun("https://www.instagram.com/p/ABC/", &log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(cookieArgsPath(t, args))
+	cleanup()
+	if string(got) != "# stored jar\n" || !strings.Contains(log.String(), `"instagram.com/bot-1"`) {
+		t.Errorf("run got %q, log %q; want the stored jar, named in the log", got, log.String())
+	}
+
+	args, cleanup, err = MediaCookieArgsForProbe("https://www.instagram.com/p/ABC/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup()
+	if len(advances) != 2 || !advances[0] || advances[1] {
+		t.Errorf("advance flags = %v, want the run to advance and the probe not to", advances)
+	}
+
+	args, cleanup, err = MediaCookieArgsForRun("https://vimeo.com/1", io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = os.ReadFile(cookieArgsPath(t, args))
+	cleanup()
+	if string(got) != "# env jar\n" {
+		t.Errorf("uncovered host got %q, want the env jar", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -13,6 +14,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/riverqueue/river"
 	"gorm.io/gorm"
 
@@ -29,6 +31,9 @@ type ArchiveJobArgs struct {
 	ShortID   string `json:"short_id"`
 	Type      string `json:"type"`
 	URL       string `json:"url"`
+	// Quality is the video quality policy for yt-dlp and playlist jobs. Nil is
+	// the default best-available policy.
+	Quality *utils.VideoQuality `json:"quality,omitempty"`
 }
 
 // Kind returns the job kind for River.
@@ -51,6 +56,12 @@ func NewArchiveWorker(storage storage.Storage, db *gorm.DB, archiversMap map[str
 	}
 }
 
+// Timeout overrides the client-wide job timeout for video and audio jobs,
+// which must outlast a live recording of LIVE_MAX_DURATION.
+func (w *ArchiveWorker) Timeout(job *river.Job[ArchiveJobArgs]) time.Duration {
+	return utils.ArchiveJobTimeoutFor(job.Args.Type)
+}
+
 // Work processes a single archive job from the queue.
 func (w *ArchiveWorker) Work(ctx context.Context, job *river.Job[ArchiveJobArgs]) error {
 	args := job.Args
@@ -98,15 +109,26 @@ func (w *ArchiveWorker) Work(ctx context.Context, job *river.Job[ArchiveJobArgs]
 			slog.Error("Archive job permanently failed",
 				"short_id", args.ShortID, "type", args.Type,
 				"attempts", job.MaxAttempts, "error", err)
+			w.enqueueManifest(ctx, item.CaptureID, args.ShortID)
 		}
 		// Let River retry (if any attempts left)
 		return err
 	}
 
 	logger.Info("Job processing completed successfully")
+	w.enqueueManifest(ctx, item.CaptureID, args.ShortID)
 	return nil
 }
 
+// enqueueManifest has the capture signed if this job was its last to finish.
+// A capture left unsigned is signed when its manifest is first asked for.
+func (w *ArchiveWorker) enqueueManifest(ctx context.Context, captureID uint, shortID string) {
+	riverClient, _ := river.ClientFromContextSafely[pgx.Tx](ctx)
+	if err := EnqueueManifestIfSettled(ctx, w.db, riverClient, captureID, shortID); err != nil {
+		slog.Warn("Failed to queue capture manifest", "short_id", shortID, "error", err)
+	}
+}
+
 // processArchiveJob handles the logic for a single job attempt.
 func processArchiveJob(ctx context.Context, jobArgs ArchiveJobArgs, item *models.ArchiveItem, storage storage.Storage, db *gorm.DB, archiversMap map[string]archivers.Archiver) error {
 	arch, ok := archiversMap[jobArgs.Type]
@@ -127,6 +149,22 @@ func processArchiveJob(ctx context.Context, jobArgs ArchiveJobArgs, item *models
 		"url", jobArgs.URL,
 		"attempt", item.RetryCount)
 
+	// The job args are authoritative; the item's own record covers jobs
+	// queued by paths that predate the field.
+	quality := utils.DecodeVideoQuality(item.QualityPolicy)
+	if jobArgs.Quality != nil {
+		quality = jobArgs.Quality.Normalize()
+	}
+	if !quality.IsZero() {
+		fmt.Fprintf(dbLogWriter, "Quality policy: %s\n", utils.EncodeVideoQuality(quality))
+		ctx = archivers.WithVideoQuality(ctx, quality)
+	}
+
+	checkpoints := &liveCheckpoints{store: storage}
+	if utils.ArchiveTypesEqual(jobArgs.Type, utils.ArchiveTypeYtDlp) {
+		ctx = archivers.WithLiveCheckpoint(ctx, liveCheckpointSaver(jobArgs, storage, db, item, checkpoints))
+	}
+
 	timeout := utils.TimeoutForArchiveJob(ctx, jobArgs.Type, jobArgs.URL, dbLogWriter)
 	ctx, cancel := context.WithTimeout(ctx, timeout) // respect River cancellation
 	defer cancel()
@@ -141,9 +179,34 @@ func processArchiveJob(ctx context.Context, jobArgs ArchiveJobArgs, item *models
 
 	if err != nil {
 		slog.Error("Archive operation failed", "short_id", jobArgs.ShortID, "type", jobArgs.Type, "error", err)
+		if promoteLiveCheckpoint(db, item, dbLogWriter) {
+			return nil
+		}
 		return err
 	}
 
+	// A playlist's children are part of its product: they are queued before
+	// the item can be marked completed, so a completed playlist always lists
+	// every video it took.
+	if result.Playlist != nil {
+		riverClient, _ := river.ClientFromContextSafely[pgx.Tx](ctx)
+		if err := expandPlaylist(ctx, db, riverClient, item, result.Playlist, dbLogWriter); err != nil {
+			fmt.Fprintf(dbLogWriter, "\nFailed to queue playlist videos: %v\n", err)
+			return err
+		}
+	}
+	if len(result.Submodules) > 0 {
+		riverClient, _ := river.ClientFromContextSafely[pgx.Tx](ctx)
+		if err := expandSubmodules(ctx, db, riverClient, item, result.Submodules, dbLogWriter); err != nil {
+			fmt.Fprintf(dbLogWriter, "\nFailed to queue submodules: %v\n", err)
+			// The tar is still streaming; closing it ends the goroutine.
+			if c, ok := result.Data.(io.Closer); ok {
+				c.Close()
+			}
+			return err
+		}
+	}
+
 	// Save the resulting data to storage. The archive bucket forbids
 	// overwrites and deletes (bucket lock), so every upload attempt writes a
 	// fresh object; the item's storage_key records the key that succeeded.
@@ -157,6 +220,9 @@ func processArchiveJob(ctx context.Context, jobArgs ArchiveJobArgs, item *models
 		return err
 	}
 
+	// The final recording supersedes the last live checkpoint.
+	checkpoints.replace(nil)
+
 	slog.Info("Archive saved successfully",
 		"short_id", jobArgs.ShortID,
 		"type", jobArgs.Type,
@@ -174,6 +240,16 @@ func processArchiveJob(ctx context.Context, jobArgs ArchiveJobArgs, item *models
 		}
 	}
 
+	// Videos get an HLS copy for seeking when it is enabled. Queued rather than
+	// done here: this job's clock was sized for the download, and the worker
+	// decides whether the video is long enough to bother.
+	if utils.ArchiveTypesEqual(jobArgs.Type, utils.ArchiveTypeYtDlp) {
+		riverClient, _ := river.ClientFromContextSafely[pgx.Tx](ctx)
+		if err := EnqueueHLS(ctx, riverClient, jobArgs.ShortID, jobArgs.Type); err != nil {
+			slog.Warn("Failed to queue HLS packaging", "short_id", jobArgs.ShortID, "error", err)
+		}
+	}
+
 	return nil
 }
 
@@ -183,7 +259,7 @@ func processArchiveJob(ctx context.Context, jobArgs ArchiveJobArgs, item *models
 // item whose required metadata is only partly stored.
 func saveArchiveResult(ctx context.Context, result archivers.Result, keyBase string, store storage.Storage, db *gorm.DB, item *models.ArchiveItem, logWriter io.Writer) error {
 	key := keyBase + result.Extension
-	fileSize, err := writeArchiveData(result.Data, key, store)
+	fileSize, checksum, err := writeArchiveData(result.Data, key, store)
 	if err != nil {
 		return err
 	}
@@ -237,6 +313,7 @@ func saveArchiveResult(ctx context.Context, result archivers.Result, keyBase str
 		"storage_key":      key,
 		"extension":        result.Extension,
 		"file_size":        fileSize,
+		"checksum":         checksum,
 		"metadata_key":     metadataKey,
 		"raw_metadata_key": rawMetadataKey,
 	}
@@ -316,6 +393,11 @@ func writeJSONSidecar(store storage.Storage, key string, data []byte) error {
 	if !json.Valid(data) {
 		return fmt.Errorf("sidecar is not valid JSON")
 	}
+	return writeStored(store, key, data)
+}
+
+// writeStored writes data to storage under key.
+func writeStored(store storage.Storage, key string, data []byte) error {
 	w, err := store.Writer(key)
 	if err != nil {
 		return err
@@ -370,7 +452,7 @@ func uploadNonce() string {
 
 // saveArchiveData handles writing archive data to storage and updating the database.
 func saveArchiveData(data io.Reader, key, ext, source string, storage storage.Storage, db *gorm.DB, item *models.ArchiveItem) error {
-	fileSize, err := writeArchiveData(data, key, storage)
+	fileSize, checksum, err := writeArchiveData(data, key, storage)
 	if err != nil {
 		return err
 	}
@@ -381,6 +463,7 @@ func saveArchiveData(data io.Reader, key, ext, source string, storage storage.St
 		"storage_key": key,
 		"extension":   ext,
 		"file_size":   fileSize,
+		"checksum":    checksum,
 	}
 	// Source is only written when the archiver declared one (the Bright Data
 	// fallback does); native archivers leave the column at its default.
@@ -390,9 +473,11 @@ func saveArchiveData(data io.Reader, key, ext, source string, storage storage.St
 	return db.Model(item).Updates(updates).Error
 }
 
-func writeArchiveData(data io.Reader, key string, storage storage.Storage) (int64, error) {
+// writeArchiveData streams data to key and returns the stored size and the hex
+// SHA-256 of the bytes written, which the fixity audit later re-reads against.
+func writeArchiveData(data io.Reader, key string, storage storage.Storage) (int64, string, error) {
 	if data == nil {
-		return 0, fmt.Errorf("archive data is nil")
+		return 0, "", fmt.Errorf("archive data is nil")
 	}
 	// Archivers hand back readers backed by a live process or a goroutine
 	// writing into an io.Pipe, and closing is what releases them. Every return
@@ -414,10 +499,11 @@ func writeArchiveData(data io.Reader, key string, storage storage.Storage) (int6
 
 	w, err := storage.Writer(key)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get storage writer: %w", err)
+		return 0, "", fmt.Errorf("failed to get storage writer: %w", err)
 	}
 
-	_, copyErr := io.Copy(w, data)
+	hash := sha256.New()
+	_, copyErr := io.Copy(io.MultiWriter(w, hash), data)
 
 	// For archivers that return a process (like yt-dlp), we must close the reader to wait for the process to exit.
 	if closeErr := closeData(); closeErr != nil && copyErr == nil {
@@ -429,7 +515,7 @@ func writeArchiveData(data io.Reader, key string, storage storage.Storage) (int6
 	}
 
 	if copyErr != nil {
-		return 0, fmt.Errorf("failed during data copy/close: %w", copyErr)
+		return 0, "", fmt.Errorf("failed during data copy/close: %w", copyErr)
 	}
 
 	fileSize, err := storage.Size(key)
@@ -437,5 +523,5 @@ func writeArchiveData(data io.Reader, key string, storage storage.Storage) (int6
 		log.Printf("Warning: Could not get file size for %s: %v", key, err)
 		fileSize = 0
 	}
-	return fileSize, nil
+	return fileSize, hex.EncodeToString(hash.Sum(nil)), nil
 }
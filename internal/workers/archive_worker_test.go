@@ -3,6 +3,8 @@ package workers
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"io"
@@ -123,6 +125,10 @@ func TestSaveArchiveDataMarksCompleted(t *testing.T) {
 	if got.Status != "completed" || got.StorageKey != key || got.Extension != ".mhtml" || got.FileSize != int64(len(payload)) {
 		t.Fatalf("item not finalized correctly: %+v", got)
 	}
+	// The checksum is of the bytes written, for the fixity audit to hold them to.
+	if sum := sha256.Sum256(payload); got.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("Checksum = %q", got.Checksum)
+	}
 }
 
 func TestProcessArchiveJobSuccessCompletes(t *testing.T) {
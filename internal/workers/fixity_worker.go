@@ -0,0 +1,415 @@
+package workers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"arker/internal/manifest"
+	"arker/internal/models"
+	"arker/internal/storage"
+)
+
+// FixityQueue is the queue audits run on. It is given one worker, so only one
+// audit is ever reading from storage.
+const FixityQueue = "fixity"
+
+// FixityAuditJobArgs is the payload for one pass of the fixity audit.
+type FixityAuditJobArgs struct{}
+
+// Kind returns the job kind for River.
+func (FixityAuditJobArgs) Kind() string { return "fixity_audit" }
+
+// ErrNotRecoverable refuses a recapture of an item whose latest audit did not
+// find its stored artifact damaged, or whose artifact has already been
+// replaced since.
+var ErrNotRecoverable = errors.New("item has no unrepaired fixity failure")
+
+// fixityFailureStatuses are the audit outcomes that mean the stored object is
+// gone or is not what was written. An error status is not one: it says
+// nothing about the object.
+var fixityFailureStatuses = []string{
+	models.FixityStatusMissing,
+	models.FixityStatusSizeMismatch,
+	models.FixityStatusChecksumMismatch,
+}
+
+// FixityWorker re-reads stored archive artifacts, and the files a manifest
+// lists beside them, and checks them against the size and checksum recorded
+// when they were written or first audited. Each pass audits the
+// items audited longest ago (never-audited first), so repeated passes cycle
+// through the whole archive.
+type FixityWorker struct {
+	river.WorkerDefaults[FixityAuditJobArgs]
+	storage storage.Storage
+	db      *gorm.DB
+	// bytesPerSecond caps how fast objects are read; 0 reads unthrottled.
+	bytesPerSecond int64
+	// batch is how many items one pass audits.
+	batch int
+}
+
+// NewFixityWorker creates a new fixity audit worker.
+func NewFixityWorker(store storage.Storage, db *gorm.DB, bytesPerSecond int64, batch int) *FixityWorker {
+	if batch <= 0 {
+		batch = 100
+	}
+	return &FixityWorker{storage: store, db: db, bytesPerSecond: bytesPerSecond, batch: batch}
+}
+
+// Work runs one audit pass.
+func (w *FixityWorker) Work(ctx context.Context, job *river.Job[FixityAuditJobArgs]) error {
+	return w.audit(ctx)
+}
+
+// audit is Work without the River envelope, so it can be exercised directly.
+func (w *FixityWorker) audit(ctx context.Context) error {
+	var items []models.ArchiveItem
+	err := w.db.
+		Joins("LEFT JOIN (SELECT archive_item_id, MAX(id) AS last_audit_id FROM fixity_audits GROUP BY archive_item_id) last_audits ON last_audits.archive_item_id = archive_items.id").
+		Where("archive_items.status = ? AND archive_items.storage_key <> ''", "completed").
+		Order("last_audits.last_audit_id IS NOT NULL, last_audits.last_audit_id, archive_items.id").
+		Limit(w.batch).
+		Find(&items).Error
+	if err != nil {
+		return fmt.Errorf("fixity: selecting items: %w", err)
+	}
+
+	counts := map[string]int{}
+	for i := range items {
+		audit, err := w.auditItem(ctx, &items[i])
+		if err != nil {
+			// Cancelled mid-read: nothing was learned about this object, and
+			// the next pass starts with it.
+			slog.Info("Fixity audit interrupted", "audited", i, "error", err)
+			return err
+		}
+		if err := w.record(&audit); err != nil {
+			return fmt.Errorf("fixity: recording audit of item %d: %w", audit.ArchiveItemID, err)
+		}
+		counts[audit.Status]++
+		if !fixityPassed(audit.Status) {
+			slog.Warn("Fixity audit failed",
+				"item_id", audit.ArchiveItemID,
+				"key", audit.StorageKey,
+				"role", audit.Role,
+				"status", audit.Status,
+				"expected_size", audit.ExpectedSize,
+				"actual_size", audit.ActualSize,
+				"error", audit.Error)
+		}
+	}
+	slog.Info("Fixity audit pass finished", "audited", len(items), "results", counts)
+	return nil
+}
+
+// record stores audit and drops the item's earlier audits. Only the latest
+// result is ever read, and keeping every pass would grow the table by the
+// whole collection each cycle.
+func (w *FixityWorker) record(audit *models.FixityAudit) error {
+	return w.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(audit).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().
+			Where("archive_item_id = ? AND id < ?", audit.ArchiveItemID, audit.ID).
+			Delete(&models.FixityAudit{}).Error
+	})
+}
+
+// auditItem reads item's stored objects and returns the audit record: the
+// artifact first, then each file manifestFiles lists beside it, stopping at
+// the first that fails. The rebuilt repository of a git delta is not read
+// again; its layers are. The only error it returns is ctx's; storage failures
+// are recorded in the audit.
+func (w *FixityWorker) auditItem(ctx context.Context, item *models.ArchiveItem) (audit models.FixityAudit, err error) {
+	started := time.Now()
+	audit = models.FixityAudit{
+		ArchiveItemID:    item.ID,
+		StorageKey:       item.StorageKey,
+		Role:             manifest.RoleArtifact,
+		ItemKey:          item.StorageKey,
+		ExpectedSize:     item.FileSize,
+		ExpectedChecksum: item.Checksum,
+	}
+	defer func() { audit.DurationMs = time.Since(started).Milliseconds() }()
+
+	if err = w.readObject(ctx, &audit); err != nil {
+		return audit, err
+	}
+	if audit.Status == "" {
+		classifyAudit(&audit)
+	}
+	if audit.Status == models.FixityStatusBaselined {
+		// Stored before checksums were kept: what is there now becomes the
+		// baseline later passes hold it to. UpdateColumns leaves updated_at
+		// alone; the cleanup worker orders by it.
+		baseline := map[string]interface{}{"checksum": audit.ActualChecksum}
+		if item.FileSize == 0 {
+			baseline["file_size"] = audit.ActualSize
+		}
+		if err := w.db.Model(item).UpdateColumns(baseline).Error; err != nil {
+			audit.Status = models.FixityStatusError
+			audit.Error = fmt.Sprintf("recording baseline checksum: %v", err)
+		}
+	}
+	if !fixityPassed(audit.Status) {
+		return audit, nil
+	}
+
+	listed, err := manifestFiles(w.storage, []models.ArchiveItem{*item})
+	if err != nil {
+		audit.Status = models.FixityStatusError
+		audit.Error = err.Error()
+		return audit, nil
+	}
+	for _, f := range listed[item.ID] {
+		if f.Role == manifest.RoleArtifact || f.Role == manifest.RoleRepository {
+			continue
+		}
+		file, err := w.auditFile(ctx, item, f)
+		if err != nil {
+			return audit, err
+		}
+		if !fixityPassed(file.Status) {
+			audit = file
+			return audit, nil
+		}
+	}
+	return audit, nil
+}
+
+// auditFile reads one of the files beside item's artifact and holds it to
+// its FixityBaseline, recording one if it has none yet.
+func (w *FixityWorker) auditFile(ctx context.Context, item *models.ArchiveItem, f manifest.File) (models.FixityAudit, error) {
+	audit := models.FixityAudit{
+		ArchiveItemID: item.ID,
+		StorageKey:    f.Key,
+		Role:          f.Role,
+		ItemKey:       item.StorageKey,
+	}
+	var baseline models.FixityBaseline
+	err := w.db.Where("storage_key = ?", f.Key).Limit(1).Find(&baseline).Error
+	if err != nil {
+		audit.Status = models.FixityStatusError
+		audit.Error = fmt.Sprintf("loading baseline: %v", err)
+		return audit, nil
+	}
+	audit.ExpectedSize = baseline.Size
+	audit.ExpectedChecksum = baseline.Checksum
+
+	if err := w.readObject(ctx, &audit); err != nil || audit.Status != "" {
+		return audit, err
+	}
+	classifyAudit(&audit)
+	if audit.Status == models.FixityStatusBaselined {
+		baseline = models.FixityBaseline{StorageKey: f.Key, Size: audit.ActualSize, Checksum: audit.ActualChecksum}
+		// A parent layer shared by two items may be baselined by either.
+		if err := w.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&baseline).Error; err != nil {
+			audit.Status = models.FixityStatusError
+			audit.Error = fmt.Sprintf("recording baseline checksum: %v", err)
+		}
+	}
+	return audit, nil
+}
+
+// readObject re-reads audit's StorageKey and fills in its actual size and
+// checksum. A read that fails sets the audit's status; the only error it
+// returns is ctx's.
+func (w *FixityWorker) readObject(ctx context.Context, audit *models.FixityAudit) error {
+	r, err := w.storage.Reader(audit.StorageKey)
+	if err != nil {
+		// Backends word "no such object" differently; ask plainly before
+		// calling the object gone.
+		if exists, existsErr := w.storage.Exists(audit.StorageKey); existsErr == nil && !exists {
+			audit.Status = models.FixityStatusMissing
+		} else {
+			audit.Status = models.FixityStatusError
+		}
+		audit.Error = err.Error()
+		return nil
+	}
+	hash := sha256.New()
+	size, err := io.Copy(hash, newThrottledReader(ctx, r, w.bytesPerSecond))
+	r.Close()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if err != nil {
+		audit.Status = models.FixityStatusError
+		audit.Error = err.Error()
+		return nil
+	}
+	audit.ActualSize = size
+	audit.ActualChecksum = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
+
+// classifyAudit sets the status of an audit whose object was read. With no
+// expected checksum the read is the baseline, which the caller records.
+func classifyAudit(audit *models.FixityAudit) {
+	switch {
+	case audit.ExpectedSize > 0 && audit.ActualSize != audit.ExpectedSize:
+		audit.Status = models.FixityStatusSizeMismatch
+	case audit.ExpectedChecksum == "":
+		audit.Status = models.FixityStatusBaselined
+	case audit.ActualChecksum != audit.ExpectedChecksum:
+		audit.Status = models.FixityStatusChecksumMismatch
+	default:
+		audit.Status = models.FixityStatusOK
+	}
+}
+
+func fixityPassed(status string) bool {
+	return status == models.FixityStatusOK || status == models.FixityStatusBaselined
+}
+
+// AuditedItemKey returns the item StorageKey an audit was taken under.
+func AuditedItemKey(audit models.FixityAudit) string {
+	if audit.ItemKey != "" {
+		return audit.ItemKey
+	}
+	return audit.StorageKey
+}
+
+// FixityFailures returns the latest audit of every item whose latest audit
+// found its stored object missing or altered, newest first.
+func FixityFailures(db *gorm.DB) ([]models.FixityAudit, error) {
+	var audits []models.FixityAudit
+	err := db.
+		Joins("JOIN (SELECT archive_item_id AS latest_item_id, MAX(id) AS latest_id FROM fixity_audits GROUP BY archive_item_id) latest ON latest.latest_id = fixity_audits.id").
+		Where("fixity_audits.status IN ?", fixityFailureStatuses).
+		Order("fixity_audits.id DESC").
+		Find(&audits).Error
+	return audits, err
+}
+
+// RecaptureFixityFailure queues a fresh capture of an item whose stored
+// artifact failed its latest audit. The damaged object is left where it is
+// (storage is append-only); the recapture stores a new one and points the
+// item at it, and the next audit of the item checks that.
+//
+// It returns ErrNotRecoverable when the item's latest audit passed, when the
+// item is not completed (a recapture is already under way), or when it no
+// longer points at the object that failed (a recapture already replaced it).
+func RecaptureFixityFailure(ctx context.Context, db *gorm.DB, riverClient *river.Client[pgx.Tx], itemID uint) error {
+	var item models.ArchiveItem
+	if err := db.First(&item, itemID).Error; err != nil {
+		return err
+	}
+	var latest models.FixityAudit
+	if err := db.Where("archive_item_id = ?", item.ID).Order("id DESC").First(&latest).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotRecoverable
+		}
+		return err
+	}
+	if !isFixityFailure(latest.Status) || item.Status != "completed" || item.StorageKey != AuditedItemKey(latest) {
+		return ErrNotRecoverable
+	}
+	return RequeueArchiveItem(ctx, db, riverClient, &item, "recapture")
+}
+
+func isFixityFailure(status string) bool {
+	for _, s := range fixityFailureStatuses {
+		if status == s {
+			return true
+		}
+	}
+	return false
+}
+
+// NewFixityAuditPeriodicJob schedules an audit pass every interval, and one at
+// startup.
+func NewFixityAuditPeriodicJob(interval time.Duration) *river.PeriodicJob {
+	return river.NewPeriodicJob(
+		river.PeriodicInterval(interval),
+		func() (river.JobArgs, *river.InsertOpts) {
+			return FixityAuditJobArgs{}, fixityAuditInsertOpts()
+		},
+		&river.PeriodicJobOpts{RunOnStart: true},
+	)
+}
+
+// EnqueueFixityAudit requests an audit pass now. It is a no-op while one is
+// already queued or running.
+func EnqueueFixityAudit(ctx context.Context, riverClient *river.Client[pgx.Tx]) error {
+	if riverClient == nil {
+		return nil
+	}
+	_, err := riverClient.Insert(ctx, FixityAuditJobArgs{}, fixityAuditInsertOpts())
+	return err
+}
+
+func fixityAuditInsertOpts() *river.InsertOpts {
+	return &river.InsertOpts{
+		Queue: FixityQueue,
+		// A failed pass is not retried; the next one picks up where it left
+		// off, since it starts from the items audited longest ago.
+		MaxAttempts: 1,
+		Tags:        []string{"fixity"},
+		// A slow pass must not have the next ones pile up behind it.
+		UniqueOpts: river.UniqueOpts{
+			ByArgs: true,
+			ByState: []rivertype.JobState{
+				rivertype.JobStateAvailable,
+				rivertype.JobStatePending,
+				rivertype.JobStateRunning,
+				rivertype.JobStateScheduled,
+				rivertype.JobStateRetryable,
+			},
+		},
+	}
+}
+
+// throttledReader paces reads to an average of rate bytes per second, so an
+// audit pass does not compete with captures and visitors for storage
+// bandwidth. A zero rate does not throttle.
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	rate    int64
+	started time.Time
+	read    int64
+}
+
+func newThrottledReader(ctx context.Context, r io.Reader, rate int64) io.Reader {
+	return &throttledReader{ctx: ctx, r: r, rate: rate, started: time.Now()}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if err := t.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if t.rate <= 0 {
+		return t.r.Read(p)
+	}
+	// At most a second's worth at a time, so the pacing stays smooth.
+	if int64(len(p)) > t.rate {
+		p = p[:t.rate]
+	}
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+	due := t.started.Add(time.Duration(float64(t.read) / float64(t.rate) * float64(time.Second)))
+	if wait := time.Until(due); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-t.ctx.Done():
+			return n, t.ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,246 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"arker/internal/models"
+	"arker/internal/storage"
+)
+
+func newFixityTestWorker(t *testing.T, batch int) (*FixityWorker, *gorm.DB, *storage.MemoryStorage) {
+	t.Helper()
+	db := newWorkerTestDB(t)
+	if err := db.AutoMigrate(&models.FixityAudit{}, &models.FixityBaseline{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	store := storage.NewMemoryStorage()
+	return NewFixityWorker(store, db, 0, batch), db, store
+}
+
+// storeItem saves data the way an archive job does, so the item carries the
+// size and checksum of what was written.
+func storeItem(t *testing.T, db *gorm.DB, store storage.Storage, shortID string, data []byte) models.ArchiveItem {
+	t.Helper()
+	key := shortID + "/mhtml-aa.mhtml"
+	item := seedItem(t, db, shortID, "mhtml", "processing", "")
+	if err := saveArchiveData(bytes.NewReader(data), key, ".mhtml", "", store, db, &item); err != nil {
+		t.Fatalf("saveArchiveData: %v", err)
+	}
+	return reload(t, db, item.ID)
+}
+
+func latestAudit(t *testing.T, db *gorm.DB, itemID uint) models.FixityAudit {
+	t.Helper()
+	var audit models.FixityAudit
+	if err := db.Where("archive_item_id = ?", itemID).Order("id DESC").First(&audit).Error; err != nil {
+		t.Fatalf("no audit of item %d: %v", itemID, err)
+	}
+	return audit
+}
+
+func TestFixityAuditClassifiesStoredObjects(t *testing.T) {
+	w, db, store := newFixityTestWorker(t, 0)
+	intact := storeItem(t, db, store, "ok001", []byte("intact bytes"))
+	missing := storeItem(t, db, store, "gone1", []byte("deleted bytes"))
+	store.Delete(missing.StorageKey)
+	flipped := storeItem(t, db, store, "flip1", []byte("original"))
+	putObject(t, store, flipped.StorageKey, []byte("0riginal"))
+	truncated := storeItem(t, db, store, "trnc1", []byte("a longer object"))
+	putObject(t, store, truncated.StorageKey, []byte("a longer"))
+	// Stored before checksums were kept.
+	putObject(t, store, "old01/mhtml-aa.mhtml", []byte("legacy"))
+	legacy := seedItem(t, db, "old01", "mhtml", "completed", "old01/mhtml-aa.mhtml")
+	db.Model(&legacy).UpdateColumn("file_size", 6)
+	// Never finished: nothing to audit.
+	seedItem(t, db, "pend1", "mhtml", "pending", "")
+
+	if err := w.audit(context.Background()); err != nil {
+		t.Fatalf("audit: %v", err)
+	}
+	var count int64
+	db.Model(&models.FixityAudit{}).Count(&count)
+	if count != 5 {
+		t.Fatalf("%d audits recorded, want 5", count)
+	}
+	for _, tc := range []struct {
+		item models.ArchiveItem
+		want string
+	}{
+		{intact, models.FixityStatusOK},
+		{missing, models.FixityStatusMissing},
+		{flipped, models.FixityStatusChecksumMismatch},
+		{truncated, models.FixityStatusSizeMismatch},
+		{legacy, models.FixityStatusBaselined},
+	} {
+		if got := latestAudit(t, db, tc.item.ID); got.Status != tc.want {
+			t.Errorf("item %s: status %q, want %q (%+v)", tc.item.StorageKey, got.Status, tc.want, got)
+		}
+	}
+	if got := latestAudit(t, db, truncated.ID); got.ExpectedSize != 15 || got.ActualSize != 8 {
+		t.Errorf("truncated sizes = %d/%d", got.ExpectedSize, got.ActualSize)
+	}
+	if got := latestAudit(t, db, missing.ID); got.Error == "" {
+		t.Error("missing object recorded no error")
+	}
+
+	// The legacy item's checksum is adopted, so the next pass holds it to it.
+	adopted := reload(t, db, legacy.ID)
+	if adopted.Checksum != latestAudit(t, db, legacy.ID).ActualChecksum || adopted.Checksum == "" {
+		t.Errorf("legacy checksum = %q", adopted.Checksum)
+	}
+	if !adopted.UpdatedAt.Equal(legacy.UpdatedAt) {
+		t.Error("adopting a checksum touched updated_at")
+	}
+	putObject(t, store, legacy.StorageKey, []byte("LEGACY"))
+	if err := w.audit(context.Background()); err != nil {
+		t.Fatalf("second audit: %v", err)
+	}
+	if got := latestAudit(t, db, legacy.ID); got.Status != models.FixityStatusChecksumMismatch {
+		t.Errorf("altered legacy item: status %q", got.Status)
+	}
+}
+
+func TestFixityAuditReadsTheFilesBesideTheArtifact(t *testing.T) {
+	w, db, store := newFixityTestWorker(t, 0)
+	item := storeItem(t, db, store, "side1", []byte("page"))
+	putObject(t, store, "side1/metadata.json", []byte(`{"title":"page"}`))
+	putObject(t, store, "side1/thumb.webp", []byte("thumbnail"))
+	db.Model(&item).UpdateColumns(map[string]interface{}{
+		"metadata_key":     "side1/metadata.json",
+		"thumbnail_key":    "side1/thumb.webp",
+		"thumbnail_status": models.ThumbnailStatusReady,
+	})
+
+	// The first pass records what the sidecars hold.
+	if err := w.audit(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := latestAudit(t, db, item.ID); got.Status != models.FixityStatusOK || got.Role != "artifact" {
+		t.Fatalf("first audit = %+v", got)
+	}
+	var baselines int64
+	db.Model(&models.FixityBaseline{}).Count(&baselines)
+	if baselines != 2 {
+		t.Fatalf("%d baselines recorded, want 2", baselines)
+	}
+
+	// A damaged sidecar fails the item.
+	putObject(t, store, "side1/metadata.json", []byte(`{"title":"PAGE"}`))
+	if err := w.audit(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := latestAudit(t, db, item.ID)
+	if got.Status != models.FixityStatusChecksumMismatch || got.StorageKey != "side1/metadata.json" || got.Role != "metadata" || got.ItemKey != item.StorageKey {
+		t.Fatalf("audit after damage = %+v", got)
+	}
+	if failures, err := FixityFailures(db); err != nil || len(failures) != 1 || AuditedItemKey(failures[0]) != item.StorageKey {
+		t.Errorf("failures = %+v, %v", failures, err)
+	}
+
+	store.Delete("side1/thumb.webp")
+	putObject(t, store, "side1/metadata.json", []byte(`{"title":"page"}`))
+	if err := w.audit(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := latestAudit(t, db, item.ID); got.Status != models.FixityStatusMissing || got.Role != "thumbnail" {
+		t.Errorf("audit after a lost thumbnail = %+v", got)
+	}
+}
+
+func TestFixityAuditCyclesThroughItems(t *testing.T) {
+	w, db, store := newFixityTestWorker(t, 2)
+	var items []models.ArchiveItem
+	for _, id := range []string{"cyc01", "cyc02", "cyc03"} {
+		items = append(items, storeItem(t, db, store, id, []byte(id)))
+	}
+
+	audited := func() []uint {
+		var audits []models.FixityAudit
+		db.Order("id DESC").Limit(2).Find(&audits)
+		return []uint{audits[1].ArchiveItemID, audits[0].ArchiveItemID}
+	}
+	if err := w.audit(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := audited(); got[0] != items[0].ID || got[1] != items[1].ID {
+		t.Fatalf("first pass audited %v", got)
+	}
+	// Never audited first, then the one audited longest ago.
+	if err := w.audit(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := audited(); got[0] != items[2].ID || got[1] != items[0].ID {
+		t.Fatalf("second pass audited %v", got)
+	}
+
+	// Only each item's latest result is kept.
+	var count int64
+	db.Model(&models.FixityAudit{}).Count(&count)
+	if count != int64(len(items)) {
+		t.Errorf("%d audit rows after two passes, want one per item", count)
+	}
+}
+
+func TestFixityAuditStopsWhenCancelled(t *testing.T) {
+	w, db, store := newFixityTestWorker(t, 0)
+	storeItem(t, db, store, "can01", []byte("bytes"))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := w.audit(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("audit = %v, want context.Canceled", err)
+	}
+	var count int64
+	db.Model(&models.FixityAudit{}).Count(&count)
+	if count != 0 {
+		t.Errorf("an interrupted read was recorded")
+	}
+}
+
+func TestRecaptureFixityFailureRefusesHealthyItems(t *testing.T) {
+	_, db, store := newFixityTestWorker(t, 0)
+	never := storeItem(t, db, store, "rec01", []byte("bytes"))
+	healthy := storeItem(t, db, store, "rec02", []byte("bytes"))
+	db.Create(&models.FixityAudit{ArchiveItemID: healthy.ID, StorageKey: healthy.StorageKey, Status: models.FixityStatusOK})
+	// Recaptured since it failed: the item points at a new object.
+	replaced := storeItem(t, db, store, "rec03", []byte("bytes"))
+	db.Create(&models.FixityAudit{ArchiveItemID: replaced.ID, StorageKey: "rec03/mhtml-old.mhtml", Status: models.FixityStatusMissing})
+	// A recapture is under way.
+	inFlight := storeItem(t, db, store, "rec04", []byte("bytes"))
+	db.Create(&models.FixityAudit{ArchiveItemID: inFlight.ID, StorageKey: inFlight.StorageKey, Status: models.FixityStatusChecksumMismatch})
+	db.Model(&inFlight).Update("status", "pending")
+
+	for _, item := range []models.ArchiveItem{never, healthy, replaced, inFlight} {
+		if err := RecaptureFixityFailure(context.Background(), db, nil, item.ID); !errors.Is(err, ErrNotRecoverable) {
+			t.Errorf("item %d: err = %v, want ErrNotRecoverable", item.ID, err)
+		}
+	}
+
+	failures, err := FixityFailures(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 2 || failures[0].ArchiveItemID != inFlight.ID || failures[1].ArchiveItemID != replaced.ID {
+		t.Errorf("failures = %+v", failures)
+	}
+}
+
+func TestThrottledReaderPacesReads(t *testing.T) {
+	data := strings.Repeat("x", 3000)
+	started := time.Now()
+	n, err := io.Copy(io.Discard, newThrottledReader(context.Background(), strings.NewReader(data), 10000))
+	if err != nil || n != 3000 {
+		t.Fatalf("copied %d, %v", n, err)
+	}
+	if elapsed := time.Since(started); elapsed < 250*time.Millisecond {
+		t.Errorf("3000 bytes at 10000 B/s took %v", elapsed)
+	}
+}
@@ -0,0 +1,280 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+
+	"arker/internal/archivers"
+	"arker/internal/models"
+	"arker/internal/storage"
+	"arker/internal/utils"
+)
+
+// HLSJobArgs is the payload for packaging one archived video as HLS.
+// Addressed by (short_id, type) like ArchiveJobArgs and ThumbnailJobArgs.
+type HLSJobArgs struct {
+	ShortID string `json:"short_id"`
+	Type    string `json:"type"`
+}
+
+// Kind returns the job kind for River.
+func (HLSJobArgs) Kind() string { return "hls" }
+
+// HLSWorker segments a completed video into HLS for seeking in long videos.
+//
+// It runs after the video is already archived and never touches the archive
+// item's status: a video whose packaging fails is exactly as archived as one
+// that was never packaged, and the viewer falls back to the MP4.
+type HLSWorker struct {
+	river.WorkerDefaults[HLSJobArgs]
+	storage storage.Storage
+	db      *gorm.DB
+}
+
+// NewHLSWorker creates a new HLS packaging worker.
+func NewHLSWorker(store storage.Storage, db *gorm.DB) *HLSWorker {
+	return &HLSWorker{storage: store, db: db}
+}
+
+// Timeout overrides the client-wide job timeout, which is sized for
+// downloads rather than transcodes.
+func (w *HLSWorker) Timeout(*river.Job[HLSJobArgs]) time.Duration {
+	return utils.HLSSettings().Timeout
+}
+
+// Work packages one video.
+func (w *HLSWorker) Work(ctx context.Context, job *river.Job[HLSJobArgs]) error {
+	return w.packageVideo(ctx, job.Args)
+}
+
+// packageVideo is Work without the River envelope, so it can be exercised
+// directly.
+func (w *HLSWorker) packageVideo(ctx context.Context, args HLSJobArgs) error {
+	args.Type = utils.NormalizeArchiveType(args.Type)
+	logger := slog.With("worker", "hls", "short_id", args.ShortID, "type", args.Type)
+
+	cfg := utils.HLSSettings()
+	if !cfg.Enabled {
+		logger.Debug("HLS packaging is disabled; dropping job")
+		return nil
+	}
+
+	var item models.ArchiveItem
+	if err := w.db.Joins("JOIN captures ON archive_items.capture_id = captures.id").
+		Where("captures.short_id = ? AND archive_items.type IN ?", args.ShortID, utils.ArchiveTypeMatchValues(args.Type)).
+		First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.Warn("Archive item no longer exists; dropping HLS job")
+			return nil
+		}
+		return fmt.Errorf("hls: finding archive item for %s/%s: %w", args.ShortID, args.Type, err)
+	}
+	if item.Status != "completed" || item.StorageKey == "" {
+		logger.Debug("Archive item not completed; skipping HLS")
+		return nil
+	}
+
+	var existing models.HLSPackage
+	err := w.db.Where("archive_item_id = ?", item.ID).First(&existing).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+	case err != nil:
+		return fmt.Errorf("hls: checking for an existing package: %w", err)
+	case HLSSkipLifted(&existing):
+		// Skipped under a higher minimum than today's.
+		if err := w.db.Unscoped().Delete(&existing).Error; err != nil {
+			return fmt.Errorf("hls: clearing a lifted skip: %w", err)
+		}
+	default:
+		logger.Debug("HLS package already recorded; nothing to do")
+		return nil
+	}
+
+	// The normalized metadata usually knows the duration already, which
+	// spares a download of every short video just to learn it is short.
+	if duration, ok := storedVideoDuration(w.storage, item); ok && duration < cfg.MinDuration {
+		return w.markSkipped(&item, logger, duration)
+	}
+
+	workDir, err := os.MkdirTemp("", "arker-hls-*")
+	if err != nil {
+		return fmt.Errorf("hls: temp dir: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	inputPath := filepath.Join(workDir, "input"+item.Extension)
+	if err := copyStoredObject(w.storage, item.StorageKey, inputPath); err != nil {
+		// Transient (network/S3) as far as we can tell from here; let River retry.
+		return fmt.Errorf("hls: downloading %s: %w", item.StorageKey, err)
+	}
+
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("hls: %w", err)
+	}
+	probe, err := archivers.ProbeVideo(ctx, input)
+	input.Close()
+	if err != nil {
+		return w.markUnavailable(&item, logger, fmt.Sprintf("probe failed: %v", err))
+	}
+	if probe.DurationSeconds != nil {
+		if duration := time.Duration(*probe.DurationSeconds * float64(time.Second)); duration < cfg.MinDuration {
+			return w.markSkipped(&item, logger, duration)
+		}
+	}
+
+	var packagingLog strings.Builder
+	output, err := archivers.PackageHLS(ctx, inputPath, filepath.Join(workDir, "hls"), probe, cfg, &packagingLog)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("hls: %w", ctx.Err())
+		}
+		// ffmpeg failing on bytes that ffprobe accepted is a property of the
+		// file (an unsupported codec for fMP4, a broken stream) and will not
+		// change on retry.
+		return w.markUnavailable(&item, logger, err.Error())
+	}
+
+	pkg, err := storeHLSOutput(w.storage, item, output)
+	if err != nil {
+		return fmt.Errorf("hls: storing package: %w", err)
+	}
+	if err := w.db.Create(pkg).Error; err != nil {
+		return fmt.Errorf("hls: recording package: %w", err)
+	}
+	logger.Info("HLS package stored",
+		"key_prefix", pkg.KeyPrefix,
+		"renditions", pkg.Renditions,
+		"segments", pkg.SegmentCount,
+		"bytes", pkg.TotalBytes)
+	return nil
+}
+
+// storeHLSOutput uploads every file of a package under a fresh prefix beside
+// the item's own objects, the way Result.Extras are stored, and returns the
+// row describing it. The bucket is append-only, so a retried job writes a new
+// prefix rather than reusing a partly written one.
+func storeHLSOutput(store storage.Storage, item models.ArchiveItem, output *archivers.HLSOutput) (*models.HLSPackage, error) {
+	keyBase := strings.TrimSuffix(item.StorageKey, item.Extension)
+	prefix := fmt.Sprintf("%s.hls-%s/", keyBase, uploadNonce())
+
+	pkg := &models.HLSPackage{ArchiveItemID: item.ID, Status: models.HLSStatusReady, KeyPrefix: prefix}
+	// One file in memory at a time: a segment is a few megabytes, the whole
+	// package of a multi-hour stream is gigabytes.
+	for _, name := range output.Files {
+		data, err := os.ReadFile(filepath.Join(output.Dir, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, err
+		}
+		if err := writeExtraArtifact(store, prefix+name, data); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		pkg.TotalBytes += int64(len(data))
+	}
+
+	names := make([]string, 0, len(output.Renditions))
+	for _, rendition := range output.Renditions {
+		names = append(names, rendition.Name)
+		pkg.SegmentCount += rendition.Segments
+	}
+	pkg.Renditions = strings.Join(names, ",")
+	return pkg, nil
+}
+
+// markUnavailable records that this video will never have an HLS package, so
+// neither a retry nor a later page view queues it again.
+func (w *HLSWorker) markUnavailable(item *models.ArchiveItem, logger *slog.Logger, reason string) error {
+	logger.Info("Marking HLS unavailable", "reason", reason)
+	pkg := models.HLSPackage{ArchiveItemID: item.ID, Status: models.HLSStatusUnavailable, Detail: utils.TruncateForLog(reason, 1000)}
+	if err := w.db.Create(&pkg).Error; err != nil {
+		return fmt.Errorf("hls: marking unavailable: %w", err)
+	}
+	return nil
+}
+
+// markSkipped records that this video is too short to package, so a page
+// view does not queue it again only to learn the same, which without a
+// duration in the metadata costs a copy of the whole video.
+func (w *HLSWorker) markSkipped(item *models.ArchiveItem, logger *slog.Logger, duration time.Duration) error {
+	logger.Debug("Video is shorter than the HLS minimum; skipping", "duration", duration)
+	pkg := models.HLSPackage{ArchiveItemID: item.ID, Status: models.HLSStatusSkipped,
+		Detail: "shorter than the minimum duration", DurationSeconds: duration.Seconds()}
+	if err := w.db.Create(&pkg).Error; err != nil {
+		return fmt.Errorf("hls: marking skipped: %w", err)
+	}
+	return nil
+}
+
+// HLSSkipLifted reports whether a video skipped as too short would qualify
+// under the current minimum, because HLS_MIN_DURATION has been lowered since.
+func HLSSkipLifted(pkg *models.HLSPackage) bool {
+	return pkg.Status == models.HLSStatusSkipped &&
+		time.Duration(pkg.DurationSeconds*float64(time.Second)) >= utils.HLSSettings().MinDuration
+}
+
+// storedVideoDuration reads the duration recorded in an item's normalized
+// metadata. ok is false when there is no metadata or it has no duration.
+func storedVideoDuration(store storage.Storage, item models.ArchiveItem) (time.Duration, bool) {
+	if item.MetadataKey == "" {
+		return 0, false
+	}
+	reader, err := store.Reader(item.MetadataKey)
+	if err != nil {
+		return 0, false
+	}
+	defer reader.Close()
+	var meta archivers.VideoMetadata
+	if err := json.NewDecoder(io.LimitReader(reader, 32<<20)).Decode(&meta); err != nil || meta.DurationSeconds == nil {
+		return 0, false
+	}
+	return time.Duration(*meta.DurationSeconds * float64(time.Second)), true
+}
+
+func copyStoredObject(store storage.Storage, key, dest string) error {
+	reader, err := store.Reader(key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	_, copyErr := io.Copy(f, reader)
+	if closeErr := f.Close(); closeErr != nil && copyErr == nil {
+		copyErr = closeErr
+	}
+	return copyErr
+}
+
+// EnqueueHLS requests an HLS package for one archived video. A no-op when
+// packaging is disabled, so callers need not check.
+func EnqueueHLS(ctx context.Context, riverClient *river.Client[pgx.Tx], shortID, archiveType string) error {
+	if riverClient == nil || !utils.HLSSettings().Enabled {
+		return nil
+	}
+	args := HLSJobArgs{ShortID: shortID, Type: utils.NormalizeArchiveType(archiveType)}
+	_, err := riverClient.Insert(ctx, args, &river.InsertOpts{
+		// The default queue, with the downloads: a transcode is as heavy as
+		// one, and high_priority exists for work that is not.
+		MaxAttempts: 2,
+		Tags:        []string{"hls", args.Type},
+		UniqueOpts: river.UniqueOpts{
+			ByArgs:   true,
+			ByPeriod: 30 * time.Minute,
+		},
+	})
+	return err
+}
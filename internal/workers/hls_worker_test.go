@@ -0,0 +1,174 @@
+package workers
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"arker/internal/models"
+	"arker/internal/storage"
+	"arker/internal/testfixtures"
+	"arker/internal/utils"
+)
+
+func enableHLSForTest(t *testing.T, minDuration time.Duration) {
+	t.Helper()
+	utils.InitHLS(utils.HLSConfig{Enabled: true, MinDuration: minDuration, Renditions: []string{utils.HLSSourceRendition}})
+	t.Cleanup(func() { utils.InitHLS(utils.HLSConfig{}) })
+}
+
+func newHLSTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := newWorkerTestDB(t)
+	if err := db.AutoMigrate(&models.HLSPackage{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func TestHLSWorkerStoresPackageBesideTheVideo(t *testing.T) {
+	db := newHLSTestDB(t)
+	store := storage.NewMemoryStorage()
+	enableHLSForTest(t, 20*time.Minute)
+	testfixtures.InstallFakeFFmpegHLS(t, testfixtures.FFmpegHLSFake{})
+
+	item := seedItem(t, db, "long1", utils.ArchiveTypeYtDlp, "completed", "long1/yt-dlp-abc.mp4")
+	db.Model(&item).Update("extension", ".mp4")
+	putObject(t, store, "long1/yt-dlp-abc.mp4", []byte("mp4-bytes"))
+
+	w := NewHLSWorker(store, db)
+	if err := w.packageVideo(context.Background(), HLSJobArgs{ShortID: "long1", Type: utils.ArchiveTypeYtDlp}); err != nil {
+		t.Fatal(err)
+	}
+
+	var pkg models.HLSPackage
+	if err := db.Where("archive_item_id = ?", item.ID).First(&pkg).Error; err != nil {
+		t.Fatalf("no package recorded: %v", err)
+	}
+	if pkg.Status != models.HLSStatusReady || pkg.Renditions != "source" || pkg.SegmentCount != 2 {
+		t.Errorf("package = %+v", pkg)
+	}
+	if !strings.HasPrefix(pkg.KeyPrefix, "long1/yt-dlp-abc.hls-") || !strings.HasSuffix(pkg.KeyPrefix, "/") {
+		t.Errorf("key prefix = %q, want one beside the video's own key", pkg.KeyPrefix)
+	}
+	for _, name := range []string{"master.m3u8", "source/index.m3u8", "source/init.mp4", "source/seg_00000.m4s", "source/seg_00001.m4s"} {
+		r, err := store.Reader(pkg.KeyPrefix + name)
+		if err != nil {
+			t.Errorf("%s was not stored: %v", name, err)
+			continue
+		}
+		r.Close()
+	}
+	r, _ := store.Reader(pkg.KeyPrefix + "master.m3u8")
+	master, _ := io.ReadAll(r)
+	r.Close()
+	if !strings.Contains(string(master), "source/index.m3u8") {
+		t.Errorf("master = %s", master)
+	}
+
+	// A repeat job is a no-op rather than a second package.
+	if err := w.packageVideo(context.Background(), HLSJobArgs{ShortID: "long1", Type: utils.ArchiveTypeYtDlp}); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&models.HLSPackage{}).Count(&count)
+	if count != 1 {
+		t.Errorf("packages = %d after a repeat job, want 1", count)
+	}
+}
+
+func TestHLSWorkerSkipsShortVideos(t *testing.T) {
+	db := newHLSTestDB(t)
+	store := storage.NewMemoryStorage()
+	enableHLSForTest(t, 20*time.Minute)
+	bin := testfixtures.InstallFakeFFmpegHLS(t, testfixtures.FFmpegHLSFake{DurationSeconds: 300})
+
+	// Known short from metadata: never downloaded.
+	short := seedItem(t, db, "short", utils.ArchiveTypeYtDlp, "completed", "short/yt-dlp-a.mp4")
+	db.Model(&short).Updates(map[string]interface{}{"extension": ".mp4", "metadata_key": "short/yt-dlp-a.metadata.json"})
+	putObject(t, store, "short/yt-dlp-a.metadata.json", []byte(`{"schema_version":"1","duration_seconds":95}`))
+	// No metadata: probed, then skipped.
+	legacy := seedItem(t, db, "legcy", utils.ArchiveTypeYtDlp, "completed", "legcy/youtube.mp4")
+	db.Model(&legacy).Update("extension", ".mp4")
+	putObject(t, store, "legcy/youtube.mp4", []byte("mp4-bytes"))
+
+	w := NewHLSWorker(store, db)
+	for _, shortID := range []string{"short", "legcy"} {
+		if err := w.packageVideo(context.Background(), HLSJobArgs{ShortID: shortID, Type: utils.ArchiveTypeYtDlp}); err != nil {
+			t.Fatalf("%s: %v", shortID, err)
+		}
+	}
+	// Recorded, so a page view does not queue them again.
+	var skipped []models.HLSPackage
+	db.Order("archive_item_id").Find(&skipped)
+	if len(skipped) != 2 || skipped[0].Status != models.HLSStatusSkipped || skipped[0].DurationSeconds != 95 ||
+		skipped[1].Status != models.HLSStatusSkipped || skipped[1].DurationSeconds != 300 {
+		t.Fatalf("packages = %+v, want both recorded as skipped with their durations", skipped)
+	}
+	if HLSSkipLifted(&skipped[0]) || HLSSkipLifted(&skipped[1]) {
+		t.Error("a skip is lifted under the minimum it was made under")
+	}
+	if err := w.packageVideo(context.Background(), HLSJobArgs{ShortID: "legcy", Type: utils.ArchiveTypeYtDlp}); err != nil {
+		t.Fatal(err)
+	}
+	if calls, err := os.ReadFile(filepath.Join(bin, "calls.log")); err == nil && len(calls) > 0 {
+		t.Errorf("ffmpeg ran for a short video: %s", calls)
+	}
+
+	// A lower minimum lifts the skip of the longer one only.
+	enableHLSForTest(t, 2*time.Minute)
+	if HLSSkipLifted(&skipped[0]) || !HLSSkipLifted(&skipped[1]) {
+		t.Errorf("lifted = %v, %v; want only the 300s video", HLSSkipLifted(&skipped[0]), HLSSkipLifted(&skipped[1]))
+	}
+	if err := w.packageVideo(context.Background(), HLSJobArgs{ShortID: "legcy", Type: utils.ArchiveTypeYtDlp}); err != nil {
+		t.Fatal(err)
+	}
+	var pkg models.HLSPackage
+	db.Where("archive_item_id = ?", legacy.ID).First(&pkg)
+	if pkg.Status != models.HLSStatusReady {
+		t.Errorf("package after the minimum was lowered = %+v", pkg)
+	}
+}
+
+func TestHLSWorkerMarksUnsegmentableVideosUnavailable(t *testing.T) {
+	db := newHLSTestDB(t)
+	store := storage.NewMemoryStorage()
+	enableHLSForTest(t, time.Minute)
+	testfixtures.InstallFakeFFmpegHLS(t, testfixtures.FFmpegHLSFake{FailSegment: true})
+
+	item := seedItem(t, db, "odd01", utils.ArchiveTypeYtDlp, "completed", "odd01/yt-dlp-a.mp4")
+	db.Model(&item).Update("extension", ".mp4")
+	putObject(t, store, "odd01/yt-dlp-a.mp4", []byte("mp4-bytes"))
+
+	if err := NewHLSWorker(store, db).packageVideo(context.Background(), HLSJobArgs{ShortID: "odd01", Type: utils.ArchiveTypeYtDlp}); err != nil {
+		t.Fatalf("a permanent failure returned %v; River would retry it", err)
+	}
+	var pkg models.HLSPackage
+	if err := db.Where("archive_item_id = ?", item.ID).First(&pkg).Error; err != nil || pkg.Status != models.HLSStatusUnavailable || pkg.Detail == "" {
+		t.Errorf("package = %+v (%v), want unavailable with a reason", pkg, err)
+	}
+	if got := reload(t, db, item.ID); got.Status != "completed" {
+		t.Errorf("item status = %q; packaging must never touch the archive", got.Status)
+	}
+}
+
+func TestHLSWorkerDoesNothingWhenDisabled(t *testing.T) {
+	db := newHLSTestDB(t)
+	store := storage.NewMemoryStorage()
+	seedItem(t, db, "off01", utils.ArchiveTypeYtDlp, "completed", "off01/yt-dlp-a.mp4")
+
+	if err := NewHLSWorker(store, db).packageVideo(context.Background(), HLSJobArgs{ShortID: "off01", Type: utils.ArchiveTypeYtDlp}); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&models.HLSPackage{}).Count(&count)
+	if count != 0 {
+		t.Errorf("packages = %d with HLS disabled", count)
+	}
+}
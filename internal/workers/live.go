@@ -0,0 +1,125 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"gorm.io/gorm"
+
+	"arker/internal/archivers"
+	"arker/internal/models"
+	"arker/internal/storage"
+)
+
+// liveCheckpoints holds the objects of the checkpoint an attempt stored last,
+// so they can be deleted once something newer replaces them. Only this
+// attempt's own checkpoints are tracked: whatever the item pointed at before
+// the attempt may be a published recording.
+type liveCheckpoints struct {
+	store storage.Storage
+	keys  []string
+}
+
+// replace records keys as the current checkpoint and deletes the previous
+// one. Deleting is best effort: a backend that cannot delete, or a bucket
+// lock that refuses it, leaves the object behind and only logs why.
+func (c *liveCheckpoints) replace(keys []string) {
+	old := c.keys
+	c.keys = keys
+	deleteObjects(c.store, old)
+}
+
+// deleteObjects deletes keys from store where the backend supports it.
+func deleteObjects(store storage.Storage, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	deleter, ok := store.(storage.Deleter)
+	if !ok {
+		slog.Warn("Storage cannot delete superseded objects", "keys", keys)
+		return
+	}
+	for _, key := range keys {
+		if err := deleter.Delete(key); err != nil {
+			slog.Warn("Failed to delete superseded object", "key", key, "error", err)
+		}
+	}
+}
+
+// liveCheckpointSaver stores each checkpoint of a live recording as the
+// item's artifact while the job is still running. The item stays processing;
+// it only points at the newest checkpoint, so that a worker lost mid-stream
+// leaves something promoteLiveCheckpoint can publish. Every checkpoint is a
+// fresh object, and the one it supersedes is deleted once the item points at
+// the new one; the last is deleted when the final recording is saved.
+func liveCheckpointSaver(jobArgs ArchiveJobArgs, store storage.Storage, db *gorm.DB, item *models.ArchiveItem, checkpoints *liveCheckpoints) archivers.LiveCheckpointFunc {
+	return func(ctx context.Context, checkpoint archivers.LiveCheckpoint) error {
+		keyBase := fmt.Sprintf("%s/%s-%s", jobArgs.ShortID, jobArgs.Type, uploadNonce())
+		key := keyBase + archivers.LiveCheckpointExtension
+		fileSize, checksum, err := writeArchiveData(checkpoint.Data, key, store)
+		if err != nil {
+			return err
+		}
+		metadataKey := ""
+		if len(checkpoint.Metadata) > 0 {
+			metadataKey = keyBase + ".metadata.json"
+			if err := writeJSONSidecar(store, metadataKey, checkpoint.Metadata); err != nil {
+				return fmt.Errorf("failed to store checkpoint metadata: %w", err)
+			}
+		}
+		rawMetadataKey := ""
+		if len(checkpoint.RawMetadata) > 0 {
+			rawMetadataKey = keyBase + ".raw-metadata.json"
+			if err := writeJSONSidecar(store, rawMetadataKey, checkpoint.RawMetadata); err != nil {
+				return fmt.Errorf("failed to store checkpoint raw metadata: %w", err)
+			}
+		}
+		keys := []string{key}
+		for _, sidecar := range []string{metadataKey, rawMetadataKey} {
+			if sidecar != "" {
+				keys = append(keys, sidecar)
+			}
+		}
+		if err := db.Model(item).Updates(map[string]interface{}{
+			"storage_key":      key,
+			"extension":        archivers.LiveCheckpointExtension,
+			"file_size":        fileSize,
+			"checksum":         checksum,
+			"metadata_key":     metadataKey,
+			"raw_metadata_key": rawMetadataKey,
+			"completeness":     archivers.CompletenessPartial,
+		}).Error; err != nil {
+			// Nothing points at the new checkpoint; the previous one stays.
+			deleteObjects(store, keys)
+			return err
+		}
+		checkpoints.replace(keys)
+		return nil
+	}
+}
+
+// promoteLiveCheckpoint publishes the last stored checkpoint of a live
+// recording whose attempt failed, and reports whether it did. Recording the
+// stream again would start a new window from the live edge, not resume this
+// one, so the hours already stored are worth more than a retry.
+func promoteLiveCheckpoint(db *gorm.DB, item *models.ArchiveItem, logWriter io.Writer) bool {
+	var current models.ArchiveItem
+	if err := db.First(&current, item.ID).Error; err != nil {
+		return false
+	}
+	if current.Status == "completed" || current.StorageKey == "" || current.Extension != archivers.LiveCheckpointExtension {
+		return false
+	}
+	if err := db.Model(item).Updates(map[string]interface{}{
+		"status":       "completed",
+		"completeness": archivers.CompletenessPartial,
+	}).Error; err != nil {
+		slog.Error("Failed to promote live checkpoint", "item_id", item.ID, "error", err)
+		return false
+	}
+	fmt.Fprintf(logWriter, "\nKept the last live checkpoint (%d bytes) as a partial recording\n", current.FileSize)
+	slog.Info("Promoted live checkpoint", "item_id", item.ID, "storage_key", current.StorageKey)
+	return true
+}
@@ -0,0 +1,74 @@
+package workers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"arker/internal/archivers"
+	"arker/internal/models"
+	"arker/internal/storage"
+	"arker/internal/testfixtures"
+	"arker/internal/utils"
+)
+
+// TestProcessArchiveJobPromotesTheLastLiveCheckpoint records a live stream
+// whose attempt fails after the recording, the way a lost sidecar or a
+// killed worker would, and expects the last checkpoint to be published as a
+// partial capture instead of the hours being thrown away, with the
+// checkpoints it superseded deleted.
+func TestProcessArchiveJobPromotesTheLastLiveCheckpoint(t *testing.T) {
+	previous := utils.LiveSettings()
+	t.Cleanup(func() { utils.InitLive(previous) })
+	utils.InitLive(utils.LiveConfig{MaxDuration: time.Minute, CheckpointInterval: 200 * time.Millisecond})
+	c := testfixtures.Lookup(t, "youtube_regular")
+	testfixtures.InstallFakeYtDlp(t, testfixtures.YtDlpFake{Fixture: c.Name, Live: true, LiveChunks: 8, NoInfoJSON: true})
+	testfixtures.InstallFakeFFmpegRemux(t, false)
+
+	db := newWorkerTestDB(t)
+	url := models.ArchivedURL{Original: c.URL}
+	db.Create(&url)
+	capture := models.Capture{ArchivedURLID: url.ID, Timestamp: time.Now(), ShortID: "live1"}
+	db.Create(&capture)
+	item := models.ArchiveItem{CaptureID: capture.ID, Type: utils.ArchiveTypeYtDlp, Status: "processing"}
+	db.Create(&item)
+
+	store := storage.NewMemoryStorage()
+	m := map[string]archivers.Archiver{utils.ArchiveTypeYtDlp: &archivers.YtDlpArchiver{}}
+	args := ArchiveJobArgs{ShortID: "live1", Type: utils.ArchiveTypeYtDlp, URL: c.URL}
+	if err := processArchiveJob(context.Background(), args, &item, store, db, m); err != nil {
+		t.Fatalf("processArchiveJob: %v; want the checkpoint promoted", err)
+	}
+
+	var got models.ArchiveItem
+	db.First(&got, item.ID)
+	if got.Status != "completed" || got.Completeness != archivers.CompletenessPartial ||
+		got.Extension != archivers.LiveCheckpointExtension || !strings.HasPrefix(got.StorageKey, "live1/yt-dlp-") {
+		t.Fatalf("item = %+v; want the checkpoint completed as partial", got)
+	}
+	size, err := store.Size(got.StorageKey)
+	if err != nil || size == 0 || size != got.FileSize || size%188 != 0 {
+		t.Errorf("stored checkpoint size = %d (%v), item says %d; want whole MPEG-TS packets", size, err, got.FileSize)
+	}
+
+	// Superseded checkpoints are deleted; only the promoted one is stored.
+	store.Walk(context.Background(), func(key string, _ int64) error {
+		if strings.HasSuffix(key, archivers.LiveCheckpointExtension) && key != got.StorageKey {
+			t.Errorf("superseded checkpoint %s still stored", key)
+		}
+		return nil
+	})
+
+	var logs []models.ArchiveItemLog
+	db.Where("archive_item_id = ?", item.ID).Order("id").Find(&logs)
+	var text strings.Builder
+	for _, entry := range logs {
+		text.WriteString(entry.Chunk)
+	}
+	for _, want := range []string{"Detected a live stream", "Stored live checkpoint", "Kept the last live checkpoint"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("logs do not mention %q:\n%s", want, text.String())
+		}
+	}
+}
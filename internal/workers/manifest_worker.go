@@ -0,0 +1,336 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+
+	"arker/internal/archivers"
+	"arker/internal/gitcache"
+	"arker/internal/manifest"
+	"arker/internal/models"
+	"arker/internal/storage"
+	"arker/internal/timestamp"
+	"arker/internal/utils"
+)
+
+// ManifestJobArgs is the payload for signing a capture's manifest.
+type ManifestJobArgs struct {
+	ShortID string `json:"short_id"`
+}
+
+// Kind returns the job kind for River.
+func (ManifestJobArgs) Kind() string { return "manifest" }
+
+// ManifestWorker lists, hashes and signs everything a settled capture
+// stored. It is queued when a capture's last item finishes, and by the
+// manifest endpoint for captures settled before signing existed.
+type ManifestWorker struct {
+	river.WorkerDefaults[ManifestJobArgs]
+	storage storage.Storage
+	db      *gorm.DB
+	signer  *manifest.Signer
+	// tsa, when set, timestamps each manifest signed.
+	tsa *timestamp.Authority
+}
+
+// NewManifestWorker creates a new manifest signing worker. A nil tsa leaves
+// manifests untimestamped.
+func NewManifestWorker(store storage.Storage, db *gorm.DB, signer *manifest.Signer, tsa *timestamp.Authority) *ManifestWorker {
+	return &ManifestWorker{storage: store, db: db, signer: signer, tsa: tsa}
+}
+
+// Work signs one capture's manifest.
+func (w *ManifestWorker) Work(ctx context.Context, job *river.Job[ManifestJobArgs]) error {
+	return w.sign(ctx, job.Args)
+}
+
+// sign is Work without the River envelope, so it can be exercised directly.
+//
+// Digests are taken from the bytes read back from storage, not from what the
+// archiver produced, so the manifest vouches for what is actually kept. A
+// capture whose latest manifest already lists exactly its current files is
+// left alone.
+func (w *ManifestWorker) sign(ctx context.Context, args ManifestJobArgs) error {
+	logger := slog.With("worker", "manifest", "short_id", args.ShortID)
+
+	var capture models.Capture
+	if err := w.db.Preload("ArchivedURL").Preload("ArchiveItems", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("short_id = ?", args.ShortID).First(&capture).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.Warn("Capture no longer exists; dropping manifest job")
+			return nil
+		}
+		return fmt.Errorf("manifest: finding capture %s: %w", args.ShortID, err)
+	}
+	if capture.AliasOfID != nil {
+		// An alias owns no items; its canonical capture has the manifest.
+		return nil
+	}
+	if !captureSettled(capture.ArchiveItems) {
+		logger.Debug("Capture not settled; its last item will queue the manifest")
+		return nil
+	}
+
+	listed, err := manifestFiles(w.storage, capture.ArchiveItems)
+	if err != nil {
+		return err
+	}
+	if len(listed) == 0 {
+		return nil
+	}
+	if current, err := w.latestKeys(capture.ID); err != nil {
+		return err
+	} else if sameKeys(current, listed) {
+		logger.Debug("Manifest already lists every stored file")
+		return nil
+	}
+
+	m := &manifest.Manifest{
+		Version:    manifest.Version,
+		ShortID:    capture.ShortID,
+		URL:        capture.ArchivedURL.Original,
+		CapturedAt: capture.Timestamp.UTC(),
+		SignedAt:   time.Now().UTC(),
+	}
+	fileCount, totalBytes := 0, int64(0)
+	for _, item := range capture.ArchiveItems {
+		if item.Status != "completed" || item.StorageKey == "" {
+			continue
+		}
+		entry := manifest.Item{Type: item.Type, Completeness: item.Completeness}
+		for _, f := range listed[item.ID] {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			size, digest, err := hashManifestFile(w.storage, f)
+			if err != nil {
+				return fmt.Errorf("manifest: hashing %s: %w", f.Key, err)
+			}
+			f.Size, f.SHA256 = size, digest
+			entry.Files = append(entry.Files, f)
+			fileCount++
+			totalBytes += size
+		}
+		m.Items = append(m.Items, entry)
+	}
+
+	envelope, err := w.signer.Sign(m)
+	if err != nil {
+		return fmt.Errorf("manifest: signing: %w", err)
+	}
+	key := fmt.Sprintf("%s/manifest-%s.sig.json", capture.ShortID, uploadNonce())
+	if err := writeJSONSidecar(w.storage, key, envelope); err != nil {
+		return fmt.Errorf("manifest: storing %s: %w", key, err)
+	}
+	record := models.CaptureManifest{
+		CaptureID:  capture.ID,
+		StorageKey: key,
+		KeyID:      w.signer.KeyID(),
+		FileCount:  fileCount,
+		TotalBytes: totalBytes,
+	}
+	if err := w.db.Create(&record).Error; err != nil {
+		return fmt.Errorf("manifest: recording %s: %w", key, err)
+	}
+	if w.tsa != nil {
+		riverClient, _ := river.ClientFromContextSafely[pgx.Tx](ctx)
+		if err := EnqueueTimestamp(ctx, riverClient, record.ID); err != nil {
+			logger.Warn("Failed to queue manifest timestamp", "error", err)
+		}
+	}
+
+	logger.Info("Capture manifest signed", "key", key, "files", fileCount, "bytes", totalBytes)
+	return nil
+}
+
+// latestKeys returns the storage keys the capture's newest manifest lists,
+// or nil when it has none.
+func (w *ManifestWorker) latestKeys(captureID uint) ([]string, error) {
+	var record models.CaptureManifest
+	if err := w.db.Where("capture_id = ?", captureID).Order("id DESC").First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("manifest: finding latest manifest: %w", err)
+	}
+	r, err := w.storage.Reader(record.StorageKey)
+	if err != nil {
+		return nil, fmt.Errorf("manifest: opening %s: %w", record.StorageKey, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("manifest: reading %s: %w", record.StorageKey, err)
+	}
+	m, err := manifest.Open(data, w.signer.PublicKey())
+	if err != nil {
+		// Signed with a retired key, or damaged: sign afresh.
+		return nil, nil
+	}
+	return m.Keys(), nil
+}
+
+// manifestFiles lists the stored files of each completed item, by item ID,
+// without their sizes and digests.
+func manifestFiles(store storage.Storage, items []models.ArchiveItem) (map[uint][]manifest.File, error) {
+	listed := map[uint][]manifest.File{}
+	for _, item := range items {
+		if item.Status != "completed" || item.StorageKey == "" {
+			continue
+		}
+		files := []manifest.File{{Role: manifest.RoleArtifact, Key: item.StorageKey}}
+		if isGitDelta(item) {
+			// What /archive/:shortid/git serves, and what it is made of.
+			parents, err := gitcache.ParentKeys(store, item.StorageKey)
+			if err != nil {
+				return nil, fmt.Errorf("manifest: listing layers of %s: %w", item.StorageKey, err)
+			}
+			files = append(files, manifest.File{Role: manifest.RoleRepository, Key: item.StorageKey})
+			for _, key := range parents {
+				files = append(files, manifest.File{Role: manifest.RoleParentLayer, Key: key})
+			}
+		}
+		if item.MetadataKey != "" {
+			files = append(files, manifest.File{Role: manifest.RoleMetadata, Key: item.MetadataKey})
+			for _, key := range storedExtraKeys(store, item.MetadataKey) {
+				files = append(files, manifest.File{Role: manifest.RoleExtra, Key: key})
+			}
+		}
+		if item.RawMetadataKey != "" {
+			files = append(files, manifest.File{Role: manifest.RoleRawMetadata, Key: item.RawMetadataKey})
+		}
+		if item.ThumbnailKey != "" && item.ThumbnailStatus == models.ThumbnailStatusReady {
+			files = append(files, manifest.File{Role: manifest.RoleThumbnail, Key: item.ThumbnailKey})
+		}
+		listed[item.ID] = files
+	}
+	return listed, nil
+}
+
+func isGitDelta(item models.ArchiveItem) bool {
+	return utils.ArchiveTypesEqual(item.Type, utils.ArchiveTypeGit) && item.Extension == gitcache.DeltaExtension
+}
+
+// storedExtraKeys returns the caption tracks a video's metadata records as
+// stored. Extras have no column of their own; the metadata is their index.
+func storedExtraKeys(store storage.Storage, metadataKey string) []string {
+	r, err := store.Reader(metadataKey)
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+	var metadata archivers.VideoMetadata
+	if err := json.NewDecoder(r).Decode(&metadata); err != nil {
+		return nil
+	}
+	var keys []string
+	for _, track := range metadata.Subtitles {
+		if track.StorageKey != "" {
+			keys = append(keys, track.StorageKey)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sameKeys(current []string, listed map[uint][]manifest.File) bool {
+	if current == nil {
+		return false
+	}
+	var want []string
+	for _, files := range listed {
+		for _, f := range files {
+			want = append(want, f.Key)
+		}
+	}
+	sort.Strings(want)
+	current = append([]string(nil), current...)
+	sort.Strings(current)
+	return strings.Join(current, "\n") == strings.Join(want, "\n")
+}
+
+// hashManifestFile returns the size and digest of a listed file: the stored
+// object, or for a repository file the tar rebuilt from its layers.
+func hashManifestFile(store storage.Storage, f manifest.File) (int64, string, error) {
+	if f.Role != manifest.RoleRepository {
+		return hashStored(store, f.Key)
+	}
+	pr, pw := io.Pipe()
+	go func() { pw.CloseWithError(gitcache.WriteTar(pw, store, f.Key)) }()
+	defer pr.Close()
+	return manifest.Hash(pr)
+}
+
+func hashStored(store storage.Storage, key string) (int64, string, error) {
+	r, err := store.Reader(key)
+	if err != nil {
+		return 0, "", err
+	}
+	defer r.Close()
+	return manifest.Hash(r)
+}
+
+// captureSettled reports whether every item of a capture has finished and
+// at least one stored something.
+func captureSettled(items []models.ArchiveItem) bool {
+	completed := false
+	for _, item := range items {
+		switch item.Status {
+		case "completed":
+			completed = true
+		case "failed":
+		default:
+			return false
+		}
+	}
+	return completed
+}
+
+// EnqueueManifestIfSettled queues signing of a capture's manifest once none
+// of its items is still pending or processing. Called as each archive job
+// finishes; only the last one to finish finds the capture settled.
+func EnqueueManifestIfSettled(ctx context.Context, db *gorm.DB, riverClient *river.Client[pgx.Tx], captureID uint, shortID string) error {
+	if riverClient == nil {
+		return nil
+	}
+	var items []models.ArchiveItem
+	if err := db.Select("status").Where("capture_id = ?", captureID).Find(&items).Error; err != nil {
+		return err
+	}
+	if !captureSettled(items) {
+		return nil
+	}
+	return EnqueueManifest(ctx, riverClient, shortID)
+}
+
+// EnqueueManifest requests signing of a capture's manifest. A capture already
+// signed for its current files is left alone, so repeats are cheap.
+func EnqueueManifest(ctx context.Context, riverClient *river.Client[pgx.Tx], shortID string) error {
+	if riverClient == nil {
+		return nil
+	}
+	_, err := riverClient.Insert(ctx, ManifestJobArgs{ShortID: shortID}, &river.InsertOpts{
+		// Hashing rereads every stored byte of the capture; that is a
+		// download's worth of I/O, so it waits with the downloads.
+		MaxAttempts: 5,
+		Tags:        []string{"manifest"},
+		UniqueOpts: river.UniqueOpts{
+			// Short: two items finishing together queue it once, while an
+			// item retried later still gets the capture signed again.
+			ByArgs:   true,
+			ByPeriod: time.Minute,
+		},
+	})
+	return err
+}
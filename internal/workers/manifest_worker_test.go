@@ -0,0 +1,169 @@
+package workers
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"io"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"arker/internal/gitcache"
+	"arker/internal/manifest"
+	"arker/internal/models"
+	"arker/internal/storage"
+)
+
+func newManifestTestWorker(t *testing.T) (*ManifestWorker, *gorm.DB, storage.Storage) {
+	t.Helper()
+	db := newWorkerTestDB(t)
+	if err := db.AutoMigrate(&models.CaptureManifest{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	store := storage.NewMemoryStorage()
+	_, key, _ := ed25519.GenerateKey(nil)
+	return NewManifestWorker(store, db, manifest.NewSigner(key), nil), db, store
+}
+
+func TestManifestWorkerSignsStoredFiles(t *testing.T) {
+	w, db, store := newManifestTestWorker(t)
+	putObject(t, store, "abc12/yt-dlp-aa.mp4", []byte("video bytes"))
+	putObject(t, store, "abc12/yt-dlp-aa.metadata.json", []byte(`{"subtitles":[{"lang":"en","storage_key":"abc12/yt-dlp-aa.sub.en.vtt"}]}`))
+	putObject(t, store, "abc12/yt-dlp-aa.sub.en.vtt", []byte("WEBVTT\n"))
+	item := seedItem(t, db, "abc12", "yt-dlp", "completed", "abc12/yt-dlp-aa.mp4")
+	db.Model(&item).Update("metadata_key", "abc12/yt-dlp-aa.metadata.json")
+	db.Create(&models.ArchiveItem{CaptureID: item.CaptureID, Type: "mhtml", Status: "failed"})
+
+	if err := w.sign(context.Background(), ManifestJobArgs{ShortID: "abc12"}); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	var records []models.CaptureManifest
+	db.Find(&records)
+	if len(records) != 1 || records[0].FileCount != 3 || records[0].TotalBytes == 0 || records[0].KeyID != w.signer.KeyID() {
+		t.Fatalf("records = %+v", records)
+	}
+	r, err := store.Reader(records[0].StorageKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	m, err := manifest.Open(data, w.signer.PublicKey())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if m.ShortID != "abc12" || m.URL != "https://example.com/abc12" || len(m.Items) != 1 {
+		t.Fatalf("manifest = %+v", m)
+	}
+	files := m.Items[0].Files
+	if len(files) != 3 || files[0].Role != manifest.RoleArtifact || files[1].Role != manifest.RoleMetadata || files[2].Role != manifest.RoleExtra {
+		t.Fatalf("files = %+v", files)
+	}
+	size, digest, _ := manifest.Hash(strings.NewReader("video bytes"))
+	if files[0].Size != size || files[0].SHA256 != digest {
+		t.Errorf("artifact = %+v, want %d %s", files[0], size, digest)
+	}
+
+	// Nothing changed: no second manifest.
+	if err := w.sign(context.Background(), ManifestJobArgs{ShortID: "abc12"}); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&models.CaptureManifest{}).Count(&count)
+	if count != 1 {
+		t.Errorf("re-signing an unchanged capture made %d manifests", count)
+	}
+
+	// A failed item retried into a completed one is signed again.
+	putObject(t, store, "abc12/mhtml-bb.mhtml", []byte("page"))
+	db.Model(&models.ArchiveItem{}).Where("type = ?", "mhtml").Updates(map[string]any{"status": "completed", "storage_key": "abc12/mhtml-bb.mhtml"})
+	if err := w.sign(context.Background(), ManifestJobArgs{ShortID: "abc12"}); err != nil {
+		t.Fatal(err)
+	}
+	db.Model(&models.CaptureManifest{}).Count(&count)
+	if count != 2 {
+		t.Errorf("after the retry there are %d manifests, want 2", count)
+	}
+}
+
+func TestManifestWorkerWaitsForUnsettledCapture(t *testing.T) {
+	w, db, store := newManifestTestWorker(t)
+	putObject(t, store, "abc12/mhtml-aa.mhtml", []byte("page"))
+	item := seedItem(t, db, "abc12", "mhtml", "completed", "abc12/mhtml-aa.mhtml")
+	db.Create(&models.ArchiveItem{CaptureID: item.CaptureID, Type: "screenshot", Status: "processing"})
+
+	if err := w.sign(context.Background(), ManifestJobArgs{ShortID: "abc12"}); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	db.Model(&models.CaptureManifest{}).Count(&count)
+	if count != 0 {
+		t.Errorf("an unsettled capture was signed")
+	}
+}
+
+// gitLayer builds a stored git layer: a tar of the named entries, after a
+// delta marker when parentKey is set.
+func gitLayer(t *testing.T, parentKey string, entries ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	write := func(name, body string) {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg})
+		io.WriteString(tw, body)
+	}
+	if parentKey != "" {
+		write(gitcache.DeltaMarker, `{"parent_short_id":"base1","parent_storage_key":"`+parentKey+`","depth":1}`)
+	}
+	for _, name := range entries {
+		write(name, "contents of "+name)
+	}
+	tw.Close()
+	return buf.Bytes()
+}
+
+// An incremental git capture is downloaded as the whole repository rebuilt
+// from its layers, so that is what arker verify must find in the manifest.
+func TestManifestWorkerCoversRebuiltGitRepository(t *testing.T) {
+	w, db, store := newManifestTestWorker(t)
+	putObject(t, store, "base1/git-aa.tar", gitLayer(t, "", "HEAD", "objects/aa/1111", "refs/heads/main"))
+	putObject(t, store, "delt1/git-bb.delta.tar", gitLayer(t, "base1/git-aa.tar", "objects/bb/2222", "HEAD", "refs/heads/main"))
+	item := seedItem(t, db, "delt1", "git", "completed", "delt1/git-bb.delta.tar")
+	db.Model(&item).Update("extension", gitcache.DeltaExtension)
+
+	if err := w.sign(context.Background(), ManifestJobArgs{ShortID: "delt1"}); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	var record models.CaptureManifest
+	db.First(&record)
+	r, _ := store.Reader(record.StorageKey)
+	data, _ := io.ReadAll(r)
+	r.Close()
+	m, err := manifest.Open(data, w.signer.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := m.Items[0].Files
+	if len(files) != 3 || files[1].Role != manifest.RoleRepository || files[2].Role != manifest.RoleParentLayer || files[2].Key != "base1/git-aa.tar" {
+		t.Fatalf("files = %+v", files)
+	}
+
+	// What /archive/delt1/git serves.
+	var rebuilt bytes.Buffer
+	if err := gitcache.WriteTar(&rebuilt, store, "delt1/git-bb.delta.tar"); err != nil {
+		t.Fatal(err)
+	}
+	size, digest, _ := manifest.Hash(&rebuilt)
+	if _, f, ok := m.Match(size, digest); !ok || f.Role != manifest.RoleRepository {
+		t.Errorf("the rebuilt repository is not in the manifest (match %+v, %v)", f, ok)
+	}
+	parent, _ := store.Reader("base1/git-aa.tar")
+	size, digest, _ = manifest.Hash(parent)
+	parent.Close()
+	if _, f, ok := m.Match(size, digest); !ok || f.Role != manifest.RoleParentLayer {
+		t.Errorf("the parent layer is not in the manifest (match %+v, %v)", f, ok)
+	}
+}
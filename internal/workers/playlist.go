@@ -0,0 +1,152 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+
+	"arker/internal/archivers"
+	"arker/internal/models"
+	"arker/internal/utils"
+)
+
+// playlistChildTypes is what each video of a playlist is captured as. Only the
+// video: a browser capture of every watch page would multiply a 200-video
+// channel into 600 jobs for pages that all look the same.
+var playlistChildTypes = []string{utils.ArchiveTypeYtDlp}
+
+// expandPlaylist creates a child capture and a PlaylistEntry for every video
+// in listing, under the playlist item's capture. It is idempotent per video
+// URL, so a retried playlist job picks up where a failed attempt stopped
+// rather than queueing every video twice, and first queues again any video
+// that attempt created but could not queue.
+func expandPlaylist(ctx context.Context, db *gorm.DB, riverClient *river.Client[pgx.Tx], item *models.ArchiveItem, listing *archivers.PlaylistListing, logWriter io.Writer) error {
+	var parent models.Capture
+	if err := db.First(&parent, item.CaptureID).Error; err != nil {
+		return fmt.Errorf("load playlist capture: %w", err)
+	}
+
+	var existing []models.PlaylistEntry
+	if err := db.Where("playlist_capture_id = ?", parent.ID).Find(&existing).Error; err != nil {
+		return fmt.Errorf("load playlist entries: %w", err)
+	}
+	done := make(map[string]bool, len(existing))
+	children := make(map[uint]string, len(existing))
+	for _, entry := range existing {
+		done[entry.URL] = true
+		children[entry.ChildCaptureID] = entry.URL
+	}
+	requeued, err := requeuePendingChildren(ctx, db, riverClient, children)
+	if err != nil {
+		return err
+	}
+	if requeued > 0 {
+		fmt.Fprintf(logWriter, "Queued %d videos from an earlier attempt again\n", requeued)
+	}
+
+	// Every video is archived under the playlist's own quality policy.
+	quality := utils.DecodeVideoQuality(item.QualityPolicy)
+
+	var created, aliased int
+	for _, entry := range listing.Entries {
+		if done[entry.URL] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		shortID, aliasOf, err := createPlaylistChild(db, parent, entry, quality)
+		if err != nil {
+			return fmt.Errorf("queue video %d (%s): %w", entry.Position, entry.URL, err)
+		}
+		if aliasOf != nil {
+			aliased++
+			fmt.Fprintf(logWriter, "#%d %s: already archived as %s, aliased as %s\n", entry.Position, entry.URL, aliasOf.ShortID, shortID)
+			continue
+		}
+		created++
+		fmt.Fprintf(logWriter, "#%d %s: queued as %s\n", entry.Position, entry.URL, shortID)
+		if riverClient != nil { // nil in tests that only exercise the database side.
+			if err := enqueueChildCaptureJobs(ctx, riverClient, shortID, entry.URL, playlistChildTypes, quality); err != nil {
+				return fmt.Errorf("queue video %d (%s): %w", entry.Position, entry.URL, err)
+			}
+		}
+	}
+
+	fmt.Fprintf(logWriter, "Playlist expanded: %d videos queued, %d already archived, %d from an earlier attempt\n",
+		created, aliased, len(existing))
+	slog.Info("Expanded playlist capture",
+		"short_id", parent.ShortID,
+		"entries", len(listing.Entries),
+		"queued", created,
+		"aliased", aliased)
+	return nil
+}
+
+// createPlaylistChild creates the child capture for one video and its
+// PlaylistEntry in one transaction, serialized on the video's identity like
+// every other capture creation. A video that already has a capture usable by
+// find-or-create (completed, or still in flight) gets an alias of it instead of
+// a second download; the returned aliasOf is that capture.
+func createPlaylistChild(db *gorm.DB, parent models.Capture, entry archivers.PlaylistListingEntry, quality utils.VideoQuality) (string, *models.Capture, error) {
+	canonical := utils.CanonicalizeArchiveURL(entry.URL)
+	criteria := findOrCreateCriteria{types: playlistChildTypes, quality: quality}
+
+	var shortID string
+	var aliasOf *models.Capture
+	err := withCaptureIdentityLock(db, canonical, func(tx *gorm.DB) error {
+		rows, exact, err := loadIdentityRows(tx, entry.URL, canonical)
+		if err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			if aliasOf, _, err = findFindOrCreateCandidate(tx, archivedURLIDs(rows), criteria); err != nil {
+				return err
+			}
+		}
+		if aliasOf == nil {
+			if err := refuseUnavailableTypes(playlistChildTypes); err != nil {
+				return err
+			}
+		}
+
+		archivedURL, err := ensureArchivedURL(tx, entry.URL, canonical, exact)
+		if err != nil {
+			return err
+		}
+		shortID = utils.GenerateShortID(tx)
+		child := models.Capture{ArchivedURLID: archivedURL.ID, Timestamp: time.Now(), ShortID: shortID, APIKeyID: parent.APIKeyID}
+		if aliasOf != nil {
+			child.AliasOfID = &aliasOf.ID
+		}
+		if err := tx.Create(&child).Error; err != nil {
+			return err
+		}
+		if aliasOf == nil {
+			for _, typ := range playlistChildTypes {
+				if err := tx.Create(&models.ArchiveItem{CaptureID: child.ID, Type: typ, Status: "pending", QualityPolicy: qualityPolicyFor(typ, quality)}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Create(&models.PlaylistEntry{
+			PlaylistCaptureID: parent.ID,
+			Position:          entry.Position,
+			URL:               entry.URL,
+			VideoID:           entry.ID,
+			Title:             entry.Title,
+			DurationSeconds:   entry.DurationSeconds,
+			ChildCaptureID:    child.ID,
+		}).Error
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return shortID, aliasOf, nil
+}
@@ -0,0 +1,148 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"arker/internal/archivers"
+	"arker/internal/models"
+	"arker/internal/storage"
+	"arker/internal/utils"
+)
+
+// playlistArchiver returns a fixed listing, as PlaylistArchiver would after
+// running yt-dlp.
+type playlistArchiver struct{ listing *archivers.PlaylistListing }
+
+func (p playlistArchiver) Archive(ctx context.Context, url string, logWriter io.Writer, db *gorm.DB, itemID uint) (archivers.Result, error) {
+	return archivers.Result{Data: bytes.NewReader([]byte("{}")), Extension: ".json", Playlist: p.listing}, nil
+}
+
+func newPlaylistTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := newWorkerTestDB(t)
+	if err := db.AutoMigrate(&models.PlaylistEntry{}, &models.Config{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func TestPlaylistJobQueuesNewVideosAndAliasesArchivedOnes(t *testing.T) {
+	db := newPlaylistTestDB(t)
+	archived := seedCapture(t, db, "https://www.youtube.com/watch?v=old", "old01", 30*24*time.Hour,
+		map[string]string{utils.ArchiveTypeYtDlp: "completed"})
+	inFlight := seedCapture(t, db, "https://www.youtube.com/watch?v=busy", "busy1", time.Minute,
+		map[string]string{utils.ArchiveTypeYtDlp: "processing"})
+	failed := seedCapture(t, db, "https://www.youtube.com/watch?v=bad", "bad01", time.Hour,
+		map[string]string{utils.ArchiveTypeYtDlp: "failed"})
+
+	apiKeyID := uint(7)
+	parent := seedCapture(t, db, "https://www.youtube.com/playlist?list=PL1", "plist", 0,
+		map[string]string{utils.ArchiveTypePlaylist: "processing"})
+	db.Model(&parent).Update("api_key_id", apiKeyID)
+	var item models.ArchiveItem
+	db.Where("capture_id = ?", parent.ID).First(&item)
+
+	listing := &archivers.PlaylistListing{Entries: []archivers.PlaylistListingEntry{
+		{Position: 1, URL: "https://www.youtube.com/watch?v=new", ID: "new", Title: "New video"},
+		{Position: 2, URL: "https://www.youtube.com/watch?v=old", ID: "old"},
+		{Position: 3, URL: "https://www.youtube.com/watch?v=busy", ID: "busy"},
+		{Position: 4, URL: "https://www.youtube.com/watch?v=bad", ID: "bad"},
+	}}
+	m := map[string]archivers.Archiver{utils.ArchiveTypePlaylist: playlistArchiver{listing}}
+	args := ArchiveJobArgs{ShortID: "plist", Type: utils.ArchiveTypePlaylist, URL: "https://www.youtube.com/playlist?list=PL1"}
+	if err := processArchiveJob(context.Background(), args, &item, storage.NewMemoryStorage(), db, m); err != nil {
+		t.Fatalf("processArchiveJob: %v", err)
+	}
+
+	var entries []models.PlaylistEntry
+	db.Where("playlist_capture_id = ?", parent.ID).Preload("ChildCapture.ArchiveItems").Order("position").Find(&entries)
+	if len(entries) != 4 {
+		t.Fatalf("%d entries, want 4", len(entries))
+	}
+	wantAlias := map[int]*models.Capture{1: nil, 2: &archived, 3: &inFlight, 4: nil}
+	for _, entry := range entries {
+		child := entry.ChildCapture
+		if child.APIKeyID == nil || *child.APIKeyID != apiKeyID {
+			t.Errorf("#%d: child API key = %v, want the playlist's", entry.Position, child.APIKeyID)
+		}
+		want := wantAlias[entry.Position]
+		switch {
+		case want != nil && (child.AliasOfID == nil || *child.AliasOfID != want.ID):
+			t.Errorf("#%d: alias of %v, want %s", entry.Position, child.AliasOfID, want.ShortID)
+		case want != nil && len(child.ArchiveItems) != 0:
+			t.Errorf("#%d: alias owns items", entry.Position)
+		case want == nil && (child.AliasOfID != nil || len(child.ArchiveItems) != 1 || child.ArchiveItems[0].Type != utils.ArchiveTypeYtDlp):
+			t.Errorf("#%d: child = %+v, want a fresh yt-dlp capture", entry.Position, child)
+		}
+		if entry.Position == 4 && child.ID == failed.ID {
+			t.Error("a failed capture was reused")
+		}
+	}
+	if entries[0].Title != "New video" || entries[0].VideoID != "new" {
+		t.Errorf("entry metadata = %+v", entries[0])
+	}
+
+	var got models.ArchiveItem
+	db.First(&got, item.ID)
+	if got.Status != "completed" {
+		t.Errorf("playlist item status = %q, want completed", got.Status)
+	}
+
+	// A retried job finds every video already queued and adds nothing.
+	var captures int64
+	db.Model(&models.Capture{}).Count(&captures)
+	if err := expandPlaylist(context.Background(), db, nil, &item, listing, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	var after int64
+	db.Model(&models.Capture{}).Count(&after)
+	if after != captures {
+		t.Errorf("re-expanding created %d more captures", after-captures)
+	}
+
+	// The retry queues again the videos still pending, with the args their
+	// first jobs had, so a job already queued absorbs them.
+	children := map[uint]string{}
+	for _, entry := range entries {
+		children[entry.ChildCaptureID] = entry.URL
+	}
+	jobs, err := pendingChildJobs(db, children)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh := entries[0].ChildCapture
+	want := ArchiveJobArgs{ShortID: fresh.ShortID, Type: utils.ArchiveTypeYtDlp, URL: entries[0].URL}
+	if len(jobs) != 2 || jobs[0] != want || jobs[1].URL != entries[3].URL {
+		t.Errorf("pending child jobs = %+v, want the two fresh videos", jobs)
+	}
+}
+
+func TestPlaylistJobRefusedWhileYtDlpIsDown(t *testing.T) {
+	db := newPlaylistTestDB(t)
+	utils.SetArchiveTypeHealth(func(typ string) (string, bool) {
+		return "yt-dlp: not installed", typ == utils.ArchiveTypeYtDlp
+	})
+	t.Cleanup(func() { utils.SetArchiveTypeHealth(nil) })
+
+	parent := seedCapture(t, db, "https://www.youtube.com/@someone", "chan1", 0,
+		map[string]string{utils.ArchiveTypePlaylist: "processing"})
+	var item models.ArchiveItem
+	db.Where("capture_id = ?", parent.ID).First(&item)
+	listing := &archivers.PlaylistListing{Entries: []archivers.PlaylistListingEntry{
+		{Position: 1, URL: "https://www.youtube.com/watch?v=new"},
+	}}
+	if err := expandPlaylist(context.Background(), db, nil, &item, listing, io.Discard); err == nil {
+		t.Fatal("a video was queued while yt-dlp is down")
+	}
+	var entries int64
+	db.Model(&models.PlaylistEntry{}).Count(&entries)
+	if entries != 0 {
+		t.Errorf("%d entries recorded for refused videos", entries)
+	}
+}
@@ -2,12 +2,14 @@ package workers
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
 	"gorm.io/gorm"
 
 	"arker/internal/archivers"
@@ -29,6 +31,28 @@ type FindOrCreateResult struct {
 	Status  string
 }
 
+// UnavailableTypesError refuses a capture because the health monitor found a
+// dependency of one of its archive types down. Nothing was created or queued.
+type UnavailableTypesError struct {
+	// Reasons maps each refused type to why.
+	Reasons map[string]string
+}
+
+func (e *UnavailableTypesError) Error() string {
+	return utils.DescribeUnavailableArchiveTypes(e.Reasons)
+}
+
+// refuseUnavailableTypes returns an UnavailableTypesError when any type cannot
+// run right now. Checked where a new capture is about to be created, not
+// earlier: a request that resolves to an alias or an existing capture queues
+// nothing and has no reason to fail.
+func refuseUnavailableTypes(types []string) error {
+	if reasons := utils.UnavailableArchiveTypes(types); len(reasons) > 0 {
+		return &UnavailableTypesError{Reasons: reasons}
+	}
+	return nil
+}
+
 // captureIdentityLocks serializes capture creation for one canonical identity
 // within this process. It is the in-process half of the pair described on
 // withCaptureIdentityLock.
@@ -161,6 +185,32 @@ func ensureArchivedURL(tx *gorm.DB, url, canonical string, exact *models.Archive
 	return created, nil
 }
 
+// defaultArchiveTypes returns the types of a request that names none. The
+// content probe behind utils.GetArchiveTypes costs a request to the site, up
+// to two probe timeouts, so it is skipped when an earlier capture would answer
+// the request under any type list the probe could pick: reusable reports
+// whether one does. The locked lookup that follows finds that capture again.
+func defaultArchiveTypes(db *gorm.DB, url string, reusable func(tx *gorm.DB, archivedURLIDs []uint, types []string) (bool, error)) ([]string, error) {
+	if outcomes := utils.ContentProbeOutcomes(url); outcomes != nil {
+		rows, _, err := loadIdentityRows(db, url, utils.CanonicalizeArchiveURL(url))
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) > 0 {
+			for _, types := range outcomes {
+				ok, err := reusable(db, archivedURLIDs(rows), types)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					return types, nil
+				}
+			}
+		}
+	}
+	return utils.GetArchiveTypes(url), nil
+}
+
 // QueueCapture creates an ArchivedURL (if needed), a capture, and queues
 // archive jobs.
 //
@@ -171,15 +221,29 @@ func ensureArchivedURL(tx *gorm.DB, url, canonical string, exact *models.Archive
 // provenance, but owns no archive items and enqueues no jobs. Serving resolves
 // aliases to the canonical capture with a visible redirect.
 func QueueCapture(ctx context.Context, db *gorm.DB, riverClient *river.Client[pgx.Tx], url string, types []string, apiKeyID *uint, force bool) (string, error) {
+	return QueueCaptureWithQuality(ctx, db, riverClient, url, types, apiKeyID, force, utils.VideoQuality{})
+}
+
+// QueueCaptureWithQuality is QueueCapture for a request with a video quality
+// policy. An alias is only made of a capture whose video was archived under a
+// policy that satisfies this one.
+func QueueCaptureWithQuality(ctx context.Context, db *gorm.DB, riverClient *river.Client[pgx.Tx], url string, types []string, apiKeyID *uint, force bool, quality utils.VideoQuality) (string, error) {
+	quality = quality.Normalize()
 	if len(types) == 0 {
-		types = utils.GetArchiveTypes(url)
+		var err error
+		types, err = defaultArchiveTypes(db, url, func(tx *gorm.DB, ids []uint, candidate []string) (bool, error) {
+			return !force && findReusableCapture(tx, ids, candidate, quality) != nil, nil
+		})
+		if err != nil {
+			return "", err
+		}
 	} else {
 		// Callers may still send retired type names (e.g. "youtube"); store
 		// and queue the canonical name so there is one type per archiver.
 		types = utils.NormalizeArchiveTypes(types)
 	}
 
-	shortID, aliasOf, createdItems, err := createCapture(db, url, types, apiKeyID, force)
+	shortID, aliasOf, createdItems, err := createCapture(db, url, types, apiKeyID, force, quality)
 	if err != nil {
 		return "", err
 	}
@@ -194,19 +258,23 @@ func QueueCapture(ctx context.Context, db *gorm.DB, riverClient *river.Client[pg
 		return shortID, nil
 	}
 
-	jobsEnqueued := enqueueCaptureJobs(ctx, riverClient, shortID, url, types)
+	jobsEnqueued := 0
+	if riverClient != nil { // nil in tests that only exercise the database side.
+		jobsEnqueued = enqueueCaptureJobs(ctx, riverClient, shortID, url, types, quality)
+	}
 
 	slog.Info("Queued new capture",
 		"short_id", shortID,
 		"url", url,
 		"types", types,
+		"quality", utils.EncodeVideoQuality(quality),
 		"items_created", createdItems,
 		"jobs_enqueued", jobsEnqueued)
 
 	return shortID, nil
 }
 
-func enqueueCaptureJobs(ctx context.Context, riverClient *river.Client[pgx.Tx], shortID, url string, types []string) int {
+func enqueueCaptureJobs(ctx context.Context, riverClient *river.Client[pgx.Tx], shortID, url string, types []string, quality utils.VideoQuality) int {
 	jobsEnqueued := 0
 	for _, t := range types {
 		args := ArchiveJobArgs{
@@ -214,6 +282,7 @@ func enqueueCaptureJobs(ctx context.Context, riverClient *river.Client[pgx.Tx],
 			ShortID:   shortID,
 			Type:      t,
 			URL:       url,
+			Quality:   jobQuality(t, quality),
 		}
 
 		opts := &river.InsertOpts{
@@ -238,6 +307,125 @@ func enqueueCaptureJobs(ctx context.Context, riverClient *river.Client[pgx.Tx],
 	return jobsEnqueued
 }
 
+// enqueueChildCaptureJobs queues the archive jobs of a capture a playlist or
+// a repository's submodules expanded into. Unlike enqueueCaptureJobs it
+// returns the first failure, so the parent job fails and its retry queues the
+// child again through requeuePendingChildren.
+func enqueueChildCaptureJobs(ctx context.Context, riverClient *river.Client[pgx.Tx], shortID, url string, types []string, quality utils.VideoQuality) error {
+	for _, t := range types {
+		args := ArchiveJobArgs{ShortID: shortID, Type: t, URL: url, Quality: jobQuality(t, quality)}
+		if _, err := riverClient.Insert(ctx, args, childJobInsertOpts(t)); err != nil {
+			return fmt.Errorf("enqueue %s job for %s: %w", t, shortID, err)
+		}
+	}
+	return nil
+}
+
+// requeuePendingChildren queues again the jobs of child captures whose items
+// are still pending: an earlier attempt of the parent created them and may
+// have failed to queue them. children maps each child capture ID to the URL it
+// captures. A job already queued or running absorbs the new one, so none runs
+// twice. It returns how many items it queued.
+func requeuePendingChildren(ctx context.Context, db *gorm.DB, riverClient *river.Client[pgx.Tx], children map[uint]string) (int, error) {
+	jobs, err := pendingChildJobs(db, children)
+	if err != nil || riverClient == nil { // nil in tests that only exercise the database side.
+		return 0, err
+	}
+	for _, args := range jobs {
+		if _, err := riverClient.Insert(ctx, args, childJobInsertOpts(args.Type)); err != nil {
+			return 0, fmt.Errorf("enqueue %s job for %s: %w", args.Type, args.ShortID, err)
+		}
+	}
+	return len(jobs), nil
+}
+
+// pendingChildJobs returns the archive job of every pending item of children,
+// with the args enqueueChildCaptureJobs gave it.
+func pendingChildJobs(db *gorm.DB, children map[uint]string) ([]ArchiveJobArgs, error) {
+	if len(children) == 0 {
+		return nil, nil
+	}
+	ids := make([]uint, 0, len(children))
+	for id := range children {
+		ids = append(ids, id)
+	}
+	var items []struct {
+		models.ArchiveItem
+		ShortID string
+	}
+	err := db.Model(&models.ArchiveItem{}).
+		Select("archive_items.*, captures.short_id").
+		Joins("JOIN captures ON captures.id = archive_items.capture_id").
+		Where("archive_items.capture_id IN ? AND archive_items.status = ?", ids, "pending").
+		Order("archive_items.id").
+		Find(&items).Error
+	if err != nil {
+		return nil, fmt.Errorf("load pending child items: %w", err)
+	}
+	jobs := make([]ArchiveJobArgs, len(items))
+	for i, item := range items {
+		jobs[i] = ArchiveJobArgs{
+			ShortID: item.ShortID,
+			Type:    item.Type,
+			URL:     children[item.CaptureID],
+			Quality: jobQuality(item.Type, utils.DecodeVideoQuality(item.QualityPolicy)),
+		}
+	}
+	return jobs, nil
+}
+
+// childJobInsertOpts are unique by args for as long as a job is live, not
+// for a period, so requeuePendingChildren can ask again at any time.
+func childJobInsertOpts(typ string) *river.InsertOpts {
+	return &river.InsertOpts{
+		MaxAttempts: 3,
+		Tags:        []string{"archive", typ},
+		UniqueOpts: river.UniqueOpts{
+			ByArgs: true,
+			ByState: []rivertype.JobState{
+				rivertype.JobStateAvailable,
+				rivertype.JobStatePending,
+				rivertype.JobStateRunning,
+				rivertype.JobStateScheduled,
+				rivertype.JobStateRetryable,
+			},
+		},
+	}
+}
+
+// RequeueArchiveItem sets an existing archive item back to pending and queues
+// a new archive job for it, under the video quality policy it was requested
+// with. tag names the reason in the job's tags ("retry", "recapture").
+func RequeueArchiveItem(ctx context.Context, db *gorm.DB, riverClient *river.Client[pgx.Tx], item *models.ArchiveItem, tag string) error {
+	var capture models.Capture
+	if err := db.Preload("ArchivedURL").First(&capture, item.CaptureID).Error; err != nil {
+		return err
+	}
+	if err := db.Model(item).Update("status", "pending").Error; err != nil {
+		return err
+	}
+
+	args := ArchiveJobArgs{
+		CaptureID: 0, // Will be looked up by short_id and type
+		ShortID:   capture.ShortID,
+		Type:      item.Type,
+		URL:       capture.ArchivedURL.Original,
+	}
+	if quality := utils.DecodeVideoQuality(item.QualityPolicy); !quality.IsZero() {
+		args.Quality = &quality
+	}
+	opts := &river.InsertOpts{
+		MaxAttempts: 3,
+		Tags:        []string{"archive", item.Type, tag},
+		UniqueOpts: river.UniqueOpts{
+			ByArgs:   true,
+			ByPeriod: 1 * time.Minute,
+		},
+	}
+	_, err := riverClient.Insert(ctx, args, opts)
+	return err
+}
+
 // FindOrCreateCapture returns the newest reusable canonical capture, joins a
 // canonical in-flight capture when possible, or creates and queues a new one.
 // Explicit types are all required; an auto-detected social request is settled
@@ -245,13 +433,31 @@ func enqueueCaptureJobs(ctx context.Context, riverClient *river.Client[pgx.Tx],
 // Unlike QueueCapture's compatibility aliasing behavior, this operation has no
 // freshness window and never creates an alias.
 func FindOrCreateCapture(ctx context.Context, db *gorm.DB, riverClient *river.Client[pgx.Tx], url string, types []string, apiKeyID *uint) (FindOrCreateResult, error) {
+	return FindOrCreateCaptureWithQuality(ctx, db, riverClient, url, types, apiKeyID, utils.VideoQuality{})
+}
+
+// FindOrCreateCaptureWithQuality is FindOrCreateCapture for a request with a
+// video quality policy. A capture only answers it when its video was archived
+// under a policy that satisfies the request; see utils.VideoQuality.Satisfies.
+func FindOrCreateCaptureWithQuality(ctx context.Context, db *gorm.DB, riverClient *river.Client[pgx.Tx], url string, types []string, apiKeyID *uint, quality utils.VideoQuality) (FindOrCreateResult, error) {
+	quality = quality.Normalize()
 	defaultTypes := len(types) == 0
 	if len(types) == 0 {
-		types = utils.GetArchiveTypes(url)
+		var err error
+		types, err = defaultArchiveTypes(db, url, func(tx *gorm.DB, ids []uint, candidate []string) (bool, error) {
+			criteria := findOrCreateCriteriaFor(url, candidate, true)
+			criteria.quality = quality
+			capture, _, err := findFindOrCreateCandidate(tx, ids, criteria)
+			return capture != nil, err
+		})
+		if err != nil {
+			return FindOrCreateResult{}, err
+		}
 	} else {
 		types = utils.NormalizeArchiveTypes(types)
 	}
 	criteria := findOrCreateCriteriaFor(url, types, defaultTypes)
+	criteria.quality = quality
 
 	canonical := utils.CanonicalizeArchiveURL(url)
 
@@ -279,6 +485,10 @@ func FindOrCreateCapture(ctx context.Context, db *gorm.DB, riverClient *river.Cl
 			}
 		}
 
+		if err := refuseUnavailableTypes(types); err != nil {
+			return err
+		}
+
 		archivedURL, err := ensureArchivedURL(tx, url, canonical, exact)
 		if err != nil {
 			return err
@@ -289,7 +499,7 @@ func FindOrCreateCapture(ctx context.Context, db *gorm.DB, riverClient *river.Cl
 			return err
 		}
 		for _, typ := range types {
-			if err := tx.Create(&models.ArchiveItem{CaptureID: capture.ID, Type: typ, Status: "pending"}).Error; err != nil {
+			if err := tx.Create(&models.ArchiveItem{CaptureID: capture.ID, Type: typ, Status: "pending", QualityPolicy: qualityPolicyFor(typ, quality)}).Error; err != nil {
 				return err
 			}
 		}
@@ -301,7 +511,7 @@ func FindOrCreateCapture(ctx context.Context, db *gorm.DB, riverClient *river.Cl
 	}
 	if result.Action == FindOrCreateCreated {
 		if riverClient != nil { // nil is useful for transaction-focused unit tests.
-			enqueueCaptureJobs(ctx, riverClient, result.ShortID, url, types)
+			enqueueCaptureJobs(ctx, riverClient, result.ShortID, url, types, quality)
 		}
 	}
 	return result, nil
@@ -310,6 +520,9 @@ func FindOrCreateCapture(ctx context.Context, db *gorm.DB, riverClient *river.Cl
 type findOrCreateCriteria struct {
 	types                 []string
 	requireCompleteSocial bool
+	// quality is the requested video policy. Items of types that honor one
+	// must have been archived under a policy that satisfies it.
+	quality utils.VideoQuality
 }
 
 // findOrCreateCriteriaFor separates what a default request attempts from what
@@ -395,7 +608,7 @@ func captureStatusForTypes(c *models.Capture, criteria findOrCreateCriteria) (st
 	var completedAt time.Time
 	for _, typ := range criteria.types {
 		item, ok := byType[utils.NormalizeArchiveType(typ)]
-		if !ok {
+		if !ok || !itemSatisfiesQuality(item, criteria.quality) {
 			return "", time.Time{}, false
 		}
 		switch item.Status {
@@ -438,7 +651,7 @@ func completedSocialItemIsReusable(item models.ArchiveItem) bool {
 // capture row (plus archive items for full captures). It returns the new
 // short ID, the canonical capture when the new capture is an alias (nil for
 // full captures), and the number of archive items created.
-func createCapture(db *gorm.DB, url string, types []string, apiKeyID *uint, force bool) (string, *models.Capture, int, error) {
+func createCapture(db *gorm.DB, url string, types []string, apiKeyID *uint, force bool, quality utils.VideoQuality) (string, *models.Capture, int, error) {
 	canonical := utils.CanonicalizeArchiveURL(url)
 
 	var shortID string
@@ -452,7 +665,13 @@ func createCapture(db *gorm.DB, url string, types []string, apiKeyID *uint, forc
 		}
 
 		if !force {
-			aliasOf = findReusableCapture(tx, archivedURLIDs(rows), types)
+			aliasOf = findReusableCapture(tx, archivedURLIDs(rows), types, quality)
+		}
+
+		if aliasOf == nil {
+			if err := refuseUnavailableTypes(types); err != nil {
+				return err
+			}
 		}
 
 		// Find or create the ArchivedURL for this exact spelling.
@@ -491,9 +710,10 @@ func createCapture(db *gorm.DB, url string, types []string, apiKeyID *uint, forc
 		// Create archive items
 		for _, t := range types {
 			item := models.ArchiveItem{
-				CaptureID: capture.ID,
-				Type:      t,
-				Status:    "pending",
+				CaptureID:     capture.ID,
+				Type:          t,
+				Status:        "pending",
+				QualityPolicy: qualityPolicyFor(t, quality),
 			}
 			if err := tx.Create(&item).Error; err != nil {
 				slog.Error("Failed to create archive item",
@@ -518,7 +738,7 @@ func createCapture(db *gorm.DB, url string, types []string, apiKeyID *uint, forc
 // items cover every requested type with none of those items failed — or nil
 // when a full capture is required. Pending/processing items are acceptable:
 // their jobs are already in flight on the canonical capture.
-func findReusableCapture(tx *gorm.DB, archivedURLIDs []uint, types []string) *models.Capture {
+func findReusableCapture(tx *gorm.DB, archivedURLIDs []uint, types []string, quality utils.VideoQuality) *models.Capture {
 	if len(archivedURLIDs) == 0 {
 		return nil
 	}
@@ -539,7 +759,7 @@ func findReusableCapture(tx *gorm.DB, archivedURLIDs []uint, types []string) *mo
 	}
 
 	for i := range candidates {
-		if captureCoversTypes(&candidates[i], types) {
+		if captureCoversTypes(&candidates[i], types, quality) {
 			return &candidates[i]
 		}
 	}
@@ -547,19 +767,48 @@ func findReusableCapture(tx *gorm.DB, archivedURLIDs []uint, types []string) *mo
 }
 
 // captureCoversTypes reports whether the capture has an archive item for every
-// requested type and none of those items is failed. Types are compared in
+// requested type and none of those items is failed, each archived under a
+// quality policy that satisfies the requested one. Types are compared in
 // canonical form so rows still carrying a retired name (the startup rename
 // migration is best-effort) keep matching.
-func captureCoversTypes(c *models.Capture, types []string) bool {
-	byType := make(map[string]string, len(c.ArchiveItems))
+func captureCoversTypes(c *models.Capture, types []string, quality utils.VideoQuality) bool {
+	byType := make(map[string]models.ArchiveItem, len(c.ArchiveItems))
 	for _, item := range c.ArchiveItems {
-		byType[utils.NormalizeArchiveType(item.Type)] = item.Status
+		byType[utils.NormalizeArchiveType(item.Type)] = item
 	}
 	for _, t := range types {
-		status, ok := byType[utils.NormalizeArchiveType(t)]
-		if !ok || status == "failed" {
+		item, ok := byType[utils.NormalizeArchiveType(t)]
+		if !ok || item.Status == "failed" || !itemSatisfiesQuality(item, quality) {
 			return false
 		}
 	}
 	return true
 }
+
+// itemSatisfiesQuality reports whether an existing item answers a request for
+// quality. Types that ignore quality policies always do.
+func itemSatisfiesQuality(item models.ArchiveItem, quality utils.VideoQuality) bool {
+	if !utils.ArchiveTypeUsesVideoQuality(item.Type) {
+		return true
+	}
+	return utils.DecodeVideoQuality(item.QualityPolicy).Satisfies(quality)
+}
+
+// qualityPolicyFor is the QualityPolicy column value for a new item of typ.
+func qualityPolicyFor(typ string, quality utils.VideoQuality) string {
+	if !utils.ArchiveTypeUsesVideoQuality(typ) {
+		return ""
+	}
+	return utils.EncodeVideoQuality(quality)
+}
+
+// jobQuality is the Quality for an archive job of typ: nil for the default
+// policy and for types that ignore it, so their job args stay what they were
+// before policies existed and River's by-args uniqueness still matches them.
+func jobQuality(typ string, quality utils.VideoQuality) *utils.VideoQuality {
+	if !utils.ArchiveTypeUsesVideoQuality(typ) || quality.IsZero() {
+		return nil
+	}
+	quality = quality.Normalize()
+	return &quality
+}
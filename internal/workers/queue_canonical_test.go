@@ -331,7 +331,7 @@ func TestQueueCaptureAliasesAcrossSpellings(t *testing.T) {
 	db := newQueueTestDB(t)
 	canonical := seedCanonicalCapture(t, db, spellingShort, "freshone", time.Minute, map[string]string{"mhtml": "completed"})
 
-	shortID, aliasOf, createdItems, err := createCapture(db, spellingWatch, []string{"mhtml"}, nil, false)
+	shortID, aliasOf, createdItems, err := createCapture(db, spellingWatch, []string{"mhtml"}, nil, false, utils.VideoQuality{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -360,7 +360,7 @@ func TestQueueCaptureOrdinaryURLUnchanged(t *testing.T) {
 	url := "https://example.com/ordinary?x=1"
 	canonical := seedCanonicalCapture(t, db, url, "ordcanon", time.Minute, map[string]string{"mhtml": "completed", "screenshot": "completed"})
 
-	_, aliasOf, _, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false)
+	_, aliasOf, _, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false, utils.VideoQuality{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,98 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"arker/internal/models"
+	"arker/internal/utils"
+)
+
+const qualityTestURL = "https://www.youtube.com/watch?v=quality01"
+
+func TestFindOrCreateReusesOnlyASatisfyingQualityPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		archived  utils.VideoQuality
+		requested utils.VideoQuality
+		reuse     bool
+	}{
+		{"best answers best", utils.VideoQuality{}, utils.VideoQuality{}, true},
+		{"best answers 720p", utils.VideoQuality{}, utils.VideoQuality{MaxHeight: 720}, true},
+		{"720p does not answer best", utils.VideoQuality{MaxHeight: 720}, utils.VideoQuality{}, false},
+		{"1080p answers 720p", utils.VideoQuality{MaxHeight: 1080}, utils.VideoQuality{MaxHeight: 720}, true},
+		{"480p does not answer 720p", utils.VideoQuality{MaxHeight: 480}, utils.VideoQuality{MaxHeight: 720}, false},
+		{"video answers audio only", utils.VideoQuality{MaxHeight: 360}, utils.VideoQuality{AudioOnly: true}, true},
+		{"audio only does not answer video", utils.VideoQuality{AudioOnly: true}, utils.VideoQuality{MaxHeight: 360}, false},
+		{"codec preference must match", utils.VideoQuality{}, utils.VideoQuality{PreferCodec: "h264"}, false},
+		{"codec alias matches", utils.VideoQuality{PreferCodec: "avc1"}, utils.VideoQuality{PreferCodec: "h264"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newQueueTestDB(t)
+			capture := seedCapture(t, db, qualityTestURL, "vid01", time.Hour, map[string]string{utils.ArchiveTypeYtDlp: "completed"})
+			if err := db.Model(&models.ArchiveItem{}).Where("capture_id = ?", capture.ID).
+				Update("quality_policy", utils.EncodeVideoQuality(tt.archived)).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := FindOrCreateCaptureWithQuality(t.Context(), db, nil, qualityTestURL, []string{utils.ArchiveTypeYtDlp}, nil, tt.requested)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reused := got.Action == FindOrCreateFound; reused != tt.reuse {
+				t.Fatalf("action = %s, want reuse %v", got.Action, tt.reuse)
+			}
+			if tt.reuse {
+				return
+			}
+			var item models.ArchiveItem
+			if err := db.Joins("JOIN captures ON captures.id = archive_items.capture_id").
+				Where("captures.short_id = ?", got.ShortID).First(&item).Error; err != nil {
+				t.Fatal(err)
+			}
+			if decoded := utils.DecodeVideoQuality(item.QualityPolicy); decoded != tt.requested.Normalize() {
+				t.Errorf("new item policy = %+v, want %+v", decoded, tt.requested)
+			}
+		})
+	}
+}
+
+func TestCreateCaptureDoesNotAliasAWeakerQualityPolicy(t *testing.T) {
+	db := newQueueTestDB(t)
+	capture := seedCapture(t, db, qualityTestURL, "vid01", time.Hour, map[string]string{utils.ArchiveTypeYtDlp: "completed"})
+	db.Model(&models.ArchiveItem{}).Where("capture_id = ?", capture.ID).
+		Update("quality_policy", utils.EncodeVideoQuality(utils.VideoQuality{MaxHeight: 480}))
+
+	_, aliasOf, created, err := createCapture(db, qualityTestURL, []string{utils.ArchiveTypeYtDlp}, nil, false, utils.VideoQuality{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aliasOf != nil || created != 1 {
+		t.Fatalf("aliasOf = %v, created = %d; a 480p archive must not stand in for a best-quality request", aliasOf, created)
+	}
+
+	_, aliasOf, _, err = createCapture(db, qualityTestURL, []string{utils.ArchiveTypeYtDlp}, nil, false, utils.VideoQuality{MaxHeight: 360})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aliasOf == nil {
+		t.Fatal("a 360p request should alias an existing capture")
+	}
+}
+
+func TestJobQualityOnlyForTypesThatHonorIt(t *testing.T) {
+	quality := utils.VideoQuality{MaxHeight: 720}
+	if got := jobQuality(utils.ArchiveTypeYtDlp, quality); got == nil || *got != quality {
+		t.Errorf("yt-dlp job quality = %v", got)
+	}
+	if got := jobQuality(utils.ArchiveTypeScreenshot, quality); got != nil {
+		t.Errorf("screenshot job carries a quality policy: %+v", got)
+	}
+	if got := jobQuality(utils.ArchiveTypeYtDlp, utils.VideoQuality{}); got != nil {
+		t.Errorf("the default policy must leave job args unchanged, got %+v", got)
+	}
+	if got := qualityPolicyFor(utils.ArchiveTypeMHTML, quality); got != "" {
+		t.Errorf("mhtml item policy = %q", got)
+	}
+}
@@ -1,6 +1,7 @@
 package workers
 
 import (
+	"errors"
 	"fmt"
 	"sync/atomic"
 	"testing"
@@ -68,7 +69,7 @@ func TestCreateCaptureAliasesFreshCapture(t *testing.T) {
 	url := "https://example.com/page"
 	canonical := seedCapture(t, db, url, "canon", time.Hour, map[string]string{"mhtml": "completed", "screenshot": "completed"})
 
-	shortID, aliasOf, createdItems, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false)
+	shortID, aliasOf, createdItems, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false, utils.VideoQuality{})
 	if err != nil {
 		t.Fatalf("createCapture: %v", err)
 	}
@@ -105,7 +106,7 @@ func TestCreateCaptureForceBypassesAlias(t *testing.T) {
 	url := "https://example.com/page"
 	seedCapture(t, db, url, "canon", time.Hour, map[string]string{"mhtml": "completed", "screenshot": "completed"})
 
-	_, aliasOf, createdItems, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, true)
+	_, aliasOf, createdItems, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, true, utils.VideoQuality{})
 	if err != nil {
 		t.Fatalf("createCapture: %v", err)
 	}
@@ -122,7 +123,7 @@ func TestCreateCaptureNoAliasWhenTypeFailed(t *testing.T) {
 	url := "https://example.com/page"
 	seedCapture(t, db, url, "canon", time.Hour, map[string]string{"mhtml": "failed", "screenshot": "completed"})
 
-	_, aliasOf, _, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false)
+	_, aliasOf, _, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false, utils.VideoQuality{})
 	if err != nil {
 		t.Fatalf("createCapture: %v", err)
 	}
@@ -136,7 +137,7 @@ func TestCreateCaptureNoAliasWhenTypeMissing(t *testing.T) {
 	url := "https://example.com/page"
 	seedCapture(t, db, url, "canon", time.Hour, map[string]string{"mhtml": "completed"})
 
-	_, aliasOf, _, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false)
+	_, aliasOf, _, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false, utils.VideoQuality{})
 	if err != nil {
 		t.Fatalf("createCapture: %v", err)
 	}
@@ -150,7 +151,7 @@ func TestCreateCaptureNoAliasWhenStale(t *testing.T) {
 	url := "https://example.com/page"
 	seedCapture(t, db, url, "canon", 25*time.Hour, map[string]string{"mhtml": "completed", "screenshot": "completed"})
 
-	_, aliasOf, _, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false)
+	_, aliasOf, _, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false, utils.VideoQuality{})
 	if err != nil {
 		t.Fatalf("createCapture: %v", err)
 	}
@@ -168,7 +169,7 @@ func TestCreateCaptureRespectsConfiguredWindow(t *testing.T) {
 		t.Fatalf("set config: %v", err)
 	}
 
-	_, aliasOf, _, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false)
+	_, aliasOf, _, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false, utils.VideoQuality{})
 	if err != nil {
 		t.Fatalf("createCapture: %v", err)
 	}
@@ -186,7 +187,7 @@ func TestCreateCaptureAliasingDisabledByZeroWindow(t *testing.T) {
 		t.Fatalf("set config: %v", err)
 	}
 
-	_, aliasOf, _, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false)
+	_, aliasOf, _, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false, utils.VideoQuality{})
 	if err != nil {
 		t.Fatalf("createCapture: %v", err)
 	}
@@ -201,7 +202,7 @@ func TestCreateCaptureNeverAliasesToAnAlias(t *testing.T) {
 	canonical := seedCapture(t, db, url, "canon", 2*time.Hour, map[string]string{"mhtml": "completed", "screenshot": "completed"})
 
 	// First submission becomes an alias of canonical.
-	_, aliasOf, _, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false)
+	_, aliasOf, _, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false, utils.VideoQuality{})
 	if err != nil {
 		t.Fatalf("first createCapture: %v", err)
 	}
@@ -210,7 +211,7 @@ func TestCreateCaptureNeverAliasesToAnAlias(t *testing.T) {
 	}
 
 	// Second submission must also point at canonical, not at the newer alias.
-	_, aliasOf2, _, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false)
+	_, aliasOf2, _, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false, utils.VideoQuality{})
 	if err != nil {
 		t.Fatalf("second createCapture: %v", err)
 	}
@@ -224,7 +225,7 @@ func TestCreateCaptureAliasAllowsPendingItems(t *testing.T) {
 	url := "https://example.com/page"
 	canonical := seedCapture(t, db, url, "canon", time.Minute, map[string]string{"mhtml": "pending", "screenshot": "processing"})
 
-	_, aliasOf, _, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false)
+	_, aliasOf, _, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false, utils.VideoQuality{})
 	if err != nil {
 		t.Fatalf("createCapture: %v", err)
 	}
@@ -256,6 +257,52 @@ func TestFindOrCreateReturnsOldSuccessfulCapture(t *testing.T) {
 	}
 }
 
+// A default request for a URL already captured is answered without probing
+// it, whichever type list the earlier probe chose.
+func TestDefaultTypesSkipProbeWhenACaptureAnswers(t *testing.T) {
+	db := newQueueTestDB(t)
+	probes := 0
+	utils.SetRemoteContentProbe(func(string) string {
+		probes++
+		return "application/pdf"
+	})
+	t.Cleanup(func() { utils.SetRemoteContentProbe(nil) })
+	seedCapture(t, db, "https://example.com/report", "rprt1", time.Hour, map[string]string{"file": "completed"})
+	seedCapture(t, db, "https://example.com/page", "page1", time.Hour, map[string]string{"mhtml": "completed", "screenshot": "completed"})
+
+	got, err := FindOrCreateCapture(t.Context(), db, nil, "https://example.com/report", nil, nil)
+	if err != nil || got.Action != FindOrCreateFound || got.ShortID != "rprt1" {
+		t.Fatalf("report = %+v, %v", got, err)
+	}
+	got, err = FindOrCreateCapture(t.Context(), db, nil, "https://example.com/page", nil, nil)
+	if err != nil || got.Action != FindOrCreateFound || got.ShortID != "page1" {
+		t.Fatalf("page = %+v, %v", got, err)
+	}
+	shortID, err := QueueCapture(t.Context(), db, nil, "https://example.com/report", nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alias models.Capture
+	db.Where("short_id = ?", shortID).First(&alias)
+	if alias.AliasOfID == nil {
+		t.Errorf("capture %s is not an alias of the fresh one", shortID)
+	}
+	if probes != 0 {
+		t.Errorf("probed %d times for URLs already captured", probes)
+	}
+
+	// Never captured: the probe decides.
+	got, err = FindOrCreateCapture(t.Context(), db, nil, "https://example.com/other", nil, nil)
+	if err != nil || got.Action != FindOrCreateCreated || probes != 1 {
+		t.Fatalf("new URL = %+v, %v after %d probes", got, err, probes)
+	}
+	var item models.ArchiveItem
+	db.Joins("JOIN captures ON captures.id = archive_items.capture_id").Where("captures.short_id = ?", got.ShortID).First(&item)
+	if item.Type != "file" {
+		t.Errorf("new URL captured as %s", item.Type)
+	}
+}
+
 func TestFindOrCreateNewestCompletionWins(t *testing.T) {
 	db := newQueueTestDB(t)
 	url := "https://example.com/newest"
@@ -446,3 +493,65 @@ func TestFindOrCreateIgnoresAliases(t *testing.T) {
 		t.Fatalf("result = %+v", got)
 	}
 }
+
+// browserDown installs a health hook reporting the browser archive types down.
+func browserDown(t *testing.T) {
+	t.Helper()
+	utils.SetArchiveTypeHealth(func(archiveType string) (string, bool) {
+		if archiveType == "screenshot" {
+			return "playwright: failed to launch Chromium", true
+		}
+		return "", false
+	})
+	t.Cleanup(func() { utils.SetArchiveTypeHealth(nil) })
+}
+
+func TestCreateCaptureRefusesTypesWhoseDependencyIsDown(t *testing.T) {
+	db := newQueueTestDB(t)
+	browserDown(t)
+
+	_, _, _, err := createCapture(db, "https://example.com/down", []string{"mhtml", "screenshot"}, nil, true, utils.VideoQuality{})
+	var unavailable *UnavailableTypesError
+	if !errors.As(err, &unavailable) || unavailable.Reasons["screenshot"] != "playwright: failed to launch Chromium" || len(unavailable.Reasons) != 1 {
+		t.Fatalf("err = %v, want screenshot refused", err)
+	}
+	var captures, urls int64
+	db.Model(&models.Capture{}).Count(&captures)
+	db.Model(&models.ArchivedURL{}).Count(&urls)
+	if captures != 0 || urls != 0 {
+		t.Errorf("a refused request left %d captures and %d URLs behind", captures, urls)
+	}
+
+	if _, _, created, err := createCapture(db, "https://example.com/down", []string{"mhtml"}, nil, true, utils.VideoQuality{}); err != nil || created != 1 {
+		t.Errorf("an available type was refused: created=%d err=%v", created, err)
+	}
+}
+
+// An alias queues nothing, so there is nothing to refuse.
+func TestCreateCaptureStillAliasesWhileADependencyIsDown(t *testing.T) {
+	db := newQueueTestDB(t)
+	url := "https://example.com/page"
+	seedCapture(t, db, url, "canon", time.Hour, map[string]string{"mhtml": "completed", "screenshot": "completed"})
+	browserDown(t)
+
+	_, aliasOf, _, err := createCapture(db, url, []string{"mhtml", "screenshot"}, nil, false, utils.VideoQuality{})
+	if err != nil || aliasOf == nil {
+		t.Fatalf("alias = %v, err = %v; want an alias of the fresh capture", aliasOf, err)
+	}
+}
+
+func TestFindOrCreateRefusesOnlyWhenItWouldCreate(t *testing.T) {
+	db := newQueueTestDB(t)
+	seedCapture(t, db, "https://example.com/done", "done1", time.Hour, map[string]string{"mhtml": "completed", "screenshot": "completed"})
+	browserDown(t)
+
+	got, err := FindOrCreateCapture(t.Context(), db, nil, "https://example.com/done", []string{"mhtml", "screenshot"}, nil)
+	if err != nil || got.Action != FindOrCreateFound {
+		t.Fatalf("existing capture = %+v, %v; want found", got, err)
+	}
+	_, err = FindOrCreateCapture(t.Context(), db, nil, "https://example.com/new", []string{"mhtml", "screenshot"}, nil)
+	var unavailable *UnavailableTypesError
+	if !errors.As(err, &unavailable) {
+		t.Fatalf("err = %v, want UnavailableTypesError", err)
+	}
+}
@@ -0,0 +1,138 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+
+	"arker/internal/archivers"
+	"arker/internal/models"
+	"arker/internal/reader"
+	"arker/internal/storage"
+	"arker/internal/utils"
+)
+
+// ReaderJobArgs is the payload for extracting the reader-mode article from an
+// mhtml item that was captured before extraction existed.
+type ReaderJobArgs struct {
+	ShortID string `json:"short_id"`
+}
+
+// Kind returns the job kind for River.
+func (ReaderJobArgs) Kind() string { return "reader" }
+
+// ReaderWorker extracts the article text from a stored MHTML snapshot.
+//
+// Like ThumbnailWorker it only serves the backlog: new captures extract from
+// the live page inline. It is enqueued on demand by the reader endpoints and
+// the archive result API the first time somebody asks for an article that
+// has not been extracted yet.
+type ReaderWorker struct {
+	river.WorkerDefaults[ReaderJobArgs]
+	storage storage.Storage
+	db      *gorm.DB
+}
+
+// NewReaderWorker creates a new reader extraction worker.
+func NewReaderWorker(store storage.Storage, db *gorm.DB) *ReaderWorker {
+	return &ReaderWorker{storage: store, db: db}
+}
+
+// Work extracts and stores one article.
+func (w *ReaderWorker) Work(ctx context.Context, job *river.Job[ReaderJobArgs]) error {
+	return w.extract(ctx, job.Args)
+}
+
+// extract is Work without the River envelope, so it can be exercised directly.
+//
+// A snapshot that cannot be parsed still gets a sidecar, recorded as not
+// readable: the bytes will not change, and an item without a sidecar would be
+// enqueued again by the next request for it.
+func (w *ReaderWorker) extract(ctx context.Context, args ReaderJobArgs) error {
+	logger := slog.With("worker", "reader", "short_id", args.ShortID)
+
+	var item models.ArchiveItem
+	if err := w.db.Joins("JOIN captures ON archive_items.capture_id = captures.id").
+		Where("captures.short_id = ? AND archive_items.type = ?", args.ShortID, utils.ArchiveTypeMHTML).
+		First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.Warn("MHTML item no longer exists; dropping reader job")
+			return nil
+		}
+		return fmt.Errorf("reader: finding mhtml item for %s: %w", args.ShortID, err)
+	}
+	if item.MetadataKey != "" {
+		logger.Debug("Reader article already present; nothing to do")
+		return nil
+	}
+	if item.Status != "completed" || item.StorageKey == "" {
+		logger.Debug("MHTML item not completed; skipping reader extraction")
+		return nil
+	}
+
+	// The snapshot records the URL it was taken from; the capture's URL is only
+	// a fallback for resolving relative links when it does not.
+	var capture models.Capture
+	w.db.Preload("ArchivedURL").First(&capture, item.CaptureID)
+
+	stored, err := w.storage.Reader(item.StorageKey)
+	if err != nil {
+		return fmt.Errorf("reader: opening %s: %w", item.StorageKey, err)
+	}
+	document, location, err := utils.NewStreamingConverter().MainDocument(stored)
+	stored.Close()
+
+	var article *reader.Article
+	if err == nil {
+		if location == "" {
+			location = capture.ArchivedURL.Original
+		}
+		article, err = reader.Extract(bytes.NewReader(document), location, reader.SourceMHTML)
+	}
+	if err != nil {
+		logger.Info("Stored snapshot has no extractable document", "error", err)
+		article = &reader.Article{Source: reader.SourceMHTML, ExtractedAt: time.Now().UTC().Format(time.RFC3339)}
+	}
+
+	data, err := archivers.EncodeReaderArticle(article)
+	if err != nil {
+		return fmt.Errorf("reader: encoding article: %w", err)
+	}
+	key := fmt.Sprintf("%s/%s-%s.metadata.json", args.ShortID, utils.ArchiveTypeMHTML, uploadNonce())
+	if err := writeJSONSidecar(w.storage, key, data); err != nil {
+		return fmt.Errorf("reader: storing %s: %w", key, err)
+	}
+	if err := w.db.Model(&item).Update("metadata_key", key).Error; err != nil {
+		return fmt.Errorf("reader: recording %s: %w", key, err)
+	}
+
+	logger.Info("Reader article extracted", "key", key, "readable", article.Readable, "words", article.WordCount)
+	return nil
+}
+
+// EnqueueReader requests extraction of the reader-mode article for a capture's
+// mhtml item. Safe to call on every request that finds no article.
+func EnqueueReader(ctx context.Context, riverClient *river.Client[pgx.Tx], shortID string) error {
+	if riverClient == nil {
+		return nil
+	}
+	_, err := riverClient.Insert(ctx, ReaderJobArgs{ShortID: shortID}, &river.InsertOpts{
+		// Parsing one HTML document is cheap next to an archive job, and the
+		// caller is usually waiting on the page to refresh.
+		Queue:       "high_priority",
+		MaxAttempts: 2,
+		Tags:        []string{"reader"},
+		UniqueOpts: river.UniqueOpts{
+			ByArgs:   true,
+			ByPeriod: 5 * time.Minute,
+		},
+	})
+	return err
+}
@@ -0,0 +1,128 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"arker/internal/reader"
+	"arker/internal/storage"
+)
+
+// readerSnapshot is a minimal Chromium-style MHTML: the page first, quoted-
+// printable, followed by a resource the extraction must never need.
+func readerSnapshot(body string) string {
+	return "From: <Saved by Blink>\r\n" +
+		"Snapshot-Content-Location: https://blog.example/posts/tides\r\n" +
+		"Subject: Tides\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/related;\r\n\ttype=\"text/html\";\r\n\tboundary=\"----MultipartBoundary--x\"\r\n" +
+		"\r\n" +
+		"------MultipartBoundary--x\r\n" +
+		"Content-Type: text/html\r\n" +
+		"Content-ID: <frame-1@mhtml.blink>\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"Content-Location: https://blog.example/posts/tides\r\n" +
+		"\r\n" + body + "\r\n" +
+		"------MultipartBoundary--x\r\n" +
+		"Content-Type: image/png\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"Content-Location: https://blog.example/logo.png\r\n" +
+		"\r\n" +
+		"iVBORw0KGgo=\r\n" +
+		"------MultipartBoundary--x--\r\n"
+}
+
+func readerStoredArticle(t *testing.T, store storage.Storage, key string) reader.Article {
+	t.Helper()
+	r, err := store.Reader(key)
+	if err != nil {
+		t.Fatalf("open sidecar %s: %v", key, err)
+	}
+	defer r.Close()
+	data, _ := io.ReadAll(r)
+	var article reader.Article
+	if err := json.Unmarshal(data, &article); err != nil {
+		t.Fatalf("sidecar is not an article: %v", err)
+	}
+	return article
+}
+
+func TestReaderWorkerExtractsFromStoredMHTML(t *testing.T) {
+	db := newWorkerTestDB(t)
+	store := storage.NewMemoryStorage()
+
+	paragraph := strings.Repeat("The tide tables for the estuary were first printed in the harbour office. ", 8)
+	body := `<html><head><title>Reading the tides</title><meta name=3D"author" content=3D"Sam Lee"></head>` +
+		`<body><nav><a href=3D"/">Home</a></nav><article><h1>Reading the tides</h1>` +
+		`<p>` + paragraph + `</p><p><a href=3D"/posts/currents">More on currents</a> ` + paragraph + `</p></article></body></html>`
+	putObject(t, store, "tides/mhtml-a.mhtml", []byte(readerSnapshot(body)))
+	item := seedItem(t, db, "tides", "mhtml", "completed", "tides/mhtml-a.mhtml")
+
+	w := NewReaderWorker(store, db)
+	if err := w.extract(context.Background(), ReaderJobArgs{ShortID: "tides"}); err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+
+	got := reload(t, db, item.ID)
+	if got.MetadataKey == "" {
+		t.Fatal("metadata_key was not recorded")
+	}
+	article := readerStoredArticle(t, store, got.MetadataKey)
+	if !article.Readable || article.Title != "Reading the tides" || article.Byline != "Sam Lee" {
+		t.Fatalf("article = %+v", article)
+	}
+	if article.Source != reader.SourceMHTML {
+		t.Errorf("source = %q, want %q", article.Source, reader.SourceMHTML)
+	}
+	// Relative links resolve against the snapshot's own location.
+	if !strings.Contains(article.HTML, `href="https://blog.example/posts/currents"`) {
+		t.Errorf("html does not carry the absolute link: %s", article.HTML)
+	}
+
+	// A second run finds the sidecar and leaves it alone.
+	if err := w.extract(context.Background(), ReaderJobArgs{ShortID: "tides"}); err != nil {
+		t.Fatalf("second extract: %v", err)
+	}
+	if again := reload(t, db, item.ID); again.MetadataKey != got.MetadataKey {
+		t.Errorf("metadata_key changed from %q to %q", got.MetadataKey, again.MetadataKey)
+	}
+}
+
+// A snapshot that cannot be parsed is recorded as unreadable rather than left
+// without a sidecar, which would queue it again on every request.
+func TestReaderWorkerRecordsUnparseableSnapshot(t *testing.T) {
+	db := newWorkerTestDB(t)
+	store := storage.NewMemoryStorage()
+	putObject(t, store, "junk1/mhtml-a.mhtml", []byte("not a mime message at all"))
+	item := seedItem(t, db, "junk1", "mhtml", "completed", "junk1/mhtml-a.mhtml")
+
+	if err := NewReaderWorker(store, db).extract(context.Background(), ReaderJobArgs{ShortID: "junk1"}); err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	got := reload(t, db, item.ID)
+	if got.MetadataKey == "" {
+		t.Fatal("metadata_key was not recorded")
+	}
+	if article := readerStoredArticle(t, store, got.MetadataKey); article.Readable {
+		t.Errorf("article = %+v, want unreadable", article)
+	}
+}
+
+func TestReaderWorkerSkipsIncompleteItems(t *testing.T) {
+	db := newWorkerTestDB(t)
+	store := storage.NewMemoryStorage()
+	item := seedItem(t, db, "pend1", "mhtml", "processing", "")
+
+	if err := NewReaderWorker(store, db).extract(context.Background(), ReaderJobArgs{ShortID: "pend1"}); err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if got := reload(t, db, item.ID); got.MetadataKey != "" {
+		t.Errorf("metadata_key = %q for an incomplete item", got.MetadataKey)
+	}
+	if err := NewReaderWorker(store, db).extract(context.Background(), ReaderJobArgs{ShortID: "gone1"}); err != nil {
+		t.Errorf("missing item should drop the job, got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"github.com/riverqueue/river/rivertype"
+
+	"arker/internal/storage"
+)
+
+// ReplicationQueue is the queue replica repairs run on, one at a time.
+const ReplicationQueue = "replication"
+
+// ReplicaRepairJobArgs is the payload for one pass of replica repair. A
+// backfill pass first records every object on the primary that a secondary
+// has no row for.
+type ReplicaRepairJobArgs struct {
+	Backfill bool `json:"backfill,omitempty"`
+}
+
+// Kind returns the job kind for River.
+func (ReplicaRepairJobArgs) Kind() string { return "replica_repair" }
+
+// ReplicaRepairWorker copies objects to the storage backends missing them.
+type ReplicaRepairWorker struct {
+	river.WorkerDefaults[ReplicaRepairJobArgs]
+	storage *storage.ReplicatedStorage
+	// batch is how many replicas one pass repairs.
+	batch int
+}
+
+// NewReplicaRepairWorker creates a new replica repair worker. With a nil
+// store (replication off) it drops the jobs it is given.
+func NewReplicaRepairWorker(store *storage.ReplicatedStorage, batch int) *ReplicaRepairWorker {
+	if batch <= 0 {
+		batch = 200
+	}
+	return &ReplicaRepairWorker{storage: store, batch: batch}
+}
+
+// Work runs one repair pass.
+func (w *ReplicaRepairWorker) Work(ctx context.Context, job *river.Job[ReplicaRepairJobArgs]) error {
+	return w.repair(ctx, job.Args)
+}
+
+// repair is Work without the River envelope, so it can be exercised directly.
+func (w *ReplicaRepairWorker) repair(ctx context.Context, args ReplicaRepairJobArgs) error {
+	if w.storage == nil {
+		// Queued before STORAGE_REPLICAS was unset.
+		slog.Info("Storage replication is off; dropping replica repair job")
+		return nil
+	}
+	if args.Backfill {
+		walked, err := w.storage.Backfill(ctx)
+		if err != nil {
+			return err
+		}
+		slog.Info("Replica backfill finished", "objects", walked)
+	}
+	result, err := w.storage.Repair(ctx, w.batch)
+	if err != nil {
+		return err
+	}
+	if result.Repaired > 0 || result.Failed > 0 {
+		slog.Info("Replica repair pass finished", "repaired", result.Repaired, "failed", result.Failed)
+	}
+	return nil
+}
+
+// NewReplicaRepairPeriodicJob schedules a repair pass every interval.
+func NewReplicaRepairPeriodicJob(interval time.Duration) *river.PeriodicJob {
+	return river.NewPeriodicJob(
+		river.PeriodicInterval(interval),
+		func() (river.JobArgs, *river.InsertOpts) {
+			return ReplicaRepairJobArgs{}, replicaRepairInsertOpts()
+		},
+		nil,
+	)
+}
+
+// EnqueueReplicaBackfill requests a backfill and repair pass, which main runs
+// at startup so a newly added secondary is filled.
+func EnqueueReplicaBackfill(ctx context.Context, riverClient *river.Client[pgx.Tx]) error {
+	if riverClient == nil {
+		return nil
+	}
+	_, err := riverClient.Insert(ctx, ReplicaRepairJobArgs{Backfill: true}, replicaRepairInsertOpts())
+	return err
+}
+
+// EnqueueReplicaRepair requests a repair pass, which main does whenever a
+// write leaves copies pending. A pass already queued absorbs the request.
+func EnqueueReplicaRepair(ctx context.Context, riverClient *river.Client[pgx.Tx]) error {
+	if riverClient == nil {
+		return nil
+	}
+	_, err := riverClient.Insert(ctx, ReplicaRepairJobArgs{}, replicaRepairInsertOpts())
+	return err
+}
+
+func replicaRepairInsertOpts() *river.InsertOpts {
+	return &river.InsertOpts{
+		Queue: ReplicationQueue,
+		// The next pass retries whatever this one could not copy.
+		MaxAttempts: 1,
+		Tags:        []string{"replication"},
+		UniqueOpts: river.UniqueOpts{
+			ByArgs: true,
+			ByState: []rivertype.JobState{
+				rivertype.JobStateAvailable,
+				rivertype.JobStatePending,
+				rivertype.JobStateRunning,
+				rivertype.JobStateScheduled,
+				rivertype.JobStateRetryable,
+			},
+		},
+	}
+}
@@ -0,0 +1,34 @@
+package workers
+
+import (
+	"context"
+	"testing"
+
+	"arker/internal/models"
+	"arker/internal/storage"
+)
+
+func TestReplicaRepairWorkerBackfillsSecondary(t *testing.T) {
+	db := newWorkerTestDB(t)
+	if err := db.AutoMigrate(&models.StorageReplica{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	primary, secondary := storage.NewMemoryStorage(), storage.NewMemoryStorage()
+	putObject(t, primary, "abc12/mhtml-aa.mhtml", []byte("page"))
+	store := storage.NewReplicatedStorage(db,
+		storage.Backend{Name: "primary", Storage: primary},
+		storage.Backend{Name: "secondary", Storage: secondary})
+
+	w := NewReplicaRepairWorker(store, 0)
+	if err := w.repair(context.Background(), ReplicaRepairJobArgs{Backfill: true}); err != nil {
+		t.Fatalf("repair: %v", err)
+	}
+	if got := readObject(t, secondary, "abc12/mhtml-aa.mhtml"); string(got) != "page" {
+		t.Errorf("secondary holds %q", got)
+	}
+
+	// Replication turned off with jobs still queued.
+	if err := NewReplicaRepairWorker(nil, 0).repair(context.Background(), ReplicaRepairJobArgs{}); err != nil {
+		t.Errorf("a job for disabled replication failed: %v", err)
+	}
+}
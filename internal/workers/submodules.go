@@ -0,0 +1,184 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+
+	"arker/internal/archivers"
+	"arker/internal/models"
+	"arker/internal/utils"
+)
+
+// submoduleChildTypes is what each submodule is captured as: its repository,
+// not the web pages of a project the parent merely depends on.
+var submoduleChildTypes = []string{utils.ArchiveTypeGit}
+
+// maxSubmoduleAncestry bounds the walk from a capture up to the capture its
+// chain of submodules started from.
+const maxSubmoduleAncestry = 32
+
+// expandSubmodules creates a child capture and a GitSubmodule row for every
+// submodule of a git capture. Like expandPlaylist it is idempotent per path,
+// so a retried job does not queue a submodule twice, and first queues again
+// any submodule an earlier attempt created but could not queue.
+func expandSubmodules(ctx context.Context, db *gorm.DB, riverClient *river.Client[pgx.Tx], item *models.ArchiveItem, submodules []archivers.GitSubmoduleRef, logWriter io.Writer) error {
+	var parent models.Capture
+	if err := db.First(&parent, item.CaptureID).Error; err != nil {
+		return fmt.Errorf("load git capture: %w", err)
+	}
+
+	var existing []models.GitSubmodule
+	if err := db.Where("parent_capture_id = ?", parent.ID).Find(&existing).Error; err != nil {
+		return fmt.Errorf("load git submodules: %w", err)
+	}
+	done := make(map[string]bool, len(existing))
+	children := make(map[uint]string, len(existing))
+	for _, s := range existing {
+		done[s.Path] = true
+		children[s.ChildCaptureID] = s.URL
+	}
+	requeued, err := requeuePendingChildren(ctx, db, riverClient, children)
+	if err != nil {
+		return err
+	}
+	if requeued > 0 {
+		fmt.Fprintf(logWriter, "Queued %d submodules from an earlier attempt again\n", requeued)
+	}
+	since, err := submoduleRootTimestamp(db, parent)
+	if err != nil {
+		return fmt.Errorf("find the capture submodules descend from: %w", err)
+	}
+
+	var created, aliased int
+	for _, sub := range submodules {
+		if done[sub.Path] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		shortID, aliasOf, err := createSubmoduleChild(db, parent, sub, since)
+		if err != nil {
+			return fmt.Errorf("queue submodule %s (%s): %w", sub.Path, sub.URL, err)
+		}
+		if aliasOf != nil {
+			aliased++
+			fmt.Fprintf(logWriter, "Submodule %s: %s already captured as %s, aliased as %s\n", sub.Path, sub.URL, aliasOf.ShortID, shortID)
+			continue
+		}
+		created++
+		fmt.Fprintf(logWriter, "Submodule %s: %s queued as %s\n", sub.Path, sub.URL, shortID)
+		if riverClient != nil { // nil in tests that only exercise the database side.
+			if err := enqueueChildCaptureJobs(ctx, riverClient, shortID, sub.URL, submoduleChildTypes, utils.VideoQuality{}); err != nil {
+				return fmt.Errorf("queue submodule %s (%s): %w", sub.Path, sub.URL, err)
+			}
+		}
+	}
+
+	fmt.Fprintf(logWriter, "Submodules expanded: %d queued, %d already captured, %d from an earlier attempt\n",
+		created, aliased, len(existing))
+	slog.Info("Expanded git submodules",
+		"short_id", parent.ShortID,
+		"submodules", len(submodules),
+		"queued", created,
+		"aliased", aliased)
+	return nil
+}
+
+// submoduleRootTimestamp is when the capture a chain of submodules started
+// from was taken: the capture itself unless it is some capture's submodule.
+func submoduleRootTimestamp(db *gorm.DB, capture models.Capture) (time.Time, error) {
+	since := capture.Timestamp
+	id := capture.ID
+	for range maxSubmoduleAncestry {
+		var link models.GitSubmodule
+		err := db.Where("child_capture_id = ?", id).First(&link).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			break
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		var parent models.Capture
+		if err := db.First(&parent, link.ParentCaptureID).Error; err != nil {
+			return time.Time{}, err
+		}
+		if parent.Timestamp.Before(since) {
+			since = parent.Timestamp
+		}
+		id = parent.ID
+	}
+	return since, nil
+}
+
+// createSubmoduleChild creates the child capture for one submodule and its
+// GitSubmodule row in one transaction, serialized on the repository's
+// identity. A capture of the repository still in flight, or completed but
+// taken no earlier than since, is aliased rather than fetched again; an
+// older one may predate the commit the parent pins.
+func createSubmoduleChild(db *gorm.DB, parent models.Capture, sub archivers.GitSubmoduleRef, since time.Time) (string, *models.Capture, error) {
+	canonical := utils.CanonicalizeArchiveURL(sub.URL)
+	criteria := findOrCreateCriteria{types: submoduleChildTypes}
+
+	var shortID string
+	var aliasOf *models.Capture
+	err := withCaptureIdentityLock(db, canonical, func(tx *gorm.DB) error {
+		rows, exact, err := loadIdentityRows(tx, sub.URL, canonical)
+		if err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			candidate, status, err := findFindOrCreateCandidate(tx, archivedURLIDs(rows), criteria)
+			if err != nil {
+				return err
+			}
+			if candidate != nil && (status != "completed" || !candidate.Timestamp.Before(since)) {
+				aliasOf = candidate
+			}
+		}
+		if aliasOf == nil {
+			if err := refuseUnavailableTypes(submoduleChildTypes); err != nil {
+				return err
+			}
+		}
+
+		archivedURL, err := ensureArchivedURL(tx, sub.URL, canonical, exact)
+		if err != nil {
+			return err
+		}
+		shortID = utils.GenerateShortID(tx)
+		child := models.Capture{ArchivedURLID: archivedURL.ID, Timestamp: time.Now(), ShortID: shortID, APIKeyID: parent.APIKeyID}
+		if aliasOf != nil {
+			child.AliasOfID = &aliasOf.ID
+		}
+		if err := tx.Create(&child).Error; err != nil {
+			return err
+		}
+		if aliasOf == nil {
+			for _, typ := range submoduleChildTypes {
+				if err := tx.Create(&models.ArchiveItem{CaptureID: child.ID, Type: typ, Status: "pending"}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Create(&models.GitSubmodule{
+			ParentCaptureID: parent.ID,
+			Path:            sub.Path,
+			URL:             sub.URL,
+			Commit:          sub.Commit,
+			ChildCaptureID:  child.ID,
+		}).Error
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return shortID, aliasOf, nil
+}
@@ -0,0 +1,106 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"arker/internal/archivers"
+	"arker/internal/models"
+	"arker/internal/storage"
+	"arker/internal/utils"
+)
+
+// submoduleArchiver returns a repository with fixed submodules, as
+// GitArchiver would after cloning it.
+type submoduleArchiver struct{ submodules []archivers.GitSubmoduleRef }
+
+func (s submoduleArchiver) Archive(ctx context.Context, url string, logWriter io.Writer, db *gorm.DB, itemID uint) (archivers.Result, error) {
+	return archivers.Result{Data: bytes.NewReader([]byte("tar")), Extension: ".tar", Submodules: s.submodules}, nil
+}
+
+func TestGitJobCapturesSubmodules(t *testing.T) {
+	db := newWorkerTestDB(t)
+	if err := db.AutoMigrate(&models.GitSubmodule{}, &models.Config{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	const parentURL = "https://github.com/owner/app"
+	stale := seedCapture(t, db, "https://github.com/owner/stale", "stale", 30*24*time.Hour,
+		map[string]string{utils.ArchiveTypeGit: "completed"})
+	inFlight := seedCapture(t, db, "https://github.com/owner/busy", "busy1", time.Minute,
+		map[string]string{utils.ArchiveTypeGit: "pending"})
+	parent := seedCapture(t, db, parentURL, "app01", time.Hour,
+		map[string]string{utils.ArchiveTypeGit: "processing"})
+	var item models.ArchiveItem
+	db.Where("capture_id = ?", parent.ID).First(&item)
+
+	submodules := []archivers.GitSubmoduleRef{
+		{Path: "lib/new", URL: "https://github.com/owner/new", Commit: "1111"},
+		{Path: "lib/stale", URL: "https://github.com/owner/stale", Commit: "2222"},
+		{Path: "lib/busy", URL: "https://github.com/owner/busy", Commit: "3333"},
+		{Path: "lib/self", URL: parentURL, Commit: "4444"},
+	}
+	m := map[string]archivers.Archiver{utils.ArchiveTypeGit: submoduleArchiver{submodules}}
+	args := ArchiveJobArgs{ShortID: "app01", Type: utils.ArchiveTypeGit, URL: parentURL}
+	if err := processArchiveJob(context.Background(), args, &item, storage.NewMemoryStorage(), db, m); err != nil {
+		t.Fatalf("processArchiveJob: %v", err)
+	}
+
+	var rows []models.GitSubmodule
+	db.Where("parent_capture_id = ?", parent.ID).Preload("ChildCapture.ArchiveItems").Find(&rows)
+	if len(rows) != 4 {
+		t.Fatalf("%d submodule rows, want 4", len(rows))
+	}
+	// An older capture may predate the pinned commit; one in flight, or the
+	// parent itself, will hold what is there now.
+	wantAlias := map[string]*models.Capture{"lib/new": nil, "lib/stale": nil, "lib/busy": &inFlight, "lib/self": &parent}
+	var fresh models.Capture
+	for _, row := range rows {
+		child := row.ChildCapture
+		want := wantAlias[row.Path]
+		switch {
+		case want != nil && (child.AliasOfID == nil || *child.AliasOfID != want.ID):
+			t.Errorf("%s: alias of %v, want %s", row.Path, child.AliasOfID, want.ShortID)
+		case want == nil && (child.AliasOfID != nil || len(child.ArchiveItems) != 1 || child.ArchiveItems[0].Type != utils.ArchiveTypeGit):
+			t.Errorf("%s: child = %+v, want a fresh git capture", row.Path, child)
+		}
+		if row.Path == "lib/stale" && child.ID == stale.ID {
+			t.Error("a capture older than the parent was reused")
+		}
+		if row.Path == "lib/new" {
+			fresh = child
+		}
+	}
+
+	// The new submodule's own submodule points back at the parent, which
+	// has completed since: it is aliased rather than captured again, since
+	// it was taken when the chain began.
+	db.Model(&models.ArchiveItem{}).Where("capture_id = ?", parent.ID).Update("status", "completed")
+	var childItem models.ArchiveItem
+	db.Where("capture_id = ?", fresh.ID).First(&childItem)
+	back := []archivers.GitSubmoduleRef{{Path: "app", URL: parentURL, Commit: "5555"}}
+	if err := expandSubmodules(context.Background(), db, nil, &childItem, back, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	var cycle models.GitSubmodule
+	db.Where("parent_capture_id = ?", fresh.ID).Preload("ChildCapture").First(&cycle)
+	if cycle.ChildCapture.AliasOfID == nil || *cycle.ChildCapture.AliasOfID != parent.ID {
+		t.Errorf("cyclic submodule = %+v, want an alias of the parent", cycle.ChildCapture)
+	}
+
+	// A retried job adds nothing.
+	var captures int64
+	db.Model(&models.Capture{}).Count(&captures)
+	if err := expandSubmodules(context.Background(), db, nil, &item, submodules, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	var after int64
+	db.Model(&models.Capture{}).Count(&after)
+	if after != captures {
+		t.Errorf("re-expanding created %d more captures", after-captures)
+	}
+}
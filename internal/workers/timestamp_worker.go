@@ -0,0 +1,130 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/riverqueue/river"
+	"gorm.io/gorm"
+
+	"arker/internal/models"
+	"arker/internal/storage"
+	"arker/internal/timestamp"
+)
+
+// TimestampJobArgs is the payload for timestamping a signed manifest.
+type TimestampJobArgs struct {
+	ManifestID uint `json:"manifest_id"`
+}
+
+// Kind returns the job kind for River.
+func (TimestampJobArgs) Kind() string { return "timestamp" }
+
+// TimestampWorker has a time-stamping authority stamp each signed capture
+// manifest, and stores the authority's reply beside it. It is queued by the
+// manifest worker when a TSA is configured.
+type TimestampWorker struct {
+	river.WorkerDefaults[TimestampJobArgs]
+	storage storage.Storage
+	db      *gorm.DB
+	tsa     *timestamp.Authority
+}
+
+// NewTimestampWorker creates a new manifest timestamping worker. With a nil
+// tsa it drops the jobs it is given.
+func NewTimestampWorker(store storage.Storage, db *gorm.DB, tsa *timestamp.Authority) *TimestampWorker {
+	return &TimestampWorker{storage: store, db: db, tsa: tsa}
+}
+
+// Work timestamps one manifest.
+func (w *TimestampWorker) Work(ctx context.Context, job *river.Job[TimestampJobArgs]) error {
+	return w.stamp(ctx, job.Args)
+}
+
+// stamp is Work without the River envelope, so it can be exercised directly.
+//
+// The digest stamped is the SHA-256 of the manifest envelope exactly as
+// stored and served, so the reply checks against a downloaded manifest.sig
+// with any RFC 3161 tool, not only `arker verify`.
+func (w *TimestampWorker) stamp(ctx context.Context, args TimestampJobArgs) error {
+	logger := slog.With("worker", "timestamp", "manifest_id", args.ManifestID)
+	if w.tsa == nil {
+		// Queued before TSA_URL was unset.
+		logger.Info("Timestamping is off; dropping timestamp job")
+		return nil
+	}
+
+	var record models.CaptureManifest
+	if err := w.db.First(&record, args.ManifestID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.Warn("Manifest no longer exists; dropping timestamp job")
+			return nil
+		}
+		return fmt.Errorf("timestamp: finding manifest %d: %w", args.ManifestID, err)
+	}
+	var existing int64
+	if err := w.db.Model(&models.CaptureTimestamp{}).Where("capture_manifest_id = ?", record.ID).Count(&existing).Error; err != nil {
+		return fmt.Errorf("timestamp: checking manifest %d: %w", record.ID, err)
+	}
+	if existing > 0 {
+		return nil
+	}
+	var capture models.Capture
+	if err := w.db.Select("id", "short_id").First(&capture, record.CaptureID).Error; err != nil {
+		return fmt.Errorf("timestamp: finding capture %d: %w", record.CaptureID, err)
+	}
+
+	r, err := w.storage.Reader(record.StorageKey)
+	if err != nil {
+		return fmt.Errorf("timestamp: opening %s: %w", record.StorageKey, err)
+	}
+	envelope, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return fmt.Errorf("timestamp: reading %s: %w", record.StorageKey, err)
+	}
+
+	reply, token, err := w.tsa.Stamp(ctx, timestamp.Digest(envelope))
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("%s/timestamp-%s.tsr", capture.ShortID, uploadNonce())
+	if err := writeStored(w.storage, key, reply); err != nil {
+		return fmt.Errorf("timestamp: storing %s: %w", key, err)
+	}
+	stamp := models.CaptureTimestamp{
+		CaptureManifestID: record.ID,
+		CaptureID:         record.CaptureID,
+		StorageKey:        key,
+		TSAURL:            w.tsa.URL,
+		TSAName:           token.TSA,
+		Time:              token.Time,
+		SerialNumber:      token.SerialNumber.String(),
+	}
+	if err := w.db.Create(&stamp).Error; err != nil {
+		return fmt.Errorf("timestamp: recording %s: %w", key, err)
+	}
+
+	logger.Info("Capture manifest timestamped", "short_id", capture.ShortID, "key", key, "time", token.Time, "tsa", token.TSA)
+	return nil
+}
+
+// EnqueueTimestamp requests a timestamp for a signed manifest.
+func EnqueueTimestamp(ctx context.Context, riverClient *river.Client[pgx.Tx], manifestID uint) error {
+	if riverClient == nil {
+		return nil
+	}
+	_, err := riverClient.Insert(ctx, TimestampJobArgs{ManifestID: manifestID}, &river.InsertOpts{
+		// A TSA outage is waited out: River's backoff spreads ten attempts
+		// over about four hours.
+		MaxAttempts: 10,
+		Tags:        []string{"timestamp"},
+		UniqueOpts:  river.UniqueOpts{ByArgs: true},
+	})
+	return err
+}
@@ -0,0 +1,108 @@
+package workers
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"arker/internal/models"
+	"arker/internal/storage"
+	"arker/internal/timestamp"
+	"arker/internal/timestamp/tsatest"
+)
+
+func TestTimestampWorkerStampsStoredManifest(t *testing.T) {
+	tsa := tsatest.NewServer()
+	defer tsa.Close()
+	stamped := time.Date(2026, 5, 6, 7, 8, 9, 0, time.UTC)
+	tsa.SetNow(func() time.Time { return stamped })
+
+	mw, db, store := newManifestTestWorker(t)
+	if err := db.AutoMigrate(&models.CaptureTimestamp{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	putObject(t, store, "abc12/mhtml-aa.mhtml", []byte("page"))
+	seedItem(t, db, "abc12", "mhtml", "completed", "abc12/mhtml-aa.mhtml")
+	if err := mw.sign(context.Background(), ManifestJobArgs{ShortID: "abc12"}); err != nil {
+		t.Fatal(err)
+	}
+	var record models.CaptureManifest
+	db.First(&record)
+
+	w := NewTimestampWorker(store, db, tsa.Authority())
+	if err := w.stamp(context.Background(), TimestampJobArgs{ManifestID: record.ID}); err != nil {
+		t.Fatalf("stamp: %v", err)
+	}
+	var stamps []models.CaptureTimestamp
+	db.Find(&stamps)
+	if len(stamps) != 1 {
+		t.Fatalf("stamps = %+v", stamps)
+	}
+	got := stamps[0]
+	if got.CaptureManifestID != record.ID || got.CaptureID != record.CaptureID || !got.Time.Equal(stamped) ||
+		got.TSAURL != tsa.URL || !strings.Contains(got.TSAName, "tsatest TSA") || got.SerialNumber != "1" {
+		t.Errorf("stamp = %+v", got)
+	}
+	if !strings.HasPrefix(got.StorageKey, "abc12/timestamp-") || !strings.HasSuffix(got.StorageKey, ".tsr") {
+		t.Errorf("StorageKey = %q", got.StorageKey)
+	}
+
+	// The stored reply stamps the manifest as stored.
+	envelope := readObject(t, store, record.StorageKey)
+	reply := readObject(t, store, got.StorageKey)
+	if _, err := timestamp.Verify(reply, timestamp.Digest(envelope), tsa.Roots); err != nil {
+		t.Errorf("stored reply does not verify: %v", err)
+	}
+
+	// A manifest is stamped once.
+	if err := w.stamp(context.Background(), TimestampJobArgs{ManifestID: record.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if tsa.Requests() != 1 {
+		t.Errorf("TSA asked %d times, want 1", tsa.Requests())
+	}
+}
+
+func TestTimestampWorkerRetriesRefusal(t *testing.T) {
+	tsa := tsatest.NewServer()
+	defer tsa.Close()
+	tsa.Refuse(true)
+
+	mw, db, store := newManifestTestWorker(t)
+	if err := db.AutoMigrate(&models.CaptureTimestamp{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	putObject(t, store, "abc12/mhtml-aa.mhtml", []byte("page"))
+	seedItem(t, db, "abc12", "mhtml", "completed", "abc12/mhtml-aa.mhtml")
+	if err := mw.sign(context.Background(), ManifestJobArgs{ShortID: "abc12"}); err != nil {
+		t.Fatal(err)
+	}
+	var record models.CaptureManifest
+	db.First(&record)
+
+	w := NewTimestampWorker(store, db, tsa.Authority())
+	if err := w.stamp(context.Background(), TimestampJobArgs{ManifestID: record.ID}); err == nil {
+		t.Fatal("a refused timestamp was not retried")
+	}
+	var count int64
+	db.Model(&models.CaptureTimestamp{}).Count(&count)
+	if count != 0 {
+		t.Errorf("a refused timestamp was recorded")
+	}
+}
+
+func readObject(t *testing.T, store storage.Storage, key string) []byte {
+	t.Helper()
+	r, err := store.Reader(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -230,7 +230,7 @@ func TestGetArchiveTypes(t *testing.T) {
 		{
 			name:     "GitHub repository",
 			url:      "https://github.com/user/repo",
-			expected: []string{"mhtml", "screenshot", "git"},
+			expected: []string{"mhtml", "screenshot", "git", "forge"},
 		},
 		{
 			name:     "GitHub user profile",